@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressionGuard(t *testing.T) {
+	large := `{"data":{"files":[` + strings.Repeat(`{"name":"report.pdf"},`, 200) + `]}}`
+	cases := []struct {
+		name, body, contentType, acceptEncoding string
+		wantEncoding                            string
+	}{
+		{name: "large response is compressed", body: large, contentType: "application/json", acceptEncoding: "gzip, deflate", wantEncoding: "gzip"},
+		{name: "small response is not", body: `{"data":{}}`, contentType: "application/json", acceptEncoding: "gzip", wantEncoding: ""},
+		{name: "deflate when gzip is refused", body: large, contentType: "application/json", acceptEncoding: "gzip;q=0, deflate", wantEncoding: "deflate"},
+		{name: "client without compression", body: large, contentType: "application/json", acceptEncoding: "", wantEncoding: ""},
+		{name: "zip downloads pass through", body: large, contentType: "application/zip", acceptEncoding: "gzip", wantEncoding: ""},
+	}
+	for _, c := range cases {
+		h := compressionGuard(true, 1024, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", c.contentType)
+			// written in pieces, as a streaming handler would
+			for i := 0; i < len(c.body); i += 100 {
+				io.WriteString(w, c.body[i:min(i+100, len(c.body))])
+			}
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		if c.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != c.wantEncoding {
+			t.Fatalf("%s: expected Content-Encoding %q, got %q", c.name, c.wantEncoding, got)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Fatalf("%s: expected Vary: Accept-Encoding, got %q", c.name, got)
+		}
+		body := rec.Body.Bytes()
+		switch c.wantEncoding {
+		case "gzip":
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s: gzip reader: %v", c.name, err)
+			}
+			if body, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: reading gzip body: %v", c.name, err)
+			}
+		case "deflate":
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s: zlib reader: %v", c.name, err)
+			}
+			if body, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: reading deflate body: %v", c.name, err)
+			}
+		}
+		if string(body) != c.body {
+			t.Fatalf("%s: body mismatch: got %d bytes, want %d", c.name, len(body), len(c.body))
+		}
+	}
+}
+
+func TestCompressionGuard_Disabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := compressionGuard(false, 1024, next)
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Vary") != "" {
+		t.Fatalf("disabled guard should not touch the response")
+	}
+}
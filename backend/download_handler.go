@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/repository"
+	"github.com/useradityaa/internal/services"
+)
+
+// selectedZipRequest is the body of POST /download/zip
+type selectedZipRequest struct {
+	MappingIDs []string `json:"mappingIds"`
+}
+
+// selectedZipHandler streams a ZIP of the caller's selected files. A GraphQL response
+// can't carry a streamed archive, so "download selected" posts the mapping IDs here
+// with the same bearer token used for /query. Mappings that were skipped are listed
+// in the X-Skipped-Files header.
+func selectedZipHandler(fileService *services.FileService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userIDStr, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			http.Error(w, "invalid user id in token", http.StatusUnauthorized)
+			return
+		}
+		if !middleware.HasScope(r.Context(), auth.ScopeFilesRead) {
+			http.Error(w, "forbidden: api token lacks the "+auth.ScopeFilesRead+" scope", http.StatusForbidden)
+			return
+		}
+		if fileService == nil {
+			http.Error(w, services.ErrStorageUnavailable.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		var req selectedZipRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		ids := make([]uuid.UUID, 0, len(req.MappingIDs))
+		for _, s := range req.MappingIDs {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				http.Error(w, "invalid mapping id", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+
+		// Resolve access before writing, so errors can still be reported with a status code
+		files, skipped, err := fileService.SelectZipFiles(r.Context(), userID, ids)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(files) == 0 {
+			http.Error(w, "none of the selected files can be downloaded", http.StatusNotFound)
+			return
+		}
+		if len(skipped) > 0 {
+			names := make([]string, len(skipped))
+			for i, id := range skipped {
+				names[i] = id.String()
+			}
+			w.Header().Set("X-Skipped-Files", strings.Join(names, ","))
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "files.zip"))
+		if err := fileService.WriteZip(r.Context(), files, w); err != nil {
+			// Headers are already sent; the truncated archive fails to open on the client
+			log.Printf("warning: selected files zip for user %s: %v", userID, err)
+		}
+	})
+}
+
+// signedDownloadHandler serves encrypted files, decrypted, at the signed URLs download
+// links point to for them: GET /download/file/<file id>?expires=&disposition=&signature=.
+// The signature is the authorization, so it needs no bearer token, like a presigned URL.
+func signedDownloadHandler(fileService *services.FileService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fileID, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, "/download/file/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if fileService == nil {
+			http.Error(w, services.ErrStorageUnavailable.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		q := r.URL.Query()
+		dl, err := fileService.OpenSignedDownload(r.Context(), fileID, q.Get("expires"), q.Get("disposition"), q.Get("signature"), time.Now())
+		switch {
+		case errors.Is(err, services.ErrDownloadLinkInvalid), errors.Is(err, services.ErrFileQuarantined):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, repository.ErrNotFound):
+			http.NotFound(w, r)
+			return
+		case err != nil:
+			log.Printf("warning: signed download of file %s: %v", fileID, err)
+			http.Error(w, "download failed", http.StatusInternalServerError)
+			return
+		}
+		defer dl.Content.Close()
+		w.Header().Set("Content-Type", dl.MimeType)
+		w.Header().Set("Content-Disposition", dl.Disposition)
+		w.Header().Set("Content-Length", strconv.FormatInt(dl.Size, 10))
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, dl.Content); err != nil {
+			// Headers are already sent; the client sees a short body
+			log.Printf("warning: signed download of file %s: %v", fileID, err)
+		}
+	})
+}
@@ -0,0 +1,655 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/graph/model"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+	"github.com/useradityaa/internal/services"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// toRepoFileSort maps the GraphQL FileSort enum onto the repository ordering.
+// A nil sort keeps the default upload-time ordering.
+func toRepoFileSort(sort *model.FileSort) repository.FileSort {
+	if sort != nil && *sort == model.FileSortLastAccessedAt {
+		return repository.SortByLastAccessed
+	}
+	return repository.SortByUploadedAt
+}
+
+// toRepoSearchScope maps the GraphQL scope enum onto the repository's; nil searches everything.
+func toRepoSearchScope(scope *model.SearchScope) repository.SearchScope {
+	if scope == nil {
+		return repository.ScopeAll
+	}
+	switch *scope {
+	case model.SearchScopeFolder:
+		return repository.ScopeFolder
+	case model.SearchScopeRoot:
+		return repository.ScopeRoot
+	}
+	return repository.ScopeAll
+}
+
+func toRepoFilenameMatch(match *model.FilenameMatch) repository.FilenameMatch {
+	if match == nil {
+		return repository.MatchContains
+	}
+	switch *match {
+	case model.FilenameMatchPrefix:
+		return repository.MatchPrefix
+	case model.FilenameMatchExact:
+		return repository.MatchExact
+	}
+	return repository.MatchContains
+}
+
+// parseUploadVisibility validates an upload's visibility argument; nil or empty leaves the
+// choice to the file service's default.
+func parseUploadVisibility(v *string) (string, error) {
+	if v == nil || strings.TrimSpace(*v) == "" {
+		return "", nil
+	}
+	return services.ParseVisibility(*v)
+}
+
+// toUploadOrder maps the upload input's order and priority onto the file service's
+// UploadOrder. A priority list is only accepted together with PRIORITY order.
+func toUploadOrder(order *model.UploadOrder, priority []int) (services.UploadOrder, error) {
+	o := model.UploadOrderSubmitted
+	if order != nil {
+		o = *order
+	}
+	switch o {
+	case model.UploadOrderSmallestFirst:
+		if priority != nil {
+			return services.UploadOrder{}, fmt.Errorf("priority is only used with PRIORITY order")
+		}
+		return services.UploadOrder{SmallestFirst: true}, nil
+	case model.UploadOrderPriority:
+		if priority == nil {
+			return services.UploadOrder{}, fmt.Errorf("PRIORITY order needs a priority for each file")
+		}
+		return services.UploadOrder{Priority: priority}, nil
+	}
+	if priority != nil {
+		return services.UploadOrder{}, fmt.Errorf("priority is only used with PRIORITY order")
+	}
+	return services.UploadOrder{}, nil
+}
+
+// toNameConflict maps the upload input's name conflict policy onto the file service's.
+func toNameConflict(policy *model.NameConflict) services.NameConflict {
+	if policy == nil {
+		return services.NameConflictAllow
+	}
+	switch *policy {
+	case model.NameConflictRename:
+		return services.NameConflictRename
+	case model.NameConflictReject:
+		return services.NameConflictReject
+	}
+	return services.NameConflictAllow
+}
+
+// toDeleteMode maps a delete mutation's mode onto the file service's; nil keeps the
+// server default. Only admins may choose a mode.
+func toDeleteMode(mode *model.DeleteMode, isAdmin bool) (services.DeleteMode, error) {
+	if mode == nil {
+		return "", nil
+	}
+	if !isAdmin {
+		return "", fmt.Errorf("unauthorized: only admins can choose the delete mode")
+	}
+	if *mode == model.DeleteModeImmediate {
+		return services.DeleteModeImmediate, nil
+	}
+	return services.DeleteModeTrash, nil
+}
+
+// uploadFailureError describes a skipped file as a GraphQL error whose extensions name the
+// file's position in the request and, for validation rejections, its reason code, so
+// clients can tell exactly which files failed and why.
+func uploadFailureError(f services.UploadFailure) *gqlerror.Error {
+	var reason interface{}
+	if r := f.Reason(); r != "" {
+		reason = string(r)
+	}
+	return &gqlerror.Error{
+		Message: fmt.Sprintf("failed to upload %s: %v", f.Filename, f.Err),
+		Extensions: map[string]interface{}{
+			"index":         f.Index,
+			"filename":      f.Filename,
+			"quotaExceeded": errors.Is(f.Err, services.ErrQuotaExceeded),
+			"nameConflict":  errors.Is(f.Err, services.ErrNameConflict),
+			"reason":        reason,
+		},
+	}
+}
+
+// toModelUploadRejection reports a file an upload didn't store; reason stays null for
+// failures that aren't validation rejections.
+func toModelUploadRejection(f services.UploadFailure) *model.UploadRejection {
+	rejection := &model.UploadRejection{
+		Index:    f.Index,
+		Filename: f.Filename,
+		Message:  f.Err.Error(),
+	}
+	if reason := model.UploadRejectionReason(f.Reason()); reason.IsValid() {
+		rejection.Reason = &reason
+	}
+	return rejection
+}
+
+// toModelBulkShareResults converts the per-file, per-email outcomes of a bulk share.
+func toModelBulkShareResults(results []services.BulkShareResult) []*model.BulkShareResult {
+	out := make([]*model.BulkShareResult, len(results))
+	for i, r := range results {
+		out[i] = &model.BulkShareResult{FileID: r.FileID.String(), SharedWithEmail: r.Email}
+		if r.Share != nil {
+			id := r.Share.ID.String()
+			out[i].ShareID = &id
+		}
+		if r.Error != "" {
+			out[i].Error = &r.Error
+		}
+		if r.NotifyError != "" {
+			out[i].NotificationError = &r.NotifyError
+		}
+	}
+	return out
+}
+
+// toModelFileMoveResults converts the per-file outcomes of a bulk move.
+func toModelFileMoveResults(results []services.FileMoveResult) []*model.FileMoveResult {
+	out := make([]*model.FileMoveResult, len(results))
+	for i, r := range results {
+		out[i] = &model.FileMoveResult{MappingID: r.MappingID.String(), Moved: r.Moved, Error: optionalString(r.Error)}
+	}
+	return out
+}
+
+// notifyFailureError reports a recipient who wasn't told about a share created for them.
+// The share mutation still succeeds, so this is returned alongside its data.
+func notifyFailureError(f services.NotifyFailure) *gqlerror.Error {
+	return &gqlerror.Error{
+		Message: f.Error(),
+		Extensions: map[string]interface{}{
+			"sharedWithEmail":    f.Email,
+			"notificationFailed": true,
+		},
+	}
+}
+
+// toModelRestoreTrashResult converts the outcome of restoring a user's whole trash.
+func toModelRestoreTrashResult(r *services.TrashRestore) *model.RestoreTrashResult {
+	out := &model.RestoreTrashResult{Restored: r.Restored, Skipped: []*model.RestoreTrashSkip{}}
+	for _, s := range r.Skipped {
+		out.Skipped = append(out.Skipped, &model.RestoreTrashSkip{
+			MappingID: s.MappingID.String(),
+			FileID:    s.FileID.String(),
+			Filename:  s.Filename,
+			Reason:    s.Reason,
+		})
+	}
+	return out
+}
+
+// toModelAPIToken converts an API token for listing; the hash never leaves the server.
+func toModelAPIToken(t models.APIToken) *model.APIToken {
+	return &model.APIToken{
+		ID:         t.ID.String(),
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
+		LastUsedAt: formatOptionalTime(t.LastUsedAt),
+	}
+}
+
+// toModelUploadSession converts an upload session for its client; the object storage
+// details stay on the server.
+func toModelUploadSession(s models.UploadSession) *model.UploadSession {
+	return &model.UploadSession{
+		ID:         s.ID.String(),
+		Filename:   s.Filename,
+		TotalSize:  int(s.TotalSize),
+		ChunkSize:  int(s.ChunkSize),
+		ChunkCount: int((s.TotalSize + s.ChunkSize - 1) / s.ChunkSize),
+		ExpiresAt:  s.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+// toModelOrganization converts an organization and its members' total usage.
+func toModelOrganization(org models.Organization, used int64) *model.Organization {
+	return &model.Organization{
+		ID:         org.ID.String(),
+		Name:       org.Name,
+		QuotaBytes: int(org.QuotaBytes),
+		UsedBytes:  int(used),
+		CreatedAt:  org.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// formatOptionalTime renders a nullable timestamp as an optional RFC3339 string.
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+// optionalString maps an empty string to null.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// stringValue maps null to the empty string.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// formatVersion renders an updated_at version with full precision so clients can echo it
+// back unchanged for optimistic concurrency checks.
+func formatVersion(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.Format(time.RFC3339Nano)
+	return &s
+}
+
+// toModelFolder converts a folder record into its GraphQL shape.
+func toModelFolder(f models.Folder) *model.Folder {
+	var parentID *string
+	if f.ParentID != nil {
+		p := f.ParentID.String()
+		parentID = &p
+	}
+	return &model.Folder{
+		ID:          f.ID.String(),
+		Name:        f.Name,
+		ParentID:    parentID,
+		CreatedAt:   f.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   formatVersion(f.UpdatedAt),
+		Description: optionalString(f.Description),
+		DeletedAt:   formatOptionalTime(f.DeletedAt),
+	}
+}
+
+// toModelFolderTree converts a folder tree, children included.
+func toModelFolderTree(nodes []*services.FolderTreeNode) []*model.FolderTreeNode {
+	out := make([]*model.FolderTreeNode, 0, len(nodes))
+	for _, n := range nodes {
+		out = append(out, &model.FolderTreeNode{
+			Folder:         toModelFolder(n.Folder),
+			HasChildren:    n.HasChildren,
+			ChildrenLoaded: n.ChildrenLoaded,
+			Children:       toModelFolderTree(n.Children),
+		})
+	}
+	return out
+}
+
+// toModelUserFile converts a user-file mapping (with its joined file and uploader) into its GraphQL shape.
+func toModelUserFile(uf models.UserFile) *model.UserFile {
+	var folderID *string
+	if uf.FolderID != nil {
+		f := uf.FolderID.String()
+		folderID = &f
+	}
+	return &model.UserFile{
+		ID:             uf.ID.String(),
+		UserID:         uf.UserID.String(),
+		FileID:         uf.FileID.String(),
+		UploadedAt:     uf.UploadedAt.Format(time.RFC3339),
+		FolderID:       folderID,
+		LastAccessedAt: formatOptionalTime(uf.LastAccessedAt),
+		File:           toModelFile(uf.File),
+		Uploader:       toModelUploader(uf.UploaderEmail, uf.UploaderName, uf.UploaderPicture),
+		DownloadStats:  toModelDownloadCounts(uf.DownloadStats),
+		Description:    optionalString(uf.Description),
+	}
+}
+
+// toModelFile converts a file record into its GraphQL shape.
+func toModelFile(f models.File) *model.File {
+	return &model.File{
+		ID:           f.ID.String(),
+		Hash:         f.Hash,
+		OriginalName: f.OriginalName,
+		MimeType:     f.MimeType,
+		Size:         int(f.Size),
+		RefCount:     f.RefCount,
+		Visibility:   f.Visibility,
+		CreatedAt:    f.CreatedAt.Format(time.RFC3339),
+		Quarantined:  f.Status == models.FileStatusQuarantined,
+	}
+}
+
+// toModelUploadFailure converts a logged upload failure for the admin listing.
+func toModelUploadFailure(f models.UploadFailure) *model.UploadFailureLog {
+	return &model.UploadFailureLog{
+		ID:        f.ID.String(),
+		UserID:    f.UserID.String(),
+		UserEmail: f.UserEmail,
+		Filename:  f.Filename,
+		Size:      int(f.Size),
+		Reason:    f.Reason,
+		Message:   f.Message,
+		CreatedAt: f.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// toModelQuarantinedFile is toModelUserFile plus the scanner's reason, for admin listings.
+func toModelQuarantinedFile(uf models.UserFile) *model.UserFile {
+	out := toModelUserFile(uf)
+	if uf.File.QuarantineReason != "" {
+		reason := uf.File.QuarantineReason
+		out.File.QuarantineReason = &reason
+	}
+	return out
+}
+
+// toModelUploader builds the uploader/creator shape; empty name and picture become null.
+func toModelUploader(email, name, picture string) *model.Uploader {
+	u := &model.Uploader{Email: email}
+	if name != "" {
+		u.Name = &name
+	}
+	if picture != "" {
+		u.Picture = &picture
+	}
+	return u
+}
+
+// toModelSharedFolder converts a folder from a shared folder listing, including its creator.
+func toModelSharedFolder(f models.Folder) *model.Folder {
+	out := toModelFolder(f)
+	if f.CreatorEmail != "" {
+		out.Creator = toModelUploader(f.CreatorEmail, f.CreatorName, f.CreatorPicture)
+	}
+	return out
+}
+
+// toModelDownloadCounts converts attached download stats; nil when the listing didn't ask for them.
+func toModelDownloadCounts(st *models.FileDownloadStats) *model.FileDownloadCounts {
+	if st == nil {
+		return nil
+	}
+	return &model.FileDownloadCounts{
+		TotalDownloads:  int(st.TotalDownloads),
+		SharedDownloads: int(st.SharedDownloads),
+		PublicDownloads: int(st.PublicDownloads),
+		LastDownloadAt:  formatOptionalTime(st.LastDownloadAt),
+	}
+}
+
+// uploadFolderDir returns the directory of a folder-upload file relative to the uploaded
+// root folder: the relative path without its file name and without a leading component
+// equal to the root folder's name, since that folder is created separately.
+func uploadFolderDir(relativePath, folderName string) string {
+	parts := strings.Split(relativePath, "/")
+	if len(parts) <= 1 {
+		return ""
+	}
+	dirParts := parts[:len(parts)-1]
+	if dirParts[0] == folderName {
+		dirParts = dirParts[1:]
+	}
+	return strings.Join(dirParts, "/")
+}
+
+// toModelAdminUserInfo converts a user's admin summary.
+func toModelAdminUserInfo(u *models.AdminUserInfo) *model.AdminUserInfo {
+	return &model.AdminUserInfo{
+		ID:           u.ID.String(),
+		Email:        u.Email,
+		Name:         &u.Name,
+		Picture:      &u.Picture,
+		CreatedAt:    u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    u.UpdatedAt.Format(time.RFC3339),
+		TotalFiles:   u.TotalFiles,
+		TotalFolders: u.TotalFolders,
+		StorageUsed:  int(u.StorageUsed),
+	}
+}
+
+// toModelShareOwner converts the owner joined to a share, which carries only id, email and
+// creation time.
+func toModelShareOwner(u models.User) *model.User {
+	return &model.User{
+		ID:        u.ID.String(),
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: u.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// toModelFileShare converts a file share with its joined file.
+func toModelFileShare(share models.FileShare, owner *model.User) *model.FileShare {
+	var sharedWithID *string
+	if share.SharedWithID != nil {
+		id := share.SharedWithID.String()
+		sharedWithID = &id
+	}
+	return &model.FileShare{
+		ID:              share.ID.String(),
+		FileID:          share.FileID.String(),
+		OwnerID:         share.OwnerID.String(),
+		SharedWithEmail: share.SharedWithEmail,
+		SharedWithID:    sharedWithID,
+		Permission:      share.Permission,
+		SharedAt:        share.SharedAt.Format(time.RFC3339),
+		ExpiresAt:       formatOptionalTime(share.ExpiresAt),
+		File:            toModelFile(share.File),
+		Owner:           owner,
+	}
+}
+
+// toModelFolderShare converts a folder share with its joined folder.
+func toModelFolderShare(share models.FolderShare, owner *model.User) *model.FolderShare {
+	var sharedWithID *string
+	if share.SharedWithID != nil {
+		id := share.SharedWithID.String()
+		sharedWithID = &id
+	}
+	return &model.FolderShare{
+		ID:              share.ID.String(),
+		FolderID:        share.FolderID.String(),
+		OwnerID:         share.OwnerID.String(),
+		SharedWithEmail: share.SharedWithEmail,
+		SharedWithID:    sharedWithID,
+		Permission:      share.Permission,
+		SharedAt:        share.SharedAt.Format(time.RFC3339),
+		ExpiresAt:       formatOptionalTime(share.ExpiresAt),
+		Folder:          toModelFolder(share.Folder),
+		Owner:           owner,
+	}
+}
+
+// toModelSharesCreatedByMe converts the shares a user has created. The lists are never null.
+func toModelSharesCreatedByMe(s *services.SharesByMe) *model.SharesCreatedByMe {
+	out := &model.SharesCreatedByMe{
+		FileShares:          []*model.FileShare{},
+		FolderShares:        []*model.FolderShare{},
+		ExpiredFileShares:   []*model.FileShare{},
+		ExpiredFolderShares: []*model.FolderShare{},
+	}
+	for _, sh := range s.FileShares {
+		out.FileShares = append(out.FileShares, toModelFileShare(sh, toModelShareOwner(sh.Owner)))
+	}
+	for _, sh := range s.FolderShares {
+		out.FolderShares = append(out.FolderShares, toModelFolderShare(sh, toModelShareOwner(sh.Owner)))
+	}
+	for _, sh := range s.ExpiredFileShares {
+		out.ExpiredFileShares = append(out.ExpiredFileShares, toModelFileShare(sh, toModelShareOwner(sh.Owner)))
+	}
+	for _, sh := range s.ExpiredFolderShares {
+		out.ExpiredFolderShares = append(out.ExpiredFolderShares, toModelFolderShare(sh, toModelShareOwner(sh.Owner)))
+	}
+	return out
+}
+
+// toModelAdminUserDetail converts the admin drill-down. files holds the files of the recent
+// activity; activity on files that no longer exist is left out.
+func toModelAdminUserDetail(d *models.AdminUserDetail, files map[uuid.UUID]*models.File) *model.AdminUserDetail {
+	user := toModelAdminUserInfo(d.User)
+	self := &model.User{ID: user.ID, Email: user.Email, Name: user.Name, Picture: user.Picture, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt}
+	out := &model.AdminUserDetail{
+		User:                 user,
+		OutgoingFileShares:   []*model.FileShare{},
+		OutgoingFolderShares: []*model.FolderShare{},
+		IncomingFileShares:   []*model.FileShare{},
+		IncomingFolderShares: []*model.FolderShare{},
+		PublicLinks:          []*model.AdminPublicLink{},
+		RecentActivity:       []*model.RecentFileActivity{},
+		Downloads:            int(d.Downloads),
+		TrashFiles:           d.TrashFiles,
+		TrashBytes:           int(d.TrashBytes),
+	}
+	for _, sh := range d.OutgoingFileShares {
+		out.OutgoingFileShares = append(out.OutgoingFileShares, toModelFileShare(sh, self))
+	}
+	for _, sh := range d.OutgoingFolderShares {
+		out.OutgoingFolderShares = append(out.OutgoingFolderShares, toModelFolderShare(sh, self))
+	}
+	for _, sh := range d.IncomingFileShares {
+		out.IncomingFileShares = append(out.IncomingFileShares, toModelFileShare(sh, toModelShareOwner(sh.Owner)))
+	}
+	for _, sh := range d.IncomingFolderShares {
+		out.IncomingFolderShares = append(out.IncomingFolderShares, toModelFolderShare(sh, toModelShareOwner(sh.Owner)))
+	}
+	for _, l := range d.PublicLinks {
+		out.PublicLinks = append(out.PublicLinks, &model.AdminPublicLink{
+			ItemType:    l.ItemType,
+			ItemID:      l.ItemID.String(),
+			ItemName:    l.ItemName,
+			CreatedAt:   l.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:   formatOptionalTime(l.ExpiresAt),
+			AccessCount: int(l.AccessCount),
+		})
+	}
+	for _, a := range d.RecentActivity {
+		f := files[a.FileID]
+		if f == nil {
+			continue
+		}
+		out.RecentActivity = append(out.RecentActivity, toModelRecentActivity(a, *f))
+	}
+	return out
+}
+
+func toModelRecentActivity(a models.RecentFileActivity, f models.File) *model.RecentFileActivity {
+	return &model.RecentFileActivity{
+		FileID:           a.FileID.String(),
+		UserID:           a.UserID.String(),
+		LastActivityType: a.LastActivityType,
+		LastActivityAt:   a.LastActivityAt.Format(time.RFC3339),
+		ActivityCount:    a.ActivityCount,
+		File:             toModelFile(f),
+	}
+}
+
+// toModelDashboard converts the home screen; activity whose file wasn't loaded is left out.
+func toModelDashboard(d *services.Dashboard) *model.Dashboard {
+	out := &model.Dashboard{
+		UsedBytes:         int(d.UsedBytes),
+		QuotaBytes:        int(d.QuotaBytes),
+		RecentFiles:       []*model.UserFile{},
+		RecentFilesCursor: d.RecentFilesCursor,
+		RecentActivity:    []*model.RecentFileActivity{},
+		Starred:           []*model.StarredItem{},
+		SharedWithMeCount: d.SharedWithMe,
+		TrashFiles:        d.TrashFiles,
+		TrashBytes:        int(d.TrashBytes),
+	}
+	for _, uf := range d.RecentFiles {
+		out.RecentFiles = append(out.RecentFiles, toModelUserFile(uf))
+	}
+	for _, a := range d.RecentActivity {
+		if f := d.ActivityFiles[a.FileID]; f != nil {
+			out.RecentActivity = append(out.RecentActivity, toModelRecentActivity(a, *f))
+		}
+	}
+	for _, si := range d.Starred {
+		out.Starred = append(out.Starred, &model.StarredItem{
+			ID:        si.ID.String(),
+			UserID:    si.UserID.String(),
+			ItemType:  si.ItemType,
+			ItemID:    si.ItemID.String(),
+			StarredAt: si.StarredAt.Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+var publicLinkStatuses = map[services.LinkStatus]model.PublicLinkStatus{
+	services.LinkValid:    model.PublicLinkStatusValid,
+	services.LinkExpired:  model.PublicLinkStatusExpired,
+	services.LinkRevoked:  model.PublicLinkStatusRevoked,
+	services.LinkNotFound: model.PublicLinkStatusNotFound,
+}
+
+func toModelFileLinkInspection(info *services.FileLinkInfo) *model.PublicFileLinkInspection {
+	out := &model.PublicFileLinkInspection{
+		Status:            publicLinkStatuses[info.Status],
+		ExpiresAt:         formatOptionalTime(info.ExpiresAt),
+		PasswordProtected: info.PasswordProtected,
+	}
+	if info.Status == services.LinkValid && !info.PasswordProtected {
+		name, mimeType, size := info.FileName, info.MimeType, int(info.Size)
+		out.FileName, out.MimeType, out.Size = &name, &mimeType, &size
+	}
+	return out
+}
+
+func toModelMyPublicLinks(l *services.MyPublicLinks) *model.MyPublicLinks {
+	out := &model.MyPublicLinks{Links: []*model.MyPublicLink{}, FileLinks: l.FileLinks, FolderLinks: l.FolderLinks}
+	for _, link := range l.Links {
+		out.Links = append(out.Links, &model.MyPublicLink{
+			ItemType:    link.ItemType,
+			ItemID:      link.ItemID.String(),
+			ItemName:    link.ItemName,
+			Token:       link.Token,
+			URL:         fmt.Sprintf("/share/%s", link.Token),
+			CreatedAt:   link.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:   formatOptionalTime(link.ExpiresAt),
+			AccessCount: int(link.AccessCount),
+		})
+	}
+	return out
+}
+
+var linkStatsGranularities = map[string]model.LinkStatsGranularity{
+	services.BucketHour: model.LinkStatsGranularityHour,
+	services.BucketDay:  model.LinkStatsGranularityDay,
+}
+
+func toModelPublicLinkStats(st *services.LinkStats) *model.PublicLinkStats {
+	out := &model.PublicLinkStats{
+		Token:          st.Token,
+		TotalDownloads: int(st.TotalDownloads),
+		Granularity:    linkStatsGranularities[st.Granularity],
+		From:           st.From.Format(time.RFC3339),
+		To:             st.To.Format(time.RFC3339),
+		Buckets:        []*model.DownloadBucket{},
+	}
+	for _, b := range st.Buckets {
+		out.Buckets = append(out.Buckets, &model.DownloadBucket{Start: b.Start.Format(time.RFC3339), Downloads: int(b.Downloads)})
+	}
+	return out
+}
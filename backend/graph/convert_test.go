@@ -0,0 +1,153 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/graph/model"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/services"
+)
+
+func TestToModelSharedFolder_Creator(t *testing.T) {
+	f := models.Folder{ID: uuid.New(), Name: "reports", CreatorEmail: "owner@example.com", CreatorName: "Owner"}
+	out := toModelSharedFolder(f)
+	if out.Creator == nil || out.Creator.Email != "owner@example.com" {
+		t.Fatalf("expected creator email, got %+v", out.Creator)
+	}
+	if out.Creator.Name == nil || *out.Creator.Name != "Owner" || out.Creator.Picture != nil {
+		t.Fatalf("expected name set and picture null, got %+v", out.Creator)
+	}
+
+	// public listings use toModelFolder and never expose the creator
+	if toModelFolder(f).Creator != nil {
+		t.Fatalf("expected plain folder conversion to omit the creator")
+	}
+	if toModelSharedFolder(models.Folder{ID: uuid.New()}).Creator != nil {
+		t.Fatalf("expected no creator when the owner could not be resolved")
+	}
+}
+
+func TestParseUploadVisibility(t *testing.T) {
+	empty, public, bogus := " ", "Public", "everyone"
+	if v, err := parseUploadVisibility(nil); err != nil || v != "" {
+		t.Fatalf("expected nil to defer to the server default, got %q (%v)", v, err)
+	}
+	if v, err := parseUploadVisibility(&empty); err != nil || v != "" {
+		t.Fatalf("expected empty to defer to the server default, got %q (%v)", v, err)
+	}
+	if v, err := parseUploadVisibility(&public); err != nil || v != "public" {
+		t.Fatalf("expected public, got %q (%v)", v, err)
+	}
+	if _, err := parseUploadVisibility(&bogus); err == nil {
+		t.Fatalf("expected unknown visibility to be rejected")
+	}
+}
+
+func TestUploadFolderDir(t *testing.T) {
+	cases := map[string]string{
+		"a.txt":               "",
+		"album/a.txt":         "",
+		"album/2024/a.txt":    "2024",
+		"album/2024/q1/a.txt": "2024/q1",
+		"other/a.txt":         "other",
+		"other/album/x/a.txt": "other/album/x",
+	}
+	for path, want := range cases {
+		if got := uploadFolderDir(path, "album"); got != want {
+			t.Fatalf("uploadFolderDir(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestToUploadOrder(t *testing.T) {
+	smallest, priority := model.UploadOrderSmallestFirst, model.UploadOrderPriority
+	if o, err := toUploadOrder(nil, nil); err != nil || o.SmallestFirst || o.Priority != nil {
+		t.Fatalf("expected no order by default, got %+v (%v)", o, err)
+	}
+	if o, err := toUploadOrder(&smallest, nil); err != nil || !o.SmallestFirst {
+		t.Fatalf("expected smallest-first, got %+v (%v)", o, err)
+	}
+	if o, err := toUploadOrder(&priority, []int{2, 1}); err != nil || len(o.Priority) != 2 {
+		t.Fatalf("expected priority order, got %+v (%v)", o, err)
+	}
+	if _, err := toUploadOrder(&priority, nil); err == nil {
+		t.Fatalf("expected PRIORITY without a priority list to be rejected")
+	}
+	if _, err := toUploadOrder(nil, []int{1}); err == nil {
+		t.Fatalf("expected a priority list without PRIORITY order to be rejected")
+	}
+}
+
+func TestUploadFailureError(t *testing.T) {
+	over := uploadFailureError(services.UploadFailure{Index: 3, Filename: "big.iso", Err: fmt.Errorf("%w: no room", services.ErrQuotaExceeded)})
+	if over.Extensions["index"] != 3 || over.Extensions["filename"] != "big.iso" || over.Extensions["quotaExceeded"] != true {
+		t.Fatalf("unexpected extensions %v", over.Extensions)
+	}
+	other := uploadFailureError(services.UploadFailure{Index: 0, Filename: "a.png", Err: fmt.Errorf("mime mismatch")})
+	if other.Extensions["quotaExceeded"] != false {
+		t.Fatalf("expected non-quota failure to be marked as such, got %v", other.Extensions)
+	}
+	clash := uploadFailureError(services.UploadFailure{Filename: "a.png", Err: fmt.Errorf("%w: taken", services.ErrNameConflict)})
+	if clash.Extensions["nameConflict"] != true || clash.Extensions["quotaExceeded"] != false {
+		t.Fatalf("expected a name conflict to be flagged, got %v", clash.Extensions)
+	}
+	if over.Extensions["reason"] != "QUOTA" || clash.Extensions["reason"] != "NAME_CONFLICT" || other.Extensions["reason"] != nil {
+		t.Fatalf("unexpected reasons %v, %v, %v", over.Extensions["reason"], clash.Extensions["reason"], other.Extensions["reason"])
+	}
+}
+
+func TestToModelUploadRejection(t *testing.T) {
+	mismatch := toModelUploadRejection(services.UploadFailure{Index: 2, Filename: "a.png", Err: fmt.Errorf("%w: text", services.ErrMimeMismatch)})
+	if mismatch.Index != 2 || mismatch.Reason == nil || *mismatch.Reason != model.UploadRejectionReasonMimeMismatch || mismatch.Message != "file type mismatch: text" {
+		t.Fatalf("unexpected rejection %+v", mismatch)
+	}
+	if other := toModelUploadRejection(services.UploadFailure{Filename: "a.txt", Err: fmt.Errorf("storage down")}); other.Reason != nil {
+		t.Fatalf("expected no reason for a storage failure, got %v", *other.Reason)
+	}
+}
+
+func TestToModelFileLinkInspection(t *testing.T) {
+	valid := toModelFileLinkInspection(&services.FileLinkInfo{Status: services.LinkValid, FileName: "report.pdf", MimeType: "application/pdf", Size: 2048})
+	if valid.Status != model.PublicLinkStatusValid || valid.FileName == nil || *valid.FileName != "report.pdf" || valid.Size == nil || *valid.Size != 2048 {
+		t.Fatalf("expected file details for a valid link, got %+v", valid)
+	}
+	for status, want := range publicLinkStatuses {
+		if status == services.LinkValid {
+			continue
+		}
+		out := toModelFileLinkInspection(&services.FileLinkInfo{Status: status, FileName: "leak.pdf"})
+		if out.Status != want || out.FileName != nil || out.Size != nil || out.MimeType != nil {
+			t.Fatalf("%s: expected status %s without file details, got %+v", status, want, out)
+		}
+	}
+}
+
+func TestToModel_Description(t *testing.T) {
+	if d := toModelFolder(models.Folder{ID: uuid.New(), Description: "Tax receipts"}).Description; d == nil || *d != "Tax receipts" {
+		t.Fatalf("expected folder description, got %v", d)
+	}
+	if d := toModelFolder(models.Folder{ID: uuid.New()}).Description; d != nil {
+		t.Fatalf("expected no description to be null, got %q", *d)
+	}
+	if d := toModelUserFile(models.UserFile{ID: uuid.New(), Description: "Signed copy"}).Description; d == nil || *d != "Signed copy" {
+		t.Fatalf("expected file description, got %v", d)
+	}
+	if d := toModelUserFile(models.UserFile{ID: uuid.New()}).Description; d != nil {
+		t.Fatalf("expected no description to be null, got %q", *d)
+	}
+}
+
+func TestToDeleteMode(t *testing.T) {
+	if mode, err := toDeleteMode(nil, false); err != nil || mode != "" {
+		t.Fatalf("expected no mode to keep the server default, got %q (%v)", mode, err)
+	}
+	immediate := model.DeleteModeImmediate
+	if _, err := toDeleteMode(&immediate, false); err == nil {
+		t.Fatalf("expected non-admins to be refused a mode")
+	}
+	if mode, err := toDeleteMode(&immediate, true); err != nil || mode != services.DeleteModeImmediate {
+		t.Fatalf("expected admins to choose immediate, got %q (%v)", mode, err)
+	}
+}
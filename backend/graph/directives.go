@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// NewDirectiveRoot returns the implementations of the schema's authorization directives.
+// They give every annotated field a baseline check before its resolver runs; resolvers
+// still perform their own ownership checks.
+func NewDirectiveRoot() DirectiveRoot {
+	return DirectiveRoot{
+		Auth:  AuthDirective,
+		Admin: AdminDirective,
+		Scope: ScopeDirective,
+	}
+}
+
+// AuthDirective implements @auth: the request must carry an authenticated user.
+// Requests made with an API token are held to its scopes: queries need files:read and
+// mutations without @scope are refused, so new mutations stay closed to tokens until
+// they are given a scope.
+func AuthDirective(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	if _, ok := middleware.GetUserIDFromContext(ctx); !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	if _, viaToken := middleware.GetAPITokenIDFromContext(ctx); viaToken {
+		fc := graphql.GetFieldContext(ctx)
+		if fc != nil && fc.Field.Definition.Directives.ForName("scope") == nil {
+			if fc.Object == "Mutation" {
+				return nil, forbidden(fmt.Sprintf("forbidden: %s is not available to api tokens", fc.Field.Name))
+			}
+			if !middleware.HasScope(ctx, auth.ScopeFilesRead) {
+				return nil, forbidden("forbidden: api token lacks the " + auth.ScopeFilesRead + " scope")
+			}
+		}
+	}
+	return next(ctx)
+}
+
+// ScopeDirective implements @scope: a request made with an API token needs the named
+// scope on the token. Sessions are not limited by scopes.
+func ScopeDirective(ctx context.Context, obj any, next graphql.Resolver, name string) (any, error) {
+	if !middleware.HasScope(ctx, name) {
+		return nil, forbidden("forbidden: api token lacks the " + name + " scope")
+	}
+	return next(ctx)
+}
+
+// forbidden is an authorization error clients can recognise by its FORBIDDEN code.
+func forbidden(msg string) error {
+	return &gqlerror.Error{Message: msg, Extensions: map[string]interface{}{"code": "FORBIDDEN"}}
+}
+
+// AdminDirective implements @admin: the request must carry an authenticated administrator.
+func AdminDirective(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	if _, ok := middleware.GetUserIDFromContext(ctx); !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	return next(ctx)
+}
@@ -3,9 +3,68 @@
 package model
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
 	"github.com/99designs/gqlgen/graphql"
 )
 
+// A long-lived token for programmatic access, sent as Authorization: Bearer <token>
+type APIToken struct {
+	ID string `json:"id"`
+	// Label given when the token was created
+	Name string `json:"name"`
+	// First characters of the token, to tell tokens apart
+	Prefix string `json:"prefix"`
+	// What the token may do: files:read, files:write, share
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"createdAt"`
+	// Last time the token was used (refreshed at most once a minute)
+	LastUsedAt *string `json:"lastUsedAt,omitempty"`
+}
+
+type AccessItemInput struct {
+	ItemType string `json:"itemType"`
+	ItemID   string `json:"itemId"`
+}
+
+// An active public link in the admin drill-down; the token itself is not exposed
+type AdminPublicLink struct {
+	// file or folder
+	ItemType  string  `json:"itemType"`
+	ItemID    string  `json:"itemId"`
+	ItemName  string  `json:"itemName"`
+	CreatedAt string  `json:"createdAt"`
+	ExpiresAt *string `json:"expiresAt,omitempty"`
+	// Downloads of a file link or visits of a folder link
+	AccessCount int `json:"accessCount"`
+}
+
+// A user's account, sharing, links, activity and trash for the admin drill-down
+type AdminUserDetail struct {
+	User *AdminUserInfo `json:"user"`
+	// Unexpired file shares the user created
+	OutgoingFileShares []*FileShare `json:"outgoingFileShares"`
+	// Unexpired folder shares the user created
+	OutgoingFolderShares []*FolderShare `json:"outgoingFolderShares"`
+	// Unexpired file shares sent to the user's email
+	IncomingFileShares []*FileShare `json:"incomingFileShares"`
+	// Unexpired folder shares sent to the user's email
+	IncomingFolderShares []*FolderShare `json:"incomingFolderShares"`
+	// The user's active public links
+	PublicLinks []*AdminPublicLink `json:"publicLinks"`
+	// The user's latest file previews and downloads
+	RecentActivity []*RecentFileActivity `json:"recentActivity"`
+	// How often the user's files were downloaded through shares and public links
+	Downloads int `json:"downloads"`
+	// Number of files in the user's trash
+	TrashFiles int `json:"trashFiles"`
+	// Total size of the files in the user's trash in bytes
+	TrashBytes int `json:"trashBytes"`
+}
+
 // Extended user information for administrative views
 type AdminUserInfo struct {
 	// Unique identifier for the user
@@ -36,6 +95,81 @@ type AuthPayload struct {
 	User *User `json:"user"`
 }
 
+// Most recent run of a background job
+type BackgroundJobStatus struct {
+	// Job name
+	Name string `json:"name"`
+	// ISO timestamp of the last run
+	LastRunAt string `json:"lastRunAt"`
+	// Error from the last run, if it failed
+	LastError *string `json:"lastError,omitempty"`
+}
+
+type BulkShareFilesInput struct {
+	FileIds    []string `json:"fileIds"`
+	Emails     []string `json:"emails"`
+	Permission string   `json:"permission"`
+	ExpiresAt  *string  `json:"expiresAt,omitempty"`
+}
+
+// Outcome of sharing one file with one email in bulkShareFiles
+type BulkShareResult struct {
+	FileID          string `json:"fileId"`
+	SharedWithEmail string `json:"sharedWithEmail"`
+	// The created or updated share; null when error is set
+	ShareID *string `json:"shareId,omitempty"`
+	// Why this file wasn't shared with this email, e.g. the user doesn't own it
+	Error *string `json:"error,omitempty"`
+	// Why the recipient couldn't be emailed about the share; the share was still created. Emails still being sent when the call returns aren't reported
+	NotificationError *string `json:"notificationError,omitempty"`
+}
+
+// A newly created API token with its secret
+type CreatedAPIToken struct {
+	// The full token; it is not stored and can't be shown again
+	Token    string    `json:"token"`
+	APIToken *APIToken `json:"apiToken"`
+}
+
+// Everything the home screen shows
+type Dashboard struct {
+	UsedBytes  int `json:"usedBytes"`
+	QuotaBytes int `json:"quotaBytes"`
+	// The latest uploads, newest first
+	RecentFiles []*UserFile `json:"recentFiles"`
+	// Continues recentFiles as the pagination cursor of searchMyFiles with an empty filter; null when there are no more
+	RecentFilesCursor *string `json:"recentFilesCursor,omitempty"`
+	// The latest previews and downloads
+	RecentActivity []*RecentFileActivity `json:"recentActivity"`
+	// Starred files and folders, most recently starred first
+	Starred []*StarredItem `json:"starred"`
+	// How many files and folders are currently shared with the user
+	SharedWithMeCount int `json:"sharedWithMeCount"`
+	// Files in the trash and their total size
+	TrashFiles int `json:"trashFiles"`
+	TrashBytes int `json:"trashBytes"`
+}
+
+// Health of a single backend dependency
+type DependencyStatus struct {
+	// Dependency name, e.g. postgres or minio
+	Name string `json:"name"`
+	// Whether the dependency responded successfully
+	Up bool `json:"up"`
+	// Time taken by the check in milliseconds
+	LatencyMs float64 `json:"latencyMs"`
+	// Failure reason when the dependency is down
+	Error *string `json:"error,omitempty"`
+	// Whether the instance stays healthy while this dependency is down, e.g. the read replica
+	Optional bool `json:"optional"`
+}
+
+// Downloads counted from the start of a bucket until the next
+type DownloadBucket struct {
+	Start     string `json:"start"`
+	Downloads int    `json:"downloads"`
+}
+
 // Represents a file stored in the system with deduplication by hash
 type File struct {
 	// Unique identifier for the file
@@ -50,10 +184,14 @@ type File struct {
 	Size int `json:"size"`
 	// Number of users referencing this file
 	RefCount int `json:"refCount"`
-	// Access level: private, public, or shared
+	// Access level: private, public, or shared. Public files can be viewed by any signed-in user
 	Visibility string `json:"visibility"`
 	// ISO timestamp when file was created
 	CreatedAt string `json:"createdAt"`
+	// True when the content scanner flagged the file; quarantined files cannot be downloaded
+	Quarantined bool `json:"quarantined"`
+	// Why the scanner flagged the file (admin listings only)
+	QuarantineReason *string `json:"quarantineReason,omitempty"`
 }
 
 type FileActivity struct {
@@ -66,6 +204,17 @@ type FileActivity struct {
 	User         *User  `json:"user"`
 }
 
+// Checksums for verifying a downloaded file
+type FileChecksum struct {
+	FileID string `json:"fileId"`
+	// Hex SHA-256 of the content
+	Sha256 string `json:"sha256"`
+	// Hex IEEE CRC-32 of the content; null unless includeCrc32 was set
+	Crc32 *string `json:"crc32,omitempty"`
+	// Size in bytes
+	Size int `json:"size"`
+}
+
 type FileDownload struct {
 	ID             string  `json:"id"`
 	FileID         string  `json:"fileId"`
@@ -81,6 +230,18 @@ type FileDownload struct {
 	Owner          *User   `json:"owner"`
 }
 
+// Per-file download counts shown in file listings
+type FileDownloadCounts struct {
+	// Total number of downloads
+	TotalDownloads int `json:"totalDownloads"`
+	// Downloads by users the file was shared with
+	SharedDownloads int `json:"sharedDownloads"`
+	// Downloads through public links
+	PublicDownloads int `json:"publicDownloads"`
+	// ISO timestamp of the most recent download
+	LastDownloadAt *string `json:"lastDownloadAt,omitempty"`
+}
+
 type FileDownloadStats struct {
 	FileID          string  `json:"fileId"`
 	OwnerID         string  `json:"ownerId"`
@@ -92,15 +253,37 @@ type FileDownloadStats struct {
 	Owner           *User   `json:"owner"`
 }
 
+// One file to move and where to put it
+type FileMoveInput struct {
+	// The user-file mapping to move
+	MappingID string `json:"mappingId"`
+	// Destination folder, or null for the root
+	FolderID *string `json:"folderId,omitempty"`
+}
+
+// Outcome of moving one file in moveUserFilesWithResults
+type FileMoveResult struct {
+	MappingID string `json:"mappingId"`
+	Moved     bool   `json:"moved"`
+	// Why the file wasn't moved, e.g. it is missing, not yours or in the trash
+	Error *string `json:"error,omitempty"`
+}
+
 type FileSearchFilter struct {
-	Filename      *string  `json:"filename,omitempty"`
-	MimeTypes     []string `json:"mimeTypes,omitempty"`
-	SizeMin       *int     `json:"sizeMin,omitempty"`
-	SizeMax       *int     `json:"sizeMax,omitempty"`
-	CreatedAfter  *string  `json:"createdAfter,omitempty"`
-	CreatedBefore *string  `json:"createdBefore,omitempty"`
-	Tags          []string `json:"tags,omitempty"`
-	UploaderName  *string  `json:"uploaderName,omitempty"`
+	Filename *string `json:"filename,omitempty"`
+	// How filename is matched (default CONTAINS)
+	FilenameMatch *FilenameMatch `json:"filenameMatch,omitempty"`
+	MimeTypes     []string       `json:"mimeTypes,omitempty"`
+	SizeMin       *int           `json:"sizeMin,omitempty"`
+	SizeMax       *int           `json:"sizeMax,omitempty"`
+	CreatedAfter  *string        `json:"createdAfter,omitempty"`
+	CreatedBefore *string        `json:"createdBefore,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	UploaderName  *string        `json:"uploaderName,omitempty"`
+	// Which folders to search (default ALL)
+	Scope *SearchScope `json:"scope,omitempty"`
+	// Folder whose subtree is searched when scope is FOLDER
+	FolderID *string `json:"folderId,omitempty"`
 }
 
 type FileShare struct {
@@ -122,6 +305,21 @@ type Folder struct {
 	Name      string  `json:"name"`
 	ParentID  *string `json:"parentId,omitempty"`
 	CreatedAt string  `json:"createdAt"`
+	// Version timestamp (RFC3339 with nanoseconds) for optimistic concurrency
+	UpdatedAt *string `json:"updatedAt,omitempty"`
+	// Who created the folder; only set when browsing a folder shared with you
+	Creator *Uploader `json:"creator,omitempty"`
+	// The owner's note on the folder; only set in the owner's own listings
+	Description *string `json:"description,omitempty"`
+	// When the folder was moved to the trash; only set in myDeletedFolders
+	DeletedAt *string `json:"deletedAt,omitempty"`
+}
+
+type FolderContents struct {
+	// The opened folder (null for root)
+	Folder     *Folder     `json:"folder,omitempty"`
+	Subfolders []*Folder   `json:"subfolders"`
+	Files      []*UserFile `json:"files"`
 }
 
 // File entry for folder upload with its relative path
@@ -146,12 +344,49 @@ type FolderShare struct {
 	SharedWithUser  *User   `json:"sharedWithUser,omitempty"`
 }
 
+// What a folder share would make accessible, as counted by folderSharePreview
+type FolderSharePreview struct {
+	FolderID string `json:"folderId"`
+	// Files in the folder and all its subfolders
+	FileCount int `json:"fileCount"`
+	// Subfolders at any depth
+	SubfolderCount int `json:"subfolderCount"`
+	// Total size of those files in bytes
+	TotalBytes int `json:"totalBytes"`
+}
+
+// A folder in the folder tree with the subfolders loaded beneath it
+type FolderTreeNode struct {
+	Folder *Folder `json:"folder"`
+	// Whether the folder has any subfolders
+	HasChildren bool `json:"hasChildren"`
+	// False when subfolders exist beyond the requested depth; query folderTree with this folder as rootId to expand it
+	ChildrenLoaded bool              `json:"childrenLoaded"`
+	Children       []*FolderTreeNode `json:"children"`
+}
+
 // Input for Google OAuth authentication
 type GoogleLoginInput struct {
 	// Google ID token from OAuth flow
 	IDToken string `json:"idToken"`
 }
 
+// Result of grouping files into a new folder
+type GroupFilesResult struct {
+	// The created folder
+	Folder *Folder `json:"folder"`
+	// The moved files
+	Files []*UserFile `json:"files"`
+}
+
+// The current user's permission on a file or folder
+type ItemAccess struct {
+	ItemType string `json:"itemType"`
+	ItemID   string `json:"itemId"`
+	// none, viewer, editor or owner
+	Permission string `json:"permission"`
+}
+
 // Input for user authentication
 type LoginInput struct {
 	// User's email address
@@ -164,14 +399,67 @@ type LoginInput struct {
 type Mutation struct {
 }
 
+// One of your active public links, as listed by myPublicLinks
+type MyPublicLink struct {
+	// file or folder
+	ItemType  string  `json:"itemType"`
+	ItemID    string  `json:"itemId"`
+	ItemName  string  `json:"itemName"`
+	Token     string  `json:"token"`
+	URL       string  `json:"url"`
+	CreatedAt string  `json:"createdAt"`
+	ExpiresAt *string `json:"expiresAt,omitempty"`
+	// Downloads of a file link or visits of a folder link
+	AccessCount int `json:"accessCount"`
+}
+
+// Your active public links with how many point at files and folders
+type MyPublicLinks struct {
+	Links       []*MyPublicLink `json:"links"`
+	FileLinks   int             `json:"fileLinks"`
+	FolderLinks int             `json:"folderLinks"`
+}
+
+// A team whose members share a storage pool on top of their personal quotas
+type Organization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Storage shared by all members together
+	QuotaBytes int `json:"quotaBytes"`
+	// What all members store together, each charged as against their personal quota
+	UsedBytes int    `json:"usedBytes"`
+	CreatedAt string `json:"createdAt"`
+}
+
 type PageInfo struct {
 	EndCursor   *string `json:"endCursor,omitempty"`
 	HasNextPage bool    `json:"hasNextPage"`
 }
 
 type PageInput struct {
-	Limit  *int    `json:"limit,omitempty"`
-	Cursor *string `json:"cursor,omitempty"`
+	Limit  *int      `json:"limit,omitempty"`
+	Cursor *string   `json:"cursor,omitempty"`
+	SortBy *FileSort `json:"sortBy,omitempty"`
+}
+
+// Dry-run verdict for one planned file
+type PlannedUploadCheck struct {
+	// Position of the file in the planned batch
+	Index int    `json:"index"`
+	Size  int    `json:"size"`
+	Hash  string `json:"hash"`
+	// The user already has this content, so it would not count against the quota
+	Deduplicated bool `json:"deduplicated"`
+	// Whether the file would be accepted given the files before it
+	Fits bool `json:"fits"`
+}
+
+// A file the client intends to upload, described without its content
+type PlannedUploadInput struct {
+	// Size in bytes
+	Size int `json:"size"`
+	// SHA-256 hex digest of the content
+	Hash string `json:"hash"`
 }
 
 type PublicFileLink struct {
@@ -181,6 +469,19 @@ type PublicFileLink struct {
 	CreatedAt string  `json:"createdAt"`
 	ExpiresAt *string `json:"expiresAt,omitempty"`
 	RevokedAt *string `json:"revokedAt,omitempty"`
+	// Downloads allowed before the link expires, null for no limit
+	MaxDownloads *int `json:"maxDownloads,omitempty"`
+}
+
+// A public file link's status; file details are only set while the link is valid
+type PublicFileLinkInspection struct {
+	Status    PublicLinkStatus `json:"status"`
+	FileName  *string          `json:"fileName,omitempty"`
+	MimeType  *string          `json:"mimeType,omitempty"`
+	Size      *int             `json:"size,omitempty"`
+	ExpiresAt *string          `json:"expiresAt,omitempty"`
+	// The link needs a password; file details are withheld until it's given
+	PasswordProtected bool `json:"passwordProtected"`
 }
 
 type PublicFileLinkResolved struct {
@@ -208,6 +509,27 @@ type PublicFolderLinkResolved struct {
 	Revoked   bool    `json:"revoked"`
 }
 
+type PublicFolderListing struct {
+	Token      string      `json:"token"`
+	Folder     *Folder     `json:"folder"`
+	Owner      *User       `json:"owner"`
+	ExpiresAt  *string     `json:"expiresAt,omitempty"`
+	Subfolders []*Folder   `json:"subfolders"`
+	Files      []*UserFile `json:"files"`
+}
+
+// Download timeline of a file's public link; every bucket in the range is listed, empty ones included
+type PublicLinkStats struct {
+	Token string `json:"token"`
+	// All downloads recorded for the link, not only those in the range; counted like the buckets
+	TotalDownloads int                  `json:"totalDownloads"`
+	Granularity    LinkStatsGranularity `json:"granularity"`
+	// Start of the first bucket
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Buckets []*DownloadBucket `json:"buckets"`
+}
+
 // Root query type containing all read operations
 type Query struct {
 }
@@ -221,6 +543,37 @@ type RecentFileActivity struct {
 	File             *File  `json:"file"`
 }
 
+// Result of restoreAllTrash
+type RestoreTrashResult struct {
+	// Number of files taken out of the trash
+	Restored int `json:"restored"`
+	// Trashed files that couldn't be restored
+	Skipped []*RestoreTrashSkip `json:"skipped"`
+}
+
+// A trashed file restoreAllTrash left in place
+type RestoreTrashSkip struct {
+	// The trashed copy (UserFile.id)
+	MappingID string `json:"mappingId"`
+	FileID    string `json:"fileId"`
+	Filename  string `json:"filename"`
+	// Why it wasn't restored
+	Reason string `json:"reason"`
+}
+
+// Whether a share recipient has accessed the shared file
+type ShareAccessStatus struct {
+	ShareID         string `json:"shareId"`
+	SharedWithEmail string `json:"sharedWithEmail"`
+	// Recipient's user ID, null if they have no account yet
+	SharedWithID *string `json:"sharedWithId,omitempty"`
+	// True once the recipient has downloaded or previewed the file
+	Accessed         bool    `json:"accessed"`
+	LastDownloadedAt *string `json:"lastDownloadedAt,omitempty"`
+	LastPreviewedAt  *string `json:"lastPreviewedAt,omitempty"`
+	LastAccessedAt   *string `json:"lastAccessedAt,omitempty"`
+}
+
 type ShareFileInput struct {
 	FileID     string   `json:"fileId"`
 	Emails     []string `json:"emails"`
@@ -257,6 +610,15 @@ type SharedFolderWithMe struct {
 	Owner           *User   `json:"owner"`
 }
 
+// The shares you have created, as listed by sharesCreatedByMe
+type SharesCreatedByMe struct {
+	FileShares   []*FileShare   `json:"fileShares"`
+	FolderShares []*FolderShare `json:"folderShares"`
+	// Shares past their expiry, which no longer grant access
+	ExpiredFileShares   []*FileShare   `json:"expiredFileShares"`
+	ExpiredFolderShares []*FolderShare `json:"expiredFolderShares"`
+}
+
 // Input for creating a new user account
 type SignupInput struct {
 	// User's email address (must be unique)
@@ -297,6 +659,50 @@ type StorageUsage struct {
 	PercentUsed    float64 `json:"percentUsed"`
 	SavingsBytes   int     `json:"savingsBytes"`
 	SavingsPercent float64 `json:"savingsPercent"`
+	// Physical storage attributed to you, each file's size shared among everyone storing it
+	AttributedBytes int `json:"attributedBytes"`
+	// Number of your active files
+	FileCount int `json:"fileCount"`
+}
+
+// Aggregated backend health for operators
+type SystemStatus struct {
+	// True when every required dependency is up
+	Healthy bool `json:"healthy"`
+	// True when an optional dependency is down
+	Degraded bool `json:"degraded"`
+	// ISO timestamp when the checks ran
+	CheckedAt    string              `json:"checkedAt"`
+	Dependencies []*DependencyStatus `json:"dependencies"`
+	// Migration files on disk that were not applied at startup; reported only, they don't affect healthy
+	PendingMigrations []string               `json:"pendingMigrations"`
+	Jobs              []*BackgroundJobStatus `json:"jobs"`
+}
+
+// The beginning of a text file
+type TextPreview struct {
+	Content  string `json:"content"`
+	MimeType string `json:"mimeType"`
+	// Size of the whole file in bytes
+	Size int `json:"size"`
+	// Whether the file continues past content
+	Truncated bool `json:"truncated"`
+}
+
+// A file an upload failed to store, logged for support
+type UploadFailureLog struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	// Uploader's email; empty if the account is gone
+	UserEmail string `json:"userEmail"`
+	Filename  string `json:"filename"`
+	// Size the client declared for the file in bytes (0 when unknown)
+	Size int `json:"size"`
+	// Rejection code (QUOTA, MIME_MISMATCH, BLOCKED_TYPE, TOO_LARGE, NAME_CONFLICT, EMPTY_FILE) or ERROR
+	Reason string `json:"reason"`
+	// The error the client was given
+	Message   string `json:"message"`
+	CreatedAt string `json:"createdAt"`
 }
 
 // Input for uploading one or more files
@@ -305,6 +711,26 @@ type UploadFileInput struct {
 	Files []*graphql.Upload `json:"files"`
 	// Whether to allow duplicate uploads (bypass deduplication)
 	AllowDuplicate *bool `json:"allowDuplicate,omitempty"`
+	// Keep uploading past per-file failures; failed files are reported as GraphQL errors carrying a reason code
+	BestEffort *bool `json:"bestEffort,omitempty"`
+	// private, shared or public; defaults to the server's DEFAULT_VISIBILITY
+	Visibility *string `json:"visibility,omitempty"`
+	// Which files claim quota first when not everything fits (default SUBMITTED)
+	Order *UploadOrder `json:"order,omitempty"`
+	// Rank per file for PRIORITY order, lower first; one entry per file
+	Priority []int `json:"priority,omitempty"`
+	// What to do when the folder already has a different file of the same name (default ALLOW)
+	OnNameConflict *NameConflict `json:"onNameConflict,omitempty"`
+	// Folder to upload into: one of yours or one shared with you as editor (the root when omitted). Files uploaded into a shared folder belong to, and count against the quota of, its owner
+	FolderID *string `json:"folderId,omitempty"`
+}
+
+// Result of uploadFilesWithResults
+type UploadFilesResult struct {
+	// The stored files
+	Files []*UserFile `json:"files"`
+	// The files that were not stored, in request order
+	Rejected []*UploadRejection `json:"rejected"`
 }
 
 // Input for uploading a folder with its nested structure
@@ -317,6 +743,8 @@ type UploadFolderInput struct {
 	ParentID *string `json:"parentId,omitempty"`
 	// Whether to allow duplicate uploads (bypass deduplication)
 	AllowDuplicate *bool `json:"allowDuplicate,omitempty"`
+	// private, shared or public; defaults to the server's DEFAULT_VISIBILITY
+	Visibility *string `json:"visibility,omitempty"`
 }
 
 type UploadFolderResult struct {
@@ -328,6 +756,41 @@ type UploadFolderResult struct {
 	Summary *UploadSummary `json:"summary"`
 }
 
+// Result of checking a planned upload against the user's quota
+type UploadQuotaCheck struct {
+	Files []*PlannedUploadCheck `json:"files"`
+	// How many of the planned files would be accepted
+	FitCount int `json:"fitCount"`
+	// Quota left before the upload
+	RemainingBytes int `json:"remainingBytes"`
+	// Quota left after storing every file that fits
+	RemainingAfterBytes int `json:"remainingAfterBytes"`
+}
+
+// A file an upload did not store
+type UploadRejection struct {
+	// Position of the file in the request
+	Index    int    `json:"index"`
+	Filename string `json:"filename"`
+	// Why the file was refused; null for failures that aren't validation rejections, such as storage errors
+	Reason  *UploadRejectionReason `json:"reason,omitempty"`
+	Message string                 `json:"message"`
+}
+
+// A resumable upload of one file, sent in chunks
+type UploadSession struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	// Size of the whole file in bytes
+	TotalSize int `json:"totalSize"`
+	// Size of every chunk but the last, which holds the rest of the file
+	ChunkSize int `json:"chunkSize"`
+	// How many chunks the file is sent in
+	ChunkCount int `json:"chunkCount"`
+	// When the session is abandoned if it hasn't been completed
+	ExpiresAt string `json:"expiresAt"`
+}
+
 type UploadSummary struct {
 	// Total number of files uploaded
 	TotalFiles int `json:"totalFiles"`
@@ -347,6 +810,16 @@ type Uploader struct {
 	Picture *string `json:"picture,omitempty"`
 }
 
+// Storage usage recorded for one day
+type UsageSnapshot struct {
+	// Snapshot day (YYYY-MM-DD, UTC)
+	Date string `json:"date"`
+	// Bytes of all files the user owns, before deduplication
+	LogicalBytes int `json:"logicalBytes"`
+	// User's share of physical storage after deduplication
+	AttributedBytes int `json:"attributedBytes"`
+}
+
 // Represents a user account in the system
 type User struct {
 	// Unique identifier for the user
@@ -375,19 +848,574 @@ type UserFile struct {
 	FileID string `json:"fileId"`
 	// ISO timestamp when association was created
 	UploadedAt string `json:"uploadedAt"`
+	// Folder containing the file (null for root level)
+	FolderID *string `json:"folderId,omitempty"`
+	// ISO timestamp when the current user last previewed or downloaded the file
+	LastAccessedAt *string `json:"lastAccessedAt,omitempty"`
 	// The associated file data
 	File *File `json:"file"`
 	// Information about who originally uploaded the file
 	Uploader *Uploader `json:"uploader,omitempty"`
+	// Download counts for the file (only set when the listing requests them)
+	DownloadStats *FileDownloadCounts `json:"downloadStats,omitempty"`
+	// The current user's note on the file; every user storing it keeps their own
+	Description *string `json:"description,omitempty"`
 }
 
 type UserFileConnection struct {
 	Edges      []*UserFileEdge `json:"edges"`
 	PageInfo   *PageInfo       `json:"pageInfo"`
 	TotalCount int             `json:"totalCount"`
+	// Summed size of all matching files; only set when requested with includeTotalBytes
+	TotalBytes *int `json:"totalBytes,omitempty"`
 }
 
 type UserFileEdge struct {
 	Cursor string    `json:"cursor"`
 	Node   *UserFile `json:"node"`
 }
+
+// What deleting a file does
+type DeleteMode string
+
+const (
+	// Move it to Recently Deleted, from where it can be recovered
+	DeleteModeTrash DeleteMode = "TRASH"
+	// Delete it for good; the stored content goes too unless another copy references it
+	DeleteModeImmediate DeleteMode = "IMMEDIATE"
+)
+
+var AllDeleteMode = []DeleteMode{
+	DeleteModeTrash,
+	DeleteModeImmediate,
+}
+
+func (e DeleteMode) IsValid() bool {
+	switch e {
+	case DeleteModeTrash, DeleteModeImmediate:
+		return true
+	}
+	return false
+}
+
+func (e DeleteMode) String() string {
+	return string(e)
+}
+
+func (e *DeleteMode) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DeleteMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DeleteMode", str)
+	}
+	return nil
+}
+
+func (e DeleteMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *DeleteMode) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e DeleteMode) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Ordering for file listings
+type FileSort string
+
+const (
+	// Newest uploads first (default)
+	FileSortUploadedAt FileSort = "UPLOADED_AT"
+	// Most recently opened by the current user first
+	FileSortLastAccessedAt FileSort = "LAST_ACCESSED_AT"
+)
+
+var AllFileSort = []FileSort{
+	FileSortUploadedAt,
+	FileSortLastAccessedAt,
+}
+
+func (e FileSort) IsValid() bool {
+	switch e {
+	case FileSortUploadedAt, FileSortLastAccessedAt:
+		return true
+	}
+	return false
+}
+
+func (e FileSort) String() string {
+	return string(e)
+}
+
+func (e *FileSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = FileSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid FileSort", str)
+	}
+	return nil
+}
+
+func (e FileSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *FileSort) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e FileSort) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type FilenameMatch string
+
+const (
+	// Names containing the filename anywhere
+	FilenameMatchContains FilenameMatch = "CONTAINS"
+	// Names starting with the filename, for autocomplete
+	FilenameMatchPrefix FilenameMatch = "PREFIX"
+	// Names equal to the filename
+	FilenameMatchExact FilenameMatch = "EXACT"
+)
+
+var AllFilenameMatch = []FilenameMatch{
+	FilenameMatchContains,
+	FilenameMatchPrefix,
+	FilenameMatchExact,
+}
+
+func (e FilenameMatch) IsValid() bool {
+	switch e {
+	case FilenameMatchContains, FilenameMatchPrefix, FilenameMatchExact:
+		return true
+	}
+	return false
+}
+
+func (e FilenameMatch) String() string {
+	return string(e)
+}
+
+func (e *FilenameMatch) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = FilenameMatch(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid FilenameMatch", str)
+	}
+	return nil
+}
+
+func (e FilenameMatch) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *FilenameMatch) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e FilenameMatch) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type LinkStatsGranularity string
+
+const (
+	LinkStatsGranularityHour LinkStatsGranularity = "HOUR"
+	LinkStatsGranularityDay  LinkStatsGranularity = "DAY"
+)
+
+var AllLinkStatsGranularity = []LinkStatsGranularity{
+	LinkStatsGranularityHour,
+	LinkStatsGranularityDay,
+}
+
+func (e LinkStatsGranularity) IsValid() bool {
+	switch e {
+	case LinkStatsGranularityHour, LinkStatsGranularityDay:
+		return true
+	}
+	return false
+}
+
+func (e LinkStatsGranularity) String() string {
+	return string(e)
+}
+
+func (e *LinkStatsGranularity) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LinkStatsGranularity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LinkStatsGranularity", str)
+	}
+	return nil
+}
+
+func (e LinkStatsGranularity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *LinkStatsGranularity) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e LinkStatsGranularity) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// How an upload handles a same-name file with different content in its folder; names are compared ignoring case
+type NameConflict string
+
+const (
+	// Store the file under its name next to the existing one
+	NameConflictAllow NameConflict = "ALLOW"
+	// Store the file as "name (1).ext", "name (2).ext", ...
+	NameConflictRename NameConflict = "RENAME"
+	// Fail the file; its error carries nameConflict: true in the extensions
+	NameConflictReject NameConflict = "REJECT"
+)
+
+var AllNameConflict = []NameConflict{
+	NameConflictAllow,
+	NameConflictRename,
+	NameConflictReject,
+}
+
+func (e NameConflict) IsValid() bool {
+	switch e {
+	case NameConflictAllow, NameConflictRename, NameConflictReject:
+		return true
+	}
+	return false
+}
+
+func (e NameConflict) String() string {
+	return string(e)
+}
+
+func (e *NameConflict) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = NameConflict(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid NameConflict", str)
+	}
+	return nil
+}
+
+func (e NameConflict) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *NameConflict) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e NameConflict) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type PublicLinkStatus string
+
+const (
+	PublicLinkStatusValid    PublicLinkStatus = "VALID"
+	PublicLinkStatusExpired  PublicLinkStatus = "EXPIRED"
+	PublicLinkStatusRevoked  PublicLinkStatus = "REVOKED"
+	PublicLinkStatusNotFound PublicLinkStatus = "NOT_FOUND"
+)
+
+var AllPublicLinkStatus = []PublicLinkStatus{
+	PublicLinkStatusValid,
+	PublicLinkStatusExpired,
+	PublicLinkStatusRevoked,
+	PublicLinkStatusNotFound,
+}
+
+func (e PublicLinkStatus) IsValid() bool {
+	switch e {
+	case PublicLinkStatusValid, PublicLinkStatusExpired, PublicLinkStatusRevoked, PublicLinkStatusNotFound:
+		return true
+	}
+	return false
+}
+
+func (e PublicLinkStatus) String() string {
+	return string(e)
+}
+
+func (e *PublicLinkStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PublicLinkStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PublicLinkStatus", str)
+	}
+	return nil
+}
+
+func (e PublicLinkStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *PublicLinkStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e PublicLinkStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type SearchScope string
+
+const (
+	// Every file regardless of folder
+	SearchScopeAll SearchScope = "ALL"
+	// The given folder and all of its subfolders
+	SearchScopeFolder SearchScope = "FOLDER"
+	// Only files not in any folder
+	SearchScopeRoot SearchScope = "ROOT"
+)
+
+var AllSearchScope = []SearchScope{
+	SearchScopeAll,
+	SearchScopeFolder,
+	SearchScopeRoot,
+}
+
+func (e SearchScope) IsValid() bool {
+	switch e {
+	case SearchScopeAll, SearchScopeFolder, SearchScopeRoot:
+		return true
+	}
+	return false
+}
+
+func (e SearchScope) String() string {
+	return string(e)
+}
+
+func (e *SearchScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SearchScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchScope", str)
+	}
+	return nil
+}
+
+func (e SearchScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *SearchScope) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e SearchScope) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Order in which an upload batch claims quota
+type UploadOrder string
+
+const (
+	// Files are stored as they finish, with no guaranteed order
+	UploadOrderSubmitted UploadOrder = "SUBMITTED"
+	// Smallest files first, fitting as many files as possible
+	UploadOrderSmallestFirst UploadOrder = "SMALLEST_FIRST"
+	// Files in the order given by priority
+	UploadOrderPriority UploadOrder = "PRIORITY"
+)
+
+var AllUploadOrder = []UploadOrder{
+	UploadOrderSubmitted,
+	UploadOrderSmallestFirst,
+	UploadOrderPriority,
+}
+
+func (e UploadOrder) IsValid() bool {
+	switch e {
+	case UploadOrderSubmitted, UploadOrderSmallestFirst, UploadOrderPriority:
+		return true
+	}
+	return false
+}
+
+func (e UploadOrder) String() string {
+	return string(e)
+}
+
+func (e *UploadOrder) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UploadOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UploadOrder", str)
+	}
+	return nil
+}
+
+func (e UploadOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *UploadOrder) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e UploadOrder) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Why an upload refused a file
+type UploadRejectionReason string
+
+const (
+	// The file didn't fit the remaining quota
+	UploadRejectionReasonQuota UploadRejectionReason = "QUOTA"
+	// The file's content, extension and declared type disagree
+	UploadRejectionReasonMimeMismatch UploadRejectionReason = "MIME_MISMATCH"
+	// The file's type is blocked on this server
+	UploadRejectionReasonBlockedType UploadRejectionReason = "BLOCKED_TYPE"
+	// The file is over the server's per-file size limit
+	UploadRejectionReasonTooLarge UploadRejectionReason = "TOO_LARGE"
+	// The folder has a different file of the same name (onNameConflict: REJECT)
+	UploadRejectionReasonNameConflict UploadRejectionReason = "NAME_CONFLICT"
+	// The file is empty and this server doesn't accept empty files
+	UploadRejectionReasonEmptyFile UploadRejectionReason = "EMPTY_FILE"
+	// The content scanner flagged the file
+	UploadRejectionReasonFlagged UploadRejectionReason = "FLAGGED"
+)
+
+var AllUploadRejectionReason = []UploadRejectionReason{
+	UploadRejectionReasonQuota,
+	UploadRejectionReasonMimeMismatch,
+	UploadRejectionReasonBlockedType,
+	UploadRejectionReasonTooLarge,
+	UploadRejectionReasonNameConflict,
+	UploadRejectionReasonEmptyFile,
+	UploadRejectionReasonFlagged,
+}
+
+func (e UploadRejectionReason) IsValid() bool {
+	switch e {
+	case UploadRejectionReasonQuota, UploadRejectionReasonMimeMismatch, UploadRejectionReasonBlockedType, UploadRejectionReasonTooLarge, UploadRejectionReasonNameConflict, UploadRejectionReasonEmptyFile, UploadRejectionReasonFlagged:
+		return true
+	}
+	return false
+}
+
+func (e UploadRejectionReason) String() string {
+	return string(e)
+}
+
+func (e *UploadRejectionReason) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UploadRejectionReason(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UploadRejectionReason", str)
+	}
+	return nil
+}
+
+func (e UploadRejectionReason) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *UploadRejectionReason) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e UploadRejectionReason) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/graph/model"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/services"
+)
+
+// moveUserFiles runs a bulk move for the signed-in user through the folder service; it is
+// shared by moveUserFiles and moveUserFilesWithResults.
+func (r *mutationResolver) moveUserFiles(ctx context.Context, moves []*model.FileMoveInput) ([]services.FileMoveResult, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	batch := make([]services.FileMove, 0, len(moves))
+	for _, m := range moves {
+		mid, err := uuid.Parse(m.MappingID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping id")
+		}
+		move := services.FileMove{MappingID: mid}
+		if m.FolderID != nil && *m.FolderID != "" {
+			id, err := uuid.Parse(*m.FolderID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid folder id")
+			}
+			move.FolderID = &id
+		}
+		batch = append(batch, move)
+	}
+	return r.FolderService.MoveFiles(ctx, userID, batch)
+}
@@ -29,4 +29,12 @@ type Resolver struct {
 	FileActivityService *services.FileActivityService
 	// StarredService manages user's starred files and folders
 	StarredService *services.StarredService
+	// StatusService reports dependency health for administrators
+	StatusService *services.StatusService
+	// UsageService serves per-user storage usage history
+	UsageService *services.UsageService
+	// OrganizationService manages organizations and their shared quotas
+	OrganizationService *services.OrganizationService
+	// DashboardService gathers the home screen in one call
+	DashboardService *services.DashboardService
 }
@@ -6,8 +6,8 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/url"
 	"strings"
 	"time"
 
@@ -15,7 +15,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/useradityaa/graph/model"
 	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
+	"github.com/useradityaa/internal/services"
 )
 
 // Signup is the resolver for the signup field.
@@ -89,27 +91,14 @@ func (r *mutationResolver) UploadFiles(ctx context.Context, input model.UploadFi
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 
-	// Convert GraphQL uploads to the type FileService expects
-	var uploads []*graphql.Upload
-	for _, up := range input.Files {
-		if up == nil || up.File == nil {
-			return nil, fmt.Errorf("invalid file input")
-		}
-		uploads = append(uploads, up)
-	}
-
-	if r.FileService == nil {
-		return nil, fmt.Errorf("file storage not configured")
-	}
-
-	// Pass allowDuplicate down via context for now (small change without altering service signature)
-	if input.AllowDuplicate != nil && *input.AllowDuplicate {
-		ctx = context.WithValue(ctx, struct{ key string }{"allowDuplicate"}, true)
-	}
-	userFiles, err := r.FileService.UploadFiles(ctx, userID, uploads)
+	userFiles, failures, err := r.uploadInput(ctx, userID, input, input.BestEffort != nil && *input.BestEffort)
 	if err != nil {
 		return nil, err
 	}
+	// Skipped files are reported alongside the stored ones
+	for _, f := range failures {
+		graphql.AddError(ctx, uploadFailureError(f))
+	}
 
 	// Map to GraphQL models
 	var gqlFiles []*model.UserFile
@@ -151,6 +140,143 @@ func (r *mutationResolver) UploadFiles(ctx context.Context, input model.UploadFi
 	return gqlFiles, nil
 }
 
+// UploadFilesWithResults is the resolver for the uploadFilesWithResults field.
+func (r *mutationResolver) UploadFilesWithResults(ctx context.Context, input model.UploadFileInput) (*model.UploadFilesResult, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+
+	userFiles, failures, err := r.uploadInput(ctx, userID, input, true)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.UploadFilesResult{Files: []*model.UserFile{}, Rejected: []*model.UploadRejection{}}
+	for _, uf := range userFiles {
+		result.Files = append(result.Files, toModelUserFile(uf))
+	}
+	for _, f := range failures {
+		result.Rejected = append(result.Rejected, toModelUploadRejection(f))
+	}
+	return result, nil
+}
+
+// StartUploadSession is the resolver for the startUploadSession field.
+func (r *mutationResolver) StartUploadSession(ctx context.Context, filename string, totalSize int) (*model.UploadSession, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+
+	session, err := r.FileService.InitUploadSession(ctx, userID, filename, int64(totalSize))
+	if err != nil {
+		return nil, err
+	}
+	return toModelUploadSession(*session), nil
+}
+
+// UploadChunk is the resolver for the uploadChunk field.
+func (r *mutationResolver) UploadChunk(ctx context.Context, sessionID string, chunkIndex int, chunk graphql.Upload) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return false, services.ErrStorageUnavailable
+	}
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return false, fmt.Errorf("invalid session id")
+	}
+
+	if _, err := r.FileService.UploadChunk(ctx, userID, id, chunkIndex, chunk.File); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CompleteUploadSession is the resolver for the completeUploadSession field.
+func (r *mutationResolver) CompleteUploadSession(ctx context.Context, sessionID string) (*model.UserFile, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session id")
+	}
+
+	uf, err := r.FileService.CompleteUploadSession(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return toModelUserFile(*uf), nil
+}
+
+// CheckUploadQuota is the resolver for the checkUploadQuota field.
+func (r *mutationResolver) CheckUploadQuota(ctx context.Context, files []*model.PlannedUploadInput) (*model.UploadQuotaCheck, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+
+	sizes := make([]int64, len(files))
+	hashes := make([]string, len(files))
+	for i, f := range files {
+		sizes[i] = int64(f.Size)
+		hashes[i] = f.Hash
+	}
+	check, err := r.FileService.CheckQuotaForUpload(ctx, userID, sizes, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.UploadQuotaCheck{
+		FitCount:            check.FitCount,
+		RemainingBytes:      int(check.RemainingBytes),
+		RemainingAfterBytes: int(check.RemainingAfterBytes),
+	}
+	for _, fc := range check.Files {
+		result.Files = append(result.Files, &model.PlannedUploadCheck{
+			Index:        fc.Index,
+			Size:         int(fc.Size),
+			Hash:         fc.Hash,
+			Deduplicated: fc.Deduplicated,
+			Fits:         fc.Fits,
+		})
+	}
+	return result, nil
+}
+
 // UploadFolder is the resolver for the uploadFolder field.
 func (r *mutationResolver) UploadFolder(ctx context.Context, input model.UploadFolderInput) (*model.UploadFolderResult, error) {
 	// Require authentication
@@ -181,91 +307,44 @@ func (r *mutationResolver) UploadFolder(ctx context.Context, input model.UploadF
 		parentID = &pid
 	}
 
+	// Validate visibility before creating any folders
+	visibility, err := parseUploadVisibility(input.Visibility)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the root folder
 	rootFolderID, err := r.FolderService.CreateFolder(ctx, userID, input.FolderName, parentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create root folder: %w", err)
 	}
 
-	// Group files by their directory paths
-	folderMap := make(map[string]uuid.UUID)
-	folderMap[""] = rootFolderID // Root folder
+	// Work out every file's directory first so the whole tree is created in one pass
+	dirs := make([]string, len(input.Files))
+	for i, fileInput := range input.Files {
+		if fileInput.File.File != nil {
+			dirs[i] = uploadFolderDir(fileInput.RelativePath, input.FolderName)
+		}
+	}
+	folderMap, nestedFolders, err := r.FolderService.CreateFolderPaths(ctx, userID, rootFolderID, dirs)
+	if err != nil {
+		return nil, err
+	}
 
 	var uploadedFiles []*model.UserFile
 	totalSize := int64(0)
-	createdFolders := 1 // Root folder
+	createdFolders := 1 + nestedFolders // Root folder plus nested ones
 
 	// Process each file
-	for _, fileInput := range input.Files {
+	for i, fileInput := range input.Files {
 		if fileInput.File.File == nil {
 			continue
 		}
-
-		// Debug logging
-		fmt.Printf("DEBUG: Processing file with relativePath: %s\n", fileInput.RelativePath)
-
-		// Extract directory path from relative path
-		dir := ""
-		if fileInput.RelativePath != "" {
-			parts := strings.Split(fileInput.RelativePath, "/")
-			if len(parts) > 1 {
-				// Skip the first part if it matches the root folder name
-				dirParts := parts[:len(parts)-1]
-				if len(dirParts) > 0 && dirParts[0] == input.FolderName {
-					// Remove the root folder name from the path since we already created it
-					dirParts = dirParts[1:]
-				}
-				if len(dirParts) > 0 {
-					dir = strings.Join(dirParts, "/")
-				}
-			}
-		}
-
-		fmt.Printf("DEBUG: Extracted directory: '%s' from relativePath: '%s' (rootFolder: '%s')\n", dir, fileInput.RelativePath, input.FolderName)
-
-		// Create directory structure if needed
-		var targetFolderID uuid.UUID
-		if dir == "" {
-			targetFolderID = rootFolderID
-		} else {
-			if folderID, exists := folderMap[dir]; exists {
-				targetFolderID = folderID
-			} else {
-				// Create nested folder structure
-				pathParts := strings.Split(dir, "/")
-				currentPath := ""
-				currentParentID := &rootFolderID
-
-				for _, part := range pathParts {
-					if part == "" {
-						continue
-					}
-
-					if currentPath == "" {
-						currentPath = part
-					} else {
-						currentPath = currentPath + "/" + part
-					}
-
-					if folderID, exists := folderMap[currentPath]; exists {
-						currentParentID = &folderID
-					} else {
-						newFolderID, err := r.FolderService.CreateFolder(ctx, userID, part, currentParentID)
-						if err != nil {
-							return nil, fmt.Errorf("failed to create folder %s: %w", part, err)
-						}
-						folderMap[currentPath] = newFolderID
-						currentParentID = &newFolderID
-						createdFolders++
-					}
-				}
-				targetFolderID = *currentParentID
-			}
-		}
+		targetFolderID := folderMap[dirs[i]]
 
 		// Upload the file to the target folder
 		if r.FileService == nil {
-			return nil, fmt.Errorf("file storage not configured")
+			return nil, services.ErrStorageUnavailable
 		}
 
 		// Set allowDuplicate in context if specified
@@ -273,14 +352,8 @@ func (r *mutationResolver) UploadFolder(ctx context.Context, input model.UploadF
 			ctx = context.WithValue(ctx, "allowDuplicate", true)
 		}
 
-		// Set target folder in context for file upload
-		ctx = context.WithValue(ctx, "targetFolderID", targetFolderID)
-
-		// Debug logging
-		fmt.Printf("DEBUG: Setting targetFolderID in context: %s for file: %s\n", targetFolderID.String(), fileInput.RelativePath)
-
 		uploads := []*graphql.Upload{&fileInput.File}
-		userFiles, err := r.FileService.UploadFiles(ctx, userID, uploads)
+		userFiles, _, err := r.FileService.UploadFilesToFolder(ctx, userID, &targetFolderID, uploads, visibility, false, services.UploadOrder{}, services.NameConflictAllow)
 		if err != nil {
 			return nil, fmt.Errorf("failed to upload file %s: %w", fileInput.RelativePath, err)
 		}
@@ -353,7 +426,7 @@ func (r *mutationResolver) UploadFolder(ctx context.Context, input model.UploadF
 }
 
 // DeleteFile is the resolver for the deleteFile field.
-func (r *mutationResolver) DeleteFile(ctx context.Context, fileID string) (bool, error) {
+func (r *mutationResolver) DeleteFile(ctx context.Context, fileID string, mode *model.DeleteMode) (bool, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return false, fmt.Errorf("unauthorized")
@@ -366,17 +439,21 @@ func (r *mutationResolver) DeleteFile(ctx context.Context, fileID string) (bool,
 	if err != nil {
 		return false, fmt.Errorf("invalid file id")
 	}
+	deleteMode, err := toDeleteMode(mode, middleware.GetIsAdminFromContext(ctx))
+	if err != nil {
+		return false, err
+	}
 	if r.FileService == nil {
-		return false, fmt.Errorf("file service not configured")
+		return false, services.ErrStorageUnavailable
 	}
-	if err := r.FileService.SoftDeleteUserFile(ctx, userID, fid); err != nil {
+	if err := r.FileService.DeleteFile(ctx, userID, fid, deleteMode); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// RecoverFile is the resolver for the recoverFile field.
-func (r *mutationResolver) RecoverFile(ctx context.Context, fileID string) (bool, error) {
+// DeleteUserFile is the resolver for the deleteUserFile field.
+func (r *mutationResolver) DeleteUserFile(ctx context.Context, mappingID string, mode *model.DeleteMode) (bool, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return false, fmt.Errorf("unauthorized")
@@ -385,21 +462,25 @@ func (r *mutationResolver) RecoverFile(ctx context.Context, fileID string) (bool
 	if err != nil {
 		return false, fmt.Errorf("invalid user id in token")
 	}
-	fid, err := uuid.Parse(fileID)
+	mid, err := uuid.Parse(mappingID)
 	if err != nil {
-		return false, fmt.Errorf("invalid file id")
+		return false, fmt.Errorf("invalid mapping id")
+	}
+	deleteMode, err := toDeleteMode(mode, middleware.GetIsAdminFromContext(ctx))
+	if err != nil {
+		return false, err
 	}
 	if r.FileService == nil {
-		return false, fmt.Errorf("file service not configured")
+		return false, services.ErrStorageUnavailable
 	}
-	if err := r.FileService.RecoverUserFile(ctx, userID, fid); err != nil {
+	if err := r.FileService.DeleteFileByMappingID(ctx, userID, mid, deleteMode); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// PurgeFile is the resolver for the purgeFile field.
-func (r *mutationResolver) PurgeFile(ctx context.Context, fileID string) (bool, error) {
+// RecoverFile is the resolver for the recoverFile field.
+func (r *mutationResolver) RecoverFile(ctx context.Context, fileID string) (bool, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return false, fmt.Errorf("unauthorized")
@@ -413,16 +494,16 @@ func (r *mutationResolver) PurgeFile(ctx context.Context, fileID string) (bool,
 		return false, fmt.Errorf("invalid file id")
 	}
 	if r.FileService == nil {
-		return false, fmt.Errorf("file service not configured")
+		return false, services.ErrStorageUnavailable
 	}
-	if err := r.FileService.PurgeUserFile(ctx, userID, fid); err != nil {
+	if err := r.FileService.RecoverUserFile(ctx, userID, fid); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// CreateFolder is the resolver for the createFolder field.
-func (r *mutationResolver) CreateFolder(ctx context.Context, name string, parentID *string) (*model.Folder, error) {
+// RestoreAllTrash is the resolver for the restoreAllTrash field.
+func (r *mutationResolver) RestoreAllTrash(ctx context.Context) (*model.RestoreTrashResult, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
@@ -431,34 +512,18 @@ func (r *mutationResolver) CreateFolder(ctx context.Context, name string, parent
 	if err != nil {
 		return nil, fmt.Errorf("invalid user id in token")
 	}
-	if r.FolderService == nil {
-		return nil, fmt.Errorf("folder service not configured")
-	}
-	var pid *uuid.UUID
-	if parentID != nil && *parentID != "" {
-		id, err := uuid.Parse(*parentID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid parent id")
-		}
-		pid = &id
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
 	}
-	id, err := r.FolderService.CreateFolder(ctx, userID, name, pid)
+	result, err := r.FileService.RestoreAllTrash(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	// Load created folder
-	// We don't have a direct getter in service; return minimal payload
-	now := time.Now().Format(time.RFC3339)
-	var pidStr *string
-	if pid != nil {
-		s := pid.String()
-		pidStr = &s
-	}
-	return &model.Folder{ID: id.String(), Name: name, ParentID: pidStr, CreatedAt: now}, nil
+	return toModelRestoreTrashResult(result), nil
 }
 
-// RenameFolder is the resolver for the renameFolder field.
-func (r *mutationResolver) RenameFolder(ctx context.Context, folderID string, newName string) (bool, error) {
+// PurgeFile is the resolver for the purgeFile field.
+func (r *mutationResolver) PurgeFile(ctx context.Context, fileID string) (bool, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return false, fmt.Errorf("unauthorized")
@@ -467,116 +532,578 @@ func (r *mutationResolver) RenameFolder(ctx context.Context, folderID string, ne
 	if err != nil {
 		return false, fmt.Errorf("invalid user id in token")
 	}
-	if r.FolderService == nil {
-		return false, fmt.Errorf("folder service not configured")
-	}
-	fid, err := uuid.Parse(folderID)
+	fid, err := uuid.Parse(fileID)
 	if err != nil {
-		return false, fmt.Errorf("invalid folder id")
+		return false, fmt.Errorf("invalid file id")
+	}
+	if r.FileService == nil {
+		return false, services.ErrStorageUnavailable
 	}
-	if err := r.FolderService.RenameFolder(ctx, userID, fid, newName); err != nil {
+	if err := r.FileService.PurgeUserFile(ctx, userID, fid); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// DeleteFolder is the resolver for the deleteFolder field.
-func (r *mutationResolver) DeleteFolder(ctx context.Context, folderID string) (bool, error) {
+// SetFileVisibility is the resolver for the setFileVisibility field.
+func (r *mutationResolver) SetFileVisibility(ctx context.Context, fileID string, visibility string) (*model.UserFile, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
-		return false, fmt.Errorf("unauthorized")
+		return nil, fmt.Errorf("unauthorized")
 	}
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid user id in token")
-	}
-	if r.FolderService == nil {
-		return false, fmt.Errorf("folder service not configured")
+		return nil, fmt.Errorf("invalid user id in token")
 	}
-	fid, err := uuid.Parse(folderID)
+	fid, err := uuid.Parse(fileID)
 	if err != nil {
-		return false, fmt.Errorf("invalid folder id")
+		return nil, fmt.Errorf("invalid file id")
 	}
-	if err := r.FolderService.DeleteFolder(ctx, userID, fid); err != nil {
-		return false, err
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
 	}
-	return true, nil
+	uf, err := r.FileService.SetFileVisibility(ctx, userID, fid, visibility)
+	if err != nil {
+		return nil, err
+	}
+	return toModelUserFile(*uf), nil
 }
 
-// DeleteFolderRecursive is the resolver for the deleteFolderRecursive field.
-func (r *mutationResolver) DeleteFolderRecursive(ctx context.Context, folderID string) (bool, error) {
-	// Require authentication
-	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
-	if !ok {
-		return false, fmt.Errorf("unauthorized")
+// AdminReleaseQuarantinedFile is the resolver for the adminReleaseQuarantinedFile field.
+func (r *mutationResolver) AdminReleaseQuarantinedFile(ctx context.Context, fileID string) (bool, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return false, fmt.Errorf("unauthorized: admin access required")
 	}
-	userID, err := uuid.Parse(userIDStr)
+	fid, err := uuid.Parse(fileID)
 	if err != nil {
-		return false, fmt.Errorf("invalid user id in token")
+		return false, fmt.Errorf("invalid file ID")
 	}
-
-	// Parse folder ID
-	fid, err := uuid.Parse(folderID)
-	if err != nil {
-		return false, fmt.Errorf("invalid folder id")
+	if r.FileService == nil {
+		return false, services.ErrStorageUnavailable
 	}
-
-	// Use the new recursive delete method from FolderService
-	if err := r.FolderService.DeleteFolderRecursive(ctx, userID, fid); err != nil {
+	if err := r.FileService.ReleaseQuarantinedFile(ctx, fid); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// MoveUserFile is the resolver for the moveUserFile field.
-func (r *mutationResolver) MoveUserFile(ctx context.Context, mappingID string, folderID *string) (bool, error) {
-	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
-	if !ok {
-		return false, fmt.Errorf("unauthorized")
+// AdminDeleteQuarantinedFile is the resolver for the adminDeleteQuarantinedFile field.
+func (r *mutationResolver) AdminDeleteQuarantinedFile(ctx context.Context, fileID string) (bool, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return false, fmt.Errorf("unauthorized: admin access required")
 	}
-	userID, err := uuid.Parse(userIDStr)
+	fid, err := uuid.Parse(fileID)
 	if err != nil {
-		return false, fmt.Errorf("invalid user id in token")
+		return false, fmt.Errorf("invalid file ID")
 	}
 	if r.FileService == nil {
-		return false, fmt.Errorf("file service not configured")
-	}
-	mid, err := uuid.Parse(mappingID)
-	if err != nil {
-		return false, fmt.Errorf("invalid mapping id")
-	}
-	var fid *uuid.UUID
-	if folderID != nil && *folderID != "" {
-		id, err := uuid.Parse(*folderID)
-		if err != nil {
-			return false, fmt.Errorf("invalid folder id")
-		}
-		fid = &id
+		return false, services.ErrStorageUnavailable
 	}
-	if err := r.FileService.FileRepo.MoveUserFileToFolder(ctx, userID, mid, fid); err != nil {
+	if err := r.FileService.DeleteQuarantinedFile(ctx, fid); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// ShareFile is the resolver for the shareFile field.
-func (r *mutationResolver) ShareFile(ctx context.Context, input model.ShareFileInput) (*model.FileShare, error) {
-	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
-	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+// AdminRotateEncryptionKeys is the resolver for the adminRotateEncryptionKeys field.
+func (r *mutationResolver) AdminRotateEncryptionKeys(ctx context.Context, limit *int) (int, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return 0, fmt.Errorf("unauthorized: admin access required")
 	}
-
-	userID, err := uuid.Parse(userIDStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid user ID")
+	if r.FileService == nil {
+		return 0, services.ErrStorageUnavailable
+	}
+	n := 100
+	if limit != nil {
+		n = *limit
 	}
+	return r.FileService.RotateEncryptionKeys(ctx, n)
+}
 
-	fileID, err := uuid.Parse(input.FileID)
+// AdminSetPublicLinkLimit is the resolver for the adminSetPublicLinkLimit field.
+func (r *mutationResolver) AdminSetPublicLinkLimit(ctx context.Context, userID string, limit *int) (bool, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return false, fmt.Errorf("unauthorized: admin access required")
+	}
+	uid, err := uuid.Parse(userID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid file ID")
+		return false, fmt.Errorf("invalid user ID")
 	}
-
-	var expiresAt *time.Time
+	if r.PublicLinkService == nil {
+		return false, fmt.Errorf("public link service not configured")
+	}
+	if err := r.PublicLinkService.SetLinkLimit(ctx, uid, limit); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AdminCreateOrganization is the resolver for the adminCreateOrganization field.
+func (r *mutationResolver) AdminCreateOrganization(ctx context.Context, name string, quotaBytes int) (*model.Organization, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	if r.OrganizationService == nil {
+		return nil, fmt.Errorf("organization service not configured")
+	}
+	org, err := r.OrganizationService.CreateOrganization(ctx, name, int64(quotaBytes))
+	if err != nil {
+		return nil, err
+	}
+	return toModelOrganization(*org, 0), nil
+}
+
+// AdminSetOrganizationQuota is the resolver for the adminSetOrganizationQuota field.
+func (r *mutationResolver) AdminSetOrganizationQuota(ctx context.Context, orgID string, quotaBytes int) (*model.Organization, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	oid, err := uuid.Parse(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid organization ID")
+	}
+	if r.OrganizationService == nil {
+		return nil, fmt.Errorf("organization service not configured")
+	}
+	usage, err := r.OrganizationService.SetQuota(ctx, oid, int64(quotaBytes))
+	if err != nil {
+		return nil, err
+	}
+	return toModelOrganization(usage.Organization, usage.UsedBytes), nil
+}
+
+// AdminAddOrganizationMember is the resolver for the adminAddOrganizationMember field.
+func (r *mutationResolver) AdminAddOrganizationMember(ctx context.Context, orgID string, userID string) (bool, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return false, fmt.Errorf("unauthorized: admin access required")
+	}
+	oid, err := uuid.Parse(orgID)
+	if err != nil {
+		return false, fmt.Errorf("invalid organization ID")
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID")
+	}
+	if r.OrganizationService == nil {
+		return false, fmt.Errorf("organization service not configured")
+	}
+	if err := r.OrganizationService.AddMember(ctx, oid, uid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AdminRemoveOrganizationMember is the resolver for the adminRemoveOrganizationMember field.
+func (r *mutationResolver) AdminRemoveOrganizationMember(ctx context.Context, userID string) (bool, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return false, fmt.Errorf("unauthorized: admin access required")
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID")
+	}
+	if r.OrganizationService == nil {
+		return false, fmt.Errorf("organization service not configured")
+	}
+	return r.OrganizationService.RemoveMember(ctx, uid)
+}
+
+// CreateFolder is the resolver for the createFolder field.
+func (r *mutationResolver) CreateFolder(ctx context.Context, name string, parentID *string) (*model.Folder, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	var pid *uuid.UUID
+	if parentID != nil && *parentID != "" {
+		id, err := uuid.Parse(*parentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent id")
+		}
+		pid = &id
+	}
+	id, err := r.FolderService.CreateFolder(ctx, userID, name, pid)
+	if err != nil {
+		return nil, err
+	}
+	// Load created folder
+	// We don't have a direct getter in service; return minimal payload
+	now := time.Now().Format(time.RFC3339)
+	var pidStr *string
+	if pid != nil {
+		s := pid.String()
+		pidStr = &s
+	}
+	return &model.Folder{ID: id.String(), Name: name, ParentID: pidStr, CreatedAt: now}, nil
+}
+
+// RenameFolder is the resolver for the renameFolder field.
+func (r *mutationResolver) RenameFolder(ctx context.Context, folderID string, newName string, expectedUpdatedAt *string) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return false, fmt.Errorf("folder service not configured")
+	}
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return false, fmt.Errorf("invalid folder id")
+	}
+	var expected *time.Time
+	if expectedUpdatedAt != nil && *expectedUpdatedAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, *expectedUpdatedAt)
+		if err != nil {
+			return false, fmt.Errorf("invalid expectedUpdatedAt")
+		}
+		expected = &t
+	}
+	if err := r.FolderService.RenameFolder(ctx, userID, fid, newName, expected); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MoveFolder is the resolver for the moveFolder field.
+func (r *mutationResolver) MoveFolder(ctx context.Context, folderID string, parentID *string) (*model.Folder, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder id")
+	}
+	var pid *uuid.UUID
+	if parentID != nil && *parentID != "" {
+		id, err := uuid.Parse(*parentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent id")
+		}
+		pid = &id
+	}
+	folder, err := r.FolderService.MoveFolder(ctx, userID, fid, pid)
+	if err != nil {
+		return nil, err
+	}
+	return toModelFolder(*folder), nil
+}
+
+// SetFolderDescription is the resolver for the setFolderDescription field.
+func (r *mutationResolver) SetFolderDescription(ctx context.Context, folderID string, description string) (*model.Folder, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder id")
+	}
+	folder, err := r.FolderService.SetDescription(ctx, userID, fid, description)
+	if err != nil {
+		return nil, err
+	}
+	return toModelFolder(*folder), nil
+}
+
+// SetFolderQuota is the resolver for the setFolderQuota field.
+func (r *mutationResolver) SetFolderQuota(ctx context.Context, folderID string, quotaBytes *int) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return false, fmt.Errorf("folder service not configured")
+	}
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return false, fmt.Errorf("invalid folder id")
+	}
+	var quota *int64
+	if quotaBytes != nil {
+		q := int64(*quotaBytes)
+		quota = &q
+	}
+	if err := r.FolderService.SetFolderQuota(ctx, userID, fid, quota); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteFolder is the resolver for the deleteFolder field.
+func (r *mutationResolver) DeleteFolder(ctx context.Context, folderID string) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return false, fmt.Errorf("folder service not configured")
+	}
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return false, fmt.Errorf("invalid folder id")
+	}
+	if err := r.FolderService.DeleteFolder(ctx, userID, fid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteFolderRecursive is the resolver for the deleteFolderRecursive field.
+func (r *mutationResolver) DeleteFolderRecursive(ctx context.Context, folderID string) (bool, error) {
+	// Require authentication
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+
+	// Parse folder ID
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return false, fmt.Errorf("invalid folder id")
+	}
+
+	// Use the new recursive delete method from FolderService
+	if err := r.FolderService.DeleteFolderRecursive(ctx, userID, fid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RecoverFolder is the resolver for the recoverFolder field.
+func (r *mutationResolver) RecoverFolder(ctx context.Context, folderID string) (*model.Folder, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	fid, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder id")
+	}
+	folder, err := r.FolderService.RecoverFolder(ctx, userID, fid)
+	if err != nil {
+		return nil, err
+	}
+	return toModelFolder(*folder), nil
+}
+
+// MoveUserFile is the resolver for the moveUserFile field.
+func (r *mutationResolver) MoveUserFile(ctx context.Context, mappingID string, folderID *string) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return false, fmt.Errorf("folder service not configured")
+	}
+	mid, err := uuid.Parse(mappingID)
+	if err != nil {
+		return false, fmt.Errorf("invalid mapping id")
+	}
+	var fid *uuid.UUID
+	if folderID != nil && *folderID != "" {
+		id, err := uuid.Parse(*folderID)
+		if err != nil {
+			return false, fmt.Errorf("invalid folder id")
+		}
+		fid = &id
+	}
+	results, err := r.FolderService.MoveFiles(ctx, userID, []services.FileMove{{MappingID: mid, FolderID: fid}})
+	if err != nil {
+		return false, err
+	}
+	if !results[0].Moved {
+		return false, errors.New(results[0].Error)
+	}
+	return true, nil
+}
+
+// SetFileDescription is the resolver for the setFileDescription field.
+func (r *mutationResolver) SetFileDescription(ctx context.Context, mappingID string, description string) (*model.UserFile, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	mid, err := uuid.Parse(mappingID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping id")
+	}
+	uf, err := r.FileService.SetDescription(ctx, userID, mid, description)
+	if err != nil {
+		return nil, err
+	}
+	return toModelUserFile(*uf), nil
+}
+
+// SetFileRetention is the resolver for the setFileRetention field.
+func (r *mutationResolver) SetFileRetention(ctx context.Context, mappingID string, retainUntil *string) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return false, services.ErrStorageUnavailable
+	}
+	mid, err := uuid.Parse(mappingID)
+	if err != nil {
+		return false, fmt.Errorf("invalid mapping id")
+	}
+	var until *time.Time
+	if retainUntil != nil && *retainUntil != "" {
+		t, err := time.Parse(time.RFC3339Nano, *retainUntil)
+		if err != nil {
+			return false, fmt.Errorf("invalid retainUntil")
+		}
+		until = &t
+	}
+	if err := r.FileService.SetRetention(ctx, userID, mid, until); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MoveUserFiles is the resolver for the moveUserFiles field.
+func (r *mutationResolver) MoveUserFiles(ctx context.Context, moves []*model.FileMoveInput) (bool, error) {
+	results, err := r.moveUserFiles(ctx, moves)
+	if err != nil {
+		return false, err
+	}
+	for _, res := range results {
+		if !res.Moved {
+			return false, errors.New(res.Error)
+		}
+	}
+	return true, nil
+}
+
+// MoveUserFilesWithResults is the resolver for the moveUserFilesWithResults field.
+func (r *mutationResolver) MoveUserFilesWithResults(ctx context.Context, moves []*model.FileMoveInput) ([]*model.FileMoveResult, error) {
+	results, err := r.moveUserFiles(ctx, moves)
+	if err != nil {
+		return nil, err
+	}
+	return toModelFileMoveResults(results), nil
+}
+
+// GroupFilesIntoNewFolder is the resolver for the groupFilesIntoNewFolder field.
+func (r *mutationResolver) GroupFilesIntoNewFolder(ctx context.Context, mappingIds []string, name string, parentID *string) (*model.GroupFilesResult, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	ids := make([]uuid.UUID, 0, len(mappingIds))
+	for _, raw := range mappingIds {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping id")
+		}
+		ids = append(ids, id)
+	}
+	var pid *uuid.UUID
+	if parentID != nil && *parentID != "" {
+		id, err := uuid.Parse(*parentID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent id")
+		}
+		pid = &id
+	}
+
+	folder, files, err := r.FileService.GroupIntoNewFolder(ctx, userID, ids, name, pid)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.GroupFilesResult{Folder: toModelFolder(*folder)}
+	for _, uf := range files {
+		result.Files = append(result.Files, toModelUserFile(uf))
+	}
+	return result, nil
+}
+
+// ShareFile is the resolver for the shareFile field.
+func (r *mutationResolver) ShareFile(ctx context.Context, input model.ShareFileInput) (*model.FileShare, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	fileID, err := uuid.Parse(input.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	var expiresAt *time.Time
 	if input.ExpiresAt != nil {
 		parsedTime, err := time.Parse(time.RFC3339, *input.ExpiresAt)
 		if err != nil {
@@ -585,7 +1112,7 @@ func (r *mutationResolver) ShareFile(ctx context.Context, input model.ShareFileI
 		expiresAt = &parsedTime
 	}
 
-	shares, err := r.ShareService.ShareFile(ctx, userID, fileID, input.Emails, input.Permission, expiresAt)
+	shares, failures, err := r.ShareService.ShareFile(ctx, userID, fileID, input.Emails, input.Permission, expiresAt)
 	if err != nil {
 		return nil, err
 	}
@@ -594,6 +1121,11 @@ func (r *mutationResolver) ShareFile(ctx context.Context, input model.ShareFileI
 		return nil, fmt.Errorf("failed to create share")
 	}
 
+	// Recipients who couldn't be notified are reported alongside the share
+	for _, f := range failures {
+		graphql.AddError(ctx, notifyFailureError(f))
+	}
+
 	// Return the first share created
 	share := shares[0]
 	return &model.FileShare{
@@ -606,6 +1138,41 @@ func (r *mutationResolver) ShareFile(ctx context.Context, input model.ShareFileI
 	}, nil
 }
 
+// BulkShareFiles is the resolver for the bulkShareFiles field.
+func (r *mutationResolver) BulkShareFiles(ctx context.Context, input model.BulkShareFilesInput) ([]*model.BulkShareResult, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	fileIDs := make([]uuid.UUID, len(input.FileIds))
+	for i, id := range input.FileIds {
+		if fileIDs[i], err = uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("invalid file ID: %s", id)
+		}
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresAt != nil {
+		parsedTime, err := time.Parse(time.RFC3339, *input.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_at format")
+		}
+		expiresAt = &parsedTime
+	}
+
+	results, err := r.ShareService.BulkShareFiles(ctx, userID, fileIDs, input.Emails, input.Permission, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return toModelBulkShareResults(results), nil
+}
+
 // ShareFolder is the resolver for the shareFolder field.
 func (r *mutationResolver) ShareFolder(ctx context.Context, input model.ShareFolderInput) (*model.FolderShare, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
@@ -632,7 +1199,7 @@ func (r *mutationResolver) ShareFolder(ctx context.Context, input model.ShareFol
 		expiresAt = &t
 	}
 
-	shares, err := r.ShareService.ShareFolder(ctx, userID, folderID, input.Emails, input.Permission, expiresAt)
+	shares, failures, err := r.ShareService.ShareFolder(ctx, userID, folderID, input.Emails, input.Permission, expiresAt)
 	if err != nil {
 		return nil, err
 	}
@@ -641,6 +1208,11 @@ func (r *mutationResolver) ShareFolder(ctx context.Context, input model.ShareFol
 		return nil, fmt.Errorf("no shares created")
 	}
 
+	// Recipients who couldn't be notified are reported alongside the share
+	for _, f := range failures {
+		graphql.AddError(ctx, notifyFailureError(f))
+	}
+
 	// Return the first share (representing the successful operation)
 	share := shares[0]
 	return &model.FolderShare{
@@ -700,11 +1272,140 @@ func (r *mutationResolver) UnshareFolder(ctx context.Context, folderID string, s
 		return false, err
 	}
 
-	return true, nil
+	return true, nil
+}
+
+// UnshareFileAll is the resolver for the unshareFileAll field.
+func (r *mutationResolver) UnshareFileAll(ctx context.Context, fileID string) (int, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID")
+	}
+
+	id, err := uuid.Parse(fileID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file ID")
+	}
+
+	return r.ShareService.UnshareFileAll(ctx, userID, id)
+}
+
+// UnshareFolderAll is the resolver for the unshareFolderAll field.
+func (r *mutationResolver) UnshareFolderAll(ctx context.Context, folderID string) (int, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID")
+	}
+
+	id, err := uuid.Parse(folderID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid folder ID")
+	}
+
+	return r.ShareService.UnshareFolderAll(ctx, userID, id)
+}
+
+// TransferFileOwnership is the resolver for the transferFileOwnership field.
+func (r *mutationResolver) TransferFileOwnership(ctx context.Context, fileID string, newOwnerEmail string) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID")
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return false, fmt.Errorf("invalid file ID")
+	}
+
+	if err := r.ShareService.TransferFileOwnership(ctx, userID, fileUUID, newOwnerEmail); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateFileSharePermission is the resolver for the updateFileSharePermission field.
+func (r *mutationResolver) UpdateFileSharePermission(ctx context.Context, fileID string, sharedWithEmail string, permission string) (*model.FileShare, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	share, err := r.ShareService.UpdateSharePermission(ctx, userID, fileUUID, sharedWithEmail, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.FileShare{
+		ID:              share.ID.String(),
+		FileID:          share.FileID.String(),
+		OwnerID:         share.OwnerID.String(),
+		SharedWithEmail: share.SharedWithEmail,
+		Permission:      share.Permission,
+		SharedAt:        share.SharedAt.Format(time.RFC3339),
+		ExpiresAt:       formatOptionalTime(share.ExpiresAt),
+	}, nil
+}
+
+// UpdateFolderSharePermission is the resolver for the updateFolderSharePermission field.
+func (r *mutationResolver) UpdateFolderSharePermission(ctx context.Context, folderID string, sharedWithEmail string, permission string) (*model.FolderShare, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	folderUUID, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+
+	share, err := r.ShareService.UpdateFolderSharePermission(ctx, userID, folderUUID, sharedWithEmail, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.FolderShare{
+		ID:              share.ID.String(),
+		FolderID:        share.FolderID.String(),
+		OwnerID:         share.OwnerID.String(),
+		SharedWithEmail: share.SharedWithEmail,
+		Permission:      share.Permission,
+		SharedAt:        share.SharedAt.Format(time.RFC3339),
+		ExpiresAt:       formatOptionalTime(share.ExpiresAt),
+	}, nil
 }
 
 // CreatePublicFileLink is the resolver for the createPublicFileLink field.
-func (r *mutationResolver) CreatePublicFileLink(ctx context.Context, fileID string, expiresAt *string) (*model.PublicFileLink, error) {
+func (r *mutationResolver) CreatePublicFileLink(ctx context.Context, fileID string, expiresAt *string, password *string, maxDownloads *int, forceNew *bool) (*model.PublicFileLink, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
@@ -728,31 +1429,30 @@ func (r *mutationResolver) CreatePublicFileLink(ctx context.Context, fileID stri
 	if r.PublicLinkService == nil {
 		return nil, fmt.Errorf("public link service not configured")
 	}
-	token, exp, err := r.PublicLinkService.CreateFileLink(ctx, userID, fileUUID, expPtr)
+	limit := 0
+	if maxDownloads != nil {
+		if *maxDownloads < 1 {
+			return nil, fmt.Errorf("maxDownloads must be at least 1")
+		}
+		limit = *maxDownloads
+	}
+	token, state, err := r.PublicLinkService.CreateFileLink(ctx, userID, fileUUID, expPtr, stringValue(password), limit, forceNew != nil && *forceNew)
 	if err != nil {
 		return nil, err
 	}
-	// Try to fetch active link to obtain created_at / revoked_at if needed (best-effort)
-	var createdAt = time.Now().Format(time.RFC3339)
-	// repository GetActiveFileLinkByFile returns (token, expiresAt, revokedAt)
-	if tkn, exp2, revoked, e2 := r.PublicLinkService.PublicRepo.GetActiveFileLinkByFile(ctx, fileUUID); e2 == nil && tkn == token {
-		if exp2 != nil {
-			exp = exp2
-		}
-		if revoked != nil { /* active link shouldn't be revoked, ignore */
-		}
-	}
-	var expStr *string
-	if exp != nil {
-		s := exp.Format(time.RFC3339)
-		expStr = &s
+	// Report the link as stored, which is an existing one when it was reused
+	var stored *int
+	if state.MaxDownloads != nil {
+		n := int(*state.MaxDownloads)
+		stored = &n
 	}
 	return &model.PublicFileLink{
-		FileID:    fileID,
-		Token:     token,
-		URL:       fmt.Sprintf("/share/%s", token),
-		CreatedAt: createdAt,
-		ExpiresAt: expStr,
+		FileID:       fileID,
+		Token:        token,
+		URL:          fmt.Sprintf("/share/%s", token),
+		CreatedAt:    state.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:    formatOptionalTime(state.ExpiresAt),
+		MaxDownloads: stored,
 	}, nil
 }
 
@@ -780,7 +1480,7 @@ func (r *mutationResolver) RevokePublicFileLink(ctx context.Context, fileID stri
 }
 
 // CreatePublicFolderLink is the resolver for the createPublicFolderLink field.
-func (r *mutationResolver) CreatePublicFolderLink(ctx context.Context, folderID string, expiresAt *string) (*model.PublicFolderLink, error) {
+func (r *mutationResolver) CreatePublicFolderLink(ctx context.Context, folderID string, expiresAt *string, password *string) (*model.PublicFolderLink, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
@@ -804,7 +1504,7 @@ func (r *mutationResolver) CreatePublicFolderLink(ctx context.Context, folderID
 	if r.PublicLinkService == nil {
 		return nil, fmt.Errorf("public link service not configured")
 	}
-	token, exp, err := r.PublicLinkService.CreateFolderLink(ctx, userID, folderUUID, expPtr)
+	token, exp, err := r.PublicLinkService.CreateFolderLink(ctx, userID, folderUUID, expPtr, stringValue(password))
 	if err != nil {
 		return nil, err
 	}
@@ -853,8 +1553,96 @@ func (r *mutationResolver) RevokePublicFolderLink(ctx context.Context, folderID
 	return true, nil
 }
 
+// RotatePublicFileLink is the resolver for the rotatePublicFileLink field.
+func (r *mutationResolver) RotatePublicFileLink(ctx context.Context, fileID string, preserveStats *bool) (*model.PublicFileLink, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+	if r.PublicLinkService == nil {
+		return nil, fmt.Errorf("public link service not configured")
+	}
+	preserve := preserveStats == nil || *preserveStats
+	token, exp, err := r.PublicLinkService.RotateFileLink(ctx, userID, fileUUID, preserve)
+	if err != nil {
+		return nil, err
+	}
+	var expStr *string
+	if exp != nil {
+		s := exp.Format(time.RFC3339)
+		expStr = &s
+	}
+	return &model.PublicFileLink{
+		FileID:    fileID,
+		Token:     token,
+		URL:       fmt.Sprintf("/share/%s", token),
+		CreatedAt: time.Now().Format(time.RFC3339),
+		ExpiresAt: expStr,
+	}, nil
+}
+
+// RotatePublicFolderLink is the resolver for the rotatePublicFolderLink field.
+func (r *mutationResolver) RotatePublicFolderLink(ctx context.Context, folderID string, preserveStats *bool) (*model.PublicFolderLink, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+	folderUUID, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+	if r.PublicLinkService == nil {
+		return nil, fmt.Errorf("public link service not configured")
+	}
+	preserve := preserveStats == nil || *preserveStats
+	token, exp, err := r.PublicLinkService.RotateFolderLink(ctx, userID, folderUUID, preserve)
+	if err != nil {
+		return nil, err
+	}
+	var expStr *string
+	if exp != nil {
+		s := exp.Format(time.RFC3339)
+		expStr = &s
+	}
+	return &model.PublicFolderLink{
+		FolderID:  folderID,
+		Token:     token,
+		URL:       fmt.Sprintf("/share/%s", token),
+		CreatedAt: time.Now().Format(time.RFC3339),
+		ExpiresAt: expStr,
+	}, nil
+}
+
+// RevokeAllMyPublicLinks is the resolver for the revokeAllMyPublicLinks field.
+func (r *mutationResolver) RevokeAllMyPublicLinks(ctx context.Context) (int, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id in token")
+	}
+	if r.PublicLinkService == nil {
+		return 0, fmt.Errorf("public link service not configured")
+	}
+	return r.PublicLinkService.RevokeAllMyPublicLinks(ctx, userID)
+}
+
 // AddPublicFileToMyStorage is the resolver for the addPublicFileToMyStorage field.
-func (r *mutationResolver) AddPublicFileToMyStorage(ctx context.Context, token string) (bool, error) {
+func (r *mutationResolver) AddPublicFileToMyStorage(ctx context.Context, token string, password *string) (bool, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return false, fmt.Errorf("unauthorized")
@@ -866,7 +1654,8 @@ func (r *mutationResolver) AddPublicFileToMyStorage(ctx context.Context, token s
 	if r.PublicLinkService == nil {
 		return false, fmt.Errorf("public link service not configured")
 	}
-	f, _, _, revoked, err := r.PublicLinkService.ResolveFileLink(ctx, token)
+	// Saving isn't a download, so it leaves the link's download count alone
+	f, _, _, revoked, err := r.PublicLinkService.CheckFileLink(ctx, token, stringValue(password))
 	if err != nil {
 		return false, err
 	}
@@ -1014,13 +1803,59 @@ func (r *mutationResolver) UnstarFolder(ctx context.Context, folderID string) (b
 	return true, nil
 }
 
+// CreateAPIToken is the resolver for the createAPIToken field.
+func (r *mutationResolver) CreateAPIToken(ctx context.Context, name string, scopes []string) (*model.CreatedAPIToken, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	// A leaked token must not be able to mint more tokens
+	if _, viaToken := middleware.GetAPITokenIDFromContext(ctx); viaToken {
+		return nil, fmt.Errorf("api tokens can't be managed with an api token")
+	}
+
+	t, token, err := r.AuthService.CreateAPIToken(ctx, userID, name, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &model.CreatedAPIToken{Token: token, APIToken: toModelAPIToken(*t)}, nil
+}
+
+// RevokeAPIToken is the resolver for the revokeAPIToken field.
+func (r *mutationResolver) RevokeAPIToken(ctx context.Context, id string) (bool, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return false, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id in token")
+	}
+	if _, viaToken := middleware.GetAPITokenIDFromContext(ctx); viaToken {
+		return false, fmt.Errorf("api tokens can't be managed with an api token")
+	}
+
+	tokenID, err := uuid.Parse(id)
+	if err != nil {
+		return false, fmt.Errorf("invalid token id")
+	}
+	if err := r.AuthService.RevokeAPIToken(ctx, userID, tokenID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Health is the resolver for the _health field.
 func (r *queryResolver) Health(ctx context.Context) (string, error) {
 	return "ok", nil
 }
 
 // MyFiles is the resolver for the myFiles field.
-func (r *queryResolver) MyFiles(ctx context.Context) ([]*model.UserFile, error) {
+func (r *queryResolver) MyFiles(ctx context.Context, withDownloadStats *bool, mostDownloadedFirst *bool) ([]*model.UserFile, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
@@ -1030,12 +1865,19 @@ func (r *queryResolver) MyFiles(ctx context.Context) ([]*model.UserFile, error)
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 	if r.FileService == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, services.ErrStorageUnavailable
 	}
 	ufs, err := r.FileService.GetUserFiles(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	// Download counts are opt-in: they cost an extra aggregate query
+	mostDownloaded := mostDownloadedFirst != nil && *mostDownloadedFirst
+	if mostDownloaded || (withDownloadStats != nil && *withDownloadStats) {
+		if err := r.FileDownloadService.AttachDownloadStats(ctx, userID, ufs, mostDownloaded); err != nil {
+			return nil, err
+		}
+	}
 	var out []*model.UserFile
 	for _, uf := range ufs {
 		// Inline pointer construction for optional fields
@@ -1069,13 +1911,14 @@ func (r *queryResolver) MyFiles(ctx context.Context) ([]*model.UserFile, error)
 				Name:    namePtr,
 				Picture: picPtr,
 			},
+			DownloadStats: toModelDownloadCounts(uf.DownloadStats),
 		})
 	}
 	return out, nil
 }
 
 // MyFolderFiles is the resolver for the myFolderFiles field.
-func (r *queryResolver) MyFolderFiles(ctx context.Context, folderID *string) ([]*model.UserFile, error) {
+func (r *queryResolver) MyFolderFiles(ctx context.Context, folderID *string, sortBy *model.FileSort, withDownloadStats *bool, mostDownloadedFirst *bool) ([]*model.UserFile, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
@@ -1085,7 +1928,7 @@ func (r *queryResolver) MyFolderFiles(ctx context.Context, folderID *string) ([]
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 	if r.FileService == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, services.ErrStorageUnavailable
 	}
 	var fid *uuid.UUID
 	if folderID != nil && *folderID != "" {
@@ -1095,10 +1938,17 @@ func (r *queryResolver) MyFolderFiles(ctx context.Context, folderID *string) ([]
 		}
 		fid = &id
 	}
-	ufs, err := r.FileService.FileRepo.ListUserFilesInFolder(ctx, userID, fid)
+	ufs, err := r.FileService.FileRepo.ListUserFilesInFolder(ctx, userID, fid, toRepoFileSort(sortBy))
 	if err != nil {
 		return nil, err
 	}
+	// Download counts are opt-in: they cost an extra aggregate query
+	mostDownloaded := mostDownloadedFirst != nil && *mostDownloadedFirst
+	if mostDownloaded || (withDownloadStats != nil && *withDownloadStats) {
+		if err := r.FileDownloadService.AttachDownloadStats(ctx, userID, ufs, mostDownloaded); err != nil {
+			return nil, err
+		}
+	}
 	out := make([]*model.UserFile, 0, len(ufs))
 	for _, uf := range ufs {
 		var namePtr *string
@@ -1112,16 +1962,18 @@ func (r *queryResolver) MyFolderFiles(ctx context.Context, folderID *string) ([]
 			picPtr = &p
 		}
 		out = append(out, &model.UserFile{
-			ID:         uf.ID.String(),
-			UserID:     uf.UserID.String(),
-			FileID:     uf.FileID.String(),
-			UploadedAt: uf.UploadedAt.Format(time.RFC3339),
+			ID:             uf.ID.String(),
+			UserID:         uf.UserID.String(),
+			FileID:         uf.FileID.String(),
+			UploadedAt:     uf.UploadedAt.Format(time.RFC3339),
+			LastAccessedAt: formatOptionalTime(uf.LastAccessedAt),
 			File: &model.File{
 				ID: uf.File.ID.String(), Hash: uf.File.Hash, OriginalName: uf.File.OriginalName,
 				MimeType: uf.File.MimeType, Size: int(uf.File.Size), RefCount: uf.File.RefCount,
 				Visibility: uf.File.Visibility, CreatedAt: uf.File.CreatedAt.Format(time.RFC3339),
 			},
-			Uploader: &model.Uploader{Email: uf.UploaderEmail, Name: namePtr, Picture: picPtr},
+			Uploader:      &model.Uploader{Email: uf.UploaderEmail, Name: namePtr, Picture: picPtr},
+			DownloadStats: toModelDownloadCounts(uf.DownloadStats),
 		})
 	}
 	return out, nil
@@ -1138,7 +1990,7 @@ func (r *queryResolver) MyDeletedFiles(ctx context.Context) ([]*model.UserFile,
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 	if r.FileService == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, services.ErrStorageUnavailable
 	}
 	ufs, err := r.FileService.GetDeletedUserFiles(ctx, userID)
 	if err != nil {
@@ -1183,6 +2035,30 @@ func (r *queryResolver) MyDeletedFiles(ctx context.Context) ([]*model.UserFile,
 	return out, nil
 }
 
+// MyDeletedFolders is the resolver for the myDeletedFolders field.
+func (r *queryResolver) MyDeletedFolders(ctx context.Context) ([]*model.Folder, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	folders, err := r.FolderService.GetDeletedFolders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*model.Folder, 0, len(folders))
+	for _, f := range folders {
+		out = append(out, toModelFolder(f))
+	}
+	return out, nil
+}
+
 // MyStorage is the resolver for the myStorage field.
 func (r *queryResolver) MyStorage(ctx context.Context) (*model.StorageUsage, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
@@ -1194,36 +2070,77 @@ func (r *queryResolver) MyStorage(ctx context.Context) (*model.StorageUsage, err
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 	if r.FileService == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, services.ErrStorageUnavailable
 	}
-	used, quota, err := r.FileService.GetUserUsage(ctx, userID)
+	usage, err := r.FileService.GetUsageBreakdown(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	// attributed physical usage (sum of size/ref_count per file)
-	attributed, err := r.FileService.GetUserAttributedUsage(ctx, userID)
+	percent := float64(0)
+	if usage.QuotaBytes > 0 {
+		percent = (float64(usage.LogicalBytes) / float64(usage.QuotaBytes)) * 100.0
+	}
+	return &model.StorageUsage{
+		UsedBytes:       int(usage.LogicalBytes),
+		QuotaBytes:      int(usage.QuotaBytes),
+		PercentUsed:     percent,
+		SavingsBytes:    int(usage.DedupSavedBytes),
+		SavingsPercent:  usage.DedupSavedPercent(),
+		AttributedBytes: int(usage.AttributedBytes),
+		FileCount:       usage.FileCount,
+	}, nil
+}
+
+// MyUsageHistory is the resolver for the myUsageHistory field.
+func (r *queryResolver) MyUsageHistory(ctx context.Context, days *int) ([]*model.UsageSnapshot, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.UsageService == nil {
+		return nil, fmt.Errorf("usage service not configured")
+	}
+	n := 30
+	if days != nil {
+		n = *days
+	}
+	snapshots, err := r.UsageService.GetUsageHistory(ctx, userID, n)
 	if err != nil {
 		return nil, err
 	}
-	percent := float64(0)
-	if quota > 0 {
-		percent = (float64(used) / float64(quota)) * 100.0
+	out := make([]*model.UsageSnapshot, 0, len(snapshots))
+	for _, snap := range snapshots {
+		out = append(out, &model.UsageSnapshot{
+			Date:            snap.Date.Format("2006-01-02"),
+			LogicalBytes:    int(snap.LogicalBytes),
+			AttributedBytes: int(snap.AttributedBytes),
+		})
 	}
-	savings := used - attributed
-	if savings < 0 {
-		savings = 0
+	return out, nil
+}
+
+// MyOrganization is the resolver for the myOrganization field.
+func (r *queryResolver) MyOrganization(ctx context.Context) (*model.Organization, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
 	}
-	savingsPercent := float64(0)
-	if used > 0 {
-		savingsPercent = (float64(savings) / float64(used)) * 100.0
+	if r.OrganizationService == nil {
+		return nil, nil
 	}
-	return &model.StorageUsage{
-		UsedBytes:      int(used),
-		QuotaBytes:     int(quota),
-		PercentUsed:    percent,
-		SavingsBytes:   int(savings),
-		SavingsPercent: savingsPercent,
-	}, nil
+	usage, err := r.OrganizationService.GetUserOrganization(ctx, userID)
+	if err != nil || usage == nil {
+		return nil, err
+	}
+	return toModelOrganization(usage.Organization, usage.UsedBytes), nil
 }
 
 // FindMyFileByHash is the resolver for the findMyFileByHash field.
@@ -1237,7 +2154,7 @@ func (r *queryResolver) FindMyFileByHash(ctx context.Context, hash string) (*mod
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 	if r.FileService == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, services.ErrStorageUnavailable
 	}
 	uf, err := r.FileService.FindUserFileByHash(ctx, userID, hash)
 	if err != nil {
@@ -1299,7 +2216,7 @@ func (r *queryResolver) FileURL(ctx context.Context, fileID string, inline *bool
 		in = *inline
 	}
 	if r.FileService == nil {
-		return "", fmt.Errorf("file service not configured")
+		return "", services.ErrStorageUnavailable
 	}
 
 	// First try to get the file URL if user owns it
@@ -1319,6 +2236,9 @@ func (r *queryResolver) FileURL(ctx context.Context, fileID string, inline *bool
 		}
 		return fileURL, nil
 	}
+	if errors.Is(err, services.ErrFileQuarantined) {
+		return "", err
+	}
 
 	// If user doesn't own the file, check if it's shared with them
 	fmt.Printf("DEBUG: User %s doesn't own file %s, checking for shared access\n", userID, fid)
@@ -1346,17 +2266,22 @@ func (r *queryResolver) FileURL(ctx context.Context, fileID string, inline *bool
 	if file == nil {
 		return "", fmt.Errorf("file not found")
 	}
+	fileURL, err = r.FileService.PresignFileURL(ctx, file, in)
+	if err != nil {
+		return "", err
+	}
 
 	// Track the download for shared files
 	// Get the owner ID of the file first
 	ownerUserFile, err := r.FileService.FileRepo.GetOwnerByFileID(ctx, fid)
 	if err == nil && ownerUserFile != nil && r.FileDownloadService != nil {
 		// Record the download tracking (fire and forget, don't fail if tracking fails)
+		trackCtx := context.WithoutCancel(ctx)
 		go func() {
 			// Validate that the downloader and owner are different to avoid self-downloads
 			if userID != ownerUserFile.UserID {
 				fmt.Printf("TRACKING: Recording download - File: %s, Owner: %s, Downloader: %s\n", fid, ownerUserFile.UserID, userID)
-				err := r.FileDownloadService.DownloadRepo.RecordDownload(context.Background(), fid, ownerUserFile.UserID, &userID, "shared", "", "GraphQL", "GraphQL-Client")
+				err := r.FileDownloadService.RecordSharedFileDownload(trackCtx, fid, ownerUserFile.UserID, &userID, nil)
 				if err != nil {
 					// Log error but don't fail the request - tracking is not critical
 					fmt.Printf("WARNING: Failed to record download tracking: %v\n", err)
@@ -1379,30 +2304,107 @@ func (r *queryResolver) FileURL(ctx context.Context, fileID string, inline *bool
 		}
 	}
 
-	// Prepare response-content-disposition
-	dispType := "attachment"
-	if in {
-		dispType = "inline"
+	return fileURL, nil
+}
+
+// FileURLByHash is the resolver for the fileURLByHash field.
+func (r *queryResolver) FileURLByHash(ctx context.Context, hash string, inline *bool) (string, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid user id in token")
+	}
+	in := false
+	if inline != nil {
+		in = *inline
+	}
+	if r.FileService == nil {
+		return "", services.ErrStorageUnavailable
+	}
+	fileURL, err := r.FileService.GetFileURLByHash(ctx, userID, hash, in)
+	if err != nil {
+		return "", err
+	}
+	// Counted like fileURL's owner downloads
+	if r.FileDownloadService != nil && r.FileDownloadService.DownloadRepo != nil {
+		if uf, ferr := r.FileService.FindUserFileByHash(ctx, userID, strings.ToLower(strings.TrimSpace(hash))); ferr == nil && uf != nil {
+			go func() {
+				downloader := userID
+				if err := r.FileDownloadService.DownloadRepo.RecordDownload(context.Background(), uf.FileID, userID, &downloader, "direct", "", "GraphQL", "GraphQL-Client"); err != nil {
+					fmt.Printf("WARNING: Failed to record direct download: %v\n", err)
+				}
+			}()
+		}
+	}
+	return fileURL, nil
+}
+
+// FileTextPreview is the resolver for the fileTextPreview field.
+func (r *queryResolver) FileTextPreview(ctx context.Context, fileID string, maxBytes *int) (*model.TextPreview, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	fid, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file id")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	limit := 0
+	if maxBytes != nil {
+		limit = *maxBytes
+	}
+	preview, err := r.FileService.GetTextPreview(ctx, userID, fid, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TextPreview{
+		Content:   preview.Content,
+		MimeType:  preview.MimeType,
+		Size:      int(preview.Size),
+		Truncated: preview.Truncated,
+	}, nil
+}
+
+// FileChecksum is the resolver for the fileChecksum field.
+func (r *queryResolver) FileChecksum(ctx context.Context, fileID string, includeCrc32 *bool) (*model.FileChecksum, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	fid, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file id")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
 	}
-	reqParams := url.Values{}
-	reqParams.Set("response-content-disposition", fmt.Sprintf("%s; filename=\"%s\"", dispType, file.OriginalName))
-
-	expiry := 10 * time.Minute
-	u, err := r.FileService.Minio.PresignedGetObject(ctx, r.FileService.Bucket, file.StoragePath, expiry, reqParams)
+	sum, err := r.FileService.GetFileChecksum(ctx, userID, fid, includeCrc32 != nil && *includeCrc32)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if r.FileService.PublicEndpoint != "" {
-		if base, perr := url.Parse(r.FileService.PublicEndpoint); perr == nil {
-			u.Scheme = base.Scheme
-			u.Host = base.Host
-		}
+	out := &model.FileChecksum{FileID: sum.FileID.String(), Sha256: sum.SHA256, Size: int(sum.Size)}
+	if sum.CRC32 != "" {
+		out.Crc32 = &sum.CRC32
 	}
-	return u.String(), nil
+	return out, nil
 }
 
 // SearchMyFiles is the resolver for the searchMyFiles field.
-func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSearchFilter, pagination *model.PageInput) (*model.UserFileConnection, error) {
+func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSearchFilter, pagination *model.PageInput, includeTotalBytes *bool) (*model.UserFileConnection, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
@@ -1412,13 +2414,14 @@ func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSear
 		return nil, fmt.Errorf("invalid user id in token")
 	}
 	if r.FileService == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, services.ErrStorageUnavailable
 	}
 	// Map GraphQL filter to repo filter
 	rf := repository.SearchFilter{}
 	if filter.Filename != nil && *filter.Filename != "" {
 		rf.Filename = filter.Filename
 	}
+	rf.FilenameMatch = toRepoFilenameMatch(filter.FilenameMatch)
 	if len(filter.MimeTypes) > 0 {
 		rf.MimeTypes = filter.MimeTypes
 	}
@@ -1446,6 +2449,14 @@ func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSear
 	if filter.UploaderName != nil && *filter.UploaderName != "" {
 		rf.UploaderName = filter.UploaderName
 	}
+	rf.Scope = toRepoSearchScope(filter.Scope)
+	if filter.FolderID != nil && *filter.FolderID != "" {
+		fid, err := uuid.Parse(*filter.FolderID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid folder id")
+		}
+		rf.FolderID = &fid
+	}
 
 	pg := repository.Page{Limit: 50}
 	if pagination != nil {
@@ -1453,9 +2464,11 @@ func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSear
 			pg.Limit = *pagination.Limit
 		}
 		pg.Cursor = pagination.Cursor
+		pg.Sort = toRepoFileSort(pagination.SortBy)
 	}
+	pg.WithTotalBytes = includeTotalBytes != nil && *includeTotalBytes
 
-	items, next, total, err := r.FileService.SearchUserFiles(ctx, userID, rf, pg)
+	items, next, totals, err := r.FileService.SearchUserFiles(ctx, userID, rf, pg)
 	if err != nil {
 		return nil, err
 	}
@@ -1473,12 +2486,13 @@ func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSear
 			picPtr = &p
 		}
 		edges = append(edges, &model.UserFileEdge{
-			Cursor: fmt.Sprintf("%d:%s", uf.UploadedAt.UnixNano(), uf.ID.String()),
+			Cursor: repository.FileCursor(uf, pg.Sort),
 			Node: &model.UserFile{
-				ID:         uf.ID.String(),
-				UserID:     uf.UserID.String(),
-				FileID:     uf.FileID.String(),
-				UploadedAt: uf.UploadedAt.Format(time.RFC3339),
+				ID:             uf.ID.String(),
+				UserID:         uf.UserID.String(),
+				FileID:         uf.FileID.String(),
+				UploadedAt:     uf.UploadedAt.Format(time.RFC3339),
+				LastAccessedAt: formatOptionalTime(uf.LastAccessedAt),
 				File: &model.File{
 					ID:           uf.File.ID.String(),
 					Hash:         uf.File.Hash,
@@ -1498,14 +2512,39 @@ func (r *queryResolver) SearchMyFiles(ctx context.Context, filter model.FileSear
 		})
 	}
 
-	return &model.UserFileConnection{
+	conn := &model.UserFileConnection{
 		Edges: edges,
 		PageInfo: &model.PageInfo{
 			EndCursor:   next,
 			HasNextPage: next != nil,
 		},
-		TotalCount: total,
-	}, nil
+		TotalCount: totals.Count,
+	}
+	if pg.WithTotalBytes {
+		b := int(totals.Bytes)
+		conn.TotalBytes = &b
+	}
+	return conn, nil
+}
+
+// SuggestMyFilenames is the resolver for the suggestMyFilenames field.
+func (r *queryResolver) SuggestMyFilenames(ctx context.Context, prefix string, limit *int) ([]string, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	return r.FileService.SuggestFilenames(ctx, userID, prefix, n)
 }
 
 // MyFolders is the resolver for the myFolders field.
@@ -1540,11 +2579,85 @@ func (r *queryResolver) MyFolders(ctx context.Context, parentID *string) ([]*mod
 			s := f.ParentID.String()
 			pStr = &s
 		}
-		out = append(out, &model.Folder{ID: f.ID.String(), Name: f.Name, ParentID: pStr, CreatedAt: f.CreatedAt.Format(time.RFC3339)})
+		out = append(out, &model.Folder{ID: f.ID.String(), Name: f.Name, ParentID: pStr, CreatedAt: f.CreatedAt.Format(time.RFC3339), UpdatedAt: formatVersion(f.UpdatedAt)})
+	}
+	return out, nil
+}
+
+// FolderContents is the resolver for the folderContents field.
+func (r *queryResolver) FolderContents(ctx context.Context, folderID *string) (*model.FolderContents, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	var fid *uuid.UUID
+	if folderID != nil && *folderID != "" {
+		id, err := uuid.Parse(*folderID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid folder id")
+		}
+		fid = &id
+	}
+	contents, err := r.FolderService.GetFolderContents(ctx, userID, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &model.FolderContents{
+		Subfolders: make([]*model.Folder, 0, len(contents.Subfolders)),
+		Files:      make([]*model.UserFile, 0, len(contents.Files)),
+	}
+	if contents.Folder != nil {
+		out.Folder = toModelFolder(*contents.Folder)
+	}
+	for _, f := range contents.Subfolders {
+		out.Subfolders = append(out.Subfolders, toModelFolder(f))
+	}
+	for _, uf := range contents.Files {
+		out.Files = append(out.Files, toModelUserFile(uf))
 	}
 	return out, nil
 }
 
+// FolderTree is the resolver for the folderTree field.
+func (r *queryResolver) FolderTree(ctx context.Context, rootID *string, depth *int) ([]*model.FolderTreeNode, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	if r.FolderService == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	var rid *uuid.UUID
+	if rootID != nil && *rootID != "" {
+		id, err := uuid.Parse(*rootID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid folder id")
+		}
+		rid = &id
+	}
+	maxDepth := 2
+	if depth != nil {
+		maxDepth = *depth
+	}
+	tree, err := r.FolderService.GetFolderTree(ctx, userID, rid, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return toModelFolderTree(tree), nil
+}
+
 // SharedFilesWithMe is the resolver for the sharedFilesWithMe field.
 func (r *queryResolver) SharedFilesWithMe(ctx context.Context) ([]*model.SharedFileWithMe, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
@@ -1691,148 +2804,324 @@ func (r *queryResolver) SharedFolderFiles(ctx context.Context, folderID string)
 			},
 		})
 	}
-
+
+	return result, nil
+}
+
+// SharedFolderSubfolders is the resolver for the sharedFolderSubfolders field.
+func (r *queryResolver) SharedFolderSubfolders(ctx context.Context, folderID string) ([]*model.Folder, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	folderUUID, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+
+	// Get user email for access check
+	userEmail, err := r.ShareService.UserRepo.GetUserEmailByID(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user email: %w", err)
+	}
+
+	// Check if user has access to the folder
+	hasAccess, _, err := r.ShareService.HasFolderAccess(ctx, userID, userEmail, folderUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check folder access: %w", err)
+	}
+	if !hasAccess {
+		return nil, fmt.Errorf("access denied to folder")
+	}
+
+	// Get subfolders within the shared folder
+	subfolders, err := r.ShareService.GetSharedFolderSubfolders(ctx, userID, folderUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subfolders: %w", err)
+	}
+
+	var result []*model.Folder
+	for _, folder := range subfolders {
+		result = append(result, toModelSharedFolder(folder))
+	}
+
+	return result, nil
+}
+
+// FileShares is the resolver for the fileShares field.
+func (r *queryResolver) FileShares(ctx context.Context, fileID string) ([]*model.FileShare, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	shares, err := r.ShareService.GetFileShares(ctx, userID, fileUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.FileShare
+	for _, share := range shares {
+
+		result = append(result, &model.FileShare{
+			ID:              share.ID.String(),
+			FileID:          share.FileID.String(),
+			OwnerID:         share.OwnerID.String(),
+			SharedWithEmail: share.SharedWithEmail,
+			Permission:      share.Permission,
+			SharedAt:        share.SharedAt.Format(time.RFC3339),
+		})
+	}
+
+	return result, nil
+}
+
+// FolderShares is the resolver for the folderShares field.
+func (r *queryResolver) FolderShares(ctx context.Context, folderID string) ([]*model.FolderShare, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	folderUUID, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+
+	shares, err := r.ShareService.GetFolderShares(ctx, userID, folderUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.FolderShare
+	for _, share := range shares {
+		result = append(result, &model.FolderShare{
+			ID:              share.ID.String(),
+			FolderID:        share.FolderID.String(),
+			OwnerID:         share.OwnerID.String(),
+			SharedWithEmail: share.SharedWithEmail,
+			Permission:      share.Permission,
+			SharedAt:        share.SharedAt.Format(time.RFC3339),
+		})
+	}
+
+	return result, nil
+}
+
+// FolderSharePreview is the resolver for the folderSharePreview field.
+func (r *queryResolver) FolderSharePreview(ctx context.Context, folderID string) (*model.FolderSharePreview, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	folderUUID, err := uuid.Parse(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+	preview, err := r.ShareService.PreviewFolderShare(ctx, userID, folderUUID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.FolderSharePreview{
+		FolderID:       preview.FolderID.String(),
+		FileCount:      preview.FileCount,
+		SubfolderCount: preview.SubfolderCount,
+		TotalBytes:     int(preview.TotalBytes),
+	}, nil
+}
+
+// SharesCreatedByMe is the resolver for the sharesCreatedByMe field.
+func (r *queryResolver) SharesCreatedByMe(ctx context.Context) (*model.SharesCreatedByMe, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	shares, err := r.ShareService.GetSharesCreatedByMe(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toModelSharesCreatedByMe(shares), nil
+}
+
+// FileShareAccess is the resolver for the fileShareAccess field.
+func (r *queryResolver) FileShareAccess(ctx context.Context, fileID string) ([]*model.ShareAccessStatus, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+	if r.ShareService == nil {
+		return nil, fmt.Errorf("share service not configured")
+	}
+
+	access, err := r.ShareService.GetShareAccessStatus(ctx, userID, fileUUID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.ShareAccessStatus, 0, len(access))
+	for _, a := range access {
+		var recipient *string
+		if a.RecipientID != nil {
+			id := a.RecipientID.String()
+			recipient = &id
+		}
+		result = append(result, &model.ShareAccessStatus{
+			ShareID:          a.ShareID.String(),
+			SharedWithEmail:  a.SharedWithEmail,
+			SharedWithID:     recipient,
+			Accessed:         a.LastAccessedAt != nil,
+			LastDownloadedAt: formatOptionalTime(a.LastDownloadedAt),
+			LastPreviewedAt:  formatOptionalTime(a.LastPreviewedAt),
+			LastAccessedAt:   formatOptionalTime(a.LastAccessedAt),
+		})
+	}
 	return result, nil
 }
 
-// SharedFolderSubfolders is the resolver for the sharedFolderSubfolders field.
-func (r *queryResolver) SharedFolderSubfolders(ctx context.Context, folderID string) ([]*model.Folder, error) {
+// AccessLevels is the resolver for the accessLevels field.
+func (r *queryResolver) AccessLevels(ctx context.Context, items []*model.AccessItemInput) ([]*model.ItemAccess, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
 	}
-
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid user ID")
 	}
-
-	folderUUID, err := uuid.Parse(folderID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid folder ID")
-	}
-
-	// Get user email for access check
-	userEmail, err := r.ShareService.UserRepo.GetUserEmailByID(ctx, userID.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user email: %w", err)
+	if r.ShareService == nil {
+		return nil, fmt.Errorf("share service not configured")
 	}
 
-	// Check if user has access to the folder
-	hasAccess, _, err := r.ShareService.HasFolderAccess(ctx, userID, userEmail, folderUUID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check folder access: %w", err)
-	}
-	if !hasAccess {
-		return nil, fmt.Errorf("access denied to folder")
+	accessItems := make([]models.AccessItem, 0, len(items))
+	for _, item := range items {
+		itemID, err := uuid.Parse(item.ItemID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item ID: %s", item.ItemID)
+		}
+		accessItems = append(accessItems, models.AccessItem{Type: item.ItemType, ID: itemID})
 	}
 
-	// Get subfolders within the shared folder
-	subfolders, err := r.ShareService.GetSharedFolderSubfolders(ctx, userID, folderUUID)
+	levels, err := r.ShareService.GetAccessLevels(ctx, userID, accessItems)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get subfolders: %w", err)
+		return nil, err
 	}
-
-	var result []*model.Folder
-	for _, folder := range subfolders {
-		result = append(result, &model.Folder{
-			ID:   folder.ID.String(),
-			Name: folder.Name,
-			ParentID: func() *string {
-				if folder.ParentID != nil {
-					s := folder.ParentID.String()
-					return &s
-				}
-				return nil
-			}(),
-			CreatedAt: folder.CreatedAt.Format(time.RFC3339),
+	result := make([]*model.ItemAccess, 0, len(levels))
+	for _, l := range levels {
+		result = append(result, &model.ItemAccess{
+			ItemType:   l.Type,
+			ItemID:     l.ID.String(),
+			Permission: l.Permission,
 		})
 	}
-
 	return result, nil
 }
 
-// FileShares is the resolver for the fileShares field.
-func (r *queryResolver) FileShares(ctx context.Context, fileID string) ([]*model.FileShare, error) {
+// MyPublicLinks is the resolver for the myPublicLinks field.
+func (r *queryResolver) MyPublicLinks(ctx context.Context) (*model.MyPublicLinks, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
 	}
-
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID")
+		return nil, fmt.Errorf("invalid user id in token")
 	}
-
-	fileUUID, err := uuid.Parse(fileID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid file ID")
+	if r.PublicLinkService == nil {
+		return nil, fmt.Errorf("public link service not configured")
 	}
-
-	shares, err := r.ShareService.GetFileShares(ctx, userID, fileUUID)
+	links, err := r.PublicLinkService.ListMyPublicLinks(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-
-	var result []*model.FileShare
-	for _, share := range shares {
-
-		result = append(result, &model.FileShare{
-			ID:              share.ID.String(),
-			FileID:          share.FileID.String(),
-			OwnerID:         share.OwnerID.String(),
-			SharedWithEmail: share.SharedWithEmail,
-			Permission:      share.Permission,
-			SharedAt:        share.SharedAt.Format(time.RFC3339),
-		})
-	}
-
-	return result, nil
+	return toModelMyPublicLinks(links), nil
 }
 
-// FolderShares is the resolver for the folderShares field.
-func (r *queryResolver) FolderShares(ctx context.Context, folderID string) ([]*model.FolderShare, error) {
+// PublicLinkStats is the resolver for the publicLinkStats field.
+func (r *queryResolver) PublicLinkStats(ctx context.Context, fileID string, from *string, to *string, granularity *model.LinkStatsGranularity) (*model.PublicLinkStats, error) {
 	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unauthorized")
 	}
-
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID")
+		return nil, fmt.Errorf("invalid user id in token")
 	}
-
-	folderUUID, err := uuid.Parse(folderID)
+	fid, err := uuid.Parse(fileID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid folder ID")
+		return nil, fmt.Errorf("invalid file ID")
 	}
-
-	shares, err := r.ShareService.GetFolderShares(ctx, userID, folderUUID)
+	if r.PublicLinkService == nil {
+		return nil, fmt.Errorf("public link service not configured")
+	}
+	var fromTime, toTime *time.Time
+	if from != nil && *from != "" {
+		t, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from")
+		}
+		fromTime = &t
+	}
+	if to != nil && *to != "" {
+		t, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to")
+		}
+		toTime = &t
+	}
+	bucket := services.BucketDay
+	if granularity != nil && *granularity == model.LinkStatsGranularityHour {
+		bucket = services.BucketHour
+	}
+	stats, err := r.PublicLinkService.GetLinkStats(ctx, userID, fid, fromTime, toTime, bucket)
 	if err != nil {
 		return nil, err
 	}
-
-	var result []*model.FolderShare
-	for _, share := range shares {
-		result = append(result, &model.FolderShare{
-			ID:              share.ID.String(),
-			FolderID:        share.FolderID.String(),
-			OwnerID:         share.OwnerID.String(),
-			SharedWithEmail: share.SharedWithEmail,
-			Permission:      share.Permission,
-			SharedAt:        share.SharedAt.Format(time.RFC3339),
-		})
-	}
-
-	return result, nil
+	return toModelPublicLinkStats(stats), nil
 }
 
 // ResolvePublicFileLink is the resolver for the resolvePublicFileLink field.
-func (r *queryResolver) ResolvePublicFileLink(ctx context.Context, token string) (*model.PublicFileLinkResolved, error) {
+func (r *queryResolver) ResolvePublicFileLink(ctx context.Context, token string, password *string) (*model.PublicFileLinkResolved, error) {
 	if r.PublicLinkService == nil {
 		return nil, fmt.Errorf("public link service not configured")
 	}
-	f, owner, expiresAt, revoked, err := r.PublicLinkService.ResolveFileLink(ctx, token)
+	f, owner, expiresAt, revoked, err := r.PublicLinkService.ResolveFileLink(ctx, token, stringValue(password))
 	if err != nil {
 		return nil, err
 	}
@@ -1842,17 +3131,11 @@ func (r *queryResolver) ResolvePublicFileLink(ctx context.Context, token string)
 
 	// Track the download for public links (assuming resolution indicates download intent)
 	if r.FileDownloadService != nil {
-		// Try to get user ID from context (might be nil for anonymous access)
-		var downloadedBy *uuid.UUID
-		if userIDStr, ok := middleware.GetUserIDFromContext(ctx); ok {
-			if userID, err := uuid.Parse(userIDStr); err == nil {
-				downloadedBy = &userID
-			}
-		}
-
-		// Record the download tracking (fire and forget, don't fail if tracking fails)
+		// Record the download tracking (fire and forget, don't fail if tracking fails).
+		// The detached context keeps the caller's identity so logged-in downloads are attributed.
+		trackCtx := context.WithoutCancel(ctx)
 		go func() {
-			err := r.FileDownloadService.DownloadRepo.RecordDownload(context.Background(), f.ID, owner.ID, downloadedBy, "public", token, "", "")
+			err := r.FileDownloadService.RecordPublicLinkDownload(trackCtx, f.ID, token)
 			if err != nil {
 				fmt.Printf("WARNING: Failed to record public download tracking: %v\n", err)
 			}
@@ -1882,12 +3165,24 @@ func (r *queryResolver) ResolvePublicFileLink(ctx context.Context, token string)
 	}, nil
 }
 
+// InspectPublicFileLink is the resolver for the inspectPublicFileLink field.
+func (r *queryResolver) InspectPublicFileLink(ctx context.Context, token string) (*model.PublicFileLinkInspection, error) {
+	if r.PublicLinkService == nil {
+		return nil, fmt.Errorf("public link service not configured")
+	}
+	info, err := r.PublicLinkService.InspectFileLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return toModelFileLinkInspection(info), nil
+}
+
 // ResolvePublicFolderLink is the resolver for the resolvePublicFolderLink field.
-func (r *queryResolver) ResolvePublicFolderLink(ctx context.Context, token string) (*model.PublicFolderLinkResolved, error) {
+func (r *queryResolver) ResolvePublicFolderLink(ctx context.Context, token string, password *string) (*model.PublicFolderLinkResolved, error) {
 	if r.PublicLinkService == nil {
 		return nil, fmt.Errorf("public link service not configured")
 	}
-	fo, owner, expiresAt, revoked, err := r.PublicLinkService.ResolveFolderLink(ctx, token)
+	fo, owner, expiresAt, revoked, err := r.PublicLinkService.ResolveFolderLink(ctx, token, stringValue(password))
 	if err != nil {
 		return nil, err
 	}
@@ -1919,7 +3214,7 @@ func (r *queryResolver) ResolvePublicFolderLink(ctx context.Context, token strin
 }
 
 // PublicFolderFiles is the resolver for the publicFolderFiles field.
-func (r *queryResolver) PublicFolderFiles(ctx context.Context, token string) ([]*model.UserFile, error) {
+func (r *queryResolver) PublicFolderFiles(ctx context.Context, token string, password *string) ([]*model.UserFile, error) {
 	if r.PublicLinkService == nil {
 		return nil, fmt.Errorf("public link service not configured")
 	}
@@ -1928,7 +3223,7 @@ func (r *queryResolver) PublicFolderFiles(ctx context.Context, token string) ([]
 	}
 
 	// First resolve the public folder link to get the folder
-	folder, _, _, revoked, err := r.PublicLinkService.ResolveFolderLink(ctx, token)
+	folder, _, _, revoked, err := r.PublicLinkService.ResolveFolderLink(ctx, token, stringValue(password))
 	if err != nil {
 		return nil, err
 	}
@@ -1972,13 +3267,13 @@ func (r *queryResolver) PublicFolderFiles(ctx context.Context, token string) ([]
 }
 
 // PublicFolderSubfolders is the resolver for the publicFolderSubfolders field.
-func (r *queryResolver) PublicFolderSubfolders(ctx context.Context, token string) ([]*model.Folder, error) {
+func (r *queryResolver) PublicFolderSubfolders(ctx context.Context, token string, password *string) ([]*model.Folder, error) {
 	if r.PublicLinkService == nil {
 		return nil, fmt.Errorf("public link service not configured")
 	}
 
 	// First resolve the public folder link to get the folder
-	folder, _, _, revoked, err := r.PublicLinkService.ResolveFolderLink(ctx, token)
+	folder, _, _, revoked, err := r.PublicLinkService.ResolveFolderLink(ctx, token, stringValue(password))
 	if err != nil {
 		return nil, err
 	}
@@ -2011,6 +3306,86 @@ func (r *queryResolver) PublicFolderSubfolders(ctx context.Context, token string
 	return result, nil
 }
 
+// BrowsePublicFolder is the resolver for the browsePublicFolder field.
+func (r *queryResolver) BrowsePublicFolder(ctx context.Context, token string, recursive *bool, password *string) (*model.PublicFolderListing, error) {
+	if r.PublicLinkService == nil {
+		return nil, fmt.Errorf("public link service not configured")
+	}
+	rec := false
+	if recursive != nil {
+		rec = *recursive
+	}
+	listing, err := r.PublicLinkService.BrowsePublicFolder(ctx, token, stringValue(password), rec)
+	if err != nil {
+		return nil, err
+	}
+
+	subfolders := make([]*model.Folder, 0, len(listing.Subfolders))
+	for _, sub := range listing.Subfolders {
+		subfolders = append(subfolders, toModelFolder(sub))
+	}
+	files := make([]*model.UserFile, 0, len(listing.Files))
+	for _, file := range listing.Files {
+		files = append(files, toModelUserFile(file))
+	}
+
+	owner := listing.Owner
+	return &model.PublicFolderListing{
+		Token:      token,
+		Folder:     toModelFolder(*listing.Folder),
+		Owner:      &model.User{ID: owner.ID.String(), Email: owner.Email, CreatedAt: owner.CreatedAt.Format(time.RFC3339), UpdatedAt: owner.CreatedAt.Format(time.RFC3339)},
+		ExpiresAt:  formatOptionalTime(listing.ExpiresAt),
+		Subfolders: subfolders,
+		Files:      files,
+	}, nil
+}
+
+// PublicFolderFileURL is the resolver for the publicFolderFileURL field.
+func (r *queryResolver) PublicFolderFileURL(ctx context.Context, token string, fileID string, inline *bool, password *string) (string, error) {
+	if r.PublicLinkService == nil {
+		return "", fmt.Errorf("public link service not configured")
+	}
+	if r.FileService == nil {
+		return "", services.ErrStorageUnavailable
+	}
+	fid, err := uuid.Parse(fileID)
+	if err != nil {
+		return "", fmt.Errorf("invalid file id")
+	}
+	in := false
+	if inline != nil {
+		in = *inline
+	}
+
+	_, _, err = r.PublicLinkService.ResolvePublicFolderFile(ctx, token, stringValue(password), fid)
+	if err != nil {
+		return "", err
+	}
+	// Folder listings don't carry the storage path, so load the full file record
+	file, err := r.FileService.FileRepo.GetByID(ctx, fid)
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", fmt.Errorf("file not found")
+	}
+	fileURL, err := r.FileService.PresignFileURL(ctx, file, in)
+	if err != nil {
+		return "", err
+	}
+
+	if r.FileDownloadService != nil && r.FileDownloadService.DownloadRepo != nil {
+		// Record the download tracking (fire and forget, don't fail if tracking fails)
+		trackCtx := context.WithoutCancel(ctx)
+		go func() {
+			if err := r.FileDownloadService.RecordPublicLinkDownload(trackCtx, fid, token); err != nil {
+				fmt.Printf("WARNING: Failed to record public folder download tracking: %v\n", err)
+			}
+		}()
+	}
+	return fileURL, nil
+}
+
 // AdminAllUsers is the resolver for the adminAllUsers field.
 // AdminAllUsers is the resolver for the adminAllUsers field.
 func (r *queryResolver) AdminAllUsers(ctx context.Context) ([]*model.AdminUserInfo, error) {
@@ -2145,6 +3520,31 @@ func (r *queryResolver) AdminUserFolders(ctx context.Context, userID string) ([]
 	return result, nil
 }
 
+// AdminUserDetail is the resolver for the adminUserDetail field.
+func (r *queryResolver) AdminUserDetail(ctx context.Context, userID string) (*model.AdminUserDetail, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+	if r.AdminService == nil {
+		return nil, fmt.Errorf("admin service not configured")
+	}
+	detail, err := r.AdminService.GetUserDetail(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	files := map[uuid.UUID]*models.File{}
+	for _, a := range detail.RecentActivity {
+		if f, err := r.AdminService.FileRepo.GetByID(ctx, a.FileID); err == nil {
+			files[a.FileID] = f
+		}
+	}
+	return toModelAdminUserDetail(detail, files), nil
+}
+
 // AdminFileDownloadStats is the resolver for the adminFileDownloadStats field.
 func (r *queryResolver) AdminFileDownloadStats(ctx context.Context) ([]*model.FileDownloadStats, error) {
 	// Check if user is admin
@@ -2197,6 +3597,108 @@ func (r *queryResolver) AdminFileDownloadStats(ctx context.Context) ([]*model.Fi
 	return result, nil
 }
 
+// SystemStatus is the resolver for the systemStatus field.
+func (r *queryResolver) SystemStatus(ctx context.Context) (*model.SystemStatus, error) {
+	// Check if user is admin
+	isAdmin := middleware.GetIsAdminFromContext(ctx)
+	if !isAdmin {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	if r.StatusService == nil {
+		return nil, fmt.Errorf("status service not configured")
+	}
+
+	status := r.StatusService.Check(ctx)
+	result := &model.SystemStatus{
+		Healthy:           status.Healthy,
+		Degraded:          status.Degraded,
+		CheckedAt:         status.CheckedAt.Format(time.RFC3339),
+		Dependencies:      []*model.DependencyStatus{},
+		PendingMigrations: status.PendingMigrations,
+		Jobs:              []*model.BackgroundJobStatus{},
+	}
+	if result.PendingMigrations == nil {
+		result.PendingMigrations = []string{}
+	}
+	for _, d := range status.Dependencies {
+		var errPtr *string
+		if d.Error != "" {
+			e := d.Error
+			errPtr = &e
+		}
+		result.Dependencies = append(result.Dependencies, &model.DependencyStatus{
+			Name:      d.Name,
+			Up:        d.Up,
+			LatencyMs: float64(d.Latency.Microseconds()) / 1000,
+			Error:     errPtr,
+			Optional:  d.Optional,
+		})
+	}
+	for _, j := range status.Jobs {
+		var errPtr *string
+		if j.LastError != "" {
+			e := j.LastError
+			errPtr = &e
+		}
+		result.Jobs = append(result.Jobs, &model.BackgroundJobStatus{
+			Name:      j.Name,
+			LastRunAt: j.LastRunAt.Format(time.RFC3339),
+			LastError: errPtr,
+		})
+	}
+	return result, nil
+}
+
+// AdminQuarantinedFiles is the resolver for the adminQuarantinedFiles field.
+func (r *queryResolver) AdminQuarantinedFiles(ctx context.Context) ([]*model.UserFile, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	files, err := r.FileService.ListQuarantinedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*model.UserFile, 0, len(files))
+	for _, uf := range files {
+		out = append(out, toModelQuarantinedFile(uf))
+	}
+	return out, nil
+}
+
+// AdminUploadFailures is the resolver for the adminUploadFailures field.
+func (r *queryResolver) AdminUploadFailures(ctx context.Context, userID *string, limit *int) ([]*model.UploadFailureLog, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, fmt.Errorf("unauthorized: admin access required")
+	}
+	var uid *uuid.UUID
+	if userID != nil {
+		parsed, err := uuid.Parse(*userID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id")
+		}
+		uid = &parsed
+	}
+	if r.FileService == nil {
+		return nil, services.ErrStorageUnavailable
+	}
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	failures, err := r.FileService.ListUploadFailures(ctx, uid, n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*model.UploadFailureLog, 0, len(failures))
+	for _, f := range failures {
+		out = append(out, toModelUploadFailure(f))
+	}
+	return out, nil
+}
+
 // MyFileDownloads is the resolver for the myFileDownloads field.
 func (r *queryResolver) MyFileDownloads(ctx context.Context, fileID string) ([]*model.FileDownload, error) {
 	// Get user ID from context
@@ -2392,7 +3894,7 @@ func (r *queryResolver) MyRecentFileActivities(ctx context.Context, limit *int)
 	var gqlActivities []*model.RecentFileActivity
 	for _, activity := range activities {
 		// Get file data
-		file, err := r.FileService.FileRepo.GetByID(ctx, activity.FileID)
+		file, err := r.FileActivityService.FileRepo.GetByID(ctx, activity.FileID)
 		if err != nil {
 			continue // skip files that can't be found
 		}
@@ -2552,6 +4054,55 @@ func (r *queryResolver) MyStarredItems(ctx context.Context) ([]*model.StarredIte
 	return result, nil
 }
 
+// MyDashboard is the resolver for the myDashboard field.
+func (r *queryResolver) MyDashboard(ctx context.Context, recentFiles *int, recentActivity *int, starred *int) (*model.Dashboard, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	var limits services.DashboardLimits
+	if recentFiles != nil {
+		limits.RecentFiles = *recentFiles
+	}
+	if recentActivity != nil {
+		limits.RecentActivity = *recentActivity
+	}
+	if starred != nil {
+		limits.Starred = *starred
+	}
+	dashboard, err := r.DashboardService.GetDashboard(ctx, userID, limits)
+	if err != nil {
+		return nil, err
+	}
+	return toModelDashboard(dashboard), nil
+}
+
+// MyAPITokens is the resolver for the myAPITokens field.
+func (r *queryResolver) MyAPITokens(ctx context.Context) ([]*model.APIToken, error) {
+	userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+
+	tokens, err := r.AuthService.ListAPITokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.APIToken, 0, len(tokens))
+	for _, t := range tokens {
+		result = append(result, toModelAPIToken(t))
+	}
+	return result, nil
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/services"
+)
+
+// Without MinIO the file service is nil; every file operation should fail with the same
+// clear error instead of panicking.
+func TestFileOperations_StorageUnavailable(t *testing.T) {
+	c := newTestClient()
+	user := asUser(uuid.NewString(), true)
+	id := uuid.NewString()
+
+	for _, op := range []string{
+		`{ myFiles { id } }`,
+		`{ myDeletedFiles { id } }`,
+		`{ myStorage { usedBytes } }`,
+		`{ myDashboard { trashBytes } }`,
+		`{ findMyFileByHash(hash: "abc") { id } }`,
+		`{ fileURL(fileId: "` + id + `") }`,
+		`{ fileTextPreview(fileId: "` + id + `") { content } }`,
+		`{ fileChecksum(fileId: "` + id + `") { sha256 } }`,
+		`{ searchMyFiles(filter: {}) { totalCount } }`,
+		`{ adminQuarantinedFiles { id } }`,
+		`{ adminUploadFailures { id } }`,
+		`mutation { deleteFile(fileId: "` + id + `") }`,
+		`mutation { recoverFile(fileId: "` + id + `") }`,
+		`mutation { purgeFile(fileId: "` + id + `") }`,
+		`mutation { restoreAllTrash { restored } }`,
+		`mutation { setFileVisibility(fileId: "` + id + `", visibility: "public") { id } }`,
+		`mutation { setFileRetention(mappingId: "` + id + `", retainUntil: "2030-01-01T00:00:00Z") }`,
+		`mutation { checkUploadQuota(files: [{size: 1, hash: "abc"}]) { fitCount } }`,
+		`mutation { groupFilesIntoNewFolder(mappingIds: ["` + id + `"], name: "x") { folder { id } } }`,
+	} {
+		var resp map[string]interface{}
+		err := c.Post(op, &resp, user)
+		if err == nil || !strings.Contains(err.Error(), services.ErrStorageUnavailable.Error()) {
+			t.Fatalf("%s: expected %q, got %v", op, services.ErrStorageUnavailable, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/useradityaa/graph/model"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/services"
+)
+
+// uploadInput runs an upload mutation's input through the file service for userID; it is
+// shared by uploadFiles and uploadFilesWithResults.
+func (r *mutationResolver) uploadInput(ctx context.Context, userID uuid.UUID, input model.UploadFileInput, bestEffort bool) ([]models.UserFile, []services.UploadFailure, error) {
+	// Convert GraphQL uploads to the type FileService expects
+	var uploads []*graphql.Upload
+	for _, up := range input.Files {
+		if up == nil || up.File == nil {
+			return nil, nil, fmt.Errorf("invalid file input")
+		}
+		uploads = append(uploads, up)
+	}
+
+	if r.FileService == nil {
+		return nil, nil, services.ErrStorageUnavailable
+	}
+
+	// Pass allowDuplicate down via context for now (small change without altering service signature)
+	if input.AllowDuplicate != nil && *input.AllowDuplicate {
+		ctx = context.WithValue(ctx, struct{ key string }{"allowDuplicate"}, true)
+	}
+	visibility, err := parseUploadVisibility(input.Visibility)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, err := toUploadOrder(input.Order, input.Priority)
+	if err != nil {
+		return nil, nil, err
+	}
+	onConflict := toNameConflict(input.OnNameConflict)
+	if input.FolderID != nil {
+		folderID, err := uuid.Parse(*input.FolderID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid folder ID")
+		}
+		return r.FileService.UploadFilesToFolder(ctx, userID, &folderID, uploads, visibility, bestEffort, order, onConflict)
+	}
+	return r.FileService.UploadFilesOrdered(ctx, userID, uploads, visibility, bestEffort, order, onConflict)
+}
@@ -6,69 +6,122 @@ package auth
 import (
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// jwtSecret is the secret key used for signing JWT tokens.
-// It reads from JWT_SECRET environment variable. This variable must be set.
-var jwtSecret = getJWTSecret()
+// errNoSecret is returned when a token is signed or verified without a secret.
+var errNoSecret = errors.New("jwt secret not configured")
 
-// getJWTSecret retrieves the JWT secret from environment variables.
-// JWT_SECRET environment variable must be set to a secure random string.
-// The application will panic if this environment variable is not provided.
-func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		panic("JWT_SECRET environment variable must be set")
-	}
-	return []byte(secret)
+// KeySet holds the HMAC keys session tokens are signed and verified with.
+// New tokens are signed with the ActiveKID key and carry it in their "kid" header;
+// tokens are verified with the key named by their kid, so keys that are no longer
+// active keep validating outstanding tokens until they are removed from Keys.
+// The empty ID names the key for tokens issued without a kid.
+type KeySet struct {
+	// ActiveKID selects the key new tokens are signed with
+	ActiveKID string
+	// Keys maps key IDs to secrets
+	Keys map[string][]byte
+	// Issuer and Audience, when set, are written to the "iss" and "aud" claims of new
+	// tokens and required on verified ones, so tokens can't be replayed against
+	// another service that shares a secret
+	Issuer   string
+	Audience string
+}
+
+// NewKeySet returns a KeySet with a single key used for tokens without a kid.
+func NewKeySet(secret []byte) *KeySet {
+	return &KeySet{Keys: map[string][]byte{"": secret}}
+}
+
+// key returns the secret registered under kid.
+func (k *KeySet) key(kid string) ([]byte, error) {
+	if k == nil || len(k.Keys) == 0 {
+		return nil, errNoSecret
+	}
+	secret, ok := k.Keys[kid]
+	if !ok || len(secret) == 0 {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return secret, nil
 }
 
 // GenerateJWT creates a new JWT token for a user with specified admin privileges.
-// The token includes the user ID, admin status, and expires in 72 hours.
+// The token includes the user ID, admin status, the key set's issuer and audience
+// when configured, and expires in 72 hours.
 //
 // Parameters:
+//   - keys: The key set; the token is signed with its active key
 //   - userID: Unique identifier for the user
 //   - isAdmin: Whether the user has administrative privileges
 //
 // Returns:
 //   - string: The signed JWT token
 //   - error: nil on success, or an error if token generation fails
-func GenerateJWT(userID string, isAdmin bool) (string, error) {
+func GenerateJWT(keys *KeySet, userID string, isAdmin bool) (string, error) {
+	if keys == nil {
+		return "", errNoSecret
+	}
+	secret, err := keys.key(keys.ActiveKID)
+	if err != nil {
+		return "", err
+	}
 	claims := jwt.MapClaims{
 		"userId":  userID,
 		"isAdmin": isAdmin,
 		"exp":     time.Now().Add(time.Hour * 72).Unix(),
 	}
+	if keys.Issuer != "" {
+		claims["iss"] = keys.Issuer
+	}
+	if keys.Audience != "" {
+		claims["aud"] = keys.Audience
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if keys.ActiveKID != "" {
+		token.Header["kid"] = keys.ActiveKID
+	}
+	return token.SignedString(secret)
 }
 
 // VerifyJWT validates a JWT token and extracts user information from it.
-// It checks the token signature, expiration time, and required claims.
+// It checks the token signature, expiration time, and required claims, including the
+// issuer and audience when the key set configures them.
+// The verification key is chosen by the token's "kid" header.
 //
 // Parameters:
+//   - keys: The key set holding the current and previously active keys
 //   - tokenString: The JWT token string to validate
 //
 // Returns:
 //   - string: The user ID extracted from the token
 //   - bool: Whether the user has admin privileges
 //   - error: nil if token is valid, or an error describing validation failure
-func VerifyJWT(tokenString string) (string, bool, error) {
+func VerifyJWT(keys *KeySet, tokenString string) (string, bool, error) {
+	if keys == nil || len(keys.Keys) == 0 {
+		return "", false, errNoSecret
+	}
 	if tokenString == "" {
 		return "", false, errors.New("empty token")
 	}
 
+	var opts []jwt.ParserOption
+	if keys.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(keys.Issuer))
+	}
+	if keys.Audience != "" {
+		opts = append(opts, jwt.WithAudience(keys.Audience))
+	}
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return jwtSecret, nil
-	})
+		kid, _ := t.Header["kid"].(string)
+		return keys.key(kid)
+	}, opts...)
 	if err != nil {
 		return "", false, err
 	}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	newSecret  = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestJWT_RoundTrip(t *testing.T) {
+	keys := NewKeySet(testSecret)
+	token, err := GenerateJWT(keys, "user-1", true)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	userID, isAdmin, err := VerifyJWT(keys, token)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if userID != "user-1" || !isAdmin {
+		t.Fatalf("unexpected claims: %q admin=%v", userID, isAdmin)
+	}
+}
+
+func TestJWT_WrongSecret(t *testing.T) {
+	token, err := GenerateJWT(NewKeySet(testSecret), "user-1", false)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, _, err := VerifyJWT(NewKeySet(newSecret), token); err == nil {
+		t.Fatalf("expected token signed with another secret to be rejected")
+	}
+}
+
+func TestJWT_Expired(t *testing.T) {
+	claims := jwt.MapClaims{"userId": "user-1", "exp": time.Now().Add(-time.Minute).Unix()}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, _, err := VerifyJWT(NewKeySet(testSecret), token); err == nil {
+		t.Fatalf("expected expired token to be rejected")
+	}
+}
+
+func TestJWT_NoSecret(t *testing.T) {
+	if _, err := GenerateJWT(nil, "user-1", false); err == nil {
+		t.Fatalf("expected signing without a secret to fail")
+	}
+	if _, _, err := VerifyJWT(&KeySet{}, "token"); err == nil {
+		t.Fatalf("expected verifying without a secret to fail")
+	}
+}
+
+func TestJWT_KeyRotation(t *testing.T) {
+	before := &KeySet{ActiveKID: "k1", Keys: map[string][]byte{"k1": testSecret}}
+	oldToken, err := GenerateJWT(before, "user-1", false)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	legacyToken, err := GenerateJWT(NewKeySet(testSecret), "user-2", false)
+	if err != nil {
+		t.Fatalf("generate legacy: %v", err)
+	}
+
+	// overlap: k2 signs, k1 and the kid-less legacy key still verify
+	during := &KeySet{ActiveKID: "k2", Keys: map[string][]byte{"": testSecret, "k1": testSecret, "k2": newSecret}}
+	if userID, _, err := VerifyJWT(during, oldToken); err != nil || userID != "user-1" {
+		t.Fatalf("expected old-key token to validate during overlap, got %q (%v)", userID, err)
+	}
+	if userID, _, err := VerifyJWT(during, legacyToken); err != nil || userID != "user-2" {
+		t.Fatalf("expected token without kid to validate during overlap, got %q (%v)", userID, err)
+	}
+	newToken, err := GenerateJWT(during, "user-3", false)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != "k2" {
+		t.Fatalf("expected new token to carry kid k2, got %v (%v)", parsed.Header["kid"], err)
+	}
+
+	// after the overlap the retired key is dropped
+	after := &KeySet{ActiveKID: "k2", Keys: map[string][]byte{"k2": newSecret}}
+	if _, _, err := VerifyJWT(after, oldToken); err == nil {
+		t.Fatalf("expected token for retired key to be rejected")
+	}
+	if _, _, err := VerifyJWT(after, newToken); err != nil {
+		t.Fatalf("expected current token to validate, got %v", err)
+	}
+}
+
+func TestJWT_IssuerAudience(t *testing.T) {
+	keys := &KeySet{Keys: map[string][]byte{"": testSecret}, Issuer: "safevault", Audience: "safevault-api"}
+	token, err := GenerateJWT(keys, "user-1", false)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if userID, _, err := VerifyJWT(keys, token); err != nil || userID != "user-1" {
+		t.Fatalf("expected matching issuer and audience to validate, got %q (%v)", userID, err)
+	}
+
+	otherIssuer := &KeySet{Keys: keys.Keys, Issuer: "other", Audience: "safevault-api"}
+	if _, _, err := VerifyJWT(otherIssuer, token); err == nil {
+		t.Fatalf("expected token from another issuer to be rejected")
+	}
+	otherAudience := &KeySet{Keys: keys.Keys, Issuer: "safevault", Audience: "other-api"}
+	if _, _, err := VerifyJWT(otherAudience, token); err == nil {
+		t.Fatalf("expected token for another audience to be rejected")
+	}
+
+	// A token without the claims, e.g. from a service sharing the secret, is rejected too
+	bare, err := GenerateJWT(NewKeySet(testSecret), "user-1", false)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, _, err := VerifyJWT(keys, bare); err == nil {
+		t.Fatalf("expected token without issuer and audience to be rejected")
+	}
+	// Unconfigured key sets don't check the claims
+	if _, _, err := VerifyJWT(NewKeySet(testSecret), token); err != nil {
+		t.Fatalf("expected claims to be ignored when not configured, got %v", err)
+	}
+}
@@ -6,26 +6,128 @@ package config
 import (
 	"context"
 	"log"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DBTimeouts are server-side limits set on every pooled connection, so Postgres itself
+// kills runaway queries and releases what they hold. Zero leaves a limit off.
+type DBTimeouts struct {
+	// Statement aborts any statement running longer (statement_timeout)
+	Statement time.Duration
+	// IdleInTransaction ends sessions left idle inside an open transaction, releasing
+	// their locks (idle_in_transaction_session_timeout)
+	IdleInTransaction time.Duration
+}
+
+// apply sets the timeouts as startup parameters of cc, in milliseconds.
+func (t DBTimeouts) apply(cc *pgx.ConnConfig) {
+	set := func(name string, d time.Duration) {
+		if d > 0 {
+			// Postgres reads 0 as "no limit", so a sub-millisecond value rounds up
+			cc.RuntimeParams[name] = strconv.FormatInt(max(d.Milliseconds(), 1), 10)
+		}
+	}
+	set("statement_timeout", t.Statement)
+	set("idle_in_transaction_session_timeout", t.IdleInTransaction)
+}
+
 // InitDB initializes a PostgreSQL connection pool using the provided DSN.
 // It creates a new connection pool with default settings and tests the connection.
 // The function will terminate the application if connection establishment fails.
 //
 // Parameters:
 //   - dsn: PostgreSQL Data Source Name (connection string)
+//   - tracer: Optional tracer installed on every connection, e.g. the query budget (may be nil)
+//   - timeouts: Statement and idle-in-transaction limits set on every connection
 //
 // Returns:
 //   - *pgxpool.Pool: Configured PostgreSQL connection pool ready for use
-func InitDB(dsn string) *pgxpool.Pool {
+func InitDB(dsn string, tracer pgx.QueryTracer, timeouts DBTimeouts) *pgxpool.Pool {
 	if dsn == "" {
 		log.Fatal("database DSN is empty; set DATABASE_URL_PROD or configuration value")
 	}
-	dbpool, err := pgxpool.New(context.Background(), dsn)
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		log.Fatalf("Unable to parse database DSN: %v\n", err)
+	}
+	poolConfig.ConnConfig.Tracer = tracer
+	timeouts.apply(poolConfig.ConnConfig)
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v\n", err)
+	}
+	return dbpool
+}
+
+// InitLockDB opens the pool whose sessions hold file locks (see repository.FileLocker).
+// It is kept apart from the main pool because a lock holder keeps its session for the whole
+// locked operation while running that operation's queries on the main pool. No statement
+// timeout is set: waiting for a lock that a long operation holds is expected.
+// The function will terminate the application if the DSN can't be parsed.
+//
+// Parameters:
+//   - dsn: PostgreSQL Data Source Name (connection string)
+//   - maxConns: Most locks held or waited for at once; further callers queue for a session
+//
+// Returns:
+//   - *pgxpool.Pool: Connection pool for lock sessions
+func InitLockDB(dsn string, maxConns int32) *pgxpool.Pool {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		log.Fatalf("Unable to parse database DSN: %v\n", err)
+	}
+	poolConfig.MaxConns = maxConns
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v\n", err)
 	}
 	return dbpool
 }
+
+// InitReplicaDB opens the optional read-replica pool used for heavy read queries.
+// Unlike InitDB it never terminates the application: an empty DSN, or a replica that
+// doesn't answer a ping at startup, returns nil so callers use the primary pool instead.
+// A replica that goes down later is not replaced; queries routed to it fail until it
+// recovers, and the status checks report it as degraded.
+//
+// Parameters:
+//   - dsn: PostgreSQL Data Source Name for the replica (may be empty)
+//   - timeouts: Statement and idle-in-transaction limits set on every connection
+//
+// Returns:
+//   - *pgxpool.Pool: Replica connection pool, or nil when not configured or unreachable
+func InitReplicaDB(dsn string, timeouts DBTimeouts) *pgxpool.Pool {
+	if dsn == "" {
+		return nil
+	}
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		log.Printf("warning: unable to parse read replica DSN, using primary: %v", err)
+		return nil
+	}
+	timeouts.apply(poolConfig.ConnConfig)
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		log.Printf("warning: unable to connect to read replica, using primary: %v", err)
+		return nil
+	}
+	// The pool connects lazily, so only a ping tells whether the replica is there
+	ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+	defer cancel()
+	if err := dbpool.Ping(ctx); err != nil {
+		dbpool.Close()
+		log.Printf("warning: read replica unreachable, using primary: %v", err)
+		return nil
+	}
+	return dbpool
+}
+
+// DefaultLockSessions is how many file locks may be held or waited for at once
+const DefaultLockSessions = 16
+
+// replicaPingTimeout bounds the startup check of the read replica
+const replicaPingTimeout = 5 * time.Second
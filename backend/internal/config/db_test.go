@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestDBTimeouts_Apply(t *testing.T) {
+	cc, err := pgx.ParseConfig("postgres://app@localhost:5432/vault")
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	DBTimeouts{Statement: 30 * time.Second, IdleInTransaction: 500 * time.Microsecond}.apply(cc)
+	if got := cc.RuntimeParams["statement_timeout"]; got != "30000" {
+		t.Fatalf("expected statement_timeout 30000ms, got %q", got)
+	}
+	// Rounded up, since 0 would turn the limit off
+	if got := cc.RuntimeParams["idle_in_transaction_session_timeout"]; got != "1" {
+		t.Fatalf("expected idle_in_transaction_session_timeout 1ms, got %q", got)
+	}
+
+	cc, _ = pgx.ParseConfig("postgres://app@localhost:5432/vault")
+	DBTimeouts{}.apply(cc)
+	if _, ok := cc.RuntimeParams["statement_timeout"]; ok {
+		t.Fatalf("expected no statement_timeout when unset")
+	}
+}
+
+// TestInitDB_StatementTimeout runs against a real database named by TEST_DATABASE_URL.
+func TestInitDB_StatementTimeout(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db := InitDB(dsn, nil, DBTimeouts{Statement: 100 * time.Millisecond})
+	defer db.Close()
+
+	start := time.Now()
+	_, err := db.Exec(context.Background(), `SELECT pg_sleep(5)`)
+	var pgErr *pgconn.PgError
+	// 57014 is query_canceled, which statement_timeout raises
+	if !errors.As(err, &pgErr) || pgErr.Code != "57014" {
+		t.Fatalf("expected the slow query to be cancelled by statement_timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the query aborted near the timeout, took %v", elapsed)
+	}
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +18,21 @@ import (
 type Config struct {
 	Port        string
 	DatabaseURL string
+	// DatabaseReplicaURL optionally points at a read replica for admin/analytic queries
+	DatabaseReplicaURL string
+	// DBQueryBudget logs requests running more than this many queries, to catch N+1
+	// patterns in development and testing (0 disables counting)
+	DBQueryBudget int
+	// DBQueryBudgetEnforce fails requests over DBQueryBudget instead of only logging them
+	DBQueryBudgetEnforce bool
+	// DBStatementTimeout makes Postgres abort statements running longer (0 = no limit)
+	DBStatementTimeout time.Duration
+	// DBIdleInTransactionTimeout ends sessions idle inside a transaction for longer (0 = no limit)
+	DBIdleInTransactionTimeout time.Duration
+	// ResponseCompression gzip/deflate-compresses GraphQL responses for clients accepting it
+	ResponseCompression bool
+	// CompressionMinBytes is the smallest response body worth compressing
+	CompressionMinBytes int
 
 	MinioEndpoint  string
 	MinioAccessKey string
@@ -21,9 +40,101 @@ type Config struct {
 	MinioUseSSL    bool
 	MinioBucket    string
 	MinioPublicURL string
+	// MinioPublicURLs maps request hosts to their own public endpoint; see PublicEndpointsByHost
+	MinioPublicURLs string
 
 	GoogleClientID string
 	AdminEmail     string
+	// JWTSecret signs and verifies session tokens without a key ID; see JWTSigningKeys
+	JWTSecret string
+	// JWTKeyID names the active signing key in JWTKeys, for key rotation
+	JWTKeyID string
+	// JWTKeys lists signing keys as comma-separated "id:secret" pairs
+	JWTKeys string
+	// JWTIssuer and JWTAudience are set as the "iss" and "aud" claims of session tokens
+	// and required when verifying them (empty leaves the claim out and unchecked)
+	JWTIssuer   string
+	JWTAudience string
+	// GoogleAllowedDomain limits Google sign-in to one hosted domain (empty allows any)
+	GoogleAllowedDomain string
+
+	// TransferRemovesPreviousOwner deletes the previous owner's copies of a file whose
+	// ownership is transferred instead of keeping them as editor copies
+	TransferRemovesPreviousOwner bool
+
+	// MaxShareLifetime and MaxPublicLinkLifetime cap how far in the future an
+	// expiry may be set. Zero means no cap.
+	MaxShareLifetime      time.Duration
+	MaxPublicLinkLifetime time.Duration
+	// MaxPublicLinksPerUser caps each user's active public links (0 = no cap)
+	MaxPublicLinksPerUser int
+
+	// MaxFilesPerUpload limits how many files a single upload request may carry
+	MaxFilesPerUpload int
+	// UploadConcurrency bounds how many files of one upload request are processed in parallel
+	UploadConcurrency int
+	// StorageLayout names the object key scheme for new uploads ("flat" or "sharded")
+	StorageLayout string
+	// DefaultVisibility is the visibility of uploads that don't choose one ("private", "shared" or "public")
+	DefaultVisibility string
+	// DownloadFilenameTemplate names downloaded files, e.g. "{folder} - {original}"
+	DownloadFilenameTemplate string
+	// DeleteMode is what deleting a file does: "trash" (recoverable) or "immediate" (permanent)
+	DeleteMode string
+	// DefaultQuotaBytes is the storage quota of users without an override in user_quotas
+	DefaultQuotaBytes int64
+	// MaxUploadFileMB rejects uploaded files over this many megabytes (0 means no limit)
+	MaxUploadFileMB int
+	// BlockedMimeTypes lists MIME types uploads may not have, comma-separated ("type/*" allowed)
+	BlockedMimeTypes string
+	// AllowEmptyFiles accepts zero-byte uploads; when false they are rejected
+	AllowEmptyFiles bool
+	// QuarantineFlaggedUploads stores content flagged by the scanner as quarantined instead of rejecting it
+	QuarantineFlaggedUploads bool
+	// ClamAVAddr is the clamd host:port uploads are scanned with (empty disables scanning)
+	ClamAVAddr string
+	// ScanTimeout bounds the scan of one uploaded file; slower scans reject the file
+	ScanTimeout time.Duration
+	// TempUploadDir holds uploads while they are hashed and checked (empty uses the system temp directory)
+	TempUploadDir string
+	// TempUploadMaxMB caps the megabytes of uploads held in TempUploadDir at once (0 means no cap)
+	TempUploadMaxMB int
+	// UsageSnapshotInterval is how often per-user usage snapshots are written
+	UsageSnapshotInterval time.Duration
+	// UploadSessionTTL is how long a resumable upload session stays open
+	UploadSessionTTL time.Duration
+	// UploadSessionSweepInterval is how often expired upload sessions are cleaned up (0 disables it)
+	UploadSessionSweepInterval time.Duration
+
+	// CDNBaseURL serves downloads from a CDN in front of the bucket (empty serves presigned MinIO URLs)
+	CDNBaseURL string
+	// CDNSigningKey signs CDN download URLs; the edge verifies them with the same key
+	CDNSigningKey string
+	// CDNURLTTL is how long a signed CDN URL stays valid
+	CDNURLTTL time.Duration
+	// CDNPurgeURL receives cache purge requests when content is deleted or quarantined (optional)
+	CDNPurgeURL string
+	// CDNPurgeToken is sent as a bearer token with purge requests (optional)
+	CDNPurgeToken string
+
+	// EncryptionKeys lists the master keys content is encrypted at rest with, as
+	// comma-separated "<id>:<base64 32-byte key>" pairs (empty stores content unencrypted)
+	EncryptionKeys string
+	// EncryptionKeyID names the key new content is encrypted with (optional with one key)
+	EncryptionKeyID string
+	// DownloadBaseURL is this server's public URL, used in download links of encrypted files
+	DownloadBaseURL string
+
+	// SMTPAddr is the host:port of the mail server share notifications are sent through
+	// (empty sends none)
+	SMTPAddr string
+	// SMTPUsername and SMTPPassword authenticate with the mail server (optional)
+	SMTPUsername string
+	SMTPPassword string
+	// SMTPFrom is the sender address of notification emails
+	SMTPFrom string
+	// AppURL is the web app's public URL, linked from notification emails (optional)
+	AppURL string
 }
 
 var (
@@ -40,21 +151,185 @@ func Load() *Config {
 		}
 
 		cfg = &Config{
-			Port:           getEnv("PORT", "8080"),
-			DatabaseURL:    getEnv("DATABASE_URL_PROD", ""),
-			MinioEndpoint:  getEnv("MINIO_ENDPOINT", ""),
-			MinioAccessKey: getEnv("MINIO_ACCESS_KEY", ""),
-			MinioSecretKey: getEnv("MINIO_SECRET_KEY", ""),
-			MinioUseSSL:    getEnvBool("MINIO_USE_SSL", false),
-			MinioBucket:    getEnv("MINIO_BUCKET", ""),
-			MinioPublicURL: getEnv("MINIO_PUBLIC_ENDPOINT", ""),
-			GoogleClientID: getEnv("GOOGLE_CLIENT_ID", ""),
-			AdminEmail:     getEnv("ADMIN_EMAIL", ""),
+			Port:            getEnv("PORT", "8080"),
+			DatabaseURL:     getEnv("DATABASE_URL_PROD", ""),
+			MinioEndpoint:   getEnv("MINIO_ENDPOINT", ""),
+			MinioAccessKey:  getEnv("MINIO_ACCESS_KEY", ""),
+			MinioSecretKey:  getEnv("MINIO_SECRET_KEY", ""),
+			MinioUseSSL:     getEnvBool("MINIO_USE_SSL", false),
+			MinioBucket:     getEnv("MINIO_BUCKET", ""),
+			MinioPublicURL:  getEnv("MINIO_PUBLIC_ENDPOINT", ""),
+			MinioPublicURLs: getEnv("MINIO_PUBLIC_ENDPOINTS", ""),
+			GoogleClientID:  getEnv("GOOGLE_CLIENT_ID", ""),
+			AdminEmail:      getEnv("ADMIN_EMAIL", ""),
+			JWTSecret:       getEnv("JWT_SECRET", ""),
+			JWTKeyID:        getEnv("JWT_KEY_ID", ""),
+			JWTKeys:         getEnv("JWT_KEYS", ""),
+			JWTIssuer:       getEnv("JWT_ISSUER", ""),
+			JWTAudience:     getEnv("JWT_AUDIENCE", ""),
+
+			GoogleAllowedDomain: getEnv("GOOGLE_ALLOWED_DOMAIN", ""),
+
+			DatabaseReplicaURL: getEnv("DATABASE_URL_REPLICA", ""),
+
+			DBQueryBudget:        getEnvInt("DB_QUERY_BUDGET", 0),
+			DBQueryBudgetEnforce: getEnvBool("DB_QUERY_BUDGET_ENFORCE", false),
+
+			DBStatementTimeout:         getEnvDuration("DB_STATEMENT_TIMEOUT", 2*time.Minute),
+			DBIdleInTransactionTimeout: getEnvDuration("DB_IDLE_IN_TRANSACTION_TIMEOUT", 10*time.Minute),
+
+			ResponseCompression: getEnvBool("RESPONSE_COMPRESSION", true),
+			CompressionMinBytes: getEnvInt("COMPRESSION_MIN_BYTES", 1024),
+
+			TransferRemovesPreviousOwner: getEnvBool("TRANSFER_REMOVES_PREVIOUS_OWNER", false),
+
+			MaxShareLifetime:      getEnvDuration("SHARE_MAX_LIFETIME", 0),
+			MaxPublicLinkLifetime: getEnvDuration("PUBLIC_LINK_MAX_LIFETIME", 0),
+			MaxPublicLinksPerUser: getEnvInt("MAX_PUBLIC_LINKS_PER_USER", 0),
+
+			MaxFilesPerUpload: getEnvInt("MAX_FILES_PER_UPLOAD", 100),
+			UploadConcurrency: getEnvInt("UPLOAD_CONCURRENCY", 4),
+
+			StorageLayout:     getEnv("STORAGE_LAYOUT", "flat"),
+			DefaultVisibility: getEnv("DEFAULT_VISIBILITY", "private"),
+
+			DownloadFilenameTemplate: getEnv("DOWNLOAD_FILENAME_TEMPLATE", "{original}"),
+			DeleteMode:               getEnv("DELETE_MODE", "trash"),
+
+			DefaultQuotaBytes: getEnvInt64("DEFAULT_QUOTA_BYTES", 20<<20),
+
+			MaxUploadFileMB:  getEnvInt("MAX_UPLOAD_FILE_MB", 0),
+			BlockedMimeTypes: getEnv("BLOCKED_MIME_TYPES", ""),
+			AllowEmptyFiles:  getEnvBool("ALLOW_EMPTY_FILES", true),
+
+			QuarantineFlaggedUploads: getEnvBool("QUARANTINE_FLAGGED_UPLOADS", false),
+			ClamAVAddr:               getEnv("CLAMAV_ADDR", ""),
+			ScanTimeout:              getEnvDuration("SCAN_TIMEOUT", time.Minute),
+
+			TempUploadDir:   getEnv("TEMP_UPLOAD_DIR", ""),
+			TempUploadMaxMB: getEnvInt("TEMP_UPLOAD_MAX_MB", 2048),
+
+			UsageSnapshotInterval: getEnvDuration("USAGE_SNAPSHOT_INTERVAL", 24*time.Hour),
+
+			UploadSessionTTL:           getEnvDuration("UPLOAD_SESSION_TTL", 24*time.Hour),
+			UploadSessionSweepInterval: getEnvDuration("UPLOAD_SESSION_SWEEP_INTERVAL", time.Hour),
+
+			CDNBaseURL:    getEnv("CDN_BASE_URL", ""),
+			CDNSigningKey: getEnv("CDN_SIGNING_KEY", ""),
+			CDNURLTTL:     getEnvDuration("CDN_URL_TTL", 10*time.Minute),
+			CDNPurgeURL:   getEnv("CDN_PURGE_URL", ""),
+			CDNPurgeToken: getEnv("CDN_PURGE_TOKEN", ""),
+
+			EncryptionKeys:  getEnv("ENCRYPTION_KEYS", ""),
+			EncryptionKeyID: getEnv("ENCRYPTION_KEY_ID", ""),
+			DownloadBaseURL: getEnv("DOWNLOAD_BASE_URL", ""),
+
+			SMTPAddr:     getEnv("SMTP_ADDR", ""),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom:     getEnv("SMTP_FROM", ""),
+			AppURL:       getEnv("APP_URL", ""),
 		}
 	})
 	return cfg
 }
 
+// PublicEndpointsByHost parses MINIO_PUBLIC_ENDPOINTS, a comma-separated list of
+// host=endpoint pairs such as "files.example.com=https://cdn.example.com". Requests
+// arriving for a listed host get presigned URLs on its endpoint; all others keep
+// MINIO_PUBLIC_ENDPOINT. Hosts are matched case-insensitively.
+func (c *Config) PublicEndpointsByHost() (map[string]string, error) {
+	endpoints := map[string]string{}
+	for _, entry := range strings.Split(c.MinioPublicURLs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, endpoint, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		endpoint = strings.TrimSpace(endpoint)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("MINIO_PUBLIC_ENDPOINTS entries must look like host=endpoint")
+		}
+		if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("MINIO_PUBLIC_ENDPOINTS endpoint for %q must be an absolute URL like https://files.example.com", host)
+		}
+		if _, dup := endpoints[host]; dup {
+			return nil, fmt.Errorf("MINIO_PUBLIC_ENDPOINTS lists host %q twice", host)
+		}
+		endpoints[host] = endpoint
+	}
+	return endpoints, nil
+}
+
+// MinJWTSecretLength is the shortest JWT_SECRET accepted at startup (256 bits for HS256).
+const MinJWTSecretLength = 32
+
+// JWTSigningKeys validates the JWT key configuration and returns the active key ID
+// and every verification key by ID. Without JWT_KEYS, JWT_SECRET alone signs tokens
+// under the empty ID. With JWT_KEYS, JWT_KEY_ID picks the signing key and JWT_SECRET,
+// if still set, keeps verifying tokens issued before key IDs were introduced. Every
+// secret must be at least MinJWTSecretLength bytes long, so weak placeholder values
+// are caught at startup rather than in production traffic.
+//
+// Returns:
+//   - string: The ID of the key new tokens are signed with
+//   - map[string][]byte: Secrets by key ID, including the active one
+//   - error: nil if the configuration is usable, or an error explaining how to fix it
+func (c *Config) JWTSigningKeys() (string, map[string][]byte, error) {
+	keys := map[string][]byte{}
+	if c.JWTSecret != "" {
+		if err := checkJWTSecret("JWT_SECRET", c.JWTSecret); err != nil {
+			return "", nil, err
+		}
+		keys[""] = []byte(c.JWTSecret)
+	}
+
+	if strings.TrimSpace(c.JWTKeys) == "" {
+		if c.JWTKeyID != "" {
+			return "", nil, fmt.Errorf("JWT_KEY_ID is set but JWT_KEYS is empty")
+		}
+		if c.JWTSecret == "" {
+			return "", nil, fmt.Errorf("JWT_SECRET must be set")
+		}
+		return "", keys, nil
+	}
+
+	for _, entry := range strings.Split(c.JWTKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return "", nil, fmt.Errorf("JWT_KEYS entries must look like id:secret")
+		}
+		if _, dup := keys[id]; dup {
+			return "", nil, fmt.Errorf("JWT_KEYS lists key %q twice", id)
+		}
+		if err := checkJWTSecret(fmt.Sprintf("JWT_KEYS key %q", id), secret); err != nil {
+			return "", nil, err
+		}
+		keys[id] = []byte(secret)
+	}
+	if c.JWTKeyID == "" {
+		return "", nil, fmt.Errorf("JWT_KEY_ID must name the active key in JWT_KEYS")
+	}
+	if _, ok := keys[c.JWTKeyID]; !ok {
+		return "", nil, fmt.Errorf("JWT_KEY_ID %q is not listed in JWT_KEYS", c.JWTKeyID)
+	}
+	return c.JWTKeyID, keys, nil
+}
+
+// checkJWTSecret rejects secrets shorter than MinJWTSecretLength.
+func checkJWTSecret(name, secret string) error {
+	if len(secret) < MinJWTSecretLength {
+		return fmt.Errorf("%s must be at least %d characters (got %d); generate one with `openssl rand -hex 32`", name, MinJWTSecretLength, len(secret))
+	}
+	return nil
+}
+
 // getEnv retrieves an environment variable value with a fallback default.
 // This helper function simplifies environment variable access with default values.
 //
@@ -89,3 +364,58 @@ func getEnvBool(key string, def bool) bool {
 	}
 	return def
 }
+
+// getEnvInt retrieves an integer environment variable with a fallback default.
+//
+// Parameters:
+//   - key: The environment variable name to retrieve
+//   - def: The default integer to return if parsing fails or variable is not set
+//
+// Returns:
+//   - int: The parsed integer or the default if parsing fails
+func getEnvInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// getEnvInt64 retrieves a 64-bit integer environment variable with a fallback default.
+//
+// Parameters:
+//   - key: The environment variable name to retrieve
+//   - def: The default integer to return if parsing fails or variable is not set
+//
+// Returns:
+//   - int64: The parsed integer or the default if parsing fails
+func getEnvInt64(key string, def int64) int64 {
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// getEnvDuration retrieves a duration environment variable with a fallback default.
+// Values use Go duration syntax, e.g. "720h" for 30 days.
+//
+// Parameters:
+//   - key: The environment variable name to retrieve
+//   - def: The default duration to return if parsing fails or variable is not set
+//
+// Returns:
+//   - time.Duration: The parsed duration or the default if parsing fails
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+	}
+	return def
+}
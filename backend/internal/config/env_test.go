@@ -0,0 +1,69 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_JWTSigningKeys_Secret(t *testing.T) {
+	for _, secret := range []string{"", "secret", strings.Repeat("a", MinJWTSecretLength-1)} {
+		if _, _, err := (&Config{JWTSecret: secret}).JWTSigningKeys(); err == nil {
+			t.Fatalf("expected %d-character secret to be rejected", len(secret))
+		}
+	}
+	kid, keys, err := (&Config{JWTSecret: strings.Repeat("a", MinJWTSecretLength)}).JWTSigningKeys()
+	if err != nil || kid != "" || len(keys) != 1 {
+		t.Fatalf("expected minimum-length secret to be accepted, got %q %v (%v)", kid, keys, err)
+	}
+}
+
+func TestConfig_JWTSigningKeys_Rotation(t *testing.T) {
+	old, cur := strings.Repeat("o", MinJWTSecretLength), strings.Repeat("c", MinJWTSecretLength)
+	cfg := &Config{JWTSecret: old, JWTKeyID: "2024-06", JWTKeys: "2024-01:" + old + ", 2024-06:" + cur}
+	kid, keys, err := cfg.JWTSigningKeys()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if kid != "2024-06" || string(keys["2024-06"]) != cur || string(keys["2024-01"]) != old || string(keys[""]) != old {
+		t.Fatalf("unexpected keys: %q %v", kid, keys)
+	}
+
+	for _, bad := range []*Config{
+		{JWTKeyID: "missing", JWTKeys: "2024-06:" + cur},
+		{JWTKeys: "2024-06:" + cur},
+		{JWTKeyID: "2024-06", JWTKeys: "2024-06:short"},
+		{JWTKeyID: "2024-06", JWTKeys: "2024-06"},
+		{JWTKeyID: "2024-06", JWTKeys: "2024-06:" + cur + ",2024-06:" + cur},
+		{JWTKeyID: "2024-06", JWTSecret: cur},
+	} {
+		if _, _, err := bad.JWTSigningKeys(); err == nil {
+			t.Fatalf("expected %+v to be rejected", *bad)
+		}
+	}
+}
+
+func TestConfig_PublicEndpointsByHost(t *testing.T) {
+	cfg := &Config{MinioPublicURLs: " Files.Example.com=https://cdn.example.com, intranet:8080=http://minio.internal:9000 ,"}
+	endpoints, err := cfg.PublicEndpointsByHost()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(endpoints) != 2 || endpoints["files.example.com"] != "https://cdn.example.com" || endpoints["intranet:8080"] != "http://minio.internal:9000" {
+		t.Fatalf("unexpected endpoints: %v", endpoints)
+	}
+
+	if endpoints, err := (&Config{}).PublicEndpointsByHost(); err != nil || len(endpoints) != 0 {
+		t.Fatalf("expected no endpoints when unset, got %v (%v)", endpoints, err)
+	}
+
+	for _, bad := range []string{
+		"files.example.com",
+		"=https://cdn.example.com",
+		"files.example.com=cdn.example.com",
+		"a.example.com=https://a.example.com,A.example.com=https://b.example.com",
+	} {
+		if _, err := (&Config{MinioPublicURLs: bad}).PublicEndpointsByHost(); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
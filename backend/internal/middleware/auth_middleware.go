@@ -1,5 +1,5 @@
 // Package middleware provides HTTP middleware functions for the SnapVault application.
-// It includes authentication middleware for JWT token validation and context injection.
+// It includes authentication middleware for JWT and API token validation and context injection.
 package middleware
 
 import (
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/models"
 )
 
 // contextKey is a private type to avoid key collisions in context.
@@ -16,21 +17,46 @@ type contextKey string
 
 // Context keys for storing user authentication information
 const (
-	userIDContextKey  contextKey = "userId"
-	isAdminContextKey contextKey = "isAdmin"
+	userIDContextKey   contextKey = "userId"
+	isAdminContextKey  contextKey = "isAdmin"
+	apiTokenContextKey contextKey = "apiTokenId"
+	scopesContextKey   contextKey = "scopes"
 )
 
+// APITokenResolver looks up the API token behind a bearer credential.
+// *services.AuthService satisfies it.
+type APITokenResolver interface {
+	ResolveAPIToken(ctx context.Context, token string) (*models.APIToken, error)
+}
+
 // AuthMiddleware validates the Authorization: Bearer <token> header.
 // On success, it injects the `userId` and `isAdmin` from the token into the request context
 // and calls the next handler. On failure, it responds with 401 Unauthorized.
 // If no Authorization header is provided, the request continues as anonymous.
 //
 // Parameters:
+//   - keys: The JWT keys tokens are verified against
 //   - next: The next HTTP handler in the chain
 //
 // Returns:
 //   - http.Handler: A handler that performs authentication before calling next
-func AuthMiddleware(next http.Handler) http.Handler {
+func AuthMiddleware(keys *auth.KeySet, next http.Handler) http.Handler {
+	return AuthMiddlewareWithTokens(keys, nil, next)
+}
+
+// AuthMiddlewareWithTokens is AuthMiddleware that also accepts API tokens, told apart
+// from JWTs by auth.APITokenPrefix. A valid API token authenticates as its owner, never
+// as an admin, and the token's ID and scopes are recorded in the context. With a nil resolver API
+// tokens are rejected like any other invalid credential.
+//
+// Parameters:
+//   - keys: The JWT keys tokens are verified against
+//   - tokens: Resolves API tokens to their owners (optional)
+//   - next: The next HTTP handler in the chain
+//
+// Returns:
+//   - http.Handler: A handler that performs authentication before calling next
+func AuthMiddlewareWithTokens(keys *auth.KeySet, tokens APITokenResolver, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -44,18 +70,46 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userID, isAdmin, err := auth.VerifyJWT(parts[1])
+		if auth.IsAPIToken(parts[1]) {
+			if tokens == nil {
+				http.Error(w, "invalid or revoked API token", http.StatusUnauthorized)
+				return
+			}
+			t, err := tokens.ResolveAPIToken(r.Context(), parts[1])
+			if err != nil {
+				http.Error(w, "invalid or revoked API token", http.StatusUnauthorized)
+				return
+			}
+			ctx := WithAPIToken(WithUser(r.Context(), t.UserID.String(), false), t.ID.String(), t.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		userID, isAdmin, err := auth.VerifyJWT(keys, parts[1])
 		if err != nil {
 			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), userIDContextKey, userID)
-		ctx = context.WithValue(ctx, isAdminContextKey, isAdmin)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), userID, isAdmin)))
 	})
 }
 
+// WithUser returns a copy of ctx carrying the authenticated user, as AuthMiddleware does
+// after verifying a token. It is also used to build authenticated contexts in tests.
+//
+// Parameters:
+//   - ctx: The parent context
+//   - userID: The authenticated user's ID
+//   - isAdmin: Whether the user has administrative privileges
+//
+// Returns:
+//   - context.Context: A context readable by GetUserIDFromContext and GetIsAdminFromContext
+func WithUser(ctx context.Context, userID string, isAdmin bool) context.Context {
+	ctx = context.WithValue(ctx, userIDContextKey, userID)
+	return context.WithValue(ctx, isAdminContextKey, isAdmin)
+}
+
 // GetUserIDFromContext retrieves the authenticated userId set by AuthMiddleware.
 // This function should be used in GraphQL resolvers and other handlers to get
 // the current user's ID from the request context.
@@ -89,3 +143,55 @@ func GetIsAdminFromContext(ctx context.Context) bool {
 	}
 	return false
 }
+
+// GetAPITokenIDFromContext returns the ID of the API token the request authenticated with.
+// It reports false for requests authenticated with a session JWT or not at all.
+//
+// Parameters:
+//   - ctx: The request context containing user information
+//
+// Returns:
+//   - string: The API token ID
+//   - bool: true if the request was authenticated with an API token
+func GetAPITokenIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(apiTokenContextKey).(string)
+	return id, ok && id != ""
+}
+
+// WithAPIToken returns a copy of ctx marked as authenticated by the given API token,
+// limited to its scopes. Combine it with WithUser for the token's owner.
+//
+// Parameters:
+//   - ctx: The parent context
+//   - tokenID: The API token's ID
+//   - scopes: The scopes the token holds
+//
+// Returns:
+//   - context.Context: A context readable by GetAPITokenIDFromContext and HasScope
+func WithAPIToken(ctx context.Context, tokenID string, scopes []string) context.Context {
+	ctx = context.WithValue(ctx, apiTokenContextKey, tokenID)
+	return context.WithValue(ctx, scopesContextKey, scopes)
+}
+
+// HasScope reports whether the request may act within scope. Requests authenticated
+// with an API token need the scope on the token; sessions and anonymous requests are
+// not limited by scopes.
+//
+// Parameters:
+//   - ctx: The request context containing user information
+//   - scope: The scope to check, e.g. auth.ScopeFilesWrite
+//
+// Returns:
+//   - bool: true if the request may act within scope
+func HasScope(ctx context.Context, scope string) bool {
+	if _, viaToken := GetAPITokenIDFromContext(ctx); !viaToken {
+		return true
+	}
+	scopes, _ := ctx.Value(scopesContextKey).([]string)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/models"
+)
+
+// stubResolver accepts the tokens it holds until they are revoked.
+type stubResolver map[string]*models.APIToken
+
+func (s stubResolver) ResolveAPIToken(ctx context.Context, token string) (*models.APIToken, error) {
+	if t, ok := s[token]; ok {
+		return t, nil
+	}
+	return nil, errors.New("invalid or revoked API token")
+}
+
+func serveWithToken(h http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddleware_APIToken(t *testing.T) {
+	keys := auth.NewKeySet([]byte("0123456789abcdef0123456789abcdef"))
+	owner := uuid.New()
+	token := auth.APITokenPrefix + "abc"
+	tokenID := uuid.New()
+	tokens := stubResolver{token: {ID: tokenID, UserID: owner}}
+
+	var gotUser, gotToken string
+	var gotAdmin bool
+	h := AuthMiddlewareWithTokens(keys, tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = GetUserIDFromContext(r.Context())
+		gotToken, _ = GetAPITokenIDFromContext(r.Context())
+		gotAdmin = GetIsAdminFromContext(r.Context())
+	}))
+
+	if rec := serveWithToken(h, token); rec.Code != http.StatusOK {
+		t.Fatalf("expected api token to authenticate, got %d", rec.Code)
+	}
+	if gotUser != owner.String() || gotToken != tokenID.String() || gotAdmin {
+		t.Fatalf("expected owner without admin rights, got user %q token %q admin %v", gotUser, gotToken, gotAdmin)
+	}
+
+	// JWTs keep working and carry no token id
+	jwtToken, err := auth.GenerateJWT(keys, owner.String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := serveWithToken(h, jwtToken); rec.Code != http.StatusOK || gotToken != "" {
+		t.Fatalf("expected jwt to authenticate without a token id, got %d (%q)", rec.Code, gotToken)
+	}
+
+	delete(tokens, token)
+	if rec := serveWithToken(h, token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked token to be rejected, got %d", rec.Code)
+	}
+
+	// Without a resolver, API tokens are never accepted
+	if rec := serveWithToken(AuthMiddleware(keys, h), token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected api token to be rejected without a resolver, got %d", rec.Code)
+	}
+}
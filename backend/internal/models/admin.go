@@ -29,3 +29,25 @@ type AdminUserInfo struct {
 	// StorageUsed is the total storage space consumed by the user's files in bytes
 	StorageUsed int64 `json:"storageUsed"`
 }
+
+// AdminUserDetail gathers everything support needs about one user on a single page:
+// their account and usage, sharing in both directions, public links, activity and trash.
+type AdminUserDetail struct {
+	// User carries the account details with file, folder and storage totals
+	User *AdminUserInfo
+	// OutgoingFileShares and OutgoingFolderShares are the unexpired shares the user created
+	OutgoingFileShares   []FileShare
+	OutgoingFolderShares []FolderShare
+	// IncomingFileShares and IncomingFolderShares are the unexpired shares sent to the user's email
+	IncomingFileShares   []FileShare
+	IncomingFolderShares []FolderShare
+	// PublicLinks are the user's active public links
+	PublicLinks []PublicLink
+	// RecentActivity is the user's latest file previews and downloads
+	RecentActivity []RecentFileActivity
+	// Downloads is how often the user's files were downloaded by others
+	Downloads int64
+	// TrashFiles and TrashBytes count the user's soft-deleted files
+	TrashFiles int
+	TrashBytes int64
+}
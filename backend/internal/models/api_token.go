@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIToken is a long-lived credential a user creates for scripts and tools.
+// The token itself is never stored; TokenHash identifies it on use.
+type APIToken struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"userId"`
+	// Name is the label the user gave the token
+	Name string `json:"name"`
+	// Prefix is the token's leading characters, shown so users can tell tokens apart
+	Prefix string `json:"prefix"`
+	// Scopes limit what the token may do (see auth.AllAPITokenScopes)
+	Scopes    []string  `json:"scopes"`
+	TokenHash string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	// LastUsedAt is refreshed at most once a minute while the token is in use
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
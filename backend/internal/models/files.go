@@ -22,14 +22,41 @@ type File struct {
 	MimeType string
 	// Size is the file size in bytes
 	Size int64 `gorm:"not null"`
-	// RefCount tracks how many users reference this file (for cleanup purposes)
-	RefCount int `gorm:"default:0"` // Number of users referencing
-	// Visibility controls the file's access level: "private", "public", or "shared"
+	// RefCount is the number of active user_files mappings, kept in sync by a database trigger
+	RefCount int `gorm:"default:0"` // Number of active mappings
+	// Visibility is the owning mapping's visibility when the file is loaded through a UserFile;
+	// the files column itself is a legacy content-level setting that access checks ignore
 	Visibility string `gorm:"default:'private'"` // private, public, shared
 	// CreatedAt timestamp when the file was first uploaded to the system
 	CreatedAt time.Time `gorm:"autoCreateTime"`
+	// Status is "active" or "quarantined"; quarantined content cannot be downloaded
+	Status string `gorm:"default:'active'"`
+	// QuarantineReason is the scanner's reason for flagging the content (empty unless quarantined)
+	QuarantineReason string
+	// QuarantinedAt is when the content was quarantined (nil unless quarantined)
+	QuarantinedAt *time.Time
+	// EncryptionKeyID names the master key the stored object is encrypted under; empty for
+	// plaintext objects. Only loaded by lookups of the file itself (GetByID, FindByHash)
+	EncryptionKeyID string
+	// EncryptionNonce is the per-file nonce the object's key is derived with (nil for plaintext)
+	EncryptionNonce []byte
 }
 
+// File statuses
+const (
+	FileStatusActive      = "active"
+	FileStatusQuarantined = "quarantined"
+)
+
+// File visibilities, set per owner mapping in user_files.visibility. A public file can be
+// viewed and downloaded by any signed-in user; private and shared files only by their owner
+// and share recipients. Anonymous access always needs a public link, whatever the visibility.
+const (
+	VisibilityPrivate = "private"
+	VisibilityShared  = "shared"
+	VisibilityPublic  = "public"
+)
+
 // UserFile represents the association between a user and a file.
 // This allows multiple users to have access to the same file with different roles.
 // Files can be organized into folders through the FolderID field.
@@ -46,6 +73,12 @@ type UserFile struct {
 	UploadedAt time.Time `gorm:"autoCreateTime"`
 	// FolderID optionally groups this file into a folder (nil for root level)
 	FolderID *uuid.UUID `gorm:"index"`
+	// LastAccessedAt is when this user last previewed or downloaded the file (nil if never)
+	LastAccessedAt *time.Time
+	// DeletedAt is when the mapping was moved to trash (nil while active; only loaded by mapping-ID lookups)
+	DeletedAt *time.Time
+	// Description is this user's note on the file (empty when none); other users' copies keep their own
+	Description string
 
 	// File is the associated file record loaded via foreign key
 	File File `gorm:"foreignKey:FileID"`
@@ -57,4 +90,6 @@ type UserFile struct {
 	UploaderName string
 	// UploaderPicture contains the profile picture URL of the uploader (if available)
 	UploaderPicture string
+	// DownloadStats holds the file's download counts; only populated when a listing asks for them
+	DownloadStats *FileDownloadStats `gorm:"-"`
 }
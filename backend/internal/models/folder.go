@@ -20,4 +20,25 @@ type Folder struct {
 	ParentID *uuid.UUID `gorm:"index"`
 	// CreatedAt timestamp when the folder was created
 	CreatedAt time.Time `gorm:"autoCreateTime"`
+	// UpdatedAt changes on every modification and doubles as the optimistic concurrency version
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	// Description is the owner's note on the folder (empty when none)
+	Description string
+	// DeletedAt is set while the folder is in the trash
+	DeletedAt *time.Time
+
+	// CreatorEmail, CreatorName and CreatorPicture describe the folder's owner; they are only
+	// populated by shared folder listings, mirroring UserFile's uploader fields
+	CreatorEmail   string `gorm:"-"`
+	CreatorName    string `gorm:"-"`
+	CreatorPicture string `gorm:"-"`
+}
+
+// FolderTreeEntry is one folder of a depth-limited subtree listing.
+type FolderTreeEntry struct {
+	Folder
+	// Depth is 1 for the top level of the listing
+	Depth int
+	// HasChildren reports whether the folder has subfolders, whether or not they were listed
+	HasChildren bool
 }
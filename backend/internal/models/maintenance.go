@@ -0,0 +1,17 @@
+package models
+
+import "github.com/google/uuid"
+
+// FileRefCount compares a file's stored ref_count with the mappings that actually point at it.
+type FileRefCount struct {
+	FileID      uuid.UUID `json:"fileId"`
+	Hash        string    `json:"hash"`
+	StoragePath string    `json:"storagePath"`
+	Size        int64     `json:"size"`
+	// RefCount is the value stored in files.ref_count
+	RefCount int `json:"refCount"`
+	// ActiveMappings counts user_files rows for the file that aren't in trash
+	ActiveMappings int `json:"activeMappings"`
+	// TotalMappings counts every user_files row for the file, trashed ones included
+	TotalMappings int `json:"totalMappings"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization is a team sharing a storage pool. Members keep their personal quota; the
+// organization's quota additionally caps what all members store together.
+type Organization struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// QuotaBytes is the pool shared by every member
+	QuotaBytes int64     `json:"quotaBytes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
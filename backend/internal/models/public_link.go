@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PublicLink is an active public link to a file or folder, as listed for its owner
+type PublicLink struct {
+	ItemType string // "file" or "folder"
+	ItemID   uuid.UUID
+	// ItemName is the file's original name or the folder's name
+	ItemName  string
+	Token     string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	// AccessCount is the download count of a file link or the access count of a folder link
+	AccessCount int64
+}
+
+// LinkState is what decides whether a public link may be resolved
+type LinkState struct {
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	// PasswordHash is the bcrypt hash of the link's password, nil for open links
+	PasswordHash *string
+	// Downloads counts resolves of a file link, or visits of a folder link
+	Downloads int64
+	// MaxDownloads is how many times a file link may be resolved, nil for no limit
+	MaxDownloads *int64
+}
+
+// Exhausted reports whether the link has used up its allowed downloads
+func (s LinkState) Exhausted() bool {
+	return s.MaxDownloads != nil && s.Downloads >= *s.MaxDownloads
+}
+
+// DownloadBucket counts the downloads in one hour or day of a link's download timeline
+type DownloadBucket struct {
+	// Start is the beginning of the bucket in UTC
+	Start     time.Time
+	Downloads int64
+}
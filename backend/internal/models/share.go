@@ -22,6 +22,19 @@ type FileShare struct {
 	SharedWithUser *User `gorm:"foreignKey:SharedWithID"`
 }
 
+// ShareAccess reports whether a file share's recipient has opened the shared file
+type ShareAccess struct {
+	ShareID         uuid.UUID
+	SharedWithEmail string
+	// RecipientID is nil when the recipient has no account yet
+	RecipientID      *uuid.UUID
+	SharedAt         time.Time
+	LastDownloadedAt *time.Time
+	LastPreviewedAt  *time.Time
+	// LastAccessedAt is the later of LastDownloadedAt and LastPreviewedAt (nil if never accessed)
+	LastAccessedAt *time.Time
+}
+
 // FolderShare represents a folder shared with a user
 type FolderShare struct {
 	ID              uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
@@ -37,3 +50,15 @@ type FolderShare struct {
 	Owner          User   `gorm:"foreignKey:OwnerID"`
 	SharedWithUser *User  `gorm:"foreignKey:SharedWithID"`
 }
+
+// AccessItem identifies a file or folder whose permission is being looked up
+type AccessItem struct {
+	Type string // "file" or "folder"
+	ID   uuid.UUID
+}
+
+// ItemAccess is the caller's permission on an item: "none", "viewer", "editor" or "owner"
+type ItemAccess struct {
+	AccessItem
+	Permission string
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadFailure is one file an upload couldn't store, kept so support can see why uploads
+// fail for a user.
+type UploadFailure struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"userId"`
+	// UserEmail is the uploader's email when listing; empty if the account is gone
+	UserEmail string `json:"userEmail"`
+	Filename  string `json:"filename"`
+	// Size is the size the client declared for the file (0 when it didn't say)
+	Size int64 `json:"size"`
+	// Reason is the rejection code (QUOTA, MIME_MISMATCH, ...) or ERROR for other failures
+	Reason string `json:"reason"`
+	// Message is the error the client was given
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadSession is a file being uploaded in chunks, so an interrupted upload can resume
+// where it stopped instead of starting over.
+type UploadSession struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"userId"`
+	Filename string    `json:"filename"`
+	// TotalSize is the size of the whole file, declared when the session is opened
+	TotalSize int64 `json:"totalSize"`
+	// ChunkSize is the size of every chunk but the last
+	ChunkSize int64 `json:"chunkSize"`
+	// ObjectKey is where the chunks are assembled in object storage
+	ObjectKey string `json:"-"`
+	// MultipartID is the object storage multipart upload the chunks are parts of
+	MultipartID string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// UploadPart is one chunk of an upload session that has been stored.
+type UploadPart struct {
+	ChunkIndex int    `json:"chunkIndex"`
+	ETag       string `json:"-"`
+	Size       int64  `json:"size"`
+}
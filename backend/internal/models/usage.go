@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageSnapshot is one day's storage usage for a user, used to chart growth over time.
+type UsageSnapshot struct {
+	// UserID is the user the snapshot belongs to
+	UserID uuid.UUID `json:"userId"`
+	// Date is the UTC day the snapshot was taken (time of day is zero)
+	Date time.Time `json:"date"`
+	// LogicalBytes is the full size of every distinct file the user holds, as charged to their quota
+	LogicalBytes int64 `json:"logicalBytes"`
+	// AttributedBytes is the user's share of physical storage, with shared files split across holders
+	AttributedBytes int64 `json:"attributedBytes"`
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// Accounts live in two tables, users for password sign-ups and google_users for Google
+// sign-ins, so an account id stored on a mapping, share, link or download may point at
+// either. The fragments below join both and read whichever matched, so every query
+// describes owners, uploaders and downloaders the same way.
+
+// accountJoin left-joins users as alias and google_users as "g" + alias on idColumn.
+func accountJoin(alias, idColumn string) string {
+	return fmt.Sprintf(`
+		LEFT JOIN users %[1]s ON %[2]s = %[1]s.id
+		LEFT JOIN google_users g%[1]s ON %[2]s = g%[1]s.id`, alias, idColumn)
+}
+
+// accountColumns selects the email and creation time of the account joined as alias,
+// named prefix_email and prefix_created_at, for scanning into an accountRow. Both are NULL
+// when no account matched. The id isn't selected: callers already have it from the column
+// they joined on.
+func accountColumns(alias, prefix string) string {
+	return fmt.Sprintf(`COALESCE(%[1]s.email, g%[1]s.email) AS %[2]s_email, COALESCE(%[1]s.created_at, g%[1]s.created_at) AS %[2]s_created_at`,
+		alias, prefix)
+}
+
+// profileColumns selects the email, name and picture of the account joined as alias,
+// named prefix_email, prefix_name and prefix_picture. Only Google accounts have a name and
+// picture; missing values come back empty so they scan into plain strings.
+func profileColumns(alias, prefix string) string {
+	return fmt.Sprintf(`COALESCE(%[1]s.email, g%[1]s.email, '') AS %[2]s_email, COALESCE(g%[1]s.name, '') AS %[2]s_name, COALESCE(g%[1]s.picture, '') AS %[2]s_picture`,
+		alias, prefix)
+}
+
+// accountRow receives the values selected by accountColumns.
+type accountRow struct {
+	email     *string
+	createdAt *time.Time
+}
+
+// dest returns the scan destinations for accountColumns, in order.
+func (a *accountRow) dest() []interface{} {
+	return []interface{}{&a.email, &a.createdAt}
+}
+
+// user builds the account with the given id; ok is false when no account matched.
+func (a accountRow) user(id uuid.UUID) (models.User, bool) {
+	if a.email == nil {
+		return models.User{ID: id}, false
+	}
+	u := models.User{ID: id, Email: *a.email}
+	if a.createdAt != nil {
+		u.CreatedAt = *a.createdAt
+	}
+	return u, true
+}
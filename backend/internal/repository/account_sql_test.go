@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// selectNames returns the output column names of a query's top-level select list: the
+// alias when there is one, else the column name without its table.
+func selectNames(t *testing.T, query string) []string {
+	t.Helper()
+	start := strings.Index(query, "SELECT")
+	end := strings.Index(query, "FROM ")
+	if start < 0 || end < start {
+		t.Fatalf("no select list in %s", query)
+	}
+	var names []string
+	depth, from := 0, start+len("SELECT")
+	list := query[:end]
+	for i := from; i <= len(list); i++ {
+		if i < len(list) {
+			switch list[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		expr := strings.TrimSpace(list[from:i])
+		from = i + 1
+		if idx := strings.LastIndex(strings.ToUpper(expr), " AS "); idx >= 0 {
+			names = append(names, strings.TrimSpace(expr[idx+4:]))
+			continue
+		}
+		names = append(names, expr[strings.LastIndex(expr, ".")+1:])
+	}
+	return names
+}
+
+func TestAccountJoin(t *testing.T) {
+	join := accountJoin("uo", "fd.owner_id")
+	for _, want := range []string{"LEFT JOIN users uo ON fd.owner_id = uo.id", "LEFT JOIN google_users guo ON fd.owner_id = guo.id"} {
+		if !strings.Contains(join, want) {
+			t.Fatalf("expected join to contain %q, got %s", want, join)
+		}
+	}
+}
+
+func TestAccountColumns(t *testing.T) {
+	names := selectNames(t, "SELECT "+accountColumns("u", "owner")+" FROM x")
+	if strings.Join(names, ",") != "owner_email,owner_created_at" {
+		t.Fatalf("unexpected account columns %v", names)
+	}
+	names = selectNames(t, "SELECT "+profileColumns("u", "uploader")+" FROM x")
+	if strings.Join(names, ",") != "uploader_email,uploader_name,uploader_picture" {
+		t.Fatalf("unexpected profile columns %v", names)
+	}
+	// Profile values scan into plain strings, so none of them may come back NULL
+	if strings.Contains(profileColumns("u", "uploader"), "NULLIF") || strings.Count(profileColumns("u", "uploader"), ", '')") != 3 {
+		t.Fatalf("expected every profile column to default to an empty string: %s", profileColumns("u", "uploader"))
+	}
+}
+
+func TestSharesForUserSQL_NoDuplicateColumns(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		scans int
+	}{
+		// 8 share columns, 8 file columns and the owner's email and creation time
+		{"file shares", fileSharesForUserSQL, 18},
+		// 8 share columns, 4 folder columns and the owner's email and creation time
+		{"folder shares", folderSharesForUserSQL, 14},
+	}
+	for _, c := range cases {
+		names := selectNames(t, c.query)
+		if len(names) != c.scans {
+			t.Fatalf("%s: expected %d columns to match the scan, got %d: %v", c.name, c.scans, len(names), names)
+		}
+		seen := map[string]bool{}
+		for _, n := range names {
+			// Unaliased columns of different tables may share a name (fs.id, f.id); the
+			// owner id must only come from the share
+			if n == "owner_id" && seen[n] {
+				t.Fatalf("%s: owner_id selected twice: %v", c.name, names)
+			}
+			seen[n] = true
+		}
+	}
+}
+
+func TestAccountRow_User(t *testing.T) {
+	id := uuid.New()
+	if u, ok := (accountRow{}).user(id); ok || u.ID != id || u.Email != "" {
+		t.Fatalf("expected a missing account to report not found with just the id, got %+v, %v", u, ok)
+	}
+	email, created := "a@example.com", time.Unix(100, 0)
+	u, ok := accountRow{email: &email, createdAt: &created}.user(id)
+	if !ok || u.ID != id || u.Email != email || !u.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected account %+v, %v", u, ok)
+	}
+	row := accountRow{}
+	if len(row.dest()) != len(selectNames(t, "SELECT "+accountColumns("u", "owner")+" FROM x")) {
+		t.Fatalf("expected one scan destination per account column")
+	}
+}
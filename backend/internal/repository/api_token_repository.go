@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/useradityaa/internal/models"
+)
+
+// APITokenRepository stores users' API tokens by hash.
+type APITokenRepository interface {
+	// Create inserts a token; ID and CreatedAt are filled in
+	Create(ctx context.Context, token *models.APIToken) error
+	// ListByUser returns the user's tokens that aren't revoked, newest first
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error)
+	// FindActiveByHash returns the unrevoked token with the given hash, or ErrNotFound
+	FindActiveByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	// Revoke marks the user's token revoked; false means the user has no such active token
+	Revoke(ctx context.Context, userID, tokenID uuid.UUID) (bool, error)
+	// TouchLastUsed records a use, writing at most once a minute per token
+	TouchLastUsed(ctx context.Context, tokenID uuid.UUID) error
+}
+
+type apiTokenRepository struct{ DB *pgxpool.Pool }
+
+// NewAPITokenRepository creates a new API token repository instance
+func NewAPITokenRepository(db *pgxpool.Pool) APITokenRepository {
+	return &apiTokenRepository{DB: db}
+}
+
+// apiTokenColumns lists the columns scanned by scanAPIToken, in order
+const apiTokenColumns = `id, user_id, name, prefix, scopes, token_hash, created_at, last_used_at, revoked_at`
+
+func scanAPIToken(row interface{ Scan(...any) error }, t *models.APIToken) error {
+	return row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.TokenHash, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt)
+}
+
+func (r *apiTokenRepository) Create(ctx context.Context, t *models.APIToken) error {
+	return r.DB.QueryRow(ctx, `
+		INSERT INTO api_tokens (user_id, name, prefix, scopes, token_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, t.UserID, t.Name, t.Prefix, t.Scopes, t.TokenHash).Scan(&t.ID, &t.CreatedAt)
+}
+
+func (r *apiTokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var t models.APIToken
+		if err := scanAPIToken(rows, &t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *apiTokenRepository) FindActiveByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	var t models.APIToken
+	row := r.DB.QueryRow(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`, tokenHash)
+	if err := scanAPIToken(row, &t); err != nil {
+		return nil, lookupErr("api token", err)
+	}
+	return &t, nil
+}
+
+func (r *apiTokenRepository) Revoke(ctx context.Context, userID, tokenID uuid.UUID) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE api_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *apiTokenRepository) TouchLastUsed(ctx context.Context, tokenID uuid.UUID) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, tokenID)
+	return err
+}
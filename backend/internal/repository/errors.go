@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotFound is returned by single-row lookups when nothing matches. Other database
+// errors are wrapped instead, so callers can tell the two apart with errors.Is.
+var ErrNotFound = errors.New("not found")
+
+// ErrRetained is returned when a file copy is under retention and can't be deleted yet.
+var ErrRetained = errors.New("file is under retention")
+
+// ErrOverQuota is returned when a change would take a user past the storage quota it was
+// checked against.
+var ErrOverQuota = errors.New("over quota")
+
+// ErrLinkLimit is returned when storing a public link would take its owner past the cap on
+// active links it was checked against.
+var ErrLinkLimit = errors.New("active link limit reached")
+
+// lookupErr maps pgx's no-rows error onto ErrNotFound and wraps anything else,
+// naming what was being loaded in both cases.
+func lookupErr(what string, err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%s: %w", what, ErrNotFound)
+	}
+	return fmt.Errorf("failed to load %s: %w", what, err)
+}
@@ -3,9 +3,9 @@ package repository
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/useradityaa/internal/models"
 )
@@ -20,10 +20,18 @@ type FileDownloadRepository interface {
 
 type fileDownloadRepository struct {
 	DB *pgxpool.Pool
+	// ReadDB serves download statistics; it is the replica when configured, else DB
+	ReadDB *pgxpool.Pool
 }
 
 func NewFileDownloadRepository(db *pgxpool.Pool) FileDownloadRepository {
-	return &fileDownloadRepository{DB: db}
+	return &fileDownloadRepository{DB: db, ReadDB: db}
+}
+
+// NewFileDownloadRepositoryWithReplica creates a download repository that sends
+// statistics queries to replica. A nil replica falls back to the primary.
+func NewFileDownloadRepositoryWithReplica(db, replica *pgxpool.Pool) FileDownloadRepository {
+	return &fileDownloadRepository{DB: db, ReadDB: ReadPool(db, replica)}
 }
 
 func (r *fileDownloadRepository) RecordDownload(ctx context.Context, fileID, ownerID uuid.UUID, downloadedBy *uuid.UUID, downloadType, shareToken, ipAddress, userAgent string) error {
@@ -35,74 +43,54 @@ func (r *fileDownloadRepository) RecordDownload(ctx context.Context, fileID, own
 	return err
 }
 
-func (r *fileDownloadRepository) GetFileDownloads(ctx context.Context, fileID uuid.UUID) ([]models.FileDownload, error) {
-	query := `
+// fileDownloadsSQL lists download events with their file, downloader and owner, filtered by
+// where (on fd) and newest first.
+func fileDownloadsSQL(where string) string {
+	return `
 		SELECT 
 			fd.id, fd.file_id, fd.downloaded_by, fd.owner_id, fd.download_type, 
 			fd.share_token, fd.ip_address, fd.user_agent, fd.downloaded_at,
 			f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-			COALESCE(u_downloaded.id, gu_downloaded.id) as downloaded_user_id,
-			COALESCE(u_downloaded.email, gu_downloaded.email) as downloaded_user_email,
-			COALESCE(u_downloaded.created_at, gu_downloaded.created_at) as downloaded_user_created_at,
-			COALESCE(u_owner.id, gu_owner.id) as owner_user_id,
-			COALESCE(u_owner.email, gu_owner.email) as owner_user_email,
-			COALESCE(u_owner.created_at, gu_owner.created_at) as owner_user_created_at
+			` + accountColumns("ud", "downloaded_user") + `,
+			` + accountColumns("uo", "owner_user") + `
 		FROM file_downloads fd
-		JOIN files f ON fd.file_id = f.id
-		LEFT JOIN users u_downloaded ON fd.downloaded_by = u_downloaded.id
-		LEFT JOIN google_users gu_downloaded ON fd.downloaded_by = gu_downloaded.id
-		LEFT JOIN users u_owner ON fd.owner_id = u_owner.id
-		LEFT JOIN google_users gu_owner ON fd.owner_id = gu_owner.id
-		WHERE fd.file_id = $1
+		JOIN files f ON fd.file_id = f.id` +
+		accountJoin("ud", "fd.downloaded_by") +
+		accountJoin("uo", "fd.owner_id") + `
+		WHERE ` + where + `
 		ORDER BY fd.downloaded_at DESC
 	`
+}
 
-	rows, err := r.DB.Query(ctx, query, fileID)
-	if err != nil {
-		return nil, err
-	}
+// scanFileDownloads reads rows selected by fileDownloadsSQL. The downloader is nil for
+// anonymous public link downloads.
+func scanFileDownloads(rows pgx.Rows) ([]models.FileDownload, error) {
 	defer rows.Close()
 
 	var downloads []models.FileDownload
 	for rows.Next() {
 		var download models.FileDownload
-		var downloadedUser *models.User
-		var tempDownloadedUser models.User
-		var downloadedUserID, downloadedUserEmail, ownerUserID, ownerUserEmail *string
-		var downloadedUserCreatedAt, ownerUserCreatedAt *time.Time
+		var downloader, owner accountRow
 
-		err := rows.Scan(
+		dest := []interface{}{
 			&download.ID, &download.FileID, &download.DownloadedBy, &download.OwnerID, &download.DownloadType,
 			&download.ShareToken, &download.IPAddress, &download.UserAgent, &download.DownloadedAt,
 			&download.File.ID, &download.File.Hash, &download.File.OriginalName, &download.File.MimeType,
 			&download.File.Size, &download.File.RefCount, &download.File.Visibility, &download.File.CreatedAt,
-			&downloadedUserID, &downloadedUserEmail, &downloadedUserCreatedAt,
-			&ownerUserID, &ownerUserEmail, &ownerUserCreatedAt,
-		)
-		if err != nil {
+		}
+		dest = append(dest, downloader.dest()...)
+		dest = append(dest, owner.dest()...)
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
 
-		// Handle downloaded user
-		if downloadedUserID != nil && downloadedUserEmail != nil && downloadedUserCreatedAt != nil {
-			uuid, _ := uuid.Parse(*downloadedUserID)
-			tempDownloadedUser = models.User{
-				ID:        uuid,
-				Email:     *downloadedUserEmail,
-				CreatedAt: *downloadedUserCreatedAt,
+		if download.DownloadedBy != nil {
+			if u, ok := downloader.user(*download.DownloadedBy); ok {
+				download.DownloadedUser = &u
 			}
-			downloadedUser = &tempDownloadedUser
 		}
-		download.DownloadedUser = downloadedUser
-
-		// Handle owner
-		if ownerUserID != nil && ownerUserEmail != nil && ownerUserCreatedAt != nil {
-			ownerUUID, _ := uuid.Parse(*ownerUserID)
-			download.Owner = models.User{
-				ID:        ownerUUID,
-				Email:     *ownerUserEmail,
-				CreatedAt: *ownerUserCreatedAt,
-			}
+		if u, ok := owner.user(download.OwnerID); ok {
+			download.Owner = u
 		}
 
 		downloads = append(downloads, download)
@@ -111,84 +99,35 @@ func (r *fileDownloadRepository) GetFileDownloads(ctx context.Context, fileID uu
 	return downloads, rows.Err()
 }
 
+func (r *fileDownloadRepository) GetFileDownloads(ctx context.Context, fileID uuid.UUID) ([]models.FileDownload, error) {
+	rows, err := r.DB.Query(ctx, fileDownloadsSQL("fd.file_id = $1"), fileID)
+	if err != nil {
+		return nil, err
+	}
+	return scanFileDownloads(rows)
+}
+
 func (r *fileDownloadRepository) GetOwnerSharedFileDownloads(ctx context.Context, ownerID uuid.UUID) ([]models.FileDownload, error) {
 	fmt.Printf("DEBUG: Repository querying downloads for owner: %s\n", ownerID)
-	query := `
-		SELECT 
-			fd.id, fd.file_id, fd.downloaded_by, fd.owner_id, fd.download_type, 
-			fd.share_token, fd.ip_address, fd.user_agent, fd.downloaded_at,
-			f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-			COALESCE(u_downloaded.id, gu_downloaded.id) as downloaded_user_id,
-			COALESCE(u_downloaded.email, gu_downloaded.email) as downloaded_user_email,
-			COALESCE(u_downloaded.created_at, gu_downloaded.created_at) as downloaded_user_created_at,
-			COALESCE(u_owner.id, gu_owner.id) as owner_user_id,
-			COALESCE(u_owner.email, gu_owner.email) as owner_user_email,
-			COALESCE(u_owner.created_at, gu_owner.created_at) as owner_user_created_at
-		FROM file_downloads fd
-		JOIN files f ON fd.file_id = f.id
-		LEFT JOIN users u_downloaded ON fd.downloaded_by = u_downloaded.id
-		LEFT JOIN google_users gu_downloaded ON fd.downloaded_by = gu_downloaded.id
-		LEFT JOIN users u_owner ON fd.owner_id = u_owner.id
-		LEFT JOIN google_users gu_owner ON fd.owner_id = gu_owner.id
-		WHERE fd.owner_id = $1
-		ORDER BY fd.downloaded_at DESC
-	`
-
-	rows, err := r.DB.Query(ctx, query, ownerID)
+	rows, err := r.DB.Query(ctx, fileDownloadsSQL("fd.owner_id = $1"), ownerID)
 	if err != nil {
 		fmt.Printf("ERROR: Repository query failed: %v\n", err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	var downloads []models.FileDownload
-	for rows.Next() {
-		var download models.FileDownload
-		var downloadedUser *models.User
-		var downloadedUserID, downloadedUserEmail, downloadedUserCreatedAt interface{}
-		var ownerUserID, ownerUserEmail, ownerUserCreatedAt interface{}
-
-		err := rows.Scan(
-			&download.ID, &download.FileID, &download.DownloadedBy, &download.OwnerID, &download.DownloadType,
-			&download.ShareToken, &download.IPAddress, &download.UserAgent, &download.DownloadedAt,
-			&download.File.ID, &download.File.Hash, &download.File.OriginalName, &download.File.MimeType,
-			&download.File.Size, &download.File.RefCount, &download.File.Visibility, &download.File.CreatedAt,
-			&downloadedUserID, &downloadedUserEmail, &downloadedUserCreatedAt,
-			&ownerUserID, &ownerUserEmail, &ownerUserCreatedAt,
-		)
-		if err != nil {
-			fmt.Printf("ERROR: Row scan failed: %v\n", err)
-			return nil, err
-		}
-
-		// Handle downloaded user (might be null for anonymous downloads)
-		if download.DownloadedBy != nil && downloadedUserID != nil {
-			downloadedUser = &models.User{
-				ID:        *download.DownloadedBy,
-				Email:     downloadedUserEmail.(string),
-				CreatedAt: downloadedUserCreatedAt.(time.Time),
-			}
-		}
-		download.DownloadedUser = downloadedUser
-
-		// Handle owner user (should always exist)
-		if ownerUserID != nil {
-			download.Owner = models.User{
-				ID:        download.OwnerID,
-				Email:     ownerUserEmail.(string),
-				CreatedAt: ownerUserCreatedAt.(time.Time),
-			}
-		}
-
-		downloads = append(downloads, download)
+	downloads, err := scanFileDownloads(rows)
+	if err != nil {
+		fmt.Printf("ERROR: Row scan failed: %v\n", err)
+		return nil, err
 	}
 
 	fmt.Printf("DEBUG: Repository found %d downloads for owner %s\n", len(downloads), ownerID)
-	return downloads, rows.Err()
+	return downloads, nil
 }
 
-func (r *fileDownloadRepository) GetFileDownloadStats(ctx context.Context) ([]models.FileDownloadStats, error) {
-	query := `
+// fileDownloadStatsSQL totals downloads per file and owner, filtered by where (on fd),
+// most downloaded first.
+func fileDownloadStatsSQL(where string) string {
+	return `
 		SELECT 
 			fd.file_id, fd.owner_id,
 			COUNT(*) as total_downloads,
@@ -196,114 +135,53 @@ func (r *fileDownloadRepository) GetFileDownloadStats(ctx context.Context) ([]mo
 			COUNT(CASE WHEN fd.download_type = 'public' THEN 1 END) as public_downloads,
 			MAX(fd.downloaded_at) as last_download_at,
 			f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-			COALESCE(u.id, gu.id) as owner_user_id,
-			COALESCE(u.email, gu.email) as owner_user_email,
-			COALESCE(u.created_at, gu.created_at) as owner_user_created_at
+			` + accountColumns("uo", "owner_user") + `
 		FROM file_downloads fd
-		JOIN files f ON fd.file_id = f.id
-		LEFT JOIN users u ON fd.owner_id = u.id
-		LEFT JOIN google_users gu ON fd.owner_id = gu.id
+		JOIN files f ON fd.file_id = f.id` +
+		accountJoin("uo", "fd.owner_id") + `
+		WHERE ` + where + `
 		GROUP BY fd.file_id, fd.owner_id, f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-				 owner_user_id, owner_user_email, owner_user_created_at
+				 owner_user_email, owner_user_created_at
 		ORDER BY total_downloads DESC, last_download_at DESC
 	`
+}
 
-	rows, err := r.DB.Query(ctx, query)
+func (r *fileDownloadRepository) GetFileDownloadStats(ctx context.Context) ([]models.FileDownloadStats, error) {
+	rows, err := r.ReadDB.Query(ctx, fileDownloadStatsSQL("TRUE"))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var stats []models.FileDownloadStats
-	for rows.Next() {
-		var stat models.FileDownloadStats
-		var lastDownloadAt *time.Time
-		var ownerUserID, ownerUserEmail *string
-		var ownerUserCreatedAt *time.Time
-
-		err := rows.Scan(
-			&stat.FileID, &stat.OwnerID, &stat.TotalDownloads, &stat.SharedDownloads, &stat.PublicDownloads, &lastDownloadAt,
-			&stat.File.ID, &stat.File.Hash, &stat.File.OriginalName, &stat.File.MimeType,
-			&stat.File.Size, &stat.File.RefCount, &stat.File.Visibility, &stat.File.CreatedAt,
-			&ownerUserID, &ownerUserEmail, &ownerUserCreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		stat.LastDownloadAt = lastDownloadAt
-
-		// Handle owner user
-		if ownerUserID != nil && ownerUserEmail != nil && ownerUserCreatedAt != nil {
-			ownerUUID, _ := uuid.Parse(*ownerUserID)
-			stat.Owner = models.User{
-				ID:        ownerUUID,
-				Email:     *ownerUserEmail,
-				CreatedAt: *ownerUserCreatedAt,
-			}
-		}
-
-		stats = append(stats, stat)
-	}
-
-	return stats, rows.Err()
+	return scanFileDownloadStats(rows)
 }
 
 func (r *fileDownloadRepository) GetFileDownloadStatsForUser(ctx context.Context, ownerID uuid.UUID) ([]models.FileDownloadStats, error) {
-	query := `
-		SELECT 
-			fd.file_id, fd.owner_id,
-			COUNT(*) as total_downloads,
-			COUNT(CASE WHEN fd.download_type = 'shared' THEN 1 END) as shared_downloads,
-			COUNT(CASE WHEN fd.download_type = 'public' THEN 1 END) as public_downloads,
-			MAX(fd.downloaded_at) as last_download_at,
-			f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-			COALESCE(u.id, gu.id) as owner_user_id,
-			COALESCE(u.email, gu.email) as owner_user_email,
-			COALESCE(u.created_at, gu.created_at) as owner_user_created_at
-		FROM file_downloads fd
-		JOIN files f ON fd.file_id = f.id
-		LEFT JOIN users u ON fd.owner_id = u.id
-		LEFT JOIN google_users gu ON fd.owner_id = gu.id
-		WHERE fd.owner_id = $1
-		GROUP BY fd.file_id, fd.owner_id, f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-				 owner_user_id, owner_user_email, owner_user_created_at
-		ORDER BY total_downloads DESC, last_download_at DESC
-	`
-
-	rows, err := r.DB.Query(ctx, query, ownerID)
+	rows, err := r.ReadDB.Query(ctx, fileDownloadStatsSQL("fd.owner_id = $1"), ownerID)
 	if err != nil {
 		return nil, err
 	}
+	return scanFileDownloadStats(rows)
+}
+
+// scanFileDownloadStats reads rows selected by fileDownloadStatsSQL.
+func scanFileDownloadStats(rows pgx.Rows) ([]models.FileDownloadStats, error) {
 	defer rows.Close()
 
 	var stats []models.FileDownloadStats
 	for rows.Next() {
 		var stat models.FileDownloadStats
-		var lastDownloadAt *time.Time
-		var ownerUserID, ownerUserEmail *string
-		var ownerUserCreatedAt *time.Time
+		var owner accountRow
 
-		err := rows.Scan(
-			&stat.FileID, &stat.OwnerID, &stat.TotalDownloads, &stat.SharedDownloads, &stat.PublicDownloads, &lastDownloadAt,
+		dest := []interface{}{
+			&stat.FileID, &stat.OwnerID, &stat.TotalDownloads, &stat.SharedDownloads, &stat.PublicDownloads, &stat.LastDownloadAt,
 			&stat.File.ID, &stat.File.Hash, &stat.File.OriginalName, &stat.File.MimeType,
 			&stat.File.Size, &stat.File.RefCount, &stat.File.Visibility, &stat.File.CreatedAt,
-			&ownerUserID, &ownerUserEmail, &ownerUserCreatedAt,
-		)
-		if err != nil {
+		}
+		if err := rows.Scan(append(dest, owner.dest()...)...); err != nil {
 			return nil, err
 		}
 
-		stat.LastDownloadAt = lastDownloadAt
-
-		// Handle owner user
-		if ownerUserID != nil && ownerUserEmail != nil && ownerUserCreatedAt != nil {
-			ownerUUID, _ := uuid.Parse(*ownerUserID)
-			stat.Owner = models.User{
-				ID:        ownerUUID,
-				Email:     *ownerUserEmail,
-				CreatedAt: *ownerUserCreatedAt,
-			}
+		if u, ok := owner.user(stat.OwnerID); ok {
+			stat.Owner = u
 		}
 
 		stats = append(stats, stat)
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FileLocker serializes operations that change which mappings reference a file, across
+// every server process sharing the database.
+type FileLocker interface {
+	// WithFileLock runs fn while holding an exclusive lock on the file. The lock is released
+	// when fn returns, whether or not it failed.
+	WithFileLock(ctx context.Context, fileID uuid.UUID, fn func(ctx context.Context) error) error
+}
+
+type fileLocker struct {
+	// DB holds the sessions the locks are taken in. It should be a pool of its own: each
+	// holder keeps a connection for as long as fn runs, and fn's queries go through the
+	// main pool, so sharing one pool lets enough holders take every connection and then
+	// wait forever for another.
+	DB *pgxpool.Pool
+}
+
+func NewFileLocker(db *pgxpool.Pool) FileLocker {
+	return &fileLocker{DB: db}
+}
+
+// WithFileLock takes the session-level pg_advisory_lock on the file's key on a connection
+// of its own and releases it with pg_advisory_unlock once fn is done. No transaction stays
+// open meanwhile, so idle_in_transaction_session_timeout can't end the session and drop the
+// lock while fn is still running.
+func (l *fileLocker) WithFileLock(ctx context.Context, fileID uuid.UUID, fn func(ctx context.Context) error) error {
+	conn, err := l.DB.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	key := fileLockKey(fileID)
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		conn.Release()
+		return err
+	}
+	defer func() {
+		// Unlock even when ctx was cancelled; a session that can't unlock is closed rather
+		// than returned to the pool still holding the lock
+		if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			conn.Hijack().Close(context.WithoutCancel(ctx))
+			return
+		}
+		conn.Release()
+	}()
+	return fn(ctx)
+}
+
+// fileLockKey folds a file id into the 64-bit key space of Postgres advisory locks.
+// Two files may share a key; that only costs them some needless waiting.
+func fileLockKey(fileID uuid.UUID) int64 {
+	return int64(binary.BigEndian.Uint64(fileID[:8]) ^ binary.BigEndian.Uint64(fileID[8:]))
+}
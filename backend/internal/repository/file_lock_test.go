@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFileLockKey(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	if fileLockKey(a) != fileLockKey(a) {
+		t.Fatalf("expected the same file to always map to the same lock key")
+	}
+	if fileLockKey(a) == fileLockKey(b) {
+		t.Fatalf("expected different files to get different lock keys")
+	}
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -16,9 +17,13 @@ import (
 type FileRepository interface {
 	FindByHash(ctx context.Context, hash string) (*models.File, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*models.File, error)
+	// GetByIDs loads several files in one query, in no particular order; ids without a
+	// files row are left out
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.File, error)
 	CreateFile(ctx context.Context, file *models.File) error
-	IncrementRefCount(ctx context.Context, fileID uuid.UUID) error
-	DecrementRefCount(ctx context.Context, fileID uuid.UUID) error
+	// CountFileMappings counts the file's active mappings and all mappings including soft-deleted ones.
+	// files.ref_count mirrors the active count and is maintained by a trigger on user_files.
+	CountFileMappings(ctx context.Context, fileID uuid.UUID) (active int, total int, err error)
 	// Note: userID can be from users or google_users; FK relaxed
 	AddUserFile(ctx context.Context, userID, fileID uuid.UUID, role string) (bool, error)
 	AddUserFileWithFolder(ctx context.Context, userID, fileID uuid.UUID, role string, folderID *uuid.UUID) (bool, error)
@@ -26,13 +31,30 @@ type FileRepository interface {
 	DeleteUserFile(ctx context.Context, userID, fileID uuid.UUID) error
 	// New helpers
 	GetUserUsageSum(ctx context.Context, userID uuid.UUID) (int64, error)
+	// GetUserQuota returns the user's quota override from user_quotas; nil when they have
+	// none and the default applies
+	GetUserQuota(ctx context.Context, userID uuid.UUID) (*int64, error)
 	GetUserAttributedUsage(ctx context.Context, userID uuid.UUID) (int64, error)
+	// GetUserUsageTotals returns what GetUserUsageSum, GetUserAttributedUsage and
+	// GetUserQuota do, plus the user's active file count, in one query. Like those, it
+	// leaves out trashed mappings and the copies the user holds as an editor
+	GetUserUsageTotals(ctx context.Context, userID uuid.UUID) (UsageTotals, error)
 	FindUserFileByHash(ctx context.Context, userID uuid.UUID, hash string) (*models.UserFile, error)
 	GetUserFileByFileID(ctx context.Context, userID, fileID uuid.UUID) (*models.UserFile, error)
+	// GetUserFilesByFileIDs returns the user's newest active mapping of each of the given
+	// files in one query; files the user has no active mapping of are left out
+	GetUserFilesByFileIDs(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]models.UserFile, error)
 	GetOwnerByFileID(ctx context.Context, fileID uuid.UUID) (*models.UserFile, error)
 	MarkUserFileDeleted(ctx context.Context, userID, fileID uuid.UUID) error
 	RecoverUserFile(ctx context.Context, userID, fileID uuid.UUID) error
+	// RecoverUserFilesByMappingIDs restores the user's trashed mappings among mappingIDs in
+	// one transaction and returns the ids restored; mappings no longer in the trash, or
+	// whose file is gone, are left out
+	RecoverUserFilesByMappingIDs(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) ([]uuid.UUID, error)
 	GetDeletedUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error)
+	// GetDeletedUserFilesTotals counts the user's trashed mappings and sums their sizes
+	// without loading them
+	GetDeletedUserFilesTotals(ctx context.Context, userID uuid.UUID) (count int, bytes int64, err error)
 	DeleteFileByID(ctx context.Context, fileID uuid.UUID) error
 	GetUserFileMappingStatus(ctx context.Context, userID, fileID uuid.UUID) (status string, err error)
 	UserHasActiveMapping(ctx context.Context, userID, fileID uuid.UUID) (bool, error)
@@ -42,9 +64,65 @@ type FileRepository interface {
 	GetUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) (*models.UserFile, error)
 	SoftDeleteUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) error
 	DeleteUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) error
-	SearchUserFiles(ctx context.Context, userID uuid.UUID, filter SearchFilter, page Page) (items []models.UserFile, nextCursor *string, total int, err error)
-	ListUserFilesInFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) ([]models.UserFile, error)
+	SearchUserFiles(ctx context.Context, userID uuid.UUID, filter SearchFilter, page Page) (items []models.UserFile, nextCursor *string, totals SearchTotals, err error)
+	// SuggestFilenames returns up to limit distinct names of the user's active files starting
+	// with prefix (case-insensitive), most recently used first
+	SuggestFilenames(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]string, error)
+	ListUserFilesInFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, sort FileSort) ([]models.UserFile, error)
 	MoveUserFileToFolder(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID, folderID *uuid.UUID) error
+	// GetUserMappingStates reports in one query, for each of mappingIDs that is the user's,
+	// whether it is active (true) or in the trash (false); other ids are left out
+	GetUserMappingStates(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) (map[uuid.UUID]bool, error)
+	// MoveUserFiles moves each of the user's active mappings in moves to its folder (nil for
+	// root) in one transaction. If any of them is missing, someone else's or in the trash,
+	// nothing moves and ErrMappingsNotMoved is returned
+	MoveUserFiles(ctx context.Context, userID uuid.UUID, moves map[uuid.UUID]*uuid.UUID) error
+	TouchUserFileAccess(ctx context.Context, userID, fileID uuid.UUID) error
+	// SetUserFileDescription sets the note on one of the user's active mappings; nil clears it.
+	// ErrNotFound is returned when the mapping is missing, trashed or someone else's
+	SetUserFileDescription(ctx context.Context, userID, mappingID uuid.UUID, description *string) error
+	// SetUserFileDisplayName sets the name one mapping is shown under instead of the content's
+	// original name; nil falls back to it. ErrNotFound when the mapping isn't the user's
+	SetUserFileDisplayName(ctx context.Context, userID, mappingID uuid.UUID, name *string) error
+	// SetUserFileRetention keeps a mapping, active or trashed, from being deleted until the
+	// given time; nil lifts it. ErrNotFound when the mapping doesn't exist
+	SetUserFileRetention(ctx context.Context, mappingID uuid.UUID, until *time.Time) error
+	// GetRetainedMappings returns every user's mappings of a file still under retention,
+	// with the time each retention ends
+	GetRetainedMappings(ctx context.Context, fileID uuid.UUID) (map[uuid.UUID]time.Time, error)
+	// SetUserFileVisibility sets the visibility of the user's active owner mappings of a file
+	SetUserFileVisibility(ctx context.Context, userID, fileID uuid.UUID, visibility string) error
+	// SetUserFileMappingVisibility sets the visibility of one of the user's mappings, leaving
+	// their other copies of the content alone
+	SetUserFileMappingVisibility(ctx context.Context, userID, mappingID uuid.UUID, visibility string) error
+	// SetFileStatus quarantines content with a reason or releases it back to active; false when the file is unknown
+	SetFileStatus(ctx context.Context, fileID uuid.UUID, status string, reason string) (bool, error)
+	// ListQuarantinedFiles lists quarantined content with its owner's mapping, oldest first
+	ListQuarantinedFiles(ctx context.Context) ([]models.UserFile, error)
+	// ReplaceFileObject points the file at a re-encrypted copy of its content under
+	// storagePath, but only while it is still stored at oldPath; false when it has moved
+	// meanwhile. The hash, and so deduplication, is unchanged
+	ReplaceFileObject(ctx context.Context, fileID uuid.UUID, oldPath, storagePath, keyID string, nonce []byte) (bool, error)
+	// ListFilesNotUnderKey returns up to limit files not encrypted under keyID, plaintext
+	// ones included, for a key rotation to re-encrypt
+	ListFilesNotUnderKey(ctx context.Context, keyID string, limit int) ([]models.File, error)
+	// MarkUserFilesAddedBy records that an editor of a shared folder added the owner's
+	// mappings among mappingIDs. Only mappings in folderID created or restored since the
+	// upload began are marked, so the owner's earlier copies never are
+	MarkUserFilesAddedBy(ctx context.Context, ownerID uuid.UUID, mappingIDs []uuid.UUID, folderID, addedBy uuid.UUID, since time.Time) error
+	// GetUserFileAddedBy returns the mapping, whoever owns it, if addedBy added it to a
+	// shared folder; nil otherwise
+	GetUserFileAddedBy(ctx context.Context, addedBy, mappingID uuid.UUID) (*models.UserFile, error)
+	// TransferFileOwnership hands fromUserID's owner mappings of fileID, and the shares they
+	// created of it, to toUserID, all or nothing. The previous owner's mappings become editor
+	// mappings when keepAsEditor and are deleted otherwise. The new owner's active mapping of
+	// the file is promoted, or a root mapping named and visible like the previous owner's is
+	// added, and any share of the file with toEmail is dropped. ErrNotFound when fromUserID
+	// doesn't own the file, and ErrRetained when their copies would be deleted while one is
+	// under retention. Unless toUserID already owns a copy, the file must fit in quota bytes
+	// of owned content, checked in the same transaction; ErrOverQuota otherwise. A negative
+	// quota skips the check
+	TransferFileOwnership(ctx context.Context, fromUserID, toUserID uuid.UUID, toEmail string, fileID uuid.UUID, keepAsEditor bool, quota int64) error
 }
 
 type fileRepository struct {
@@ -57,7 +135,9 @@ func NewFileRepository(db *pgxpool.Pool) FileRepository {
 
 // Search filters and pagination
 type SearchFilter struct {
-	Filename      *string
+	Filename *string
+	// FilenameMatch selects how Filename is compared; the zero value matches substrings
+	FilenameMatch FilenameMatch
 	MimeTypes     []string
 	SizeMin       *int64
 	SizeMax       *int64
@@ -65,56 +145,199 @@ type SearchFilter struct {
 	CreatedBefore *time.Time
 	Tags          []string
 	UploaderName  *string
+	// Scope restricts results by folder; the zero value searches everything
+	Scope SearchScope
+	// FolderID is the subtree searched when Scope is ScopeFolder
+	FolderID *uuid.UUID
+}
+
+// SearchScope selects which folders a search covers
+type SearchScope string
+
+const (
+	// ScopeAll searches every active file regardless of folder (default)
+	ScopeAll SearchScope = "all"
+	// ScopeFolder searches a folder and all of its subfolders
+	ScopeFolder SearchScope = "folder"
+	// ScopeRoot searches only files that are not in any folder
+	ScopeRoot SearchScope = "root"
+)
+
+// scopeCondition returns the WHERE clause for the filter's folder scope, or "" for ScopeAll.
+// arg registers a query argument and returns its placeholder; $1 is the user id.
+func scopeCondition(filter SearchFilter, arg func(interface{}) string) (string, error) {
+	switch filter.Scope {
+	case "", ScopeAll:
+		return "", nil
+	case ScopeRoot:
+		return "b.folder_id IS NULL", nil
+	case ScopeFolder:
+		if filter.FolderID == nil {
+			return "", fmt.Errorf("folder scope requires a folder id")
+		}
+		return `b.folder_id IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM folders WHERE id = ` + arg(*filter.FolderID) + ` AND user_id = $1
+			UNION ALL
+			SELECT fo.id FROM folders fo JOIN subtree st ON fo.parent_id = st.id WHERE fo.user_id = $1
+		)
+		SELECT id FROM subtree)`, nil
+	}
+	return "", fmt.Errorf("unknown search scope %q", filter.Scope)
+}
+
+// FilenameMatch selects how a filename filter is compared to stored names
+type FilenameMatch string
+
+const (
+	// MatchContains finds names containing the filter anywhere (default)
+	MatchContains FilenameMatch = "contains"
+	// MatchPrefix finds names starting with the filter, for autocomplete
+	MatchPrefix FilenameMatch = "prefix"
+	// MatchExact finds names equal to the filter
+	MatchExact FilenameMatch = "exact"
+)
+
+// searchNameSQL is the name a search row is shown and matched under: the mapping's own
+// display name, or the content's original name when it has none. Matching the shared
+// original_name instead would find files by another user's name for the same content.
+const searchNameSQL = "COALESCE(b.display_name, f.original_name)"
+
+// filenameCondition returns the WHERE clause for the filter's filename, or "" without one.
+// All modes ignore case and match the name the user sees (searchNameSQL). The search is
+// already limited to the user's own mappings, so the name is compared per row rather than
+// through the indexes on files.original_name, which don't know about renames.
+func filenameCondition(filter SearchFilter, arg func(interface{}) string) (string, error) {
+	if filter.Filename == nil || *filter.Filename == "" {
+		return "", nil
+	}
+	name := *filter.Filename
+	switch filter.FilenameMatch {
+	case "", MatchContains:
+		return fmt.Sprintf("%s ILIKE '%%' || %s || '%%'", searchNameSQL, arg(name)), nil
+	case MatchPrefix:
+		return fmt.Sprintf("lower(%s) LIKE %s", searchNameSQL, arg(likePrefix(strings.ToLower(name)))), nil
+	case MatchExact:
+		return fmt.Sprintf("lower(%s) = %s", searchNameSQL, arg(strings.ToLower(name))), nil
+	}
+	return "", fmt.Errorf("unknown filename match %q", filter.FilenameMatch)
+}
+
+// likePrefix escapes LIKE wildcards in s and appends %, so s matches only literally
+// at the start of a value.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
 }
 
 type Page struct {
 	Limit  int
 	Cursor *string
+	Sort   FileSort
+	// WithTotalBytes also sums the sizes of all matching files, at the cost of an aggregate
+	WithTotalBytes bool
+}
+
+// SearchTotals describes the whole set a search matched, across all pages
+type SearchTotals struct {
+	Count int
+	// Bytes is the summed size of the matching files; only set when Page.WithTotalBytes
+	Bytes int64
 }
 
+// UsageTotals is a user's storage usage as GetUserUsageTotals reads it
+type UsageTotals struct {
+	// LogicalBytes counts each distinct file the user stores once, at full size
+	LogicalBytes int64
+	// AttributedBytes shares each file's size among all mappings referencing it
+	AttributedBytes int64
+	// FileCount counts the user's active mappings
+	FileCount int
+	// QuotaOverride is the user's row in user_quotas; nil when the default applies
+	QuotaOverride *int64
+}
+
+// FileSort selects the ordering of file listings
+type FileSort string
+
+const (
+	// SortByUploadedAt orders newest uploads first (default)
+	SortByUploadedAt FileSort = "uploaded_at"
+	// SortByLastAccessed orders by the user's own last preview/download, never-opened files last
+	SortByLastAccessed FileSort = "last_accessed_at"
+)
+
 // Find file by hash
 func (r *fileRepository) FindByHash(ctx context.Context, hash string) (*models.File, error) {
-	query := `SELECT id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at 
+	query := `SELECT id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at, status,
+	                 COALESCE(encryption_key_id, ''), encryption_nonce
 	          FROM files WHERE hash=$1`
 	row := r.DB.QueryRow(ctx, query, hash)
 	file := &models.File{}
 	err := row.Scan(&file.ID, &file.Hash, &file.StoragePath, &file.OriginalName, &file.MimeType,
-		&file.Size, &file.RefCount, &file.Visibility, &file.CreatedAt)
+		&file.Size, &file.RefCount, &file.Visibility, &file.CreatedAt, &file.Status,
+		&file.EncryptionKeyID, &file.EncryptionNonce)
 	if err != nil {
-		return nil, err
+		return nil, lookupErr("file", err)
 	}
 	return file, nil
 }
 
 // Get file by ID
 func (r *fileRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.File, error) {
-	row := r.DB.QueryRow(ctx, `SELECT id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at FROM files WHERE id=$1`, id)
+	row := r.DB.QueryRow(ctx, `SELECT id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at, status, COALESCE(quarantine_reason, ''), quarantined_at, COALESCE(encryption_key_id, ''), encryption_nonce FROM files WHERE id=$1`, id)
 	var f models.File
-	if err := row.Scan(&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt); err != nil {
-		return nil, err
+	if err := row.Scan(&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status, &f.QuarantineReason, &f.QuarantinedAt, &f.EncryptionKeyID, &f.EncryptionNonce); err != nil {
+		return nil, lookupErr("file "+id.String(), err)
 	}
 	return &f, nil
 }
 
+func (r *fileRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.File, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := r.DB.Query(ctx, `SELECT id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at, status, COALESCE(quarantine_reason, ''), quarantined_at, COALESCE(encryption_key_id, ''), encryption_nonce FROM files WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.File
+	for rows.Next() {
+		var f models.File
+		if err := rows.Scan(&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status, &f.QuarantineReason, &f.QuarantinedAt, &f.EncryptionKeyID, &f.EncryptionNonce); err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
+
 // Create file
 func (r *fileRepository) CreateFile(ctx context.Context, file *models.File) error {
-	query := `INSERT INTO files (id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at)
-	          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	status := file.Status
+	if status == "" {
+		status = models.FileStatusActive
+	}
+	query := `INSERT INTO files (id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at,
+	                             status, quarantine_reason, quarantined_at, encryption_key_id, encryption_nonce)
+	          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,NULLIF($11, ''),$12,NULLIF($13, ''),$14)`
 	_, err := r.DB.Exec(ctx, query, file.ID, file.Hash, file.StoragePath, file.OriginalName,
-		file.MimeType, file.Size, file.RefCount, file.Visibility, time.Now())
-	return err
-}
-
-// Increment ref_count
-func (r *fileRepository) IncrementRefCount(ctx context.Context, fileID uuid.UUID) error {
-	_, err := r.DB.Exec(ctx, `UPDATE files SET ref_count = ref_count + 1 WHERE id=$1`, fileID)
+		file.MimeType, file.Size, file.RefCount, file.Visibility, time.Now(),
+		status, file.QuarantineReason, file.QuarantinedAt, file.EncryptionKeyID, file.EncryptionNonce)
 	return err
 }
 
-// Decrement ref_count
-func (r *fileRepository) DecrementRefCount(ctx context.Context, fileID uuid.UUID) error {
-	_, err := r.DB.Exec(ctx, `UPDATE files SET ref_count = GREATEST(ref_count - 1, 0) WHERE id=$1`, fileID)
-	return err
+// CountFileMappings counts mappings straight from user_files so purge decisions never
+// depend on a stored counter. Soft-deleted mappings keep the object alive for recovery,
+// so storage may only be released once total reaches zero.
+func (r *fileRepository) CountFileMappings(ctx context.Context, fileID uuid.UUID) (int, int, error) {
+	var active, total int
+	err := r.DB.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE deleted_at IS NULL), COUNT(*)
+		FROM user_files WHERE file_id=$1
+	`, fileID).Scan(&active, &total)
+	return active, total, err
 }
 
 // Map file to user
@@ -123,7 +346,7 @@ func (r *fileRepository) AddUserFile(ctx context.Context, userID, fileID uuid.UU
 	var restoredID uuid.UUID
 	err := r.DB.QueryRow(ctx, `
 		UPDATE user_files uf
-		SET deleted_at = NULL, uploaded_at = $3, role = $4
+		SET deleted_at = NULL, uploaded_at = $3, role = $4, folder_id = `+recoveredFolderSQL+`
 		WHERE uf.id = (
 			SELECT id FROM user_files
 			WHERE user_id = $1 AND file_id = $2 AND deleted_at IS NOT NULL
@@ -207,15 +430,11 @@ func (r *fileRepository) CreateUserFileMappingWithFolder(ctx context.Context, us
 
 // Get all files of a user
 func (r *fileRepository) GetUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error) {
-	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					 f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-					 COALESCE(u.email, gu.email, '') AS uploader_email,
-					 NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					 NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id, COALESCE(uf.description, ''),
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at,
+					 ` + profileColumns("u", "uploader") + `
 			  FROM user_files uf
-			  JOIN files f ON uf.file_id=f.id
-			  LEFT JOIN users u ON uf.user_id = u.id
-			  LEFT JOIN google_users gu ON uf.user_id = gu.id
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 			  WHERE uf.user_id=$1 AND uf.deleted_at IS NULL`
 	rows, err := r.DB.Query(ctx, query, userID)
 	if err != nil {
@@ -227,7 +446,7 @@ func (r *fileRepository) GetUserFiles(ctx context.Context, userID uuid.UUID) ([]
 	for rows.Next() {
 		var uf models.UserFile
 		var f models.File
-		err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
+		err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID, &uf.Description,
 			&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
 			&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture)
 		if err != nil {
@@ -270,12 +489,16 @@ func (r *fileRepository) MarkUserFileDeleted(ctx context.Context, userID, fileID
 	return err
 }
 
+// recoveredFolderSQL keeps a recovered file in its folder unless the folder is in the trash
+// itself, in which case the file comes back at the root
+const recoveredFolderSQL = `(SELECT fo.id FROM folders fo WHERE fo.id = uf.folder_id AND fo.deleted_at IS NULL)`
+
 // RecoverUserFile recovers a soft-deleted file by setting deleted_at to NULL
 func (r *fileRepository) RecoverUserFile(ctx context.Context, userID, fileID uuid.UUID) error {
 	// Recover only one (the most recent) deleted mapping
 	_, err := r.DB.Exec(ctx, `
 		UPDATE user_files uf
-		SET deleted_at = NULL
+		SET deleted_at = NULL, folder_id = `+recoveredFolderSQL+`
 		WHERE uf.id = (
 			SELECT id FROM user_files
 			WHERE user_id=$1 AND file_id=$2 AND deleted_at IS NOT NULL
@@ -286,17 +509,48 @@ func (r *fileRepository) RecoverUserFile(ctx context.Context, userID, fileID uui
 	return err
 }
 
+// recoverBatchSize bounds the ids restored by one statement of RecoverUserFilesByMappingIDs
+const recoverBatchSize = 500
+
+func (r *fileRepository) RecoverUserFilesByMappingIDs(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) ([]uuid.UUID, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var restored []uuid.UUID
+	for start := 0; start < len(mappingIDs); start += recoverBatchSize {
+		end := min(start+recoverBatchSize, len(mappingIDs))
+		// ref_count follows through the user_files trigger, row by row
+		rows, err := tx.Query(ctx, `
+			UPDATE user_files uf SET deleted_at = NULL, folder_id = `+recoveredFolderSQL+`
+			WHERE uf.user_id = $1 AND uf.id = ANY($2) AND uf.deleted_at IS NOT NULL
+			  AND EXISTS (SELECT 1 FROM files f WHERE f.id = uf.file_id)
+			RETURNING uf.id
+		`, userID, mappingIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return nil, err
+		}
+		restored = append(restored, ids...)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
 // GetDeletedUserFiles returns soft-deleted mappings
 func (r *fileRepository) GetDeletedUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error) {
 	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					 f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-					 COALESCE(u.email, gu.email, '') AS uploader_email,
-					 NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					 NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at,
+					 ` + profileColumns("u", "uploader") + `
 			  FROM user_files uf
-			  JOIN files f ON uf.file_id=f.id
-			  LEFT JOIN users u ON uf.user_id = u.id
-			  LEFT JOIN google_users gu ON uf.user_id = gu.id
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 			  WHERE uf.user_id=$1 AND uf.deleted_at IS NOT NULL`
 	rows, err := r.DB.Query(ctx, query, userID)
 	if err != nil {
@@ -318,19 +572,45 @@ func (r *fileRepository) GetDeletedUserFiles(ctx context.Context, userID uuid.UU
 	return result, nil
 }
 
+func (r *fileRepository) GetDeletedUserFilesTotals(ctx context.Context, userID uuid.UUID) (int, int64, error) {
+	var count int
+	var bytes int64
+	err := r.DB.QueryRow(ctx, `SELECT COUNT(*), COALESCE(SUM(f.size), 0)
+			  FROM user_files uf
+			  JOIN files f ON uf.file_id=f.id
+			  WHERE uf.user_id=$1 AND uf.deleted_at IS NOT NULL`, userID).Scan(&count, &bytes)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, bytes, nil
+}
+
 // DeleteFileByID hard-deletes file row
 func (r *fileRepository) DeleteFileByID(ctx context.Context, fileID uuid.UUID) error {
 	_, err := r.DB.Exec(ctx, `DELETE FROM files WHERE id=$1`, fileID)
 	return err
 }
 
+// GetUserQuota returns the user's quota override, or nil when user_quotas has no row for them
+func (r *fileRepository) GetUserQuota(ctx context.Context, userID uuid.UUID) (*int64, error) {
+	var quota int64
+	err := r.DB.QueryRow(ctx, `SELECT quota_bytes FROM user_quotas WHERE user_id = $1`, userID).Scan(&quota)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
 // GetUserUsageSum returns total bytes used by a user (sum of sizes of their files)
 func (r *fileRepository) GetUserUsageSum(ctx context.Context, userID uuid.UUID) (int64, error) {
 	row := r.DB.QueryRow(ctx, `
 		SELECT COALESCE(SUM(f.size),0)
 		FROM files f
 		JOIN (
-			SELECT DISTINCT file_id FROM user_files WHERE user_id=$1 AND deleted_at IS NULL
+			SELECT DISTINCT file_id FROM user_files WHERE user_id=$1 AND deleted_at IS NULL AND role <> 'editor'
 		) d ON d.file_id = f.id
 	`, userID)
 	var sum int64
@@ -340,14 +620,16 @@ func (r *fileRepository) GetUserUsageSum(ctx context.Context, userID uuid.UUID)
 	return sum, nil
 }
 
-// GetUserAttributedUsage returns user's attributed physical storage usage (sum of size/ref_count per file mapping)
+// GetUserAttributedUsage returns user's attributed physical storage usage (sum of size/ref_count per file mapping).
+// Like the other usage sums it leaves out editor mappings: files the user handed to a new
+// owner, which count against that owner instead.
 func (r *fileRepository) GetUserAttributedUsage(ctx context.Context, userID uuid.UUID) (int64, error) {
 	// Use integer division for bytes; protects against division by zero with GREATEST
 	row := r.DB.QueryRow(ctx, `
 		SELECT COALESCE(SUM(f.size / GREATEST(f.ref_count, 1)), 0)
 		FROM user_files uf
 		JOIN files f ON uf.file_id = f.id
-		WHERE uf.user_id = $1 AND uf.deleted_at IS NULL
+		WHERE uf.user_id = $1 AND uf.deleted_at IS NULL AND uf.role <> 'editor'
 	`, userID)
 	var sum int64
 	if err := row.Scan(&sum); err != nil {
@@ -356,25 +638,45 @@ func (r *fileRepository) GetUserAttributedUsage(ctx context.Context, userID uuid
 	return sum, nil
 }
 
+// GetUserUsageTotals reads the user's usage in one round trip: the logical bytes as in
+// GetUserUsageSum, the attributed bytes as in GetUserAttributedUsage and the mapping count
+// over the same rows, with the quota override alongside
+func (r *fileRepository) GetUserUsageTotals(ctx context.Context, userID uuid.UUID) (UsageTotals, error) {
+	row := r.DB.QueryRow(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(d.size) FROM (
+				SELECT DISTINCT f.id, f.size FROM user_files uf JOIN files f ON uf.file_id = f.id
+				WHERE uf.user_id = $1 AND uf.deleted_at IS NULL AND uf.role <> 'editor'
+			) d), 0),
+			COALESCE(SUM(f.size / GREATEST(f.ref_count, 1)), 0),
+			COUNT(uf.id),
+			(SELECT quota_bytes FROM user_quotas WHERE user_id = $1)
+		FROM user_files uf
+		JOIN files f ON uf.file_id = f.id
+		WHERE uf.user_id = $1 AND uf.deleted_at IS NULL AND uf.role <> 'editor'
+	`, userID)
+	var t UsageTotals
+	if err := row.Scan(&t.LogicalBytes, &t.AttributedBytes, &t.FileCount, &t.QuotaOverride); err != nil {
+		return UsageTotals{}, err
+	}
+	return t, nil
+}
+
 // FindUserFileByHash locates a file mapping for a user by content hash
 func (r *fileRepository) FindUserFileByHash(ctx context.Context, userID uuid.UUID, hash string) (*models.UserFile, error) {
 	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					 f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-			COALESCE(u.email, gu.email, '') AS uploader_email,
-					 NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					 NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at, f.status,
+					 ` + profileColumns("u", "uploader") + `
 			  FROM user_files uf
-			  JOIN files f ON uf.file_id=f.id
-			  LEFT JOIN users u ON uf.user_id = u.id
-			  LEFT JOIN google_users gu ON uf.user_id = gu.id
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 		WHERE uf.user_id=$1 AND f.hash=$2 AND uf.deleted_at IS NULL`
 	row := r.DB.QueryRow(ctx, query, userID, hash)
 	var uf models.UserFile
 	var f models.File
 	if err := row.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
-		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
+		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status,
 		&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture); err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
@@ -385,23 +687,19 @@ func (r *fileRepository) FindUserFileByHash(ctx context.Context, userID uuid.UUI
 
 // GetUserFileByFileID locates a user-file mapping and joins file by file ID
 func (r *fileRepository) GetUserFileByFileID(ctx context.Context, userID, fileID uuid.UUID) (*models.UserFile, error) {
-	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					 f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-					 COALESCE(u.email, gu.email, '') AS uploader_email,
-					 NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					 NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id, COALESCE(uf.description, ''),
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at, f.status,
+					 ` + profileColumns("u", "uploader") + `
 			  FROM user_files uf
-			  JOIN files f ON uf.file_id=f.id
-			  LEFT JOIN users u ON uf.user_id = u.id
-			  LEFT JOIN google_users gu ON uf.user_id = gu.id
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 			  WHERE uf.user_id=$1 AND uf.file_id=$2`
 	row := r.DB.QueryRow(ctx, query, userID, fileID)
 	var uf models.UserFile
 	var f models.File
-	if err := row.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
-		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
+	if err := row.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID, &uf.Description,
+		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status,
 		&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture); err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
@@ -410,17 +708,54 @@ func (r *fileRepository) GetUserFileByFileID(ctx context.Context, userID, fileID
 	return &uf, nil
 }
 
+// GetUserFilesByFileIDs loads several files at once, one mapping per file
+func (r *fileRepository) GetUserFilesByFileIDs(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]models.UserFile, error) {
+	if len(fileIDs) == 0 {
+		return nil, nil
+	}
+	query := `SELECT DISTINCT ON (uf.file_id)
+					 uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id, COALESCE(uf.description, ''),
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at, f.status,
+					 ` + profileColumns("u", "uploader") + `
+			  FROM user_files uf
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
+			  WHERE uf.user_id=$1 AND uf.file_id = ANY($2) AND uf.deleted_at IS NULL
+			  ORDER BY uf.file_id, uf.uploaded_at DESC`
+	rows, err := r.DB.Query(ctx, query, userID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.UserFile
+	for rows.Next() {
+		var uf models.UserFile
+		var f models.File
+		var name, picture *string
+		if err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID, &uf.Description,
+			&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status,
+			&uf.UploaderEmail, &name, &picture); err != nil {
+			return nil, err
+		}
+		if name != nil {
+			uf.UploaderName = *name
+		}
+		if picture != nil {
+			uf.UploaderPicture = *picture
+		}
+		uf.File = f
+		result = append(result, uf)
+	}
+	return result, rows.Err()
+}
+
 // GetOwnerByFileID locates the owner of a file (user with role='owner')
 func (r *fileRepository) GetOwnerByFileID(ctx context.Context, fileID uuid.UUID) (*models.UserFile, error) {
 	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					 f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-					 COALESCE(u.email, gu.email, '') AS uploader_email,
-					 NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					 NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at,
+					 ` + profileColumns("u", "uploader") + `
 			  FROM user_files uf
-			  JOIN files f ON uf.file_id=f.id
-			  LEFT JOIN users u ON uf.user_id = u.id
-			  LEFT JOIN google_users gu ON uf.user_id = gu.id
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 			  WHERE uf.file_id=$1 AND uf.role='owner' 
 			  LIMIT 1`
 	row := r.DB.QueryRow(ctx, query, fileID)
@@ -429,7 +764,7 @@ func (r *fileRepository) GetOwnerByFileID(ctx context.Context, fileID uuid.UUID)
 	if err := row.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
 		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
 		&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture); err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
@@ -440,23 +775,19 @@ func (r *fileRepository) GetOwnerByFileID(ctx context.Context, fileID uuid.UUID)
 
 // GetUserFileByMappingID fetches a mapping by its id
 func (r *fileRepository) GetUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) (*models.UserFile, error) {
-	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					 f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-					 COALESCE(u.email, gu.email, '') AS uploader_email,
-					 NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					 NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+	query := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id, uf.deleted_at, COALESCE(uf.description, ''),
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at, f.status,
+					 ` + profileColumns("u", "uploader") + `
 			  FROM user_files uf
-			  JOIN files f ON uf.file_id=f.id
-			  LEFT JOIN users u ON uf.user_id = u.id
-			  LEFT JOIN google_users gu ON uf.user_id = gu.id
+			  JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 			  WHERE uf.user_id=$1 AND uf.id=$2`
 	row := r.DB.QueryRow(ctx, query, userID, mappingID)
 	var uf models.UserFile
 	var f models.File
-	if err := row.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
-		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
+	if err := row.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID, &uf.DeletedAt, &uf.Description,
+		&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status,
 		&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture); err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
@@ -466,23 +797,23 @@ func (r *fileRepository) GetUserFileByMappingID(ctx context.Context, userID uuid
 }
 
 // ListUserFilesInFolder lists active mappings within a folder (nil folder for root)
-func (r *fileRepository) ListUserFilesInFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) ([]models.UserFile, error) {
-	base := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
-					f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-					COALESCE(u.email, gu.email, '') AS uploader_email,
-					NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-					NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
+func (r *fileRepository) ListUserFilesInFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, sort FileSort) ([]models.UserFile, error) {
+	base := `SELECT uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id, uf.last_accessed_at, COALESCE(uf.description, ''),
+					f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at,
+					` + profileColumns("u", "uploader") + `
 			 FROM user_files uf
-			 JOIN files f ON uf.file_id=f.id
-			 LEFT JOIN users u ON uf.user_id = u.id
-			 LEFT JOIN google_users gu ON uf.user_id = gu.id
+			 JOIN files f ON uf.file_id=f.id` + accountJoin("u", "uf.user_id") + `
 			 WHERE uf.user_id=$1 AND uf.deleted_at IS NULL`
+	orderBy := " ORDER BY uf.uploaded_at DESC"
+	if sort == SortByLastAccessed {
+		orderBy = " ORDER BY uf.last_accessed_at DESC NULLS LAST, uf.uploaded_at DESC"
+	}
 	var rows pgx.Rows
 	var err error
 	if folderID == nil {
-		rows, err = r.DB.Query(ctx, base+" AND uf.folder_id IS NULL", userID)
+		rows, err = r.DB.Query(ctx, base+" AND uf.folder_id IS NULL"+orderBy, userID)
 	} else {
-		rows, err = r.DB.Query(ctx, base+" AND uf.folder_id=$2", userID, *folderID)
+		rows, err = r.DB.Query(ctx, base+" AND uf.folder_id=$2"+orderBy, userID, *folderID)
 	}
 	if err != nil {
 		return nil, err
@@ -492,7 +823,7 @@ func (r *fileRepository) ListUserFilesInFolder(ctx context.Context, userID uuid.
 	for rows.Next() {
 		var uf models.UserFile
 		var f models.File
-		if err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
+		if err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID, &uf.LastAccessedAt, &uf.Description,
 			&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
 			&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture); err != nil {
 			return nil, err
@@ -513,6 +844,370 @@ func (r *fileRepository) MoveUserFileToFolder(ctx context.Context, userID uuid.U
 	return err
 }
 
+// GetUserMappingStates reports which of mappingIDs are the user's, and whether each is active
+func (r *fileRepository) GetUserMappingStates(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id, deleted_at IS NULL FROM user_files
+		WHERE user_id = $1 AND id = ANY($2)
+	`, userID, mappingIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := make(map[uuid.UUID]bool, len(mappingIDs))
+	for rows.Next() {
+		var id uuid.UUID
+		var active bool
+		if err := rows.Scan(&id, &active); err != nil {
+			return nil, err
+		}
+		states[id] = active
+	}
+	return states, rows.Err()
+}
+
+// MoveUserFiles moves mappings to their folders atomically, one statement per destination;
+// if fewer rows than requested are updated the transaction is rolled back
+func (r *fileRepository) MoveUserFiles(ctx context.Context, userID uuid.UUID, moves map[uuid.UUID]*uuid.UUID) error {
+	byFolder := make(map[uuid.UUID][]uuid.UUID)
+	for mappingID, folderID := range moves {
+		key := uuid.Nil
+		if folderID != nil {
+			key = *folderID
+		}
+		byFolder[key] = append(byFolder[key], mappingID)
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var moved int64
+	for key, mappingIDs := range byFolder {
+		var folderID *uuid.UUID
+		if key != uuid.Nil {
+			folderID = &key
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE user_files SET folder_id = $1
+			WHERE user_id = $2 AND id = ANY($3) AND deleted_at IS NULL
+		`, folderID, userID, mappingIDs)
+		if err != nil {
+			return err
+		}
+		moved += tag.RowsAffected()
+	}
+	if moved != int64(len(moves)) {
+		return ErrMappingsNotMoved
+	}
+	return tx.Commit(ctx)
+}
+
+// TouchUserFileAccess stamps last_accessed_at on the user's active mappings for a file
+func (r *fileRepository) TouchUserFileAccess(ctx context.Context, userID, fileID uuid.UUID) error {
+	_, err := r.DB.Exec(ctx, `UPDATE user_files SET last_accessed_at = NOW() WHERE user_id=$1 AND file_id=$2 AND deleted_at IS NULL`, userID, fileID)
+	return err
+}
+
+// SetUserFileDescription sets or, with nil, clears the note on one of the user's active mappings
+func (r *fileRepository) SetUserFileDescription(ctx context.Context, userID, mappingID uuid.UUID, description *string) error {
+	ct, err := r.DB.Exec(ctx, `UPDATE user_files SET description=$3 WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, mappingID, userID, description)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("file %s: %w", mappingID, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *fileRepository) SetUserFileDisplayName(ctx context.Context, userID, mappingID uuid.UUID, name *string) error {
+	ct, err := r.DB.Exec(ctx, `UPDATE user_files SET display_name=$3 WHERE id=$1 AND user_id=$2`, mappingID, userID, name)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("file %s: %w", mappingID, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *fileRepository) SetUserFileRetention(ctx context.Context, mappingID uuid.UUID, until *time.Time) error {
+	ct, err := r.DB.Exec(ctx, `UPDATE user_files SET retain_until=$2 WHERE id=$1`, mappingID, until)
+	if err != nil {
+		return fmt.Errorf("failed to set retention: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("file %s: %w", mappingID, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *fileRepository) GetRetainedMappings(ctx context.Context, fileID uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	rows, err := r.DB.Query(ctx, `SELECT id, retain_until FROM user_files WHERE file_id=$1 AND retain_until > NOW()`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retention: %w", err)
+	}
+	defer rows.Close()
+	retained := map[uuid.UUID]time.Time{}
+	for rows.Next() {
+		var id uuid.UUID
+		var until time.Time
+		if err := rows.Scan(&id, &until); err != nil {
+			return nil, err
+		}
+		retained[id] = until
+	}
+	return retained, rows.Err()
+}
+
+// SetUserFileVisibility sets the visibility on the user's active owner mappings for a file
+func (r *fileRepository) SetUserFileVisibility(ctx context.Context, userID, fileID uuid.UUID, visibility string) error {
+	_, err := r.DB.Exec(ctx, `UPDATE user_files SET visibility=$3 WHERE user_id=$1 AND file_id=$2 AND role='owner' AND deleted_at IS NULL`, userID, fileID, visibility)
+	return err
+}
+
+// SetUserFileMappingVisibility sets the visibility on a single mapping
+func (r *fileRepository) SetUserFileMappingVisibility(ctx context.Context, userID, mappingID uuid.UUID, visibility string) error {
+	ct, err := r.DB.Exec(ctx, `UPDATE user_files SET visibility=$3 WHERE id=$1 AND user_id=$2`, mappingID, userID, visibility)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("file %s: %w", mappingID, ErrNotFound)
+	}
+	return nil
+}
+
+// ReplaceFileObject swaps the file's object location and encryption in one conditional update
+func (r *fileRepository) ReplaceFileObject(ctx context.Context, fileID uuid.UUID, oldPath, storagePath, keyID string, nonce []byte) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE files SET storage_path = $3, encryption_key_id = NULLIF($4, ''), encryption_nonce = $5
+		WHERE id = $1 AND storage_path = $2
+	`, fileID, oldPath, storagePath, keyID, nonce)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListFilesNotUnderKey lists files stored as plaintext or under another key, oldest first
+func (r *fileRepository) ListFilesNotUnderKey(ctx context.Context, keyID string, limit int) ([]models.File, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id, hash, storage_path, original_name, mime_type, size, ref_count, visibility, created_at, status,
+		       COALESCE(encryption_key_id, ''), encryption_nonce
+		FROM files
+		WHERE encryption_key_id IS DISTINCT FROM $1
+		ORDER BY created_at
+		LIMIT $2
+	`, keyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.File
+	for rows.Next() {
+		var f models.File
+		if err := rows.Scan(&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt, &f.Status,
+			&f.EncryptionKeyID, &f.EncryptionNonce); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// MarkUserFilesAddedBy sets added_by on the owner's freshly added copies in the folder
+func (r *fileRepository) MarkUserFilesAddedBy(ctx context.Context, ownerID uuid.UUID, mappingIDs []uuid.UUID, folderID, addedBy uuid.UUID, since time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE user_files SET added_by = $4
+		WHERE user_id = $1 AND id = ANY($2) AND folder_id = $3 AND uploaded_at >= $5
+	`, ownerID, mappingIDs, folderID, addedBy, since)
+	return err
+}
+
+// GetUserFileAddedBy looks a mapping up by id and the editor who added it
+func (r *fileRepository) GetUserFileAddedBy(ctx context.Context, addedBy, mappingID uuid.UUID) (*models.UserFile, error) {
+	var uf models.UserFile
+	err := r.DB.QueryRow(ctx, `
+		SELECT id, user_id, file_id, role, uploaded_at, folder_id, deleted_at
+		FROM user_files
+		WHERE id = $1 AND added_by = $2
+	`, mappingID, addedBy).Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID, &uf.DeletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &uf, nil
+}
+
+// transferQuotaSQL reports whether fileID fits in $3 bytes of $1's owned content: always
+// when they already own a copy, else when their usage (as GetUserUsageSum sums it) plus
+// the file's size stays within it.
+const transferQuotaSQL = `
+	SELECT EXISTS (
+		SELECT 1 FROM user_files
+		WHERE user_id = $1 AND file_id = $2 AND deleted_at IS NULL AND role <> 'editor'
+	) OR (
+		SELECT COALESCE(SUM(f.size), 0)
+		FROM files f
+		JOIN (
+			SELECT DISTINCT file_id FROM user_files WHERE user_id = $1 AND deleted_at IS NULL AND role <> 'editor'
+		) d ON d.file_id = f.id
+	) + (SELECT size FROM files WHERE id = $2) <= $3`
+
+func (r *fileRepository) TransferFileOwnership(ctx context.Context, fromUserID, toUserID uuid.UUID, toEmail string, fileID uuid.UUID, keepAsEditor bool, quota int64) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, display_name, visibility, COALESCE(retain_until > NOW(), false) FROM user_files
+		WHERE user_id = $1 AND file_id = $2 AND role = 'owner' AND deleted_at IS NULL
+		ORDER BY uploaded_at DESC
+		FOR UPDATE
+	`, fromUserID, fileID)
+	if err != nil {
+		return err
+	}
+	var ids []uuid.UUID
+	var displayName *string
+	var visibility string
+	retained := false
+	for rows.Next() {
+		var id uuid.UUID
+		var name *string
+		var vis string
+		var held bool
+		if err := rows.Scan(&id, &name, &vis, &held); err != nil {
+			rows.Close()
+			return err
+		}
+		if len(ids) == 0 {
+			displayName, visibility = name, vis
+		}
+		ids = append(ids, id)
+		retained = retained || held
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("file %s: %w", fileID, ErrNotFound)
+	}
+	if retained && !keepAsEditor {
+		return fmt.Errorf("file %s: %w", fileID, ErrRetained)
+	}
+
+	if quota >= 0 {
+		// Transfers to the same user queue here, so two of them can't both fit the same room
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1::text, 0))`, toUserID); err != nil {
+			return err
+		}
+		var fits bool
+		if err := tx.QueryRow(ctx, transferQuotaSQL, toUserID, fileID, quota).Scan(&fits); err != nil {
+			return err
+		}
+		if !fits {
+			return fmt.Errorf("file %s: %w", fileID, ErrOverQuota)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE user_files SET role = 'owner'
+		WHERE user_id = $1 AND file_id = $2 AND deleted_at IS NULL
+	`, toUserID, fileID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO user_files (id, user_id, file_id, role, uploaded_at, display_name, visibility)
+			VALUES ($1, $2, $3, 'owner', $4, $5, $6)
+		`, uuid.New(), toUserID, fileID, time.Now(), displayName, visibility); err != nil {
+			return err
+		}
+	}
+
+	if keepAsEditor {
+		_, err = tx.Exec(ctx, `UPDATE user_files SET role = 'editor' WHERE id = ANY($1)`, ids)
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM user_files WHERE id = ANY($1)`, ids)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM file_shares WHERE file_id = $1 AND LOWER(shared_with_email) = LOWER($2)`, fileID, toEmail); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE file_shares SET owner_id = $3 WHERE file_id = $1 AND owner_id = $2`, fileID, fromUserID, toUserID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SetFileStatus sets a file's status; the quarantine reason and time are kept only while quarantined
+func (r *fileRepository) SetFileStatus(ctx context.Context, fileID uuid.UUID, status string, reason string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE files SET status = $2,
+			quarantine_reason = CASE WHEN $2 = 'quarantined' THEN NULLIF($3, '') END,
+			quarantined_at = CASE WHEN $2 = 'quarantined' THEN COALESCE(quarantined_at, NOW()) END
+		WHERE id = $1`, fileID, status, reason)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListQuarantinedFiles returns every quarantined file joined with its first owner mapping
+func (r *fileRepository) ListQuarantinedFiles(ctx context.Context) ([]models.UserFile, error) {
+	query := `SELECT DISTINCT ON (f.quarantined_at, f.id)
+					 uf.id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.folder_id,
+					 f.id, f.hash, f.storage_path, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at,
+					 f.status, COALESCE(f.quarantine_reason, ''), f.quarantined_at,
+					 ` + profileColumns("u", "uploader") + `
+			  FROM files f
+			  JOIN user_files uf ON uf.file_id = f.id AND uf.role = 'owner'` + accountJoin("u", "uf.user_id") + `
+			  WHERE f.status = 'quarantined'
+			  ORDER BY f.quarantined_at, f.id, uf.uploaded_at`
+	rows, err := r.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.UserFile
+	for rows.Next() {
+		var uf models.UserFile
+		var f models.File
+		var name, picture *string
+		if err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.FolderID,
+			&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
+			&f.Status, &f.QuarantineReason, &f.QuarantinedAt,
+			&uf.UploaderEmail, &name, &picture); err != nil {
+			return nil, err
+		}
+		if name != nil {
+			uf.UploaderName = *name
+		}
+		if picture != nil {
+			uf.UploaderPicture = *picture
+		}
+		uf.File = f
+		result = append(result, uf)
+	}
+	return result, rows.Err()
+}
+
 // SoftDeleteUserFileByMappingID soft-deletes a mapping by id
 func (r *fileRepository) SoftDeleteUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) error {
 	_, err := r.DB.Exec(ctx, `UPDATE user_files SET deleted_at = NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, mappingID, userID)
@@ -525,8 +1220,9 @@ func (r *fileRepository) DeleteUserFileByMappingID(ctx context.Context, userID u
 	return err
 }
 
-// SearchUserFiles implements combined filters with keyset pagination by (uploaded_at,id)
-func (r *fileRepository) SearchUserFiles(ctx context.Context, userID uuid.UUID, filter SearchFilter, page Page) ([]models.UserFile, *string, int, error) {
+// SearchUserFiles implements combined filters with keyset pagination by (sort key,id).
+// The sort key is uploaded_at by default or last_accessed_at when page.Sort asks for it.
+func (r *fileRepository) SearchUserFiles(ctx context.Context, userID uuid.UUID, filter SearchFilter, page Page) ([]models.UserFile, *string, SearchTotals, error) {
 	// Base query selects active mappings for the user
 	sb := strings.Builder{}
 	countSB := strings.Builder{}
@@ -537,33 +1233,30 @@ func (r *fileRepository) SearchUserFiles(ctx context.Context, userID uuid.UUID,
 	}
 	// Filtering CTEs and joins
 	baseCTE := `WITH base AS (
-		SELECT uf.id AS mapping_id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at
+		SELECT uf.id AS mapping_id, uf.user_id, uf.file_id, uf.role, uf.uploaded_at, uf.last_accessed_at, uf.folder_id, uf.visibility, uf.description, uf.display_name
 		FROM user_files uf
 		WHERE uf.user_id = $1 AND uf.deleted_at IS NULL
     )`
+	selectSQL := `
+    SELECT b.mapping_id, b.user_id, b.file_id, b.role, b.uploaded_at, b.last_accessed_at, COALESCE(b.description, ''),
+		   f.id, f.hash, f.storage_path, ` + searchNameSQL + `, f.mime_type, f.size, f.ref_count, b.visibility, f.created_at,
+		   ` + profileColumns("u", "uploader")
 	joinSQL := `
-    SELECT b.mapping_id, b.user_id, b.file_id, b.role, b.uploaded_at,
-		   f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-		   COALESCE(u.email, gu.email, '') AS uploader_email,
-		   NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-		   NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture
 	FROM base b
-	JOIN files f ON f.id = b.file_id
-	LEFT JOIN users u ON b.user_id = u.id
-    LEFT JOIN google_users gu ON b.user_id = gu.id`
+	JOIN files f ON f.id = b.file_id` + accountJoin("u", "b.user_id")
 	sb.WriteString(baseCTE)
+	sb.WriteString(selectSQL)
 	sb.WriteString(joinSQL)
-	countSB.WriteString(baseCTE)
-	countSB.WriteString(strings.Replace(joinSQL, `SELECT b.mapping_id, b.user_id, b.file_id, b.role, b.uploaded_at,
-	    f.id, f.hash, f.storage_path, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-	    COALESCE(u.email, gu.email, '') AS uploader_email,
-	    NULLIF(COALESCE(gu.name, ''), '') AS uploader_name,
-	    NULLIF(COALESCE(gu.picture, ''), '') AS uploader_picture`, "SELECT 1", 1))
+	countSB.WriteString(joinSQL)
 
 	// Dynamic WHERE filters
 	where := []string{}
-	if filter.Filename != nil && *filter.Filename != "" {
-		where = append(where, fmt.Sprintf("f.original_name ILIKE '%%' || %s || '%%'", arg(*filter.Filename)))
+	nameCond, err := filenameCondition(filter, arg)
+	if err != nil {
+		return nil, nil, SearchTotals{}, err
+	}
+	if nameCond != "" {
+		where = append(where, nameCond)
 	}
 	if len(filter.MimeTypes) > 0 {
 		where = append(where, fmt.Sprintf("f.mime_type = ANY(%s)", arg(filter.MimeTypes)))
@@ -597,15 +1290,30 @@ func (r *fileRepository) SearchUserFiles(ctx context.Context, userID uuid.UUID,
 	if filter.UploaderName != nil && *filter.UploaderName != "" {
 		where = append(where, fmt.Sprintf("(gu.name ILIKE '%%' || %s || '%%')", arg(*filter.UploaderName)))
 	}
+	scope, err := scopeCondition(filter, arg)
+	if err != nil {
+		return nil, nil, SearchTotals{}, err
+	}
+	if scope != "" {
+		where = append(where, scope)
+	}
 
 	if len(where) > 0 {
 		whereSQL := "\nWHERE " + strings.Join(where, " AND ")
 		sb.WriteString(whereSQL)
 		countSB.WriteString(whereSQL)
 	}
+	// The cursor arguments added below belong to the page query only
+	countArgs := len(args)
+
+	// Never-accessed files sort after everything else when ordering by last access
+	sortKey := "b.uploaded_at"
+	if page.Sort == SortByLastAccessed {
+		sortKey = "COALESCE(b.last_accessed_at, 'epoch'::timestamp)"
+	}
 
 	// Keyset pagination
-	// Cursor format: uploaded_at RFC3339NANO + ":" + mapping_id
+	// Cursor format: sort key unix nanos + ":" + mapping_id
 	if page.Cursor != nil && *page.Cursor != "" {
 		var ts time.Time
 		var mid uuid.UUID
@@ -619,16 +1327,16 @@ func (r *fileRepository) SearchUserFiles(ctx context.Context, userID uuid.UUID,
 				mid = id
 			}
 		}
-		if !ts.IsZero() && mid != uuid.Nil {
-			where2 := ""
+		if mid != uuid.Nil && (!ts.IsZero() || page.Sort == SortByLastAccessed) {
+			where2 := "\nWHERE "
 			if len(where) > 0 {
 				where2 = " AND "
 			}
-			sb.WriteString(where2 + fmt.Sprintf("(b.uploaded_at, b.mapping_id) < (%s, %s)", arg(ts), arg(mid)))
+			sb.WriteString(where2 + fmt.Sprintf("(%s, b.mapping_id) < (%s, %s)", sortKey, arg(ts), arg(mid)))
 		}
 	}
 
-	sb.WriteString("\nORDER BY b.uploaded_at DESC, b.mapping_id DESC")
+	sb.WriteString("\nORDER BY " + sortKey + " DESC, b.mapping_id DESC")
 	limit := 50
 	if page.Limit > 0 && page.Limit <= 200 {
 		limit = page.Limit
@@ -637,49 +1345,100 @@ func (r *fileRepository) SearchUserFiles(ctx context.Context, userID uuid.UUID,
 
 	// Total count (without pagination) for UI; keep approximate by separate query for performance
 	// Note: count respects same filters but without LIMIT/OFFSET
-	countSQL := countSB.String()
-	countSQL = countSQL + "\nSELECT COUNT(*) FROM (" + strings.Replace(countSB.String(), "SELECT 1", "SELECT 1", 1) + ") _x"
+	countSQL := searchTotalsSQL(baseCTE, countSB.String(), page.WithTotalBytes)
 
 	// Run main query
 	rows, err := r.DB.Query(ctx, sb.String(), args...)
 	if err != nil {
-		return nil, nil, 0, err
+		return nil, nil, SearchTotals{}, err
 	}
 	defer rows.Close()
 
 	out := []models.UserFile{}
-	var lastUploaded time.Time
-	var lastID uuid.UUID
 	for rows.Next() {
 		var uf models.UserFile
 		var f models.File
-		if err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt,
+		if err := rows.Scan(&uf.ID, &uf.UserID, &uf.FileID, &uf.Role, &uf.UploadedAt, &uf.LastAccessedAt, &uf.Description,
 			&f.ID, &f.Hash, &f.StoragePath, &f.OriginalName, &f.MimeType, &f.Size, &f.RefCount, &f.Visibility, &f.CreatedAt,
 			&uf.UploaderEmail, &uf.UploaderName, &uf.UploaderPicture); err != nil {
-			return nil, nil, 0, err
+			return nil, nil, SearchTotals{}, err
 		}
 		uf.File = f
 		out = append(out, uf)
-		lastUploaded = uf.UploadedAt
-		lastID = uf.ID
 	}
 
 	var nextCursor *string
 	if len(out) > limit {
-		// trim extra and set cursor
+		// trim extra and set cursor from the last row actually returned
 		out = out[:limit]
-		cursor := fmt.Sprintf("%d:%s", lastUploaded.UnixNano(), lastID.String())
+		cursor := FileCursor(out[limit-1], page.Sort)
 		nextCursor = &cursor
 	}
 
-	// Get total count
-	var total int
-	if err := r.DB.QueryRow(ctx, countSQL, args...).Scan(&total); err != nil {
+	// Get total count, and the summed size if asked for
+	var totals SearchTotals
+	dest := []interface{}{&totals.Count}
+	if page.WithTotalBytes {
+		dest = append(dest, &totals.Bytes)
+	}
+	if err := r.DB.QueryRow(ctx, countSQL, args[:countArgs]...).Scan(dest...); err != nil {
 		// If count fails, degrade gracefully
-		total = 0
+		totals = SearchTotals{}
 	}
 
-	return out, nextCursor, total, nil
+	return out, nextCursor, totals, nil
+}
+
+// suggestFilenamesSQL ranks names by the latest upload or access of any file carrying them,
+// then by how many of the user's files do. Names are the user's own (display_name when a
+// mapping has one), and the prefix is matched like MatchPrefix searches.
+const suggestFilenamesSQL = `
+	SELECT COALESCE(uf.display_name, f.original_name) AS name
+	FROM user_files uf
+	JOIN files f ON f.id = uf.file_id
+	WHERE uf.user_id = $1 AND uf.deleted_at IS NULL AND lower(COALESCE(uf.display_name, f.original_name)) LIKE $2
+	GROUP BY name
+	ORDER BY MAX(GREATEST(uf.uploaded_at, COALESCE(uf.last_accessed_at, uf.uploaded_at))) DESC, COUNT(*) DESC, name
+	LIMIT $3`
+
+func (r *fileRepository) SuggestFilenames(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]string, error) {
+	rows, err := r.DB.Query(ctx, suggestFilenamesSQL, userID, likePrefix(strings.ToLower(prefix)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// searchTotalsSQL builds the query counting the rows matched by a search's FROM and WHERE
+// clauses, and with bytes also summing their file sizes, ignoring pagination.
+func searchTotalsSQL(baseCTE, fromWhere string, bytes bool) string {
+	cols := "COUNT(*)"
+	if bytes {
+		cols += ", COALESCE(SUM(f.size), 0)::BIGINT"
+	}
+	return baseCTE + "\nSELECT " + cols + fromWhere
+}
+
+// FileCursor builds the keyset cursor for a search result under the given sort
+func FileCursor(uf models.UserFile, sort FileSort) string {
+	key := uf.UploadedAt
+	if sort == SortByLastAccessed {
+		// Matches the COALESCE(..., 'epoch') sort key used for never-accessed files
+		key = time.Unix(0, 0).UTC()
+		if uf.LastAccessedAt != nil {
+			key = *uf.LastAccessedAt
+		}
+	}
+	return fmt.Sprintf("%d:%s", key.UnixNano(), uf.ID.String())
 }
 
 // GetUserFileMappingStatus returns one of: "none", "active", "deleted"
@@ -689,7 +1448,7 @@ func (r *fileRepository) GetUserFileMappingStatus(ctx context.Context, userID, f
 	// Use a nullable bool to detect no rows via scan error
 	err := row.Scan(&isActive)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return "none", nil
 		}
 		return "", err
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// argCollector mimics SearchUserFiles' placeholder allocation, with $1 taken by the user id
+func argCollector() (*[]interface{}, func(interface{}) string) {
+	args := []interface{}{uuid.New()}
+	return &args, func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+}
+
+func TestScopeCondition_All(t *testing.T) {
+	for _, scope := range []SearchScope{"", ScopeAll} {
+		args, arg := argCollector()
+		cond, err := scopeCondition(SearchFilter{Scope: scope}, arg)
+		if err != nil || cond != "" || len(*args) != 1 {
+			t.Fatalf("scope %q: expected no condition, got %q (%v)", scope, cond, err)
+		}
+	}
+}
+
+func TestScopeCondition_Root(t *testing.T) {
+	args, arg := argCollector()
+	cond, err := scopeCondition(SearchFilter{Scope: ScopeRoot}, arg)
+	if err != nil || cond != "b.folder_id IS NULL" || len(*args) != 1 {
+		t.Fatalf("unexpected root condition %q (%v)", cond, err)
+	}
+}
+
+func TestScopeCondition_FolderSubtree(t *testing.T) {
+	folderID := uuid.New()
+	args, arg := argCollector()
+	cond, err := scopeCondition(SearchFilter{Scope: ScopeFolder, FolderID: &folderID}, arg)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(*args) != 2 || (*args)[1] != folderID {
+		t.Fatalf("expected folder id bound as $2, got %v", *args)
+	}
+	for _, want := range []string{"WITH RECURSIVE", "WHERE id = $2 AND user_id = $1", "fo.parent_id = st.id"} {
+		if !strings.Contains(cond, want) {
+			t.Fatalf("expected condition to contain %q, got %s", want, cond)
+		}
+	}
+}
+
+func TestScopeCondition_Invalid(t *testing.T) {
+	_, arg := argCollector()
+	if _, err := scopeCondition(SearchFilter{Scope: ScopeFolder}, arg); err == nil {
+		t.Fatalf("expected error for folder scope without folder id")
+	}
+	if _, err := scopeCondition(SearchFilter{Scope: "nested"}, arg); err == nil {
+		t.Fatalf("expected error for unknown scope")
+	}
+}
+
+func TestFilenameCondition_Modes(t *testing.T) {
+	name := "Report"
+	cases := []struct {
+		match FilenameMatch
+		cond  string
+		arg   string
+	}{
+		{"", "COALESCE(b.display_name, f.original_name) ILIKE '%' || $2 || '%'", "Report"},
+		{MatchContains, "COALESCE(b.display_name, f.original_name) ILIKE '%' || $2 || '%'", "Report"},
+		{MatchPrefix, "lower(COALESCE(b.display_name, f.original_name)) LIKE $2", "report%"},
+		{MatchExact, "lower(COALESCE(b.display_name, f.original_name)) = $2", "report"},
+	}
+	for _, c := range cases {
+		args, arg := argCollector()
+		cond, err := filenameCondition(SearchFilter{Filename: &name, FilenameMatch: c.match}, arg)
+		if err != nil || cond != c.cond {
+			t.Fatalf("match %q: unexpected condition %q (%v)", c.match, cond, err)
+		}
+		if len(*args) != 2 || (*args)[1] != c.arg {
+			t.Fatalf("match %q: expected %q bound as $2, got %v", c.match, c.arg, *args)
+		}
+	}
+}
+
+func TestFilenameCondition_PrefixEscapesWildcards(t *testing.T) {
+	name := `50%_off\`
+	args, arg := argCollector()
+	if _, err := filenameCondition(SearchFilter{Filename: &name, FilenameMatch: MatchPrefix}, arg); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := (*args)[1]; got != `50\%\_off\\%` {
+		t.Fatalf("expected wildcards to be escaped, got %q", got)
+	}
+}
+
+func TestFilenameCondition_NoFilename(t *testing.T) {
+	empty := ""
+	for _, f := range []SearchFilter{{FilenameMatch: MatchExact}, {Filename: &empty, FilenameMatch: MatchPrefix}} {
+		args, arg := argCollector()
+		cond, err := filenameCondition(f, arg)
+		if err != nil || cond != "" || len(*args) != 1 {
+			t.Fatalf("expected no condition, got %q (%v)", cond, err)
+		}
+	}
+	name := "x"
+	_, arg := argCollector()
+	if _, err := filenameCondition(SearchFilter{Filename: &name, FilenameMatch: "fuzzy"}, arg); err == nil {
+		t.Fatalf("expected error for unknown match mode")
+	}
+}
+
+func TestSearchTotalsSQL(t *testing.T) {
+	base := "WITH base AS (SELECT 1)"
+	fromWhere := "\n\tFROM base b\n\tJOIN files f ON f.id = b.file_id\nWHERE f.mime_type = ANY($2)"
+
+	countOnly := searchTotalsSQL(base, fromWhere, false)
+	if countOnly != base+"\nSELECT COUNT(*)"+fromWhere {
+		t.Fatalf("unexpected count query: %s", countOnly)
+	}
+
+	// The sum runs over the same filtered rows as the count, not just one page
+	withBytes := searchTotalsSQL(base, fromWhere, true)
+	if withBytes != base+"\nSELECT COUNT(*), COALESCE(SUM(f.size), 0)::BIGINT"+fromWhere {
+		t.Fatalf("unexpected totals query: %s", withBytes)
+	}
+	if strings.Contains(withBytes, "LIMIT") || strings.Contains(withBytes, "ORDER BY") {
+		t.Fatalf("expected totals to ignore pagination, got %s", withBytes)
+	}
+}
+
+func TestLookupErr(t *testing.T) {
+	missing := lookupErr("file", pgx.ErrNoRows)
+	if !errors.Is(missing, ErrNotFound) {
+		t.Fatalf("expected no rows to map to ErrNotFound, got %v", missing)
+	}
+
+	dbErr := errors.New("connection reset")
+	failed := lookupErr("file", dbErr)
+	if errors.Is(failed, ErrNotFound) || !errors.Is(failed, dbErr) {
+		t.Fatalf("expected database errors to be wrapped, got %v", failed)
+	}
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -16,10 +18,20 @@ import (
 type FolderRepository interface {
 	// CreateFolder creates a new folder for a user, optionally nested under a parent folder
 	CreateFolder(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*models.Folder, error)
-	// RenameFolder changes the name of an existing folder
-	RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string) error
-	// DeleteFolder removes a folder from the database
+	// RenameFolder changes the name of an existing folder. When expectedUpdatedAt is set the
+	// rename only applies if the folder hasn't changed since, otherwise ErrVersionConflict is returned
+	RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string, expectedUpdatedAt *time.Time) error
+	// MoveFolder places a folder under newParentID (the root when nil). Its id, files and shares
+	// are untouched. ErrFolderCycle is returned when the target lies inside the folder
+	MoveFolder(ctx context.Context, userID, folderID uuid.UUID, newParentID *uuid.UUID) error
+	// SetFolderDescription sets the note on one of the user's folders; nil clears it.
+	// ErrNotFound is returned when the folder is missing or someone else's
+	SetFolderDescription(ctx context.Context, userID, folderID uuid.UUID, description *string) error
+	// DeleteFolder moves a folder to the trash. Trashed folders are left out of every lookup
+	// below except GetDeletedFolders and RecoverFolder
 	DeleteFolder(ctx context.Context, userID, folderID uuid.UUID) error
+	// PurgeFolder removes a folder from the database for good, skipping the trash
+	PurgeFolder(ctx context.Context, userID, folderID uuid.UUID) error
 	// ListFolders retrieves all folders for a user, optionally filtered by parent folder
 	ListFolders(ctx context.Context, userID uuid.UUID, parentID *uuid.UUID) ([]models.Folder, error)
 	// GetFolderByID retrieves a specific folder by its ID
@@ -28,18 +40,68 @@ type FolderRepository interface {
 	CountChildren(ctx context.Context, userID, folderID uuid.UUID) (int, error)
 	// ValidateParent checks if a folder exists and belongs to the specified user
 	ValidateParent(ctx context.Context, userID uuid.UUID, parentID uuid.UUID) (bool, error)
-	// DeleteFolderReassignFiles removes a folder and reassigns its files to the root level
+	// ValidateParents checks many folders in one query; every requested ID is a key of the
+	// result, true when the folder exists and belongs to the user
+	ValidateParents(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) (map[uuid.UUID]bool, error)
+	// DeleteFolderReassignFiles moves a folder to the trash and reassigns its files to the root level
 	DeleteFolderReassignFiles(ctx context.Context, userID, folderID uuid.UUID) error
-	// DeleteFolderRecursive removes a folder and all its contents (files and subfolders) recursively
+	// DeleteFolderRecursive moves a folder and all its contents (files and subfolders) to the trash
 	DeleteFolderRecursive(ctx context.Context, userID, folderID uuid.UUID) error
+	// GetDeletedFolders lists the user's trashed folders, one per deletion: subfolders
+	// trashed along with their parent are left out, as recovering the parent restores them
+	GetDeletedFolders(ctx context.Context, userID uuid.UUID) ([]models.Folder, error)
+	// RecoverFolder takes a trashed folder out of the trash under parentID (the root when
+	// nil), together with the subfolders and files deleted with it. ErrNotFound is returned
+	// when the folder isn't one of the user's trashed folders
+	RecoverFolder(ctx context.Context, userID, folderID uuid.UUID, parentID *uuid.UUID) error
 	// GetAllSubfolders returns all descendant folders of a given folder
 	GetAllSubfolders(ctx context.Context, userID, folderID uuid.UUID) ([]models.Folder, error)
 	// CreateFolderPath creates a folder and all necessary parent directories
 	CreateFolderPath(ctx context.Context, userID uuid.UUID, folderPath string, parentID *uuid.UUID) (*models.Folder, error)
 	// BulkCreateFolders creates multiple folders in a single transaction
 	BulkCreateFolders(ctx context.Context, userID uuid.UUID, folders []models.Folder) error
+	// CreateFolderWithFiles creates a folder and moves the user's active mappings into it in one
+	// transaction. Nothing is written and ErrMappingsNotMoved is returned if any mapping can't be moved
+	CreateFolderWithFiles(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID, mappingIDs []uuid.UUID) (*models.Folder, error)
+	// GetFolderTree lists the folders below rootID (the user's root when nil) down to maxDepth
+	// levels in one query, ordered by depth then name
+	GetFolderTree(ctx context.Context, userID uuid.UUID, rootID *uuid.UUID, maxDepth int) ([]models.FolderTreeEntry, error)
+	// SetFolderQuota caps how many bytes one of the user's folders and its subfolders may
+	// hold; nil removes the cap. ErrNotFound is returned when the folder is missing or
+	// someone else's
+	SetFolderQuota(ctx context.Context, userID, folderID uuid.UUID, quotaBytes *int64) error
+	// GetFolderQuota returns the cap of one of the user's folders, nil when it has none.
+	// ErrNotFound is returned when the folder is missing or someone else's
+	GetFolderQuota(ctx context.Context, userID, folderID uuid.UUID) (*int64, error)
+	// GetFolderQuotaUsage returns the quota and current usage of every folder with a quota
+	// among folderID and its ancestors, nearest first. Usage counts the active copies in
+	// the folder's subtree of every user
+	GetFolderQuotaUsage(ctx context.Context, folderID uuid.UUID) ([]FolderQuotaUsage, error)
+	// GetFolderOwner returns the id of the user who owns the folder, for callers acting on
+	// it through a share. ErrNotFound is returned when the folder is missing
+	GetFolderOwner(ctx context.Context, folderID uuid.UUID) (uuid.UUID, error)
 }
 
+// FolderQuotaUsage is how full a folder with a quota is.
+type FolderQuotaUsage struct {
+	FolderID   uuid.UUID
+	FolderName string
+	QuotaBytes int64
+	UsedBytes  int64
+}
+
+// ErrVersionConflict is returned when a conditional update finds the row was modified
+// since the version the caller supplied.
+var ErrVersionConflict = errors.New("conflict: resource was modified by another request")
+
+// ErrFolderCycle is returned by MoveFolder when the target is the folder itself or one of
+// its descendants.
+var ErrFolderCycle = errors.New("cannot move a folder into itself or one of its subfolders")
+
+// ErrMappingsNotMoved is returned by CreateFolderWithFiles and MoveUserFiles when some of
+// the mappings are missing, deleted, or owned by another user.
+var ErrMappingsNotMoved = errors.New("one or more files could not be moved")
+
 // folderRepository implements FolderRepository using PostgreSQL
 type folderRepository struct{ DB *pgxpool.Pool }
 
@@ -50,23 +112,104 @@ func NewFolderRepository(db *pgxpool.Pool) FolderRepository { return &folderRepo
 // Returns the created folder with its generated ID and timestamp.
 func (r *folderRepository) CreateFolder(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*models.Folder, error) {
 	id := uuid.New()
-	_, err := r.DB.Exec(ctx, `INSERT INTO folders (id, user_id, name, parent_id, created_at) VALUES ($1,$2,$3,$4,$5)`, id, userID, name, parentID, time.Now())
+	// Postgres keeps microseconds; truncate so the returned version matches the stored one
+	now := time.Now().Truncate(time.Microsecond)
+	_, err := r.DB.Exec(ctx, `INSERT INTO folders (id, user_id, name, parent_id, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$5)`, id, userID, name, parentID, now)
 	if err != nil {
 		return nil, err
 	}
-	return &models.Folder{ID: id, UserID: userID, Name: name, ParentID: parentID, CreatedAt: time.Now()}, nil
+	return &models.Folder{ID: id, UserID: userID, Name: name, ParentID: parentID, CreatedAt: now, UpdatedAt: now}, nil
 }
 
 // RenameFolder changes the name of an existing folder.
-// Only the folder owner can rename their folders.
-func (r *folderRepository) RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string) error {
-	_, err := r.DB.Exec(ctx, `UPDATE folders SET name=$3 WHERE id=$1 AND user_id=$2`, folderID, userID, newName)
-	return err
+// Only the folder owner can rename their folders. If expectedUpdatedAt is given the
+// UPDATE is conditional on it, so a stale client can't overwrite a newer rename.
+func (r *folderRepository) RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string, expectedUpdatedAt *time.Time) error {
+	if expectedUpdatedAt == nil {
+		_, err := r.DB.Exec(ctx, `UPDATE folders SET name=$3, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID, newName)
+		return err
+	}
+	ct, err := r.DB.Exec(ctx, `UPDATE folders SET name=$3, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL AND updated_at=$4`, folderID, userID, newName, *expectedUpdatedAt)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		// Distinguish a missing folder from one that moved on
+		exists, err := r.ValidateParent(ctx, userID, folderID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("folder not found")
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// MoveFolder re-parents a folder in a transaction holding a per-user advisory lock, so two
+// concurrent moves can't each pass the cycle check and together create a loop. Files keep
+// their folder_id and shares stay keyed by folder id; inherited access is derived from the
+// ancestor chain at check time, so it follows the new location without further writes.
+func (r *folderRepository) MoveFolder(ctx context.Context, userID, folderID uuid.UUID, newParentID *uuid.UUID) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('folder-move:' || $1::text, 0))`, userID); err != nil {
+		return err
+	}
+	if newParentID != nil {
+		var cycle bool
+		err := tx.QueryRow(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM folders WHERE id = $1 AND user_id = $2
+				UNION
+				SELECT f.id FROM folders f JOIN subtree st ON f.parent_id = st.id WHERE f.user_id = $2
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $3)`, folderID, userID, *newParentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrFolderCycle
+		}
+	}
+	ct, err := tx.Exec(ctx, `UPDATE folders SET parent_id=$3, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID, newParentID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return lookupErr("folder "+folderID.String(), pgx.ErrNoRows)
+	}
+	return tx.Commit(ctx)
+}
+
+// SetFolderDescription stores or clears the folder's note. Like a rename it counts as a
+// modification, so the folder's version moves on.
+func (r *folderRepository) SetFolderDescription(ctx context.Context, userID, folderID uuid.UUID, description *string) error {
+	ct, err := r.DB.Exec(ctx, `UPDATE folders SET description=$3, updated_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID, description)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("folder %s: %w", folderID, ErrNotFound)
+	}
+	return nil
 }
 
-// DeleteFolder removes a folder from the database.
+// DeleteFolder moves a folder to the trash by stamping deleted_at.
 // Only the folder owner can delete their folders.
 func (r *folderRepository) DeleteFolder(ctx context.Context, userID, folderID uuid.UUID) error {
+	_, err := r.DB.Exec(ctx, `UPDATE folders SET deleted_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID)
+	return err
+}
+
+// PurgeFolder removes a folder from the database.
+// Only the folder owner can purge their folders.
+func (r *folderRepository) PurgeFolder(ctx context.Context, userID, folderID uuid.UUID) error {
 	_, err := r.DB.Exec(ctx, `DELETE FROM folders WHERE id=$1 AND user_id=$2`, folderID, userID)
 	return err
 }
@@ -74,10 +217,10 @@ func (r *folderRepository) DeleteFolder(ctx context.Context, userID, folderID uu
 // ValidateParent checks if a folder exists and belongs to the specified user.
 // This is used to validate parent folder references when creating nested folders.
 func (r *folderRepository) ValidateParent(ctx context.Context, userID uuid.UUID, parentID uuid.UUID) (bool, error) {
-	row := r.DB.QueryRow(ctx, `SELECT 1 FROM folders WHERE id=$1 AND user_id=$2`, parentID, userID)
+	row := r.DB.QueryRow(ctx, `SELECT 1 FROM folders WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, parentID, userID)
 	var one int
 	if err := row.Scan(&one); err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return false, nil
 		}
 		return false, err
@@ -85,11 +228,37 @@ func (r *folderRepository) ValidateParent(ctx context.Context, userID uuid.UUID,
 	return true, nil
 }
 
-// DeleteFolderReassignFiles moves files in the folder to root (folder_id=NULL) then deletes the folder.
+// ValidateParents checks which of the folders exist and belong to the user with a single
+// query, so callers placing files into many folders don't pay a round trip per folder.
+func (r *folderRepository) ValidateParents(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	valid := make(map[uuid.UUID]bool, len(parentIDs))
+	for _, id := range parentIDs {
+		valid[id] = false
+	}
+	if len(parentIDs) == 0 {
+		return valid, nil
+	}
+	rows, err := r.DB.Query(ctx, `SELECT id FROM folders WHERE user_id=$1 AND id = ANY($2) AND deleted_at IS NULL`, userID, parentIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		valid[id] = true
+	}
+	return valid, rows.Err()
+}
+
+// DeleteFolderReassignFiles moves files in the folder to root (folder_id=NULL) then trashes the
+// folder. The files stay where they are if the folder is later recovered.
 func (r *folderRepository) DeleteFolderReassignFiles(ctx context.Context, userID, folderID uuid.UUID) error {
 	batch := &pgx.Batch{}
 	batch.Queue(`UPDATE user_files SET folder_id=NULL WHERE folder_id=$1 AND user_id=$2`, folderID, userID)
-	batch.Queue(`DELETE FROM folders WHERE id=$1 AND user_id=$2`, folderID, userID)
+	batch.Queue(`UPDATE folders SET deleted_at=NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID)
 	br := r.DB.SendBatch(ctx, batch)
 	if _, err := br.Exec(); err != nil {
 		br.Close()
@@ -106,9 +275,9 @@ func (r *folderRepository) ListFolders(ctx context.Context, userID uuid.UUID, pa
 	var rows pgx.Rows
 	var err error
 	if parentID == nil {
-		rows, err = r.DB.Query(ctx, `SELECT id, user_id, name, parent_id, created_at FROM folders WHERE user_id=$1 AND parent_id IS NULL ORDER BY name ASC`, userID)
+		rows, err = r.DB.Query(ctx, `SELECT id, user_id, name, parent_id, created_at, updated_at, COALESCE(description, '') FROM folders WHERE user_id=$1 AND parent_id IS NULL AND deleted_at IS NULL ORDER BY name ASC`, userID)
 	} else {
-		rows, err = r.DB.Query(ctx, `SELECT id, user_id, name, parent_id, created_at FROM folders WHERE user_id=$1 AND parent_id=$2 ORDER BY name ASC`, userID, *parentID)
+		rows, err = r.DB.Query(ctx, `SELECT id, user_id, name, parent_id, created_at, updated_at, COALESCE(description, '') FROM folders WHERE user_id=$1 AND parent_id=$2 AND deleted_at IS NULL ORDER BY name ASC`, userID, *parentID)
 	}
 	if err != nil {
 		return nil, err
@@ -117,7 +286,7 @@ func (r *folderRepository) ListFolders(ctx context.Context, userID uuid.UUID, pa
 	var out []models.Folder
 	for rows.Next() {
 		var f models.Folder
-		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt); err != nil {
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt, &f.UpdatedAt, &f.Description); err != nil {
 			return nil, err
 		}
 		out = append(out, f)
@@ -126,16 +295,16 @@ func (r *folderRepository) ListFolders(ctx context.Context, userID uuid.UUID, pa
 }
 
 func (r *folderRepository) GetFolderByID(ctx context.Context, userID, folderID uuid.UUID) (*models.Folder, error) {
-	row := r.DB.QueryRow(ctx, `SELECT id, user_id, name, parent_id, created_at FROM folders WHERE id=$1 AND user_id=$2`, folderID, userID)
+	row := r.DB.QueryRow(ctx, `SELECT id, user_id, name, parent_id, created_at, updated_at, COALESCE(description, '') FROM folders WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID)
 	var f models.Folder
-	if err := row.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt); err != nil {
-		return nil, err
+	if err := row.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt, &f.UpdatedAt, &f.Description); err != nil {
+		return nil, lookupErr("folder "+folderID.String(), err)
 	}
 	return &f, nil
 }
 
 func (r *folderRepository) CountChildren(ctx context.Context, userID, folderID uuid.UUID) (int, error) {
-	row := r.DB.QueryRow(ctx, `SELECT COUNT(1) FROM folders WHERE parent_id=$1 AND user_id=$2`, folderID, userID)
+	row := r.DB.QueryRow(ctx, `SELECT COUNT(1) FROM folders WHERE parent_id=$1 AND user_id=$2 AND deleted_at IS NULL`, folderID, userID)
 	var n int
 	if err := row.Scan(&n); err != nil {
 		return 0, err
@@ -143,7 +312,20 @@ func (r *folderRepository) CountChildren(ctx context.Context, userID, folderID u
 	return n, nil
 }
 
-// DeleteFolderRecursive removes a folder and all its contents (files and subfolders) recursively
+// folderSubtreeCTE selects the active folders of the subtree rooted at $1 owned by $2.
+// Subfolders trashed earlier, and everything below them, are left out.
+const folderSubtreeCTE = `
+	WITH RECURSIVE folder_tree AS (
+		SELECT id FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		UNION ALL
+		SELECT f.id FROM folders f
+		INNER JOIN folder_tree ft ON f.parent_id = ft.id
+		WHERE f.user_id = $2 AND f.deleted_at IS NULL
+	)`
+
+// DeleteFolderRecursive moves a folder and all its contents (files and subfolders) to the
+// trash. Everything is stamped with the transaction's NOW(), which is how RecoverFolder
+// tells what was deleted together from what was trashed before.
 func (r *folderRepository) DeleteFolderRecursive(ctx context.Context, userID, folderID uuid.UUID) error {
 	// Use a transaction to ensure consistency
 	tx, err := r.DB.Begin(ctx)
@@ -152,32 +334,30 @@ func (r *folderRepository) DeleteFolderRecursive(ctx context.Context, userID, fo
 	}
 	defer tx.Rollback(ctx)
 
-	// First, recursively delete all files in this folder and its subfolders
-	_, err = tx.Exec(ctx, `
-		WITH RECURSIVE folder_tree AS (
-			SELECT id FROM folders WHERE id = $1 AND user_id = $2
-			UNION ALL
-			SELECT f.id FROM folders f
-			INNER JOIN folder_tree ft ON f.parent_id = ft.id
-			WHERE f.user_id = $2
-		)
-		DELETE FROM user_files 
-		WHERE folder_id IN (SELECT id FROM folder_tree) AND user_id = $2
+	// Files under retention keep the whole tree from being deleted
+	var retained int
+	if err := tx.QueryRow(ctx, folderSubtreeCTE+`
+		SELECT COUNT(*) FROM user_files
+		WHERE folder_id IN (SELECT id FROM folder_tree) AND user_id = $2 AND retain_until > NOW()
+	`, folderID, userID).Scan(&retained); err != nil {
+		return err
+	}
+	if retained > 0 {
+		return fmt.Errorf("%w: %d file(s) in the folder can't be deleted yet", ErrRetained, retained)
+	}
+
+	// First, trash the active files in this folder and its subfolders
+	_, err = tx.Exec(ctx, folderSubtreeCTE+`
+		UPDATE user_files SET deleted_at = NOW()
+		WHERE folder_id IN (SELECT id FROM folder_tree) AND user_id = $2 AND deleted_at IS NULL
 	`, folderID, userID)
 	if err != nil {
 		return err
 	}
 
-	// Then delete all folders in the hierarchy
-	_, err = tx.Exec(ctx, `
-		WITH RECURSIVE folder_tree AS (
-			SELECT id FROM folders WHERE id = $1 AND user_id = $2
-			UNION ALL
-			SELECT f.id FROM folders f
-			INNER JOIN folder_tree ft ON f.parent_id = ft.id
-			WHERE f.user_id = $2
-		)
-		DELETE FROM folders WHERE id IN (SELECT id FROM folder_tree) AND user_id = $2
+	// Then trash all folders in the hierarchy
+	_, err = tx.Exec(ctx, folderSubtreeCTE+`
+		UPDATE folders SET deleted_at = NOW() WHERE id IN (SELECT id FROM folder_tree) AND user_id = $2
 	`, folderID, userID)
 	if err != nil {
 		return err
@@ -186,6 +366,105 @@ func (r *folderRepository) DeleteFolderRecursive(ctx context.Context, userID, fo
 	return tx.Commit(ctx)
 }
 
+// GetDeletedFolders lists the trashed folders whose parent wasn't trashed in the same
+// deletion, most recently deleted first
+func (r *folderRepository) GetDeletedFolders(ctx context.Context, userID uuid.UUID) ([]models.Folder, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at, f.updated_at, COALESCE(f.description, ''), f.deleted_at
+		FROM folders f
+		LEFT JOIN folders p ON p.id = f.parent_id
+		WHERE f.user_id = $1 AND f.deleted_at IS NOT NULL
+		  AND (p.id IS NULL OR p.deleted_at IS DISTINCT FROM f.deleted_at)
+		ORDER BY f.deleted_at DESC, f.name ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Folder
+	for rows.Next() {
+		var f models.Folder
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt, &f.UpdatedAt, &f.Description, &f.DeletedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// RecoverFolder walks down from the folder through the subfolders carrying its deleted_at
+// stamp and clears it on them and on the user's files in them stamped alike, in one
+// statement. Subfolders and files trashed on their own before stay in the trash.
+func (r *folderRepository) RecoverFolder(ctx context.Context, userID, folderID uuid.UUID, parentID *uuid.UUID) error {
+	var restored int
+	err := r.DB.QueryRow(ctx, `
+		WITH RECURSIVE batch AS (
+			SELECT id, deleted_at FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+			UNION ALL
+			SELECT f.id, f.deleted_at FROM folders f
+			INNER JOIN batch b ON f.parent_id = b.id
+			WHERE f.user_id = $2 AND f.deleted_at = b.deleted_at
+		),
+		files AS (
+			UPDATE user_files uf SET deleted_at = NULL
+			FROM batch b
+			WHERE uf.folder_id = b.id AND uf.user_id = $2 AND uf.deleted_at = b.deleted_at
+		),
+		folders_restored AS (
+			UPDATE folders f
+			SET deleted_at = NULL,
+			    parent_id = CASE WHEN f.id = $1 THEN $3 ELSE f.parent_id END,
+			    updated_at = CASE WHEN f.id = $1 THEN NOW() ELSE f.updated_at END
+			FROM batch b
+			WHERE f.id = b.id
+			RETURNING f.id
+		)
+		SELECT COUNT(*) FROM folders_restored
+	`, folderID, userID, parentID).Scan(&restored)
+	if err != nil {
+		return err
+	}
+	if restored == 0 {
+		return lookupErr("deleted folder "+folderID.String(), pgx.ErrNoRows)
+	}
+	return nil
+}
+
+// GetFolderTree walks the hierarchy with a recursive CTE that stops at maxDepth, and flags
+// each folder that has subfolders so callers know which nodes can be expanded further.
+func (r *folderRepository) GetFolderTree(ctx context.Context, userID uuid.UUID, rootID *uuid.UUID, maxDepth int) ([]models.FolderTreeEntry, error) {
+	rows, err := r.DB.Query(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id, user_id, name, parent_id, created_at, updated_at, 1 AS depth
+			FROM folders
+			WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at, f.updated_at, t.depth + 1
+			FROM folders f
+			INNER JOIN tree t ON f.parent_id = t.id
+			WHERE f.user_id = $1 AND f.deleted_at IS NULL AND t.depth < $3
+		)
+		SELECT t.id, t.user_id, t.name, t.parent_id, t.created_at, t.updated_at, t.depth,
+		       EXISTS (SELECT 1 FROM folders c WHERE c.parent_id = t.id AND c.user_id = $1 AND c.deleted_at IS NULL)
+		FROM tree t
+		ORDER BY t.depth ASC, t.name ASC
+	`, userID, rootID, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.FolderTreeEntry
+	for rows.Next() {
+		var e models.FolderTreeEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Name, &e.ParentID, &e.CreatedAt, &e.UpdatedAt, &e.Depth, &e.HasChildren); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
 // GetAllSubfolders returns all descendant folders of a given folder
 func (r *folderRepository) GetAllSubfolders(ctx context.Context, userID, folderID uuid.UUID) ([]models.Folder, error) {
 	log.Printf("DEBUG: GetAllSubfolders called for folderID: %s, userID: %s", folderID, userID)
@@ -195,11 +474,12 @@ func (r *folderRepository) GetAllSubfolders(ctx context.Context, userID, folderI
 		WITH RECURSIVE folder_tree AS (
 			SELECT id, user_id, name, parent_id, created_at 
 			FROM folders 
-			WHERE parent_id = $1
+			WHERE parent_id = $1 AND deleted_at IS NULL
 			UNION ALL
 			SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at
 			FROM folders f
 			INNER JOIN folder_tree ft ON f.parent_id = ft.id
+			WHERE f.deleted_at IS NULL
 		)
 		SELECT id, user_id, name, parent_id, created_at FROM folder_tree
 		ORDER BY name ASC
@@ -257,3 +537,144 @@ func (r *folderRepository) BulkCreateFolders(ctx context.Context, userID uuid.UU
 
 	return tx.Commit(ctx)
 }
+
+// CreateFolderWithFiles creates a folder and moves the given mappings into it atomically.
+// Only the user's active mappings are moved; if fewer rows than requested are updated the
+// transaction is rolled back so the folder is not left behind half-filled.
+func (r *folderRepository) CreateFolderWithFiles(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID, mappingIDs []uuid.UUID) (*models.Folder, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	id := uuid.New()
+	now := time.Now().Truncate(time.Microsecond)
+	if _, err := tx.Exec(ctx, `INSERT INTO folders (id, user_id, name, parent_id, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$5)`, id, userID, name, parentID, now); err != nil {
+		return nil, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE user_files SET folder_id = $1
+		WHERE user_id = $2 AND id = ANY($3) AND deleted_at IS NULL
+	`, id, userID, mappingIDs)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() != int64(len(mappingIDs)) {
+		return nil, ErrMappingsNotMoved
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &models.Folder{ID: id, UserID: userID, Name: name, ParentID: parentID, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// SetFolderQuota stores or clears the folder's quota. The ownership check and the write
+// run as one statement, so a folder that isn't the user's is never touched.
+func (r *folderRepository) SetFolderQuota(ctx context.Context, userID, folderID uuid.UUID, quotaBytes *int64) error {
+	var owned int
+	var err error
+	if quotaBytes == nil {
+		err = r.DB.QueryRow(ctx, `
+			WITH owned AS (SELECT id FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL),
+			removed AS (DELETE FROM folder_quotas WHERE folder_id IN (SELECT id FROM owned))
+			SELECT COUNT(*) FROM owned
+		`, folderID, userID).Scan(&owned)
+	} else {
+		err = r.DB.QueryRow(ctx, `
+			WITH owned AS (SELECT id FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL),
+			stored AS (
+				INSERT INTO folder_quotas (folder_id, quota_bytes)
+				SELECT id, $3 FROM owned
+				ON CONFLICT (folder_id) DO UPDATE SET quota_bytes = EXCLUDED.quota_bytes, updated_at = NOW()
+			)
+			SELECT COUNT(*) FROM owned
+		`, folderID, userID, *quotaBytes).Scan(&owned)
+	}
+	if err != nil {
+		return err
+	}
+	if owned == 0 {
+		return lookupErr("folder "+folderID.String(), pgx.ErrNoRows)
+	}
+	return nil
+}
+
+// GetFolderQuota returns the folder's quota, or nil when folder_quotas has no row for it
+func (r *folderRepository) GetFolderQuota(ctx context.Context, userID, folderID uuid.UUID) (*int64, error) {
+	var quota *int64
+	err := r.DB.QueryRow(ctx, `
+		SELECT q.quota_bytes
+		FROM folders f
+		LEFT JOIN folder_quotas q ON q.folder_id = f.id
+		WHERE f.id = $1 AND f.user_id = $2 AND f.deleted_at IS NULL
+	`, folderID, userID).Scan(&quota)
+	if err != nil {
+		return nil, lookupErr("folder "+folderID.String(), err)
+	}
+	return quota, nil
+}
+
+// GetFolderOwner looks up who owns a folder, whoever asks
+func (r *folderRepository) GetFolderOwner(ctx context.Context, folderID uuid.UUID) (uuid.UUID, error) {
+	var owner uuid.UUID
+	if err := r.DB.QueryRow(ctx, `SELECT user_id FROM folders WHERE id = $1 AND deleted_at IS NULL`, folderID).Scan(&owner); err != nil {
+		return uuid.Nil, lookupErr("folder "+folderID.String(), err)
+	}
+	return owner, nil
+}
+
+// folderQuotaUsageQuery walks up from the folder to find the ancestors with a quota, then
+// down each of their subtrees to sum the copies stored there. Both walks stop after
+// maxFolderAccessDepth levels so a parent_id cycle cannot loop forever.
+const folderQuotaUsageQuery = `
+	WITH RECURSIVE chain AS (
+		SELECT id, parent_id, name, 0 AS depth FROM folders WHERE id = $1
+		UNION ALL
+		SELECT p.id, p.parent_id, p.name, c.depth + 1
+		FROM chain c
+		JOIN folders p ON p.id = c.parent_id
+		WHERE c.depth < $2
+	),
+	limited AS (
+		SELECT c.id, c.name, c.depth, q.quota_bytes
+		FROM chain c
+		JOIN folder_quotas q ON q.folder_id = c.id
+	),
+	subtree AS (
+		SELECT l.id AS root, l.id, 0 AS depth FROM limited l
+		UNION ALL
+		SELECT s.root, f.id, s.depth + 1
+		FROM subtree s
+		JOIN folders f ON f.parent_id = s.id
+		WHERE s.depth < $2
+	)
+	SELECT l.id, l.name, l.quota_bytes, COALESCE((
+		SELECT SUM(fi.size)
+		FROM user_files uf
+		JOIN files fi ON fi.id = uf.file_id
+		WHERE uf.deleted_at IS NULL
+			AND uf.folder_id IN (SELECT s.id FROM subtree s WHERE s.root = l.id)
+	), 0)
+	FROM limited l
+	ORDER BY l.depth`
+
+func (r *folderRepository) GetFolderQuotaUsage(ctx context.Context, folderID uuid.UUID) ([]FolderQuotaUsage, error) {
+	rows, err := r.DB.Query(ctx, folderQuotaUsageQuery, folderID, maxFolderAccessDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []FolderQuotaUsage
+	for rows.Next() {
+		var u FolderQuotaUsage
+		if err := rows.Scan(&u.FolderID, &u.FolderName, &u.QuotaBytes, &u.UsedBytes); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
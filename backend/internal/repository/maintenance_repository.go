@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/useradityaa/internal/models"
+)
+
+// MaintenanceRepository reads and repairs bookkeeping across all users for offline maintenance.
+type MaintenanceRepository interface {
+	// ListFileRefCounts returns every file with its stored ref_count and actual mapping counts
+	ListFileRefCounts(ctx context.Context) ([]models.FileRefCount, error)
+	// SetFileRefCount overwrites a file's stored ref_count
+	SetFileRefCount(ctx context.Context, fileID uuid.UUID, refCount int) error
+	// ListUserUsage returns each user's logical usage, computed like GetUserUsageSum
+	ListUserUsage(ctx context.Context) (map[uuid.UUID]int64, error)
+	// ListUserQuotas returns every quota override in user_quotas, keyed by user
+	ListUserQuotas(ctx context.Context) (map[uuid.UUID]int64, error)
+}
+
+type maintenanceRepository struct{ DB *pgxpool.Pool }
+
+// NewMaintenanceRepository creates a new maintenance repository instance
+func NewMaintenanceRepository(db *pgxpool.Pool) MaintenanceRepository {
+	return &maintenanceRepository{DB: db}
+}
+
+func (r *maintenanceRepository) ListFileRefCounts(ctx context.Context) ([]models.FileRefCount, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT f.id, f.hash, f.storage_path, f.size, f.ref_count,
+		       COUNT(uf.id) FILTER (WHERE uf.deleted_at IS NULL), COUNT(uf.id)
+		FROM files f
+		LEFT JOIN user_files uf ON uf.file_id = f.id
+		GROUP BY f.id
+		ORDER BY f.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.FileRefCount
+	for rows.Next() {
+		var c models.FileRefCount
+		if err := rows.Scan(&c.FileID, &c.Hash, &c.StoragePath, &c.Size, &c.RefCount, &c.ActiveMappings, &c.TotalMappings); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (r *maintenanceRepository) SetFileRefCount(ctx context.Context, fileID uuid.UUID, refCount int) error {
+	_, err := r.DB.Exec(ctx, `UPDATE files SET ref_count = $2 WHERE id = $1`, fileID, refCount)
+	return err
+}
+
+func (r *maintenanceRepository) ListUserUsage(ctx context.Context) (map[uuid.UUID]int64, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT d.user_id, COALESCE(SUM(f.size), 0)
+		FROM (SELECT DISTINCT user_id, file_id FROM user_files WHERE deleted_at IS NULL AND role <> 'editor') d
+		JOIN files f ON f.id = d.file_id
+		GROUP BY d.user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := map[uuid.UUID]int64{}
+	for rows.Next() {
+		var id uuid.UUID
+		var used int64
+		if err := rows.Scan(&id, &used); err != nil {
+			return nil, err
+		}
+		usage[id] = used
+	}
+	return usage, rows.Err()
+}
+
+func (r *maintenanceRepository) ListUserQuotas(ctx context.Context) (map[uuid.UUID]int64, error) {
+	rows, err := r.DB.Query(ctx, `SELECT user_id, quota_bytes FROM user_quotas`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := map[uuid.UUID]int64{}
+	for rows.Next() {
+		var id uuid.UUID
+		var quota int64
+		if err := rows.Scan(&id, &quota); err != nil {
+			return nil, err
+		}
+		quotas[id] = quota
+	}
+	return quotas, rows.Err()
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/useradityaa/internal/models"
+)
+
+// OrganizationRepository stores organizations, their members and shared quotas.
+type OrganizationRepository interface {
+	// CreateOrganization inserts an organization; ID and CreatedAt are filled in
+	CreateOrganization(ctx context.Context, org *models.Organization) error
+	// GetOrganization returns the organization, or ErrNotFound
+	GetOrganization(ctx context.Context, orgID uuid.UUID) (*models.Organization, error)
+	// GetUserOrganization returns the organization the user belongs to, or nil without one
+	GetUserOrganization(ctx context.Context, userID uuid.UUID) (*models.Organization, error)
+	// SetQuota changes the organization's quota; ErrNotFound when it doesn't exist
+	SetQuota(ctx context.Context, orgID uuid.UUID, quotaBytes int64) error
+	// AddMember puts the user in the organization, moving them out of any other one
+	AddMember(ctx context.Context, orgID, userID uuid.UUID) error
+	// RemoveMember takes the user out of their organization; false when they had none
+	RemoveMember(ctx context.Context, userID uuid.UUID) (bool, error)
+	// GetOrganizationUsage sums every member's usage as charged to their personal quota
+	GetOrganizationUsage(ctx context.Context, orgID uuid.UUID) (int64, error)
+}
+
+type organizationRepository struct{ DB *pgxpool.Pool }
+
+// NewOrganizationRepository creates a new organization repository instance
+func NewOrganizationRepository(db *pgxpool.Pool) OrganizationRepository {
+	return &organizationRepository{DB: db}
+}
+
+func (r *organizationRepository) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	return r.DB.QueryRow(ctx, `
+		INSERT INTO organizations (name, quota_bytes)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`, org.Name, org.QuotaBytes).Scan(&org.ID, &org.CreatedAt)
+}
+
+func (r *organizationRepository) GetOrganization(ctx context.Context, orgID uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	err := r.DB.QueryRow(ctx, `
+		SELECT id, name, quota_bytes, created_at FROM organizations WHERE id = $1
+	`, orgID).Scan(&org.ID, &org.Name, &org.QuotaBytes, &org.CreatedAt)
+	if err != nil {
+		return nil, lookupErr("organization", err)
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) GetUserOrganization(ctx context.Context, userID uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	err := r.DB.QueryRow(ctx, `
+		SELECT o.id, o.name, o.quota_bytes, o.created_at
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1
+	`, userID).Scan(&org.ID, &org.Name, &org.QuotaBytes, &org.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) SetQuota(ctx context.Context, orgID uuid.UUID, quotaBytes int64) error {
+	tag, err := r.DB.Exec(ctx, `UPDATE organizations SET quota_bytes = $2 WHERE id = $1`, orgID, quotaBytes)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *organizationRepository) AddMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO organization_members (user_id, org_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET org_id = EXCLUDED.org_id, joined_at = NOW()
+	`, userID, orgID)
+	return err
+}
+
+func (r *organizationRepository) RemoveMember(ctx context.Context, userID uuid.UUID) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM organization_members WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetOrganizationUsage charges each member for the distinct content they hold, like
+// GetUserUsageSum, so content two members both keep counts once for each of them.
+func (r *organizationRepository) GetOrganizationUsage(ctx context.Context, orgID uuid.UUID) (int64, error) {
+	var sum int64
+	err := r.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(f.size), 0)
+		FROM files f
+		JOIN (
+			SELECT DISTINCT uf.user_id, uf.file_id
+			FROM user_files uf
+			JOIN organization_members m ON m.user_id = uf.user_id
+			WHERE m.org_id = $1 AND uf.deleted_at IS NULL AND uf.role <> 'editor'
+		) d ON d.file_id = f.id
+	`, orgID).Scan(&sum)
+	return sum, err
+}
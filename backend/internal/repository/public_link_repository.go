@@ -3,26 +3,73 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/useradityaa/internal/models"
 )
 
 type PublicLinkRepository interface {
-	CreateFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time) error
-	GetActiveFileLinkByFile(ctx context.Context, fileID uuid.UUID) (string, *time.Time, *time.Time, error)
-	GetFileLinkResolve(ctx context.Context, token string) (*models.File, *models.User, *time.Time, *time.Time, error)
+	// CreateFileLink stores a link; passwordHash is nil for links without a password and
+	// maxDownloads nil for links that may be downloaded any number of times. Expired and
+	// used-up links of the file are revoked first. A file keeps one unrevoked link, so when
+	// it still has a usable one nothing is stored; GetActiveFileLinkByFile tells which won.
+	// The owner's active links are counted in the same transaction, serialized per owner,
+	// and ErrLinkLimit is returned when they number limit or more; a negative limit skips it
+	CreateFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, maxDownloads *int64, limit int) error
+	// ReplaceFileLink revokes the file's active links and stores a new one in their place in
+	// one transaction, like CreateFileLink otherwise
+	ReplaceFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, maxDownloads *int64, limit int) error
+	// GetActiveFileLinkByFile returns the token and state of the file's most recent link,
+	// which may since have been revoked or expired
+	GetActiveFileLinkByFile(ctx context.Context, fileID uuid.UUID) (string, *models.LinkState, error)
+	// GetFileLinkResolve returns the linked file and its owner with the link's state
+	GetFileLinkResolve(ctx context.Context, token string) (*models.File, *models.User, *models.LinkState, error)
 	RevokeFileLink(ctx context.Context, fileID uuid.UUID) error
 
-	CreateFolderLink(ctx context.Context, folderID, ownerID uuid.UUID, token string, expiresAt *time.Time) error
+	// CreateFolderLink stores a folder link, within the owner's limit as in CreateFileLink
+	CreateFolderLink(ctx context.Context, folderID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, limit int) error
 	GetActiveFolderLinkByFolder(ctx context.Context, folderID uuid.UUID) (string, *time.Time, *time.Time, error)
-	GetFolderLinkResolve(ctx context.Context, token string) (*models.Folder, *models.User, *time.Time, *time.Time, error)
+	GetFolderLinkResolve(ctx context.Context, token string) (*models.Folder, *models.User, *models.LinkState, error)
 	RevokeFolderLink(ctx context.Context, folderID uuid.UUID) error
 
-	IncrementFileDownload(ctx context.Context, token string) error
+	// IncrementFileDownload counts a download of an unrevoked link unless that would take it
+	// past its max_downloads, checking and counting in one statement so concurrent downloads
+	// can't overshoot. Reports whether the download was counted
+	IncrementFileDownload(ctx context.Context, token string) (bool, error)
 	IncrementFolderAccess(ctx context.Context, token string) error
+
+	// RotateFileLink revokes the file's active links and issues newToken in their place in one
+	// transaction. With preserve the latest link's download count, download limit and expiry
+	// carry over; its password always does. Returns the new link's expiry
+	RotateFileLink(ctx context.Context, fileID uuid.UUID, newToken string, preserve bool) (*time.Time, error)
+	// RotateFolderLink is RotateFileLink for folder links, carrying over the access count
+	RotateFolderLink(ctx context.Context, folderID uuid.UUID, newToken string, preserve bool) (*time.Time, error)
+
+	// ListActiveLinksByOwner lists the owner's unrevoked, unexpired file and folder links, newest
+	// first. File links that used up their downloads count as expired
+	ListActiveLinksByOwner(ctx context.Context, ownerID uuid.UUID) ([]models.PublicLink, error)
+	// CountActiveLinksByOwner counts the links ListActiveLinksByOwner would return
+	CountActiveLinksByOwner(ctx context.Context, ownerID uuid.UUID) (int, error)
+	// RevokeAllLinksByOwner revokes every unrevoked file and folder link of the owner in one
+	// transaction, returning how many of each were revoked
+	RevokeAllLinksByOwner(ctx context.Context, ownerID uuid.UUID) (files int, folders int, err error)
+
+	// GetLinkDownloadBuckets counts the downloads recorded for token from from (inclusive) to
+	// to (exclusive), grouped into UTC hours or days as bucket says ("hour" or "day"). Only
+	// buckets with downloads are returned, oldest first
+	GetLinkDownloadBuckets(ctx context.Context, token string, from, to time.Time, bucket string) ([]models.DownloadBucket, error)
+	// CountLinkDownloads counts all downloads recorded for token, the total the buckets of
+	// GetLinkDownloadBuckets add up to over the link's whole life
+	CountLinkDownloads(ctx context.Context, token string) (int64, error)
+
+	// GetLinkLimit returns the admin override of the user's active link cap, nil without one
+	GetLinkLimit(ctx context.Context, userID uuid.UUID) (*int, error)
+	// SetLinkLimit stores the user's cap override; nil removes it
+	SetLinkLimit(ctx context.Context, userID uuid.UUID, limit *int) error
 }
 
 type publicLinkRepository struct{ DB *pgxpool.Pool }
@@ -31,40 +78,80 @@ func NewPublicLinkRepository(db *pgxpool.Pool) PublicLinkRepository {
 	return &publicLinkRepository{DB: db}
 }
 
-func (r *publicLinkRepository) CreateFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time) error {
-	_, err := r.DB.Exec(ctx, `INSERT INTO file_public_links (file_id, owner_id, token, expires_at) VALUES ($1,$2,$3,$4)`, fileID, ownerID, token, expiresAt)
-	return err
+func (r *publicLinkRepository) CreateFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, maxDownloads *int64, limit int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkLinkLimit(ctx, tx, ownerID, limit); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE file_public_links SET revoked_at=NOW()
+          WHERE file_id=$1 AND revoked_at IS NULL
+            AND ((expires_at IS NOT NULL AND expires_at <= NOW())
+                 OR (max_downloads IS NOT NULL AND COALESCE(download_count, 0) >= max_downloads))`, fileID); err != nil {
+		return err
+	}
+	// uq_file_public_links_active keeps a concurrent share from adding a second live link
+	if _, err := tx.Exec(ctx, `INSERT INTO file_public_links (file_id, owner_id, token, expires_at, password_hash, max_downloads) VALUES ($1,$2,$3,$4,$5,$6)
+          ON CONFLICT (file_id) WHERE revoked_at IS NULL DO NOTHING`, fileID, ownerID, token, expiresAt, passwordHash, maxDownloads); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (r *publicLinkRepository) GetActiveFileLinkByFile(ctx context.Context, fileID uuid.UUID) (string, *time.Time, *time.Time, error) {
+func (r *publicLinkRepository) ReplaceFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, maxDownloads *int64, limit int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkLinkLimit(ctx, tx, ownerID, limit); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE file_public_links SET revoked_at=NOW() WHERE file_id=$1 AND revoked_at IS NULL`, fileID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO file_public_links (file_id, owner_id, token, expires_at, password_hash, max_downloads) VALUES ($1,$2,$3,$4,$5,$6)`, fileID, ownerID, token, expiresAt, passwordHash, maxDownloads); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *publicLinkRepository) GetActiveFileLinkByFile(ctx context.Context, fileID uuid.UUID) (string, *models.LinkState, error) {
 	var token string
-	var expiresAt *time.Time
-	var revokedAt *time.Time
-	err := r.DB.QueryRow(ctx, `SELECT token, expires_at, revoked_at FROM file_public_links WHERE file_id=$1 ORDER BY created_at DESC LIMIT 1`, fileID).Scan(&token, &expiresAt, &revokedAt)
+	var state models.LinkState
+	err := r.DB.QueryRow(ctx, `SELECT token, created_at, expires_at, revoked_at, password_hash, COALESCE(download_count, 0), max_downloads
+          FROM file_public_links WHERE file_id=$1 ORDER BY created_at DESC LIMIT 1`, fileID).Scan(
+		&token, &state.CreatedAt, &state.ExpiresAt, &state.RevokedAt, &state.PasswordHash, &state.Downloads, &state.MaxDownloads)
 	if err != nil {
-		return "", nil, nil, err
+		return "", nil, lookupErr("public file link", err)
 	}
-	return token, expiresAt, revokedAt, nil
+	return token, &state, nil
 }
 
-func (r *publicLinkRepository) GetFileLinkResolve(ctx context.Context, token string) (*models.File, *models.User, *time.Time, *time.Time, error) {
+func (r *publicLinkRepository) GetFileLinkResolve(ctx context.Context, token string) (*models.File, *models.User, *models.LinkState, error) {
 	q := `SELECT f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-                 COALESCE(u.id, gu.id) as owner_id, COALESCE(u.email, gu.email) as owner_email, COALESCE(u.created_at, NOW()) as owner_created_at,
-                 l.expires_at, l.revoked_at
+                 l.owner_id, ` + accountColumns("u", "owner") + `,
+                 l.expires_at, l.revoked_at, l.password_hash, COALESCE(l.download_count, 0), l.max_downloads
           FROM file_public_links l
-          JOIN files f ON l.file_id = f.id
-          LEFT JOIN users u ON l.owner_id = u.id
-          LEFT JOIN google_users gu ON l.owner_id = gu.id
+          JOIN files f ON l.file_id = f.id` + accountJoin("u", "l.owner_id") + `
           WHERE l.token=$1`
 	var file models.File
-	var owner models.User
-	var expiresAt *time.Time
-	var revokedAt *time.Time
-	err := r.DB.QueryRow(ctx, q, token).Scan(&file.ID, &file.Hash, &file.OriginalName, &file.MimeType, &file.Size, &file.RefCount, &file.Visibility, &file.CreatedAt, &owner.ID, &owner.Email, &owner.CreatedAt, &expiresAt, &revokedAt)
-	if err != nil {
-		return nil, nil, nil, nil, err
+	var ownerID uuid.UUID
+	var owner accountRow
+	var state models.LinkState
+	dest := []interface{}{&file.ID, &file.Hash, &file.OriginalName, &file.MimeType, &file.Size, &file.RefCount, &file.Visibility, &file.CreatedAt, &ownerID}
+	dest = append(dest, owner.dest()...)
+	dest = append(dest, &state.ExpiresAt, &state.RevokedAt, &state.PasswordHash, &state.Downloads, &state.MaxDownloads)
+	if err := r.DB.QueryRow(ctx, q, token).Scan(dest...); err != nil {
+		return nil, nil, nil, lookupErr("public file link", err)
 	}
-	return &file, &owner, expiresAt, revokedAt, nil
+	user, _ := owner.user(ownerID)
+	return &file, &user, &state, nil
 }
 
 func (r *publicLinkRepository) RevokeFileLink(ctx context.Context, fileID uuid.UUID) error {
@@ -78,9 +165,40 @@ func (r *publicLinkRepository) RevokeFileLink(ctx context.Context, fileID uuid.U
 	return nil
 }
 
-func (r *publicLinkRepository) CreateFolderLink(ctx context.Context, folderID, ownerID uuid.UUID, token string, expiresAt *time.Time) error {
-	_, err := r.DB.Exec(ctx, `INSERT INTO folder_public_links (folder_id, owner_id, token, expires_at) VALUES ($1,$2,$3,$4)`, folderID, ownerID, token, expiresAt)
-	return err
+func (r *publicLinkRepository) CreateFolderLink(ctx context.Context, folderID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, limit int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkLinkLimit(ctx, tx, ownerID, limit); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO folder_public_links (folder_id, owner_id, token, expires_at, password_hash) VALUES ($1,$2,$3,$4,$5)`, folderID, ownerID, token, expiresAt, passwordHash); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// checkLinkLimit fails with ErrLinkLimit when ownerID has limit or more active links, and
+// does nothing for a negative limit. The transaction-scoped lock on the owner holds off
+// their other link creations until tx ends, so two of them can't both pass the count.
+func checkLinkLimit(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, limit int) error {
+	if limit < 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('public_links:' || $1::text, 0))`, ownerID); err != nil {
+		return err
+	}
+	var n int
+	if err := tx.QueryRow(ctx, activeLinksCountSQL, ownerID).Scan(&n); err != nil {
+		return err
+	}
+	if n >= limit {
+		return fmt.Errorf("owner %s has %d active links: %w", ownerID, n, ErrLinkLimit)
+	}
+	return nil
 }
 
 func (r *publicLinkRepository) GetActiveFolderLinkByFolder(ctx context.Context, folderID uuid.UUID) (string, *time.Time, *time.Time, error) {
@@ -94,24 +212,25 @@ func (r *publicLinkRepository) GetActiveFolderLinkByFolder(ctx context.Context,
 	return token, expiresAt, revokedAt, nil
 }
 
-func (r *publicLinkRepository) GetFolderLinkResolve(ctx context.Context, token string) (*models.Folder, *models.User, *time.Time, *time.Time, error) {
+func (r *publicLinkRepository) GetFolderLinkResolve(ctx context.Context, token string) (*models.Folder, *models.User, *models.LinkState, error) {
 	q := `SELECT fo.id, fo.name, fo.parent_id, fo.created_at,
-                 COALESCE(u.id, gu.id) as owner_id, COALESCE(u.email, gu.email) as owner_email, COALESCE(u.created_at, NOW()) as owner_created_at,
-                 l.expires_at, l.revoked_at
+                 l.owner_id, ` + accountColumns("u", "owner") + `,
+                 l.expires_at, l.revoked_at, l.password_hash, COALESCE(l.access_count, 0)
           FROM folder_public_links l
-          JOIN folders fo ON l.folder_id = fo.id
-          LEFT JOIN users u ON l.owner_id = u.id
-          LEFT JOIN google_users gu ON l.owner_id = gu.id
+          JOIN folders fo ON l.folder_id = fo.id AND fo.deleted_at IS NULL` + accountJoin("u", "l.owner_id") + `
           WHERE l.token=$1`
 	var folder models.Folder
-	var owner models.User
-	var expiresAt *time.Time
-	var revokedAt *time.Time
-	err := r.DB.QueryRow(ctx, q, token).Scan(&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt, &owner.ID, &owner.Email, &owner.CreatedAt, &expiresAt, &revokedAt)
-	if err != nil {
-		return nil, nil, nil, nil, err
+	var ownerID uuid.UUID
+	var owner accountRow
+	var state models.LinkState
+	dest := []interface{}{&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt, &ownerID}
+	dest = append(dest, owner.dest()...)
+	dest = append(dest, &state.ExpiresAt, &state.RevokedAt, &state.PasswordHash, &state.Downloads)
+	if err := r.DB.QueryRow(ctx, q, token).Scan(dest...); err != nil {
+		return nil, nil, nil, err
 	}
-	return &folder, &owner, expiresAt, revokedAt, nil
+	user, _ := owner.user(ownerID)
+	return &folder, &user, &state, nil
 }
 
 func (r *publicLinkRepository) RevokeFolderLink(ctx context.Context, folderID uuid.UUID) error {
@@ -125,11 +244,196 @@ func (r *publicLinkRepository) RevokeFolderLink(ctx context.Context, folderID uu
 	return nil
 }
 
-func (r *publicLinkRepository) IncrementFileDownload(ctx context.Context, token string) error {
-	_, err := r.DB.Exec(ctx, `UPDATE file_public_links SET download_count = download_count + 1 WHERE token=$1`, token)
-	return err
+func (r *publicLinkRepository) IncrementFileDownload(ctx context.Context, token string) (bool, error) {
+	var count int64
+	err := r.DB.QueryRow(ctx, `UPDATE file_public_links SET download_count = COALESCE(download_count, 0) + 1
+          WHERE token=$1 AND revoked_at IS NULL
+            AND (max_downloads IS NULL OR COALESCE(download_count, 0) < max_downloads)
+          RETURNING download_count`, token).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 func (r *publicLinkRepository) IncrementFolderAccess(ctx context.Context, token string) error {
 	_, err := r.DB.Exec(ctx, `UPDATE folder_public_links SET access_count = access_count + 1 WHERE token=$1`, token)
 	return err
 }
+
+func (r *publicLinkRepository) RotateFileLink(ctx context.Context, fileID uuid.UUID, newToken string, preserve bool) (*time.Time, error) {
+	return r.rotateLink(ctx, "file_public_links", "file_id", "download_count", "max_downloads", fileID, newToken, preserve)
+}
+
+func (r *publicLinkRepository) RotateFolderLink(ctx context.Context, folderID uuid.UUID, newToken string, preserve bool) (*time.Time, error) {
+	return r.rotateLink(ctx, "folder_public_links", "folder_id", "access_count", "", folderID, newToken, preserve)
+}
+
+// rotateLink backs RotateFileLink and RotateFolderLink; the table and column names are
+// fixed by the callers, never user input. limitCol is empty for links without a limit.
+func (r *publicLinkRepository) rotateLink(ctx context.Context, table, targetCol, countCol, limitCol string, targetID uuid.UUID, newToken string, preserve bool) (*time.Time, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	limit := "NULL::BIGINT"
+	if limitCol != "" {
+		limit = limitCol
+	}
+	var ownerID uuid.UUID
+	var expiresAt *time.Time
+	var count int64
+	var passwordHash *string
+	var maxCount *int64
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT owner_id, expires_at, COALESCE(%s, 0), password_hash, %s FROM %s WHERE %s=$1 AND revoked_at IS NULL ORDER BY created_at DESC LIMIT 1 FOR UPDATE`, countCol, limit, table, targetCol), targetID).Scan(&ownerID, &expiresAt, &count, &passwordHash, &maxCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("no active link")
+		}
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET revoked_at=NOW() WHERE %s=$1 AND revoked_at IS NULL`, table, targetCol), targetID); err != nil {
+		return nil, err
+	}
+	if !preserve {
+		expiresAt, count, maxCount = nil, 0, nil
+	}
+	// The password is kept either way: rotating a leaked link shouldn't unprotect it
+	insert := fmt.Sprintf(`INSERT INTO %s (%s, owner_id, token, expires_at, %s, password_hash) VALUES ($1,$2,$3,$4,$5,$6)`, table, targetCol, countCol)
+	args := []interface{}{targetID, ownerID, newToken, expiresAt, count, passwordHash}
+	if limitCol != "" {
+		insert = fmt.Sprintf(`INSERT INTO %s (%s, owner_id, token, expires_at, %s, password_hash, %s) VALUES ($1,$2,$3,$4,$5,$6,$7)`, table, targetCol, countCol, limitCol)
+		args = append(args, maxCount)
+	}
+	if _, err := tx.Exec(ctx, insert, args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return expiresAt, nil
+}
+
+func (r *publicLinkRepository) ListActiveLinksByOwner(ctx context.Context, ownerID uuid.UUID) ([]models.PublicLink, error) {
+	q := `SELECT 'file', l.file_id, f.original_name, l.token, l.created_at, l.expires_at, COALESCE(l.download_count, 0)
+          FROM file_public_links l
+          JOIN files f ON l.file_id = f.id
+          WHERE l.owner_id=$1 AND l.revoked_at IS NULL AND (l.expires_at IS NULL OR l.expires_at > NOW())
+            AND (l.max_downloads IS NULL OR COALESCE(l.download_count, 0) < l.max_downloads)
+          UNION ALL
+          SELECT 'folder', l.folder_id, f.name, l.token, l.created_at, l.expires_at, COALESCE(l.access_count, 0)
+          FROM folder_public_links l
+          JOIN folders f ON l.folder_id = f.id AND f.deleted_at IS NULL
+          WHERE l.owner_id=$1 AND l.revoked_at IS NULL AND (l.expires_at IS NULL OR l.expires_at > NOW())
+          ORDER BY 5 DESC`
+	rows, err := r.DB.Query(ctx, q, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.PublicLink
+	for rows.Next() {
+		var l models.PublicLink
+		if err := rows.Scan(&l.ItemType, &l.ItemID, &l.ItemName, &l.Token, &l.CreatedAt, &l.ExpiresAt, &l.AccessCount); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// activeLinksCountSQL counts the owner ($1) links that are neither revoked, expired nor used up
+const activeLinksCountSQL = `SELECT (SELECT COUNT(*) FROM file_public_links
+                  WHERE owner_id=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+                    AND (max_downloads IS NULL OR COALESCE(download_count, 0) < max_downloads))
+               + (SELECT COUNT(*) FROM folder_public_links
+                  WHERE owner_id=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()))`
+
+func (r *publicLinkRepository) CountActiveLinksByOwner(ctx context.Context, ownerID uuid.UUID) (int, error) {
+	var n int
+	if err := r.DB.QueryRow(ctx, activeLinksCountSQL, ownerID).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *publicLinkRepository) RevokeAllLinksByOwner(ctx context.Context, ownerID uuid.UUID) (int, int, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	files, err := tx.Exec(ctx, `UPDATE file_public_links SET revoked_at=NOW() WHERE owner_id=$1 AND revoked_at IS NULL`, ownerID)
+	if err != nil {
+		return 0, 0, err
+	}
+	folders, err := tx.Exec(ctx, `UPDATE folder_public_links SET revoked_at=NOW() WHERE owner_id=$1 AND revoked_at IS NULL`, ownerID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+	return int(files.RowsAffected()), int(folders.RowsAffected()), nil
+}
+
+func (r *publicLinkRepository) GetLinkDownloadBuckets(ctx context.Context, token string, from, to time.Time, bucket string) ([]models.DownloadBucket, error) {
+	if bucket != "hour" && bucket != "day" {
+		return nil, fmt.Errorf("unknown bucket %q", bucket)
+	}
+	rows, err := r.DB.Query(ctx, `
+		SELECT date_trunc($4, downloaded_at AT TIME ZONE 'UTC'), COUNT(*)
+		FROM file_downloads
+		WHERE share_token = $1 AND downloaded_at >= $2 AND downloaded_at < $3
+		GROUP BY 1
+		ORDER BY 1`, token, from, to, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.DownloadBucket
+	for rows.Next() {
+		var b models.DownloadBucket
+		if err := rows.Scan(&b.Start, &b.Downloads); err != nil {
+			return nil, err
+		}
+		b.Start = b.Start.UTC()
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (r *publicLinkRepository) CountLinkDownloads(ctx context.Context, token string) (int64, error) {
+	var n int64
+	if err := r.DB.QueryRow(ctx, `SELECT COUNT(*) FROM file_downloads WHERE share_token = $1`, token).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *publicLinkRepository) GetLinkLimit(ctx context.Context, userID uuid.UUID) (*int, error) {
+	var limit int
+	err := r.DB.QueryRow(ctx, `SELECT max_active_links FROM public_link_limits WHERE user_id=$1`, userID).Scan(&limit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+func (r *publicLinkRepository) SetLinkLimit(ctx context.Context, userID uuid.UUID, limit *int) error {
+	if limit == nil {
+		_, err := r.DB.Exec(ctx, `DELETE FROM public_link_limits WHERE user_id=$1`, userID)
+		return err
+	}
+	_, err := r.DB.Exec(ctx, `INSERT INTO public_link_limits (user_id, max_active_links) VALUES ($1,$2)
+          ON CONFLICT (user_id) DO UPDATE SET max_active_links=EXCLUDED.max_active_links, updated_at=NOW()`, userID, *limit)
+	return err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrQueryBudgetExceeded is the cause of a tracked context cancelled for running more
+// queries than its budget allows.
+var ErrQueryBudgetExceeded = errors.New("database query budget exceeded")
+
+// QueryBudget counts the queries run per request to surface N+1 patterns during
+// development and testing. Install it as the pool's tracer and wrap each request's
+// context with Track. A request going over Limit is logged once; with Enforce set its
+// context is also cancelled, so that query and every later one fails. A batch counts
+// as one query, since it is a single round trip.
+type QueryBudget struct {
+	// Limit is the most queries one request may run
+	Limit int
+	// Enforce fails requests over Limit instead of only logging them
+	Enforce bool
+	// Logf reports requests over Limit (nil uses log.Printf)
+	Logf func(format string, args ...any)
+}
+
+type queryBudgetKey struct{}
+
+// queryTally is the count for one tracked context.
+type queryTally struct {
+	label  string
+	n      atomic.Int64
+	cancel context.CancelCauseFunc
+}
+
+// Track returns a context whose queries count against the budget, and a function
+// returning how many ran so far. label names the request in log lines.
+func (b *QueryBudget) Track(ctx context.Context, label string) (context.Context, func() int) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	tally := &queryTally{label: label, cancel: cancel}
+	return context.WithValue(ctx, queryBudgetKey{}, tally), func() int { return int(tally.n.Load()) }
+}
+
+// count records one query for ctx, reporting the first one over the limit.
+func (b *QueryBudget) count(ctx context.Context, sql string) context.Context {
+	tally, ok := ctx.Value(queryBudgetKey{}).(*queryTally)
+	if !ok {
+		return ctx
+	}
+	n := tally.n.Add(1)
+	if n <= int64(b.Limit) {
+		return ctx
+	}
+	if n == int64(b.Limit)+1 {
+		logf := b.Logf
+		if logf == nil {
+			logf = log.Printf
+		}
+		logf("query budget: %s ran more than %d queries; query %d was %q", tally.label, b.Limit, n, strings.Join(strings.Fields(sql), " "))
+	}
+	if b.Enforce {
+		tally.cancel(ErrQueryBudgetExceeded)
+	}
+	return ctx
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (b *QueryBudget) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return b.count(ctx, data.SQL)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (b *QueryBudget) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// TraceBatchStart implements pgx.BatchTracer; the batch counts once.
+func (b *QueryBudget) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	sql := "batch"
+	if data.Batch != nil && len(data.Batch.QueuedQueries) > 0 {
+		sql = data.Batch.QueuedQueries[0].SQL
+	}
+	return b.count(ctx, sql)
+}
+
+// TraceBatchQuery implements pgx.BatchTracer.
+func (b *QueryBudget) TraceBatchQuery(context.Context, *pgx.Conn, pgx.TraceBatchQueryData) {}
+
+// TraceBatchEnd implements pgx.BatchTracer.
+func (b *QueryBudget) TraceBatchEnd(context.Context, *pgx.Conn, pgx.TraceBatchEndData) {}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestQueryBudget_LogsOnceOverLimit(t *testing.T) {
+	var logged []string
+	budget := &QueryBudget{Limit: 2, Logf: func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) }}
+	ctx, count := budget.Track(context.Background(), "POST /query")
+
+	for i := 0; i < 4; i++ {
+		ctx = budget.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT *\n\t FROM files WHERE id = $1"})
+	}
+	if count() != 4 {
+		t.Fatalf("expected 4 queries counted, got %d", count())
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "POST /query ran more than 2 queries") || !strings.Contains(logged[0], `"SELECT * FROM files WHERE id = $1"`) {
+		t.Fatalf("expected one log line for the request, got %q", logged)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("expected a logging-only budget to leave the request running")
+	}
+}
+
+func TestQueryBudget_EnforceCancelsRequest(t *testing.T) {
+	budget := &QueryBudget{Limit: 1, Enforce: true, Logf: func(string, ...any) {}}
+	ctx, _ := budget.Track(context.Background(), "POST /query")
+
+	if ctx = budget.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"}); ctx.Err() != nil {
+		t.Fatalf("expected the query within budget to run")
+	}
+	ctx = budget.TraceBatchStart(ctx, nil, pgx.TraceBatchStartData{Batch: &pgx.Batch{}})
+	if !errors.Is(context.Cause(ctx), ErrQueryBudgetExceeded) {
+		t.Fatalf("expected the request to be cancelled by the budget, got %v", context.Cause(ctx))
+	}
+}
+
+func TestQueryBudget_UntrackedContext(t *testing.T) {
+	budget := &QueryBudget{Limit: 0, Enforce: true, Logf: func(string, ...any) { t.Fatalf("untracked queries must not be logged") }}
+	ctx := budget.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	if ctx.Err() != nil {
+		t.Fatalf("expected queries outside a request to be left alone")
+	}
+}
@@ -0,0 +1,13 @@
+package repository
+
+import "github.com/jackc/pgx/v5/pgxpool"
+
+// ReadPool picks the pool for read-heavy or analytic queries: the read replica
+// when one is configured, otherwise the primary. Replicas may lag the primary,
+// so anything that must see a just-committed write should keep using the primary.
+func ReadPool(primary, replica *pgxpool.Pool) *pgxpool.Pool {
+	if replica != nil {
+		return replica
+	}
+	return primary
+}
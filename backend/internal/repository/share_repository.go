@@ -2,9 +2,11 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/useradityaa/internal/models"
 )
@@ -12,21 +14,43 @@ import (
 type ShareRepository interface {
 	// File sharing
 	CreateFileShare(ctx context.Context, fileID, ownerID uuid.UUID, sharedWithEmail string, permission string, expiresAt *time.Time) (*models.FileShare, error)
+	// CreateFileShares shares every file with every email in one statement; the shares carry no file or owner details
+	CreateFileShares(ctx context.Context, ownerID uuid.UUID, fileIDs []uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FileShare, error)
 	GetFileShares(ctx context.Context, fileID uuid.UUID) ([]models.FileShare, error)
 	GetFileSharesForUser(ctx context.Context, userEmail string) ([]models.FileShare, error)
+	// GetFileSharesByOwner lists the file shares the user has created, newest first: the
+	// unexpired ones, and with includeExpired the expired ones too
+	GetFileSharesByOwner(ctx context.Context, ownerID uuid.UUID, includeExpired bool) ([]models.FileShare, error)
 	DeleteFileShare(ctx context.Context, fileID uuid.UUID, sharedWithEmail string) error
+	// DeleteAllFileShares removes every share of the file and returns how many there were
+	DeleteAllFileShares(ctx context.Context, fileID uuid.UUID) (int64, error)
+	// UpdateFileSharePermission changes the permission of an existing share; nil when there is no such share
+	UpdateFileSharePermission(ctx context.Context, fileID uuid.UUID, sharedWithEmail string, permission string) (*models.FileShare, error)
+	// GetFileShareAccess lists the file's shares with each recipient's latest download and preview
+	GetFileShareAccess(ctx context.Context, fileID uuid.UUID) ([]models.ShareAccess, error)
 
 	// Folder sharing
 	CreateFolderShare(ctx context.Context, folderID, ownerID uuid.UUID, sharedWithEmail string, permission string, expiresAt *time.Time) (*models.FolderShare, error)
 	GetFolderShares(ctx context.Context, folderID uuid.UUID) ([]models.FolderShare, error)
 	GetFolderSharesForUser(ctx context.Context, userEmail string) ([]models.FolderShare, error)
+	// GetFolderSharesByOwner is GetFileSharesByOwner for folder shares
+	GetFolderSharesByOwner(ctx context.Context, ownerID uuid.UUID, includeExpired bool) ([]models.FolderShare, error)
 	DeleteFolderShare(ctx context.Context, folderID uuid.UUID, sharedWithEmail string) error
+	// DeleteAllFolderShares removes every share of the folder and returns how many there were
+	DeleteAllFolderShares(ctx context.Context, folderID uuid.UUID) (int64, error)
+	// UpdateFolderSharePermission changes the permission of an existing share; nil when there is no such share
+	UpdateFolderSharePermission(ctx context.Context, folderID uuid.UUID, sharedWithEmail string, permission string) (*models.FolderShare, error)
 
 	// Check permissions
 	HasFileAccess(ctx context.Context, userID uuid.UUID, userEmail string, fileID uuid.UUID) (bool, string, error)
 	HasFolderAccess(ctx context.Context, userID uuid.UUID, userEmail string, folderID uuid.UUID) (bool, string, error)
+	// GetFileAccessLevels is HasFileAccess for many files in one query; files without access are omitted
+	GetFileAccessLevels(ctx context.Context, userID uuid.UUID, userEmail string, fileIDs []uuid.UUID) (map[uuid.UUID]string, error)
+	// GetFolderAccessLevels is HasFolderAccess for many folders in one query; folders without access are omitted
+	GetFolderAccessLevels(ctx context.Context, userID uuid.UUID, userEmail string, folderIDs []uuid.UUID) (map[uuid.UUID]string, error)
 
-	// Get folder contents
+	// Get folder contents; GetFolderFiles lists only the folder owner's active files, with
+	// the editor who added a file as its uploader
 	GetFolderFiles(ctx context.Context, folderID uuid.UUID) ([]models.UserFile, error)
 	GetDirectSubfolders(ctx context.Context, folderID uuid.UUID) ([]models.Folder, error)
 }
@@ -56,6 +80,38 @@ func (r *shareRepository) CreateFileShare(ctx context.Context, fileID, ownerID u
 	return r.getFileShareByID(ctx, id)
 }
 
+// CreateFileShares is CreateFileShare for each pair of file and email, as one insert so the
+// batch is stored entirely or not at all. Existing shares get the new permission and expiry.
+// fileIDs and emails must not repeat, since one statement can't update a row twice.
+func (r *shareRepository) CreateFileShares(ctx context.Context, ownerID uuid.UUID, fileIDs []uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FileShare, error) {
+	if len(fileIDs) == 0 || len(emails) == 0 {
+		return []models.FileShare{}, nil
+	}
+	query := `INSERT INTO file_shares (id, file_id, owner_id, shared_with_email, permission, shared_at, expires_at)
+	          SELECT gen_random_uuid(), f.id, $1, e.email, $4, NOW(), $5
+	          FROM unnest($2::uuid[]) AS f(id) CROSS JOIN unnest($3::text[]) AS e(email)
+	          ON CONFLICT (file_id, shared_with_email)
+	          DO UPDATE SET permission = EXCLUDED.permission, expires_at = EXCLUDED.expires_at
+	          RETURNING id, file_id, owner_id, shared_with_email, shared_with_id, permission, shared_at, expires_at`
+
+	rows, err := r.DB.Query(ctx, query, ownerID, fileIDs, emails, permission, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.FileShare{}
+	for rows.Next() {
+		var share models.FileShare
+		if err := rows.Scan(&share.ID, &share.FileID, &share.OwnerID, &share.SharedWithEmail, &share.SharedWithID,
+			&share.Permission, &share.SharedAt, &share.ExpiresAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
 func (r *shareRepository) getFileShareByID(ctx context.Context, shareID uuid.UUID) (*models.FileShare, error) {
 	query := `SELECT fs.id, fs.file_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id, 
 	                 fs.permission, fs.shared_at, fs.expires_at,
@@ -74,7 +130,7 @@ func (r *shareRepository) getFileShareByID(ctx context.Context, shareID uuid.UUI
 		&file.RefCount, &file.Visibility, &file.CreatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, lookupErr("file share", err)
 	}
 
 	share.File = file
@@ -117,20 +173,57 @@ func (r *shareRepository) GetFileShares(ctx context.Context, fileID uuid.UUID) (
 	return shares, nil
 }
 
-func (r *shareRepository) GetFileSharesForUser(ctx context.Context, userEmail string) ([]models.FileShare, error) {
-	query := `SELECT fs.id, fs.file_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id, 
+// GetFileShareAccess joins the file's shares to download and activity records by recipient.
+// Recipients are matched by shared_with_id, or by email when the share predates their account.
+func (r *shareRepository) GetFileShareAccess(ctx context.Context, fileID uuid.UUID) ([]models.ShareAccess, error) {
+	query := `SELECT fs.id, fs.shared_with_email, rcpt.id, fs.shared_at,
+	                 (SELECT MAX(t) FROM (
+	                     SELECT d.downloaded_at AS t FROM file_downloads d
+	                     WHERE d.file_id = fs.file_id AND d.downloaded_by = rcpt.id
+	                     UNION ALL
+	                     SELECT a.activity_at FROM file_activities a
+	                     WHERE a.file_id = fs.file_id AND a.user_id = rcpt.id AND a.activity_type = 'download'
+	                 ) dl) AS last_downloaded_at,
+	                 (SELECT MAX(a.activity_at) FROM file_activities a
+	                  WHERE a.file_id = fs.file_id AND a.user_id = rcpt.id AND a.activity_type = 'preview') AS last_previewed_at
+	          FROM file_shares fs
+	          LEFT JOIN LATERAL (
+	              SELECT COALESCE(fs.shared_with_id,
+	                              (SELECT u.id FROM users u WHERE u.email = fs.shared_with_email LIMIT 1),
+	                              (SELECT gu.id FROM google_users gu WHERE gu.email = fs.shared_with_email LIMIT 1)) AS id
+	          ) rcpt ON true
+	          WHERE fs.file_id = $1
+	          ORDER BY fs.shared_at`
+
+	rows, err := r.DB.Query(ctx, query, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.ShareAccess
+	for rows.Next() {
+		var a models.ShareAccess
+		if err := rows.Scan(&a.ShareID, &a.SharedWithEmail, &a.RecipientID, &a.SharedAt, &a.LastDownloadedAt, &a.LastPreviewedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// fileSharesForUserSQL lists the unexpired file shares sent to an email, with each file and
+// its owner. The owner's id is the share's own owner_id.
+var fileSharesForUserSQL = `SELECT fs.id, fs.file_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id, 
 	                 fs.permission, fs.shared_at, fs.expires_at,
 	                 f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-	                 COALESCE(u.id, gu.id) as owner_id, 
-	                 COALESCE(u.email, gu.email) as owner_email, 
-	                 COALESCE(u.created_at, NOW()) as owner_created_at
+	                 ` + accountColumns("u", "owner") + `
 	          FROM file_shares fs
-	          JOIN files f ON fs.file_id = f.id
-	          LEFT JOIN users u ON fs.owner_id = u.id
-	          LEFT JOIN google_users gu ON fs.owner_id = gu.id
+	          JOIN files f ON fs.file_id = f.id` + accountJoin("u", "fs.owner_id") + `
 	          WHERE fs.shared_with_email = $1 AND (fs.expires_at IS NULL OR fs.expires_at > NOW())`
 
-	rows, err := r.DB.Query(ctx, query, userEmail)
+func (r *shareRepository) GetFileSharesForUser(ctx context.Context, userEmail string) ([]models.FileShare, error) {
+	rows, err := r.DB.Query(ctx, fileSharesForUserSQL, userEmail)
 	if err != nil {
 		return nil, err
 	}
@@ -140,33 +233,85 @@ func (r *shareRepository) GetFileSharesForUser(ctx context.Context, userEmail st
 	for rows.Next() {
 		var share models.FileShare
 		var file models.File
-		var owner models.User
+		var owner accountRow
 
-		err := rows.Scan(
+		dest := []interface{}{
 			&share.ID, &share.FileID, &share.OwnerID, &share.SharedWithEmail, &share.SharedWithID,
 			&share.Permission, &share.SharedAt, &share.ExpiresAt,
 			&file.ID, &file.Hash, &file.OriginalName, &file.MimeType, &file.Size,
 			&file.RefCount, &file.Visibility, &file.CreatedAt,
-			&owner.ID, &owner.Email, &owner.CreatedAt,
-		)
-		if err != nil {
+		}
+		if err := rows.Scan(append(dest, owner.dest()...)...); err != nil {
 			return nil, err
 		}
 
 		share.File = file
-		share.Owner = owner
+		share.Owner, _ = owner.user(share.OwnerID)
 		shares = append(shares, share)
 	}
 
 	return shares, nil
 }
 
+func (r *shareRepository) GetFileSharesByOwner(ctx context.Context, ownerID uuid.UUID, includeExpired bool) ([]models.FileShare, error) {
+	query := `SELECT fs.id, fs.file_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id,
+	                 fs.permission, fs.shared_at, fs.expires_at,
+	                 f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at
+	          FROM file_shares fs
+	          JOIN files f ON fs.file_id = f.id
+	          WHERE fs.owner_id = $1 AND ($2 OR fs.expires_at IS NULL OR fs.expires_at > NOW())
+	          ORDER BY fs.shared_at DESC`
+
+	rows, err := r.DB.Query(ctx, query, ownerID, includeExpired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []models.FileShare
+	for rows.Next() {
+		var share models.FileShare
+		err := rows.Scan(
+			&share.ID, &share.FileID, &share.OwnerID, &share.SharedWithEmail, &share.SharedWithID,
+			&share.Permission, &share.SharedAt, &share.ExpiresAt,
+			&share.File.ID, &share.File.Hash, &share.File.OriginalName, &share.File.MimeType, &share.File.Size,
+			&share.File.RefCount, &share.File.Visibility, &share.File.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
 func (r *shareRepository) DeleteFileShare(ctx context.Context, fileID uuid.UUID, sharedWithEmail string) error {
 	query := `DELETE FROM file_shares WHERE file_id = $1 AND shared_with_email = $2`
 	_, err := r.DB.Exec(ctx, query, fileID, sharedWithEmail)
 	return err
 }
 
+func (r *shareRepository) DeleteAllFileShares(ctx context.Context, fileID uuid.UUID) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM file_shares WHERE file_id = $1`, fileID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *shareRepository) UpdateFileSharePermission(ctx context.Context, fileID uuid.UUID, sharedWithEmail string, permission string) (*models.FileShare, error) {
+	query := `UPDATE file_shares SET permission = $3 WHERE file_id = $1 AND shared_with_email = $2 RETURNING id`
+	var id uuid.UUID
+	if err := r.DB.QueryRow(ctx, query, fileID, sharedWithEmail, permission).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return r.getFileShareByID(ctx, id)
+}
+
 // Folder sharing implementation
 func (r *shareRepository) CreateFolderShare(ctx context.Context, folderID, ownerID uuid.UUID, sharedWithEmail string, permission string, expiresAt *time.Time) (*models.FolderShare, error) {
 	id := uuid.New()
@@ -190,7 +335,7 @@ func (r *shareRepository) getFolderShareByID(ctx context.Context, shareID uuid.U
 	                 fs.permission, fs.shared_at, fs.expires_at,
 	                 f.id, f.name, f.parent_id, f.created_at
 	          FROM folder_shares fs
-	          JOIN folders f ON fs.folder_id = f.id
+	          JOIN folders f ON fs.folder_id = f.id AND f.deleted_at IS NULL
 	          WHERE fs.id = $1`
 
 	var share models.FolderShare
@@ -202,7 +347,7 @@ func (r *shareRepository) getFolderShareByID(ctx context.Context, shareID uuid.U
 		&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, lookupErr("folder share", err)
 	}
 
 	share.Folder = folder
@@ -214,7 +359,7 @@ func (r *shareRepository) GetFolderShares(ctx context.Context, folderID uuid.UUI
 	                 fs.permission, fs.shared_at, fs.expires_at,
 	                 f.id, f.name, f.parent_id, f.created_at
 	          FROM folder_shares fs
-	          JOIN folders f ON fs.folder_id = f.id
+	          JOIN folders f ON fs.folder_id = f.id AND f.deleted_at IS NULL
 	          WHERE fs.folder_id = $1`
 
 	rows, err := r.DB.Query(ctx, query, folderID)
@@ -244,20 +389,18 @@ func (r *shareRepository) GetFolderShares(ctx context.Context, folderID uuid.UUI
 	return shares, nil
 }
 
-func (r *shareRepository) GetFolderSharesForUser(ctx context.Context, userEmail string) ([]models.FolderShare, error) {
-	query := `SELECT fs.id, fs.folder_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id, 
+// folderSharesForUserSQL lists the unexpired folder shares sent to an email, with each
+// folder and its owner. The owner's id is the share's own owner_id.
+var folderSharesForUserSQL = `SELECT fs.id, fs.folder_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id, 
 	                 fs.permission, fs.shared_at, fs.expires_at,
 	                 f.id, f.name, f.parent_id, f.created_at,
-	                 COALESCE(u.id, gu.id) as owner_id, 
-	                 COALESCE(u.email, gu.email) as owner_email, 
-	                 COALESCE(u.created_at, NOW()) as owner_created_at
+	                 ` + accountColumns("u", "owner") + `
 	          FROM folder_shares fs
-	          JOIN folders f ON fs.folder_id = f.id
-	          LEFT JOIN users u ON fs.owner_id = u.id
-	          LEFT JOIN google_users gu ON fs.owner_id = gu.id
+	          JOIN folders f ON fs.folder_id = f.id AND f.deleted_at IS NULL` + accountJoin("u", "fs.owner_id") + `
 	          WHERE fs.shared_with_email = $1 AND (fs.expires_at IS NULL OR fs.expires_at > NOW())`
 
-	rows, err := r.DB.Query(ctx, query, userEmail)
+func (r *shareRepository) GetFolderSharesForUser(ctx context.Context, userEmail string) ([]models.FolderShare, error) {
+	rows, err := r.DB.Query(ctx, folderSharesForUserSQL, userEmail)
 	if err != nil {
 		return nil, err
 	}
@@ -267,36 +410,88 @@ func (r *shareRepository) GetFolderSharesForUser(ctx context.Context, userEmail
 	for rows.Next() {
 		var share models.FolderShare
 		var folder models.Folder
-		var owner models.User
+		var owner accountRow
 
-		err := rows.Scan(
+		dest := []interface{}{
 			&share.ID, &share.FolderID, &share.OwnerID, &share.SharedWithEmail, &share.SharedWithID,
 			&share.Permission, &share.SharedAt, &share.ExpiresAt,
 			&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt,
-			&owner.ID, &owner.Email, &owner.CreatedAt,
-		)
-		if err != nil {
+		}
+		if err := rows.Scan(append(dest, owner.dest()...)...); err != nil {
 			return nil, err
 		}
 
 		share.Folder = folder
-		share.Owner = owner
+		share.Owner, _ = owner.user(share.OwnerID)
 		shares = append(shares, share)
 	}
 
 	return shares, nil
 }
 
+func (r *shareRepository) GetFolderSharesByOwner(ctx context.Context, ownerID uuid.UUID, includeExpired bool) ([]models.FolderShare, error) {
+	query := `SELECT fs.id, fs.folder_id, fs.owner_id, fs.shared_with_email, fs.shared_with_id,
+	                 fs.permission, fs.shared_at, fs.expires_at,
+	                 f.id, f.name, f.parent_id, f.created_at
+	          FROM folder_shares fs
+	          JOIN folders f ON fs.folder_id = f.id AND f.deleted_at IS NULL
+	          WHERE fs.owner_id = $1 AND ($2 OR fs.expires_at IS NULL OR fs.expires_at > NOW())
+	          ORDER BY fs.shared_at DESC`
+
+	rows, err := r.DB.Query(ctx, query, ownerID, includeExpired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []models.FolderShare
+	for rows.Next() {
+		var share models.FolderShare
+		err := rows.Scan(
+			&share.ID, &share.FolderID, &share.OwnerID, &share.SharedWithEmail, &share.SharedWithID,
+			&share.Permission, &share.SharedAt, &share.ExpiresAt,
+			&share.Folder.ID, &share.Folder.Name, &share.Folder.ParentID, &share.Folder.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
 func (r *shareRepository) DeleteFolderShare(ctx context.Context, folderID uuid.UUID, sharedWithEmail string) error {
 	query := `DELETE FROM folder_shares WHERE folder_id = $1 AND shared_with_email = $2`
 	_, err := r.DB.Exec(ctx, query, folderID, sharedWithEmail)
 	return err
 }
 
+func (r *shareRepository) DeleteAllFolderShares(ctx context.Context, folderID uuid.UUID) (int64, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM folder_shares WHERE folder_id = $1`, folderID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *shareRepository) UpdateFolderSharePermission(ctx context.Context, folderID uuid.UUID, sharedWithEmail string, permission string) (*models.FolderShare, error) {
+	query := `UPDATE folder_shares SET permission = $3 WHERE folder_id = $1 AND shared_with_email = $2 RETURNING id`
+	var id uuid.UUID
+	if err := r.DB.QueryRow(ctx, query, folderID, sharedWithEmail, permission).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return r.getFolderShareByID(ctx, id)
+}
+
 // Permission checking functions
 func (r *shareRepository) HasFileAccess(ctx context.Context, userID uuid.UUID, userEmail string, fileID uuid.UUID) (bool, string, error) {
 	// Check if user owns the file
-	query := `SELECT role FROM user_files WHERE user_id = $1 AND file_id = $2 AND deleted_at IS NULL`
+	// An owner mapping wins over the editor mapping left from handing the file to someone else
+	query := `SELECT role FROM user_files WHERE user_id = $1 AND file_id = $2 AND deleted_at IS NULL ORDER BY (role = 'owner') DESC LIMIT 1`
 	var role string
 	err := r.DB.QueryRow(ctx, query, userID, fileID).Scan(&role)
 	if err == nil {
@@ -311,20 +506,40 @@ func (r *shareRepository) HasFileAccess(ctx context.Context, userID uuid.UUID, u
 		return true, permission, nil
 	}
 
+	// Check if an owner made the file public
+	query = `SELECT visibility FROM user_files WHERE file_id = $1 AND role = 'owner' AND visibility = 'public' AND deleted_at IS NULL LIMIT 1`
+	var visibility string
+	err = r.DB.QueryRow(ctx, query, fileID).Scan(&visibility)
+	if err == nil {
+		has, permission := visibilityAccess(visibility)
+		return has, permission, nil
+	}
+
 	return false, "", nil
 }
 
+// visibilityAccess is the access a file's visibility grants a signed-in user without a mapping
+// or share: public files can be viewed by anyone, private and shared files by nobody else.
+func visibilityAccess(visibility string) (bool, string) {
+	if visibility == models.VisibilityPublic {
+		return true, "viewer"
+	}
+	return false, ""
+}
+
 func (r *shareRepository) HasFolderAccess(ctx context.Context, userID uuid.UUID, userEmail string, folderID uuid.UUID) (bool, string, error) {
 	// Check if user owns the folder
-	query := `SELECT 'owner' FROM folders WHERE user_id = $1 AND id = $2`
+	query := `SELECT 'owner' FROM folders WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL`
 	var role string
 	err := r.DB.QueryRow(ctx, query, userID, folderID).Scan(&role)
 	if err == nil {
 		return true, role, nil
 	}
 
-	// Check if folder is directly shared with user
-	query = `SELECT permission FROM folder_shares WHERE folder_id = $1 AND shared_with_email = $2 AND (expires_at IS NULL OR expires_at > NOW())`
+	// Check if folder is directly shared with user; a trashed folder grants nothing
+	query = `SELECT fs.permission FROM folder_shares fs
+	         JOIN folders f ON f.id = fs.folder_id AND f.deleted_at IS NULL
+	         WHERE fs.folder_id = $1 AND fs.shared_with_email = $2 AND (fs.expires_at IS NULL OR fs.expires_at > NOW())`
 	var permission string
 	err = r.DB.QueryRow(ctx, query, folderID, userEmail).Scan(&permission)
 	if err == nil {
@@ -343,61 +558,193 @@ func (r *shareRepository) HasFolderAccess(ctx context.Context, userID uuid.UUID,
 	return false, "", nil
 }
 
+// ancestorAccess is one ancestor of a folder that grants the user access, depth 1 being the parent
+type ancestorAccess struct {
+	Depth      int
+	Owned      bool
+	Permission string
+}
+
+// nearestAncestorAccess picks the permission the closest granting ancestor gives, preferring
+// ownership over a share on the same level, as the per-level walk up the tree would.
+func nearestAncestorAccess(levels []ancestorAccess) (bool, string) {
+	var best *ancestorAccess
+	for i := range levels {
+		l := &levels[i]
+		if !l.Owned && l.Permission == "" {
+			continue
+		}
+		if best == nil || l.Depth < best.Depth || (l.Depth == best.Depth && l.Owned && !best.Owned) {
+			best = l
+		}
+	}
+	if best == nil {
+		return false, ""
+	}
+	if best.Owned {
+		return true, "owner"
+	}
+	return true, best.Permission
+}
+
+// parentFolderAccessQuery walks the folder's ancestors in one query, stopping after
+// maxFolderAccessDepth levels so a parent_id cycle cannot loop forever, and returns every
+// ancestor the user owns or has an unexpired share on. The walk stops at trashed folders,
+// so nothing in the trash is reachable through a share.
+const parentFolderAccessQuery = `
+	WITH RECURSIVE ancestors AS (
+		SELECT p.id, p.parent_id, p.user_id, 1 AS depth
+		FROM folders f
+		JOIN folders p ON p.id = f.parent_id AND p.deleted_at IS NULL
+		WHERE f.id = $3 AND f.deleted_at IS NULL
+		UNION ALL
+		SELECT p.id, p.parent_id, p.user_id, a.depth + 1
+		FROM ancestors a
+		JOIN folders p ON p.id = a.parent_id AND p.deleted_at IS NULL
+		WHERE a.depth < $4
+	)
+	SELECT a.depth, a.user_id = $1, COALESCE(fs.permission, '')
+	FROM ancestors a
+	LEFT JOIN folder_shares fs ON fs.folder_id = a.id
+		AND fs.shared_with_email = $2
+		AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+	WHERE a.user_id = $1 OR fs.permission IS NOT NULL
+	ORDER BY a.depth`
+
 // hasParentFolderAccess checks if user has access to any parent folder
 func (r *shareRepository) hasParentFolderAccess(ctx context.Context, userID uuid.UUID, userEmail string, folderID uuid.UUID) (bool, string, error) {
-	// Get the parent folder ID
-	var parentID *uuid.UUID
-	query := `SELECT parent_id FROM folders WHERE id = $1`
-	err := r.DB.QueryRow(ctx, query, folderID).Scan(&parentID)
+	rows, err := r.DB.Query(ctx, parentFolderAccessQuery, userID, userEmail, folderID, maxFolderAccessDepth)
 	if err != nil {
-		// If there's an error or no parent, no inherited access
-		return false, "", nil
+		return false, "", err
 	}
+	defer rows.Close()
 
-	if parentID == nil {
-		// Reached root level, no inherited access
-		return false, "", nil
+	var levels []ancestorAccess
+	for rows.Next() {
+		var l ancestorAccess
+		if err := rows.Scan(&l.Depth, &l.Owned, &l.Permission); err != nil {
+			return false, "", err
+		}
+		levels = append(levels, l)
 	}
-
-	// Check if user owns the parent folder
-	query = `SELECT 'owner' FROM folders WHERE user_id = $1 AND id = $2`
-	var role string
-	err = r.DB.QueryRow(ctx, query, userID, *parentID).Scan(&role)
-	if err == nil {
-		return true, role, nil
+	if err := rows.Err(); err != nil {
+		return false, "", err
 	}
 
-	// Check if parent folder is shared with user
-	query = `SELECT permission FROM folder_shares WHERE folder_id = $1 AND shared_with_email = $2 AND (expires_at IS NULL OR expires_at > NOW())`
-	var permission string
-	err = r.DB.QueryRow(ctx, query, *parentID, userEmail).Scan(&permission)
-	if err == nil {
-		return true, permission, nil
+	has, permission := nearestAncestorAccess(levels)
+	return has, permission, nil
+}
+
+// maxFolderAccessDepth bounds how many ancestors a folder access check walks, so a
+// parent_id cycle cannot loop forever
+const maxFolderAccessDepth = 64
+
+// GetFileAccessLevels applies HasFileAccess's rules to every file at once: the user's own
+// mapping wins (preferring an owner mapping), then an unexpired share to userEmail, then
+// viewer access to files an owner made public.
+func (r *shareRepository) GetFileAccessLevels(ctx context.Context, userID uuid.UUID, userEmail string, fileIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	levels := make(map[uuid.UUID]string)
+	if len(fileIDs) == 0 {
+		return levels, nil
 	}
+	query := `
+		SELECT ids.id, COALESCE(
+			(SELECT uf.role FROM user_files uf
+			 WHERE uf.user_id = $1 AND uf.file_id = ids.id AND uf.deleted_at IS NULL
+			 ORDER BY (uf.role = 'owner') DESC LIMIT 1),
+			(SELECT fs.permission FROM file_shares fs
+			 WHERE fs.file_id = ids.id AND fs.shared_with_email = $2
+			   AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+			 LIMIT 1),
+			(SELECT 'viewer' FROM user_files pv
+			 WHERE pv.file_id = ids.id AND pv.role = 'owner' AND pv.visibility = 'public' AND pv.deleted_at IS NULL
+			 LIMIT 1)
+		) AS permission
+		FROM unnest($3::uuid[]) AS ids(id)`
+
+	rows, err := r.DB.Query(ctx, query, userID, userEmail, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	// Recursively check the parent's parent
-	return r.hasParentFolderAccess(ctx, userID, userEmail, *parentID)
+	for rows.Next() {
+		var id uuid.UUID
+		var permission *string
+		if err := rows.Scan(&id, &permission); err != nil {
+			return nil, err
+		}
+		if permission != nil {
+			levels[id] = *permission
+		}
+	}
+	return levels, rows.Err()
 }
 
-func (r *shareRepository) GetFolderFiles(ctx context.Context, folderID uuid.UUID) ([]models.UserFile, error) {
-	// Get files in the folder - remove user_id restriction for shared access
+// GetFolderAccessLevels applies HasFolderAccess's rules to every folder at once. Each folder's
+// ancestor chain is walked in a single recursive query and the nearest level granting access
+// decides the permission, ownership before a share on the same level. Trashed folders get no
+// level and the walk stops at a trashed ancestor.
+func (r *shareRepository) GetFolderAccessLevels(ctx context.Context, userID uuid.UUID, userEmail string, folderIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	levels := make(map[uuid.UUID]string)
+	if len(folderIDs) == 0 {
+		return levels, nil
+	}
 	query := `
+		WITH RECURSIVE chain AS (
+			SELECT f.id AS item_id, f.id AS folder_id, f.parent_id, f.user_id, 0 AS depth
+			FROM folders f
+			WHERE f.id = ANY($3) AND f.deleted_at IS NULL
+			UNION ALL
+			SELECT c.item_id, p.id, p.parent_id, p.user_id, c.depth + 1
+			FROM chain c
+			JOIN folders p ON p.id = c.parent_id AND p.deleted_at IS NULL
+			WHERE c.depth < $4
+		)
+		SELECT DISTINCT ON (c.item_id) c.item_id,
+			CASE WHEN c.user_id = $1 THEN 'owner' ELSE fs.permission END
+		FROM chain c
+		LEFT JOIN folder_shares fs ON fs.folder_id = c.folder_id
+			AND fs.shared_with_email = $2
+			AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+		WHERE c.user_id = $1 OR fs.permission IS NOT NULL
+		ORDER BY c.item_id, c.depth, (c.user_id = $1) DESC`
+
+	rows, err := r.DB.Query(ctx, query, userID, userEmail, folderIDs, maxFolderAccessDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var permission string
+		if err := rows.Scan(&id, &permission); err != nil {
+			return nil, err
+		}
+		levels[id] = permission
+	}
+	return levels, rows.Err()
+}
+
+// folderFilesSQL lists the files a shared folder shows: the folder owner's active
+// mappings in it. Trashing or moving the owner's copy removes it for every recipient;
+// copies other users keep in their own storage are theirs and never listed here.
+var folderFilesSQL = `
 		SELECT 
-			uf.id, uf.user_id, uf.file_id, uf.uploaded_at,
-			f.id, f.hash, f.original_name, f.mime_type, f.size, f.ref_count, f.visibility, f.created_at,
-			COALESCE(u.email, gu.email) as uploader_email,
-			COALESCE('', gu.name) as uploader_name,
-			COALESCE('', gu.picture) as uploader_picture
+			uf.id, uf.user_id, uf.file_id, uf.uploaded_at, uf.folder_id,
+			f.id, f.hash, COALESCE(uf.display_name, f.original_name), f.mime_type, f.size, f.ref_count, uf.visibility, f.created_at,
+			` + profileColumns("u", "uploader") + `
 		FROM user_files uf 
 		JOIN files f ON uf.file_id = f.id 
-		JOIN folders fo ON uf.folder_id = fo.id
-		LEFT JOIN users u ON uf.user_id = u.id 
-		LEFT JOIN google_users gu ON uf.user_id = gu.id 
+		JOIN folders fo ON uf.folder_id = fo.id` + accountJoin("u", "COALESCE(uf.added_by, uf.user_id)") + `
 		WHERE uf.folder_id = $1 
+		  AND uf.user_id = fo.user_id
 		  AND uf.deleted_at IS NULL
 		ORDER BY uf.uploaded_at DESC`
 
-	rows, err := r.DB.Query(ctx, query, folderID)
+func (r *shareRepository) GetFolderFiles(ctx context.Context, folderID uuid.UUID) ([]models.UserFile, error) {
+	rows, err := r.DB.Query(ctx, folderFilesSQL, folderID)
 	if err != nil {
 		return nil, err
 	}
@@ -409,7 +756,7 @@ func (r *shareRepository) GetFolderFiles(ctx context.Context, folderID uuid.UUID
 		var uploaderEmail, uploaderName, uploaderPicture string
 
 		err := rows.Scan(
-			&uf.ID, &uf.UserID, &uf.FileID, &uf.UploadedAt,
+			&uf.ID, &uf.UserID, &uf.FileID, &uf.UploadedAt, &uf.FolderID,
 			&uf.File.ID, &uf.File.Hash, &uf.File.OriginalName, &uf.File.MimeType,
 			&uf.File.Size, &uf.File.RefCount, &uf.File.Visibility, &uf.File.CreatedAt,
 			&uploaderEmail, &uploaderName, &uploaderPicture,
@@ -429,13 +776,15 @@ func (r *shareRepository) GetFolderFiles(ctx context.Context, folderID uuid.UUID
 	return files, rows.Err()
 }
 
-// GetDirectSubfolders returns direct subfolders of a given folder (not recursive, no user filtering)
+// GetDirectSubfolders returns direct subfolders of a given folder (not recursive, no user filtering),
+// with the creating user's email, name and picture for shared folder browsers
 func (r *shareRepository) GetDirectSubfolders(ctx context.Context, folderID uuid.UUID) ([]models.Folder, error) {
 	rows, err := r.DB.Query(ctx, `
-		SELECT id, user_id, name, parent_id, created_at 
-		FROM folders 
-		WHERE parent_id = $1 
-		ORDER BY name ASC
+		SELECT fo.id, fo.user_id, fo.name, fo.parent_id, fo.created_at,
+			`+profileColumns("u", "creator")+`
+		FROM folders fo`+accountJoin("u", "fo.user_id")+`
+		WHERE fo.parent_id = $1 AND fo.deleted_at IS NULL
+		ORDER BY fo.name ASC
 	`, folderID)
 	if err != nil {
 		return nil, err
@@ -445,7 +794,8 @@ func (r *shareRepository) GetDirectSubfolders(ctx context.Context, folderID uuid
 	var folders []models.Folder
 	for rows.Next() {
 		var f models.Folder
-		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt); err != nil {
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.ParentID, &f.CreatedAt,
+			&f.CreatorEmail, &f.CreatorName, &f.CreatorPicture); err != nil {
 			return nil, err
 		}
 		folders = append(folders, f)
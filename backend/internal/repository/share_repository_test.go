@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// testFolder is an in-memory folders row with its shares keyed by email
+type testFolder struct {
+	parent *uuid.UUID
+	owner  uuid.UUID
+	shares map[string]string
+}
+
+type testTree map[uuid.UUID]*testFolder
+
+func (t testTree) add(id uuid.UUID, parent *uuid.UUID, owner uuid.UUID, shares map[string]string) {
+	t[id] = &testFolder{parent: parent, owner: owner, shares: shares}
+}
+
+// perLevelAccess is the previous hasParentFolderAccess: one parent lookup, ownership check and
+// share check per level. A visited set stands in for the cycle the old code never detected.
+func perLevelAccess(tree testTree, userID uuid.UUID, email string, folderID uuid.UUID, visited map[uuid.UUID]bool) (bool, string) {
+	f, ok := tree[folderID]
+	if !ok || f.parent == nil || visited[*f.parent] {
+		return false, ""
+	}
+	parentID := *f.parent
+	visited[parentID] = true
+	parent, ok := tree[parentID]
+	if !ok {
+		return false, ""
+	}
+	if parent.owner == userID {
+		return true, "owner"
+	}
+	if p, ok := parent.shares[email]; ok {
+		return true, p
+	}
+	return perLevelAccess(tree, userID, email, parentID, visited)
+}
+
+// ancestorRows mirrors parentFolderAccessQuery over the in-memory tree
+func ancestorRows(tree testTree, userID uuid.UUID, email string, folderID uuid.UUID, maxDepth int) []ancestorAccess {
+	var rows []ancestorAccess
+	f, ok := tree[folderID]
+	for depth := 1; ok && f.parent != nil && depth <= maxDepth; depth++ {
+		if f, ok = tree[*f.parent]; !ok {
+			break
+		}
+		owned := f.owner == userID
+		permission := f.shares[email]
+		if owned || permission != "" {
+			rows = append(rows, ancestorAccess{Depth: depth, Owned: owned, Permission: permission})
+		}
+	}
+	return rows
+}
+
+func TestNearestAncestorAccess_MatchesPerLevel(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+	email := "me@example.com"
+	root, mid, leaf, deep := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	cases := map[string]testTree{}
+
+	owned := testTree{}
+	owned.add(root, nil, me, nil)
+	owned.add(mid, &root, me, nil)
+	owned.add(leaf, &mid, me, nil)
+	cases["owned parent"] = owned
+
+	sharedRoot := testTree{}
+	sharedRoot.add(root, nil, other, map[string]string{email: "viewer"})
+	sharedRoot.add(mid, &root, other, nil)
+	sharedRoot.add(leaf, &mid, other, nil)
+	sharedRoot.add(deep, &leaf, other, nil)
+	cases["share on distant ancestor"] = sharedRoot
+
+	nearest := testTree{}
+	nearest.add(root, nil, other, map[string]string{email: "viewer"})
+	nearest.add(mid, &root, other, map[string]string{email: "editor"})
+	nearest.add(leaf, &mid, other, nil)
+	cases["nearest share wins"] = nearest
+
+	ownerFirst := testTree{}
+	ownerFirst.add(root, nil, other, nil)
+	ownerFirst.add(mid, &root, me, map[string]string{email: "viewer"})
+	ownerFirst.add(leaf, &mid, other, nil)
+	cases["ownership before share on one level"] = ownerFirst
+
+	otherEmail := testTree{}
+	otherEmail.add(root, nil, other, map[string]string{"someone@example.com": "editor"})
+	otherEmail.add(mid, &root, other, nil)
+	cases["no access"] = otherEmail
+
+	for name, tree := range cases {
+		for id := range tree {
+			wantHas, wantPerm := perLevelAccess(tree, me, email, id, map[uuid.UUID]bool{})
+			gotHas, gotPerm := nearestAncestorAccess(ancestorRows(tree, me, email, id, maxFolderAccessDepth))
+			if gotHas != wantHas || gotPerm != wantPerm {
+				t.Fatalf("%s: folder %s: expected (%v, %q), got (%v, %q)", name, id, wantHas, wantPerm, gotHas, gotPerm)
+			}
+		}
+	}
+}
+
+func TestNearestAncestorAccess_Cycle(t *testing.T) {
+	me, other := uuid.New(), uuid.New()
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	tree := testTree{}
+	tree.add(a, &c, other, nil)
+	tree.add(b, &a, other, nil)
+	tree.add(c, &b, other, nil)
+
+	rows := ancestorRows(tree, me, "me@example.com", b, maxFolderAccessDepth)
+	if has, _ := nearestAncestorAccess(rows); has {
+		t.Fatalf("expected no access through a cycle without grants")
+	}
+
+	tree[c].shares = map[string]string{"me@example.com": "viewer"}
+	wantHas, wantPerm := perLevelAccess(tree, me, "me@example.com", b, map[uuid.UUID]bool{})
+	gotHas, gotPerm := nearestAncestorAccess(ancestorRows(tree, me, "me@example.com", b, maxFolderAccessDepth))
+	if !wantHas || gotHas != wantHas || gotPerm != wantPerm {
+		t.Fatalf("expected (%v, %q) through the cycle, got (%v, %q)", wantHas, wantPerm, gotHas, gotPerm)
+	}
+}
+
+func TestParentFolderAccessQuery_Bounded(t *testing.T) {
+	for _, want := range []string{"WITH RECURSIVE", "a.depth < $4", "ORDER BY a.depth"} {
+		if !strings.Contains(parentFolderAccessQuery, want) {
+			t.Fatalf("expected query to contain %q", want)
+		}
+	}
+	if maxFolderAccessDepth <= 0 {
+		t.Fatalf("expected a positive depth bound, got %d", maxFolderAccessDepth)
+	}
+}
+
+func TestParentFolderAccessQuery_SkipsTrash(t *testing.T) {
+	// Neither the folder itself nor any ancestor on the way up may be in the trash
+	for _, want := range []string{"f.id = $3 AND f.deleted_at IS NULL", "p.id = f.parent_id AND p.deleted_at IS NULL", "p.id = a.parent_id AND p.deleted_at IS NULL"} {
+		if !strings.Contains(parentFolderAccessQuery, want) {
+			t.Fatalf("expected query to contain %q", want)
+		}
+	}
+}
+
+func TestVisibilityAccess(t *testing.T) {
+	if has, permission := visibilityAccess(models.VisibilityPublic); !has || permission != "viewer" {
+		t.Fatalf("expected public files to grant read-only access, got (%v, %q)", has, permission)
+	}
+	for _, v := range []string{models.VisibilityPrivate, models.VisibilityShared, ""} {
+		if has, _ := visibilityAccess(v); has {
+			t.Fatalf("expected %q visibility to grant no access without a mapping or share", v)
+		}
+	}
+}
+
+func TestFolderFilesSQL_OwnerActiveOnly(t *testing.T) {
+	// Recipients see the owner's copies; a trashed copy drops out of the listing
+	for _, want := range []string{"uf.user_id = fo.user_id", "uf.deleted_at IS NULL"} {
+		if !strings.Contains(folderFilesSQL, want) {
+			t.Fatalf("expected query to contain %q", want)
+		}
+	}
+}
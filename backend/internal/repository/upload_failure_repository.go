@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/useradityaa/internal/models"
+)
+
+// UploadFailureRepository keeps a log of files uploads failed to store.
+type UploadFailureRepository interface {
+	// RecordUploadFailures stores the failures of one upload in a single insert
+	RecordUploadFailures(ctx context.Context, failures []models.UploadFailure) error
+	// ListUploadFailures returns the newest failures with the uploader's email, optionally
+	// only those of one user
+	ListUploadFailures(ctx context.Context, userID *uuid.UUID, limit int) ([]models.UploadFailure, error)
+}
+
+type uploadFailureRepository struct{ DB *pgxpool.Pool }
+
+// NewUploadFailureRepository creates a new upload failure repository instance
+func NewUploadFailureRepository(db *pgxpool.Pool) UploadFailureRepository {
+	return &uploadFailureRepository{DB: db}
+}
+
+func (r *uploadFailureRepository) RecordUploadFailures(ctx context.Context, failures []models.UploadFailure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	userIDs := make([]uuid.UUID, len(failures))
+	names := make([]string, len(failures))
+	sizes := make([]int64, len(failures))
+	reasons := make([]string, len(failures))
+	messages := make([]string, len(failures))
+	for i, f := range failures {
+		userIDs[i], names[i], sizes[i], reasons[i], messages[i] = f.UserID, f.Filename, f.Size, f.Reason, f.Message
+	}
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO upload_failures (user_id, filename, size, reason, message)
+		SELECT * FROM unnest($1::uuid[], $2::text[], $3::bigint[], $4::text[], $5::text[])
+	`, userIDs, names, sizes, reasons, messages)
+	return err
+}
+
+func (r *uploadFailureRepository) ListUploadFailures(ctx context.Context, userID *uuid.UUID, limit int) ([]models.UploadFailure, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT uf.id, uf.user_id, uf.filename, uf.size, uf.reason, uf.message, uf.created_at, `+accountColumns("u", "user")+`
+		FROM upload_failures uf`+accountJoin("u", "uf.user_id")+`
+		WHERE $1::uuid IS NULL OR uf.user_id = $1
+		ORDER BY uf.created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []models.UploadFailure{}
+	for rows.Next() {
+		var f models.UploadFailure
+		var account accountRow
+		dest := []interface{}{&f.ID, &f.UserID, &f.Filename, &f.Size, &f.Reason, &f.Message, &f.CreatedAt}
+		if err := rows.Scan(append(dest, account.dest()...)...); err != nil {
+			return nil, err
+		}
+		if user, ok := account.user(f.UserID); ok {
+			f.UserEmail = user.Email
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/useradityaa/internal/models"
+)
+
+// UploadSessionRepository stores chunked upload sessions and the chunks received so far.
+type UploadSessionRepository interface {
+	// CreateUploadSession inserts the session, filling in its ID and CreatedAt
+	CreateUploadSession(ctx context.Context, session *models.UploadSession) error
+	// GetUploadSession returns ErrNotFound when the session doesn't exist
+	GetUploadSession(ctx context.Context, id uuid.UUID) (*models.UploadSession, error)
+	// RecordUploadPart stores a received chunk, replacing an earlier copy of the same index
+	RecordUploadPart(ctx context.Context, sessionID uuid.UUID, part models.UploadPart) error
+	// ListUploadParts returns the session's chunks ordered by index
+	ListUploadParts(ctx context.Context, sessionID uuid.UUID) ([]models.UploadPart, error)
+	// DeleteUploadSession removes the session along with its parts
+	DeleteUploadSession(ctx context.Context, id uuid.UUID) error
+	// ListExpiredUploadSessions returns up to limit sessions that expired before now
+	ListExpiredUploadSessions(ctx context.Context, now time.Time, limit int) ([]models.UploadSession, error)
+}
+
+type uploadSessionRepository struct{ DB *pgxpool.Pool }
+
+// NewUploadSessionRepository creates a new upload session repository instance
+func NewUploadSessionRepository(db *pgxpool.Pool) UploadSessionRepository {
+	return &uploadSessionRepository{DB: db}
+}
+
+const uploadSessionColumns = `id, user_id, filename, total_size, chunk_size, object_key, multipart_id, created_at, expires_at`
+
+func scanUploadSession(row interface{ Scan(...any) error }, s *models.UploadSession) error {
+	return row.Scan(&s.ID, &s.UserID, &s.Filename, &s.TotalSize, &s.ChunkSize, &s.ObjectKey, &s.MultipartID, &s.CreatedAt, &s.ExpiresAt)
+}
+
+func (r *uploadSessionRepository) CreateUploadSession(ctx context.Context, session *models.UploadSession) error {
+	return r.DB.QueryRow(ctx, `
+		INSERT INTO upload_sessions (user_id, filename, total_size, chunk_size, object_key, multipart_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, session.UserID, session.Filename, session.TotalSize, session.ChunkSize, session.ObjectKey, session.MultipartID, session.ExpiresAt).
+		Scan(&session.ID, &session.CreatedAt)
+}
+
+func (r *uploadSessionRepository) GetUploadSession(ctx context.Context, id uuid.UUID) (*models.UploadSession, error) {
+	var s models.UploadSession
+	err := scanUploadSession(r.DB.QueryRow(ctx, `SELECT `+uploadSessionColumns+` FROM upload_sessions WHERE id = $1`, id), &s)
+	if err != nil {
+		return nil, lookupErr("upload session", err)
+	}
+	return &s, nil
+}
+
+func (r *uploadSessionRepository) RecordUploadPart(ctx context.Context, sessionID uuid.UUID, part models.UploadPart) error {
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO upload_session_parts (session_id, chunk_index, etag, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, chunk_index) DO UPDATE SET etag = EXCLUDED.etag, size = EXCLUDED.size
+	`, sessionID, part.ChunkIndex, part.ETag, part.Size)
+	return err
+}
+
+func (r *uploadSessionRepository) ListUploadParts(ctx context.Context, sessionID uuid.UUID) ([]models.UploadPart, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT chunk_index, etag, size FROM upload_session_parts
+		WHERE session_id = $1
+		ORDER BY chunk_index
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []models.UploadPart{}
+	for rows.Next() {
+		var p models.UploadPart
+		if err := rows.Scan(&p.ChunkIndex, &p.ETag, &p.Size); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+func (r *uploadSessionRepository) DeleteUploadSession(ctx context.Context, id uuid.UUID) error {
+	_, err := r.DB.Exec(ctx, `DELETE FROM upload_sessions WHERE id = $1`, id)
+	return err
+}
+
+func (r *uploadSessionRepository) ListExpiredUploadSessions(ctx context.Context, now time.Time, limit int) ([]models.UploadSession, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+uploadSessionColumns+` FROM upload_sessions
+		WHERE expires_at < $1
+		ORDER BY expires_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.UploadSession{}
+	for rows.Next() {
+		var s models.UploadSession
+		if err := scanUploadSession(rows, &s); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
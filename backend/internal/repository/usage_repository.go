@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/useradityaa/internal/models"
+)
+
+// UsageRepository stores daily usage snapshots.
+type UsageRepository interface {
+	// ListSnapshotUsers returns every user holding files, plus users snapshotted before so a
+	// drop to zero is still recorded
+	ListSnapshotUsers(ctx context.Context) ([]uuid.UUID, error)
+	// UpsertSnapshot writes a snapshot, replacing one already taken for the same user and day
+	UpsertSnapshot(ctx context.Context, snapshot models.UsageSnapshot) error
+	// GetUsageHistory returns the user's snapshots dated from..to inclusive, oldest first
+	GetUsageHistory(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]models.UsageSnapshot, error)
+}
+
+type usageRepository struct{ DB *pgxpool.Pool }
+
+// NewUsageRepository creates a new usage repository instance
+func NewUsageRepository(db *pgxpool.Pool) UsageRepository { return &usageRepository{DB: db} }
+
+func (r *usageRepository) ListSnapshotUsers(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT user_id FROM user_files
+		UNION
+		SELECT user_id FROM usage_snapshots
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
+
+func (r *usageRepository) UpsertSnapshot(ctx context.Context, s models.UsageSnapshot) error {
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO usage_snapshots (user_id, snapshot_date, logical_bytes, attributed_bytes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, snapshot_date)
+		DO UPDATE SET logical_bytes = EXCLUDED.logical_bytes, attributed_bytes = EXCLUDED.attributed_bytes, created_at = NOW()
+	`, s.UserID, s.Date, s.LogicalBytes, s.AttributedBytes)
+	return err
+}
+
+func (r *usageRepository) GetUsageHistory(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]models.UsageSnapshot, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT user_id, snapshot_date, logical_bytes, attributed_bytes
+		FROM usage_snapshots
+		WHERE user_id = $1 AND snapshot_date BETWEEN $2 AND $3
+		ORDER BY snapshot_date ASC
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.UsageSnapshot
+	for rows.Next() {
+		var s models.UsageSnapshot
+		if err := rows.Scan(&s.UserID, &s.Date, &s.LogicalBytes, &s.AttributedBytes); err != nil {
+			return nil, err
+		}
+		history = append(history, s)
+	}
+	return history, rows.Err()
+}
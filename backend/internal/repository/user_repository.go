@@ -5,7 +5,10 @@ package repository
 
 import (
 	"context"
+	"errors"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/useradityaa/internal/models"
 )
@@ -35,16 +38,26 @@ type UserRepository interface {
 
 	// GetAllUsers retrieves comprehensive user information for admin dashboard
 	GetAllUsers(ctx context.Context) ([]*models.AdminUserInfo, error)
+	// GetAdminUserInfo retrieves the same information for a single user
+	GetAdminUserInfo(ctx context.Context, userID uuid.UUID) (*models.AdminUserInfo, error)
 }
 
 // userRepository implements UserRepository using PostgreSQL
 type userRepository struct {
 	DB *pgxpool.Pool
+	// ReadDB serves admin aggregates; it is the replica when configured, else DB
+	ReadDB *pgxpool.Pool
 }
 
 // NewUserRepository creates a new user repository instance
 func NewUserRepository(db *pgxpool.Pool) UserRepository {
-	return &userRepository{DB: db}
+	return &userRepository{DB: db, ReadDB: db}
+}
+
+// NewUserRepositoryWithReplica creates a user repository that sends admin
+// aggregates to replica. A nil replica falls back to the primary.
+func NewUserRepositoryWithReplica(db, replica *pgxpool.Pool) UserRepository {
+	return &userRepository{DB: db, ReadDB: ReadPool(db, replica)}
 }
 
 // FindByEmail retrieves a manual user by their email address.
@@ -59,7 +72,7 @@ func (r *userRepository) FindByEmail(ctx context.Context, email string) (*models
 	user := &models.User{}
 	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
 	if err != nil {
-		return nil, err
+		return nil, lookupErr("user", err)
 	}
 
 	return user, nil
@@ -77,7 +90,7 @@ func (r *userRepository) FindByGoogleMail(ctx context.Context, email string) (*m
 	user := &models.GoogleUser{}
 	err := row.Scan(&user.ID, &user.Email, &user.Name, &user.Picture)
 	if err != nil {
-		return nil, err
+		return nil, lookupErr("google user", err)
 	}
 
 	return user, nil
@@ -113,7 +126,7 @@ func (r *userRepository) FindByID(ctx context.Context, id string) (*models.User,
 
 	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
 	if err != nil {
-		return nil, err
+		return nil, lookupErr("user "+id, err)
 	}
 
 	return user, nil
@@ -135,6 +148,9 @@ func (r *userRepository) FindUserByEmailAny(ctx context.Context, email string) (
 	if err == nil {
 		return user, "user", nil
 	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, "", err
+	}
 
 	// Try Google users
 	googleUser, err := r.FindByGoogleMail(ctx, email)
@@ -154,16 +170,21 @@ func (r *userRepository) GetUserEmailByID(ctx context.Context, userID string) (s
 	if err == nil {
 		return email, nil
 	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", lookupErr("user "+userID, err)
+	}
 
 	// Try Google users
 	query = `SELECT email FROM google_users WHERE id = $1`
-	err = r.DB.QueryRow(ctx, query, userID).Scan(&email)
-	return email, err
+	if err := r.DB.QueryRow(ctx, query, userID).Scan(&email); err != nil {
+		return "", lookupErr("user "+userID, err)
+	}
+	return email, nil
 }
 
-// GetAllUsers returns admin information for all users
-func (r *userRepository) GetAllUsers(ctx context.Context) ([]*models.AdminUserInfo, error) {
-	query := `
+// adminUserStatsQuery selects the admin information of manual and Google users alike;
+// callers append their own filter and ordering.
+const adminUserStatsQuery = `
 		WITH user_stats AS (
 			SELECT 
 				u.id,
@@ -198,11 +219,11 @@ func (r *userRepository) GetAllUsers(ctx context.Context) ([]*models.AdminUserIn
 			GROUP BY gu.id, gu.email, gu.name, gu.picture, gu.created_at, gu.updated_at
 		)
 		SELECT id, email, name, picture, created_at, updated_at, total_files, total_folders, storage_used
-		FROM user_stats
-		ORDER BY created_at DESC
-	`
+		FROM user_stats`
 
-	rows, err := r.DB.Query(ctx, query)
+// GetAllUsers returns admin information for all users
+func (r *userRepository) GetAllUsers(ctx context.Context) ([]*models.AdminUserInfo, error) {
+	rows, err := r.ReadDB.Query(ctx, adminUserStatsQuery+` ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -210,18 +231,7 @@ func (r *userRepository) GetAllUsers(ctx context.Context) ([]*models.AdminUserIn
 
 	var users []*models.AdminUserInfo
 	for rows.Next() {
-		user := &models.AdminUserInfo{}
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.Name,
-			&user.Picture,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-			&user.TotalFiles,
-			&user.TotalFolders,
-			&user.StorageUsed,
-		)
+		user, err := scanAdminUserInfo(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -230,3 +240,31 @@ func (r *userRepository) GetAllUsers(ctx context.Context) ([]*models.AdminUserIn
 
 	return users, rows.Err()
 }
+
+// GetAdminUserInfo returns admin information for one user, or ErrNotFound
+func (r *userRepository) GetAdminUserInfo(ctx context.Context, userID uuid.UUID) (*models.AdminUserInfo, error) {
+	user, err := scanAdminUserInfo(r.ReadDB.QueryRow(ctx, adminUserStatsQuery+` WHERE id = $1`, userID))
+	if err != nil {
+		return nil, lookupErr("user "+userID.String(), err)
+	}
+	return user, nil
+}
+
+func scanAdminUserInfo(row pgx.Row) (*models.AdminUserInfo, error) {
+	user := &models.AdminUserInfo{}
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.Picture,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.TotalFiles,
+		&user.TotalFolders,
+		&user.StorageUsed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -2,16 +2,31 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 
 	"github.com/google/uuid"
+	"github.com/useradityaa/internal/middleware"
 	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
 )
 
+// ErrAdminRequired is returned when a non-admin calls an admin-only service method.
+var ErrAdminRequired = errors.New("unauthorized: admin access required")
+
+// adminRecentActivityLimit caps the activity entries in a user drill-down
+const adminRecentActivityLimit = 20
+
 type AdminService struct {
 	UserRepo   repository.UserRepository
 	FileRepo   repository.FileRepository
 	FolderRepo repository.FolderRepository
+	// The repositories below back GetUserDetail
+	ShareRepo    repository.ShareRepository
+	LinkRepo     repository.PublicLinkRepository
+	ActivityRepo repository.FileActivityRepository
+	DownloadRepo repository.FileDownloadRepository
 }
 
 func NewAdminService(userRepo repository.UserRepository, fileRepo repository.FileRepository, folderRepo repository.FolderRepository) *AdminService {
@@ -33,3 +48,60 @@ func (s *AdminService) GetUserFiles(ctx context.Context, userID uuid.UUID) ([]mo
 func (s *AdminService) GetUserFolders(ctx context.Context, userID uuid.UUID) ([]models.Folder, error) {
 	return s.FolderRepo.ListFolders(ctx, userID, nil)
 }
+
+// GetUserDetail gathers a user's account, usage, shares in both directions, active public
+// links, recent activity and trash for the admin support view. The caller must be an admin;
+// every lookup is written to the audit log with the admin's and the target's ids.
+func (s *AdminService) GetUserDetail(ctx context.Context, targetUserID uuid.UUID) (*models.AdminUserDetail, error) {
+	if !middleware.GetIsAdminFromContext(ctx) {
+		return nil, ErrAdminRequired
+	}
+	if s.UserRepo == nil || s.FileRepo == nil || s.ShareRepo == nil || s.LinkRepo == nil || s.ActivityRepo == nil || s.DownloadRepo == nil {
+		return nil, fmt.Errorf("admin service not configured")
+	}
+	adminID, _ := middleware.GetUserIDFromContext(ctx)
+	log.Printf("audit: admin %s viewed user detail of %s", adminID, targetUserID)
+
+	user, err := s.UserRepo.GetAdminUserInfo(ctx, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	detail := &models.AdminUserDetail{User: user}
+
+	if detail.OutgoingFileShares, err = s.ShareRepo.GetFileSharesByOwner(ctx, targetUserID, false); err != nil {
+		return nil, fmt.Errorf("outgoing file shares: %w", err)
+	}
+	if detail.OutgoingFolderShares, err = s.ShareRepo.GetFolderSharesByOwner(ctx, targetUserID, false); err != nil {
+		return nil, fmt.Errorf("outgoing folder shares: %w", err)
+	}
+	if detail.IncomingFileShares, err = s.ShareRepo.GetFileSharesForUser(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("incoming file shares: %w", err)
+	}
+	if detail.IncomingFolderShares, err = s.ShareRepo.GetFolderSharesForUser(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("incoming folder shares: %w", err)
+	}
+	if detail.PublicLinks, err = s.LinkRepo.ListActiveLinksByOwner(ctx, targetUserID); err != nil {
+		return nil, fmt.Errorf("public links: %w", err)
+	}
+	if detail.RecentActivity, err = s.ActivityRepo.GetRecentFileActivities(ctx, targetUserID, adminRecentActivityLimit); err != nil {
+		return nil, fmt.Errorf("recent activity: %w", err)
+	}
+
+	stats, err := s.DownloadRepo.GetFileDownloadStatsForUser(ctx, targetUserID)
+	if err != nil {
+		return nil, fmt.Errorf("download stats: %w", err)
+	}
+	for _, st := range stats {
+		detail.Downloads += st.TotalDownloads
+	}
+
+	trash, err := s.FileRepo.GetDeletedUserFiles(ctx, targetUserID)
+	if err != nil {
+		return nil, fmt.Errorf("trash: %w", err)
+	}
+	detail.TrashFiles = len(trash)
+	for _, uf := range trash {
+		detail.TrashBytes += uf.File.Size
+	}
+	return detail, nil
+}
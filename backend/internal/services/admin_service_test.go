@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// stubActivityRepo returns fixed recent activity per user
+type stubActivityRepo struct {
+	recent map[uuid.UUID][]models.RecentFileActivity
+	// tracked records TrackFileActivity calls by user
+	tracked map[uuid.UUID][]uuid.UUID
+}
+
+func (s *stubActivityRepo) TrackFileActivity(ctx context.Context, userID, fileID uuid.UUID, activityType string) error {
+	if s.tracked == nil {
+		s.tracked = map[uuid.UUID][]uuid.UUID{}
+	}
+	s.tracked[userID] = append(s.tracked[userID], fileID)
+	return nil
+}
+func (s *stubActivityRepo) GetRecentFileActivities(ctx context.Context, userID uuid.UUID, limit int) ([]models.RecentFileActivity, error) {
+	return s.recent[userID], nil
+}
+
+func TestAdminService_GetUserDetail(t *testing.T) {
+	target, other := uuid.New(), uuid.New()
+	email := "target@example.com"
+	users := &stubUserRepo{adminInfo: map[uuid.UUID]*models.AdminUserInfo{
+		target: {ID: target, Email: email, TotalFiles: 3, TotalFolders: 2, StorageUsed: 4096},
+	}}
+	files := &stubFileRepo{}
+	sizedUploads(files, 100, 250)
+	for _, f := range files.filesByHash {
+		files.mappings = append(files.mappings, &stubMapping{id: uuid.New(), userID: target, fileID: f.ID, deleted: true})
+	}
+	shares := &stubShareRepo{
+		fileShares: []models.FileShare{
+			{ID: uuid.New(), OwnerID: target, SharedWithEmail: "friend@example.com"},
+			{ID: uuid.New(), OwnerID: other, SharedWithEmail: email},
+		},
+		folderShares: []models.FolderShare{
+			{ID: uuid.New(), OwnerID: target, SharedWithEmail: "friend@example.com"},
+			{ID: uuid.New(), OwnerID: other, SharedWithEmail: email},
+			{ID: uuid.New(), OwnerID: other, SharedWithEmail: "someone@example.com"},
+		},
+	}
+	links := &stubPublicLinkRepo{active: map[uuid.UUID][]models.PublicLink{
+		target: {{ItemType: "file", ItemID: uuid.New(), CreatedAt: time.Now(), AccessCount: 7}},
+	}}
+	activity := &stubActivityRepo{recent: map[uuid.UUID][]models.RecentFileActivity{
+		target: {{FileID: uuid.New(), UserID: target, LastActivityType: "download", ActivityCount: 2}},
+	}}
+	downloads := &stubDownloadRepo{}
+	sharedFile := uuid.New()
+	for i := 0; i < 3; i++ {
+		downloads.RecordDownload(context.Background(), sharedFile, target, nil, "public", "tok", "", "")
+	}
+	downloads.RecordDownload(context.Background(), uuid.New(), other, nil, "public", "tok", "", "")
+
+	svc := NewAdminService(users, files, &stubFolderRepo{})
+	svc.ShareRepo, svc.LinkRepo, svc.ActivityRepo, svc.DownloadRepo = shares, links, activity, downloads
+	ctx := middleware.WithUser(context.Background(), uuid.NewString(), true)
+
+	d, err := svc.GetUserDetail(ctx, target)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if d.User.Email != email || d.User.TotalFiles != 3 || d.User.TotalFolders != 2 || d.User.StorageUsed != 4096 {
+		t.Fatalf("unexpected user summary %+v", d.User)
+	}
+	if len(d.OutgoingFileShares) != 1 || len(d.OutgoingFolderShares) != 1 {
+		t.Fatalf("expected one outgoing share of each kind, got %d files and %d folders", len(d.OutgoingFileShares), len(d.OutgoingFolderShares))
+	}
+	if len(d.IncomingFileShares) != 1 || len(d.IncomingFolderShares) != 1 {
+		t.Fatalf("expected one incoming share of each kind, got %d files and %d folders", len(d.IncomingFileShares), len(d.IncomingFolderShares))
+	}
+	if len(d.PublicLinks) != 1 || d.PublicLinks[0].AccessCount != 7 {
+		t.Fatalf("expected the active public link, got %+v", d.PublicLinks)
+	}
+	if len(d.RecentActivity) != 1 || d.RecentActivity[0].LastActivityType != "download" {
+		t.Fatalf("expected the recent activity, got %+v", d.RecentActivity)
+	}
+	if d.Downloads != 3 {
+		t.Fatalf("expected 3 downloads of the user's files, got %d", d.Downloads)
+	}
+	if d.TrashFiles != 2 || d.TrashBytes != 350 {
+		t.Fatalf("expected 2 trashed files of 350 bytes, got %d files of %d bytes", d.TrashFiles, d.TrashBytes)
+	}
+}
+
+func TestAdminService_GetUserDetail_AdminOnly(t *testing.T) {
+	target := uuid.New()
+	users := &stubUserRepo{adminInfo: map[uuid.UUID]*models.AdminUserInfo{target: {ID: target}}}
+	svc := NewAdminService(users, &stubFileRepo{}, &stubFolderRepo{})
+	svc.ShareRepo, svc.LinkRepo, svc.ActivityRepo, svc.DownloadRepo = &stubShareRepo{}, &stubPublicLinkRepo{}, &stubActivityRepo{}, &stubDownloadRepo{}
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		middleware.WithUser(context.Background(), uuid.NewString(), false),
+	} {
+		if _, err := svc.GetUserDetail(ctx, target); !errors.Is(err, ErrAdminRequired) {
+			t.Fatalf("expected non-admins to be refused, got %v", err)
+		}
+	}
+
+	admin := middleware.WithUser(context.Background(), uuid.NewString(), true)
+	if _, err := svc.GetUserDetail(admin, uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected an unknown user to be reported as not found, got %v", err)
+	}
+}
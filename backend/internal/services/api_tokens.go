@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// maxAPITokensPerUser caps how many active API tokens one user may hold
+const maxAPITokensPerUser = 20
+
+// maxAPITokenNameLength caps the length of a token's label
+const maxAPITokenNameLength = 100
+
+// ErrInvalidAPIToken is returned when a presented API token is unknown or revoked.
+var ErrInvalidAPIToken = errors.New("invalid or revoked API token")
+
+// CreateAPIToken issues a new API token for the user with the given scopes (nil grants
+// all of them). The returned token string is the only copy: just its hash is stored,
+// so it can't be shown again.
+func (s *AuthService) CreateAPIToken(ctx context.Context, userID uuid.UUID, name string, scopes []string) (*models.APIToken, string, error) {
+	if s.APITokens == nil {
+		return nil, "", fmt.Errorf("api tokens not configured")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if len(name) > maxAPITokenNameLength {
+		return nil, "", fmt.Errorf("token name must be at most %d characters", maxAPITokenNameLength)
+	}
+	scopes, err := auth.NormalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	existing, err := s.APITokens.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list api tokens: %w", err)
+	}
+	if len(existing) >= maxAPITokensPerUser {
+		return nil, "", fmt.Errorf("too many api tokens: revoke one before creating another (limit %d)", maxAPITokensPerUser)
+	}
+
+	token, hash, prefix, err := auth.GenerateAPIToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+	t := &models.APIToken{UserID: userID, Name: name, Prefix: prefix, Scopes: scopes, TokenHash: hash}
+	if err := s.APITokens.Create(ctx, t); err != nil {
+		return nil, "", fmt.Errorf("failed to store api token: %w", err)
+	}
+	return t, token, nil
+}
+
+// ListAPITokens returns the user's active API tokens, newest first.
+func (s *AuthService) ListAPITokens(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	if s.APITokens == nil {
+		return nil, fmt.Errorf("api tokens not configured")
+	}
+	return s.APITokens.ListByUser(ctx, userID)
+}
+
+// RevokeAPIToken revokes one of the user's tokens; it stops working immediately.
+// Tokens of other users are reported as not found.
+func (s *AuthService) RevokeAPIToken(ctx context.Context, userID, tokenID uuid.UUID) error {
+	if s.APITokens == nil {
+		return fmt.Errorf("api tokens not configured")
+	}
+	revoked, err := s.APITokens.Revoke(ctx, userID, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("api token %s: %w", tokenID, repository.ErrNotFound)
+	}
+	return nil
+}
+
+// ResolveAPIToken returns the active token matching a presented API token string and
+// records the use. Unknown and revoked tokens yield ErrInvalidAPIToken.
+func (s *AuthService) ResolveAPIToken(ctx context.Context, token string) (*models.APIToken, error) {
+	if s.APITokens == nil || !auth.IsAPIToken(token) {
+		return nil, ErrInvalidAPIToken
+	}
+	t, err := s.APITokens.FindActiveByHash(ctx, auth.HashAPIToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.APITokens.TouchLastUsed(ctx, t.ID); err != nil {
+		log.Printf("warning: failed to record api token use: %v", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// stubAPITokenRepo keeps tokens in memory, revoked ones included.
+type stubAPITokenRepo struct {
+	tokens  []*models.APIToken
+	touches int
+}
+
+func (s *stubAPITokenRepo) Create(ctx context.Context, t *models.APIToken) error {
+	t.ID, t.CreatedAt = uuid.New(), time.Now()
+	s.tokens = append(s.tokens, t)
+	return nil
+}
+func (s *stubAPITokenRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	var out []models.APIToken
+	for _, t := range s.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			out = append(out, *t)
+		}
+	}
+	return out, nil
+}
+func (s *stubAPITokenRepo) FindActiveByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	for _, t := range s.tokens {
+		if t.TokenHash == hash && t.RevokedAt == nil {
+			return t, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+func (s *stubAPITokenRepo) Revoke(ctx context.Context, userID, tokenID uuid.UUID) (bool, error) {
+	for _, t := range s.tokens {
+		if t.ID == tokenID && t.UserID == userID && t.RevokedAt == nil {
+			now := time.Now()
+			t.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (s *stubAPITokenRepo) TouchLastUsed(ctx context.Context, tokenID uuid.UUID) error {
+	s.touches++
+	return nil
+}
+
+func TestAuthService_APITokens(t *testing.T) {
+	repo := &stubAPITokenRepo{}
+	svc := &AuthService{APITokens: repo}
+	ctx := context.Background()
+	owner := uuid.New()
+
+	created, token, err := svc.CreateAPIToken(ctx, owner, "  backup script ", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !auth.IsAPIToken(token) || !strings.HasPrefix(token, created.Prefix) || created.Name != "backup script" {
+		t.Fatalf("unexpected token %q for %+v", token, created)
+	}
+	if created.TokenHash == token || strings.Contains(created.TokenHash, token) {
+		t.Fatalf("expected only a hash of the token to be stored")
+	}
+
+	resolved, err := svc.ResolveAPIToken(ctx, token)
+	if err != nil || resolved.UserID != owner || repo.touches != 1 {
+		t.Fatalf("expected token to resolve to its owner, got %+v (%v)", resolved, err)
+	}
+	if _, err := svc.ResolveAPIToken(ctx, token+"x"); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expected unknown token to be rejected, got %v", err)
+	}
+
+	// Other users can't revoke the token
+	if err := svc.RevokeAPIToken(ctx, uuid.New(), created.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected other user's revoke to find nothing, got %v", err)
+	}
+	if err := svc.RevokeAPIToken(ctx, owner, created.ID); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := svc.ResolveAPIToken(ctx, token); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Fatalf("expected revoked token to be rejected, got %v", err)
+	}
+	if tokens, _ := svc.ListAPITokens(ctx, owner); len(tokens) != 0 {
+		t.Fatalf("expected revoked token to be unlisted, got %+v", tokens)
+	}
+}
+
+func TestAuthService_CreateAPIToken_Invalid(t *testing.T) {
+	repo := &stubAPITokenRepo{}
+	svc := &AuthService{APITokens: repo}
+	ctx := context.Background()
+	owner := uuid.New()
+
+	for _, name := range []string{"", "   ", strings.Repeat("n", maxAPITokenNameLength+1)} {
+		if _, _, err := svc.CreateAPIToken(ctx, owner, name, nil); err == nil {
+			t.Fatalf("expected name %q to be rejected", name)
+		}
+	}
+	for i := 0; i < maxAPITokensPerUser; i++ {
+		if _, _, err := svc.CreateAPIToken(ctx, owner, "script", nil); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if _, _, err := svc.CreateAPIToken(ctx, owner, "one too many", nil); err == nil {
+		t.Fatalf("expected the token limit to be enforced")
+	}
+	if _, _, err := (&AuthService{}).CreateAPIToken(ctx, owner, "script", nil); err == nil {
+		t.Fatalf("expected error without a token repository")
+	}
+}
+
+func TestAuthService_CreateAPIToken_Scopes(t *testing.T) {
+	svc := &AuthService{APITokens: &stubAPITokenRepo{}}
+	ctx := context.Background()
+	owner := uuid.New()
+
+	all, _, err := svc.CreateAPIToken(ctx, owner, "full", nil)
+	if err != nil || strings.Join(all.Scopes, ",") != "files:read,files:write,share" {
+		t.Fatalf("expected every scope by default, got %v (%v)", all.Scopes, err)
+	}
+	readOnly, _, err := svc.CreateAPIToken(ctx, owner, "backup", []string{" Files:Read ", "files:read"})
+	if err != nil || len(readOnly.Scopes) != 1 || readOnly.Scopes[0] != auth.ScopeFilesRead {
+		t.Fatalf("expected a single read scope, got %v (%v)", readOnly.Scopes, err)
+	}
+	for _, scopes := range [][]string{{}, {"admin"}, {"files:read", "files:delete"}} {
+		if _, _, err := svc.CreateAPIToken(ctx, owner, "bad", scopes); err == nil {
+			t.Fatalf("expected scopes %v to be rejected", scopes)
+		}
+	}
+}
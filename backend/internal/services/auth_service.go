@@ -16,6 +16,10 @@ import (
 type AuthService struct {
 	// UserRepo provides database operations for user management
 	UserRepo repository.UserRepository
+	// JWTKeys signs the session tokens issued on signup and login
+	JWTKeys *auth.KeySet
+	// APITokens stores long-lived tokens for programmatic access (optional)
+	APITokens repository.APITokenRepository
 }
 
 // Signup creates a new user account with email and password authentication.
@@ -32,12 +36,18 @@ type AuthService struct {
 //   - string: JWT token for authentication
 //   - error: nil on success, or an error if signup fails
 func (s *AuthService) Signup(ctx context.Context, email, password string) (*models.User, string, error) {
-	existingUser, _ := s.UserRepo.FindByEmail(ctx, email)
+	existingUser, err := s.UserRepo.FindByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, "", err
+	}
 	if existingUser != nil {
 		return nil, "", errors.New("user already exists")
 	}
 
-	existingGoogleUser, _ := s.UserRepo.FindByGoogleMail(ctx, email)
+	existingGoogleUser, err := s.UserRepo.FindByGoogleMail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, "", err
+	}
 	if existingGoogleUser != nil {
 		return nil, "", errors.New("you have already signed in with this email via Google. Please log in with Google")
 	}
@@ -57,7 +67,7 @@ func (s *AuthService) Signup(ctx context.Context, email, password string) (*mode
 	}
 
 	isAdmin := s.IsAdmin(user.Email)
-	token, err := auth.GenerateJWT(user.ID.String(), isAdmin)
+	token, err := auth.GenerateJWT(s.JWTKeys, user.ID.String(), isAdmin)
 	if err != nil {
 		return nil, "", err
 	}
@@ -89,7 +99,7 @@ func (s *AuthService) Login(ctx context.Context, email, password string) (*model
 	}
 
 	isAdmin := s.IsAdmin(user.Email)
-	token, err := auth.GenerateJWT(user.ID.String(), isAdmin)
+	token, err := auth.GenerateJWT(s.JWTKeys, user.ID.String(), isAdmin)
 	if err != nil {
 		return nil, "", err
 	}
@@ -2,16 +2,24 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
 )
 
 // stubUserRepo is a minimal in-memory stub for UserRepository used in tests
 type stubUserRepo struct {
 	usersByEmail  map[string]*models.User
 	googleByEmail map[string]*models.GoogleUser
+	// profileUpdates counts UpdateGoogleUserProfile calls
+	profileUpdates int
+	// adminInfo backs GetAdminUserInfo, keyed by user
+	adminInfo map[uuid.UUID]*models.AdminUserInfo
+	// emails backs GetUserEmailByID, keyed by user id
+	emails map[string]string
 }
 
 func (s *stubUserRepo) FindByEmail(ctx context.Context, email string) (*models.User, error) {
@@ -22,23 +30,39 @@ func (s *stubUserRepo) FindByGoogleMail(ctx context.Context, email string) (*mod
 }
 func (s *stubUserRepo) Create(ctx context.Context, user *models.User) error { return nil }
 func (s *stubUserRepo) CreateGoogleUser(ctx context.Context, user *models.GoogleUser) error {
+	if s.googleByEmail != nil {
+		s.googleByEmail[user.Email] = user
+	}
 	return nil
 }
 func (s *stubUserRepo) UpdateGoogleUserProfile(ctx context.Context, email, name, picture string) error {
+	s.profileUpdates++
 	return nil
 }
 func (s *stubUserRepo) FindByID(ctx context.Context, id string) (*models.User, error) {
 	return nil, nil
 }
 func (s *stubUserRepo) FindUserByEmailAny(ctx context.Context, email string) (interface{}, string, error) {
-	return nil, "", nil
+	if u := s.usersByEmail[email]; u != nil {
+		return u, "user", nil
+	}
+	if u := s.googleByEmail[email]; u != nil {
+		return u, "google_user", nil
+	}
+	return nil, "", repository.ErrNotFound
 }
 func (s *stubUserRepo) GetUserEmailByID(ctx context.Context, userID string) (string, error) {
-	return "", nil
+	return s.emails[userID], nil
 }
 func (s *stubUserRepo) GetAllUsers(ctx context.Context) ([]*models.AdminUserInfo, error) {
 	return nil, nil
 }
+func (s *stubUserRepo) GetAdminUserInfo(ctx context.Context, userID uuid.UUID) (*models.AdminUserInfo, error) {
+	if u := s.adminInfo[userID]; u != nil {
+		return u, nil
+	}
+	return nil, fmt.Errorf("user %s: %w", userID, repository.ErrNotFound)
+}
 
 func TestAuthService_IsAdmin(t *testing.T) {
 	svc := &AuthService{}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/useradityaa/internal/models"
+)
+
+// CDN serves downloads from an edge cache in front of object storage, so hot files don't
+// cost a MinIO presign and transfer on every request. Download URLs point at BaseURL with
+// the object key as path and carry an expiry and an HMAC-SHA256 signature the edge checks
+// before serving; see SignedURL for the exact scheme.
+type CDN struct {
+	// BaseURL is where the CDN serves the bucket's objects, e.g. https://cdn.example.com/files
+	BaseURL string
+	// SigningKey is the secret shared with the edge for verifying URL signatures
+	SigningKey []byte
+	// TTL is how long a signed URL stays valid (defaultCDNURLTTL when zero)
+	TTL time.Duration
+	// Purger evicts cached objects whose content was deleted or quarantined (optional;
+	// without it cached copies live until the edge's own expiry)
+	Purger CDNPurger
+}
+
+// CDNPurger evicts objects from a CDN's cache.
+type CDNPurger interface {
+	// Purge evicts the objects stored under keys.
+	Purge(ctx context.Context, keys []string) error
+}
+
+// defaultCDNURLTTL matches the lifetime of direct presigned URLs
+const defaultCDNURLTTL = 10 * time.Minute
+
+// NewCDN validates the CDN settings from configuration; an empty baseURL means no CDN and
+// returns nil. A signing key is required so the edge can't be used to read arbitrary keys.
+func NewCDN(baseURL, signingKey string, ttl time.Duration) (*CDN, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("CDN base URL %q must be an absolute http(s) URL", baseURL)
+	}
+	if signingKey == "" {
+		return nil, fmt.Errorf("a CDN signing key is required with a CDN base URL")
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("CDN URL lifetime must not be negative")
+	}
+	return &CDN{BaseURL: baseURL, SigningKey: []byte(signingKey), TTL: ttl}, nil
+}
+
+// SignedURL returns the URL serving key with the given content disposition until now plus
+// TTL. The signature is the hex HMAC-SHA256 over "/<key>\n<expires>\n<disposition>", so the
+// edge must verify it, check expires (Unix seconds) hasn't passed and forward the
+// disposition to the origin as response-content-disposition.
+func (c *CDN) SignedURL(key, disposition string, now time.Time) string {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = defaultCDNURLTTL
+	}
+	path := "/" + strings.TrimLeft(key, "/")
+	expires := strconv.FormatInt(now.Add(ttl).Unix(), 10)
+
+	mac := hmac.New(sha256.New, c.SigningKey)
+	mac.Write([]byte(path + "\n" + expires + "\n" + disposition))
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("disposition", disposition)
+	q.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	return c.BaseURL + (&url.URL{Path: path}).EscapedPath() + "?" + q.Encode()
+}
+
+// purgeCDN evicts a file's cached objects after its content was deleted or quarantined.
+// Failures are only logged: the edge's copy expires with its signed URLs, and the object
+// storage change already happened.
+func (s *FileService) purgeCDN(ctx context.Context, f *models.File) {
+	if s.CDN == nil || s.CDN.Purger == nil {
+		return
+	}
+	if err := s.CDN.Purger.Purge(ctx, objectKeyCandidates(f)); err != nil {
+		log.Printf("warning: failed to purge file %s from the CDN: %v", f.ID, err)
+	}
+}
+
+// HTTPPurger purges a CDN by POSTing {"paths": ["/<key>", ...]} to URL, the shape most CDN
+// purge APIs or a small adapter in front of them accept.
+type HTTPPurger struct {
+	// URL receives purge requests
+	URL string
+	// Token is sent as a bearer token when set
+	Token string
+	// Client sends the requests. When nil, a client giving up after Timeout is used
+	Client *http.Client
+	// Timeout bounds one purge request when Client is nil (defaultPurgeTimeout when zero).
+	// Purges run inline after storage changes, so a hung CDN mustn't hold them up
+	Timeout time.Duration
+}
+
+// defaultPurgeTimeout bounds a CDN purge request unless HTTPPurger.Timeout says otherwise
+const defaultPurgeTimeout = 10 * time.Second
+
+// Purge implements CDNPurger.
+func (p *HTTPPurger) Purge(ctx context.Context, keys []string) error {
+	paths := make([]string, len(keys))
+	for i, k := range keys {
+		paths[i] = "/" + strings.TrimLeft(k, "/")
+	}
+	body, err := json.Marshal(map[string][]string{"paths": paths})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	client := p.Client
+	if client == nil {
+		timeout := p.Timeout
+		if timeout <= 0 {
+			timeout = defaultPurgeTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("CDN purge returned %s", resp.Status)
+	}
+	return nil
+}
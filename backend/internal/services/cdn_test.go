@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/useradityaa/internal/models"
+)
+
+func TestNewCDN(t *testing.T) {
+	if cdn, err := NewCDN("  ", "key", 0); cdn != nil || err != nil {
+		t.Fatalf("expected no CDN without a base URL, got %+v (%v)", cdn, err)
+	}
+	cdn, err := NewCDN("https://cdn.example.com/files/", "key", time.Minute)
+	if err != nil || cdn.BaseURL != "https://cdn.example.com/files" || cdn.TTL != time.Minute {
+		t.Fatalf("unexpected CDN %+v (%v)", cdn, err)
+	}
+	for _, base := range []string{"cdn.example.com", "ftp://cdn.example.com", "https://"} {
+		if _, err := NewCDN(base, "key", 0); err == nil {
+			t.Fatalf("expected base URL %q to be rejected", base)
+		}
+	}
+	if _, err := NewCDN("https://cdn.example.com", "", 0); err == nil {
+		t.Fatalf("expected a CDN without a signing key to be rejected")
+	}
+}
+
+func TestCDN_SignedURL(t *testing.T) {
+	cdn := &CDN{BaseURL: "https://cdn.example.com/files", SigningKey: []byte("secret"), TTL: time.Hour}
+	now := time.Unix(1700000000, 0)
+	raw := cdn.SignedURL("files/ab cd", `attachment; filename="a b.txt"`, now)
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("bad url %q: %v", raw, err)
+	}
+	if u.Host != "cdn.example.com" || u.Path != "/files/files/ab cd" || !strings.Contains(raw, "/files/files/ab%20cd?") {
+		t.Fatalf("expected the object key under the base path, got %s", raw)
+	}
+	q := u.Query()
+	if q.Get("expires") != strconv.FormatInt(now.Add(time.Hour).Unix(), 10) {
+		t.Fatalf("expected expiry an hour out, got %s", q.Get("expires"))
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("/files/ab cd\n" + q.Get("expires") + "\n" + `attachment; filename="a b.txt"`))
+	if q.Get("signature") != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("signature doesn't verify: %s", raw)
+	}
+
+	// Without a TTL URLs last as long as direct presigns
+	cdn.TTL = 0
+	u, _ = url.Parse(cdn.SignedURL("k", "inline", now))
+	if u.Query().Get("expires") != strconv.FormatInt(now.Add(defaultCDNURLTTL).Unix(), 10) {
+		t.Fatalf("expected the default lifetime, got %s", u.Query().Get("expires"))
+	}
+}
+
+func TestFileService_GetFileURL_CDNSelection(t *testing.T) {
+	client, err := minio.New("localhost:9000", &minio.Options{Creds: credentials.NewStaticV4("key", "secret", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	fileID := uuid.New()
+	repo := &stubFileRepo{names: map[uuid.UUID]string{fileID: "report.pdf"}}
+	fs := NewFileService(repo, client, "bucket", "https://files.example.com")
+	ctx := context.Background()
+
+	direct, err := fs.GetFileURL(ctx, uuid.New(), fileID, false)
+	if err != nil || !strings.HasPrefix(direct, "https://files.example.com/bucket/") {
+		t.Fatalf("expected a presigned MinIO URL without a CDN, got %q (%v)", direct, err)
+	}
+
+	fs.CDN = &CDN{BaseURL: "https://cdn.example.com", SigningKey: []byte("secret")}
+	viaCDN, err := fs.GetFileURL(WithPublicEndpoint(ctx, "http://minio.internal:9000"), uuid.New(), fileID, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, _ := url.Parse(viaCDN)
+	if u.Host != "cdn.example.com" || u.Path != "/files/"+fileID.String() || u.Query().Get("disposition") != `inline; filename="report.pdf"` {
+		t.Fatalf("expected a signed CDN URL for the object, got %s", viaCDN)
+	}
+	if u.Query().Get("X-Amz-Signature") != "" {
+		t.Fatalf("expected no MinIO presign with a CDN, got %s", viaCDN)
+	}
+
+	// Quarantined content is refused whichever way it would be served
+	repo.statuses = map[uuid.UUID]string{fileID: models.FileStatusQuarantined}
+	if _, err := fs.GetFileURL(ctx, uuid.New(), fileID, false); !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("expected quarantined content to be refused, got %v", err)
+	}
+}
+
+type stubPurger struct {
+	keys [][]string
+	err  error
+}
+
+func (p *stubPurger) Purge(ctx context.Context, keys []string) error {
+	p.keys = append(p.keys, keys)
+	return p.err
+}
+
+func TestFileService_DeleteStoredFile_PurgesCDN(t *testing.T) {
+	purger := &stubPurger{err: errors.New("edge unreachable")}
+	fs, removed := deleteModeService(&stubFileRepo{}, DeleteModeImmediate)
+	fs.CDN = &CDN{BaseURL: "https://cdn.example.com", SigningKey: []byte("secret"), Purger: purger}
+	f := &models.File{ID: uuid.New(), Hash: strings.Repeat("a", 64), StoragePath: "files/" + strings.Repeat("a", 64)}
+
+	// A failed purge is logged, not returned: the content is already gone from storage
+	if err := fs.deleteStoredFile(context.Background(), f); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(purger.keys) != 1 || strings.Join(purger.keys[0], ",") != strings.Join(*removed, ",") {
+		t.Fatalf("expected the removed keys %v to be purged, got %v", *removed, purger.keys)
+	}
+}
+
+func TestHTTPPurger(t *testing.T) {
+	var got struct{ Paths []string }
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("bad purge body: %v", err)
+		}
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	p := &HTTPPurger{URL: srv.URL + "/purge", Token: "t0k"}
+	if err := p.Purge(context.Background(), []string{"files/abc", "files/ab/c"}); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if auth != "Bearer t0k" || strings.Join(got.Paths, ",") != "/files/abc,/files/ab/c" {
+		t.Fatalf("unexpected purge request: auth %q, paths %v", auth, got.Paths)
+	}
+	p.URL = srv.URL + "/fail"
+	if err := p.Purge(context.Background(), []string{"files/abc"}); err == nil {
+		t.Fatalf("expected a failed purge to be reported")
+	}
+}
+
+func TestHTTPPurger_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p := &HTTPPurger{URL: srv.URL, Timeout: 50 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- p.Purge(context.Background(), []string{"files/abc"}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected a hung purge to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("purge didn't give up on a hung CDN")
+	}
+}
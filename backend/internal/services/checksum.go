@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// FileChecksum lets a client verify the integrity of a downloaded file.
+type FileChecksum struct {
+	FileID uuid.UUID
+	// SHA256 is the hex SHA-256 of the content
+	SHA256 string
+	// CRC32 is the IEEE CRC-32 of the content as 8 hex digits; empty unless requested
+	CRC32 string
+	Size  int64
+}
+
+// GetFileChecksum returns the SHA-256 of one of the user's files, for checking a
+// download against. Only users holding an active copy of the file get it, so it can't
+// be used to probe whether some content is stored. withCRC32 also computes a CRC-32
+// for quick checks; that reads the whole object, so it is only done on request.
+func (s *FileService) GetFileChecksum(ctx context.Context, userID, fileID uuid.UUID, withCRC32 bool) (*FileChecksum, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	uf, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
+		return nil, fmt.Errorf("not found or unauthorized")
+	}
+	if uf.File.Status == models.FileStatusQuarantined {
+		return nil, ErrFileQuarantined
+	}
+	sum := &FileChecksum{FileID: fileID, SHA256: uf.File.Hash, Size: uf.File.Size}
+	if withCRC32 {
+		if sum.CRC32, err = s.objectCRC32(ctx, &uf.File); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// objectCRC32 streams f's object through a CRC-32.
+func (s *FileService) objectCRC32(ctx context.Context, f *models.File) (string, error) {
+	obj, err := s.openObject(ctx, f)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, obj); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return fmt.Sprintf("%08x", h.Sum32()), nil
+}
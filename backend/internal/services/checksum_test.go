@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+func TestFileService_GetFileChecksum(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{filesByHash: map[string]*models.File{"2cf24dba": {ID: fileID, Size: 5}}}
+	fs := NewFileService(repo, nil, "", "")
+	reads := 0
+	fs.objectReader = func(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+		reads++
+		return io.NopCloser(strings.NewReader("hello")), nil
+	}
+
+	sum, err := fs.GetFileChecksum(ctx, userID, fileID, false)
+	if err != nil || sum.SHA256 != "2cf24dba" || sum.Size != 5 || sum.CRC32 != "" {
+		t.Fatalf("expected the stored hash without a CRC-32, got %+v (%v)", sum, err)
+	}
+	if reads != 0 {
+		t.Fatalf("expected the object not to be read without a CRC-32")
+	}
+
+	sum, err = fs.GetFileChecksum(ctx, userID, fileID, true)
+	if err != nil || sum.CRC32 != "3610a686" {
+		t.Fatalf("expected the CRC-32 of the content, got %+v (%v)", sum, err)
+	}
+}
+
+func TestFileService_GetFileChecksum_RequiresAccess(t *testing.T) {
+	ctx := context.Background()
+	fileID, quarantined := uuid.New(), uuid.New()
+	repo := &stubFileRepo{
+		unmapped: map[uuid.UUID]bool{fileID: true},
+		statuses: map[uuid.UUID]string{quarantined: models.FileStatusQuarantined},
+	}
+	fs := NewFileService(repo, nil, "", "")
+	fs.objectReader = func(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+		t.Fatalf("expected no object read for a file the user can't get")
+		return nil, nil
+	}
+
+	if sum, err := fs.GetFileChecksum(ctx, uuid.New(), fileID, true); err == nil {
+		t.Fatalf("expected a file without a copy of the user's to be refused, got %+v", sum)
+	}
+	if _, err := fs.GetFileChecksum(ctx, uuid.New(), quarantined, true); !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("expected quarantined content to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamavChunkSize is how much content is sent per INSTREAM chunk
+const clamavChunkSize = 64 << 10
+
+// ClamAVScanner scans content with a clamd daemon over TCP using its INSTREAM command.
+// The content is streamed, so files larger than clamd's StreamMaxLength come back as a
+// scan error and are rejected.
+type ClamAVScanner struct {
+	// Addr is clamd's host:port, e.g. "clamav:3310"
+	Addr string
+}
+
+// Scan streams content to clamd and reports the signature it found, if any. The scan is
+// abandoned when ctx is done.
+func (c *ClamAVScanner) Scan(ctx context.Context, filename string, content io.Reader) (bool, string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return false, "", fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	// Unblock reads and writes in flight when ctx ends
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if err := c.stream(conn, content); err != nil {
+		if ctx.Err() != nil {
+			return false, "", ctx.Err()
+		}
+		return false, "", fmt.Errorf("clamd: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, "", ctx.Err()
+		}
+		return false, "", fmt.Errorf("clamd: reading reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00"))
+}
+
+// stream sends content as an INSTREAM command: length-prefixed chunks ended by a zero length.
+func (c *ClamAVScanner) stream(w io.Writer, content io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, 4+clamavChunkSize)
+	for {
+		n, err := content.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading content: %w", err)
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamdReply reads "stream: OK", "stream: <signature> FOUND" or "<message> ERROR".
+func parseClamdReply(reply string) (bool, string, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return false, "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return true, strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return false, "", fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts one INSTREAM scan and replies FOUND when the content contains
+// "EICAR", OK otherwise; it answers nothing when hang is set
+func fakeClamd(t *testing.T, hang bool) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback listener: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+			return
+		}
+		var content []byte
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size[:])
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			content = append(content, chunk...)
+		}
+		received <- content
+		if hang {
+			io.Copy(io.Discard, conn)
+			return
+		}
+		reply := "stream: OK\x00"
+		if bytes.Contains(content, []byte("EICAR")) {
+			reply = "stream: Eicar-Test-Signature FOUND\x00"
+		}
+		io.WriteString(conn, reply)
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestClamAVScanner_Scan(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("a", 3*clamavChunkSize/2) + "EICAR"
+	addr, received := fakeClamd(t, false)
+	flagged, reason, err := (&ClamAVScanner{Addr: addr}).Scan(ctx, "eicar.com", strings.NewReader(content))
+	if err != nil || !flagged || reason != "Eicar-Test-Signature" {
+		t.Fatalf("expected the signature reported, got flagged=%v reason=%q (%v)", flagged, reason, err)
+	}
+	if got := <-received; string(got) != content {
+		t.Fatalf("expected clamd to receive the whole content, got %d of %d bytes", len(got), len(content))
+	}
+
+	addr, _ = fakeClamd(t, false)
+	if flagged, _, err := (&ClamAVScanner{Addr: addr}).Scan(ctx, "notes.txt", strings.NewReader("hello")); err != nil || flagged {
+		t.Fatalf("expected clean content passed, got flagged=%v (%v)", flagged, err)
+	}
+}
+
+func TestClamAVScanner_Timeout(t *testing.T) {
+	addr, _ := fakeClamd(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := (&ClamAVScanner{Addr: addr}).Scan(ctx, "slow.bin", strings.NewReader("hello")); err == nil {
+		t.Fatalf("expected a clamd that never answers to fail the scan")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	if _, _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR"); err == nil || !strings.Contains(err.Error(), "size limit") {
+		t.Fatalf("expected clamd errors reported, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// ContentScanner inspects uploaded content before it is added to a user's storage,
+// e.g. by handing it to an antivirus engine.
+type ContentScanner interface {
+	// Scan reports whether the content is flagged and why. An error means the content
+	// could not be scanned; the upload is then rejected.
+	Scan(ctx context.Context, filename string, content io.Reader) (flagged bool, reason string, err error)
+}
+
+// NopScanner passes all content without reading it; it is the scanner when none is
+// configured.
+type NopScanner struct{}
+
+// Scan reports the content as clean.
+func (NopScanner) Scan(ctx context.Context, filename string, content io.Reader) (bool, string, error) {
+	return false, "", nil
+}
+
+// defaultScanTimeout bounds a scan when ScanTimeout isn't set
+const defaultScanTimeout = time.Minute
+
+// ErrFileQuarantined is returned when a download is requested for quarantined content.
+var ErrFileQuarantined = errors.New("file is quarantined pending admin review")
+
+// ErrContentFlagged is wrapped by upload errors for content the scanner flagged.
+var ErrContentFlagged = errors.New("content flagged by scanner")
+
+// scanUpload runs the configured scanner over new content, streamed from the spool. It
+// returns the status the content should be stored with, or an error when the upload must
+// be rejected: scan failures and scans running past ScanTimeout always reject, flagged
+// content is rejected unless QuarantineFlagged is set.
+func (s *FileService) scanUpload(ctx context.Context, filename string, su *spooledUpload) (string, string, error) {
+	if s.Scanner == nil {
+		return models.FileStatusActive, "", nil
+	}
+	timeout := s.ScanTimeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	flagged, reason, err := s.Scanner.Scan(ctx, filename, su.Reader())
+	if err == nil && ctx.Err() != nil {
+		// A scanner that ignores its context still doesn't get to pass late content
+		err = ctx.Err()
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to scan %s: %w", filename, err)
+	}
+	if !flagged {
+		return models.FileStatusActive, "", nil
+	}
+	if !s.QuarantineFlagged {
+		return "", "", fmt.Errorf("%w: upload rejected: %s was flagged by the content scanner: %s", ErrContentFlagged, filename, reason)
+	}
+	return models.FileStatusQuarantined, reason, nil
+}
+
+// ListQuarantinedFiles lists quarantined content for admin review. Callers must check admin rights.
+func (s *FileService) ListQuarantinedFiles(ctx context.Context) ([]models.UserFile, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	return s.FileRepo.ListQuarantinedFiles(ctx)
+}
+
+// ReleaseQuarantinedFile makes quarantined content downloadable again after review.
+// Callers must check admin rights.
+func (s *FileService) ReleaseQuarantinedFile(ctx context.Context, fileID uuid.UUID) error {
+	if _, err := s.quarantinedFile(ctx, fileID); err != nil {
+		return err
+	}
+	if _, err := s.FileRepo.SetFileStatus(ctx, fileID, models.FileStatusActive, ""); err != nil {
+		return fmt.Errorf("failed to release file: %w", err)
+	}
+	return nil
+}
+
+// DeleteQuarantinedFile removes quarantined content from object storage and deletes the
+// file together with every user's mapping of it, unless any of them is under retention.
+// Callers must check admin rights.
+func (s *FileService) DeleteQuarantinedFile(ctx context.Context, fileID uuid.UUID) error {
+	f, err := s.quarantinedFile(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkRetention(ctx, fileID); err != nil {
+		return err
+	}
+	return s.deleteStoredFile(ctx, f)
+}
+
+// quarantinedFile loads a file and checks that it is quarantined.
+func (s *FileService) quarantinedFile(ctx context.Context, fileID uuid.UUID) (*models.File, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	f, err := s.FileRepo.GetByID(ctx, fileID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && f == nil) {
+		return nil, fmt.Errorf("file not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Status != models.FileStatusQuarantined {
+		return nil, fmt.Errorf("file is not quarantined")
+	}
+	return f, nil
+}
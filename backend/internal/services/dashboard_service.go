@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// defaultDashboardListLimit is how many entries each dashboard list shows by default
+const defaultDashboardListLimit = 10
+
+// maxDashboardListLimit caps each dashboard list
+const maxDashboardListLimit = 50
+
+// DashboardLimits bounds the lists of a dashboard; each is limited on its own. Zero or less
+// picks the default of 10 and values above 50 are capped.
+type DashboardLimits struct {
+	RecentFiles    int
+	RecentActivity int
+	Starred        int
+}
+
+// Dashboard is everything the home screen shows, gathered in one call.
+type Dashboard struct {
+	// UsedBytes and QuotaBytes are as reported by FileService.GetUserUsage
+	UsedBytes  int64
+	QuotaBytes int64
+	// RecentFiles are the user's latest uploads, newest first. RecentFilesCursor continues
+	// them as a SearchUserFiles page without filters would; nil when there are no more
+	RecentFiles       []models.UserFile
+	RecentFilesCursor *string
+	// RecentActivity is the user's latest previews and downloads, with the files they were
+	// on in ActivityFiles; activity on files that no longer exist is left out
+	RecentActivity []models.RecentFileActivity
+	ActivityFiles  map[uuid.UUID]*models.File
+	// Starred are the user's starred files and folders, most recently starred first
+	Starred []models.StarredItem
+	// SharedWithMe counts the files and folders currently shared with the user
+	SharedWithMe int
+	// TrashFiles and TrashBytes count the user's soft-deleted files
+	TrashFiles int
+	TrashBytes int64
+}
+
+// DashboardService builds the home screen from the services behind each of its sections.
+type DashboardService struct {
+	Files *FileService
+	// The services below are optional; without one its section stays empty
+	Activity *FileActivityService
+	Starred  *StarredService
+	Shares   *ShareService
+}
+
+func NewDashboardService(files *FileService, activity *FileActivityService, starred *StarredService, shares *ShareService) *DashboardService {
+	return &DashboardService{
+		Files:    files,
+		Activity: activity,
+		Starred:  starred,
+		Shares:   shares,
+	}
+}
+
+// dashboardLimit applies the default and cap to one list's requested size.
+func dashboardLimit(n int) int {
+	if n <= 0 {
+		return defaultDashboardListLimit
+	}
+	if n > maxDashboardListLimit {
+		return maxDashboardListLimit
+	}
+	return n
+}
+
+// GetDashboard gathers the user's usage, recent files and activity, starred items, the
+// number of items shared with them and their trash in one call.
+func (s *DashboardService) GetDashboard(ctx context.Context, userID uuid.UUID, limits DashboardLimits) (*Dashboard, error) {
+	if s == nil || s.Files == nil {
+		return nil, ErrStorageUnavailable
+	}
+	d := &Dashboard{}
+	var err error
+	if d.UsedBytes, d.QuotaBytes, err = s.Files.GetUserUsage(ctx, userID); err != nil {
+		return nil, fmt.Errorf("usage: %w", err)
+	}
+
+	files, cursor, _, err := s.Files.SearchUserFiles(ctx, userID, repository.SearchFilter{}, repository.Page{Limit: dashboardLimit(limits.RecentFiles)})
+	if err != nil {
+		return nil, fmt.Errorf("recent files: %w", err)
+	}
+	d.RecentFiles, d.RecentFilesCursor = files, cursor
+
+	if d.TrashFiles, d.TrashBytes, err = s.Files.FileRepo.GetDeletedUserFilesTotals(ctx, userID); err != nil {
+		return nil, fmt.Errorf("trash: %w", err)
+	}
+
+	if s.Activity != nil {
+		activity, err := s.Activity.GetRecentFileActivities(ctx, userID, dashboardLimit(limits.RecentActivity))
+		if err != nil {
+			return nil, fmt.Errorf("recent activity: %w", err)
+		}
+		ids := make([]uuid.UUID, 0, len(activity))
+		for _, a := range activity {
+			ids = append(ids, a.FileID)
+		}
+		found, err := s.Activity.FileRepo.GetByIDs(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("recent activity: %w", err)
+		}
+		d.ActivityFiles = map[uuid.UUID]*models.File{}
+		for i := range found {
+			d.ActivityFiles[found[i].ID] = &found[i]
+		}
+		for _, a := range activity {
+			// Files deleted since are skipped, as in myRecentFileActivities
+			if d.ActivityFiles[a.FileID] != nil {
+				d.RecentActivity = append(d.RecentActivity, a)
+			}
+		}
+	}
+
+	if s.Starred != nil {
+		starred, err := s.Starred.GetAllStarredItems(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("starred: %w", err)
+		}
+		if n := dashboardLimit(limits.Starred); len(starred) > n {
+			starred = starred[:n]
+		}
+		d.Starred = starred
+	}
+
+	if s.Shares != nil {
+		sharedFiles, err := s.Shares.GetSharedFilesWithMe(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("shared files: %w", err)
+		}
+		sharedFolders, err := s.Shares.GetSharedFoldersWithMe(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("shared folders: %w", err)
+		}
+		d.SharedWithMe = len(sharedFiles) + len(sharedFolders)
+	}
+	return d, nil
+}
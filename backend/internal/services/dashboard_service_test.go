@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// stubStarredRepo backs GetAllStarredItems with a fixed, newest-first list
+type stubStarredRepo struct {
+	items []models.StarredItem
+}
+
+func (s *stubStarredRepo) StarItem(ctx context.Context, userID uuid.UUID, itemType string, itemID uuid.UUID) error {
+	return nil
+}
+func (s *stubStarredRepo) UnstarItem(ctx context.Context, userID uuid.UUID, itemType string, itemID uuid.UUID) error {
+	return nil
+}
+func (s *stubStarredRepo) IsItemStarred(ctx context.Context, userID uuid.UUID, itemType string, itemID uuid.UUID) (bool, error) {
+	return false, nil
+}
+func (s *stubStarredRepo) GetStarredFiles(ctx context.Context, userID uuid.UUID) ([]models.StarredFile, error) {
+	return nil, nil
+}
+func (s *stubStarredRepo) GetStarredFolders(ctx context.Context, userID uuid.UUID) ([]models.StarredFolder, error) {
+	return nil, nil
+}
+func (s *stubStarredRepo) GetAllStarredItems(ctx context.Context, userID uuid.UUID) ([]models.StarredItem, error) {
+	return s.items, nil
+}
+func (s *stubStarredRepo) GetStarredStatus(ctx context.Context, userID uuid.UUID, items []struct {
+	Type string
+	ID   uuid.UUID
+}) (map[string]bool, error) {
+	return nil, nil
+}
+
+func TestDashboardService_GetDashboard(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	email := "me@example.com"
+
+	repo := &stubFileRepo{usage: 4096, filesByHash: map[string]*models.File{}}
+	var uploaded []uuid.UUID
+	for i := 0; i < 4; i++ {
+		fileID := uuid.New()
+		repo.addMapping(userID, fileID)
+		uploaded = append(uploaded, fileID)
+	}
+	// One file in the trash, with its size known for the trash total
+	trashed := uuid.New()
+	repo.filesByHash["trashed"] = &models.File{ID: trashed, Size: 300}
+	repo.mappings = append(repo.mappings, &stubMapping{id: uuid.New(), userID: userID, fileID: trashed, deleted: true})
+	// Another user's file doesn't show up
+	repo.addMapping(uuid.New(), uuid.New())
+
+	gone := uuid.New()
+	repo.gone = map[uuid.UUID]bool{gone: true}
+	now := time.Now()
+	activity := &stubActivityRepo{recent: map[uuid.UUID][]models.RecentFileActivity{userID: {
+		{FileID: uploaded[0], UserID: userID, LastActivityType: "preview", LastActivityAt: now, ActivityCount: 2},
+		{FileID: gone, UserID: userID, LastActivityType: "download", LastActivityAt: now.Add(-time.Minute), ActivityCount: 1},
+	}}}
+	starred := &stubStarredRepo{items: []models.StarredItem{
+		{ID: uuid.New(), ItemType: "file", ItemID: uploaded[1]},
+		{ID: uuid.New(), ItemType: "folder", ItemID: uuid.New()},
+		{ID: uuid.New(), ItemType: "file", ItemID: uploaded[2]},
+	}}
+	shares := &stubShareRepo{
+		fileShares:   []models.FileShare{{SharedWithEmail: email}, {SharedWithEmail: "other@example.com"}},
+		folderShares: []models.FolderShare{{SharedWithEmail: email}},
+	}
+	users := &stubUserRepo{emails: map[string]string{userID.String(): email}}
+
+	files := NewFileService(repo, nil, "", "")
+	svc := NewDashboardService(
+		files,
+		NewFileActivityService(activity, repo),
+		NewStarredService(starred, repo, nil),
+		NewShareService(shares, users, repo, nil),
+	)
+	d, err := svc.GetDashboard(ctx, userID, DashboardLimits{RecentFiles: 2, Starred: 2})
+	if err != nil {
+		t.Fatalf("dashboard: %v", err)
+	}
+
+	if d.UsedBytes != 4096 || d.QuotaBytes != defaultQuotaBytes {
+		t.Fatalf("unexpected usage %d of %d", d.UsedBytes, d.QuotaBytes)
+	}
+	if len(d.RecentFiles) != 2 || d.RecentFiles[0].FileID != uploaded[3] || d.RecentFiles[1].FileID != uploaded[2] {
+		t.Fatalf("expected the two newest uploads, newest first, got %+v", d.RecentFiles)
+	}
+	if d.RecentFilesCursor == nil || *d.RecentFilesCursor != repository.FileCursor(d.RecentFiles[1], repository.SortByUploadedAt) {
+		t.Fatalf("expected a cursor continuing after the second file, got %v", d.RecentFilesCursor)
+	}
+	if len(d.RecentActivity) != 1 || d.RecentActivity[0].FileID != uploaded[0] || d.ActivityFiles[uploaded[0]] == nil {
+		t.Fatalf("expected the activity on the remaining file only, got %+v", d.RecentActivity)
+	}
+	if repo.byIDsCalls != 1 {
+		t.Fatalf("expected the activity's files loaded in one lookup, got %d", repo.byIDsCalls)
+	}
+	if len(d.Starred) != 2 || d.Starred[0].ItemID != uploaded[1] {
+		t.Fatalf("expected the first two starred items, got %+v", d.Starred)
+	}
+	if d.SharedWithMe != 2 {
+		t.Fatalf("expected one file and one folder shared with the user, got %d", d.SharedWithMe)
+	}
+	if d.TrashFiles != 1 || d.TrashBytes != 300 {
+		t.Fatalf("expected one 300-byte file in the trash, got %d files, %d bytes", d.TrashFiles, d.TrashBytes)
+	}
+}
+
+func TestDashboardService_OptionalSections(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	repo := &stubFileRepo{}
+	for i := 0; i < maxDashboardListLimit+5; i++ {
+		repo.addMapping(userID, uuid.New())
+	}
+
+	// Sections without a service stay empty; the default limit still applies
+	d, err := NewDashboardService(NewFileService(repo, nil, "", ""), nil, nil, nil).GetDashboard(ctx, userID, DashboardLimits{})
+	if err != nil {
+		t.Fatalf("dashboard: %v", err)
+	}
+	if len(d.RecentFiles) != defaultDashboardListLimit || d.RecentFilesCursor == nil || d.RecentActivity != nil || d.Starred != nil || d.SharedWithMe != 0 {
+		t.Fatalf("unexpected dashboard %+v", d)
+	}
+	if d, _ = NewDashboardService(NewFileService(repo, nil, "", ""), nil, nil, nil).GetDashboard(ctx, userID, DashboardLimits{RecentFiles: 1000}); len(d.RecentFiles) != maxDashboardListLimit {
+		t.Fatalf("expected recent files capped at %d, got %d", maxDashboardListLimit, len(d.RecentFiles))
+	}
+
+	if _, err := NewDashboardService(nil, nil, nil, nil).GetDashboard(ctx, userID, DashboardLimits{}); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("expected ErrStorageUnavailable without a file service, got %v", err)
+	}
+}
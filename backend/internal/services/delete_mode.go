@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/repository"
+)
+
+// DeleteMode decides what the standard delete does with a user's file.
+type DeleteMode string
+
+const (
+	// DeleteModeTrash moves the file to Recently Deleted, from where it can be recovered
+	DeleteModeTrash DeleteMode = "trash"
+	// DeleteModeImmediate removes the mapping for good; the object and file row go too
+	// once no other mapping references the content
+	DeleteModeImmediate DeleteMode = "immediate"
+)
+
+// ParseDeleteMode validates a delete mode from configuration; empty means trash.
+func ParseDeleteMode(name string) (DeleteMode, error) {
+	switch DeleteMode(strings.ToLower(strings.TrimSpace(name))) {
+	case "", DeleteModeTrash:
+		return DeleteModeTrash, nil
+	case DeleteModeImmediate:
+		return DeleteModeImmediate, nil
+	}
+	return "", fmt.Errorf("unknown delete mode %q (want %q or %q)", name, DeleteModeTrash, DeleteModeImmediate)
+}
+
+// deleteMode returns mode, or the configured DeleteMode when mode is empty.
+func (s *FileService) deleteMode(mode DeleteMode) (DeleteMode, error) {
+	if mode == "" {
+		mode = s.DeleteMode
+	}
+	return ParseDeleteMode(string(mode))
+}
+
+// DeleteFile is the standard delete for a file: with several active copies of the content
+// it takes the newest, like SoftDeleteUserFile. mode overrides the configured DeleteMode
+// when set.
+func (s *FileService) DeleteFile(ctx context.Context, userID, fileID uuid.UUID, mode DeleteMode) error {
+	if s == nil || s.FileRepo == nil {
+		return ErrStorageUnavailable
+	}
+	mode, err := s.deleteMode(mode)
+	if err != nil {
+		return err
+	}
+	if mode == DeleteModeTrash {
+		return s.SoftDeleteUserFile(ctx, userID, fileID)
+	}
+	files, err := s.FileRepo.GetUserFilesByFileIDs(ctx, userID, []uuid.UUID{fileID})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("file %s: %w", fileID, repository.ErrNotFound)
+	}
+	return s.purgeMapping(ctx, userID, files[0].ID, fileID)
+}
+
+// DeleteFileByMappingID is DeleteFile for one particular copy of a file.
+func (s *FileService) DeleteFileByMappingID(ctx context.Context, userID, mappingID uuid.UUID, mode DeleteMode) error {
+	if s == nil || s.FileRepo == nil {
+		return ErrStorageUnavailable
+	}
+	mode, err := s.deleteMode(mode)
+	if err != nil {
+		return err
+	}
+	if mode == DeleteModeTrash {
+		return s.SoftDeleteUserFileByMappingID(ctx, userID, mappingID.String())
+	}
+	uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mappingID)
+	if err != nil {
+		return err
+	}
+	if uf == nil {
+		// Editors only ever move the files they added to a shared folder to the owner's trash
+		return s.SoftDeleteUserFileByMappingID(ctx, userID, mappingID.String())
+	}
+	if uf.DeletedAt != nil {
+		return fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+	}
+	return s.purgeMapping(ctx, userID, mappingID, uf.FileID)
+}
+
+// purgeMapping deletes an active mapping without passing through the trash and releases
+// the content if nothing references it anymore.
+func (s *FileService) purgeMapping(ctx context.Context, userID, mappingID, fileID uuid.UUID) error {
+	if err := s.checkRetention(ctx, fileID, mappingID); err != nil {
+		return err
+	}
+	if err := s.FileRepo.DeleteUserFileByMappingID(ctx, userID, mappingID); err != nil {
+		return err
+	}
+	return s.releaseFile(ctx, fileID)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/repository"
+)
+
+func TestParseDeleteMode(t *testing.T) {
+	for in, want := range map[string]DeleteMode{"": DeleteModeTrash, "trash": DeleteModeTrash, " Immediate ": DeleteModeImmediate} {
+		if got, err := ParseDeleteMode(in); err != nil || got != want {
+			t.Fatalf("%q: expected %q, got %q (%v)", in, want, got, err)
+		}
+	}
+	if _, err := ParseDeleteMode("shred"); err == nil {
+		t.Fatalf("expected an unknown mode to be rejected")
+	}
+}
+
+// deleteModeService returns a file service over repo that records removed object keys
+func deleteModeService(repo *stubFileRepo, mode DeleteMode) (*FileService, *[]string) {
+	fs := NewFileService(repo, nil, "", "")
+	fs.DeleteMode = mode
+	var removed []string
+	fs.objectRemover = func(ctx context.Context, key string) error {
+		removed = append(removed, key)
+		return nil
+	}
+	return fs, &removed
+}
+
+func TestFileService_DeleteFile_TrashMode(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	repo.addMapping(userID, fileID)
+	fs, removed := deleteModeService(repo, DeleteModeTrash)
+
+	if err := fs.DeleteFile(ctx, userID, fileID, ""); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if active, total, _ := repo.CountFileMappings(ctx, fileID); active != 0 || total != 1 || len(*removed) != 0 {
+		t.Fatalf("expected the file in the trash with its object kept, got %d of %d and removed %v", active, total, *removed)
+	}
+	if err := fs.RecoverUserFile(ctx, userID, fileID); err != nil {
+		t.Fatalf("expected a trashed file to be recoverable, got %v", err)
+	}
+	if active, _, _ := repo.CountFileMappings(ctx, fileID); active != 1 {
+		t.Fatalf("expected the file back after recovery, got %d active", active)
+	}
+}
+
+func TestFileService_DeleteFile_ImmediateMode(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	repo.addMapping(userID, fileID)
+	fs, removed := deleteModeService(repo, DeleteModeImmediate)
+
+	if err := fs.DeleteFile(ctx, userID, fileID, ""); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, total, _ := repo.CountFileMappings(ctx, fileID); total != 0 {
+		t.Fatalf("expected no mapping left, got %d", total)
+	}
+	if len(*removed) == 0 || !repo.gone[fileID] {
+		t.Fatalf("expected the object and file row removed, got removed %v, gone %v", *removed, repo.gone[fileID])
+	}
+	if err := fs.RecoverUserFile(ctx, userID, fileID); err == nil {
+		t.Fatalf("expected an immediately deleted file not to be recoverable")
+	}
+	if err := fs.DeleteFile(ctx, userID, fileID, ""); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound deleting again, got %v", err)
+	}
+}
+
+func TestFileService_DeleteFile_ImmediateKeepsSharedContent(t *testing.T) {
+	ctx := context.Background()
+	userID, otherID, fileID := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	mine := repo.addMapping(userID, fileID)
+	repo.addMapping(userID, fileID)
+	repo.addMapping(otherID, fileID)
+	fs, removed := deleteModeService(repo, DeleteModeImmediate)
+
+	// Only the chosen copy goes; the content stays for the remaining copies
+	if err := fs.DeleteFileByMappingID(ctx, userID, mine, ""); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if active, total, _ := repo.CountFileMappings(ctx, fileID); active != 2 || total != 2 {
+		t.Fatalf("expected two copies left, got %d of %d", active, total)
+	}
+	if len(*removed) != 0 || repo.gone[fileID] {
+		t.Fatalf("expected the object kept while referenced, removed %v", *removed)
+	}
+}
+
+func TestFileService_DeleteFile_ModeOverride(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	repo.addMapping(userID, fileID)
+	fs, removed := deleteModeService(repo, DeleteModeImmediate)
+
+	// A per-request trash overrides the immediate default
+	if err := fs.DeleteFile(ctx, userID, fileID, DeleteModeTrash); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, total, _ := repo.CountFileMappings(ctx, fileID); total != 1 || len(*removed) != 0 {
+		t.Fatalf("expected the file trashed, not purged; %d mappings, removed %v", total, *removed)
+	}
+	if err := fs.DeleteFile(ctx, userID, fileID, "shred"); err == nil {
+		t.Fatalf("expected an unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DownloadNameTemplate shapes the filename downloads are offered under, e.g.
+// "{folder} - {original}". It only changes the name in the content disposition; stored
+// names are untouched. The empty template behaves like "{original}".
+type DownloadNameTemplate string
+
+// DefaultDownloadNameTemplate offers every file under its uploaded name
+const DefaultDownloadNameTemplate DownloadNameTemplate = "{original}"
+
+// maxDownloadNameLen caps expanded names so long folder names can't build unusable headers
+const maxDownloadNameLen = 255
+
+var downloadNamePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// downloadNamePlaceholders lists the placeholders a template may use
+var downloadNamePlaceholders = map[string]bool{
+	"{original}": true, // the uploaded filename
+	"{name}":     true, // the uploaded filename without its extension
+	"{ext}":      true, // the extension including the dot, empty without one
+	"{date}":     true, // the upload date as YYYY-MM-DD (UTC)
+	"{folder}":   true, // the folder the file is in, empty at the root
+}
+
+// ParseDownloadNameTemplate validates a template from configuration; empty means
+// "{original}". Unknown placeholders and stray braces are rejected, and the template must
+// include {original} or {name} so different files don't all download under one name.
+func ParseDownloadNameTemplate(s string) (DownloadNameTemplate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultDownloadNameTemplate, nil
+	}
+	for _, p := range downloadNamePlaceholder.FindAllString(s, -1) {
+		if !downloadNamePlaceholders[p] {
+			return "", fmt.Errorf("unknown placeholder %s in download filename template %q", p, s)
+		}
+	}
+	if strings.ContainsAny(downloadNamePlaceholder.ReplaceAllString(s, ""), "{}") {
+		return "", fmt.Errorf("unbalanced braces in download filename template %q", s)
+	}
+	if !strings.Contains(s, "{original}") && !strings.Contains(s, "{name}") {
+		return "", fmt.Errorf("download filename template %q must include {original} or {name}", s)
+	}
+	return DownloadNameTemplate(s), nil
+}
+
+// DownloadNameVars are the values a template is expanded with.
+type DownloadNameVars struct {
+	Original   string
+	Folder     string
+	UploadedAt time.Time
+}
+
+// Expand fills in the template and sanitizes the result for use as a download filename.
+// A name that sanitizes to nothing falls back to the sanitized original name.
+func (t DownloadNameTemplate) Expand(vars DownloadNameVars) string {
+	tmpl := string(t)
+	if tmpl == "" {
+		tmpl = string(DefaultDownloadNameTemplate)
+	}
+	ext := path.Ext(vars.Original)
+	date := ""
+	if !vars.UploadedAt.IsZero() {
+		date = vars.UploadedAt.UTC().Format("2006-01-02")
+	}
+	values := []string{
+		"{original}", vars.Original,
+		"{name}", strings.TrimSuffix(vars.Original, ext),
+		"{ext}", ext,
+		"{date}", date,
+		"{folder}", vars.Folder,
+	}
+	for i := 0; i < len(values); i += 2 {
+		if values[i+1] == "" {
+			tmpl = dropPlaceholder(tmpl, values[i])
+		}
+	}
+	expanded := strings.NewReplacer(values...).Replace(tmpl)
+
+	if name := sanitizeDownloadName(expanded); name != "" {
+		return name
+	}
+	if name := sanitizeDownloadName(vars.Original); name != "" {
+		return name
+	}
+	return "download"
+}
+
+// dropPlaceholder removes an empty placeholder together with the separators joining it to
+// the rest of the name, so "{folder} - {original}" at the root becomes just "{original}".
+func dropPlaceholder(tmpl, placeholder string) string {
+	p := regexp.QuoteMeta(placeholder)
+	tmpl = regexp.MustCompile(`[ _-]*`+p+`\s*$`).ReplaceAllString(tmpl, "")
+	return regexp.MustCompile(p+`[ _-]*`).ReplaceAllString(tmpl, "")
+}
+
+// sanitizeDownloadName makes a name safe for a content-disposition filename: path
+// separators become "_", quotes and control characters are dropped, and runs of
+// whitespace collapse. Overlong names are cut, keeping the extension.
+func sanitizeDownloadName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case r == '/' || r == '\\':
+			r = '_'
+		case r == '"' || unicode.IsControl(r):
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	out := b.String()
+	if len(out) > maxDownloadNameLen {
+		out = truncateDownloadName(out, maxDownloadNameLen)
+	}
+	if out == "." || out == ".." {
+		return ""
+	}
+	return out
+}
+
+// truncateDownloadName shortens name to at most n bytes on a rune boundary, keeping the
+// extension when it is short enough to matter.
+func truncateDownloadName(name string, n int) string {
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	limit := n - len(ext)
+	for len(base) > limit {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	return strings.TrimSpace(base) + ext
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDownloadNameTemplate(t *testing.T) {
+	for _, s := range []string{"", "  ", "{original}", "{folder} - {original}", "{date}_{name}{ext}"} {
+		if _, err := ParseDownloadNameTemplate(s); err != nil {
+			t.Fatalf("expected %q to be accepted, got %v", s, err)
+		}
+	}
+	if tmpl, _ := ParseDownloadNameTemplate(""); tmpl != DefaultDownloadNameTemplate {
+		t.Fatalf("expected empty template to default to {original}, got %q", tmpl)
+	}
+	for _, s := range []string{"{owner}-{original}", "{original", "original}", "{date}", "{folder}/{ext}"} {
+		if _, err := ParseDownloadNameTemplate(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestDownloadNameTemplate_Expand(t *testing.T) {
+	uploaded := time.Date(2024, 3, 9, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600))
+	vars := DownloadNameVars{Original: "report.pdf", Folder: "Invoices", UploadedAt: uploaded}
+	cases := []struct {
+		tmpl DownloadNameTemplate
+		vars DownloadNameVars
+		want string
+	}{
+		{"", vars, "report.pdf"},
+		{"{original}", vars, "report.pdf"},
+		{"{folder} - {original}", vars, "Invoices - report.pdf"},
+		{"{date}_{name}{ext}", vars, "2024-03-10_report.pdf"},
+		{"{name} ({folder}){ext}", vars, "report (Invoices).pdf"},
+		// Empty placeholders take their separators with them
+		{"{folder} - {original}", DownloadNameVars{Original: "report.pdf"}, "report.pdf"},
+		{"{original} - {folder}", DownloadNameVars{Original: "report.pdf"}, "report.pdf"},
+		{"{date}_{name}{ext}", DownloadNameVars{Original: "README"}, "README"},
+	}
+	for _, c := range cases {
+		if got := c.tmpl.Expand(c.vars); got != c.want {
+			t.Fatalf("%q: expected %q, got %q", c.tmpl, c.want, got)
+		}
+	}
+}
+
+func TestDownloadNameTemplate_Sanitizes(t *testing.T) {
+	tmpl := DownloadNameTemplate("{folder} - {original}")
+	cases := []struct {
+		vars DownloadNameVars
+		want string
+	}{
+		{DownloadNameVars{Original: "a/b\\c.txt", Folder: "x/y"}, "x_y - a_b_c.txt"},
+		{DownloadNameVars{Original: "say \"hi\".txt"}, "say hi.txt"},
+		{DownloadNameVars{Original: "evil\r\nSet-Cookie: x.txt"}, "evilSet-Cookie: x.txt"},
+		{DownloadNameVars{Original: "  lots \t of   space .txt "}, "lots of space .txt"},
+		{DownloadNameVars{Original: ".env"}, ".env"},
+		// Nothing usable left falls back to a generic name
+		{DownloadNameVars{Original: "\"\""}, "download"},
+		{DownloadNameVars{Original: ".."}, "download"},
+	}
+	for _, c := range cases {
+		if got := tmpl.Expand(c.vars); got != c.want {
+			t.Fatalf("%+v: expected %q, got %q", c.vars, c.want, got)
+		}
+	}
+}
+
+func TestDownloadNameTemplate_TruncatesKeepingExtension(t *testing.T) {
+	got := DownloadNameTemplate("{folder} - {original}").Expand(DownloadNameVars{
+		Original: "report.pdf",
+		Folder:   strings.Repeat("é", 200),
+	})
+	if len(got) > maxDownloadNameLen || !strings.HasSuffix(got, ".pdf") {
+		t.Fatalf("expected a name of at most %d bytes ending in .pdf, got %d bytes: %q", maxDownloadNameLen, len(got), got)
+	}
+	if !strings.HasPrefix(got, "é") || strings.ContainsRune(got, '�') {
+		t.Fatalf("expected truncation on a rune boundary, got %q", got)
+	}
+}
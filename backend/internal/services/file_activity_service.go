@@ -12,6 +12,10 @@ import (
 type FileActivityService struct {
 	FileActivityRepo repository.FileActivityRepository
 	FileRepo         repository.FileRepository
+	// ShareRepo lets share recipients track activity on files shared with them (optional)
+	ShareRepo repository.ShareRepository
+	// UserRepo resolves the user's email for shares made to it before they signed up (optional)
+	UserRepo repository.UserRepository
 }
 
 func NewFileActivityService(fileActivityRepo repository.FileActivityRepository, fileRepo repository.FileRepository) *FileActivityService {
@@ -31,13 +35,19 @@ func (s *FileActivityService) TrackFileActivity(ctx context.Context, userID, fil
 		return fmt.Errorf("invalid activity type: %s", activityType)
 	}
 
-	// Check if file exists and user has access to it
+	// Check if file exists and user has access to it, as its owner or through a share
 	userFile, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID)
 	if err != nil {
 		return fmt.Errorf("user does not have access to file: %w", err)
 	}
 	if userFile == nil {
-		return fmt.Errorf("file not found or user does not have access")
+		shared, err := s.hasSharedAccess(ctx, userID, fileID)
+		if err != nil {
+			return err
+		}
+		if !shared {
+			return fmt.Errorf("file not found or user does not have access")
+		}
 	}
 
 	// Track the activity
@@ -46,9 +56,34 @@ func (s *FileActivityService) TrackFileActivity(ctx context.Context, userID, fil
 		return fmt.Errorf("failed to track file activity: %w", err)
 	}
 
+	// Only the user's own copy has a last access to stamp
+	if userFile != nil {
+		if err := s.FileRepo.TouchUserFileAccess(ctx, userID, fileID); err != nil {
+			return fmt.Errorf("failed to update last access: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// hasSharedAccess reports whether fileID is shared with userID, directly or through a folder.
+func (s *FileActivityService) hasSharedAccess(ctx context.Context, userID, fileID uuid.UUID) (bool, error) {
+	if s.ShareRepo == nil {
+		return false, nil
+	}
+	var email string
+	if s.UserRepo != nil {
+		if e, err := s.UserRepo.GetUserEmailByID(ctx, userID.String()); err == nil {
+			email = e
+		}
+	}
+	has, _, err := s.ShareRepo.HasFileAccess(ctx, userID, email, fileID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file access: %w", err)
+	}
+	return has, nil
+}
+
 func (s *FileActivityService) GetRecentFileActivities(ctx context.Context, userID uuid.UUID, limit int) ([]models.RecentFileActivity, error) {
 	if s.FileActivityRepo == nil {
 		return nil, fmt.Errorf("file activity repository not configured")
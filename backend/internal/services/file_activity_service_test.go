@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFileActivityService_TrackFileActivity_Access(t *testing.T) {
+	ctx := context.Background()
+	owner, viewer, stranger, fileID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	activity := &stubActivityRepo{}
+	svc := NewFileActivityService(activity, files)
+
+	// The owner is found through their own mapping
+	if err := svc.TrackFileActivity(ctx, owner, fileID, "preview"); err != nil {
+		t.Fatalf("owner: %v", err)
+	}
+	if len(activity.tracked[owner]) != 1 || len(files.touched) != 1 {
+		t.Fatalf("expected the owner's preview tracked and stamped, got %v and %v", activity.tracked[owner], files.touched)
+	}
+
+	// Users without a mapping need a share
+	files.unmapped = map[uuid.UUID]bool{fileID: true}
+	svc.ShareRepo = &stubShareRepo{notOwner: true}
+	if err := svc.TrackFileActivity(ctx, viewer, fileID, "download"); err != nil {
+		t.Fatalf("shared viewer: %v", err)
+	}
+	if len(activity.tracked[viewer]) != 1 || len(files.touched) != 1 {
+		t.Fatalf("expected the viewer's download tracked without stamping a mapping, got %v and %v", activity.tracked[viewer], files.touched)
+	}
+
+	svc.ShareRepo = &stubShareRepo{noAccess: true}
+	if err := svc.TrackFileActivity(ctx, stranger, fileID, "preview"); err == nil {
+		t.Fatalf("expected a user without access to be rejected")
+	}
+	if len(activity.tracked[stranger]) != 0 {
+		t.Fatalf("expected nothing tracked for a user without access, got %v", activity.tracked[stranger])
+	}
+}
@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// CryptoProvider encrypts file content before it is written to object storage and
+// decrypts it when it is read back. Content is encrypted as a whole and independently of
+// who uploads it, so deduplication by plaintext hash keeps working.
+type CryptoProvider interface {
+	// Encrypt returns the ciphertext of plaintext under the current key, along with the
+	// key ID and the fresh per-file nonce that must be stored with the file to decrypt it
+	Encrypt(plaintext io.Reader) (ciphertext io.Reader, keyID string, nonce []byte, err error)
+	// Decrypt returns the plaintext of content encrypted under keyID with nonce. Reads fail
+	// when the ciphertext was modified or cut short
+	Decrypt(keyID string, nonce []byte, ciphertext io.Reader) (io.Reader, error)
+	// CiphertextSize is how many bytes plainSize bytes of content take once encrypted
+	CiphertextSize(plainSize int64) int64
+	// CurrentKeyID names the key new content is encrypted with
+	CurrentKeyID() string
+}
+
+// ErrEncryptionUnavailable is returned when encrypted content is read without the key it
+// was encrypted with configured.
+var ErrEncryptionUnavailable = errors.New("encryption key unavailable")
+
+const (
+	// encryptionSegmentSize is how much plaintext each GCM seal covers, so content is
+	// encrypted and decrypted as a stream instead of being held in memory
+	encryptionSegmentSize = 64 << 10
+	// encryptionNonceSize is the size of the random per-file nonce the file key is derived with
+	encryptionNonceSize = 32
+	// fileKeyInfo separates file keys from other keys derived from the same master key
+	fileKeyInfo = "safevault file content v1"
+)
+
+// AESGCMProvider encrypts content with AES-256-GCM. Every file gets its own key, derived
+// with HKDF-SHA256 from a master key and the file's random nonce. The content is sealed
+// in segments of encryptionSegmentSize, each under a nonce holding its position and
+// whether it is the last, so segments can't be reordered, dropped or truncated unnoticed.
+type AESGCMProvider struct {
+	keys    map[string][]byte
+	current string
+}
+
+// NewAESGCMProvider returns a provider encrypting with keys[current]. The other keys are
+// kept to decrypt content written before a key rotation.
+func NewAESGCMProvider(keys map[string][]byte, current string) (*AESGCMProvider, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no encryption keys")
+	}
+	if current == "" && len(keys) == 1 {
+		for id := range keys {
+			current = id
+		}
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current encryption key %q is not among the configured keys", current)
+	}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+		}
+	}
+	return &AESGCMProvider{keys: keys, current: current}, nil
+}
+
+// ParseEncryptionKeys parses master keys from configuration, given as comma-separated
+// "<id>:<base64 key>" pairs, e.g. "2024:q83v...,2025:Zm9v...".
+func ParseEncryptionKeys(s string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("encryption key entries must be <id>:<base64 key>")
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("encryption key %q is listed twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// CurrentKeyID names the key new content is encrypted with.
+func (p *AESGCMProvider) CurrentKeyID() string {
+	return p.current
+}
+
+// SubKey derives a key for another purpose, e.g. signing URLs, from the current master key.
+func (p *AESGCMProvider) SubKey(purpose string) []byte {
+	return deriveSubKey(p.keys[p.current], purpose)
+}
+
+// SubKeys derives the key for purpose from every master key, the current one's first, so
+// what was signed before the current key changed can still be checked.
+func (p *AESGCMProvider) SubKeys(purpose string) [][]byte {
+	keys := [][]byte{p.SubKey(purpose)}
+	for id, master := range p.keys {
+		if id != p.current {
+			keys = append(keys, deriveSubKey(master, purpose))
+		}
+	}
+	return keys
+}
+
+func deriveSubKey(master []byte, purpose string) []byte {
+	key, err := hkdf.Key(sha256.New, master, nil, "safevault "+purpose, 32)
+	if err != nil {
+		// Only possible for lengths HKDF-SHA256 can't produce
+		panic(err)
+	}
+	return key
+}
+
+// fileAEAD returns the GCM cipher of the file key derived for nonce under master key keyID.
+func (p *AESGCMProvider) fileAEAD(keyID string, nonce []byte) (cipher.AEAD, error) {
+	master, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionUnavailable, keyID)
+	}
+	if len(nonce) != encryptionNonceSize {
+		return nil, fmt.Errorf("invalid encryption nonce")
+	}
+	key, err := hkdf.Key(sha256.New, master, nonce, fileKeyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *AESGCMProvider) Encrypt(plaintext io.Reader) (io.Reader, string, []byte, error) {
+	nonce := make([]byte, encryptionNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", nil, err
+	}
+	aead, err := p.fileAEAD(p.current, nonce)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return &segmentReader{aead: aead, src: plaintext, size: encryptionSegmentSize, seal: true}, p.current, nonce, nil
+}
+
+func (p *AESGCMProvider) Decrypt(keyID string, nonce []byte, ciphertext io.Reader) (io.Reader, error) {
+	aead, err := p.fileAEAD(keyID, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentReader{aead: aead, src: ciphertext, size: encryptionSegmentSize + aead.Overhead()}, nil
+}
+
+func (p *AESGCMProvider) CiphertextSize(plainSize int64) int64 {
+	segments := max((plainSize+encryptionSegmentSize-1)/encryptionSegmentSize, 1)
+	return plainSize + segments*16
+}
+
+// segmentNonce is the GCM nonce of segment index; the first byte marks the last segment.
+func segmentNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	if last {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], index)
+	return nonce
+}
+
+// errTruncated is returned when encrypted content ends before its last segment
+var errTruncated = errors.New("encrypted content is truncated")
+
+// segmentReader seals (or opens) src in segments of size bytes. It reads one byte past a
+// segment before processing it, so it knows whether the segment is the last one.
+type segmentReader struct {
+	aead cipher.AEAD
+	src  io.Reader
+	size int
+	seal bool
+
+	pending []byte // read from src, not yet processed
+	out     []byte // processed, not yet returned
+	index   uint64
+	done    bool
+	err     error
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// next processes the next segment into out.
+func (r *segmentReader) next() error {
+	eof := false
+	for len(r.pending) <= r.size {
+		buf := make([]byte, r.size+1-len(r.pending))
+		n, err := io.ReadFull(r.src, buf)
+		r.pending = append(r.pending, buf[:n]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	last := eof && len(r.pending) <= r.size
+	n := min(len(r.pending), r.size)
+	segment := r.pending[:n]
+	nonce := segmentNonce(r.index, last)
+	if r.seal {
+		r.out = r.aead.Seal(nil, nonce, segment, nil)
+	} else {
+		if last && n == 0 && r.index > 0 {
+			return errTruncated
+		}
+		plain, err := r.aead.Open(nil, nonce, segment, nil)
+		if err != nil {
+			if last {
+				// A segment that doesn't open as the last one may be a full segment whose
+				// successors were cut off
+				if _, ferr := r.aead.Open(nil, segmentNonce(r.index, false), segment, nil); ferr == nil {
+					return errTruncated
+				}
+			}
+			return fmt.Errorf("encrypted content failed authentication: %w", err)
+		}
+		r.out = plain
+	}
+	r.pending = r.pending[n:]
+	r.index++
+	r.done = last
+	return nil
+}
+
+// proxyDownloadTTL is how long the download URL of an encrypted file stays valid, like a
+// presigned one
+const proxyDownloadTTL = 10 * time.Minute
+
+// ErrDownloadLinkInvalid is returned for proxied download URLs that were tampered with or
+// have expired.
+var ErrDownloadLinkInvalid = errors.New("download link is invalid or has expired")
+
+// fileEncryption returns the key ID and nonce the file's object is encrypted with; an
+// empty key ID means plaintext. Files loaded with a user's mapping don't carry them, so
+// they are looked up when missing.
+func (s *FileService) fileEncryption(ctx context.Context, f *models.File) (string, []byte, error) {
+	if s.Crypto == nil || f.EncryptionKeyID != "" {
+		return f.EncryptionKeyID, f.EncryptionNonce, nil
+	}
+	stored, err := s.FileRepo.GetByID(ctx, f.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	return stored.EncryptionKeyID, stored.EncryptionNonce, nil
+}
+
+// decryptingReader returns the plaintext of an encrypted object; closing it closes the object.
+type decryptingReader struct {
+	io.Reader
+	io.Closer
+}
+
+// proxyDownloadURL returns the URL this server serves an encrypted file at until now plus
+// proxyDownloadTTL. It is signed like a CDN URL, with the hex HMAC-SHA256 over
+// "<path>\n<expires>\n<disposition>", so it works without the bearer token.
+func (s *FileService) proxyDownloadURL(fileID uuid.UUID, disposition string, now time.Time) string {
+	path := "/download/file/" + fileID.String()
+	expires := strconv.FormatInt(now.Add(proxyDownloadTTL).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("disposition", disposition)
+	q.Set("signature", hex.EncodeToString(s.downloadSignature(path, expires, disposition)))
+	return strings.TrimRight(s.DownloadBaseURL, "/") + path + "?" + q.Encode()
+}
+
+func (s *FileService) downloadSignature(path, expires, disposition string) []byte {
+	return signDownload(s.DownloadSigningKey, path, expires, disposition)
+}
+
+func signDownload(key []byte, path, expires, disposition string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path + "\n" + expires + "\n" + disposition))
+	return mac.Sum(nil)
+}
+
+// validDownloadSignature checks sig against the signing key and DownloadVerifyKeys.
+func (s *FileService) validDownloadSignature(sig []byte, path, expires, disposition string) bool {
+	for _, key := range append([][]byte{s.DownloadSigningKey}, s.DownloadVerifyKeys...) {
+		if hmac.Equal(sig, signDownload(key, path, expires, disposition)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxiedDownload is a decrypted file served through this server.
+type ProxiedDownload struct {
+	Content     io.ReadCloser
+	Size        int64
+	MimeType    string
+	Disposition string
+}
+
+// OpenSignedDownload checks a URL from proxyDownloadURL and opens the decrypted content it
+// grants. The caller closes Content.
+func (s *FileService) OpenSignedDownload(ctx context.Context, fileID uuid.UUID, expires, disposition, signature string, now time.Time) (*ProxiedDownload, error) {
+	if s == nil || s.FileRepo == nil || len(s.DownloadSigningKey) == 0 {
+		return nil, ErrStorageUnavailable
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, ErrDownloadLinkInvalid
+	}
+	if !s.validDownloadSignature(sig, "/download/file/"+fileID.String(), expires, disposition) {
+		return nil, ErrDownloadLinkInvalid
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > exp {
+		return nil, ErrDownloadLinkInvalid
+	}
+	f, err := s.FileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	// Content quarantined after the link was handed out isn't served anymore
+	if f.Status == models.FileStatusQuarantined {
+		return nil, ErrFileQuarantined
+	}
+	content, err := s.openObject(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxiedDownload{Content: content, Size: f.Size, MimeType: f.MimeType, Disposition: disposition}, nil
+}
+
+// RotateFileKey re-encrypts the file's content under the current key. The new object is
+// written next to the old one and the row switched over before the old object is removed,
+// so reads never see a missing object; the hash, and so deduplication, doesn't change.
+// Plaintext content gets encrypted. Reports whether the file was re-encrypted; false when
+// it already was under the current key or was removed meanwhile.
+func (s *FileService) RotateFileKey(ctx context.Context, fileID uuid.UUID) (bool, error) {
+	if s == nil || s.FileRepo == nil || s.Crypto == nil {
+		return false, ErrEncryptionUnavailable
+	}
+	rotated := false
+	err := s.withFileLock(ctx, fileID, func(ctx context.Context) error {
+		f, err := s.FileRepo.GetByID(ctx, fileID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f.EncryptionKeyID == s.Crypto.CurrentKeyID() {
+			return nil
+		}
+		plain, err := s.openObject(ctx, f)
+		if err != nil {
+			return err
+		}
+		defer plain.Close()
+		ciphertext, keyID, nonce, err := s.Crypto.Encrypt(plain)
+		if err != nil {
+			return err
+		}
+		// The key ID keeps the new object apart from the one it replaces
+		key := s.StorageLayout.ObjectKey(f.Hash) + "." + keyID
+		if err := s.putObject(ctx, key, ciphertext, s.Crypto.CiphertextSize(f.Size), "application/octet-stream"); err != nil {
+			return fmt.Errorf("re-encrypt file %s: %w", fileID, err)
+		}
+		ok, err := s.FileRepo.ReplaceFileObject(ctx, fileID, f.StoragePath, key, keyID, nonce)
+		if err != nil || !ok {
+			if rerr := s.removeObject(ctx, key); rerr != nil {
+				log.Printf("warning: failed to remove re-encrypted copy %s of file %s: %v", key, fileID, rerr)
+			}
+			return err
+		}
+		rotated = true
+		for _, old := range objectKeyCandidates(f) {
+			if err := s.removeObject(ctx, old); err != nil {
+				log.Printf("warning: failed to remove the old object %s of file %s: %v", old, fileID, err)
+			}
+		}
+		// Plaintext content may still be cached at the edge
+		s.purgeCDN(ctx, f)
+		return nil
+	})
+	return rotated, err
+}
+
+// RotateEncryptionKeys re-encrypts up to limit files not yet under the current key and
+// returns how many were. Run it again until it returns 0 to finish a rotation.
+func (s *FileService) RotateEncryptionKeys(ctx context.Context, limit int) (int, error) {
+	if s == nil || s.FileRepo == nil || s.Crypto == nil {
+		return 0, ErrEncryptionUnavailable
+	}
+	if limit <= 0 {
+		return 0, fmt.Errorf("limit must be positive")
+	}
+	files, err := s.FileRepo.ListFilesNotUnderKey(ctx, s.Crypto.CurrentKeyID(), limit)
+	if err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for _, f := range files {
+		ok, err := s.RotateFileKey(ctx, f.ID)
+		if err != nil {
+			return rotated, err
+		}
+		if ok {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
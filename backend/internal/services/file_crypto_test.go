@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+func testProvider(t *testing.T, current string, ids ...string) *AESGCMProvider {
+	t.Helper()
+	keys := map[string][]byte{}
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+	p, err := NewAESGCMProvider(keys, current)
+	if err != nil {
+		t.Fatalf("provider: %v", err)
+	}
+	return p
+}
+
+func encryptAll(t *testing.T, p CryptoProvider, plain []byte) ([]byte, string, []byte) {
+	t.Helper()
+	r, keyID, nonce, err := p.Encrypt(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	return ciphertext, keyID, nonce
+}
+
+func decryptAll(p CryptoProvider, keyID string, nonce, ciphertext []byte) ([]byte, error) {
+	r, err := p.Decrypt(keyID, nonce, bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestAESGCMProvider_RoundTrip(t *testing.T) {
+	p := testProvider(t, "", "a")
+	for _, size := range []int{0, 10, encryptionSegmentSize, 2*encryptionSegmentSize + 5} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		ciphertext, keyID, nonce := encryptAll(t, p, plain)
+		if keyID != "a" || int64(len(ciphertext)) != p.CiphertextSize(int64(size)) {
+			t.Fatalf("size %d: got key %q and %d bytes of ciphertext, want %d", size, keyID, len(ciphertext), p.CiphertextSize(int64(size)))
+		}
+		if size > 0 && bytes.Contains(ciphertext, plain) {
+			t.Fatalf("size %d: ciphertext contains the plaintext", size)
+		}
+		got, err := decryptAll(p, keyID, nonce, ciphertext)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: round trip failed (%v)", size, err)
+		}
+	}
+}
+
+func TestAESGCMProvider_DetectsTampering(t *testing.T) {
+	p := testProvider(t, "", "a")
+	plain := bytes.Repeat([]byte("x"), 2*encryptionSegmentSize+5)
+	ciphertext, keyID, nonce := encryptAll(t, p, plain)
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[100] ^= 1
+	if _, err := decryptAll(p, keyID, nonce, flipped); err == nil {
+		t.Fatalf("expected modified ciphertext to fail")
+	}
+	// Dropping whole segments from the end is caught too
+	sealed := encryptionSegmentSize + 16
+	for _, cut := range []int{sealed, 2 * sealed} {
+		if _, err := decryptAll(p, keyID, nonce, ciphertext[:cut]); !errors.Is(err, errTruncated) {
+			t.Fatalf("expected content cut after %d bytes reported truncated, got %v", cut, err)
+		}
+	}
+	if _, err := decryptAll(p, keyID, bytes.Repeat([]byte{1}, encryptionNonceSize), ciphertext); err == nil {
+		t.Fatalf("expected the wrong nonce to fail")
+	}
+	if _, err := decryptAll(p, "b", nonce, ciphertext); !errors.Is(err, ErrEncryptionUnavailable) {
+		t.Fatalf("expected an unknown key reported, got %v", err)
+	}
+}
+
+func TestParseEncryptionKeys(t *testing.T) {
+	keys, err := ParseEncryptionKeys(" old:" + strings.Repeat("A", 43) + "=, new:" + strings.Repeat("B", 43) + "=")
+	if err != nil || len(keys) != 2 || len(keys["old"]) != 32 || len(keys["new"]) != 32 {
+		t.Fatalf("unexpected keys %v (%v)", keys, err)
+	}
+	if _, err := NewAESGCMProvider(keys, ""); err == nil {
+		t.Fatalf("expected the current key required with several keys")
+	}
+	for _, bad := range []string{"nokey", "a:!!!", "a:" + strings.Repeat("A", 44) + ",a:" + strings.Repeat("A", 44)} {
+		if _, err := ParseEncryptionKeys(bad); err == nil {
+			t.Fatalf("expected %q rejected", bad)
+		}
+	}
+	if _, err := NewAESGCMProvider(map[string][]byte{"short": make([]byte, 16)}, ""); err == nil {
+		t.Fatalf("expected a short key rejected")
+	}
+}
+
+// encryptedFileService stores objects in memory and encrypts them with p
+func encryptedFileService(repo *stubFileRepo, p *AESGCMProvider) (*FileService, map[string][]byte) {
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.Crypto = p
+	fs.DownloadSigningKey = p.SubKey("download urls")
+	fs.DownloadBaseURL = "https://api.example.com/"
+	stored := map[string][]byte{}
+	fs.objectWriter = func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+		b, err := io.ReadAll(r)
+		if err == nil && int64(len(b)) != size {
+			err = errors.New("size mismatch")
+		}
+		stored[key] = b
+		return err
+	}
+	fs.objectReader = func(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+		b, ok := stored[f.StoragePath]
+		if !ok {
+			return nil, errors.New("no such object " + f.StoragePath)
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	fs.objectRemover = func(ctx context.Context, key string) error {
+		delete(stored, key)
+		return nil
+	}
+	return fs, stored
+}
+
+func TestFileService_EncryptedUploadAndDownload(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs, stored := encryptedFileService(repo, testProvider(t, "", "a"))
+	userID := uuid.New()
+	content := "quarterly numbers, not for the bucket admins"
+
+	files, _, err := fs.UploadFiles(ctx, userID, []*graphql.Upload{{Filename: "notes.txt", File: strings.NewReader(content)}}, "", false)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	row := repo.filesByHash[hashOf(content)]
+	if row == nil || row.EncryptionKeyID != "a" || len(row.EncryptionNonce) != encryptionNonceSize {
+		t.Fatalf("expected the file recorded as encrypted, got %+v", row)
+	}
+	if obj := stored[row.StoragePath]; obj == nil || bytes.Contains(obj, []byte(content)) {
+		t.Fatalf("expected only ciphertext in object storage")
+	}
+
+	raw, err := fs.GetFileURL(ctx, userID, files[0].FileID, false)
+	if err != nil {
+		t.Fatalf("download url: %v", err)
+	}
+	u, _ := url.Parse(raw)
+	if u.Host != "api.example.com" || u.Path != "/download/file/"+row.ID.String() {
+		t.Fatalf("expected a proxied download URL, got %s", raw)
+	}
+	q := u.Query()
+	dl, err := fs.OpenSignedDownload(ctx, row.ID, q.Get("expires"), q.Get("disposition"), q.Get("signature"), time.Now())
+	if err != nil {
+		t.Fatalf("open download: %v", err)
+	}
+	got, _ := io.ReadAll(dl.Content)
+	dl.Content.Close()
+	if string(got) != content || dl.Size != int64(len(content)) || dl.Disposition != q.Get("disposition") {
+		t.Fatalf("expected the decrypted content, got %q (%+v)", got, dl)
+	}
+
+	if _, err := fs.OpenSignedDownload(ctx, row.ID, q.Get("expires"), `inline; filename="x.html"`, q.Get("signature"), time.Now()); !errors.Is(err, ErrDownloadLinkInvalid) {
+		t.Fatalf("expected a changed disposition refused, got %v", err)
+	}
+	if _, err := fs.OpenSignedDownload(ctx, uuid.New(), q.Get("expires"), q.Get("disposition"), q.Get("signature"), time.Now()); !errors.Is(err, ErrDownloadLinkInvalid) {
+		t.Fatalf("expected the signature bound to the file, got %v", err)
+	}
+	if _, err := fs.OpenSignedDownload(ctx, row.ID, q.Get("expires"), q.Get("disposition"), q.Get("signature"), time.Now().Add(time.Hour)); !errors.Is(err, ErrDownloadLinkInvalid) {
+		t.Fatalf("expected an expired link refused, got %v", err)
+	}
+}
+
+func TestFileService_SignedDownloadSurvivesKeyChange(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs, _ := encryptedFileService(repo, testProvider(t, "old", "old", "new"))
+	userID := uuid.New()
+	content := "signed before the key changed"
+	files, _, err := fs.UploadFiles(ctx, userID, []*graphql.Upload{{Filename: "a.txt", File: strings.NewReader(content)}}, "", false)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	raw, err := fs.GetFileURL(ctx, userID, files[0].FileID, false)
+	if err != nil {
+		t.Fatalf("download url: %v", err)
+	}
+	q := func() url.Values { u, _ := url.Parse(raw); return u.Query() }()
+
+	// ENCRYPTION_KEY_ID now points at the new key, with the old one still listed
+	p := testProvider(t, "new", "old", "new")
+	fs.Crypto = p
+	fs.DownloadSigningKey = p.SubKey("download urls")
+	fs.DownloadVerifyKeys = p.SubKeys("download urls")[1:]
+	dl, err := fs.OpenSignedDownload(ctx, files[0].FileID, q.Get("expires"), q.Get("disposition"), q.Get("signature"), time.Now())
+	if err != nil {
+		t.Fatalf("expected a URL signed under the old key still served, got %v", err)
+	}
+	dl.Content.Close()
+
+	// A key that was never configured signs nothing this server accepts
+	fs.DownloadVerifyKeys = testProvider(t, "", "x").SubKeys("download urls")
+	if _, err := fs.OpenSignedDownload(ctx, files[0].FileID, q.Get("expires"), q.Get("disposition"), q.Get("signature"), time.Now()); !errors.Is(err, ErrDownloadLinkInvalid) {
+		t.Fatalf("expected the URL refused once its key is gone, got %v", err)
+	}
+}
+
+func TestFileService_RotateEncryptionKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs, stored := encryptedFileService(repo, testProvider(t, "old", "old", "new"))
+	userID := uuid.New()
+	content := strings.Repeat("rotate me ", encryptionSegmentSize/5)
+
+	if _, _, err := fs.UploadFiles(ctx, userID, []*graphql.Upload{{Filename: "a.txt", File: strings.NewReader(content)}}, "", false); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	before := *repo.filesByHash[hashOf(content)]
+
+	fs.Crypto = testProvider(t, "new", "old", "new")
+	n, err := fs.RotateEncryptionKeys(ctx, 10)
+	if err != nil || n != 1 {
+		t.Fatalf("expected one file re-encrypted, got %d (%v)", n, err)
+	}
+	after := repo.filesByHash[hashOf(content)]
+	if after.ID != before.ID || after.Hash != before.Hash {
+		t.Fatalf("expected the file's identity kept, got %+v", after)
+	}
+	if after.EncryptionKeyID != "new" || bytes.Equal(after.EncryptionNonce, before.EncryptionNonce) || after.StoragePath == before.StoragePath {
+		t.Fatalf("expected a new object under the new key, got %+v", after)
+	}
+	if _, ok := stored[before.StoragePath]; ok || len(stored) != 1 {
+		t.Fatalf("expected the old object removed, got %d objects", len(stored))
+	}
+	r, err := fs.openObject(ctx, after)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if got, err := io.ReadAll(r); err != nil || string(got) != content {
+		t.Fatalf("expected the content to decrypt under the new key (%v)", err)
+	}
+
+	// The same content uploaded again still deduplicates onto the rotated file
+	files, _, err := fs.UploadFiles(ctx, uuid.New(), []*graphql.Upload{{Filename: "b.txt", File: strings.NewReader(content)}}, "", false)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if files[0].FileID != before.ID || len(stored) != 1 {
+		t.Fatalf("expected the upload deduplicated onto %s, got %s with %d objects", before.ID, files[0].FileID, len(stored))
+	}
+	if n, err := fs.RotateEncryptionKeys(ctx, 10); err != nil || n != 0 {
+		t.Fatalf("expected nothing left to rotate, got %d (%v)", n, err)
+	}
+}
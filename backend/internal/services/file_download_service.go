@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/useradityaa/internal/middleware"
 	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
 )
@@ -15,6 +17,8 @@ type FileDownloadService struct {
 	DownloadRepo repository.FileDownloadRepository
 	FileRepo     repository.FileRepository
 	ShareRepo    repository.ShareRepository
+	// UserRepo resolves the downloader's email so shares addressed to it are honoured (optional)
+	UserRepo repository.UserRepository
 }
 
 func NewFileDownloadService(downloadRepo repository.FileDownloadRepository, fileRepo repository.FileRepository, shareRepo repository.ShareRepository) *FileDownloadService {
@@ -25,12 +29,49 @@ func NewFileDownloadService(downloadRepo repository.FileDownloadRepository, file
 	}
 }
 
-// RecordSharedFileDownload records when a user downloads a file they have access to through sharing
-func (s *FileDownloadService) RecordSharedFileDownload(ctx context.Context, fileID, ownerID, downloadedBy uuid.UUID, req *http.Request) error {
-	ipAddress := getClientIP(req)
-	userAgent := req.UserAgent()
+// RecordSharedFileDownload records when a user downloads a file they have access to through sharing.
+// When downloadedBy is nil the downloader is taken from the authenticated user in ctx. The
+// download is only recorded if that user owns the file or it is shared with them. req
+// supplies the client's IP address and user agent; without one they are left empty.
+func (s *FileDownloadService) RecordSharedFileDownload(ctx context.Context, fileID, ownerID uuid.UUID, downloadedBy *uuid.UUID, req *http.Request) error {
+	if downloadedBy == nil {
+		userIDStr, ok := middleware.GetUserIDFromContext(ctx)
+		if !ok {
+			return fmt.Errorf("unauthorized")
+		}
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			return fmt.Errorf("invalid user id in token")
+		}
+		downloadedBy = &userID
+	}
+	if s.ShareRepo == nil {
+		return fmt.Errorf("share access check not configured")
+	}
+
+	var userEmail string
+	if s.UserRepo != nil {
+		email, err := s.UserRepo.GetUserEmailByID(ctx, downloadedBy.String())
+		if err != nil {
+			return fmt.Errorf("failed to resolve downloader: %w", err)
+		}
+		userEmail = email
+	}
+	hasAccess, _, err := s.ShareRepo.HasFileAccess(ctx, *downloadedBy, userEmail, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to check file access: %w", err)
+	}
+	if !hasAccess {
+		return fmt.Errorf("access denied")
+	}
 
-	return s.DownloadRepo.RecordDownload(ctx, fileID, ownerID, &downloadedBy, "shared", "", ipAddress, userAgent)
+	var ipAddress, userAgent string
+	if req != nil {
+		ipAddress = getClientIP(req)
+		userAgent = req.UserAgent()
+	}
+
+	return s.DownloadRepo.RecordDownload(ctx, fileID, ownerID, downloadedBy, "shared", "", ipAddress, userAgent)
 }
 
 // RecordPublicFileDownload records when someone downloads a file through a public link
@@ -41,6 +82,28 @@ func (s *FileDownloadService) RecordPublicFileDownload(ctx context.Context, file
 	return s.DownloadRepo.RecordDownload(ctx, fileID, ownerID, downloadedBy, "public", shareToken, ipAddress, userAgent)
 }
 
+// RecordPublicLinkDownload records a download made through a public file or folder link.
+// The owner is looked up from the file itself; the download is attributed to the caller
+// when ctx carries an authenticated user and is recorded as anonymous otherwise.
+func (s *FileDownloadService) RecordPublicLinkDownload(ctx context.Context, fileID uuid.UUID, shareToken string) error {
+	owner, err := s.FileRepo.GetOwnerByFileID(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve file owner: %w", err)
+	}
+	if owner == nil {
+		return fmt.Errorf("file owner not found")
+	}
+
+	var downloadedBy *uuid.UUID
+	if userIDStr, ok := middleware.GetUserIDFromContext(ctx); ok {
+		if userID, err := uuid.Parse(userIDStr); err == nil {
+			downloadedBy = &userID
+		}
+	}
+
+	return s.DownloadRepo.RecordDownload(ctx, fileID, owner.UserID, downloadedBy, "public", shareToken, "", "")
+}
+
 // GetFileDownloads returns download history for a specific file (owner only)
 func (s *FileDownloadService) GetFileDownloads(ctx context.Context, userID, fileID uuid.UUID) ([]models.FileDownload, error) {
 	// Verify ownership
@@ -65,6 +128,44 @@ func (s *FileDownloadService) GetAllFileDownloadStats(ctx context.Context) ([]mo
 	return s.DownloadRepo.GetFileDownloadStats(ctx)
 }
 
+// AttachDownloadStats fills DownloadStats on each of the owner's files using a single
+// aggregate query. Files that were never downloaded get zero counts. With
+// mostDownloadedFirst the slice is reordered by total downloads, most recent download
+// breaking ties; otherwise the incoming order is kept.
+func (s *FileDownloadService) AttachDownloadStats(ctx context.Context, ownerID uuid.UUID, files []models.UserFile, mostDownloadedFirst bool) error {
+	if s == nil || s.DownloadRepo == nil {
+		return fmt.Errorf("download tracking not configured")
+	}
+	stats, err := s.DownloadRepo.GetFileDownloadStatsForUser(ctx, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to load download stats: %w", err)
+	}
+	byFile := make(map[uuid.UUID]models.FileDownloadStats, len(stats))
+	for _, st := range stats {
+		byFile[st.FileID] = st
+	}
+	for i := range files {
+		st, ok := byFile[files[i].FileID]
+		if !ok {
+			st = models.FileDownloadStats{FileID: files[i].FileID, OwnerID: ownerID}
+		}
+		files[i].DownloadStats = &st
+	}
+	if mostDownloadedFirst {
+		sort.SliceStable(files, func(i, j int) bool {
+			a, b := files[i].DownloadStats, files[j].DownloadStats
+			if a.TotalDownloads != b.TotalDownloads {
+				return a.TotalDownloads > b.TotalDownloads
+			}
+			if a.LastDownloadAt == nil || b.LastDownloadAt == nil {
+				return a.LastDownloadAt != nil
+			}
+			return a.LastDownloadAt.After(*b.LastDownloadAt)
+		})
+	}
+	return nil
+}
+
 // Helper function to extract client IP from request
 func getClientIP(req *http.Request) string {
 	// Check X-Forwarded-For header first (for proxies/load balancers)
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/models"
+)
+
+type stubDownload struct {
+	fileID, ownerID uuid.UUID
+	downloadedBy    *uuid.UUID
+	downloadType    string
+	shareToken      string
+	at              time.Time
+}
+
+// stubDownloadRepo aggregates recorded downloads the way the SQL stats query does
+type stubDownloadRepo struct {
+	downloads []stubDownload
+	// statsQueries counts GetFileDownloadStatsForUser calls
+	statsQueries int
+}
+
+func (s *stubDownloadRepo) RecordDownload(ctx context.Context, fileID, ownerID uuid.UUID, downloadedBy *uuid.UUID, downloadType, shareToken, ipAddress, userAgent string) error {
+	s.downloads = append(s.downloads, stubDownload{fileID: fileID, ownerID: ownerID, downloadedBy: downloadedBy, downloadType: downloadType, shareToken: shareToken, at: time.Now()})
+	return nil
+}
+func (s *stubDownloadRepo) GetFileDownloads(ctx context.Context, fileID uuid.UUID) ([]models.FileDownload, error) {
+	return nil, nil
+}
+func (s *stubDownloadRepo) GetOwnerSharedFileDownloads(ctx context.Context, ownerID uuid.UUID) ([]models.FileDownload, error) {
+	return nil, nil
+}
+func (s *stubDownloadRepo) GetFileDownloadStats(ctx context.Context) ([]models.FileDownloadStats, error) {
+	return nil, nil
+}
+func (s *stubDownloadRepo) GetFileDownloadStatsForUser(ctx context.Context, ownerID uuid.UUID) ([]models.FileDownloadStats, error) {
+	s.statsQueries++
+	byFile := map[uuid.UUID]*models.FileDownloadStats{}
+	var order []uuid.UUID
+	for _, d := range s.downloads {
+		if d.ownerID != ownerID {
+			continue
+		}
+		st, ok := byFile[d.fileID]
+		if !ok {
+			st = &models.FileDownloadStats{FileID: d.fileID, OwnerID: ownerID}
+			byFile[d.fileID] = st
+			order = append(order, d.fileID)
+		}
+		st.TotalDownloads++
+		switch d.downloadType {
+		case "shared":
+			st.SharedDownloads++
+		case "public":
+			st.PublicDownloads++
+		}
+		at := d.at
+		st.LastDownloadAt = &at
+	}
+	var out []models.FileDownloadStats
+	for _, id := range order {
+		out = append(out, *byFile[id])
+	}
+	return out, nil
+}
+
+func TestFileDownloadService_AttachDownloadStats_MatchesRecorded(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	quiet, popular, mid := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubDownloadRepo{}
+	for _, d := range []struct {
+		file uuid.UUID
+		kind string
+	}{
+		{popular, "direct"}, {popular, "shared"}, {popular, "public"},
+		{mid, "public"}, {mid, "public"},
+	} {
+		if err := repo.RecordDownload(ctx, d.file, owner, nil, d.kind, "", "", ""); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// Another owner's download of the same file must not leak into this listing
+	_ = repo.RecordDownload(ctx, popular, uuid.New(), nil, "direct", "", "", "")
+
+	svc := NewFileDownloadService(repo, nil, nil)
+	files := []models.UserFile{{FileID: quiet}, {FileID: popular}, {FileID: mid}}
+	if err := svc.AttachDownloadStats(ctx, owner, files, false); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if repo.statsQueries != 1 {
+		t.Fatalf("expected one aggregate query, got %d", repo.statsQueries)
+	}
+	if files[0].FileID != quiet {
+		t.Fatalf("expected listing order to be preserved")
+	}
+	if st := files[0].DownloadStats; st == nil || st.TotalDownloads != 0 || st.LastDownloadAt != nil {
+		t.Fatalf("expected zero stats for undownloaded file, got %+v", st)
+	}
+	st := files[1].DownloadStats
+	if st.TotalDownloads != 3 || st.SharedDownloads != 1 || st.PublicDownloads != 1 || st.LastDownloadAt == nil {
+		t.Fatalf("unexpected stats for popular file: %+v", st)
+	}
+	if st := files[2].DownloadStats; st.TotalDownloads != 2 || st.PublicDownloads != 2 {
+		t.Fatalf("unexpected stats for mid file: %+v", st)
+	}
+}
+
+func TestFileDownloadService_AttachDownloadStats_MostDownloadedFirst(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubDownloadRepo{}
+	for _, f := range []uuid.UUID{b, c, c, c, b} {
+		_ = repo.RecordDownload(ctx, f, owner, nil, "direct", "", "", "")
+	}
+	svc := NewFileDownloadService(repo, nil, nil)
+	files := []models.UserFile{{FileID: a}, {FileID: b}, {FileID: c}}
+	if err := svc.AttachDownloadStats(ctx, owner, files, true); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if files[0].FileID != c || files[1].FileID != b || files[2].FileID != a {
+		t.Fatalf("expected order c, b, a by download count")
+	}
+}
+
+func TestFileDownloadService_RecordPublicLinkDownload_Authenticated(t *testing.T) {
+	owner, viewer, fileID := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	files.addMapping(owner, fileID)
+	downloads := &stubDownloadRepo{}
+	svc := NewFileDownloadService(downloads, files, nil)
+
+	ctx := middleware.WithUser(context.Background(), viewer.String(), false)
+	if err := svc.RecordPublicLinkDownload(ctx, fileID, "tok"); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if len(downloads.downloads) != 1 {
+		t.Fatalf("expected one download, got %d", len(downloads.downloads))
+	}
+	d := downloads.downloads[0]
+	if d.ownerID != owner || d.downloadType != "public" || d.shareToken != "tok" {
+		t.Fatalf("unexpected download: %+v", d)
+	}
+	if d.downloadedBy == nil || *d.downloadedBy != viewer {
+		t.Fatalf("expected download attributed to %s, got %v", viewer, d.downloadedBy)
+	}
+}
+
+func TestFileDownloadService_RecordPublicLinkDownload_Anonymous(t *testing.T) {
+	owner, fileID := uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	files.addMapping(owner, fileID)
+	downloads := &stubDownloadRepo{}
+	svc := NewFileDownloadService(downloads, files, nil)
+
+	if err := svc.RecordPublicLinkDownload(context.Background(), fileID, "tok"); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if len(downloads.downloads) != 1 {
+		t.Fatalf("expected one download, got %d", len(downloads.downloads))
+	}
+	if d := downloads.downloads[0]; d.ownerID != owner || d.downloadedBy != nil {
+		t.Fatalf("expected anonymous download for owner %s, got %+v", owner, d)
+	}
+}
+
+func TestFileDownloadService_RecordPublicLinkDownload_UnknownFile(t *testing.T) {
+	downloads := &stubDownloadRepo{}
+	svc := NewFileDownloadService(downloads, &stubFileRepo{}, nil)
+	if err := svc.RecordPublicLinkDownload(context.Background(), uuid.New(), "tok"); err == nil {
+		t.Fatalf("expected error for file without owner")
+	}
+	if len(downloads.downloads) != 0 {
+		t.Fatalf("expected nothing recorded, got %d", len(downloads.downloads))
+	}
+}
+
+func TestFileDownloadService_RecordSharedFileDownload_FromContext(t *testing.T) {
+	owner, recipient, fileID := uuid.New(), uuid.New(), uuid.New()
+	downloads := &stubDownloadRepo{}
+	svc := NewFileDownloadService(downloads, &stubFileRepo{}, &stubShareRepo{notOwner: true})
+	svc.UserRepo = &stubUserRepo{}
+
+	ctx := middleware.WithUser(context.Background(), recipient.String(), false)
+	if err := svc.RecordSharedFileDownload(ctx, fileID, owner, nil, nil); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if len(downloads.downloads) != 1 {
+		t.Fatalf("expected one download, got %d", len(downloads.downloads))
+	}
+	d := downloads.downloads[0]
+	if d.downloadType != "shared" || d.downloadedBy == nil || *d.downloadedBy != recipient {
+		t.Fatalf("expected shared download attributed to %s, got %+v", recipient, d)
+	}
+}
+
+func TestFileDownloadService_RecordSharedFileDownload_Unauthorized(t *testing.T) {
+	owner, stranger, fileID := uuid.New(), uuid.New(), uuid.New()
+	downloads := &stubDownloadRepo{}
+	svc := NewFileDownloadService(downloads, &stubFileRepo{}, &stubShareRepo{noAccess: true})
+
+	if err := svc.RecordSharedFileDownload(context.Background(), fileID, owner, &stranger, nil); err == nil {
+		t.Fatalf("expected recorder without share access to be rejected")
+	}
+	if err := svc.RecordSharedFileDownload(context.Background(), fileID, owner, nil, nil); err == nil {
+		t.Fatalf("expected unauthenticated recorder to be rejected")
+	}
+	if len(downloads.downloads) != 0 {
+		t.Fatalf("expected nothing recorded, got %d", len(downloads.downloads))
+	}
+}
+
+func TestFileDownloadService_RecordSharedFileDownload_PublicFile(t *testing.T) {
+	owner, stranger, fileID := uuid.New(), uuid.New(), uuid.New()
+	downloads := &stubDownloadRepo{}
+	shares := &stubShareRepo{noAccess: true, public: map[uuid.UUID]bool{fileID: true}}
+	svc := NewFileDownloadService(downloads, &stubFileRepo{}, shares)
+
+	if err := svc.RecordSharedFileDownload(context.Background(), fileID, owner, &stranger, nil); err != nil {
+		t.Fatalf("expected a public file to be downloadable without a share, got %v", err)
+	}
+	if err := svc.RecordSharedFileDownload(context.Background(), uuid.New(), owner, &stranger, nil); err == nil {
+		t.Fatalf("expected a private file to still require a share")
+	}
+	if len(downloads.downloads) != 1 {
+		t.Fatalf("expected one download, got %d", len(downloads.downloads))
+	}
+}
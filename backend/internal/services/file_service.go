@@ -3,21 +3,24 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 	"github.com/minio/minio-go/v7"
 	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
@@ -33,8 +36,84 @@ type FileService struct {
 	Minio *minio.Client
 	// Bucket name in MinIO where files are stored
 	Bucket string
-	// PublicEndpoint is the public URL for accessing stored files
+	// PublicEndpoint is the public URL for accessing stored files; a request can pick
+	// another one with WithPublicEndpoint
 	PublicEndpoint string
+	// UploadConcurrency bounds how many files of one batch are processed at once
+	UploadConcurrency int
+	// MaxFilesPerUpload caps the number of files accepted by one UploadFiles call
+	MaxFilesPerUpload int
+	// Folders creates the target folder for GroupIntoNewFolder
+	Folders *FolderService
+	// StorageLayout picks the object key for newly stored content (flat when empty)
+	StorageLayout StorageLayout
+	// DefaultVisibility applies to uploads that don't choose a visibility (private when empty)
+	DefaultVisibility string
+	// DownloadName names files in download URLs ("{original}" when empty)
+	DownloadName DownloadNameTemplate
+	// DeleteMode is what DeleteFile does when the caller doesn't choose (trash when empty)
+	DeleteMode DeleteMode
+	// MaxFileSize rejects uploaded files over this many bytes (0 = no limit)
+	MaxFileSize int64
+	// DefaultQuotaBytes is the storage quota of users without a user_quotas override
+	// (20 MB when zero)
+	DefaultQuotaBytes int64
+	// BlockedMimeTypes lists types uploads may not have; "type/*" blocks a whole top-level type
+	BlockedMimeTypes []string
+	// RejectEmptyFiles refuses zero-byte uploads instead of storing them
+	RejectEmptyFiles bool
+	// Scanner checks content before it is added to a user's storage (optional)
+	Scanner ContentScanner
+	// ScanTimeout bounds how long Scanner may take over one file; uploads whose scan runs
+	// longer are rejected (1 minute when zero)
+	ScanTimeout time.Duration
+	// QuarantineFlagged stores flagged uploads as quarantined instead of rejecting them
+	QuarantineFlagged bool
+	// Spool holds uploads on disk while they are hashed and checked (nil uses the system
+	// temp directory without a size cap)
+	Spool *UploadSpool
+	// Locks serializes attaching and releasing content across server processes (optional;
+	// without it only uploads within one batch are serialized)
+	Locks repository.FileLocker
+	// Orgs caps members of an organization by its shared quota as well as their own
+	// (optional; without it only personal quotas apply)
+	Orgs repository.OrganizationRepository
+	// CDN serves download URLs from an edge cache instead of presigned MinIO URLs
+	// (optional)
+	CDN *CDN
+	// Shares and Users let share recipients with editor access upload into a shared folder
+	// and trash the files they added there (optional; without them only owners can)
+	Shares repository.ShareRepository
+	Users  repository.UserRepository
+	// Crypto encrypts content before it is stored (optional; without it content is stored
+	// as uploaded, and encrypted content can't be read). Encrypted files are downloaded
+	// through this server, since presigned and CDN URLs would serve the ciphertext
+	Crypto CryptoProvider
+	// DownloadSigningKey signs the download URLs of encrypted files
+	DownloadSigningKey []byte
+	// DownloadVerifyKeys are also accepted on download URLs, so those signed under an
+	// earlier current encryption key keep working until they expire
+	DownloadVerifyKeys [][]byte
+	// DownloadBaseURL is where this server is reached, prefixed to the download URLs of
+	// encrypted files (relative URLs when empty)
+	DownloadBaseURL string
+	// FailureLog records files uploads failed to store, for support (optional)
+	FailureLog repository.UploadFailureRepository
+	// UploadSessions stores resumable upload sessions (optional; without it chunked
+	// uploads are unavailable)
+	UploadSessions repository.UploadSessionRepository
+	// UploadSessionTTL is how long an upload session stays open before it is abandoned
+	// (24 hours when zero)
+	UploadSessionTTL time.Duration
+
+	// objectWriter replaces object storage writes in tests
+	objectWriter func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// objectReader replaces object storage reads in tests
+	objectReader func(ctx context.Context, f *models.File) (io.ReadCloser, error)
+	// objectRemover replaces object storage deletes in tests
+	objectRemover func(ctx context.Context, key string) error
+	// multipart replaces the object storage upload sessions assemble chunks in, in tests
+	multipart multipartStore
 }
 
 // NewFileService creates a new FileService instance with the provided dependencies.
@@ -49,160 +128,593 @@ type FileService struct {
 //   - *FileService: Configured file service instance
 func NewFileService(repo repository.FileRepository, minioClient *minio.Client, bucket string, publicEndpoint string) *FileService {
 	return &FileService{
-		FileRepo:       repo,
-		Minio:          minioClient,
-		Bucket:         bucket,
-		PublicEndpoint: publicEndpoint,
+		FileRepo:          repo,
+		Minio:             minioClient,
+		Bucket:            bucket,
+		PublicEndpoint:    publicEndpoint,
+		MaxFilesPerUpload: defaultMaxFilesPerUpload,
+		UploadConcurrency: defaultUploadConcurrency,
 	}
 }
 
-// perUserQuotaBytes defines the storage quota per user (20 MB)
-const perUserQuotaBytes int64 = 20 * 1024 * 1024 // 20 MB
+// defaultQuotaBytes is the per-user storage quota used when none is configured (20 MB)
+const defaultQuotaBytes int64 = 20 * 1024 * 1024 // 20 MB
+
+// defaultMaxFilesPerUpload is the per-request file limit used when none is configured
+const defaultMaxFilesPerUpload = 100
+
+// defaultUploadConcurrency is how many files of a batch are processed in parallel by default
+const defaultUploadConcurrency = 4
+
+// emptyFileMimeType is the type of the shared empty-content row, what sniffing zero bytes
+// has always produced
+const emptyFileMimeType = "text/plain"
+
+// UploadFailure describes one file that could not be stored during a best-effort upload.
+type UploadFailure struct {
+	// Index is the file's position in the uploads slice
+	Index int
+	// Filename is the client-supplied name of the file
+	Filename string
+	// Err is the reason the file was rejected; see Reason for validation rejections
+	Err error
+}
+
+// ErrStorageUnavailable is returned by file operations when object storage isn't configured,
+// e.g. when running without MinIO. Features that don't touch file content keep working.
+var ErrStorageUnavailable = errors.New("file storage unavailable")
+
+// ErrQuotaExceeded is wrapped by upload errors for files that don't fit the user's remaining quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrFolderQuotaExceeded is wrapped by upload errors for files that don't fit a folder
+// quota of the target folder. It wraps ErrQuotaExceeded, so such files are rejected as
+// over quota.
+var ErrFolderQuotaExceeded = fmt.Errorf("folder %w", ErrQuotaExceeded)
 
 // UploadFiles handles the upload of multiple files for a user.
 // It enforces user quotas, deduplicates files by hash, and stores them in MinIO.
-// Files are processed sequentially to maintain data consistency.
+// Files are processed by up to UploadConcurrency workers; quota is reserved under a lock
+// and files with identical content are serialized so deduplication stays correct.
+//
+// With bestEffort false the batch stops at the first failing file and only the error is
+// returned. With bestEffort true failing files are collected as UploadFailures and the
+// remaining files are still stored.
+//
+// Every stored file gets the given visibility, or DefaultVisibility when it is empty. The
+// visibility is set on the user's mappings of the content, so re-uploading content the user
+// already has changes the visibility of their existing copies too.
 //
 // Parameters:
 //   - ctx: Context for cancellation and deadlines
 //   - userID: UUID of the user uploading files
 //   - uploads: Slice of GraphQL Upload objects containing file data
+//   - visibility: "private", "shared" or "public"; empty uses DefaultVisibility
+//   - bestEffort: Whether to continue past per-file failures
+//
+// Same-name files are allowed; UploadFilesOrdered takes a NameConflict policy.
 //
 // Returns:
 //   - []models.UserFile: List of created user-file associations
+//   - []UploadFailure: Files that were skipped (always empty unless bestEffort)
 //   - error: nil on success, or an error describing what went wrong
-func (s *FileService) UploadFiles(ctx context.Context, userID uuid.UUID, uploads []*graphql.Upload) ([]models.UserFile, error) {
-	if s == nil || s.Minio == nil || s.Bucket == "" {
-		return nil, fmt.Errorf("file storage not configured")
+func (s *FileService) UploadFiles(ctx context.Context, userID uuid.UUID, uploads []*graphql.Upload, visibility string, bestEffort bool) ([]models.UserFile, []UploadFailure, error) {
+	return s.UploadFilesOrdered(ctx, userID, uploads, visibility, bestEffort, UploadOrder{}, NameConflictAllow)
+}
+
+// UploadFilesOrdered is UploadFiles with control over which files claim quota first.
+// With an order set, files still read and hash in parallel but reserve quota strictly in
+// that order, so when the batch runs out of space exactly the files at the end of the
+// order fail, each with an error wrapping ErrQuotaExceeded. Results and failures keep
+// referring to the files' positions in uploads. onConflict decides what happens to files
+// whose name is already taken in the target folder by different content.
+func (s *FileService) UploadFilesOrdered(ctx context.Context, userID uuid.UUID, uploads []*graphql.Upload, visibility string, bestEffort bool, order UploadOrder, onConflict NameConflict) ([]models.UserFile, []UploadFailure, error) {
+	return s.uploadFiles(ctx, userID, nil, uploads, visibility, bestEffort, order, onConflict, false)
+}
+
+// UploadFilesToFolder is UploadFilesOrdered placing the new mappings in folderID (the root
+// when nil): one of the user's folders, or one shared with them as editor. Files an editor
+// uploads become the folder owner's copies, counted against the owner's quota, so everyone
+// the folder is shared with sees them; the editor is recorded as having added them.
+// An editor can't choose the visibility of the owner's files: theirs get DefaultVisibility,
+// and the owner's other copies of the same content, trashed or not, are left untouched.
+func (s *FileService) UploadFilesToFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, uploads []*graphql.Upload, visibility string, bestEffort bool, order UploadOrder, onConflict NameConflict) ([]models.UserFile, []UploadFailure, error) {
+	if folderID == nil {
+		return s.uploadFiles(ctx, userID, nil, uploads, visibility, bestEffort, order, onConflict, false)
 	}
-	// Current usage and remaining quota
-	currentUsage, err := s.FileRepo.GetUserUsageSum(ctx, userID)
+	if s == nil || s.Folders == nil {
+		return nil, nil, fmt.Errorf("folder service not configured")
+	}
+	ok, err := s.Folders.Repo.ValidateParent(ctx, userID, *folderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get usage: %w", err)
+		return nil, nil, err
 	}
-	remaining := perUserQuotaBytes - currentUsage
-	if remaining < 0 {
-		remaining = 0
+	if ok {
+		return s.uploadFiles(ctx, userID, folderID, uploads, visibility, bestEffort, order, onConflict, false)
+	}
+	if s.Shares == nil {
+		return nil, nil, fmt.Errorf("folder %s not found", *folderID)
+	}
+	if err := requireFolderEditor(ctx, s.Shares, s.Users, userID, *folderID); err != nil {
+		return nil, nil, err
+	}
+	ownerID, err := s.Folders.Repo.GetFolderOwner(ctx, *folderID)
+	if err != nil {
+		return nil, nil, err
 	}
+	started := time.Now()
+	files, failures, err := s.uploadFiles(ctx, ownerID, folderID, uploads, "", bestEffort, order, onConflict, true)
+	if len(files) > 0 {
+		ids := make([]uuid.UUID, len(files))
+		for i, f := range files {
+			ids[i] = f.ID
+		}
+		if merr := s.FileRepo.MarkUserFilesAddedBy(ctx, ownerID, ids, *folderID, userID, started); merr != nil {
+			log.Printf("warning: failed to record %s as the editor who added %d files to folder %s: %v", userID, len(ids), *folderID, merr)
+		}
+	}
+	return files, failures, err
+}
 
-	var results []models.UserFile
+// UploadIntoNewFolder uploads files into the folder named folderName under parentID (the
+// root when nil), creating it unless the user already has a folder of that name there, in
+// which case the files join it. Files are stored best effort: the ones that fail are
+// returned as UploadFailures next to the stored ones. A folder created by this call is
+// removed again if none of the files could be stored.
+//
+// Returns:
+//   - *models.Folder: The created or reused folder
+//   - []models.UserFile: The stored files, all mapped into the folder
+//   - []UploadFailure: Files that could not be stored
+//   - error: nil unless the folder could not be set up or no file was stored
+func (s *FileService) UploadIntoNewFolder(ctx context.Context, userID uuid.UUID, folderName string, parentID *uuid.UUID, uploads []*graphql.Upload, visibility string) (*models.Folder, []models.UserFile, []UploadFailure, error) {
+	if s == nil || s.Minio == nil || s.Bucket == "" {
+		return nil, nil, nil, ErrStorageUnavailable
+	}
+	if s.Folders == nil {
+		return nil, nil, nil, fmt.Errorf("folder service not configured")
+	}
+	folderName = strings.TrimSpace(folderName)
+	if len(uploads) == 0 {
+		return nil, nil, nil, fmt.Errorf("no files provided")
+	}
+	existing, err := s.Folders.Repo.ListFolders(ctx, userID, parentID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to check existing folders: %w", err)
+	}
+	reused := false
+	for _, f := range existing {
+		reused = reused || f.Name == folderName
+	}
+	folderID, err := s.Folders.CreateFolder(ctx, userID, folderName, parentID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	folder, err := s.Folders.Repo.GetFolderByID(ctx, userID, folderID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	// Check if we have a target folder from context (for folder uploads)
-	var targetFolderID *uuid.UUID
-	if folderIDValue := ctx.Value("targetFolderID"); folderIDValue != nil {
-		fmt.Printf("DEBUG: Context value found, type: %T, value: %v\n", folderIDValue, folderIDValue)
-		if folderID, ok := folderIDValue.(uuid.UUID); ok {
-			targetFolderID = &folderID
-			fmt.Printf("DEBUG: File service received targetFolderID from context: %s\n", folderID.String())
-		} else {
-			fmt.Printf("DEBUG: Type assertion failed for targetFolderID\n")
+	results, failures, err := s.uploadFiles(ctx, userID, &folderID, uploads, visibility, true, UploadOrder{}, NameConflictAllow, false)
+	if err == nil && len(results) == 0 && len(failures) > 0 {
+		err = fmt.Errorf("no files could be uploaded: %w", failures[0].Err)
+	}
+	if err != nil {
+		if !reused {
+			if derr := s.Folders.Repo.PurgeFolder(ctx, userID, folderID); derr != nil {
+				log.Printf("failed to remove empty upload folder %s: %v", folderID, derr)
+			}
 		}
-	} else {
-		fmt.Printf("DEBUG: No targetFolderID found in context\n")
+		return nil, nil, failures, err
 	}
+	return folder, results, failures, nil
+}
 
-	for _, up := range uploads {
-		if up == nil || up.File == nil {
-			return nil, fmt.Errorf("invalid upload input")
+// uploadFiles stores uploads as userID's files. byEditor marks an editor uploading into
+// userID's folder, whose uploads only ever add new mappings (see uploadBatch.byEditor).
+func (s *FileService) uploadFiles(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, uploads []*graphql.Upload, visibility string, bestEffort bool, order UploadOrder, policy NameConflict, byEditor bool) ([]models.UserFile, []UploadFailure, error) {
+	if s == nil || s.Minio == nil || s.Bucket == "" {
+		return nil, nil, ErrStorageUnavailable
+	}
+	if visibility == "" {
+		visibility = s.DefaultVisibility
+	}
+	visibility, err := ParseVisibility(visibility)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Reject oversized batches before reading any of them
+	maxFiles := s.MaxFilesPerUpload
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFilesPerUpload
+	}
+	if len(uploads) > maxFiles {
+		return nil, nil, fmt.Errorf("too many files: %d exceeds the limit of %d per upload", len(uploads), maxFiles)
+	}
+	sequence, err := order.sequence(uploads)
+	if err != nil {
+		return nil, nil, err
+	}
+	remaining, err := s.remainingQuota(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	folderLimits, err := s.folderLimits(ctx, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names folderNames
+	switch policy {
+	case NameConflictAllow:
+	case NameConflictRename, NameConflictReject:
+		if names, err = s.loadFolderNames(ctx, userID, folderID); err != nil {
+			return nil, nil, err
 		}
+	default:
+		return nil, nil, fmt.Errorf("unknown name conflict policy %q", policy)
+	}
 
-		// Read into memory, compute hash and size
-		buf := &bytes.Buffer{}
-		if _, err := io.Copy(buf, up.File); err != nil {
-			return nil, err
-		}
+	var results []models.UserFile
+	var failures []UploadFailure
+
+	batch := &uploadBatch{
+		userID:         userID,
+		targetFolderID: folderID,
+		visibility:     visibility,
+		byEditor:       byEditor,
+		remaining:      remaining,
+		headroom:       remaining,
+		folderLimits:   folderLimits,
+		hashLocks:      make(map[string]*sync.Mutex),
+		namePolicy:     policy,
+		names:          names,
+	}
+	if order.set() {
+		batch.turns = newUploadTurns()
+	}
+
+	workers := s.UploadConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(uploads) {
+		workers = len(uploads)
+	}
 
-		// Determine MIME type using declared type, extension, and content sniffing
-		clean := func(s string) string {
-			if s == "" {
-				return s
+	// All-or-nothing batches stop handing out work after the first failure;
+	// files already in flight are allowed to finish so none is left half-stored
+	var failed atomic.Bool
+
+	stored := make([]*models.UserFile, len(uploads))
+	errs := make([]error, len(uploads))
+	// jobs carries positions in sequence; a file's position is its turn for quota
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for turn := range jobs {
+				i := sequence[turn]
+				uf, err := s.uploadRecovered(ctx, batch, uploads[i], turn)
+				batch.turns.pass(turn)
+				stored[i], errs[i] = uf, err
+				if err != nil {
+					failed.Store(true)
+				}
 			}
-			if i := strings.Index(s, ";"); i >= 0 {
-				s = s[:i]
+		}()
+	}
+	for turn := range sequence {
+		if !bestEffort && failed.Load() {
+			break
+		}
+		jobs <- turn
+	}
+	close(jobs)
+	wg.Wait()
+	s.recordUploadFailures(ctx, userID, uploads, errs)
+
+	for i, err := range errs {
+		if err == nil {
+			if stored[i] != nil {
+				results = append(results, *stored[i])
 			}
-			return strings.TrimSpace(strings.ToLower(s))
+			continue
+		}
+		if !bestEffort {
+			return nil, nil, err
+		}
+		name := ""
+		if uploads[i] != nil {
+			name = uploads[i].Filename
 		}
+		failures = append(failures, UploadFailure{Index: i, Filename: name, Err: err})
+	}
 
-		// Declared type (from client/browser)
-		declaredBase := clean(up.ContentType)
+	return results, failures, nil
+}
 
-		// Extension-based type
-		extMime := ""
-		if ext := strings.ToLower(path.Ext(up.Filename)); ext != "" {
-			extMime = clean(mime.TypeByExtension(ext))
-		}
+// uploadBatch is the state shared by the workers of one UploadFiles call.
+type uploadBatch struct {
+	userID         uuid.UUID
+	targetFolderID *uuid.UUID
+	visibility     string
+	// byEditor is set when an editor uploads into userID's folder. The visibility then only
+	// applies to the mappings the batch creates, and the user's trashed copies of the same
+	// content are left in the trash rather than restored
+	byEditor bool
 
-		// Sniffed type (actual file content)
-		peek := buf.Bytes()
-		if len(peek) > 512 {
-			peek = peek[:512]
-		}
-		sniffed := clean(http.DetectContentType(peek))
+	// mu guards remaining, the user's quota headroom for the batch
+	mu        sync.Mutex
+	remaining int64
+	// headroom is the quota left when the batch started; remaining never exceeds it
+	headroom int64
+	// folderLimits is the room left in the target folder and its ancestors that have a
+	// folder quota, guarded by mu
+	folderLimits []folderLimit
+	// hashLocks serializes files with identical content so dedup sees earlier inserts
+	hashLocks map[string]*sync.Mutex
+	// turns orders quota reservations for ordered batches (nil when unordered)
+	turns *uploadTurns
+	// names holds the target folder's taken names, guarded by mu (nil when namePolicy
+	// allows same-name files)
+	namePolicy NameConflict
+	names      folderNames
+}
 
-		// Normalize a few common aliases inline
-		if declaredBase == "image/jpg" {
-			declaredBase = "image/jpeg"
+// reserve takes n bytes of quota, reporting the headroom left when it doesn't fit.
+func (b *uploadBatch) reserve(n int64) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.remaining {
+		return b.remaining, false
+	}
+	b.remaining -= n
+	return b.remaining, true
+}
+
+// release returns quota taken by reserve that ended up unused.
+func (b *uploadBatch) release(n int64) {
+	b.mu.Lock()
+	b.remaining += n
+	b.mu.Unlock()
+}
+
+// reserveFolder takes n bytes from every folder quota the target folder falls under,
+// failing with ErrFolderQuotaExceeded, naming the folder, when one of them hasn't room.
+func (b *uploadBatch) reserveFolder(filename string, n int64) error {
+	if len(b.folderLimits) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, l := range b.folderLimits {
+		if n > l.remaining {
+			return fmt.Errorf("%w: not enough space in folder %q for %s (%d bytes left)", ErrFolderQuotaExceeded, l.name, filename, max(l.remaining, 0))
 		}
-		if extMime == "image/jpg" {
-			extMime = "image/jpeg"
+	}
+	for i := range b.folderLimits {
+		b.folderLimits[i].remaining -= n
+	}
+	return nil
+}
+
+// releaseFolder returns folder quota taken by reserveFolder for a file that wasn't stored.
+func (b *uploadBatch) releaseFolder(n int64) {
+	if len(b.folderLimits) == 0 {
+		return
+	}
+	b.mu.Lock()
+	for i := range b.folderLimits {
+		b.folderLimits[i].remaining += n
+	}
+	b.mu.Unlock()
+}
+
+// claimName settles the name a file of content hash is stored under in the target folder.
+func (b *uploadBatch) claimName(name, hash string) (string, error) {
+	if b.names == nil {
+		return name, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.names.claim(name, hash, b.namePolicy)
+}
+
+// releaseName frees a name taken by claimName for a file that wasn't stored.
+func (b *uploadBatch) releaseName(name, hash string) {
+	if b.names == nil {
+		return
+	}
+	b.mu.Lock()
+	b.names.release(name, hash)
+	b.mu.Unlock()
+}
+
+// lockHash acquires the per-content lock and returns its unlock function.
+func (b *uploadBatch) lockHash(hash string) func() {
+	b.mu.Lock()
+	l, ok := b.hashLocks[hash]
+	if !ok {
+		l = &sync.Mutex{}
+		b.hashLocks[hash] = l
+	}
+	b.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// uploadOne stores a single upload for the batch's user and returns the resulting mapping.
+// Quota is reserved from the batch before new storage is consumed and given back if unused.
+// turn is the file's position in the batch's processing order.
+func (s *FileService) uploadOne(ctx context.Context, batch *uploadBatch, up *graphql.Upload, turn int) (_ *models.UserFile, err error) {
+	if up == nil || up.File == nil {
+		return nil, fmt.Errorf("invalid upload input")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.MaxFileSize > 0 && up.Size > s.MaxFileSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrFileTooLarge, up.Filename, up.Size, s.MaxFileSize)
+	}
+	// A declared size over the whole headroom can't fit, so refuse it before reading the
+	// body. Content the user already holds would be free, but that takes the full hash.
+	if up.Size > batch.headroom {
+		return nil, fmt.Errorf("%w: not enough space for %s (%d bytes left)", ErrQuotaExceeded, up.Filename, batch.headroom)
+	}
+	userID, targetFolderID := batch.userID, batch.targetFolderID
+
+	// Spool to a temp file, computing hash and size on the way
+	spool := s.Spool
+	if spool == nil {
+		spool = defaultUploadSpool
+	}
+	// Content of unknown length is cut off at the headroom rather than spooled in full
+	var body io.Reader = up.File
+	if up.Size < 0 {
+		body = &quotaReader{r: up.File, limit: batch.headroom}
+	}
+	spooled, err := spool.Spool(body, up.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer spooled.Close()
+	// The declared size may be missing; the spooled one is exact
+	if s.MaxFileSize > 0 && spooled.Size > s.MaxFileSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrFileTooLarge, up.Filename, spooled.Size, s.MaxFileSize)
+	}
+	if spooled.Size == 0 && s.RejectEmptyFiles {
+		return nil, fmt.Errorf("%w: %s has no content", ErrEmptyFile, up.Filename)
+	}
+
+	// Determine MIME type using declared type, extension, and content sniffing
+	clean := func(s string) string {
+		if s == "" {
+			return s
 		}
-		if sniffed == "image/jpg" {
-			sniffed = "image/jpeg"
+		if i := strings.Index(s, ";"); i >= 0 {
+			s = s[:i]
 		}
+		return strings.TrimSpace(strings.ToLower(s))
+	}
+
+	// Declared type (from client/browser)
+	declaredBase := clean(up.ContentType)
 
-		// Allow-list of text-based extensions
-		textExts := map[string]bool{
-			".c": true, ".cpp": true, ".h": true, ".hpp": true,
-			".py": true, ".js": true, ".ts": true, ".java": true,
-			".txt": true, ".md": true, ".go": true, ".rs": true,
+	// Extension-based type
+	extMime := ""
+	if ext := strings.ToLower(path.Ext(up.Filename)); ext != "" {
+		extMime = clean(mime.TypeByExtension(ext))
+	}
+
+	// Sniffed type (actual file content); there is nothing to sniff in an empty file, so
+	// an empty report.pdf isn't refused for not looking like a PDF
+	sniffed := ""
+	if spooled.Size > 0 {
+		sniffed = clean(http.DetectContentType(spooled.Head))
+	}
+
+	// Normalize a few common aliases inline
+	if declaredBase == "image/jpg" {
+		declaredBase = "image/jpeg"
+	}
+	if extMime == "image/jpg" {
+		extMime = "image/jpeg"
+	}
+	if sniffed == "image/jpg" {
+		sniffed = "image/jpeg"
+	}
+
+	// Allow-list of text-based extensions
+	textExts := map[string]bool{
+		".c": true, ".cpp": true, ".h": true, ".hpp": true,
+		".py": true, ".js": true, ".ts": true, ".java": true,
+		".txt": true, ".md": true, ".go": true, ".rs": true,
+	}
+
+	// Validation: if not a text file, sniffed must agree with extension
+	ext := strings.ToLower(path.Ext(up.Filename))
+	if extMime != "" && sniffed != "" && sniffed != "application/octet-stream" {
+		if sniffed == "text/plain" && textExts[ext] {
+			// treat as valid: cpp, py, etc.
+		} else if extMime != sniffed {
+			return nil, fmt.Errorf("%w: file content (%s) does not match file extension (%s)", ErrMimeMismatch, sniffed, extMime)
 		}
+	}
 
-		// Validation: if not a text file, sniffed must agree with extension
-		ext := strings.ToLower(path.Ext(up.Filename))
-		if extMime != "" && sniffed != "" && sniffed != "application/octet-stream" {
-			if sniffed == "text/plain" && textExts[ext] {
-				// treat as valid: cpp, py, etc.
-			} else if extMime != sniffed {
-				return nil, fmt.Errorf("file content (%s) does not match file extension (%s)", sniffed, extMime)
-			}
+	// Decide final type: prefer sniffed > extension > declared
+	finalMimeType := sniffed
+	if finalMimeType == "" || finalMimeType == "application/octet-stream" {
+		if extMime != "" {
+			finalMimeType = extMime
+		} else if declaredBase != "" {
+			finalMimeType = declaredBase
+		} else {
+			finalMimeType = "application/octet-stream"
 		}
+	}
 
-		// Decide final type: prefer sniffed > extension > declared
-		finalMimeType := sniffed
-		if finalMimeType == "" || finalMimeType == "application/octet-stream" {
-			if extMime != "" {
-				finalMimeType = extMime
-			} else if declaredBase != "" {
-				finalMimeType = declaredBase
-			} else {
-				finalMimeType = "application/octet-stream"
-			}
+	// Basic validation: if both declared and extension exist, ensure they're compatible
+	if declaredBase != "" && extMime != "" && declaredBase != "application/octet-stream" {
+		// Allow some common compatible combinations
+		compatible := declaredBase == extMime
+		if !compatible {
+			return nil, fmt.Errorf("%w: declared MIME type (%s) does not match file extension (%s)", ErrMimeMismatch, declaredBase, extMime)
 		}
+	}
+	if mimeBlocked(finalMimeType, s.BlockedMimeTypes) {
+		return nil, fmt.Errorf("%w: %s files (%s) can't be uploaded", ErrBlockedType, finalMimeType, up.Filename)
+	}
+	hash, sizeBytes := spooled.Hash, spooled.Size
+	if sizeBytes == 0 {
+		// Every empty file dedups onto one shared row, so its type can't depend on which
+		// name happened to be uploaded first
+		finalMimeType = emptyFileMimeType
+	}
 
-		// Basic validation: if both declared and extension exist, ensure they're compatible
-		if declaredBase != "" && extMime != "" && declaredBase != "application/octet-stream" {
-			// Allow some common compatible combinations
-			compatible := declaredBase == extMime
-			if !compatible {
-				return nil, fmt.Errorf("declared MIME type (%s) does not match file extension (%s)", declaredBase, extMime)
-			}
+	// Ordered batches decide quota one file at a time, in order
+	batch.turns.wait(turn)
+	unlock := batch.lockHash(hash)
+	defer unlock()
+
+	// Settle the name before storing anything; it is given back if the file fails
+	name, err := batch.claimName(up.Filename, hash)
+	if err != nil {
+		batch.turns.pass(turn)
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			batch.releaseName(name, hash)
+		}
+	}()
+	// Every copy counts against folder quotas, even of content the user already has
+	if err := batch.reserveFolder(name, sizeBytes); err != nil {
+		batch.turns.pass(turn)
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			batch.releaseFolder(sizeBytes)
 		}
-		sum := sha256.Sum256(buf.Bytes())
-		hash := fmt.Sprintf("%x", sum[:])
-		sizeBytes := int64(len(buf.Bytes()))
+	}()
 
-		// If user already has this file (active mapping), create an additional mapping without re-uploading
-		if ufExisting, _ := s.FindUserFileByHash(ctx, userID, hash); ufExisting != nil {
-			// Ensure the file exists
-			dbFile, err := s.FileRepo.FindByHash(ctx, hash)
-			if err != nil && err != pgx.ErrNoRows {
-				return nil, err
-			}
-			if dbFile == nil {
-				return nil, fmt.Errorf("file record missing for existing mapping")
-			}
+	// If user already has this file (active mapping), create an additional mapping without re-uploading
+	if ufExisting, _ := s.FindUserFileByHash(ctx, userID, hash); ufExisting != nil {
+		batch.turns.pass(turn)
+		// Ensure the file exists
+		dbFile, err := s.FileRepo.FindByHash(ctx, hash)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		if dbFile == nil {
+			return nil, fmt.Errorf("file record missing for existing mapping")
+		}
+		var mappingID uuid.UUID
+		err = s.attachLocked(ctx, dbFile.ID, func(ctx context.Context) error {
 			// Use folder-aware mapping creation if target folder is specified
-			var mappingID uuid.UUID
+			var err error
 			if targetFolderID != nil {
 				fmt.Printf("DEBUG: Creating user file mapping with folder: %s\n", targetFolderID.String())
 				mappingID, err = s.FileRepo.CreateUserFileMappingWithFolder(ctx, userID, dbFile.ID, "owner", targetFolderID)
@@ -211,112 +723,593 @@ func (s *FileService) UploadFiles(ctx context.Context, userID uuid.UUID, uploads
 				mappingID, err = s.FileRepo.CreateUserFileMapping(ctx, userID, dbFile.ID, "owner")
 			}
 			if err != nil {
+				return err
+			}
+			if batch.byEditor {
+				return s.FileRepo.SetUserFileMappingVisibility(ctx, userID, mappingID, batch.visibility)
+			}
+			return s.FileRepo.SetUserFileVisibility(ctx, userID, dbFile.ID, batch.visibility)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if display := displayName(name, dbFile.OriginalName); display != nil {
+			if err := s.FileRepo.SetUserFileDisplayName(ctx, userID, mappingID, display); err != nil {
 				return nil, err
 			}
-			if ufReloaded, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mappingID); err == nil && ufReloaded != nil {
-				results = append(results, *ufReloaded)
-				continue
+		}
+		if ufReloaded, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mappingID); err == nil && ufReloaded != nil {
+			return ufReloaded, nil
+		}
+		// Fallback to existing mapping if reload fails
+		return ufExisting, nil
+	}
+
+	// Content new to this user is scanned before it is stored or mapped
+	status, reason, err := s.scanUpload(ctx, name, spooled)
+	if err != nil {
+		return nil, err
+	}
+
+	// Quota check
+	left, ok := batch.reserve(sizeBytes)
+	batch.turns.pass(turn)
+	if !ok {
+		return nil, fmt.Errorf("%w: not enough space for %s (%d bytes left)", ErrQuotaExceeded, name, left)
+	}
+	reserved := true
+	defer func() {
+		if reserved {
+			batch.release(sizeBytes)
+		}
+	}()
+
+	// Check if file exists in global files table
+	dbFile, err := s.FileRepo.FindByHash(ctx, hash)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if dbFile == nil {
+		// Upload to MinIO and create file record
+		objectName := s.StorageLayout.ObjectKey(hash)
+		content, objectSize, objectType := spooled.Reader(), sizeBytes, finalMimeType
+		var keyID string
+		var nonce []byte
+		if s.Crypto != nil {
+			if content, keyID, nonce, err = s.Crypto.Encrypt(content); err != nil {
+				return nil, err
 			}
-			// Fallback to existing mapping if reload fails
-			results = append(results, *ufExisting)
-			continue
+			objectSize, objectType = s.Crypto.CiphertextSize(sizeBytes), "application/octet-stream"
+		}
+		if err := s.putObject(ctx, objectName, content, objectSize, objectType); err != nil {
+			return nil, err
+		}
+		dbFile = &models.File{
+			ID:           uuid.New(),
+			Hash:         hash,
+			StoragePath:  objectName,
+			OriginalName: name,
+			MimeType:     finalMimeType,
+			Size:         sizeBytes,
+			RefCount:     0, // Start with 0, will be incremented when user mapping is created
+			Visibility:   "private",
+			CreatedAt:    time.Now(),
+			Status:       status,
+
+			EncryptionKeyID: keyID,
+			EncryptionNonce: nonce,
+		}
+		if status == models.FileStatusQuarantined {
+			now := time.Now()
+			dbFile.QuarantineReason = reason
+			dbFile.QuarantinedAt = &now
+		}
+		if err := s.FileRepo.CreateFile(ctx, dbFile); err != nil {
+			return nil, err
+		}
+	} else if status == models.FileStatusQuarantined && dbFile.Status != models.FileStatusQuarantined {
+		// Flagged content is quarantined for everyone who already stores it
+		if _, err := s.FileRepo.SetFileStatus(ctx, dbFile.ID, status, reason); err != nil {
+			return nil, err
+		}
+		dbFile.Status = status
+		s.purgeCDN(ctx, dbFile)
+	}
+
+	// Map to user
+	// Upsert mapping (ref_count follows via trigger); quota shrinks only for the first reference by this user
+	var prevStatus string
+	var inserted bool
+	var mappingID uuid.UUID
+	err = s.attachLocked(ctx, dbFile.ID, func(ctx context.Context) error {
+		prevStatus, _ = s.FileRepo.GetUserFileMappingStatus(ctx, userID, dbFile.ID)
+		var err error
+		if batch.byEditor {
+			if mappingID, err = s.FileRepo.CreateUserFileMappingWithFolder(ctx, userID, dbFile.ID, "owner", targetFolderID); err != nil {
+				return err
+			}
+			inserted = true
+			return s.FileRepo.SetUserFileMappingVisibility(ctx, userID, mappingID, batch.visibility)
+		}
+		if targetFolderID != nil {
+			fmt.Printf("DEBUG: Adding user file with folder: %s for existing file\n", targetFolderID.String())
+			inserted, err = s.FileRepo.AddUserFileWithFolder(ctx, userID, dbFile.ID, "owner", targetFolderID)
+		} else {
+			fmt.Printf("DEBUG: Adding user file without folder (root) for existing file\n")
+			inserted, err = s.FileRepo.AddUserFile(ctx, userID, dbFile.ID, "owner")
+		}
+		if err != nil {
+			return err
+		}
+		return s.FileRepo.SetUserFileVisibility(ctx, userID, dbFile.ID, batch.visibility)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		if ufExisting, _ := s.FindUserFileByHash(ctx, userID, hash); ufExisting != nil {
+			batch.releaseFolder(sizeBytes)
+			return ufExisting, nil
+		}
+	}
+	if prevStatus == "none" {
+		// Keep the reservation only when first mapping is created for this user
+		reserved = false
+	}
+
+	// The new (or restored) mapping shows the name the file was uploaded or renamed under
+	if mappingID == uuid.Nil {
+		if uf, _ := s.FindUserFileByHash(ctx, userID, hash); uf != nil {
+			mappingID = uf.ID
+		}
+	}
+	if mappingID != uuid.Nil {
+		if err := s.FileRepo.SetUserFileDisplayName(ctx, userID, mappingID, displayName(name, dbFile.OriginalName)); err != nil {
+			return nil, err
+		}
+		if ufReloaded, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mappingID); err == nil && ufReloaded != nil {
+			return ufReloaded, nil
+		}
+	}
+
+	// Append result by reloading mapping by file id (non-duplicate path)
+	if ufReloaded, err := s.FileRepo.GetUserFileByFileID(ctx, userID, dbFile.ID); err == nil && ufReloaded != nil {
+		return ufReloaded, nil
+	}
+	return &models.UserFile{ID: uuid.New(), UserID: userID, FileID: dbFile.ID, UploadedAt: time.Now(), File: *dbFile}, nil
+}
+
+// uploadRecovered runs uploadOne, turning a panic into that file's error: workers run
+// outside the resolver's panic handler, so an unrecovered panic would stop the server.
+// uploadOne's deferred cleanup, including removing its temp file, has run by then.
+func (s *FileService) uploadRecovered(ctx context.Context, batch *uploadBatch, up *graphql.Upload, turn int) (uf *models.UserFile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			uf, err = nil, fmt.Errorf("upload failed unexpectedly: %v", r)
+		}
+	}()
+	return s.uploadOne(ctx, batch, up, turn)
+}
+
+// MaxDescriptionLength caps file and folder descriptions, in characters
+const MaxDescriptionLength = 2000
+
+// normalizeDescription trims a description and checks its length. Blank descriptions come
+// back nil, which clears the stored one.
+func normalizeDescription(description string) (*string, error) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return nil, nil
+	}
+	if !utf8.ValidString(description) {
+		return nil, fmt.Errorf("description must be valid UTF-8")
+	}
+	if n := utf8.RuneCountInString(description); n > MaxDescriptionLength {
+		return nil, fmt.Errorf("description is %d characters, the maximum is %d", n, MaxDescriptionLength)
+	}
+	return &description, nil
+}
+
+// SetDescription sets the user's note on one of their files, identified by mapping since each
+// user storing a file keeps their own. A blank description clears it. Returns the updated mapping.
+func (s *FileService) SetDescription(ctx context.Context, userID, mappingID uuid.UUID, description string) (*models.UserFile, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	desc, err := normalizeDescription(description)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.FileRepo.SetUserFileDescription(ctx, userID, mappingID, desc); err != nil {
+		return nil, err
+	}
+	uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mappingID)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
+		return nil, fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+	}
+	return uf, nil
+}
+
+// MoveFile moves one of the user's file mappings into folderID, or back to the root when
+// folderID is nil, and returns the reloaded mapping. It goes through Folders.MoveFiles, so
+// the folder must be the user's own; a missing, trashed or foreign mapping is reported as
+// not found.
+func (s *FileService) MoveFile(ctx context.Context, userID uuid.UUID, mappingID string, folderID *uuid.UUID) (*models.UserFile, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	if s.Folders == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	mid, err := uuid.Parse(mappingID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping id")
+	}
+	results, err := s.Folders.MoveFiles(ctx, userID, []FileMove{{MappingID: mid, FolderID: folderID}})
+	if err != nil {
+		return nil, err
+	}
+	if !results[0].Moved {
+		return nil, fmt.Errorf("file %s: %w", mid, repository.ErrNotFound)
+	}
+	uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mid)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
+		return nil, fmt.Errorf("file %s: %w", mid, repository.ErrNotFound)
+	}
+	return uf, nil
+}
+
+// MoveFilesBatch moves several of the user's file mappings into folderID, or to the root
+// when folderID is nil. It is Folders.MoveFiles with a single destination: the folder is
+// checked once up front, and mappings that are missing, someone else's or in the trash are
+// reported in their results while the rest move together in one transaction. Malformed ids
+// fail the call before anything moves. Repeated ids count once; results follow the input.
+func (s *FileService) MoveFilesBatch(ctx context.Context, userID uuid.UUID, mappingIDs []string, folderID *uuid.UUID) ([]FileMoveResult, error) {
+	if s == nil || s.Folders == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	if len(mappingIDs) == 0 {
+		return nil, fmt.Errorf("no files selected")
+	}
+	moves := make([]FileMove, 0, len(mappingIDs))
+	for _, raw := range mappingIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping id %q", raw)
 		}
+		moves = append(moves, FileMove{MappingID: id, FolderID: folderID})
+	}
+	return s.Folders.MoveFiles(ctx, userID, moves)
+}
+
+// SetFileVisibility changes the visibility of the user's copies of a file. Only the owner
+// may change it; making a file public lets any signed-in user view and download it.
+func (s *FileService) SetFileVisibility(ctx context.Context, userID, fileID uuid.UUID, visibility string) (*models.UserFile, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	if strings.TrimSpace(visibility) == "" {
+		return nil, fmt.Errorf("visibility is required")
+	}
+	visibility, err := ParseVisibility(visibility)
+	if err != nil {
+		return nil, err
+	}
+	uf, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil || uf.Role != "owner" {
+		return nil, fmt.Errorf("file not found or you are not its owner")
+	}
+	if err := s.FileRepo.SetUserFileVisibility(ctx, userID, fileID, visibility); err != nil {
+		return nil, fmt.Errorf("failed to set visibility: %w", err)
+	}
+	if reloaded, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID); err == nil && reloaded != nil {
+		return reloaded, nil
+	}
+	uf.File.Visibility = visibility
+	return uf, nil
+}
+
+// userQuota resolves the user's personal quota: their override in user_quotas, else
+// DefaultQuotaBytes.
+func (s *FileService) userQuota(ctx context.Context, userID uuid.UUID) (int64, error) {
+	quota, err := s.FileRepo.GetUserQuota(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get quota: %w", err)
+	}
+	return s.quotaOrDefault(quota), nil
+}
+
+// quotaOrDefault returns override when set, else DefaultQuotaBytes.
+func (s *FileService) quotaOrDefault(override *int64) int64 {
+	if override != nil {
+		return *override
+	}
+	if s.DefaultQuotaBytes > 0 {
+		return s.DefaultQuotaBytes
+	}
+	return defaultQuotaBytes
+}
+
+// remainingQuota returns how many bytes the user can still add before hitting the quota.
+func (s *FileService) remainingQuota(ctx context.Context, userID uuid.UUID) (int64, error) {
+	currentUsage, err := s.FileRepo.GetUserUsageSum(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage: %w", err)
+	}
+	quota, err := s.userQuota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	remaining := quota - currentUsage
+	if remaining < 0 {
+		remaining = 0
+	}
+	orgRemaining, inOrg, err := s.orgRemainingQuota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if inOrg {
+		remaining = min(remaining, orgRemaining)
+	}
+	return remaining, nil
+}
+
+// folderLimit is the room left under one folder quota during an upload batch.
+type folderLimit struct {
+	name      string
+	remaining int64
+}
+
+// folderLimits loads the room left in the target folder and each of its ancestors that has
+// a folder quota; nil when uploading to the root or without a folder service. Like the
+// organization pool, concurrent batches into the same folder can overshoot it slightly.
+func (s *FileService) folderLimits(ctx context.Context, folderID *uuid.UUID) ([]folderLimit, error) {
+	if folderID == nil || s.Folders == nil || s.Folders.Repo == nil {
+		return nil, nil
+	}
+	usage, err := s.Folders.Repo.GetFolderQuotaUsage(ctx, *folderID)
+	if err != nil {
+		return nil, err
+	}
+	var limits []folderLimit
+	for _, u := range usage {
+		limits = append(limits, folderLimit{name: u.FolderName, remaining: u.QuotaBytes - u.UsedBytes})
+	}
+	return limits, nil
+}
 
-		// Quota check
-		if sizeBytes > remaining {
-			return nil, fmt.Errorf("quota exceeded: not enough space for %s (%d bytes left)", up.Filename, remaining)
-		}
+// orgRemainingQuota returns what is left of the shared quota of the user's organization;
+// inOrg is false when the user has none. Uploads by other members are not serialized with
+// the caller's, so concurrent batches from two members can overshoot the pool slightly.
+func (s *FileService) orgRemainingQuota(ctx context.Context, userID uuid.UUID) (remaining int64, inOrg bool, err error) {
+	if s.Orgs == nil {
+		return 0, false, nil
+	}
+	org, err := s.Orgs.GetUserOrganization(ctx, userID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get organization: %w", err)
+	}
+	if org == nil {
+		return 0, false, nil
+	}
+	used, err := s.Orgs.GetOrganizationUsage(ctx, org.ID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get organization usage: %w", err)
+	}
+	return max(org.QuotaBytes-used, 0), true, nil
+}
 
-		// Check if file exists in global files table
-		dbFile, err := s.FileRepo.FindByHash(ctx, hash)
-		if err != nil && err != pgx.ErrNoRows {
-			return nil, err
-		}
-		if err == pgx.ErrNoRows || dbFile == nil {
-			// Upload to MinIO and create file record
-			objectName := fmt.Sprintf("files/%s", hash)
-			reader := bytes.NewReader(buf.Bytes())
-			if _, err := s.Minio.PutObject(ctx, s.Bucket, objectName, reader, sizeBytes, minio.PutObjectOptions{ContentType: finalMimeType}); err != nil {
-				return nil, err
-			}
-			dbFile = &models.File{
-				ID:           uuid.New(),
-				Hash:         hash,
-				StoragePath:  objectName,
-				OriginalName: up.Filename,
-				MimeType:     finalMimeType,
-				Size:         sizeBytes,
-				RefCount:     0, // Start with 0, will be incremented when user mapping is created
-				Visibility:   "private",
-				CreatedAt:    time.Now(),
-			}
-			if err := s.FileRepo.CreateFile(ctx, dbFile); err != nil {
-				return nil, err
-			}
-		}
+// PlannedUploadCheck is the dry-run verdict for one file of a planned upload.
+type PlannedUploadCheck struct {
+	// Index is the file's position in the planned batch
+	Index int
+	Size  int64
+	Hash  string
+	// Deduplicated is true when the user already references this content (or it repeats an
+	// earlier file of the batch), so the upload would not count against the quota
+	Deduplicated bool
+	// Fits reports whether the file would be accepted given the files before it
+	Fits bool
+}
 
-		// Map to user
-		// Upsert mapping and handle ref_count increment only for first reference by this user
-		prevStatus, _ := s.FileRepo.GetUserFileMappingStatus(ctx, userID, dbFile.ID)
-		var inserted bool
-		if targetFolderID != nil {
-			fmt.Printf("DEBUG: Adding user file with folder: %s for existing file\n", targetFolderID.String())
-			inserted, err = s.FileRepo.AddUserFileWithFolder(ctx, userID, dbFile.ID, "owner", targetFolderID)
-		} else {
-			fmt.Printf("DEBUG: Adding user file without folder (root) for existing file\n")
-			inserted, err = s.FileRepo.AddUserFile(ctx, userID, dbFile.ID, "owner")
+// QuotaCheck summarizes whether a planned upload fits in the user's quota.
+type QuotaCheck struct {
+	Files []PlannedUploadCheck
+	// FitCount is how many of the planned files would be accepted
+	FitCount int
+	// RemainingBytes is the quota left before the upload
+	RemainingBytes int64
+	// RemainingAfterBytes is the quota that would be left after storing every file that fits
+	RemainingAfterBytes int64
+}
+
+// CheckQuotaForUpload reports how a planned upload would fare against the user's quota
+// without storing anything. Files are considered in order, matching UploadFiles: content
+// the user already has is free, and new content fits only if the quota left after the
+// earlier files covers it.
+//
+// Parameters:
+//   - ctx: Context for cancellation and deadlines
+//   - userID: UUID of the user planning the upload
+//   - sizes: Size in bytes of each planned file
+//   - hashes: SHA-256 hex digest of each planned file, aligned with sizes
+//
+// Returns:
+//   - *QuotaCheck: Per-file verdicts and the quota totals
+//   - error: nil on success, or an error if the input is invalid or a lookup fails
+func (s *FileService) CheckQuotaForUpload(ctx context.Context, userID uuid.UUID, sizes []int64, hashes []string) (*QuotaCheck, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	if len(sizes) != len(hashes) {
+		return nil, fmt.Errorf("sizes and hashes must have the same length")
+	}
+	maxFiles := s.MaxFilesPerUpload
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFilesPerUpload
+	}
+	if len(sizes) > maxFiles {
+		return nil, fmt.Errorf("too many files: %d exceeds the limit of %d per upload", len(sizes), maxFiles)
+	}
+	remaining, err := s.remainingQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &QuotaCheck{RemainingBytes: remaining}
+	seen := make(map[string]bool, len(hashes))
+	for i, size := range sizes {
+		if size < 0 {
+			return nil, fmt.Errorf("invalid size for file %d", i)
 		}
-		if err != nil {
+		hash := strings.ToLower(strings.TrimSpace(hashes[i]))
+		if len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid hash for file %d", i)
+		}
+		fc := PlannedUploadCheck{Index: i, Size: size, Hash: hash}
+		if seen[hash] {
+			fc.Deduplicated = true
+		} else if fc.Deduplicated, err = s.userHasContent(ctx, userID, hash); err != nil {
 			return nil, err
-		} else if !inserted {
-			if ufExisting, _ := s.FindUserFileByHash(ctx, userID, hash); ufExisting != nil {
-				results = append(results, *ufExisting)
-				continue
-			}
 		}
-		if prevStatus == "none" {
-			if err := s.FileRepo.IncrementRefCount(ctx, dbFile.ID); err != nil {
-				return nil, err
-			}
-			// Update remaining quota only when first mapping is created for this user
-			remaining -= sizeBytes
+		switch {
+		case fc.Deduplicated:
+			fc.Fits = true
+		case size <= remaining:
+			fc.Fits = true
+			remaining -= size
 		}
-
-		// Append result by reloading mapping by file id (non-duplicate path)
-		if ufReloaded, err := s.FileRepo.GetUserFileByFileID(ctx, userID, dbFile.ID); err == nil && ufReloaded != nil {
-			results = append(results, *ufReloaded)
-		} else {
-			results = append(results, models.UserFile{ID: uuid.New(), UserID: userID, FileID: dbFile.ID, UploadedAt: time.Now(), File: *dbFile})
+		if fc.Fits {
+			seen[hash] = true
+			check.FitCount++
 		}
+		check.Files = append(check.Files, fc)
 	}
+	check.RemainingAfterBytes = remaining
+	return check, nil
+}
 
-	return results, nil
+// userHasContent reports whether an upload of hash would reuse a mapping the user already
+// has, active or in trash, the same cases where uploadOne does not charge the quota.
+func (s *FileService) userHasContent(ctx context.Context, userID uuid.UUID, hash string) (bool, error) {
+	if uf, _ := s.FindUserFileByHash(ctx, userID, hash); uf != nil {
+		return true, nil
+	}
+	dbFile, err := s.FileRepo.FindByHash(ctx, hash)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+	if dbFile == nil {
+		return false, nil
+	}
+	status, err := s.FileRepo.GetUserFileMappingStatus(ctx, userID, dbFile.ID)
+	if err != nil {
+		return false, err
+	}
+	return status != "none", nil
 }
 
 // GetUserFiles returns files associated with a user.
 func (s *FileService) GetUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error) {
 	if s == nil || s.FileRepo == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, ErrStorageUnavailable
 	}
 	return s.FileRepo.GetUserFiles(ctx, userID)
 }
 
-// GetUserUsage returns used bytes and quota
+// GetUserUsage returns used bytes and quota: the user's override in user_quotas, or the
+// default. For organization members the quota is what they can effectively reach: their
+// usage plus the smaller of their personal and the organization's remaining space.
 func (s *FileService) GetUserUsage(ctx context.Context, userID uuid.UUID) (used int64, quota int64, err error) {
 	if s == nil || s.FileRepo == nil {
-		return 0, 0, fmt.Errorf("file service not configured")
+		return 0, 0, ErrStorageUnavailable
 	}
 	used, err = s.FileRepo.GetUserUsageSum(ctx, userID)
 	if err != nil {
 		return 0, 0, err
 	}
-	return used, perUserQuotaBytes, nil
+	quota, err = s.userQuota(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	quota, err = s.reachableQuota(ctx, userID, used, quota)
+	if err != nil {
+		return 0, 0, err
+	}
+	return used, quota, nil
+}
+
+// reachableQuota lowers an organization member's personal quota to what they can
+// effectively reach: used plus the organization's remaining space, when that is smaller.
+func (s *FileService) reachableQuota(ctx context.Context, userID uuid.UUID, used, quota int64) (int64, error) {
+	orgRemaining, inOrg, err := s.orgRemainingQuota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if inOrg && used+orgRemaining < quota {
+		return used + orgRemaining, nil
+	}
+	return quota, nil
+}
+
+// UsageBreakdown is a user's storage usage in one read, for the storage dashboard
+type UsageBreakdown struct {
+	// LogicalBytes counts each distinct file once at full size; it is what the quota limits
+	LogicalBytes int64
+	// AttributedBytes shares each file's size among everyone storing it
+	AttributedBytes int64
+	// QuotaBytes is the quota as GetUserUsage reports it
+	QuotaBytes int64
+	FileCount  int
+	// DedupSavedBytes is LogicalBytes less AttributedBytes, never negative
+	DedupSavedBytes int64
+}
+
+// DedupSavedPercent is the share of the logical usage saved through deduplication.
+func (b UsageBreakdown) DedupSavedPercent() float64 {
+	if b.LogicalBytes <= 0 {
+		return 0
+	}
+	return float64(b.DedupSavedBytes) / float64(b.LogicalBytes) * 100
+}
+
+// GetUsageBreakdown returns the user's logical and attributed usage, quota and file count,
+// read together in one query. Only organization members need a second lookup, for the
+// organization's remaining space.
+func (s *FileService) GetUsageBreakdown(ctx context.Context, userID uuid.UUID) (UsageBreakdown, error) {
+	if s == nil || s.FileRepo == nil {
+		return UsageBreakdown{}, ErrStorageUnavailable
+	}
+	totals, err := s.FileRepo.GetUserUsageTotals(ctx, userID)
+	if err != nil {
+		return UsageBreakdown{}, fmt.Errorf("failed to get usage: %w", err)
+	}
+	quota, err := s.reachableQuota(ctx, userID, totals.LogicalBytes, s.quotaOrDefault(totals.QuotaOverride))
+	if err != nil {
+		return UsageBreakdown{}, err
+	}
+	return UsageBreakdown{
+		LogicalBytes:    totals.LogicalBytes,
+		AttributedBytes: totals.AttributedBytes,
+		QuotaBytes:      quota,
+		FileCount:       totals.FileCount,
+		DedupSavedBytes: max(totals.LogicalBytes-totals.AttributedBytes, 0),
+	}, nil
 }
 
 // GetUserAttributedUsage returns the user's attributed physical storage usage (sum of size/ref_count)
 func (s *FileService) GetUserAttributedUsage(ctx context.Context, userID uuid.UUID) (int64, error) {
 	if s == nil || s.FileRepo == nil {
-		return 0, fmt.Errorf("file service not configured")
+		return 0, ErrStorageUnavailable
 	}
 	return s.FileRepo.GetUserAttributedUsage(ctx, userID)
 }
@@ -324,7 +1317,7 @@ func (s *FileService) GetUserAttributedUsage(ctx context.Context, userID uuid.UU
 // FindUserFileByHash checks if user already has a file with the given content hash
 func (s *FileService) FindUserFileByHash(ctx context.Context, userID uuid.UUID, hash string) (*models.UserFile, error) {
 	if s == nil || s.FileRepo == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, ErrStorageUnavailable
 	}
 	return s.FileRepo.FindUserFileByHash(ctx, userID, hash)
 }
@@ -332,7 +1325,7 @@ func (s *FileService) FindUserFileByHash(ctx context.Context, userID uuid.UUID,
 // GetFileURL returns a presigned URL for the given user's file
 func (s *FileService) GetFileURL(ctx context.Context, userID, fileID uuid.UUID, inline bool) (string, error) {
 	if s == nil || s.FileRepo == nil || s.Minio == nil || s.Bucket == "" {
-		return "", fmt.Errorf("file service not configured")
+		return "", ErrStorageUnavailable
 	}
 	uf, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID)
 	if err != nil {
@@ -341,23 +1334,113 @@ func (s *FileService) GetFileURL(ctx context.Context, userID, fileID uuid.UUID,
 	if uf == nil {
 		return "", fmt.Errorf("not found or unauthorized")
 	}
+	return s.userFileURL(ctx, userID, uf, inline)
+}
+
+// GetFileURLByHash returns a presigned URL for the user's file with the given SHA-256
+// content hash, for clients that track content by hash. The user needs an active mapping
+// to the content; it being stored for someone else doesn't count.
+func (s *FileService) GetFileURLByHash(ctx context.Context, userID uuid.UUID, hash string, inline bool) (string, error) {
+	if s == nil || s.FileRepo == nil || s.Minio == nil || s.Bucket == "" {
+		return "", ErrStorageUnavailable
+	}
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if !isContentHash(hash) {
+		return "", fmt.Errorf("invalid content hash")
+	}
+	uf, err := s.FileRepo.FindUserFileByHash(ctx, userID, hash)
+	if err != nil {
+		return "", err
+	}
+	if uf == nil {
+		return "", fmt.Errorf("not found or unauthorized")
+	}
+	return s.userFileURL(ctx, userID, uf, inline)
+}
+
+// isContentHash reports whether s is a lowercase hex SHA-256, the form hashes are stored in.
+func isContentHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// userFileURL presigns the file of one of the user's mappings, named after the mapping's
+// folder, and stamps the access.
+func (s *FileService) userFileURL(ctx context.Context, userID uuid.UUID, uf *models.UserFile, inline bool) (string, error) {
+	fileID := uf.FileID
+	vars := DownloadNameVars{Original: uf.File.OriginalName, UploadedAt: uf.UploadedAt}
+	if uf.FolderID != nil && s.Folders != nil && s.Folders.Repo != nil {
+		// A missing folder only leaves {folder} empty; it shouldn't block the download
+		if folder, ferr := s.Folders.Repo.GetFolderByID(ctx, userID, *uf.FolderID); ferr == nil && folder != nil {
+			vars.Folder = folder.Name
+		}
+	}
+	u, err := s.presign(ctx, &uf.File, inline, s.DownloadName.Expand(vars))
+	if err != nil {
+		return "", err
+	}
+	// Handing out a URL counts as the user opening the file; a failed stamp shouldn't block access
+	if err := s.FileRepo.TouchUserFileAccess(ctx, userID, fileID); err != nil {
+		fmt.Printf("WARNING: failed to update last access for file %s: %v\n", fileID, err)
+	}
+	return u, nil
+}
+
+// PresignFileURL returns a short-lived download URL for a stored file without any
+// ownership check. Callers are responsible for authorizing access first. Without a
+// caller's mapping there is no folder, so {folder} in DownloadName expands to nothing.
+func (s *FileService) PresignFileURL(ctx context.Context, file *models.File, inline bool) (string, error) {
+	if s == nil || file == nil {
+		return "", ErrStorageUnavailable
+	}
+	return s.presign(ctx, file, inline, s.DownloadName.Expand(DownloadNameVars{Original: file.OriginalName, UploadedAt: file.CreatedAt}))
+}
+
+// presign builds the download URL, offering the content under filename: a signed URL of
+// this server for encrypted content, a signed CDN URL when a CDN is configured, else a
+// presigned MinIO URL.
+func (s *FileService) presign(ctx context.Context, file *models.File, inline bool, filename string) (string, error) {
+	if s == nil || s.Minio == nil || s.Bucket == "" {
+		return "", ErrStorageUnavailable
+	}
+	if file.Status == models.FileStatusQuarantined {
+		return "", ErrFileQuarantined
+	}
 	// Prepare response-content-disposition
 	dispType := "attachment"
 	if inline {
 		dispType = "inline"
 	}
+	disposition := fmt.Sprintf("%s; filename=\"%s\"", dispType, filename)
+	keyID, _, err := s.fileEncryption(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	if keyID != "" {
+		return s.proxyDownloadURL(file.ID, disposition, time.Now()), nil
+	}
+	if s.CDN != nil {
+		return s.CDN.SignedURL(s.ObjectKey(ctx, file), disposition, time.Now()), nil
+	}
 	reqParams := make(url.Values)
-	reqParams.Set("response-content-disposition", fmt.Sprintf("%s; filename=\"%s\"", dispType, uf.File.OriginalName))
+	reqParams.Set("response-content-disposition", disposition)
 
 	// 10 minute expiry
 	expiry := 10 * time.Minute
-	u, err := s.Minio.PresignedGetObject(ctx, s.Bucket, uf.File.StoragePath, expiry, reqParams)
+	u, err := s.Minio.PresignedGetObject(ctx, s.Bucket, s.ObjectKey(ctx, file), expiry, reqParams)
 	if err != nil {
 		return "", err
 	}
 	// If a public endpoint is configured (e.g., http://localhost:9000), rewrite the scheme+host
-	if s.PublicEndpoint != "" {
-		if base, perr := url.Parse(s.PublicEndpoint); perr == nil {
+	if endpoint := s.publicEndpoint(ctx); endpoint != "" {
+		if base, perr := url.Parse(endpoint); perr == nil {
 			u.Scheme = base.Scheme
 			u.Host = base.Host
 		}
@@ -365,22 +1448,57 @@ func (s *FileService) GetFileURL(ctx context.Context, userID, fileID uuid.UUID,
 	return u.String(), nil
 }
 
-// SoftDeleteUserFile marks a user-file mapping as deleted (Recently Deleted)
+type publicEndpointKey struct{}
+
+// WithPublicEndpoint makes presigned URLs built under ctx point at endpoint instead of the
+// configured PublicEndpoint, for deployments reached under several hostnames. Only pass
+// endpoints from trusted configuration, never raw client input.
+func WithPublicEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, publicEndpointKey{}, endpoint)
+}
+
+// PublicEndpointFromContext returns the endpoint set by WithPublicEndpoint, if any.
+func PublicEndpointFromContext(ctx context.Context) (string, bool) {
+	endpoint, ok := ctx.Value(publicEndpointKey{}).(string)
+	return endpoint, ok && endpoint != ""
+}
+
+// publicEndpoint returns the request's endpoint override, or PublicEndpoint without one.
+func (s *FileService) publicEndpoint(ctx context.Context) string {
+	if endpoint, ok := PublicEndpointFromContext(ctx); ok {
+		return endpoint
+	}
+	return s.PublicEndpoint
+}
+
+// SoftDeleteUserFile marks a user-file mapping as deleted (Recently Deleted). With several
+// active copies of the same content it trashes the newest; use SoftDeleteUserFileByMappingID
+// to trash a particular one.
 func (s *FileService) SoftDeleteUserFile(ctx context.Context, userID, fileID uuid.UUID) error {
 	if s == nil || s.FileRepo == nil {
-		return fmt.Errorf("file service not configured")
+		return ErrStorageUnavailable
 	}
 	// ensure mapping exists
 	if _, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID); err != nil {
 		return err
 	}
+	// The copy that would be trashed is the newest active one
+	active, err := s.FileRepo.GetUserFilesByFileIDs(ctx, userID, []uuid.UUID{fileID})
+	if err != nil {
+		return err
+	}
+	if len(active) > 0 {
+		if err := s.checkRetention(ctx, fileID, active[0].ID); err != nil {
+			return err
+		}
+	}
 	return s.FileRepo.MarkUserFileDeleted(ctx, userID, fileID)
 }
 
 // RecoverUserFile recovers a soft-deleted file
 func (s *FileService) RecoverUserFile(ctx context.Context, userID, fileID uuid.UUID) error {
 	if s == nil || s.FileRepo == nil {
-		return fmt.Errorf("file service not configured")
+		return ErrStorageUnavailable
 	}
 	// ensure a deleted mapping exists
 	// Note: We check if there's a deleted mapping by trying to get it from deleted files
@@ -404,60 +1522,240 @@ func (s *FileService) RecoverUserFile(ctx context.Context, userID, fileID uuid.U
 	return s.FileRepo.RecoverUserFile(ctx, userID, fileID)
 }
 
+// TrashRestore reports the outcome of RestoreAllTrash.
+type TrashRestore struct {
+	// Restored counts the mappings taken out of the trash
+	Restored int
+	// Skipped lists trashed files that couldn't be restored
+	Skipped []TrashRestoreSkip
+}
+
+// TrashRestoreSkip is one trashed file RestoreAllTrash left alone, and why.
+type TrashRestoreSkip struct {
+	MappingID uuid.UUID
+	FileID    uuid.UUID
+	Filename  string
+	Reason    string
+}
+
+// RestoreAllTrash takes every file out of the user's trash in one transaction. Files purged
+// while the restore ran, by the user or an admin, are skipped and reported rather than
+// failing the rest. Like RecoverUserFile it doesn't check quota.
+func (s *FileService) RestoreAllTrash(ctx context.Context, userID uuid.UUID) (*TrashRestore, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	trashed, err := s.FileRepo.GetDeletedUserFiles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &TrashRestore{Skipped: []TrashRestoreSkip{}}
+	if len(trashed) == 0 {
+		return result, nil
+	}
+	ids := make([]uuid.UUID, len(trashed))
+	for i, uf := range trashed {
+		ids[i] = uf.ID
+	}
+	restored, err := s.FileRepo.RecoverUserFilesByMappingIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[uuid.UUID]bool, len(restored))
+	for _, id := range restored {
+		done[id] = true
+	}
+	result.Restored = len(restored)
+	for _, uf := range trashed {
+		if !done[uf.ID] {
+			result.Skipped = append(result.Skipped, TrashRestoreSkip{
+				MappingID: uf.ID,
+				FileID:    uf.FileID,
+				Filename:  uf.File.OriginalName,
+				Reason:    "the file was permanently deleted before it could be restored",
+			})
+		}
+	}
+	return result, nil
+}
+
 // PurgeUserFile permanently removes the mapping and underlying object if unreferenced
 func (s *FileService) PurgeUserFile(ctx context.Context, userID, fileID uuid.UUID) error {
 	if s == nil || s.FileRepo == nil {
-		return fmt.Errorf("file service not configured")
+		return ErrStorageUnavailable
 	}
 	// ensure mapping exists (even if soft-deleted)
-	if _, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID); err != nil {
+	uf, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID)
+	if err != nil {
 		return err
 	}
-	// delete mapping
-	if err := s.FileRepo.DeleteUserFile(ctx, userID, fileID); err != nil {
-		return err
+	if uf == nil {
+		return fmt.Errorf("file %s: %w", fileID, repository.ErrNotFound)
 	}
-	// decrement refs
-	if err := s.FileRepo.DecrementRefCount(ctx, fileID); err != nil {
+	// Purging removes every trashed copy of the file, so none of them may be retained
+	trashed, err := s.FileRepo.GetDeletedUserFiles(ctx, userID)
+	if err != nil {
 		return err
 	}
-	// check file ref count
-	f, err := s.FileRepo.GetByID(ctx, fileID)
-	if err != nil {
+	var copies []uuid.UUID
+	for _, t := range trashed {
+		if t.FileID == fileID {
+			copies = append(copies, t.ID)
+		}
+	}
+	if len(copies) > 0 {
+		if err := s.checkRetention(ctx, fileID, copies...); err != nil {
+			return err
+		}
+	}
+	// delete mapping
+	if err := s.FileRepo.DeleteUserFile(ctx, userID, fileID); err != nil {
 		return err
 	}
-	if f.RefCount <= 0 {
-		// delete from object storage
-		if s.Minio == nil || s.Bucket == "" {
-			return fmt.Errorf("object storage not configured for purge")
+	return s.releaseFile(ctx, fileID)
+}
+
+// withFileLock runs fn under the file's lock, or directly when no locker is configured.
+func (s *FileService) withFileLock(ctx context.Context, fileID uuid.UUID, fn func(ctx context.Context) error) error {
+	if s.Locks == nil {
+		return fn(ctx)
+	}
+	return s.Locks.WithFileLock(ctx, fileID, fn)
+}
+
+// attachLocked runs attach under the file's lock once the file row is confirmed to still
+// exist, so a concurrent purge can't release content while a new mapping is added to it.
+func (s *FileService) attachLocked(ctx context.Context, fileID uuid.UUID, attach func(ctx context.Context) error) error {
+	return s.withFileLock(ctx, fileID, func(ctx context.Context) error {
+		if _, err := s.FileRepo.GetByID(ctx, fileID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("content was removed while it was being uploaded, try again: %w", err)
+			}
+			return err
+		}
+		return attach(ctx)
+	})
+}
+
+// releaseFile removes the object and file row once no mapping, active or
+// soft-deleted, references the file anymore. The check and the delete run under the
+// file's lock so no upload can attach to the file in between.
+func (s *FileService) releaseFile(ctx context.Context, fileID uuid.UUID) error {
+	return s.withFileLock(ctx, fileID, func(ctx context.Context) error {
+		_, total, err := s.FileRepo.CountFileMappings(ctx, fileID)
+		if err != nil {
+			return err
 		}
-		if err := s.Minio.RemoveObject(ctx, s.Bucket, f.StoragePath, minio.RemoveObjectOptions{}); err != nil {
+		if total > 0 {
+			return nil
+		}
+		f, err := s.FileRepo.GetByID(ctx, fileID)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Someone else released it first; nothing left to clean up
+			return nil
+		}
+		if err != nil {
 			return err
 		}
-		// delete file row
-		if err := s.FileRepo.DeleteFileByID(ctx, fileID); err != nil {
+		return s.deleteStoredFile(ctx, f)
+	})
+}
+
+// putObject stores content under key in the bucket. A size of -1 streams content of
+// unknown length in parts of unknownSizePartSize.
+func (s *FileService) putObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if s.objectWriter != nil {
+		return s.objectWriter(ctx, key, r, size, contentType)
+	}
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	if size < 0 {
+		size, opts.PartSize = -1, unknownSizePartSize
+	}
+	_, err := s.Minio.PutObject(ctx, s.Bucket, key, r, size, opts)
+	return err
+}
+
+// removeObject deletes the object under key from the bucket.
+func (s *FileService) removeObject(ctx context.Context, key string) error {
+	if s.objectRemover != nil {
+		return s.objectRemover(ctx, key)
+	}
+	if s.Minio == nil || s.Bucket == "" {
+		return fmt.Errorf("object storage not configured for purge")
+	}
+	return s.Minio.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+// deleteStoredFile removes the file's object and its row; mappings go with the row.
+func (s *FileService) deleteStoredFile(ctx context.Context, f *models.File) error {
+	// Remove the object under every key it may live at, so copies left by a layout change go too
+	for _, key := range objectKeyCandidates(f) {
+		if err := s.removeObject(ctx, key); err != nil {
 			return err
 		}
 	}
+	// delete file row
+	if err := s.FileRepo.DeleteFileByID(ctx, f.ID); err != nil {
+		return err
+	}
+	s.purgeCDN(ctx, f)
 	return nil
 }
 
-// SoftDeleteUserFileByMappingID marks a specific user_files row deleted
+// SoftDeleteUserFileByMappingID marks a specific user_files row deleted. Unlike
+// SoftDeleteUserFile it can't pick the wrong copy when the user keeps the same content in
+// several folders, so it is how an owner takes a file out of a shared folder: recipients
+// only ever see the owner's active mapping in the folder. An editor of a shared folder can
+// also trash the files they added to it, which moves them to the owner's trash.
 func (s *FileService) SoftDeleteUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID string) error {
 	if s == nil || s.FileRepo == nil {
-		return fmt.Errorf("file service not configured")
+		return ErrStorageUnavailable
 	}
 	mid, err := uuid.Parse(mappingID)
 	if err != nil {
 		return fmt.Errorf("invalid mapping id")
 	}
-	return rwrap(s.FileRepo.SoftDeleteUserFileByMappingID(ctx, userID, mid))
+	uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mid)
+	if err != nil {
+		return err
+	}
+	if uf == nil {
+		if uf, err = s.addedByEditor(ctx, userID, mid); err != nil {
+			return err
+		}
+	}
+	if uf == nil || uf.DeletedAt != nil {
+		return fmt.Errorf("file %s: %w", mid, repository.ErrNotFound)
+	}
+	if err := s.checkRetention(ctx, uf.FileID, mid); err != nil {
+		return err
+	}
+	return s.FileRepo.SoftDeleteUserFileByMappingID(ctx, uf.UserID, mid)
+}
+
+// addedByEditor returns the mapping userID added to someone else's shared folder, as long
+// as they still have editor access to the folder; nil when they didn't add it.
+func (s *FileService) addedByEditor(ctx context.Context, userID, mappingID uuid.UUID) (*models.UserFile, error) {
+	if s.Shares == nil {
+		return nil, nil
+	}
+	uf, err := s.FileRepo.GetUserFileAddedBy(ctx, userID, mappingID)
+	if err != nil || uf == nil {
+		return nil, err
+	}
+	if uf.FolderID == nil {
+		return nil, nil
+	}
+	if err := requireFolderEditor(ctx, s.Shares, s.Users, userID, *uf.FolderID); err != nil {
+		return nil, err
+	}
+	return uf, nil
 }
 
 // PurgeUserFileByMappingID deletes a specific mapping and adjusts file/objects if needed
 func (s *FileService) PurgeUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID string) error {
 	if s == nil || s.FileRepo == nil {
-		return fmt.Errorf("file service not configured")
+		return ErrStorageUnavailable
 	}
 	mid, err := uuid.Parse(mappingID)
 	if err != nil {
@@ -471,45 +1769,158 @@ func (s *FileService) PurgeUserFileByMappingID(ctx context.Context, userID uuid.
 	if uf == nil {
 		return fmt.Errorf("not found")
 	}
-	if err := s.FileRepo.DeleteUserFileByMappingID(ctx, userID, mid); err != nil {
+	if err := s.checkRetention(ctx, uf.FileID, mid); err != nil {
 		return err
 	}
-	if err := s.FileRepo.DecrementRefCount(ctx, uf.FileID); err != nil {
+	if err := s.FileRepo.DeleteUserFileByMappingID(ctx, userID, mid); err != nil {
 		return err
 	}
-	f, err := s.FileRepo.GetByID(ctx, uf.FileID)
-	if err != nil {
-		return err
+	return s.releaseFile(ctx, uf.FileID)
+}
+
+// GroupIntoNewFolder creates a folder and moves the user's files into it in one transaction.
+// Every mapping must be an active file of the user; if any is not, nothing is created or moved.
+//
+// Parameters:
+//   - ctx: Context for cancellation and deadlines
+//   - userID: UUID of the user grouping files
+//   - mappingIDs: The user_files mappings to move
+//   - folderName: Name of the folder to create
+//   - parentID: Folder to create the new folder in (nil for root)
+//
+// Returns:
+//   - *models.Folder: The created folder
+//   - []models.UserFile: The moved mappings, reloaded from the database
+//   - error: nil on success, or an error describing which input was rejected
+func (s *FileService) GroupIntoNewFolder(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID, folderName string, parentID *uuid.UUID) (*models.Folder, []models.UserFile, error) {
+	if s == nil || s.FileRepo == nil || s.Folders == nil {
+		return nil, nil, fmt.Errorf("folder service not configured")
+	}
+	if len(mappingIDs) == 0 {
+		return nil, nil, fmt.Errorf("no files selected")
 	}
-	if f.RefCount <= 0 {
-		if s.Minio == nil || s.Bucket == "" {
-			return fmt.Errorf("object storage not configured for purge")
+
+	// Validate every mapping up front so the caller learns which one was rejected
+	seen := make(map[uuid.UUID]bool, len(mappingIDs))
+	var ids []uuid.UUID
+	for _, id := range mappingIDs {
+		if seen[id] {
+			continue
 		}
-		if err := s.Minio.RemoveObject(ctx, s.Bucket, f.StoragePath, minio.RemoveObjectOptions{}); err != nil {
-			return err
+		seen[id] = true
+		uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, id)
+		if err != nil {
+			return nil, nil, err
 		}
-		if err := s.FileRepo.DeleteFileByID(ctx, uf.FileID); err != nil {
-			return err
+		if uf == nil {
+			return nil, nil, fmt.Errorf("file %s not found", id)
 		}
+		ids = append(ids, id)
+	}
+
+	folder, err := s.Folders.CreateFolderWithFiles(ctx, userID, folderName, parentID, ids)
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil
-}
 
-// small wrapper to normalize nil error
-func rwrap(err error) error { return err }
+	files := make([]models.UserFile, 0, len(ids))
+	for _, id := range ids {
+		uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if uf != nil {
+			files = append(files, *uf)
+		}
+	}
+	return folder, files, nil
+}
 
 // GetDeletedUserFiles lists a user's soft-deleted files
 func (s *FileService) GetDeletedUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error) {
 	if s == nil || s.FileRepo == nil {
-		return nil, fmt.Errorf("file service not configured")
+		return nil, ErrStorageUnavailable
 	}
 	return s.FileRepo.GetDeletedUserFiles(ctx, userID)
 }
 
+// Suggestion limits: callers get defaultSuggestLimit without asking and never more than
+// maxSuggestLimit, keeping type-ahead queries cheap.
+const (
+	defaultSuggestLimit = 8
+	maxSuggestLimit     = 20
+)
+
+// SuggestFilenames returns distinct names of the user's active files starting with prefix,
+// for search box type-ahead. Matching ignores case and the most recently uploaded or opened
+// names come first. A blank prefix suggests nothing; limit is clamped to maxSuggestLimit.
+func (s *FileService) SuggestFilenames(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]string, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	prefix = strings.TrimLeft(prefix, " \t")
+	if strings.TrimSpace(prefix) == "" {
+		return []string{}, nil
+	}
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	limit = min(limit, maxSuggestLimit)
+	names, err := s.FileRepo.SuggestFilenames(ctx, userID, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	if names == nil {
+		names = []string{}
+	}
+	return names, nil
+}
+
+// maxFilesByIDs bounds one GetFilesByIDs call so a single request can't ask for everything
+const maxFilesByIDs = 500
+
+// GetFilesByIDs hydrates a set of file ids, e.g. a saved collection, in one lookup. Only
+// files the user holds an active copy of are returned, in the order their ids were given;
+// unknown, trashed and other users' files are skipped, and repeated ids appear once.
+func (s *FileService) GetFilesByIDs(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]models.UserFile, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	ids := make([]uuid.UUID, 0, len(fileIDs))
+	seen := make(map[uuid.UUID]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxFilesByIDs {
+		return nil, fmt.Errorf("at most %d file ids can be fetched at once", maxFilesByIDs)
+	}
+	if len(ids) == 0 {
+		return []models.UserFile{}, nil
+	}
+	found, err := s.FileRepo.GetUserFilesByFileIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.UserFile, len(found))
+	for _, uf := range found {
+		byID[uf.FileID] = uf
+	}
+	files := make([]models.UserFile, 0, len(found))
+	for _, id := range ids {
+		if uf, ok := byID[id]; ok {
+			files = append(files, uf)
+		}
+	}
+	return files, nil
+}
+
 // SearchUserFiles wraps repository search
-func (s *FileService) SearchUserFiles(ctx context.Context, userID uuid.UUID, filter repository.SearchFilter, page repository.Page) ([]models.UserFile, *string, int, error) {
+func (s *FileService) SearchUserFiles(ctx context.Context, userID uuid.UUID, filter repository.SearchFilter, page repository.Page) ([]models.UserFile, *string, repository.SearchTotals, error) {
 	if s == nil || s.FileRepo == nil {
-		return nil, nil, 0, fmt.Errorf("file service not configured")
+		return nil, nil, repository.SearchTotals{}, ErrStorageUnavailable
 	}
 	return s.FileRepo.SearchUserFiles(ctx, userID, filter, page)
 }
@@ -1,101 +1,778 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
 )
 
 // stubFileRepo implements FileRepository methods used by tests with no DB
-type stubFileRepo struct{}
+type stubFileRepo struct {
+	// touched records file IDs passed to TouchUserFileAccess
+	touched []uuid.UUID
+	// folderFiles backs ListUserFilesInFolder, keyed by folder (uuid.Nil for root)
+	folderFiles map[uuid.UUID][]models.UserFile
+	// filesByHash backs FindByHash so uploads of known content skip object storage
+	filesByHash map[string]*models.File
+	// mappings backs the soft-delete/recover/purge methods, CountFileMappings and uploads
+	mappings []*stubMapping
+	// usage is returned by GetUserUsageSum
+	usage int64
+	// usageByUser and attributedByUser override usage per user when set
+	usageByUser      map[uuid.UUID]int64
+	attributedByUser map[uuid.UUID]int64
+	// visibility records SetUserFileVisibility calls by file
+	visibility map[uuid.UUID]string
+	// roles overrides the owner role GetUserFileByFileID reports, keyed by file
+	roles map[uuid.UUID]string
+	// statuses records SetFileStatus calls and backs the status GetByID and GetUserFileByFileID report
+	statuses map[uuid.UUID]string
+	// gone lists file rows GetByID no longer finds; unmapped lists files GetUserFileByFileID has no mapping for
+	gone     map[uuid.UUID]bool
+	unmapped map[uuid.UUID]bool
+	// names sets the original name GetUserFileByMappingID reports, keyed by file
+	names map[uuid.UUID]string
+	// mimeTypes sets the MIME type GetUserFileByFileID reports, keyed by file
+	mimeTypes map[uuid.UUID]string
+	// quotas backs GetUserQuota's overrides, keyed by user
+	quotas map[uuid.UUID]int64
+	// retained backs GetRetainedMappings, keyed by mapping
+	retained map[uuid.UUID]time.Time
+	// suggestLimits records the limit of each SuggestFilenames call
+	suggestLimits []int
+	// byIDsCalls counts GetByIDs calls
+	byIDsCalls int
+	// batchLookups records the ids of each GetUserFilesByFileIDs call
+	batchLookups [][]uuid.UUID
+	// stateLookups counts GetUserMappingStates calls
+	stateLookups int
+	// trashedFolders lists the folders stubFolderRepo has in the trash
+	trashedFolders map[uuid.UUID]bool
+	// mu guards mappings for the methods reached by concurrent uploads
+	mu sync.Mutex
+}
+
+// addMapping records a new active mapping and returns its id
+func (s *stubFileRepo) addMapping(userID, fileID uuid.UUID) uuid.UUID {
+	return s.addMappingInFolder(userID, fileID, nil)
+}
+
+func (s *stubFileRepo) addMappingInFolder(userID, fileID uuid.UUID, folderID *uuid.UUID) uuid.UUID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New()
+	s.mappings = append(s.mappings, &stubMapping{id: id, userID: userID, fileID: fileID, folderID: folderID})
+	return id
+}
+
+type stubMapping struct {
+	id, userID, fileID uuid.UUID
+	folderID           *uuid.UUID
+	deleted            bool
+	description        string
+	// displayName is set by SetUserFileDisplayName and shown instead of the content's name
+	displayName string
+	// addedBy is the editor MarkUserFilesAddedBy recorded for the mapping
+	addedBy uuid.UUID
+	// role is set by TransferFileOwnership; empty means owner
+	role string
+	// visibility is set by SetUserFileVisibility and SetUserFileMappingVisibility
+	visibility string
+}
+
+// mapping finds the newest mapping for user and file in the given deleted state
+func (s *stubFileRepo) mapping(userID, fileID uuid.UUID, deleted bool) *stubMapping {
+	for i := len(s.mappings) - 1; i >= 0; i-- {
+		m := s.mappings[i]
+		if m.userID == userID && m.fileID == fileID && m.deleted == deleted {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *stubFileRepo) removeMapping(target *stubMapping) {
+	for i, m := range s.mappings {
+		if m == target {
+			s.mappings = append(s.mappings[:i], s.mappings[i+1:]...)
+			return
+		}
+	}
+}
 
 func (s *stubFileRepo) FindByHash(ctx context.Context, hash string) (*models.File, error) {
-	return nil, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filesByHash[hash], nil
+}
+func (s *stubFileRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.File, error) {
+	s.byIDsCalls++
+	var out []models.File
+	for _, id := range ids {
+		if f, err := s.GetByID(ctx, id); err == nil {
+			out = append(out, *f)
+		}
+	}
+	return out, nil
 }
 func (s *stubFileRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.File, error) {
-	return &models.File{ID: id}, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gone[id] {
+		return nil, fmt.Errorf("file %s: %w", id, repository.ErrNotFound)
+	}
+	f := &models.File{ID: id, StoragePath: "files/" + id.String()}
+	if stored := s.storedFile(id); stored != nil {
+		copied := *stored
+		f = &copied
+	}
+	if status, ok := s.statuses[id]; ok || f.Status == "" {
+		f.Status = status
+	}
+	return f, nil
+}
+
+// storedFile finds content recorded by CreateFile by its id; callers hold mu
+func (s *stubFileRepo) storedFile(id uuid.UUID) *models.File {
+	for _, f := range s.filesByHash {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// CreateFile records new content in filesByHash so later uploads of it dedup
+func (s *stubFileRepo) CreateFile(ctx context.Context, file *models.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filesByHash == nil {
+		s.filesByHash = map[string]*models.File{}
+	}
+	s.filesByHash[file.Hash] = file
+	return nil
+}
+func (s *stubFileRepo) CountFileMappings(ctx context.Context, fileID uuid.UUID) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active, total := 0, 0
+	for _, m := range s.mappings {
+		if m.fileID != fileID {
+			continue
+		}
+		total++
+		if !m.deleted {
+			active++
+		}
+	}
+	return active, total, nil
 }
-func (s *stubFileRepo) CreateFile(ctx context.Context, file *models.File) error       { return nil }
-func (s *stubFileRepo) IncrementRefCount(ctx context.Context, fileID uuid.UUID) error { return nil }
-func (s *stubFileRepo) DecrementRefCount(ctx context.Context, fileID uuid.UUID) error { return nil }
 func (s *stubFileRepo) AddUserFile(ctx context.Context, userID, fileID uuid.UUID, role string) (bool, error) {
+	if s.restoreMapping(userID, fileID, nil, false) {
+		return true, nil
+	}
+	s.addMapping(userID, fileID)
 	return true, nil
 }
 func (s *stubFileRepo) AddUserFileWithFolder(ctx context.Context, userID, fileID uuid.UUID, role string, folderID *uuid.UUID) (bool, error) {
+	if s.restoreMapping(userID, fileID, folderID, true) {
+		return true, nil
+	}
+	s.addMappingInFolder(userID, fileID, folderID)
 	return true, nil
 }
+
+// restoreMapping brings back the user's newest trashed mapping of the file, as AddUserFile
+// and AddUserFileWithFolder do; only the latter moves it into folderID, while the former
+// keeps its folder unless that folder is in the trash
+func (s *stubFileRepo) restoreMapping(userID, fileID uuid.UUID, folderID *uuid.UUID, move bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.mappings) - 1; i >= 0; i-- {
+		if m := s.mappings[i]; m.userID == userID && m.fileID == fileID && m.deleted {
+			m.deleted = false
+			if move {
+				m.folderID = folderID
+			} else if m.folderID != nil && s.trashedFolders[*m.folderID] {
+				m.folderID = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserFiles lists the user's active mappings, uploaded one second apart in the order added
 func (s *stubFileRepo) GetUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error) {
-	return nil, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.UserFile
+	for i, m := range s.mappings {
+		if m.userID == userID && !m.deleted {
+			out = append(out, models.UserFile{ID: m.id, UserID: userID, FileID: m.fileID, UploadedAt: time.Unix(int64(i), 0), File: models.File{ID: m.fileID}})
+		}
+	}
+	return out, nil
 }
 func (s *stubFileRepo) DeleteUserFile(ctx context.Context, userID, fileID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.mapping(userID, fileID, true); m != nil {
+		s.removeMapping(m)
+	}
 	return nil
 }
+func (s *stubFileRepo) GetUserQuota(ctx context.Context, userID uuid.UUID) (*int64, error) {
+	if q, ok := s.quotas[userID]; ok {
+		return &q, nil
+	}
+	return nil, nil
+}
 func (s *stubFileRepo) GetUserUsageSum(ctx context.Context, userID uuid.UUID) (int64, error) {
-	return 0, nil
+	if v, ok := s.usageByUser[userID]; ok {
+		return v, nil
+	}
+	return s.usage, nil
 }
 func (s *stubFileRepo) GetUserAttributedUsage(ctx context.Context, userID uuid.UUID) (int64, error) {
-	return 0, nil
+	return s.attributedByUser[userID], nil
+}
+func (s *stubFileRepo) GetUserUsageTotals(ctx context.Context, userID uuid.UUID) (repository.UsageTotals, error) {
+	used, _ := s.GetUserUsageSum(ctx, userID)
+	quota, _ := s.GetUserQuota(ctx, userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, m := range s.mappings {
+		if m.userID == userID && !m.deleted {
+			count++
+		}
+	}
+	return repository.UsageTotals{LogicalBytes: used, AttributedBytes: s.attributedByUser[userID], FileCount: count, QuotaOverride: quota}, nil
 }
 func (s *stubFileRepo) FindUserFileByHash(ctx context.Context, userID uuid.UUID, hash string) (*models.UserFile, error) {
+	f := s.filesByHash[hash]
+	if f == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.userID == userID && m.fileID == f.ID && !m.deleted {
+			uf := &models.UserFile{ID: m.id, UserID: userID, FileID: f.ID, FolderID: m.folderID, File: *f}
+			if m.displayName != "" {
+				uf.File.OriginalName = m.displayName
+			}
+			return uf, nil
+		}
+	}
 	return nil, nil
 }
 func (s *stubFileRepo) GetUserFileByFileID(ctx context.Context, userID, fileID uuid.UUID) (*models.UserFile, error) {
-	return &models.UserFile{UserID: userID, FileID: fileID, File: models.File{ID: fileID}}, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unmapped[fileID] {
+		return nil, nil
+	}
+	role := "owner"
+	if r, ok := s.roles[fileID]; ok {
+		role = r
+	}
+	uf := &models.UserFile{UserID: userID, FileID: fileID, Role: role, File: models.File{ID: fileID, OriginalName: s.names[fileID], StoragePath: "files/" + fileID.String(), Visibility: s.visibility[fileID], Status: s.statuses[fileID], MimeType: s.mimeTypes[fileID]}}
+	if m := s.mapping(userID, fileID, false); m != nil {
+		uf.FolderID = m.folderID
+	}
+	for hash, f := range s.filesByHash {
+		if f.ID == fileID {
+			uf.File.Hash, uf.File.Size = hash, f.Size
+		}
+	}
+	return uf, nil
 }
 func (s *stubFileRepo) GetOwnerByFileID(ctx context.Context, fileID uuid.UUID) (*models.UserFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The first mapping created for a file is its owner
+	for _, m := range s.mappings {
+		if m.fileID == fileID {
+			return &models.UserFile{ID: m.id, UserID: m.userID, FileID: fileID, Role: "owner"}, nil
+		}
+	}
 	return nil, nil
 }
 func (s *stubFileRepo) MarkUserFileDeleted(ctx context.Context, userID, fileID uuid.UUID) error {
+	if m := s.mapping(userID, fileID, false); m != nil {
+		m.deleted = true
+	}
 	return nil
 }
 func (s *stubFileRepo) RecoverUserFile(ctx context.Context, userID, fileID uuid.UUID) error {
+	if m := s.mapping(userID, fileID, true); m != nil {
+		m.deleted = false
+	}
 	return nil
 }
+func (s *stubFileRepo) RecoverUserFilesByMappingIDs(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var restored []uuid.UUID
+	for _, id := range mappingIDs {
+		for _, m := range s.mappings {
+			if m.id == id && m.userID == userID && m.deleted && !s.gone[m.fileID] {
+				m.deleted = false
+				restored = append(restored, id)
+			}
+		}
+	}
+	return restored, nil
+}
 func (s *stubFileRepo) GetDeletedUserFiles(ctx context.Context, userID uuid.UUID) ([]models.UserFile, error) {
-	return nil, nil
+	var out []models.UserFile
+	for _, m := range s.mappings {
+		if m.userID == userID && m.deleted {
+			uf := models.UserFile{ID: m.id, UserID: userID, FileID: m.fileID}
+			for _, f := range s.filesByHash {
+				if f.ID == m.fileID {
+					uf.File = *f
+				}
+			}
+			out = append(out, uf)
+		}
+	}
+	return out, nil
+}
+func (s *stubFileRepo) GetDeletedUserFilesTotals(ctx context.Context, userID uuid.UUID) (int, int64, error) {
+	trash, _ := s.GetDeletedUserFiles(ctx, userID)
+	var bytes int64
+	for _, uf := range trash {
+		bytes += uf.File.Size
+	}
+	return len(trash), bytes, nil
+}
+func (s *stubFileRepo) DeleteFileByID(ctx context.Context, fileID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gone == nil {
+		s.gone = map[uuid.UUID]bool{}
+	}
+	s.gone[fileID] = true
+	return nil
 }
-func (s *stubFileRepo) DeleteFileByID(ctx context.Context, fileID uuid.UUID) error { return nil }
 func (s *stubFileRepo) GetUserFileMappingStatus(ctx context.Context, userID, fileID uuid.UUID) (string, error) {
-	return "none", nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := "none"
+	for _, m := range s.mappings {
+		if m.userID == userID && m.fileID == fileID {
+			if !m.deleted {
+				return "active", nil
+			}
+			status = "deleted"
+		}
+	}
+	return status, nil
 }
 func (s *stubFileRepo) UserHasActiveMapping(ctx context.Context, userID, fileID uuid.UUID) (bool, error) {
 	return false, nil
 }
 func (s *stubFileRepo) CreateUserFileMapping(ctx context.Context, userID, fileID uuid.UUID, role string) (uuid.UUID, error) {
-	return uuid.New(), nil
+	return s.addMapping(userID, fileID), nil
 }
 func (s *stubFileRepo) CreateUserFileMappingWithFolder(ctx context.Context, userID, fileID uuid.UUID, role string, folderID *uuid.UUID) (uuid.UUID, error) {
-	return uuid.New(), nil
+	return s.addMappingInFolder(userID, fileID, folderID), nil
+}
+func (s *stubFileRepo) SetUserFileDescription(ctx context.Context, userID, mappingID uuid.UUID, description *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID && !m.deleted {
+			m.description = ""
+			if description != nil {
+				m.description = *description
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+}
+func (s *stubFileRepo) SetUserFileDisplayName(ctx context.Context, userID, mappingID uuid.UUID, name *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID {
+			m.displayName = ""
+			if name != nil {
+				m.displayName = *name
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+}
+func (s *stubFileRepo) SetUserFileRetention(ctx context.Context, mappingID uuid.UUID, until *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID {
+			if s.retained == nil {
+				s.retained = map[uuid.UUID]time.Time{}
+			}
+			if until == nil {
+				delete(s.retained, mappingID)
+			} else {
+				s.retained[mappingID] = *until
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+}
+func (s *stubFileRepo) GetRetainedMappings(ctx context.Context, fileID uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[uuid.UUID]time.Time{}
+	for _, m := range s.mappings {
+		if until, ok := s.retained[m.id]; ok && m.fileID == fileID && until.After(time.Now()) {
+			out[m.id] = until
+		}
+	}
+	return out, nil
+}
+func (s *stubFileRepo) GetUserFilesByFileIDs(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]models.UserFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchLookups = append(s.batchLookups, fileIDs)
+	var files []models.UserFile
+	for _, id := range fileIDs {
+		if m := s.mapping(userID, id, false); m != nil {
+			uf := models.UserFile{ID: m.id, UserID: userID, FileID: id, FolderID: m.folderID, Role: m.role,
+				File: models.File{ID: id, OriginalName: s.names[id]}}
+			if m.displayName != "" {
+				uf.File.OriginalName = m.displayName
+			}
+			files = append(files, uf)
+		}
+	}
+	return files, nil
 }
 func (s *stubFileRepo) GetUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) (*models.UserFile, error) {
-	return &models.UserFile{ID: mappingID, UserID: userID}, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID {
+			role := "owner"
+			if r, ok := s.roles[m.fileID]; ok {
+				role = r
+			}
+			uf := &models.UserFile{ID: mappingID, UserID: userID, FileID: m.fileID, FolderID: m.folderID, Description: m.description, Role: role,
+				File: models.File{ID: m.fileID, OriginalName: s.names[m.fileID], Status: s.statuses[m.fileID]}}
+			if m.displayName != "" {
+				uf.File.OriginalName = m.displayName
+			}
+			if m.deleted {
+				now := time.Now()
+				uf.DeletedAt = &now
+			}
+			return uf, nil
+		}
+	}
+	return nil, nil
 }
 func (s *stubFileRepo) SoftDeleteUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) error {
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID {
+			m.deleted = true
+		}
+	}
+	return nil
+}
+func (s *stubFileRepo) MarkUserFilesAddedBy(ctx context.Context, ownerID uuid.UUID, mappingIDs []uuid.UUID, folderID, addedBy uuid.UUID, since time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		for _, id := range mappingIDs {
+			if m.id == id && m.userID == ownerID && m.folderID != nil && *m.folderID == folderID {
+				m.addedBy = addedBy
+			}
+		}
+	}
+	return nil
+}
+func (s *stubFileRepo) GetUserFileAddedBy(ctx context.Context, addedBy, mappingID uuid.UUID) (*models.UserFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.addedBy == addedBy {
+			uf := &models.UserFile{ID: m.id, UserID: m.userID, FileID: m.fileID, FolderID: m.folderID}
+			if m.deleted {
+				now := time.Now()
+				uf.DeletedAt = &now
+			}
+			return uf, nil
+		}
+	}
+	return nil, nil
+}
+func (s *stubFileRepo) TransferFileOwnership(ctx context.Context, fromUserID, toUserID uuid.UUID, toEmail string, fileID uuid.UUID, keepAsEditor bool, quota int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var previous, recipient []*stubMapping
+	retained, owned := false, false
+	for _, m := range s.mappings {
+		switch {
+		case m.fileID != fileID || m.deleted:
+		case m.userID == fromUserID && m.role == "":
+			previous = append(previous, m)
+			retained = retained || s.retained[m.id].After(time.Now())
+		case m.userID == toUserID:
+			recipient = append(recipient, m)
+			owned = owned || m.role == ""
+		}
+	}
+	if len(previous) == 0 {
+		return fmt.Errorf("file %s: %w", fileID, repository.ErrNotFound)
+	}
+	if retained && !keepAsEditor {
+		return fmt.Errorf("file %s: %w", fileID, repository.ErrRetained)
+	}
+	if quota >= 0 && !owned {
+		used := s.usage
+		if v, ok := s.usageByUser[toUserID]; ok {
+			used = v
+		}
+		var size int64
+		if f := s.storedFile(fileID); f != nil {
+			size = f.Size
+		}
+		if used+size > quota {
+			return fmt.Errorf("file %s: %w", fileID, repository.ErrOverQuota)
+		}
+	}
+	promoted := len(recipient) > 0
+	for _, m := range recipient {
+		m.role = ""
+	}
+	if !promoted {
+		s.mappings = append(s.mappings, &stubMapping{id: uuid.New(), userID: toUserID, fileID: fileID})
+	}
+	for _, m := range previous {
+		if keepAsEditor {
+			m.role = "editor"
+		} else {
+			s.removeMapping(m)
+		}
+	}
 	return nil
 }
 func (s *stubFileRepo) DeleteUserFileByMappingID(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID) error {
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID {
+			s.removeMapping(m)
+			break
+		}
+	}
 	return nil
 }
-func (s *stubFileRepo) SearchUserFiles(ctx context.Context, userID uuid.UUID, filter repository.SearchFilter, page repository.Page) ([]models.UserFile, *string, int, error) {
-	return nil, nil, 0, nil
+
+// SearchUserFiles ignores the filter: it pages through the user's active mappings, newest
+// first, with the repository's default page size
+func (s *stubFileRepo) SearchUserFiles(ctx context.Context, userID uuid.UUID, filter repository.SearchFilter, page repository.Page) ([]models.UserFile, *string, repository.SearchTotals, error) {
+	all, _ := s.GetUserFiles(ctx, userID)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].UploadedAt.After(all[j].UploadedAt) })
+	limit := 50
+	if page.Limit > 0 {
+		limit = page.Limit
+	}
+	totals := repository.SearchTotals{Count: len(all)}
+	if len(all) <= limit {
+		return all, nil, totals, nil
+	}
+	cursor := repository.FileCursor(all[limit-1], page.Sort)
+	return all[:limit], &cursor, totals, nil
+}
+func (s *stubFileRepo) SuggestFilenames(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]string, error) {
+	s.suggestLimits = append(s.suggestLimits, limit)
+	var names []string
+	seen := map[string]bool{}
+	// Newest mapping first, standing in for recency
+	for i := len(s.mappings) - 1; i >= 0 && len(names) < limit; i-- {
+		m := s.mappings[i]
+		name := s.names[m.fileID]
+		if m.userID != userID || m.deleted || seen[name] || !strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
 }
-func (s *stubFileRepo) ListUserFilesInFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) ([]models.UserFile, error) {
-	return nil, nil
+func (s *stubFileRepo) ListUserFilesInFolder(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID, sort repository.FileSort) ([]models.UserFile, error) {
+	key := uuid.Nil
+	if folderID != nil {
+		key = *folderID
+	}
+	return s.folderFiles[key], nil
 }
 func (s *stubFileRepo) MoveUserFileToFolder(ctx context.Context, userID uuid.UUID, mappingID uuid.UUID, folderID *uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID {
+			m.folderID = folderID
+		}
+	}
+	return nil
+}
+func (s *stubFileRepo) GetUserMappingStates(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stateLookups++
+	states := map[uuid.UUID]bool{}
+	for _, id := range mappingIDs {
+		for _, m := range s.mappings {
+			if m.id == id && m.userID == userID {
+				states[id] = !m.deleted
+			}
+		}
+	}
+	return states, nil
+}
+func (s *stubFileRepo) MoveUserFiles(ctx context.Context, userID uuid.UUID, moves map[uuid.UUID]*uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	moving := map[*stubMapping]*uuid.UUID{}
+	for id, folderID := range moves {
+		for _, m := range s.mappings {
+			if m.id == id && m.userID == userID && !m.deleted {
+				moving[m] = folderID
+			}
+		}
+	}
+	if len(moving) != len(moves) {
+		return repository.ErrMappingsNotMoved
+	}
+	for m, folderID := range moving {
+		m.folderID = folderID
+	}
+	return nil
+}
+func (s *stubFileRepo) SetUserFileVisibility(ctx context.Context, userID, fileID uuid.UUID, visibility string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visibility == nil {
+		s.visibility = map[uuid.UUID]string{}
+	}
+	s.visibility[fileID] = visibility
+	for _, m := range s.mappings {
+		if m.userID == userID && m.fileID == fileID && !m.deleted && m.role == "" {
+			m.visibility = visibility
+		}
+	}
+	return nil
+}
+func (s *stubFileRepo) SetUserFileMappingVisibility(ctx context.Context, userID, mappingID uuid.UUID, visibility string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.id == mappingID && m.userID == userID {
+			m.visibility = visibility
+			return nil
+		}
+	}
+	return fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+}
+func (s *stubFileRepo) SetFileStatus(ctx context.Context, fileID uuid.UUID, status, reason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.statuses == nil {
+		s.statuses = map[uuid.UUID]string{}
+	}
+	s.statuses[fileID] = status
+	return true, nil
+}
+func (s *stubFileRepo) ReplaceFileObject(ctx context.Context, fileID uuid.UUID, oldPath, storagePath, keyID string, nonce []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.storedFile(fileID)
+	if f == nil || s.gone[fileID] || f.StoragePath != oldPath {
+		return false, nil
+	}
+	f.StoragePath, f.EncryptionKeyID, f.EncryptionNonce = storagePath, keyID, nonce
+	return true, nil
+}
+func (s *stubFileRepo) ListFilesNotUnderKey(ctx context.Context, keyID string, limit int) ([]models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.File
+	for _, f := range s.filesByHash {
+		if f.EncryptionKeyID != keyID && len(out) < limit {
+			out = append(out, *f)
+		}
+	}
+	return out, nil
+}
+func (s *stubFileRepo) ListQuarantinedFiles(ctx context.Context) ([]models.UserFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.UserFile
+	for id, status := range s.statuses {
+		if status == models.FileStatusQuarantined {
+			out = append(out, models.UserFile{FileID: id, Role: "owner", File: models.File{ID: id, Status: status}})
+		}
+	}
+	return out, nil
+}
+func (s *stubFileRepo) TouchUserFileAccess(ctx context.Context, userID, fileID uuid.UUID) error {
+	s.touched = append(s.touched, fileID)
 	return nil
 }
 
 func TestFileService_UploadFiles_Unconfigured(t *testing.T) {
 	fs := &FileService{}
-	_, err := fs.UploadFiles(context.Background(), uuid.New(), []*graphql.Upload{})
-	if err == nil {
-		t.Fatalf("expected error when storage not configured")
+	_, _, err := fs.UploadFiles(context.Background(), uuid.New(), []*graphql.Upload{}, "", false)
+	if !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("expected error when storage not configured, got %v", err)
+	}
+}
+
+func TestFileService_NilService_StorageUnavailable(t *testing.T) {
+	var fs *FileService
+	ctx := context.Background()
+	user, id := uuid.New(), uuid.New()
+	for name, call := range map[string]func() error{
+		"upload": func() error { _, _, err := fs.UploadFiles(ctx, user, nil, "", false); return err },
+		"list":   func() error { _, err := fs.GetUserFiles(ctx, user); return err },
+		"url":    func() error { _, err := fs.GetFileURL(ctx, user, id, false); return err },
+		"delete": func() error { return fs.SoftDeleteUserFile(ctx, user, id) },
+		"purge":  func() error { return fs.PurgeUserFile(ctx, user, id) },
+		"search": func() error {
+			_, _, _, err := fs.SearchUserFiles(ctx, user, repository.SearchFilter{}, repository.Page{})
+			return err
+		},
+		"zip":     func() error { _, _, err := fs.SelectZipFiles(ctx, user, []uuid.UUID{id}); return err },
+		"trashed": func() error { _, err := fs.GetDeletedUserFiles(ctx, user); return err },
+	} {
+		if err := call(); !errors.Is(err, ErrStorageUnavailable) {
+			t.Fatalf("%s: expected ErrStorageUnavailable, got %v", name, err)
+		}
 	}
 }
 
@@ -106,6 +783,45 @@ func TestFileService_GetUserUsage_NotConfigured(t *testing.T) {
 	}
 }
 
+func TestFileService_GetUsageBreakdown(t *testing.T) {
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{
+		usageByUser:      map[uuid.UUID]int64{userID: 10000, otherID: 500},
+		attributedByUser: map[uuid.UUID]int64{userID: 6000, otherID: 800},
+		quotas:           map[uuid.UUID]int64{userID: 50000},
+	}
+	repo.addMapping(userID, uuid.New())
+	repo.addMapping(userID, uuid.New())
+	repo.addMapping(userID, uuid.New())
+	repo.mappings[2].deleted = true
+	fs := NewFileService(repo, nil, "", "")
+
+	got, err := fs.GetUsageBreakdown(ctx, userID)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := UsageBreakdown{LogicalBytes: 10000, AttributedBytes: 6000, QuotaBytes: 50000, FileCount: 2, DedupSavedBytes: 4000}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if p := got.DedupSavedPercent(); p != 40 {
+		t.Fatalf("expected 40%% saved, got %v", p)
+	}
+
+	// The default quota applies without an override, and savings never go negative
+	other, err := fs.GetUsageBreakdown(ctx, otherID)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if other.QuotaBytes != defaultQuotaBytes || other.DedupSavedBytes != 0 || other.FileCount != 0 {
+		t.Fatalf("expected default quota, no savings and no files, got %+v", other)
+	}
+	if _, err := (&FileService{}).GetUsageBreakdown(ctx, userID); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("expected ErrStorageUnavailable, got %v", err)
+	}
+}
+
 func TestFileService_GetFileURL_NotConfigured(t *testing.T) {
 	fs := &FileService{FileRepo: &stubFileRepo{}}
 	_, err := fs.GetFileURL(context.Background(), uuid.New(), uuid.New(), true)
@@ -114,9 +830,1703 @@ func TestFileService_GetFileURL_NotConfigured(t *testing.T) {
 	}
 }
 
-func TestFileService_NewService_Constructs(t *testing.T) {
-	fs := NewFileService(&stubFileRepo{}, &minio.Client{}, "bucket", "http://localhost:9000")
-	if fs == nil || fs.Bucket != "bucket" {
-		t.Fatalf("expected new file service with bucket set")
+func TestFileService_GetFileURL_TouchesLastAccess(t *testing.T) {
+	// A fixed region lets minio presign without contacting the server
+	client, err := minio.New("localhost:9000", &minio.Options{Creds: credentials.NewStaticV4("key", "secret", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, client, "bucket", "")
+	fileID := uuid.New()
+	if _, err := fs.GetFileURL(context.Background(), uuid.New(), fileID, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.touched) != 1 || repo.touched[0] != fileID {
+		t.Fatalf("expected last access to be stamped for %s, got %v", fileID, repo.touched)
+	}
+}
+
+func TestFileService_GetFileURL_PublicEndpoint(t *testing.T) {
+	client, err := minio.New("localhost:9000", &minio.Options{Creds: credentials.NewStaticV4("key", "secret", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	fs := NewFileService(&stubFileRepo{}, client, "bucket", "https://files.example.com")
+	hostOf := func(ctx context.Context) string {
+		raw, err := fs.GetFileURL(ctx, uuid.New(), uuid.New(), false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("bad url %q: %v", raw, err)
+		}
+		return u.Scheme + "://" + u.Host
+	}
+
+	if got := hostOf(context.Background()); got != "https://files.example.com" {
+		t.Fatalf("expected default public endpoint, got %s", got)
+	}
+	ctx := WithPublicEndpoint(context.Background(), "http://minio.internal:9000")
+	if got := hostOf(ctx); got != "http://minio.internal:9000" {
+		t.Fatalf("expected request override, got %s", got)
+	}
+	if got := hostOf(WithPublicEndpoint(context.Background(), "")); got != "https://files.example.com" {
+		t.Fatalf("expected empty override to keep the default, got %s", got)
+	}
+
+	fs.PublicEndpoint = ""
+	if got := hostOf(context.Background()); got != "http://localhost:9000" {
+		t.Fatalf("expected the minio endpoint without a public one, got %s", got)
+	}
+}
+
+func TestFileService_GetFileURL_DownloadName(t *testing.T) {
+	client, err := minio.New("localhost:9000", &minio.Options{Creds: credentials.NewStaticV4("key", "secret", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	userID, fileID, folderID := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{names: map[uuid.UUID]string{fileID: "report.pdf"}}
+	repo.addMappingInFolder(userID, fileID, &folderID)
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{uuid.Nil: {{ID: folderID, Name: "Invoices"}}}}
+	fs := NewFileService(repo, client, "bucket", "")
+	fs.Folders = NewFolderService(&stubFolderRepo{share: share, files: repo}, repo)
+	disposition := func() string {
+		raw, err := fs.GetFileURL(context.Background(), userID, fileID, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("bad url %q: %v", raw, err)
+		}
+		return u.Query().Get("response-content-disposition")
+	}
+
+	if got := disposition(); got != `attachment; filename="report.pdf"` {
+		t.Fatalf("expected the original name by default, got %s", got)
+	}
+	fs.DownloadName = "{folder} - {original}"
+	if got := disposition(); got != `attachment; filename="Invoices - report.pdf"` {
+		t.Fatalf("expected the folder prefix, got %s", got)
+	}
+}
+
+func TestFileService_GetFileURLByHash(t *testing.T) {
+	client, err := minio.New("localhost:9000", &minio.Options{Creds: credentials.NewStaticV4("key", "secret", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	owner := uuid.New()
+	hash := hashOf("quarterly numbers")
+	file := &models.File{ID: uuid.New(), Hash: hash, OriginalName: "q3.xlsx", StoragePath: "files/" + hash}
+	repo := &stubFileRepo{filesByHash: map[string]*models.File{hash: file}}
+	repo.addMapping(owner, file.ID)
+	fs := NewFileService(repo, client, "bucket", "")
+	ctx := context.Background()
+
+	raw, err := fs.GetFileURLByHash(ctx, owner, " "+strings.ToUpper(hash)+" ", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasSuffix(u.Path, "/bucket/files/"+hash) {
+		t.Fatalf("expected a URL for the stored object, got %q (%v)", raw, err)
+	}
+	if got := u.Query().Get("response-content-disposition"); got != `inline; filename="q3.xlsx"` {
+		t.Fatalf("expected the mapping's file name, got %s", got)
+	}
+	if len(repo.touched) != 1 || repo.touched[0] != file.ID {
+		t.Fatalf("expected last access to be stamped for %s, got %v", file.ID, repo.touched)
+	}
+}
+
+func TestFileService_GetFileURLByHash_Unauthorized(t *testing.T) {
+	client, err := minio.New("localhost:9000", &minio.Options{Creds: credentials.NewStaticV4("key", "secret", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	owner, other := uuid.New(), uuid.New()
+	hash := hashOf("private notes")
+	file := &models.File{ID: uuid.New(), Hash: hash}
+	repo := &stubFileRepo{filesByHash: map[string]*models.File{hash: file}}
+	repo.addMapping(owner, file.ID)
+	fs := NewFileService(repo, client, "bucket", "")
+	ctx := context.Background()
+
+	// The content exists, but only for someone else
+	if _, err := fs.GetFileURLByHash(ctx, other, hash, false); err == nil {
+		t.Fatalf("expected a user without a mapping to be rejected")
+	}
+	if _, err := fs.GetFileURLByHash(ctx, owner, hashOf("never uploaded"), false); err == nil {
+		t.Fatalf("expected an unknown hash to be rejected")
+	}
+	for _, bad := range []string{"", "abc", strings.Repeat("z", 64), hash + "00"} {
+		if _, err := fs.GetFileURLByHash(ctx, owner, bad, false); err == nil || !strings.Contains(err.Error(), "invalid content hash") {
+			t.Fatalf("hash %q: expected it to be rejected as invalid, got %v", bad, err)
+		}
+	}
+
+	// Trashed copies don't grant access
+	repo.mapping(owner, file.ID, false).deleted = true
+	if _, err := fs.GetFileURLByHash(ctx, owner, hash, false); err == nil {
+		t.Fatalf("expected a trashed mapping to be rejected")
+	}
+	if len(repo.touched) != 0 {
+		t.Fatalf("expected no access to be stamped, got %v", repo.touched)
+	}
+}
+
+func TestFileService_SetDescription(t *testing.T) {
+	userID, otherID, fileID := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	mine := repo.addMapping(userID, fileID)
+	theirs := repo.addMapping(otherID, fileID)
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	ctx := context.Background()
+
+	uf, err := fs.SetDescription(ctx, userID, mine, " Signed copy, original is in the safe ")
+	if err != nil || uf.Description != "Signed copy, original is in the safe" {
+		t.Fatalf("expected trimmed description, got %+v (%v)", uf, err)
+	}
+	// Each user's copy of shared content keeps its own note
+	if other, _ := repo.GetUserFileByMappingID(ctx, otherID, theirs); other.Description != "" {
+		t.Fatalf("expected other users' copies to be untouched, got %q", other.Description)
+	}
+
+	if uf, err = fs.SetDescription(ctx, userID, mine, ""); err != nil || uf.Description != "" {
+		t.Fatalf("expected empty description to clear it, got %+v (%v)", uf, err)
+	}
+
+	if _, err := fs.SetDescription(ctx, userID, mine, strings.Repeat("x", MaxDescriptionLength+1)); err == nil {
+		t.Fatalf("expected overlong description to be rejected")
+	}
+	if _, err := fs.SetDescription(ctx, userID, mine, strings.Repeat("x", MaxDescriptionLength)); err != nil {
+		t.Fatalf("expected description at the limit to be accepted, got %v", err)
+	}
+
+	if _, err := fs.SetDescription(ctx, otherID, mine, "not yours"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected another user's mapping to be not found, got %v", err)
+	}
+	repo.mapping(userID, fileID, false).deleted = true
+	if _, err := fs.SetDescription(ctx, userID, mine, "in the trash"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected a trashed mapping to be not found, got %v", err)
+	}
+}
+
+func TestFileService_SuggestFilenames(t *testing.T) {
+	userID := uuid.New()
+	repo := &stubFileRepo{names: map[uuid.UUID]string{}}
+	add := func(owner uuid.UUID, name string) uuid.UUID {
+		fileID := uuid.New()
+		repo.names[fileID] = name
+		repo.addMapping(owner, fileID)
+		return fileID
+	}
+	add(userID, "Report-2023.pdf")
+	add(userID, "notes.txt")
+	add(userID, "report-2024.pdf")
+	add(userID, "report-2024.pdf")
+	trashed := add(userID, "report-old.pdf")
+	repo.mapping(userID, trashed, false).deleted = true
+	add(uuid.New(), "report-other-user.pdf")
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	ctx := context.Background()
+
+	names, err := fs.SuggestFilenames(ctx, userID, "REP", 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(names) != 2 || names[0] != "report-2024.pdf" || names[1] != "Report-2023.pdf" {
+		t.Fatalf("expected distinct active matches, newest first, got %v", names)
+	}
+	if names, _ := fs.SuggestFilenames(ctx, userID, "report-2023", 0); len(names) != 1 {
+		t.Fatalf("expected a longer prefix to narrow suggestions, got %v", names)
+	}
+	if names, _ := fs.SuggestFilenames(ctx, userID, "zzz", 0); names == nil || len(names) != 0 {
+		t.Fatalf("expected an empty, non-nil list without matches, got %#v", names)
+	}
+}
+
+func TestFileService_SuggestFilenames_Limit(t *testing.T) {
+	userID := uuid.New()
+	repo := &stubFileRepo{names: map[uuid.UUID]string{}}
+	for i := 0; i < 30; i++ {
+		fileID := uuid.New()
+		repo.names[fileID] = fmt.Sprintf("photo-%02d.jpg", i)
+		repo.addMapping(userID, fileID)
+	}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	ctx := context.Background()
+
+	if names, _ := fs.SuggestFilenames(ctx, userID, "photo", 3); len(names) != 3 || names[0] != "photo-29.jpg" {
+		t.Fatalf("expected the 3 newest names, got %v", names)
+	}
+	if names, _ := fs.SuggestFilenames(ctx, userID, "photo", 0); len(names) != defaultSuggestLimit {
+		t.Fatalf("expected the default limit of %d, got %d", defaultSuggestLimit, len(names))
+	}
+	if names, _ := fs.SuggestFilenames(ctx, userID, "photo", 1000); len(names) != maxSuggestLimit {
+		t.Fatalf("expected the limit to be capped at %d, got %d", maxSuggestLimit, len(names))
+	}
+
+	// Blank prefixes never reach the repository
+	calls := len(repo.suggestLimits)
+	for _, prefix := range []string{"", "   "} {
+		if names, err := fs.SuggestFilenames(ctx, userID, prefix, 5); err != nil || len(names) != 0 {
+			t.Fatalf("prefix %q: expected no suggestions, got %v (%v)", prefix, names, err)
+		}
+	}
+	if len(repo.suggestLimits) != calls {
+		t.Fatalf("expected blank prefixes to skip the query")
+	}
+}
+
+// folderUploadService wires a file service to folders backed by share's subfolder tree
+func folderUploadService(repo *stubFileRepo, share *stubShareRepo) (*FileService, *stubFolderRepo) {
+	folders := &stubFolderRepo{share: share, files: repo}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.Folders = NewFolderService(folders, repo)
+	return fs, folders
+}
+
+// mappedFolders returns the folder of each of the user's mappings
+func mappedFolders(repo *stubFileRepo, userID uuid.UUID) []*uuid.UUID {
+	var out []*uuid.UUID
+	for _, m := range repo.mappings {
+		if m.userID == userID {
+			out = append(out, m.folderID)
+		}
+	}
+	return out
+}
+
+func TestFileService_UploadIntoNewFolder_CreatesFolder(t *testing.T) {
+	userID, parent := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	uploads := knownUploads(repo, 2, 64)
+	// The second file has no content and fails on its own
+	uploads = append(uploads, &graphql.Upload{Filename: "broken.txt"})
+	fs, folders := folderUploadService(repo, &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{}})
+
+	folder, files, failures, err := fs.UploadIntoNewFolder(context.Background(), userID, " photos ", &parent, uploads, "")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 2 || len(failures) != 1 || failures[0].Index != 2 || failures[0].Filename != "broken.txt" {
+		t.Fatalf("expected two stored files and the broken one reported, got %d files %+v", len(files), failures)
+	}
+	mapped := mappedFolders(repo, userID)
+	if len(mapped) != 2 {
+		t.Fatalf("expected two mappings, got %d", len(mapped))
+	}
+	for _, f := range mapped {
+		if f == nil || *f != folder.ID {
+			t.Fatalf("expected every file in the new folder %s, got %v", folder.ID, f)
+		}
+	}
+	if len(folders.deleted) != 0 {
+		t.Fatalf("expected the folder to be kept, got %v removed", folders.deleted)
+	}
+}
+
+func TestFileService_UploadIntoNewFolder_ReusesExistingFolder(t *testing.T) {
+	userID, existing := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	uploads := knownUploads(repo, 1, 64)
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		uuid.Nil: {{ID: existing, UserID: userID, Name: "photos"}},
+	}}
+	fs, folders := folderUploadService(repo, share)
+
+	folder, files, failures, err := fs.UploadIntoNewFolder(context.Background(), userID, "photos", nil, uploads, "")
+	if err != nil || len(files) != 1 || len(failures) != 0 {
+		t.Fatalf("expected the file to be stored, got %d files %v (%v)", len(files), failures, err)
+	}
+	if folder.ID != existing {
+		t.Fatalf("expected the existing folder %s to be reused, got %s", existing, folder.ID)
+	}
+	if mapped := mappedFolders(repo, userID); len(mapped) != 1 || mapped[0] == nil || *mapped[0] != existing {
+		t.Fatalf("expected the file in the existing folder, got %v", mapped)
+	}
+
+	// A failed upload never removes a folder it didn't create
+	if _, _, _, err := fs.UploadIntoNewFolder(context.Background(), userID, "photos", nil, []*graphql.Upload{{Filename: "broken.txt"}}, ""); err == nil {
+		t.Fatalf("expected an error when no file could be stored")
+	}
+	if len(folders.deleted) != 0 {
+		t.Fatalf("expected the existing folder to be kept, got %v removed", folders.deleted)
+	}
+}
+
+func TestFileService_UploadIntoNewFolder_AllFailRemovesFolder(t *testing.T) {
+	repo := &stubFileRepo{}
+	fs, folders := folderUploadService(repo, &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{}})
+
+	folder, _, failures, err := fs.UploadIntoNewFolder(context.Background(), uuid.New(), "photos", nil, []*graphql.Upload{{Filename: "broken.txt"}}, "")
+	if err == nil || folder != nil || len(failures) != 1 {
+		t.Fatalf("expected the upload to fail with its failure reported, got %v %v (%v)", folder, failures, err)
+	}
+	if len(folders.deleted) != 1 {
+		t.Fatalf("expected the new empty folder to be removed, got %v", folders.deleted)
+	}
+}
+
+func TestFileService_UploadFiles_TooManyFiles(t *testing.T) {
+	fs := NewFileService(&stubFileRepo{}, &minio.Client{}, "bucket", "")
+	fs.MaxFilesPerUpload = 2
+	uploads := []*graphql.Upload{
+		{Filename: "a.txt", File: strings.NewReader("a")},
+		{Filename: "b.txt", File: strings.NewReader("b")},
+		{Filename: "c.txt", File: strings.NewReader("c")},
+	}
+	_, _, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", false)
+	if err == nil || !strings.Contains(err.Error(), "too many files") {
+		t.Fatalf("expected too many files error, got %v", err)
+	}
+}
+
+// mixedUploads returns a stored-content text file, a png whose content is plain text,
+// and a second stored-content file; the middle one fails MIME validation.
+func mixedUploads(t *testing.T) (*stubFileRepo, []*graphql.Upload) {
+	t.Helper()
+	content := "hello"
+	sum := sha256.Sum256([]byte(content))
+	hash := fmt.Sprintf("%x", sum[:])
+	repo := &stubFileRepo{filesByHash: map[string]*models.File{
+		hash: {ID: uuid.New(), Hash: hash, StoragePath: "files/" + hash},
+	}}
+	uploads := []*graphql.Upload{
+		{Filename: "a.txt", File: strings.NewReader(content)},
+		{Filename: "b.png", File: strings.NewReader("not an image")},
+		{Filename: "c.txt", File: strings.NewReader(content)},
+	}
+	return repo, uploads
+}
+
+func TestFileService_UploadFiles_BestEffortKeepsSuccesses(t *testing.T) {
+	repo, uploads := mixedUploads(t)
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 stored files, got %d", len(files))
+	}
+	if len(failures) != 1 || failures[0].Index != 1 || failures[0].Filename != "b.png" {
+		t.Fatalf("expected b.png at index 1 to fail, got %+v", failures)
+	}
+}
+
+func TestFileService_UploadFiles_AllOrNothingStopsOnFailure(t *testing.T) {
+	repo, uploads := mixedUploads(t)
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", false)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected mime mismatch error, got %v", err)
+	}
+	if files != nil || failures != nil {
+		t.Fatalf("expected no results on failure, got %d files, %d failures", len(files), len(failures))
+	}
+}
+
+func TestFileService_PurgeEligibility_SoftDeleteRecoverPurge(t *testing.T) {
+	ctx := context.Background()
+	alice, bob, fileID := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{mappings: []*stubMapping{
+		{id: uuid.New(), userID: alice, fileID: fileID},
+		{id: uuid.New(), userID: bob, fileID: fileID},
+	}}
+	// No object storage: reaching the object delete surfaces as an error
+	fs := NewFileService(repo, nil, "", "")
+
+	if err := fs.SoftDeleteUserFile(ctx, alice, fileID); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if active, _, _ := repo.CountFileMappings(ctx, fileID); active != 1 {
+		t.Fatalf("expected 1 active mapping after soft delete, got %d", active)
+	}
+	if err := fs.RecoverUserFile(ctx, alice, fileID); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if active, _, _ := repo.CountFileMappings(ctx, fileID); active != 2 {
+		t.Fatalf("expected 2 active mappings after recover, got %d", active)
+	}
+
+	// Both users trash the file: no active mappings, but the object stays for recovery
+	if err := fs.SoftDeleteUserFile(ctx, alice, fileID); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if err := fs.SoftDeleteUserFile(ctx, bob, fileID); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if active, total, _ := repo.CountFileMappings(ctx, fileID); active != 0 || total != 2 {
+		t.Fatalf("expected 0 active of 2 mappings, got %d of %d", active, total)
+	}
+
+	// Purging one trashed mapping keeps the object while the other remains recoverable
+	if err := fs.PurgeUserFile(ctx, alice, fileID); err != nil {
+		t.Fatalf("purge with remaining mapping: %v", err)
+	}
+	if len(repo.mappings) != 1 {
+		t.Fatalf("expected 1 mapping left, got %d", len(repo.mappings))
+	}
+
+	// Purging the last mapping releases the object
+	err := fs.PurgeUserFile(ctx, bob, fileID)
+	if err == nil || !strings.Contains(err.Error(), "object storage not configured") {
+		t.Fatalf("expected object removal to be attempted, got %v", err)
+	}
+}
+
+func TestFileService_PurgeEligibility_ByMappingID(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	first, second := uuid.New(), uuid.New()
+	repo := &stubFileRepo{mappings: []*stubMapping{
+		{id: first, userID: userID, fileID: fileID},
+		{id: second, userID: userID, fileID: fileID},
+	}}
+	fs := NewFileService(repo, nil, "", "")
+
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, userID, first.String()); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	// The other active mapping keeps the object: purge must not reach object storage
+	if err := fs.PurgeUserFileByMappingID(ctx, userID, first.String()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if active, total, _ := repo.CountFileMappings(ctx, fileID); active != 1 || total != 1 {
+		t.Fatalf("expected only the active mapping left, got %d of %d", active, total)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, userID, second.String()); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	err := fs.PurgeUserFileByMappingID(ctx, userID, second.String())
+	if err == nil || !strings.Contains(err.Error(), "object storage not configured") {
+		t.Fatalf("expected object removal to be attempted, got %v", err)
+	}
+}
+
+// knownUploads builds n distinct uploads of size bytes whose content already exists
+// in the files table, so they exercise quota and mapping without object storage.
+func knownUploads(repo *stubFileRepo, n, size int) []*graphql.Upload {
+	if repo.filesByHash == nil {
+		repo.filesByHash = map[string]*models.File{}
+	}
+	var uploads []*graphql.Upload
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("%0*d", size, i)
+		sum := sha256.Sum256([]byte(content))
+		hash := fmt.Sprintf("%x", sum[:])
+		repo.filesByHash[hash] = &models.File{ID: uuid.New(), Hash: hash, Size: int64(size)}
+		uploads = append(uploads, &graphql.Upload{Filename: fmt.Sprintf("f%d.txt", i), File: strings.NewReader(content)})
+	}
+	return uploads
+}
+
+func TestFileService_UploadFilesToFolder_FolderQuota(t *testing.T) {
+	const size = 64
+	ctx := context.Background()
+	userID, project, full := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	fs, folders := folderUploadService(repo, &stubShareRepo{})
+	folders.quotas = map[uuid.UUID][]repository.FolderQuotaUsage{
+		// Room for two of the three files
+		project: {{FolderID: project, FolderName: "Project", QuotaBytes: 1000, UsedBytes: 1000 - 2*size}},
+		// A subfolder with room of its own, under a parent that is already at capacity
+		full: {
+			{FolderID: full, FolderName: "Drafts", QuotaBytes: 1 << 20},
+			{FolderID: uuid.New(), FolderName: "Archive", QuotaBytes: 500, UsedBytes: 500},
+		},
+	}
+
+	files, failures, err := fs.UploadFilesToFolder(ctx, userID, &project, knownUploads(repo, 3, size), "", true, UploadOrder{}, NameConflictAllow)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 2 || len(failures) != 1 {
+		t.Fatalf("expected two files stored and one over the folder quota, got %d stored, %+v", len(files), failures)
+	}
+	if err := failures[0].Err; !errors.Is(err, ErrFolderQuotaExceeded) || !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), `"Project"`) {
+		t.Fatalf("expected a folder quota error naming the folder, got %v", err)
+	}
+
+	_, _, err = fs.UploadFilesToFolder(ctx, userID, &full, knownUploads(repo, 1, size), "", false, UploadOrder{}, NameConflictAllow)
+	if !errors.Is(err, ErrFolderQuotaExceeded) || !strings.Contains(err.Error(), `"Archive"`) {
+		t.Fatalf("expected the full ancestor to refuse the upload, got %v", err)
+	}
+}
+
+func TestFileService_UploadFilesToFolder_NoFolderQuota(t *testing.T) {
+	ctx := context.Background()
+	userID, folder := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	fs, _ := folderUploadService(repo, &stubShareRepo{})
+
+	files, failures, err := fs.UploadFilesToFolder(ctx, userID, &folder, knownUploads(repo, 3, 64), "", true, UploadOrder{}, NameConflictAllow)
+	if err != nil || len(files) != 3 || len(failures) != 0 {
+		t.Fatalf("expected every file stored without a folder quota, got %d stored, %+v (%v)", len(files), failures, err)
+	}
+}
+
+func TestFileService_UploadFilesToFolder_Editor(t *testing.T) {
+	ctx := context.Background()
+	owner, editor, viewer, folder := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	shares := &stubShareRepo{folderOwners: map[uuid.UUID]uuid.UUID{folder: owner}}
+	shares.setPermission(folder, "editor@example.com", "editor")
+	shares.setPermission(folder, "viewer@example.com", "viewer")
+	fs, folders := folderUploadService(repo, shares)
+	folders.owners = map[uuid.UUID]uuid.UUID{folder: owner}
+	fs.Shares = shares
+	fs.Users = &stubUserRepo{emails: map[string]string{editor.String(): "editor@example.com", viewer.String(): "viewer@example.com"}}
+
+	if _, _, err := fs.UploadFilesToFolder(ctx, viewer, &folder, knownUploads(repo, 1, 64), "", false, UploadOrder{}, NameConflictAllow); !errors.Is(err, ErrNotEditor) {
+		t.Fatalf("expected a viewer refused, got %v", err)
+	}
+	files, _, err := fs.UploadFilesToFolder(ctx, editor, &folder, knownUploads(repo, 1, 64), "", false, UploadOrder{}, NameConflictAllow)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected the editor's upload stored, got %d files (%v)", len(files), err)
+	}
+	added := repo.mappings[len(repo.mappings)-1]
+	if added.userID != owner || added.folderID == nil || *added.folderID != folder || added.addedBy != editor {
+		t.Fatalf("expected the owner's copy in the folder added by the editor, got %+v", added)
+	}
+
+	ownersFile, _, err := fs.UploadFilesToFolder(ctx, owner, &folder, knownUploads(repo, 1, 64), "", false, UploadOrder{}, NameConflictAllow)
+	if err != nil {
+		t.Fatalf("owner upload: %v", err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, editor, ownersFile[0].ID.String()); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected the editor unable to trash the owner's file, got %v", err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, viewer, added.id.String()); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected a viewer unable to trash the editor's file, got %v", err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, editor, added.id.String()); err != nil || !added.deleted {
+		t.Fatalf("expected the editor to trash the file they added (%v)", err)
+	}
+}
+
+func TestFileService_UploadFilesToFolder_EditorLeavesOwnersCopies(t *testing.T) {
+	ctx := context.Background()
+	owner, editor, folder := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	shares := &stubShareRepo{folderOwners: map[uuid.UUID]uuid.UUID{folder: owner}}
+	shares.setPermission(folder, "editor@example.com", "editor")
+	fs, folders := folderUploadService(repo, shares)
+	folders.owners = map[uuid.UUID]uuid.UUID{folder: owner}
+	fs.Shares = shares
+	fs.Users = &stubUserRepo{emails: map[string]string{editor.String(): "editor@example.com"}}
+
+	// The owner keeps the first content privately and has the second in the trash
+	uploads := knownUploads(repo, 2, 64)
+	var fileIDs []uuid.UUID
+	for _, up := range uploads {
+		content, _ := io.ReadAll(up.File)
+		up.File = bytes.NewReader(content)
+		fileIDs = append(fileIDs, repo.filesByHash[fmt.Sprintf("%x", sha256.Sum256(content))].ID)
+	}
+	private := &stubMapping{id: uuid.New(), userID: owner, fileID: fileIDs[0], visibility: models.VisibilityPrivate}
+	trashed := &stubMapping{id: uuid.New(), userID: owner, fileID: fileIDs[1], visibility: models.VisibilityPrivate, deleted: true}
+	repo.mappings = []*stubMapping{private, trashed}
+
+	files, _, err := fs.UploadFilesToFolder(ctx, editor, &folder, uploads, models.VisibilityPublic, false, UploadOrder{}, NameConflictAllow)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected both files stored, got %d (%v)", len(files), err)
+	}
+	if private.visibility != models.VisibilityPrivate || private.folderID != nil {
+		t.Fatalf("expected the owner's private copy untouched, got %+v", private)
+	}
+	if !trashed.deleted || trashed.folderID != nil {
+		t.Fatalf("expected the owner's trashed copy left in the trash, got %+v", trashed)
+	}
+	for _, m := range repo.mappings[2:] {
+		if m.userID != owner || m.folderID == nil || *m.folderID != folder || m.visibility != models.VisibilityPrivate || m.addedBy != editor {
+			t.Fatalf("expected a new private copy in the folder added by the editor, got %+v", m)
+		}
+	}
+	if len(repo.mappings) != 4 {
+		t.Fatalf("expected two new mappings, got %d in all", len(repo.mappings))
+	}
+}
+
+func TestFileService_UploadFiles_ReuploadLeavesTrashedFolder(t *testing.T) {
+	owner, docs := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	uploads := knownUploads(repo, 1, 64)
+	fileID := repo.filesByHash[hashOf(fmt.Sprintf("%0*d", 64, 0))].ID
+	inDocs := &stubMapping{id: uuid.New(), userID: owner, fileID: fileID, folderID: &docs}
+	repo.mappings = []*stubMapping{inDocs}
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{uuid.Nil: {{ID: docs, UserID: owner, Name: "docs"}}}}
+	fs, _ := folderUploadService(repo, share)
+	ctx := context.Background()
+
+	if err := fs.Folders.DeleteFolderRecursive(ctx, owner, docs); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fs.UploadFiles(ctx, owner, uploads, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.mappings) != 1 || inDocs.deleted || inDocs.folderID != nil {
+		t.Fatalf("expected the trashed copy restored at the root, got %d mappings, deleted=%v folder=%v", len(repo.mappings), inDocs.deleted, inDocs.folderID)
+	}
+}
+
+func TestFileService_UploadFiles_ConcurrentQuotaAndRefs(t *testing.T) {
+	const size = 1024
+	// Room for exactly three of the five files
+	repo := &stubFileRepo{usage: defaultQuotaBytes - 3*size}
+	uploads := knownUploads(repo, 5, size)
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.UploadConcurrency = 5
+
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 3 || len(failures) != 2 {
+		t.Fatalf("expected 3 stored and 2 over quota, got %d and %d", len(files), len(failures))
+	}
+	for _, f := range failures {
+		if !strings.Contains(f.Err.Error(), "quota exceeded") {
+			t.Fatalf("expected quota failure, got %v", f.Err)
+		}
+	}
+	for _, f := range files {
+		if active, _, _ := repo.CountFileMappings(context.Background(), f.FileID); active != 1 {
+			t.Fatalf("expected one reference for %s, got %d", f.FileID, active)
+		}
+	}
+}
+
+func TestFileService_UploadFiles_ConcurrentDuplicatesChargeQuotaOnce(t *testing.T) {
+	const size = 1024
+	// Room for one copy: the second must dedupe against the first instead of charging again
+	repo := &stubFileRepo{usage: defaultQuotaBytes - size}
+	uploads := knownUploads(repo, 1, size)
+	content := fmt.Sprintf("%0*d", size, 0)
+	uploads = append(uploads, &graphql.Upload{Filename: "copy.txt", File: strings.NewReader(content)})
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.UploadConcurrency = 2
+
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("expected both copies stored, got err %v failures %+v", err, failures)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 mappings, got %d", len(files))
+	}
+	if active, _, _ := repo.CountFileMappings(context.Background(), files[0].FileID); active != 2 {
+		t.Fatalf("expected 2 references to the shared file, got %d", active)
+	}
+}
+
+// sizedUploads returns uploads of stored content with the given sizes, declared on each upload.
+func sizedUploads(repo *stubFileRepo, sizes ...int) []*graphql.Upload {
+	if repo.filesByHash == nil {
+		repo.filesByHash = map[string]*models.File{}
+	}
+	var uploads []*graphql.Upload
+	for i, size := range sizes {
+		content := fmt.Sprintf("%d:%s", i, strings.Repeat("x", size-len(fmt.Sprint(i))-1))
+		hash := hashOf(content)
+		repo.filesByHash[hash] = &models.File{ID: uuid.New(), Hash: hash, Size: int64(size)}
+		uploads = append(uploads, &graphql.Upload{Filename: fmt.Sprintf("f%d.txt", i), File: strings.NewReader(content), Size: int64(size)})
+	}
+	return uploads
+}
+
+// failedIndexes checks every failure is over quota and returns their indexes.
+func failedIndexes(t *testing.T, failures []UploadFailure) []int {
+	t.Helper()
+	var idx []int
+	for _, f := range failures {
+		if !errors.Is(f.Err, ErrQuotaExceeded) {
+			t.Fatalf("expected quota failure for %s, got %v", f.Filename, f.Err)
+		}
+		idx = append(idx, f.Index)
+	}
+	return idx
+}
+
+func TestFileService_UploadFilesOrdered_SmallestFirst(t *testing.T) {
+	// Room for 3000 bytes: submission order would store the large file and little else
+	sizes := []int{3000, 1000, 2000, 1000, 1000}
+	for run := 0; run < 20; run++ {
+		repo := &stubFileRepo{usage: defaultQuotaBytes - 3000}
+		fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+		fs.UploadConcurrency = 5
+
+		files, failures, err := fs.UploadFilesOrdered(context.Background(), uuid.New(), sizedUploads(repo, sizes...), "", true, UploadOrder{SmallestFirst: true}, NameConflictAllow)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(files) != 3 {
+			t.Fatalf("expected the three small files to fit, got %d", len(files))
+		}
+		if idx := failedIndexes(t, failures); len(idx) != 2 || idx[0] != 0 || idx[1] != 2 {
+			t.Fatalf("expected the two largest files to fail, got %v", idx)
+		}
+	}
+}
+
+func TestFileService_UploadFilesOrdered_Priority(t *testing.T) {
+	sizes := []int{1000, 1000, 1000, 1000, 1000}
+	for run := 0; run < 20; run++ {
+		repo := &stubFileRepo{usage: defaultQuotaBytes - 2000}
+		fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+		fs.UploadConcurrency = 5
+
+		order := UploadOrder{Priority: []int{5, 1, 4, 3, 1}}
+		files, failures, err := fs.UploadFilesOrdered(context.Background(), uuid.New(), sizedUploads(repo, sizes...), "", true, order, NameConflictAllow)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(files) != 2 {
+			t.Fatalf("expected the two top-priority files to be stored, got %d", len(files))
+		}
+		if idx := failedIndexes(t, failures); len(idx) != 3 || idx[0] != 0 || idx[1] != 2 || idx[2] != 3 {
+			t.Fatalf("expected the lower-priority files to fail, got %v", idx)
+		}
+	}
+}
+
+func TestFileService_UploadFilesOrdered_Invalid(t *testing.T) {
+	fs := NewFileService(&stubFileRepo{}, &minio.Client{}, "bucket", "")
+	ctx := context.Background()
+	uploads := sizedUploads(&stubFileRepo{}, 10, 20)
+
+	if _, _, err := fs.UploadFilesOrdered(ctx, uuid.New(), uploads, "", true, UploadOrder{Priority: []int{1}}, NameConflictAllow); err == nil {
+		t.Fatalf("expected a short priority list to be rejected")
+	}
+	both := UploadOrder{SmallestFirst: true, Priority: []int{1, 2}}
+	if _, _, err := fs.UploadFilesOrdered(ctx, uuid.New(), uploads, "", true, both, NameConflictAllow); err == nil {
+		t.Fatalf("expected smallest-first with a priority list to be rejected")
+	}
+}
+
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("%x", sum[:])
+}
+
+func TestFileService_CheckQuotaForUpload_Mixed(t *testing.T) {
+	const size = 1024
+	ctx := context.Background()
+	userID := uuid.New()
+	// Room for two new files
+	repo := &stubFileRepo{usage: defaultQuotaBytes - 2*size}
+	known := hashOf("mapped")
+	trashed := hashOf("trashed")
+	stored := hashOf("someone else's")
+	repo.filesByHash = map[string]*models.File{
+		known:   {ID: uuid.New(), Hash: known, Size: size},
+		trashed: {ID: uuid.New(), Hash: trashed, Size: size},
+		stored:  {ID: uuid.New(), Hash: stored, Size: size},
+	}
+	repo.addMapping(userID, repo.filesByHash[known].ID)
+	repo.mappings = append(repo.mappings, &stubMapping{id: uuid.New(), userID: userID, fileID: repo.filesByHash[trashed].ID, deleted: true})
+	fs := NewFileService(repo, nil, "", "")
+
+	newA, newB := hashOf("a"), hashOf("b")
+	sizes := []int64{size, size, size, size, size, size}
+	hashes := []string{known, newA, stored, trashed, newA, newB}
+	check, err := fs.CheckQuotaForUpload(ctx, userID, sizes, hashes)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := []struct{ dedup, fits bool }{
+		{true, true},   // already mapped
+		{false, true},  // new, takes half the room
+		{false, true},  // stored by another user still counts against this user's quota
+		{true, true},   // in trash, recovered for free
+		{true, true},   // repeats the earlier new file
+		{false, false}, // no room left
+	}
+	for i, w := range want {
+		if got := check.Files[i]; got.Deduplicated != w.dedup || got.Fits != w.fits {
+			t.Fatalf("file %d: expected dedup=%v fits=%v, got %+v", i, w.dedup, w.fits, got)
+		}
+	}
+	if check.FitCount != 5 || check.RemainingBytes != 2*size || check.RemainingAfterBytes != 0 {
+		t.Fatalf("unexpected totals: %+v", check)
+	}
+	if len(repo.mappings) != 2 {
+		t.Fatalf("dry run must not create mappings, got %d", len(repo.mappings))
+	}
+}
+
+func TestFileService_CheckQuotaForUpload_InvalidInput(t *testing.T) {
+	fs := NewFileService(&stubFileRepo{}, nil, "", "")
+	ctx := context.Background()
+	if _, err := fs.CheckQuotaForUpload(ctx, uuid.New(), []int64{1, 2}, []string{hashOf("a")}); err == nil {
+		t.Fatalf("expected error for mismatched lengths")
+	}
+	if _, err := fs.CheckQuotaForUpload(ctx, uuid.New(), []int64{1}, []string{"abc"}); err == nil {
+		t.Fatalf("expected error for malformed hash")
+	}
+	if _, err := fs.CheckQuotaForUpload(ctx, uuid.New(), []int64{-1}, []string{hashOf("a")}); err == nil {
+		t.Fatalf("expected error for negative size")
+	}
+}
+
+func TestFileService_GroupIntoNewFolder_MovesFiles(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	files := &stubFileRepo{}
+	a := files.addMapping(userID, uuid.New())
+	b := files.addMapping(userID, uuid.New())
+	folders := &stubFolderRepo{files: files}
+	fs := NewFileService(files, nil, "", "")
+	fs.Folders = NewFolderService(folders, files)
+	parent := uuid.New()
+
+	folder, moved, err := fs.GroupIntoNewFolder(ctx, userID, []uuid.UUID{a, b, a}, " Trip ", &parent)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if folder.Name != "Trip" || folder.ParentID == nil || *folder.ParentID != parent {
+		t.Fatalf("unexpected folder: %+v", folder)
+	}
+	if len(moved) != 2 {
+		t.Fatalf("expected 2 moved files, got %d", len(moved))
+	}
+	for _, uf := range moved {
+		if uf.FolderID == nil || *uf.FolderID != folder.ID {
+			t.Fatalf("mapping %s not moved into %s", uf.ID, folder.ID)
+		}
+	}
+}
+
+func TestFileService_GroupIntoNewFolder_RejectsForeignMapping(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	files := &stubFileRepo{}
+	mine := files.addMapping(userID, uuid.New())
+	theirs := files.addMapping(uuid.New(), uuid.New())
+	folders := &stubFolderRepo{files: files}
+	fs := NewFileService(files, nil, "", "")
+	fs.Folders = NewFolderService(folders, files)
+
+	if _, _, err := fs.GroupIntoNewFolder(ctx, userID, []uuid.UUID{mine, theirs}, "Trip", nil); err == nil {
+		t.Fatalf("expected error for another user's mapping")
+	}
+	if len(folders.created) != 0 {
+		t.Fatalf("expected no folder created, got %d", len(folders.created))
+	}
+	if uf, _ := files.GetUserFileByMappingID(ctx, userID, mine); uf.FolderID != nil {
+		t.Fatalf("expected valid mapping left in place, got folder %s", *uf.FolderID)
+	}
+}
+
+func TestFileService_MoveFile(t *testing.T) {
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+	mine, theirs := uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	mapping := files.addMapping(userID, uuid.New())
+	folders := &stubFolderRepo{files: files, owners: map[uuid.UUID]uuid.UUID{mine: userID, theirs: otherID}}
+	fs := NewFileService(files, nil, "", "")
+	fs.Folders = NewFolderService(folders, files)
+
+	uf, err := fs.MoveFile(ctx, userID, mapping.String(), &mine)
+	if err != nil {
+		t.Fatalf("move into own folder: %v", err)
+	}
+	if uf.FolderID == nil || *uf.FolderID != mine {
+		t.Fatalf("expected reloaded mapping in folder %s, got %v", mine, uf.FolderID)
+	}
+
+	if _, err := fs.MoveFile(ctx, userID, mapping.String(), &theirs); err == nil {
+		t.Fatalf("expected another user's folder to be rejected")
+	}
+	if uf, _ := files.GetUserFileByMappingID(ctx, userID, mapping); uf.FolderID == nil || *uf.FolderID != mine {
+		t.Fatalf("expected mapping left in %s after rejected move, got %v", mine, uf.FolderID)
+	}
+	if _, err := fs.MoveFile(ctx, otherID, mapping.String(), nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another user's mapping, got %v", err)
+	}
+
+	uf, err = fs.MoveFile(ctx, userID, mapping.String(), nil)
+	if err != nil {
+		t.Fatalf("move to root: %v", err)
+	}
+	if uf.FolderID != nil {
+		t.Fatalf("expected mapping at the root, got folder %s", *uf.FolderID)
+	}
+}
+
+func TestFileService_GroupIntoNewFolder_TrashedMappingRollsBack(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	files := &stubFileRepo{}
+	mine := files.addMapping(userID, uuid.New())
+	trashed := files.addMapping(userID, uuid.New())
+	files.mappings[1].deleted = true
+	folders := &stubFolderRepo{files: files}
+	fs := NewFileService(files, nil, "", "")
+	fs.Folders = NewFolderService(folders, files)
+
+	_, _, err := fs.GroupIntoNewFolder(ctx, userID, []uuid.UUID{mine, trashed}, "Trip", nil)
+	if !errors.Is(err, repository.ErrMappingsNotMoved) {
+		t.Fatalf("expected ErrMappingsNotMoved, got %v", err)
+	}
+	if uf, _ := files.GetUserFileByMappingID(ctx, userID, mine); uf.FolderID != nil {
+		t.Fatalf("expected no mapping moved")
+	}
+}
+
+func TestFileService_NewService_Constructs(t *testing.T) {
+	fs := NewFileService(&stubFileRepo{}, &minio.Client{}, "bucket", "http://localhost:9000")
+	if fs == nil || fs.Bucket != "bucket" {
+		t.Fatalf("expected new file service with bucket set")
+	}
+}
+
+func TestFileService_UploadFiles_Visibility(t *testing.T) {
+	repo, uploads := mixedUploads(t)
+	uploads = []*graphql.Upload{uploads[0]}
+	fileID := repo.filesByHash[fmt.Sprintf("%x", sha256.Sum256([]byte("hello")))].ID
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	ctx := context.Background()
+
+	if _, _, err := fs.UploadFiles(ctx, uuid.New(), uploads, "", false); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := repo.visibility[fileID]; got != models.VisibilityPrivate {
+		t.Fatalf("expected uploads to be private without a default, got %q", got)
+	}
+
+	fs.DefaultVisibility = models.VisibilityShared
+	uploads[0].File = strings.NewReader("hello")
+	if _, _, err := fs.UploadFiles(ctx, uuid.New(), uploads, "", false); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := repo.visibility[fileID]; got != models.VisibilityShared {
+		t.Fatalf("expected configured default to apply, got %q", got)
+	}
+
+	uploads[0].File = strings.NewReader("hello")
+	if _, _, err := fs.UploadFiles(ctx, uuid.New(), uploads, "public", false); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := repo.visibility[fileID]; got != models.VisibilityPublic {
+		t.Fatalf("expected per-upload override to win, got %q", got)
+	}
+
+	uploads[0].File = strings.NewReader("hello")
+	if _, _, err := fs.UploadFiles(ctx, uuid.New(), uploads, "everyone", false); err == nil {
+		t.Fatalf("expected unknown visibility to be rejected")
+	}
+}
+
+func TestFileService_MoveFilesBatch(t *testing.T) {
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+	target, theirFolder := uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	first := files.addMapping(userID, uuid.New())
+	theirs := files.addMapping(otherID, uuid.New())
+	folders := &stubFolderRepo{files: files, owners: map[uuid.UUID]uuid.UUID{target: userID, theirFolder: otherID}}
+	fs := NewFileService(files, nil, "", "")
+	fs.Folders = NewFolderService(folders, files)
+
+	if _, err := fs.MoveFilesBatch(ctx, userID, []string{first.String(), "not-a-uuid"}, &target); err == nil {
+		t.Fatalf("expected a malformed id to be rejected")
+	}
+	if _, err := fs.MoveFilesBatch(ctx, userID, []string{first.String()}, &theirFolder); err == nil {
+		t.Fatalf("expected another user's folder to be rejected")
+	}
+	if files.mappings[0].folderID != nil {
+		t.Fatalf("expected nothing moved by rejected batches")
+	}
+
+	results, err := fs.MoveFilesBatch(ctx, userID, []string{first.String(), theirs.String(), first.String()}, &target)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(results) != 2 || !results[0].Moved || results[1].Moved || results[1].Error == "" {
+		t.Fatalf("expected only the user's own file moved, got %+v", results)
+	}
+	if *files.mappings[0].folderID != target || files.mappings[1].folderID != nil {
+		t.Fatalf("expected the user's file in %s and the other left in place", target)
+	}
+}
+
+func TestFileService_SetFileVisibility(t *testing.T) {
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, nil, "", "")
+	ctx := context.Background()
+	fileID := uuid.New()
+
+	uf, err := fs.SetFileVisibility(ctx, uuid.New(), fileID, " Public ")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if uf.File.Visibility != models.VisibilityPublic || repo.visibility[fileID] != models.VisibilityPublic {
+		t.Fatalf("expected file to be public, got %q", uf.File.Visibility)
+	}
+
+	for _, v := range []string{"", "everyone"} {
+		if _, err := fs.SetFileVisibility(ctx, uuid.New(), fileID, v); err == nil {
+			t.Fatalf("expected visibility %q to be rejected", v)
+		}
+	}
+
+	repo.roles = map[uuid.UUID]string{fileID: "viewer"}
+	if _, err := fs.SetFileVisibility(ctx, uuid.New(), fileID, models.VisibilityPrivate); err == nil {
+		t.Fatalf("expected a viewer to be unable to change visibility")
+	}
+	if repo.visibility[fileID] != models.VisibilityPublic {
+		t.Fatalf("expected visibility to be unchanged, got %q", repo.visibility[fileID])
+	}
+}
+
+// flagScanner flags every upload
+type flagScanner struct{}
+
+func (flagScanner) Scan(ctx context.Context, filename string, content io.Reader) (bool, string, error) {
+	return true, "test signature", nil
+}
+
+func TestFileService_UploadFiles_FlaggedContent(t *testing.T) {
+	repo, uploads := mixedUploads(t)
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.Scanner = flagScanner{}
+
+	if _, _, err := fs.UploadFiles(context.Background(), uuid.New(), uploads[:1], "", false); err == nil || !strings.Contains(err.Error(), "test signature") {
+		t.Fatalf("expected flagged upload to be rejected, got %v", err)
+	}
+	if len(repo.mappings) != 0 || len(repo.statuses) != 0 {
+		t.Fatalf("expected rejected upload to leave no trace, got %d mappings, %v", len(repo.mappings), repo.statuses)
+	}
+
+	fs.QuarantineFlagged = true
+	retry := []*graphql.Upload{{Filename: "a.txt", File: strings.NewReader("hello")}}
+	files, _, err := fs.UploadFiles(context.Background(), uuid.New(), retry, "", false)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected flagged upload to be stored, got %d files (%v)", len(files), err)
+	}
+	if repo.statuses[files[0].FileID] != models.FileStatusQuarantined {
+		t.Fatalf("expected flagged content to be quarantined, got %v", repo.statuses)
+	}
+}
+
+// patternScanner flags content containing pattern; err fails every scan and block waits
+// for the scan's context to end
+type patternScanner struct {
+	pattern []byte
+	err     error
+	block   bool
+}
+
+func (p patternScanner) Scan(ctx context.Context, filename string, content io.Reader) (bool, string, error) {
+	if p.block {
+		<-ctx.Done()
+		return false, "", ctx.Err()
+	}
+	if p.err != nil {
+		return false, "", p.err
+	}
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return false, "", err
+	}
+	if bytes.Contains(b, p.pattern) {
+		return true, "Test.Pattern", nil
+	}
+	return false, "", nil
+}
+
+func TestFileService_UploadFiles_ScannerRejects(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	var puts int
+	fs.objectWriter = func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+		puts++
+		return nil
+	}
+	fs.Scanner = patternScanner{pattern: []byte("X5O!P%@AP")}
+	uploads := []*graphql.Upload{
+		{Filename: "clean.txt", File: strings.NewReader("nothing to see here")},
+		{Filename: "eicar.txt", File: strings.NewReader("prefix X5O!P%@AP suffix")},
+	}
+
+	files, failures, err := fs.UploadFiles(ctx, uuid.New(), uploads, "", true)
+	if err != nil || len(files) != 1 || len(failures) != 1 {
+		t.Fatalf("expected the clean file stored and the flagged one rejected, got %d files, %+v (%v)", len(files), failures, err)
+	}
+	if failures[0].Index != 1 || failures[0].Reason() != RejectFlagged || !strings.Contains(failures[0].Err.Error(), "Test.Pattern") {
+		t.Fatalf("expected eicar.txt rejected as FLAGGED, got %+v", failures[0])
+	}
+	if puts != 1 || len(repo.mappings) != 1 {
+		t.Fatalf("expected only the clean file stored and mapped, got %d puts, %d mappings", puts, len(repo.mappings))
+	}
+
+	// Scans that fail or run out of time reject the file rather than let it through
+	for name, scanner := range map[string]patternScanner{
+		"error":   {err: errors.New("clamd: connection refused")},
+		"timeout": {block: true},
+	} {
+		fs.Scanner = scanner
+		fs.ScanTimeout = 10 * time.Millisecond
+		retry := []*graphql.Upload{{Filename: "new.txt", File: strings.NewReader(name)}}
+		if _, _, err := fs.UploadFiles(ctx, uuid.New(), retry, "", false); err == nil || !strings.Contains(err.Error(), "failed to scan") {
+			t.Fatalf("%s: expected the upload rejected, got %v", name, err)
+		}
+	}
+	if puts != 1 || len(repo.mappings) != 1 {
+		t.Fatalf("expected nothing stored for unscanned files, got %d puts, %d mappings", puts, len(repo.mappings))
+	}
+}
+
+func TestFileService_QuarantinedFile(t *testing.T) {
+	fileID := uuid.New()
+	repo := &stubFileRepo{statuses: map[uuid.UUID]string{fileID: models.FileStatusQuarantined}}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	ctx := context.Background()
+
+	if _, err := fs.GetFileURL(ctx, uuid.New(), fileID, false); !errors.Is(err, ErrFileQuarantined) {
+		t.Fatalf("expected quarantined download to be refused, got %v", err)
+	}
+	listed, err := fs.ListQuarantinedFiles(ctx)
+	if err != nil || len(listed) != 1 || listed[0].FileID != fileID {
+		t.Fatalf("expected quarantined file to be listed, got %+v (%v)", listed, err)
+	}
+
+	if err := fs.ReleaseQuarantinedFile(ctx, fileID); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if repo.statuses[fileID] != models.FileStatusActive {
+		t.Fatalf("expected released file to be active, got %q", repo.statuses[fileID])
+	}
+	if err := fs.ReleaseQuarantinedFile(ctx, fileID); err == nil {
+		t.Fatalf("expected releasing an active file to fail")
+	}
+	if err := fs.DeleteQuarantinedFile(ctx, fileID); err == nil {
+		t.Fatalf("expected deleting an active file through quarantine to fail")
+	}
+}
+
+func TestFileService_PurgeUserFile_NotFound(t *testing.T) {
+	fileID := uuid.New()
+	repo := &stubFileRepo{unmapped: map[uuid.UUID]bool{fileID: true}}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+
+	if err := fs.PurgeUserFile(context.Background(), uuid.New(), fileID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected purge of an unknown file to report not found, got %v", err)
+	}
+}
+
+func TestFileService_ReleaseFile_AlreadyGone(t *testing.T) {
+	fileID := uuid.New()
+	repo := &stubFileRepo{gone: map[uuid.UUID]bool{fileID: true}}
+	fs := NewFileService(repo, nil, "", "")
+
+	// The object store isn't configured, so reaching deletion would fail
+	if err := fs.releaseFile(context.Background(), fileID); err != nil {
+		t.Fatalf("expected a file row that is already gone to be skipped, got %v", err)
+	}
+}
+
+// stubFileLocker serializes WithFileLock per file in memory, as the advisory lock does
+type stubFileLocker struct {
+	mu    sync.Mutex
+	locks map[uuid.UUID]*sync.Mutex
+}
+
+func (l *stubFileLocker) WithFileLock(ctx context.Context, fileID uuid.UUID, fn func(ctx context.Context) error) error {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[uuid.UUID]*sync.Mutex{}
+	}
+	m := l.locks[fileID]
+	if m == nil {
+		m = &sync.Mutex{}
+		l.locks[fileID] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	defer m.Unlock()
+	return fn(ctx)
+}
+
+func TestFileService_FileLock_RotateRacingRelease(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs, stored := encryptedFileService(repo, testProvider(t, "old", "old", "new"))
+	fs.Locks = &stubFileLocker{}
+	// The map is only safe while the lock serializes its users; without it the test should
+	// fail on the leftover objects, not crash on concurrent map writes. Each storage call
+	// yields so that, unlocked, the two operations interleave.
+	var objMu sync.Mutex
+	write, read, remove := fs.objectWriter, fs.objectReader, fs.objectRemover
+	fs.objectWriter = func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		runtime.Gosched()
+		objMu.Lock()
+		defer objMu.Unlock()
+		return write(ctx, key, bytes.NewReader(b), size, contentType)
+	}
+	fs.objectReader = func(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+		runtime.Gosched()
+		objMu.Lock()
+		defer objMu.Unlock()
+		return read(ctx, f)
+	}
+	fs.objectRemover = func(ctx context.Context, key string) error {
+		runtime.Gosched()
+		objMu.Lock()
+		defer objMu.Unlock()
+		return remove(ctx, key)
+	}
+
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("content %d rotated while its last owner lets go", i)
+		fs.Crypto = testProvider(t, "old", "old", "new")
+		if _, _, err := fs.UploadFiles(ctx, uuid.New(), []*graphql.Upload{{Filename: "a.txt", File: strings.NewReader(content)}}, "", false); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		fileID := repo.filesByHash[hashOf(content)].ID
+		repo.mu.Lock()
+		repo.mappings = nil
+		repo.mu.Unlock()
+		fs.Crypto = testProvider(t, "new", "old", "new")
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for j := 0; j < 4; j++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if _, err := fs.RotateFileKey(ctx, fileID); err != nil {
+					errs <- fmt.Errorf("rotate: %w", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if err := fs.releaseFile(ctx, fileID); err != nil {
+					errs <- fmt.Errorf("release: %w", err)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		if !repo.gone[fileID] {
+			t.Fatalf("expected the unreferenced file released")
+		}
+		objMu.Lock()
+		left := len(stored)
+		objMu.Unlock()
+		if left != 0 {
+			t.Fatalf("round %d: expected no object left behind by the released file, got %d", i, left)
+		}
+	}
+}
+
+func TestFileService_SoftDeleteByMappingID_NotFound(t *testing.T) {
+	ctx := context.Background()
+	ownerID, otherID, fileID := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	mine := files.addMapping(ownerID, fileID)
+	fs := NewFileService(files, nil, "", "")
+
+	// Someone else's mapping id can't trash the owner's copy out of a shared folder
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, otherID, mine.String()); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another user's mapping, got %v", err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, ownerID, mine.String()); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, ownerID, mine.String()); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an already trashed copy, got %v", err)
+	}
+}
+
+func TestFileService_GetFilesByIDs(t *testing.T) {
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+	mine, trashed, theirs, unknown := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	second := uuid.New()
+	repo := &stubFileRepo{}
+	repo.addMapping(userID, mine)
+	repo.addMapping(userID, second)
+	repo.mappings = append(repo.mappings, &stubMapping{id: uuid.New(), userID: userID, fileID: trashed, deleted: true})
+	repo.addMapping(otherID, theirs)
+	fs := NewFileService(repo, nil, "", "")
+
+	files, err := fs.GetFilesByIDs(ctx, userID, []uuid.UUID{second, theirs, trashed, mine, unknown, second})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 2 || files[0].FileID != second || files[1].FileID != mine {
+		t.Fatalf("expected only the user's active files in request order, got %+v", files)
+	}
+	if len(repo.batchLookups) != 1 || len(repo.batchLookups[0]) != 5 {
+		t.Fatalf("expected one lookup of the 5 distinct ids, got %v", repo.batchLookups)
+	}
+}
+
+func TestFileService_GetFilesByIDs_Bounds(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, nil, "", "")
+
+	if files, err := fs.GetFilesByIDs(ctx, uuid.New(), nil); err != nil || files == nil || len(files) != 0 {
+		t.Fatalf("expected an empty list for no ids, got %v (%v)", files, err)
+	}
+	tooMany := make([]uuid.UUID, maxFilesByIDs+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.New()
+	}
+	if _, err := fs.GetFilesByIDs(ctx, uuid.New(), tooMany); err == nil {
+		t.Fatalf("expected more than %d ids to be rejected", maxFilesByIDs)
+	}
+	if len(repo.batchLookups) != 0 {
+		t.Fatalf("expected no repository lookups, got %d", len(repo.batchLookups))
+	}
+}
+
+// namedUploads is knownUploads with the given filenames, in order
+func namedUploads(repo *stubFileRepo, size int, names ...string) []*graphql.Upload {
+	uploads := knownUploads(repo, len(names), size)
+	for i, name := range names {
+		uploads[i].Filename = name
+	}
+	return uploads
+}
+
+func TestFileService_UploadFiles_NameConflictRename(t *testing.T) {
+	const size = 64
+	repo := &stubFileRepo{}
+	uploads := namedUploads(repo, size, "notes.txt", "NOTES.txt", "notes.txt", "todo.txt")
+	// notes.txt at the root holds different content; same-content same-name is no conflict
+	repo.folderFiles = map[uuid.UUID][]models.UserFile{uuid.Nil: {
+		{File: models.File{OriginalName: "notes.txt", Hash: hashOf(fmt.Sprintf("%0*d", size, 99))}},
+		{File: models.File{OriginalName: "todo.txt", Hash: hashOf(fmt.Sprintf("%0*d", size, 3))}},
+	}}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.UploadConcurrency = 1
+
+	files, failures, err := fs.UploadFilesOrdered(context.Background(), uuid.New(), uploads, "", true, UploadOrder{}, NameConflictRename)
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("unexpected failures %v (%v)", failures, err)
+	}
+	want := []string{"notes (1).txt", "NOTES (2).txt", "notes (3).txt", "todo.txt"}
+	if len(files) != len(want) {
+		t.Fatalf("expected %d files, got %d", len(want), len(files))
+	}
+	for i, uf := range files {
+		if uf.File.OriginalName != want[i] {
+			t.Fatalf("file %d: expected %q, got %q", i, want[i], uf.File.OriginalName)
+		}
+	}
+}
+
+func TestFileService_UploadFiles_NameConflictReject(t *testing.T) {
+	repo := &stubFileRepo{}
+	uploads := namedUploads(repo, 64, "notes.txt", "other.txt", "Other.TXT")
+	repo.folderFiles = map[uuid.UUID][]models.UserFile{uuid.Nil: {{File: models.File{OriginalName: "Notes.txt", Hash: "elsewhere"}}}}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.UploadConcurrency = 1
+
+	files, failures, err := fs.UploadFilesOrdered(context.Background(), uuid.New(), uploads, "", true, UploadOrder{}, NameConflictReject)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// The batch's own files collide too: the second other.txt loses to the first
+	if len(files) != 1 || files[0].File.OriginalName != "other.txt" {
+		t.Fatalf("expected only other.txt stored, got %+v", files)
+	}
+	if len(failures) != 2 || failures[0].Index != 0 || failures[1].Index != 2 {
+		t.Fatalf("expected files 0 and 2 to conflict, got %+v", failures)
+	}
+	for _, f := range failures {
+		if !errors.Is(f.Err, ErrNameConflict) {
+			t.Fatalf("expected a name conflict, got %v", f.Err)
+		}
+	}
+}
+
+func TestFileService_UploadFiles_NameConflictAllowByDefault(t *testing.T) {
+	repo := &stubFileRepo{}
+	uploads := namedUploads(repo, 64, "notes.txt", "notes.txt")
+	repo.folderFiles = map[uuid.UUID][]models.UserFile{uuid.Nil: {{File: models.File{OriginalName: "notes.txt", Hash: "elsewhere"}}}}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil || len(failures) != 0 || len(files) != 2 {
+		t.Fatalf("expected both files stored, got %d and %v (%v)", len(files), failures, err)
+	}
+	for _, uf := range files {
+		if uf.File.OriginalName != "notes.txt" {
+			t.Fatalf("expected the name to be kept, got %q", uf.File.OriginalName)
+		}
+	}
+	if _, _, err := fs.UploadFilesOrdered(context.Background(), uuid.New(), uploads, "", true, UploadOrder{}, "overwrite"); err == nil {
+		t.Fatalf("expected an unknown policy to be rejected")
+	}
+}
+
+func TestFolderNames_ReleaseFreesName(t *testing.T) {
+	names := folderNames{}
+	names.add("a.txt", "h1")
+	got, err := names.claim("a.txt", "h2", NameConflictRename)
+	if err != nil || got != "a (1).txt" {
+		t.Fatalf("expected a (1).txt, got %q (%v)", got, err)
+	}
+	names.release(got, "h2")
+	if got, _ := names.claim("A.txt", "h3", NameConflictRename); got != "A (1).txt" {
+		t.Fatalf("expected the released name to be reused, got %q", got)
+	}
+	// Releasing a second copy of content keeps the name held by the first
+	names.add("b.txt", "h4")
+	names.add("b.txt", "h4")
+	names.release("b.txt", "h4")
+	if !names.conflicts("b.txt", "h5") {
+		t.Fatalf("expected b.txt to stay taken")
+	}
+}
+
+func TestFileService_UploadFiles_EmptyFilesShareOneRow(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	var stored []string
+	fs.objectWriter = func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+		stored = append(stored, fmt.Sprintf("%s %d %s", key, size, contentType))
+		return nil
+	}
+	empty := func(names ...string) []*graphql.Upload {
+		var uploads []*graphql.Upload
+		for _, name := range names {
+			uploads = append(uploads, &graphql.Upload{Filename: name, File: strings.NewReader("")})
+		}
+		return uploads
+	}
+
+	// Extensions whose content can't be sniffed from zero bytes are still accepted
+	alice, bob := uuid.New(), uuid.New()
+	files, _, err := fs.UploadFiles(ctx, alice, empty("a.txt", "report.pdf"), "", false)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected both empty files stored, got %d (%v)", len(files), err)
+	}
+	// A user with no room left can still store empty files; they take no quota
+	repo.usageByUser = map[uuid.UUID]int64{bob: defaultQuotaBytes}
+	more, _, err := fs.UploadFiles(ctx, bob, empty("photo.png"), "", false)
+	if err != nil || len(more) != 1 {
+		t.Fatalf("expected an empty file to fit a full quota, got %d (%v)", len(more), err)
+	}
+	files = append(files, more...)
+
+	emptyHash := hashOf("")
+	row := repo.filesByHash[emptyHash]
+	if len(stored) != 1 || row == nil || row.Size != 0 || row.MimeType != emptyFileMimeType {
+		t.Fatalf("expected one shared empty object of type %s, got stored %v, row %+v", emptyFileMimeType, stored, row)
+	}
+	for i, want := range []string{"a.txt", "report.pdf", "photo.png"} {
+		// A mapping without a display name shows the row's name
+		name := row.OriginalName
+		for _, m := range repo.mappings {
+			if m.id == files[i].ID && m.displayName != "" {
+				name = m.displayName
+			}
+		}
+		if files[i].FileID != row.ID || name != want {
+			t.Fatalf("expected %s mapped to the shared row under its own name, got %s on %s", want, name, files[i].FileID)
+		}
+	}
+	if active, total, _ := repo.CountFileMappings(ctx, row.ID); active != 3 || total != 3 {
+		t.Fatalf("expected three references to the empty row, got %d of %d", active, total)
+	}
+
+	// Dropping one copy leaves the shared row in place for the others
+	var removed []string
+	fs.objectRemover = func(ctx context.Context, key string) error {
+		removed = append(removed, key)
+		return nil
+	}
+	if err := fs.DeleteFile(ctx, bob, row.ID, DeleteModeImmediate); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if active, _, _ := repo.CountFileMappings(ctx, row.ID); active != 2 || len(removed) != 0 || repo.gone[row.ID] {
+		t.Fatalf("expected the shared empty object kept for the other copies, got %d active, removed %v", active, removed)
+	}
+}
+
+func TestFileService_UploadFiles_RejectEmptyFiles(t *testing.T) {
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.RejectEmptyFiles = true
+	uploads := append([]*graphql.Upload{{Filename: "empty.txt", File: strings.NewReader("")}}, namedUploads(repo, 8, "ok.txt")...)
+
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected the non-empty file stored, got %d files (%v)", len(files), err)
+	}
+	if len(failures) != 1 || failures[0].Index != 0 || failures[0].Reason() != RejectEmptyFile {
+		t.Fatalf("expected the empty file rejected with %s, got %+v", RejectEmptyFile, failures)
+	}
+}
+
+func TestFileService_RestoreAllTrash_SkipsPurgedFiles(t *testing.T) {
+	ctx := context.Background()
+	userID, kept, purged, active := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{filesByHash: map[string]*models.File{
+		"kept":   {ID: kept, OriginalName: "kept.txt"},
+		"purged": {ID: purged, OriginalName: "purged.txt"},
+	}}
+	repo.addMapping(userID, kept)
+	purgedMapping := repo.addMapping(userID, purged)
+	repo.addMapping(userID, active)
+	fs := NewFileService(repo, nil, "", "")
+
+	for _, fileID := range []uuid.UUID{kept, purged} {
+		if err := fs.SoftDeleteUserFile(ctx, userID, fileID); err != nil {
+			t.Fatalf("soft delete: %v", err)
+		}
+	}
+	// The file row disappears between listing the trash and restoring it
+	repo.gone = map[uuid.UUID]bool{purged: true}
+
+	result, err := fs.RestoreAllTrash(ctx, userID)
+	if err != nil {
+		t.Fatalf("restore all: %v", err)
+	}
+	if result.Restored != 1 {
+		t.Fatalf("expected 1 restored, got %d", result.Restored)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].MappingID != purgedMapping || result.Skipped[0].Filename != "purged.txt" {
+		t.Fatalf("expected the purged file to be skipped, got %+v", result.Skipped)
+	}
+	if active, _, _ := repo.CountFileMappings(ctx, kept); active != 1 {
+		t.Fatalf("expected the kept file to be active again, got %d active", active)
+	}
+
+	// An empty trash restores nothing
+	if result, err = fs.RestoreAllTrash(ctx, uuid.New()); err != nil || result.Restored != 0 || len(result.Skipped) != 0 {
+		t.Fatalf("expected nothing to restore, got %+v, %v", result, err)
+	}
+}
+
+// budgetedFileRepo runs the per-file lookups through a query budget, as the pool tracer would
+type budgetedFileRepo struct {
+	*stubFileRepo
+	budget *repository.QueryBudget
+}
+
+func (r *budgetedFileRepo) GetUserFileByMappingID(ctx context.Context, userID, mappingID uuid.UUID) (*models.UserFile, error) {
+	r.budget.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT ... WHERE uf.id = $2"})
+	return r.stubFileRepo.GetUserFileByMappingID(ctx, userID, mappingID)
+}
+
+func (r *budgetedFileRepo) GetUserFilesByFileIDs(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]models.UserFile, error) {
+	r.budget.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT ... WHERE uf.file_id = ANY($2)"})
+	return r.stubFileRepo.GetUserFilesByFileIDs(ctx, userID, fileIDs)
+}
+
+func TestFileService_QueryBudget_CatchesPerFileLookups(t *testing.T) {
+	userID := uuid.New()
+	stub := &stubFileRepo{}
+	var mappingIDs, fileIDs []uuid.UUID
+	for i := 0; i < 6; i++ {
+		fileID := uuid.New()
+		fileIDs = append(fileIDs, fileID)
+		mappingIDs = append(mappingIDs, stub.addMapping(userID, fileID))
+	}
+	budget := &repository.QueryBudget{Limit: 5, Enforce: true, Logf: func(string, ...any) {}}
+	repo := &budgetedFileRepo{stubFileRepo: stub, budget: budget}
+	fs := NewFileService(repo, nil, "", "")
+	fs.Folders = NewFolderService(&stubFolderRepo{files: stub}, repo)
+
+	// Grouping looks each file up on its own: an N+1 pattern that trips the budget
+	ctx, count := budget.Track(context.Background(), "groupIntoNewFolder")
+	if _, _, err := fs.GroupIntoNewFolder(ctx, userID, mappingIDs, "Trip", nil); err != nil {
+		t.Fatalf("group: %v", err)
+	}
+	if count() <= budget.Limit || !errors.Is(context.Cause(ctx), repository.ErrQueryBudgetExceeded) {
+		t.Fatalf("expected %d per-file lookups to exceed the budget of %d", count(), budget.Limit)
+	}
+
+	// Hydrating the same files by id is one batched lookup
+	ctx, count = budget.Track(context.Background(), "filesByIds")
+	files, err := fs.GetFilesByIDs(ctx, userID, fileIDs)
+	if err != nil || len(files) != len(fileIDs) {
+		t.Fatalf("get by ids: %d files (%v)", len(files), err)
+	}
+	if count() != 1 || context.Cause(ctx) != nil {
+		t.Fatalf("expected one query within budget, got %d (%v)", count(), context.Cause(ctx))
+	}
+}
+
+func TestFileService_UserQuota_FallsBackToDefault(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubFileRepo{usage: 1024}
+	fs := NewFileService(repo, nil, "", "")
+
+	if _, quota, err := fs.GetUserUsage(ctx, uuid.New()); err != nil || quota != defaultQuotaBytes {
+		t.Fatalf("expected the built-in default without configuration, got %d (%v)", quota, err)
+	}
+	fs.DefaultQuotaBytes = 1 << 30
+	if used, quota, err := fs.GetUserUsage(ctx, uuid.New()); err != nil || used != 1024 || quota != 1<<30 {
+		t.Fatalf("expected the configured default, got %d of %d (%v)", used, quota, err)
+	}
+}
+
+func TestFileService_UserQuota_Override(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	repo := &stubFileRepo{quotas: map[uuid.UUID]int64{userID: 5000}}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.DefaultQuotaBytes = 1 << 30
+
+	if _, quota, err := fs.GetUserUsage(ctx, userID); err != nil || quota != 5000 {
+		t.Fatalf("expected the override, got %d (%v)", quota, err)
+	}
+
+	// Only the first file fits in the overridden quota, though both fit the default
+	files, failures, err := fs.UploadFiles(ctx, userID, sizedUploads(repo, 3000, 3000), "", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 1 || len(failedIndexes(t, failures)) != 1 {
+		t.Fatalf("expected 1 stored and 1 over quota, got %d and %d", len(files), len(failures))
+	}
+}
+
+// unreadableUpload fails the test if an upload body is read
+type unreadableUpload struct {
+	io.Seeker
+	t *testing.T
+}
+
+func (u unreadableUpload) Read([]byte) (int, error) {
+	u.t.Errorf("expected the upload to be refused before its body was read")
+	return 0, io.EOF
+}
+
+func TestFileService_UploadFiles_DeclaredSizeOverQuotaNotRead(t *testing.T) {
+	repo := &stubFileRepo{usage: defaultQuotaBytes - 1000}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	uploads := []*graphql.Upload{{Filename: "big.bin", File: unreadableUpload{t: t}, Size: 1001}}
+
+	_, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(failures) != 1 || !errors.Is(failures[0].Err, ErrQuotaExceeded) {
+		t.Fatalf("expected the upload to be over quota, got %+v", failures)
 	}
 }
@@ -0,0 +1,19 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/useradityaa/internal/models"
+)
+
+// ParseVisibility validates a visibility from configuration or an upload; empty means private.
+func ParseVisibility(name string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(name)); v {
+	case "":
+		return models.VisibilityPrivate, nil
+	case models.VisibilityPrivate, models.VisibilityShared, models.VisibilityPublic:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown visibility %q (want %q, %q or %q)", name, models.VisibilityPrivate, models.VisibilityShared, models.VisibilityPublic)
+}
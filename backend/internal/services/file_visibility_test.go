@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/useradityaa/internal/models"
+)
+
+func TestParseVisibility(t *testing.T) {
+	for in, want := range map[string]string{
+		"":         models.VisibilityPrivate,
+		"private":  models.VisibilityPrivate,
+		" Shared ": models.VisibilityShared,
+		"PUBLIC":   models.VisibilityPublic,
+	} {
+		got, err := ParseVisibility(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseVisibility(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseVisibility("internal"); err == nil {
+		t.Fatalf("expected error for unknown visibility")
+	}
+}
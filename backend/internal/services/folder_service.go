@@ -2,17 +2,31 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
 )
 
-type FolderService struct{ Repo repository.FolderRepository }
+type FolderService struct {
+	Repo     repository.FolderRepository
+	FileRepo repository.FileRepository
+}
+
+func NewFolderService(repo repository.FolderRepository, fileRepo repository.FileRepository) *FolderService {
+	return &FolderService{Repo: repo, FileRepo: fileRepo}
+}
 
-func NewFolderService(repo repository.FolderRepository) *FolderService {
-	return &FolderService{Repo: repo}
+// FolderContents is everything needed to render one folder view.
+type FolderContents struct {
+	// Folder is the opened folder, nil when listing the root
+	Folder     *models.Folder
+	Subfolders []models.Folder
+	Files      []models.UserFile
 }
 
 func (s *FolderService) CreateFolder(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (uuid.UUID, error) {
@@ -49,13 +63,305 @@ func (s *FolderService) CreateFolder(ctx context.Context, userID uuid.UUID, name
 	return f.ID, nil
 }
 
-func (s *FolderService) RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string) error {
+// CreateFolderWithFiles creates a new folder and moves the given mappings into it atomically.
+// Unlike CreateFolder it refuses to reuse an existing folder of the same name, since the
+// caller asked for a new one.
+func (s *FolderService) CreateFolderWithFiles(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID, mappingIDs []uuid.UUID) (*models.Folder, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("folder name required")
+	}
+	if parentID != nil {
+		ok, err := s.Repo.ValidateParent(ctx, userID, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("parent not found")
+		}
+	}
+	existingFolders, err := s.Repo.ListFolders(ctx, userID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing folders: %w", err)
+	}
+	for _, folder := range existingFolders {
+		if folder.Name == name {
+			return nil, fmt.Errorf("folder %q already exists", name)
+		}
+	}
+	return s.Repo.CreateFolderWithFiles(ctx, userID, name, parentID, mappingIDs)
+}
+
+// FileMove places one of the user's file mappings into a folder (the root when FolderID is nil).
+type FileMove struct {
+	MappingID uuid.UUID
+	FolderID  *uuid.UUID
+}
+
+// maxFileMoves caps how many files one MoveFiles call may move
+const maxFileMoves = 500
+
+// validateFolders checks with a single lookup that every folder exists and belongs to the user.
+func (s *FolderService) validateFolders(ctx context.Context, userID uuid.UUID, folderIDs []uuid.UUID) error {
+	if len(folderIDs) == 0 {
+		return nil
+	}
+	valid, err := s.Repo.ValidateParents(ctx, userID, folderIDs)
+	if err != nil {
+		return fmt.Errorf("failed to validate folders: %w", err)
+	}
+	for _, id := range folderIDs {
+		if !valid[id] {
+			return fmt.Errorf("folder %s not found", id)
+		}
+	}
+	return nil
+}
+
+// FileMoveResult is the outcome of one move in MoveFiles
+type FileMoveResult struct {
+	MappingID uuid.UUID
+	Moved     bool
+	// Error says why the mapping wasn't moved; empty when Moved
+	Error string
+}
+
+// MoveFiles moves several mappings at once. All destination folders are validated with one
+// lookup before anything moves, so an unknown or foreign folder leaves every file in place.
+// Mappings that are missing, someone else's or in the trash are then found with a single
+// query and reported in their results without stopping the others; the rest move together
+// in one transaction, so if that fails none of them move. A mapping listed more than once
+// moves to its first destination; results follow the order of moves, one per mapping.
+func (s *FolderService) MoveFiles(ctx context.Context, userID uuid.UUID, moves []FileMove) ([]FileMoveResult, error) {
+	if s == nil || s.Repo == nil || s.FileRepo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	if len(moves) > maxFileMoves {
+		return nil, fmt.Errorf("too many files: at most %d can be moved at once", maxFileMoves)
+	}
+	var targets []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, m := range moves {
+		if m.FolderID != nil && !seen[*m.FolderID] {
+			seen[*m.FolderID] = true
+			targets = append(targets, *m.FolderID)
+		}
+	}
+	if err := s.validateFolders(ctx, userID, targets); err != nil {
+		return nil, err
+	}
+
+	results := make([]FileMoveResult, 0, len(moves))
+	destinations := make(map[uuid.UUID]*uuid.UUID, len(moves))
+	mappingIDs := make([]uuid.UUID, 0, len(moves))
+	for _, m := range moves {
+		if _, dup := destinations[m.MappingID]; dup {
+			continue
+		}
+		destinations[m.MappingID] = m.FolderID
+		mappingIDs = append(mappingIDs, m.MappingID)
+		results = append(results, FileMoveResult{MappingID: m.MappingID})
+	}
+	if len(mappingIDs) == 0 {
+		return results, nil
+	}
+	states, err := s.FileRepo.GetUserMappingStates(ctx, userID, mappingIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up files: %w", err)
+	}
+	movable := make(map[uuid.UUID]*uuid.UUID, len(mappingIDs))
+	for i := range results {
+		id := results[i].MappingID
+		active, ok := states[id]
+		switch {
+		case !ok:
+			// Another user's mapping looks the same as a missing one
+			results[i].Error = fmt.Sprintf("file %s not found", id)
+		case !active:
+			results[i].Error = fmt.Sprintf("file %s is in the trash", id)
+		default:
+			movable[id] = destinations[id]
+		}
+	}
+	if len(movable) == 0 {
+		return results, nil
+	}
+	if err := s.FileRepo.MoveUserFiles(ctx, userID, movable); err != nil {
+		if !errors.Is(err, repository.ErrMappingsNotMoved) {
+			return nil, fmt.Errorf("failed to move files: %w", err)
+		}
+		// A mapping changed between the lookup and the move; the transaction moved none
+		for i := range results {
+			if _, ok := movable[results[i].MappingID]; ok {
+				results[i].Error = err.Error()
+			}
+		}
+		return results, nil
+	}
+	for i := range results {
+		if _, ok := movable[results[i].MappingID]; ok {
+			results[i].Moved = true
+		}
+	}
+	return results, nil
+}
+
+// CreateFolderPaths creates the slash-separated directory paths below rootID, reusing
+// folders that already exist, and returns the ID of every path and intermediate path
+// (with "" mapping to rootID) plus how many folders were created. rootID is validated
+// once and folders created here are known to be the user's, so they are neither
+// re-validated nor listed for existing children.
+func (s *FolderService) CreateFolderPaths(ctx context.Context, userID, rootID uuid.UUID, paths []string) (map[string]uuid.UUID, int, error) {
+	if s == nil || s.Repo == nil {
+		return nil, 0, fmt.Errorf("folder service not configured")
+	}
+	if err := s.validateFolders(ctx, userID, []uuid.UUID{rootID}); err != nil {
+		return nil, 0, err
+	}
+	ids := map[string]uuid.UUID{"": rootID}
+	// existing caches the subfolders of folders that predate this call, by name
+	existing := make(map[uuid.UUID]map[string]uuid.UUID)
+	fresh := make(map[uuid.UUID]bool)
+	created := 0
+	for _, p := range paths {
+		current := ""
+		parent := rootID
+		for _, part := range strings.Split(p, "/") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			if current == "" {
+				current = part
+			} else {
+				current = current + "/" + part
+			}
+			if id, ok := ids[current]; ok {
+				parent = id
+				continue
+			}
+			if !fresh[parent] {
+				children, ok := existing[parent]
+				if !ok {
+					pid := parent
+					folders, err := s.Repo.ListFolders(ctx, userID, &pid)
+					if err != nil {
+						return nil, 0, fmt.Errorf("failed to check existing folders: %w", err)
+					}
+					children = make(map[string]uuid.UUID, len(folders))
+					for _, f := range folders {
+						children[f.Name] = f.ID
+					}
+					existing[parent] = children
+				}
+				if id, ok := children[part]; ok {
+					ids[current] = id
+					parent = id
+					continue
+				}
+			}
+			pid := parent
+			f, err := s.Repo.CreateFolder(ctx, userID, part, &pid)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to create folder %s: %w", part, err)
+			}
+			fresh[f.ID] = true
+			ids[current] = f.ID
+			parent = f.ID
+			created++
+		}
+	}
+	return ids, created, nil
+}
+
+// RenameFolder renames a folder. Pass the folder's last seen UpdatedAt as expectedUpdatedAt
+// to reject the rename with repository.ErrVersionConflict if someone else changed it first.
+func (s *FolderService) RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string, expectedUpdatedAt *time.Time) error {
 	if strings.TrimSpace(newName) == "" {
 		return fmt.Errorf("name required")
 	}
-	return s.Repo.RenameFolder(ctx, userID, folderID, newName)
+	return s.Repo.RenameFolder(ctx, userID, folderID, newName, expectedUpdatedAt)
+}
+
+// SetDescription sets the note on one of the user's folders; a blank description clears it.
+// Returns the updated folder.
+func (s *FolderService) SetDescription(ctx context.Context, userID, folderID uuid.UUID, description string) (*models.Folder, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	desc, err := normalizeDescription(description)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.SetFolderDescription(ctx, userID, folderID, desc); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetFolderByID(ctx, userID, folderID)
+}
+
+// SetFolderQuota caps how many bytes one of the user's folders, subfolders included, may
+// hold; nil removes the cap. The cap applies to new uploads into the folder by anyone,
+// and doesn't remove what the folder already holds past it.
+func (s *FolderService) SetFolderQuota(ctx context.Context, userID, folderID uuid.UUID, quotaBytes *int64) error {
+	if s == nil || s.Repo == nil {
+		return fmt.Errorf("folder service not configured")
+	}
+	if quotaBytes != nil && *quotaBytes < 0 {
+		return fmt.Errorf("folder quota can't be negative")
+	}
+	return s.Repo.SetFolderQuota(ctx, userID, folderID, quotaBytes)
+}
+
+// MoveFolder moves one of the user's folders under another of their folders, or to the root
+// when newParentID is nil. The folder keeps its id, so its files and direct shares move with
+// it unchanged. Access inherited from ancestors follows the new location: recipients of the
+// old parent's shares lose access and those of the new parent's gain it. Moving a folder
+// into itself or its own subtree is refused, as is a name already taken at the target.
+func (s *FolderService) MoveFolder(ctx context.Context, userID, folderID uuid.UUID, newParentID *uuid.UUID) (*models.Folder, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	if newParentID != nil && *newParentID == folderID {
+		return nil, repository.ErrFolderCycle
+	}
+	folder, err := s.Repo.GetFolderByID(ctx, userID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if newParentID != nil {
+		if _, err := s.Repo.GetFolderByID(ctx, userID, *newParentID); err != nil {
+			return nil, fmt.Errorf("target folder: %w", err)
+		}
+	}
+	if sameParent(folder.ParentID, newParentID) {
+		return folder, nil
+	}
+	siblings, err := s.Repo.ListFolders(ctx, userID, newParentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing folders: %w", err)
+	}
+	for _, sibling := range siblings {
+		if sibling.Name == folder.Name {
+			return nil, fmt.Errorf("folder %q already exists at the destination", folder.Name)
+		}
+	}
+	if err := s.Repo.MoveFolder(ctx, userID, folderID, newParentID); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetFolderByID(ctx, userID, folderID)
+}
+
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
 }
 
+// DeleteFolder moves an empty-of-subfolders folder to the trash. Its files are moved to the
+// root first, so they stay where they are if the folder is recovered.
 func (s *FolderService) DeleteFolder(ctx context.Context, userID, folderID uuid.UUID) error {
 	children, err := s.Repo.CountChildren(ctx, userID, folderID)
 	if err != nil {
@@ -67,11 +373,161 @@ func (s *FolderService) DeleteFolder(ctx context.Context, userID, folderID uuid.
 	return s.Repo.DeleteFolderReassignFiles(ctx, userID, folderID)
 }
 
-// DeleteFolderRecursive deletes a folder and all its contents recursively
+// GetFolderContents returns the subfolders and active files of a folder in one call.
+// A nil folderID opens the user's root (parent_id IS NULL / folder_id IS NULL).
+func (s *FolderService) GetFolderContents(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) (*FolderContents, error) {
+	if s == nil || s.Repo == nil || s.FileRepo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	contents := &FolderContents{}
+	if folderID != nil {
+		folder, err := s.Repo.GetFolderByID(ctx, userID, *folderID)
+		if err != nil || folder == nil {
+			return nil, fmt.Errorf("folder not found")
+		}
+		contents.Folder = folder
+	}
+
+	subfolders, err := s.Repo.ListFolders(ctx, userID, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subfolders: %w", err)
+	}
+	files, err := s.FileRepo.ListUserFilesInFolder(ctx, userID, folderID, repository.SortByUploadedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	contents.Subfolders = subfolders
+	contents.Files = files
+	return contents, nil
+}
+
+// maxFolderTreeDepth caps how many levels GetFolderTree loads at once
+const maxFolderTreeDepth = 10
+
+// FolderTreeNode is a folder with the subfolders loaded beneath it.
+type FolderTreeNode struct {
+	Folder models.Folder
+	// HasChildren reports whether the folder has subfolders at all
+	HasChildren bool
+	// ChildrenLoaded is false when subfolders exist but lie beyond the requested depth,
+	// so the client should fetch them with another GetFolderTree call rooted here
+	ChildrenLoaded bool
+	Children       []*FolderTreeNode
+}
+
+// GetFolderTree returns the folders below rootID (the user's root when nil) nested up to
+// maxDepth levels, loaded with a single query. Depths above maxFolderTreeDepth are capped.
+func (s *FolderService) GetFolderTree(ctx context.Context, userID uuid.UUID, rootID *uuid.UUID, maxDepth int) ([]*FolderTreeNode, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	if maxDepth < 1 {
+		return nil, fmt.Errorf("depth must be at least 1")
+	}
+	if maxDepth > maxFolderTreeDepth {
+		maxDepth = maxFolderTreeDepth
+	}
+	if rootID != nil {
+		ok, err := s.Repo.ValidateParent(ctx, userID, *rootID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("folder not found")
+		}
+	}
+
+	entries, err := s.Repo.GetFolderTree(ctx, userID, rootID, maxDepth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load folder tree: %w", err)
+	}
+
+	// entries come ordered by depth, so every parent is indexed before its children
+	roots := []*FolderTreeNode{}
+	byID := make(map[uuid.UUID]*FolderTreeNode, len(entries))
+	for _, e := range entries {
+		node := &FolderTreeNode{
+			Folder:         e.Folder,
+			HasChildren:    e.HasChildren,
+			ChildrenLoaded: !e.HasChildren || e.Depth < maxDepth,
+			Children:       []*FolderTreeNode{},
+		}
+		byID[e.ID] = node
+		if e.Depth == 1 {
+			roots = append(roots, node)
+			continue
+		}
+		if e.ParentID != nil {
+			if parent, ok := byID[*e.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+			}
+		}
+	}
+	return roots, nil
+}
+
+// DeleteFolderRecursive moves a folder and all its contents to the trash. The trashed files
+// are listed with the user's other deleted files; recovering the folder restores them too.
 func (s *FolderService) DeleteFolderRecursive(ctx context.Context, userID, folderID uuid.UUID) error {
 	return s.Repo.DeleteFolderRecursive(ctx, userID, folderID)
 }
 
+// GetDeletedFolders lists the user's trashed folders, one per deletion
+func (s *FolderService) GetDeletedFolders(ctx context.Context, userID uuid.UUID) ([]models.Folder, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	return s.Repo.GetDeletedFolders(ctx, userID)
+}
+
+// RecoverFolder takes one of the user's trashed folders out of the trash, with the subfolders
+// and files that were deleted along with it. The folder goes back to its parent, or to the
+// root when the parent has since been deleted itself. A folder of the same name at that
+// level blocks the recovery. Returns the recovered folder.
+func (s *FolderService) RecoverFolder(ctx context.Context, userID, folderID uuid.UUID) (*models.Folder, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("folder service not configured")
+	}
+	trashed, err := s.Repo.GetDeletedFolders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var folder *models.Folder
+	for i := range trashed {
+		if trashed[i].ID == folderID {
+			folder = &trashed[i]
+			break
+		}
+	}
+	if folder == nil {
+		return nil, fmt.Errorf("deleted folder %s: %w", folderID, repository.ErrNotFound)
+	}
+
+	parentID := folder.ParentID
+	if parentID != nil {
+		ok, err := s.Repo.ValidateParent(ctx, userID, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			parentID = nil
+		}
+	}
+	siblings, err := s.Repo.ListFolders(ctx, userID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing folders: %w", err)
+	}
+	for _, sibling := range siblings {
+		if sibling.Name == folder.Name {
+			return nil, fmt.Errorf("folder %q already exists at the destination", folder.Name)
+		}
+	}
+	if err := s.Repo.RecoverFolder(ctx, userID, folderID, parentID); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetFolderByID(ctx, userID, folderID)
+}
+
 // CreateFolderHierarchy creates a nested folder structure from a path
 func (s *FolderService) CreateFolderHierarchy(ctx context.Context, userID uuid.UUID, folderPath []string, parentID *uuid.UUID) (uuid.UUID, error) {
 	if len(folderPath) == 0 {
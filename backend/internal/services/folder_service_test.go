@@ -0,0 +1,494 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+func TestFolderService_RenameFolder_StaleVersion(t *testing.T) {
+	folderID := uuid.New()
+	v1 := time.Now().Truncate(time.Microsecond)
+	repo := &stubFolderRepo{versions: map[uuid.UUID]time.Time{folderID: v1}}
+	svc := NewFolderService(repo, &stubFileRepo{})
+	ctx := context.Background()
+
+	// First client renames using the version it read
+	if err := svc.RenameFolder(ctx, uuid.New(), folderID, "first", &v1); err != nil {
+		t.Fatalf("expected rename with current version to succeed, got %v", err)
+	}
+	// Second client still holds v1 and must be rejected
+	err := svc.RenameFolder(ctx, uuid.New(), folderID, "second", &v1)
+	if !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	// Without a version the rename is unconditional
+	if err := svc.RenameFolder(ctx, uuid.New(), folderID, "third", nil); err != nil {
+		t.Fatalf("expected unconditional rename to succeed, got %v", err)
+	}
+}
+
+func TestFolderService_RenameFolder_EmptyName(t *testing.T) {
+	svc := NewFolderService(&stubFolderRepo{}, &stubFileRepo{})
+	if err := svc.RenameFolder(context.Background(), uuid.New(), uuid.New(), "  ", nil); err == nil {
+		t.Fatalf("expected error for empty name")
+	}
+}
+
+func TestFolderService_GetFolderContents(t *testing.T) {
+	rootFolder, nested := uuid.New(), uuid.New()
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		uuid.Nil:   {{ID: rootFolder, Name: "docs"}},
+		rootFolder: {{ID: nested, Name: "2024", ParentID: &rootFolder}},
+	}}
+	files := &stubFileRepo{folderFiles: map[uuid.UUID][]models.UserFile{
+		uuid.Nil:   {{ID: uuid.New()}, {ID: uuid.New()}},
+		rootFolder: {{ID: uuid.New(), FolderID: &rootFolder}},
+	}}
+	svc := NewFolderService(&stubFolderRepo{share: share}, files)
+	ctx := context.Background()
+
+	root, err := svc.GetFolderContents(ctx, uuid.New(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if root.Folder != nil || len(root.Subfolders) != 1 || len(root.Files) != 2 {
+		t.Fatalf("unexpected root contents: folder=%v subfolders=%d files=%d", root.Folder, len(root.Subfolders), len(root.Files))
+	}
+
+	inner, err := svc.GetFolderContents(ctx, uuid.New(), &rootFolder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inner.Folder == nil || inner.Folder.ID != rootFolder {
+		t.Fatalf("expected opened folder to be returned")
+	}
+	if len(inner.Subfolders) != 1 || inner.Subfolders[0].ID != nested || len(inner.Files) != 1 {
+		t.Fatalf("unexpected nested contents: subfolders=%d files=%d", len(inner.Subfolders), len(inner.Files))
+	}
+}
+
+func TestFolderService_GetFolderTree(t *testing.T) {
+	docs, photos, y2024, q1, empty := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		uuid.Nil: {{ID: docs, Name: "docs"}, {ID: photos, Name: "photos"}},
+		docs:     {{ID: y2024, Name: "2024", ParentID: &docs}, {ID: empty, Name: "empty", ParentID: &docs}},
+		y2024:    {{ID: q1, Name: "q1", ParentID: &y2024}},
+	}}
+	svc := NewFolderService(&stubFolderRepo{share: share}, &stubFileRepo{})
+	ctx := context.Background()
+
+	tree, err := svc.GetFolderTree(ctx, uuid.New(), nil, 2)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(tree) != 2 || tree[0].Folder.ID != docs || tree[1].Folder.ID != photos {
+		t.Fatalf("unexpected top level: %+v", tree)
+	}
+	d := tree[0]
+	if !d.HasChildren || !d.ChildrenLoaded || len(d.Children) != 2 {
+		t.Fatalf("expected docs' children to be loaded, got %+v", d)
+	}
+	y := d.Children[0]
+	if y.Folder.ID != y2024 || !y.HasChildren || y.ChildrenLoaded || len(y.Children) != 0 {
+		t.Fatalf("expected 2024 to have unloaded children beyond depth 2, got %+v", y)
+	}
+	if e := d.Children[1]; e.HasChildren || !e.ChildrenLoaded {
+		t.Fatalf("expected empty folder to have nothing to load, got %+v", e)
+	}
+	if p := tree[1]; p.HasChildren || !p.ChildrenLoaded {
+		t.Fatalf("expected photos to have nothing to load, got %+v", p)
+	}
+
+	// expanding the lazy node loads its subtree
+	sub, err := svc.GetFolderTree(ctx, uuid.New(), &y2024, 1)
+	if err != nil || len(sub) != 1 || sub[0].Folder.ID != q1 {
+		t.Fatalf("expected q1 under 2024, got %+v (%v)", sub, err)
+	}
+
+	if _, err := svc.GetFolderTree(ctx, uuid.New(), nil, 0); err == nil {
+		t.Fatalf("expected zero depth to be rejected")
+	}
+}
+
+func TestFolderService_MoveFiles_ValidatesFoldersOnce(t *testing.T) {
+	user, other := uuid.New(), uuid.New()
+	docs, photos, foreign, missing := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	folders := &stubFolderRepo{owners: map[uuid.UUID]uuid.UUID{docs: user, photos: user, foreign: other}}
+	svc := NewFolderService(folders, files)
+	ctx := context.Background()
+	a, b, c := files.addMapping(user, uuid.New()), files.addMapping(user, uuid.New()), files.addMapping(user, uuid.New())
+
+	moves := []FileMove{{MappingID: a, FolderID: &docs}, {MappingID: b, FolderID: &photos}, {MappingID: c, FolderID: &docs}}
+	if _, err := svc.MoveFiles(ctx, user, moves); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if folders.validations != 1 || files.stateLookups != 1 {
+		t.Fatalf("expected one folder and one file lookup, got %d and %d", folders.validations, files.stateLookups)
+	}
+	if *files.mappings[0].folderID != docs || *files.mappings[1].folderID != photos || *files.mappings[2].folderID != docs {
+		t.Fatalf("expected files to be moved into their folders")
+	}
+
+	for _, bad := range []uuid.UUID{foreign, missing} {
+		moves := []FileMove{{MappingID: a, FolderID: nil}, {MappingID: b, FolderID: &bad}}
+		if _, err := svc.MoveFiles(ctx, user, moves); err == nil {
+			t.Fatalf("expected folder %s to be rejected", bad)
+		}
+		if files.mappings[0].folderID == nil {
+			t.Fatalf("expected no file to move when a destination is invalid")
+		}
+	}
+}
+
+func TestFolderService_MoveFiles_OneFile(t *testing.T) {
+	ctx := context.Background()
+	user, other := uuid.New(), uuid.New()
+	mine, theirs := uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	mapping := files.addMapping(user, uuid.New())
+	svc := NewFolderService(&stubFolderRepo{owners: map[uuid.UUID]uuid.UUID{mine: user, theirs: other}}, files)
+
+	results, err := svc.MoveFiles(ctx, user, []FileMove{{MappingID: mapping, FolderID: &mine}})
+	if err != nil || !results[0].Moved {
+		t.Fatalf("expected a move into an own folder, got %+v (%v)", results, err)
+	}
+	if uf, _ := files.GetUserFileByMappingID(ctx, user, mapping); uf.FolderID == nil || *uf.FolderID != mine {
+		t.Fatalf("expected the mapping in folder %s, got %v", mine, uf.FolderID)
+	}
+
+	if _, err := svc.MoveFiles(ctx, user, []FileMove{{MappingID: mapping, FolderID: &theirs}}); err == nil {
+		t.Fatalf("expected another user's folder to be rejected")
+	}
+	if uf, _ := files.GetUserFileByMappingID(ctx, user, mapping); uf.FolderID == nil || *uf.FolderID != mine {
+		t.Fatalf("expected the mapping left in %s after a rejected move, got %v", mine, uf.FolderID)
+	}
+
+	results, err = svc.MoveFiles(ctx, user, []FileMove{{MappingID: mapping}})
+	if err != nil || !results[0].Moved {
+		t.Fatalf("expected a move to the root, got %+v (%v)", results, err)
+	}
+	if uf, _ := files.GetUserFileByMappingID(ctx, user, mapping); uf.FolderID != nil {
+		t.Fatalf("expected the mapping at the root, got folder %s", *uf.FolderID)
+	}
+}
+
+func TestFolderService_MoveFiles_MixedBatch(t *testing.T) {
+	ctx := context.Background()
+	user, other := uuid.New(), uuid.New()
+	docs, photos := uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	first := files.addMapping(user, uuid.New())
+	second := files.addMapping(user, uuid.New())
+	theirs := files.addMapping(other, uuid.New())
+	trashed := files.addMapping(user, uuid.New())
+	files.mappings[3].deleted = true
+	folders := &stubFolderRepo{owners: map[uuid.UUID]uuid.UUID{docs: user, photos: user}}
+	svc := NewFolderService(folders, files)
+
+	moves := []FileMove{
+		{MappingID: first, FolderID: &docs},
+		{MappingID: theirs, FolderID: &docs},
+		{MappingID: second, FolderID: &photos},
+		{MappingID: trashed, FolderID: &docs},
+		{MappingID: first, FolderID: &photos},
+	}
+	results, err := svc.MoveFiles(ctx, user, moves)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := []struct {
+		id    uuid.UUID
+		moved bool
+	}{{first, true}, {theirs, false}, {second, true}, {trashed, false}}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results (duplicates counted once), got %d: %+v", len(want), len(results), results)
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.MappingID != w.id || r.Moved != w.moved || (r.Error == "") != w.moved {
+			t.Fatalf("result %d: expected %s moved=%v, got %+v", i, w.id, w.moved, r)
+		}
+	}
+	if files.stateLookups != 1 {
+		t.Fatalf("expected the mappings looked up in one query, got %d", files.stateLookups)
+	}
+	if *files.mappings[0].folderID != docs || *files.mappings[1].folderID != photos {
+		t.Fatalf("expected the movable files in their first destinations")
+	}
+	if files.mappings[2].folderID != nil || files.mappings[3].folderID != nil {
+		t.Fatalf("expected another user's and the trashed mapping left in place")
+	}
+}
+
+func TestFolderService_CreateFolderPaths(t *testing.T) {
+	user := uuid.New()
+	root, existing := uuid.New(), uuid.New()
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		root: {{ID: existing, Name: "docs", ParentID: &root}},
+	}}
+	folders := &stubFolderRepo{share: share, owners: map[uuid.UUID]uuid.UUID{root: user}}
+	svc := NewFolderService(folders, &stubFileRepo{})
+	ctx := context.Background()
+
+	ids, created, err := svc.CreateFolderPaths(ctx, user, root, []string{"", "docs", "docs/2024/q1", "docs/2024", "photos/raw"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if ids[""] != root || ids["docs"] != existing {
+		t.Fatalf("expected root and existing folder to be reused, got %v", ids)
+	}
+	if created != 4 {
+		t.Fatalf("expected 2024, q1, photos and raw to be created, got %d", created)
+	}
+	for _, p := range []string{"docs/2024", "docs/2024/q1", "photos", "photos/raw"} {
+		if ids[p] == uuid.Nil {
+			t.Fatalf("expected an id for %s, got %v", p, ids)
+		}
+	}
+	if folders.validations != 1 {
+		t.Fatalf("expected the root to be validated once, got %d lookups", folders.validations)
+	}
+
+	if _, _, err := svc.CreateFolderPaths(ctx, uuid.New(), root, []string{"docs"}); err == nil {
+		t.Fatalf("expected another user's root folder to be rejected")
+	}
+}
+
+func TestFolderService_MoveFolder_KeepsFilesAndShares(t *testing.T) {
+	owner := uuid.New()
+	reports, archive, q1 := uuid.New(), uuid.New(), uuid.New()
+	share := &stubShareRepo{
+		subfolders: map[uuid.UUID][]models.Folder{
+			uuid.Nil: {{ID: reports, UserID: owner, Name: "reports"}, {ID: archive, UserID: owner, Name: "archive"}},
+			reports:  {{ID: q1, UserID: owner, Name: "q1", ParentID: &reports}},
+		},
+		folderShares: []models.FolderShare{{ID: uuid.New(), FolderID: reports, OwnerID: owner, SharedWithEmail: "friend@example.com", Permission: "viewer"}},
+	}
+	mapping := models.UserFile{ID: uuid.New(), FolderID: &reports}
+	files := &stubFileRepo{folderFiles: map[uuid.UUID][]models.UserFile{reports: {mapping}}}
+	folders := &stubFolderRepo{share: share}
+	svc := NewFolderService(folders, files)
+	ctx := context.Background()
+
+	moved, err := svc.MoveFolder(ctx, owner, reports, &archive)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if moved.ID != reports || moved.ParentID == nil || *moved.ParentID != archive {
+		t.Fatalf("expected reports under archive, got %+v", moved)
+	}
+
+	contents, err := svc.GetFolderContents(ctx, owner, &reports)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(contents.Files) != 1 || contents.Files[0].ID != mapping.ID || len(contents.Subfolders) != 1 || contents.Subfolders[0].ID != q1 {
+		t.Fatalf("expected files and subfolders to move along, got %d files %d subfolders", len(contents.Files), len(contents.Subfolders))
+	}
+	if len(share.folderShares) != 1 || share.folderShares[0].FolderID != reports {
+		t.Fatalf("expected the folder's share to stay intact, got %+v", share.folderShares)
+	}
+
+	// Moving back to the root is allowed; moving to where it already is writes nothing
+	if _, err := svc.MoveFolder(ctx, owner, reports, nil); err != nil {
+		t.Fatalf("move to root: %v", err)
+	}
+	if _, err := svc.MoveFolder(ctx, owner, reports, nil); err != nil || folders.moves != 2 {
+		t.Fatalf("expected a no-op move to skip the write, got %d moves (%v)", folders.moves, err)
+	}
+}
+
+func TestFolderService_MoveFolder_Invalid(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	parent, child, grandchild, sibling, foreign := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		uuid.Nil: {{ID: parent, Name: "parent"}, {ID: sibling, Name: "child"}},
+		parent:   {{ID: child, Name: "child", ParentID: &parent}},
+		child:    {{ID: grandchild, Name: "grandchild", ParentID: &child}},
+	}}
+	folders := &stubFolderRepo{share: share, owners: map[uuid.UUID]uuid.UUID{
+		parent: owner, child: owner, grandchild: owner, sibling: owner, foreign: stranger,
+	}}
+	svc := NewFolderService(folders, &stubFileRepo{})
+	ctx := context.Background()
+
+	for _, target := range []uuid.UUID{parent, child, grandchild} {
+		if _, err := svc.MoveFolder(ctx, owner, parent, &target); !errors.Is(err, repository.ErrFolderCycle) {
+			t.Fatalf("expected moving into %s to be refused as a cycle, got %v", target, err)
+		}
+	}
+	if _, err := svc.MoveFolder(ctx, owner, parent, &foreign); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected someone else's folder to be refused as a target, got %v", err)
+	}
+	if _, err := svc.MoveFolder(ctx, stranger, parent, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected a non-owner to be refused, got %v", err)
+	}
+	if _, err := svc.MoveFolder(ctx, owner, child, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected a name clash at the destination to be refused, got %v", err)
+	}
+	if folders.moves != 0 {
+		t.Fatalf("expected nothing to move, got %d moves", folders.moves)
+	}
+}
+
+func TestFolderService_SetDescription(t *testing.T) {
+	owner, folderID := uuid.New(), uuid.New()
+	repo := &stubFolderRepo{owners: map[uuid.UUID]uuid.UUID{folderID: owner}}
+	svc := NewFolderService(repo, &stubFileRepo{})
+	ctx := context.Background()
+
+	folder, err := svc.SetDescription(ctx, owner, folderID, "  Receipts for 2024 taxes \n")
+	if err != nil || folder.Description != "Receipts for 2024 taxes" {
+		t.Fatalf("expected trimmed description, got %+v (%v)", folder, err)
+	}
+	if folder, err = svc.SetDescription(ctx, owner, folderID, "   "); err != nil || folder.Description != "" {
+		t.Fatalf("expected blank description to clear it, got %+v (%v)", folder, err)
+	}
+	if _, ok := repo.descriptions[folderID]; ok {
+		t.Fatalf("expected the stored description to be removed")
+	}
+
+	if _, err := svc.SetDescription(ctx, owner, folderID, strings.Repeat("a", MaxDescriptionLength+1)); err == nil {
+		t.Fatalf("expected overlong description to be rejected")
+	}
+	// The cap counts characters, not bytes
+	if _, err := svc.SetDescription(ctx, owner, folderID, strings.Repeat("é", MaxDescriptionLength)); err != nil {
+		t.Fatalf("expected description at the limit to be accepted, got %v", err)
+	}
+
+	if _, err := svc.SetDescription(ctx, uuid.New(), folderID, "mine now"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected another user's folder to be not found, got %v", err)
+	}
+	if repo.descriptions[folderID] != strings.Repeat("é", MaxDescriptionLength) {
+		t.Fatalf("expected rejected updates to leave the description alone")
+	}
+}
+
+func TestFolderService_DeleteAndRecover_Nested(t *testing.T) {
+	owner := uuid.New()
+	docs, y2024, q1, notes := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		uuid.Nil: {{ID: docs, UserID: owner, Name: "docs"}},
+		docs:     {{ID: y2024, UserID: owner, Name: "2024", ParentID: &docs}, {ID: notes, UserID: owner, Name: "notes", ParentID: &docs}},
+		y2024:    {{ID: q1, UserID: owner, Name: "q1", ParentID: &y2024}},
+	}}
+	inDocs := &stubMapping{id: uuid.New(), userID: owner, fileID: uuid.New(), folderID: &docs}
+	inQ1 := &stubMapping{id: uuid.New(), userID: owner, fileID: uuid.New(), folderID: &q1}
+	// Trashed on its own before the folder went, so recovering the folder leaves it be
+	trashedEarlier := &stubMapping{id: uuid.New(), userID: owner, fileID: uuid.New(), folderID: &q1, deleted: true}
+	atRoot := &stubMapping{id: uuid.New(), userID: owner, fileID: uuid.New()}
+	files := &stubFileRepo{mappings: []*stubMapping{inDocs, inQ1, trashedEarlier, atRoot}}
+	svc := NewFolderService(&stubFolderRepo{share: share, files: files}, files)
+	ctx := context.Background()
+
+	if err := svc.DeleteFolderRecursive(ctx, owner, docs); err != nil {
+		t.Fatal(err)
+	}
+	if root, _ := svc.Repo.ListFolders(ctx, owner, nil); len(root) != 0 {
+		t.Fatalf("expected docs gone from the root listing, got %+v", root)
+	}
+	if _, err := svc.GetFolderContents(ctx, owner, &y2024); err == nil {
+		t.Fatalf("expected a trashed subfolder not to open")
+	}
+	if !inDocs.deleted || !inQ1.deleted || atRoot.deleted {
+		t.Fatalf("expected the subtree's files trashed and the rest kept, got docs=%v q1=%v root=%v", inDocs.deleted, inQ1.deleted, atRoot.deleted)
+	}
+	trashed, err := svc.GetDeletedFolders(ctx, owner)
+	if err != nil || len(trashed) != 1 || trashed[0].ID != docs {
+		t.Fatalf("expected only docs listed in the trash, got %+v (%v)", trashed, err)
+	}
+	if _, err := svc.RecoverFolder(ctx, owner, q1); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected a subfolder trashed with its parent not recoverable alone, got %v", err)
+	}
+
+	recovered, err := svc.RecoverFolder(ctx, owner, docs)
+	if err != nil || recovered.ID != docs || recovered.ParentID != nil {
+		t.Fatalf("expected docs back at the root, got %+v (%v)", recovered, err)
+	}
+	tree, err := svc.GetFolderTree(ctx, owner, nil, 3)
+	if err != nil || len(tree) != 1 || len(tree[0].Children) != 2 || len(tree[0].Children[0].Children) != 1 {
+		t.Fatalf("expected the whole subtree restored, got %+v (%v)", tree, err)
+	}
+	if sub, _ := svc.Repo.ListFolders(ctx, owner, &y2024); len(sub) != 1 || sub[0].ID != q1 {
+		t.Fatalf("expected q1 listed under 2024 again, got %+v", sub)
+	}
+	if inDocs.deleted || inQ1.deleted || !trashedEarlier.deleted {
+		t.Fatalf("expected the folder's files restored and the earlier trashed one kept in the trash, got docs=%v q1=%v earlier=%v", inDocs.deleted, inQ1.deleted, trashedEarlier.deleted)
+	}
+	if trashed, _ := svc.GetDeletedFolders(ctx, owner); len(trashed) != 0 {
+		t.Fatalf("expected the trash empty, got %+v", trashed)
+	}
+}
+
+func TestFolderService_DeleteAndRecover_Separately(t *testing.T) {
+	owner := uuid.New()
+	docs, y2024, q1, notes := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	share := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		uuid.Nil: {{ID: docs, UserID: owner, Name: "docs"}},
+		docs:     {{ID: y2024, UserID: owner, Name: "2024", ParentID: &docs}, {ID: notes, UserID: owner, Name: "notes", ParentID: &docs}},
+		y2024:    {{ID: q1, UserID: owner, Name: "q1", ParentID: &y2024}},
+	}}
+	inNotes := &stubMapping{id: uuid.New(), userID: owner, fileID: uuid.New(), folderID: &notes}
+	inQ1 := &stubMapping{id: uuid.New(), userID: owner, fileID: uuid.New(), folderID: &q1}
+	files := &stubFileRepo{mappings: []*stubMapping{inNotes, inQ1}}
+	folders := &stubFolderRepo{share: share, files: files}
+	svc := NewFolderService(folders, files)
+	ctx := context.Background()
+
+	// A folder with subfolders can't go on its own; an empty one leaves its files at the root
+	if err := svc.DeleteFolder(ctx, owner, y2024); err == nil {
+		t.Fatalf("expected a folder with subfolders refused")
+	}
+	if err := svc.DeleteFolder(ctx, owner, notes); err != nil {
+		t.Fatal(err)
+	}
+	if inNotes.deleted || inNotes.folderID != nil {
+		t.Fatalf("expected the file kept at the root, got deleted=%v folder=%v", inNotes.deleted, inNotes.folderID)
+	}
+
+	// q1 goes first, then docs with what's left; each deletion is recovered on its own
+	if err := svc.DeleteFolderRecursive(ctx, owner, q1); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteFolderRecursive(ctx, owner, docs); err != nil {
+		t.Fatal(err)
+	}
+	if trashed, _ := svc.GetDeletedFolders(ctx, owner); len(trashed) != 3 {
+		t.Fatalf("expected notes, q1 and docs listed in the trash, got %+v", trashed)
+	}
+
+	// Its parent is still in the trash, so q1 comes back at the root
+	recovered, err := svc.RecoverFolder(ctx, owner, q1)
+	if err != nil || recovered.ParentID != nil || inQ1.deleted {
+		t.Fatalf("expected q1 and its file back at the root, got %+v (%v), file deleted=%v", recovered, err, inQ1.deleted)
+	}
+	if _, err := svc.RecoverFolder(ctx, owner, docs); err != nil {
+		t.Fatal(err)
+	}
+	if sub, _ := svc.Repo.ListFolders(ctx, owner, &y2024); len(sub) != 0 {
+		t.Fatalf("expected q1 left at the root, got %+v under 2024", sub)
+	}
+	if _, err := svc.RecoverFolder(ctx, owner, notes); err != nil {
+		t.Fatal(err)
+	}
+	if inNotes.folderID != nil {
+		t.Fatalf("expected the file moved out before the delete to stay at the root")
+	}
+
+	// A folder of the same name at the destination blocks recovery
+	if err := svc.DeleteFolder(ctx, owner, q1); err != nil {
+		t.Fatal(err)
+	}
+	share.subfolders[uuid.Nil] = append(share.subfolders[uuid.Nil], models.Folder{ID: uuid.New(), UserID: owner, Name: "q1"})
+	if _, err := svc.RecoverFolder(ctx, owner, q1); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected a name clash refused, got %v", err)
+	}
+}
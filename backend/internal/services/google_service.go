@@ -2,12 +2,16 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/useradityaa/internal/auth"
 	"github.com/useradityaa/internal/config"
 	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
+	"google.golang.org/api/idtoken"
 )
 
 // GoogleService handles Google OAuth authentication and user management.
@@ -15,6 +19,60 @@ import (
 type GoogleService struct {
 	// UserRepo provides database operations for user management
 	UserRepo repository.UserRepository
+	// JWTKeys signs the session tokens issued on login
+	JWTKeys *auth.KeySet
+	// AllowedDomain restricts sign-in to one Google Workspace domain (empty allows any)
+	AllowedDomain string
+	// Verifier validates ID tokens; nil uses Google's token endpoint keys via auth.VerifyWithGoogleIDToken
+	Verifier GoogleTokenVerifier
+}
+
+// GoogleTokenVerifier validates a Google ID token and returns its payload.
+type GoogleTokenVerifier interface {
+	VerifyIDToken(idToken string) (*idtoken.Payload, error)
+}
+
+// googleIDTokenVerifier is the production verifier backed by auth.VerifyWithGoogleIDToken.
+type googleIDTokenVerifier struct{}
+
+func (googleIDTokenVerifier) VerifyIDToken(idToken string) (*idtoken.Payload, error) {
+	return auth.VerifyWithGoogleIDToken(idToken)
+}
+
+// checkGoogleClaims rejects tokens whose email Google has not verified and, when
+// allowedDomain is set, accounts outside that hosted domain. Both the hd claim and the
+// email's domain must match, since hd is only present for Workspace accounts.
+func checkGoogleClaims(claims map[string]interface{}, allowedDomain string) error {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return fmt.Errorf("google token has no email")
+	}
+
+	// email_verified is a bool in ID tokens but has been seen as a string
+	verified := false
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = strings.EqualFold(v, "true")
+	}
+	if !verified {
+		return fmt.Errorf("google email is not verified")
+	}
+
+	if allowedDomain == "" {
+		return nil
+	}
+	allowedDomain = strings.ToLower(strings.TrimSpace(allowedDomain))
+	hd, _ := claims["hd"].(string)
+	emailDomain := ""
+	if at := strings.LastIndex(email, "@"); at != -1 {
+		emailDomain = email[at+1:]
+	}
+	if !strings.EqualFold(hd, allowedDomain) || !strings.EqualFold(emailDomain, allowedDomain) {
+		return fmt.Errorf("google account is not in the allowed domain")
+	}
+	return nil
 }
 
 // LoginWithGoogle authenticates a user using a Google OAuth ID token.
@@ -29,18 +87,30 @@ type GoogleService struct {
 //   - *models.GoogleUser: The authenticated Google user object
 //   - string: JWT token for application authentication
 //   - error: nil on success, or an error if authentication fails
+//
+// Tokens with an unverified email, or outside AllowedDomain when it is set, are rejected.
 func (s *GoogleService) LoginWithGoogle(ctx context.Context, idToken string) (*models.GoogleUser, string, error) {
-	payload, err := auth.VerifyWithGoogleIDToken(idToken)
+	var verifier GoogleTokenVerifier = googleIDTokenVerifier{}
+	if s.Verifier != nil {
+		verifier = s.Verifier
+	}
+	payload, err := verifier.VerifyIDToken(idToken)
 	if err != nil {
 		return nil, "", err
 	}
+	if err := checkGoogleClaims(payload.Claims, s.AllowedDomain); err != nil {
+		return nil, "", err
+	}
 
 	email, _ := payload.Claims["email"].(string)
 	name, _ := payload.Claims["name"].(string)
 	picture, _ := payload.Claims["picture"].(string)
 
 	user, err := s.UserRepo.FindByGoogleMail(ctx, email)
-	if err != nil {
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, "", err
+	}
+	if user == nil {
 		newUser := &models.GoogleUser{
 			ID:      uuid.New(),
 			Email:   email,
@@ -62,7 +132,7 @@ func (s *GoogleService) LoginWithGoogle(ctx context.Context, idToken string) (*m
 
 	cfg := config.Load()
 	isAdmin := cfg.AdminEmail != "" && cfg.AdminEmail == email
-	token, err := auth.GenerateJWT(user.ID.String(), isAdmin)
+	token, err := auth.GenerateJWT(s.JWTKeys, user.ID.String(), isAdmin)
 	if err != nil {
 		return nil, "", err
 	}
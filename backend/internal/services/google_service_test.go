@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/models"
+	"google.golang.org/api/idtoken"
+)
+
+// stubGoogleVerifier returns a payload with fixed claims, or err, for any token
+type stubGoogleVerifier struct {
+	claims map[string]interface{}
+	err    error
+}
+
+func (v stubGoogleVerifier) VerifyIDToken(idToken string) (*idtoken.Payload, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	return &idtoken.Payload{Claims: v.claims}, nil
+}
+
+func newGoogleTestService(claims map[string]interface{}, allowedDomain string) (*GoogleService, *stubUserRepo) {
+	repo := &stubUserRepo{googleByEmail: map[string]*models.GoogleUser{}}
+	return &GoogleService{
+		UserRepo:      repo,
+		JWTKeys:       auth.NewKeySet([]byte("test-secret-test-secret-test-secret")),
+		AllowedDomain: allowedDomain,
+		Verifier:      stubGoogleVerifier{claims: claims},
+	}, repo
+}
+
+func TestGoogleService_LoginWithGoogle_CreatesUser(t *testing.T) {
+	svc, repo := newGoogleTestService(map[string]interface{}{
+		"email": "alice@example.com", "email_verified": true, "hd": "example.com", "name": "Alice",
+	}, "example.com")
+	user, token, err := svc.LoginWithGoogle(context.Background(), "tok")
+	if err != nil || user == nil || token == "" {
+		t.Fatalf("expected login to succeed, got %v", err)
+	}
+	if user.Email != "alice@example.com" || user.Name != "Alice" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if repo.googleByEmail["alice@example.com"] != user {
+		t.Fatalf("expected new google user to be created")
+	}
+}
+
+func TestGoogleService_LoginWithGoogle_UpdatesProfile(t *testing.T) {
+	svc, repo := newGoogleTestService(map[string]interface{}{
+		"email": "alice@example.com", "email_verified": true, "name": "Alice Smith", "picture": "https://example.com/a.png",
+	}, "")
+	existing := &models.GoogleUser{ID: uuid.New(), Email: "alice@example.com", Name: "Alice"}
+	repo.googleByEmail[existing.Email] = existing
+
+	user, _, err := svc.LoginWithGoogle(context.Background(), "tok")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if user.ID != existing.ID || user.Name != "Alice Smith" || repo.profileUpdates != 1 {
+		t.Fatalf("expected existing user's profile to be updated, got %+v (%d updates)", user, repo.profileUpdates)
+	}
+
+	// an unchanged profile is not written again
+	if _, _, err := svc.LoginWithGoogle(context.Background(), "tok"); err != nil || repo.profileUpdates != 1 {
+		t.Fatalf("expected no further profile update, got %d (%v)", repo.profileUpdates, err)
+	}
+}
+
+func TestGoogleService_LoginWithGoogle_InvalidToken(t *testing.T) {
+	svc := &GoogleService{UserRepo: &stubUserRepo{}, Verifier: stubGoogleVerifier{err: errors.New("bad signature")}}
+	if _, _, err := svc.LoginWithGoogle(context.Background(), "tok"); err == nil {
+		t.Fatalf("expected verifier error to be returned")
+	}
+}
+
+func TestGoogleService_LoginWithGoogle_Unverified(t *testing.T) {
+	for _, verified := range []interface{}{false, "false", nil} {
+		claims := map[string]interface{}{"email": "alice@example.com"}
+		if verified != nil {
+			claims["email_verified"] = verified
+		}
+		svc, _ := newGoogleTestService(claims, "")
+		if _, _, err := svc.LoginWithGoogle(context.Background(), "tok"); err == nil {
+			t.Fatalf("expected email_verified=%v to be rejected", verified)
+		}
+	}
+}
+
+func TestGoogleService_LoginWithGoogle_WrongDomain(t *testing.T) {
+	for _, claims := range []map[string]interface{}{
+		{"email": "bob@other.com", "email_verified": true, "hd": "other.com"},
+		// consumer account with a matching address but no hosted domain
+		{"email": "bob@example.com", "email_verified": true},
+		// hosted domain matches but the email is elsewhere
+		{"email": "bob@other.com", "email_verified": true, "hd": "example.com"},
+	} {
+		svc, repo := newGoogleTestService(claims, "example.com")
+		if _, _, err := svc.LoginWithGoogle(context.Background(), "tok"); err == nil {
+			t.Fatalf("expected %v to be rejected", claims)
+		}
+		if len(repo.googleByEmail) != 0 {
+			t.Fatalf("expected no user to be created for %v", claims)
+		}
+	}
+}
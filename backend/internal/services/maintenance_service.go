@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// defaultOrphanGrace is how old an unreferenced object must be before GC removes it.
+// Uploads store the object before the file row, so younger objects may still be claimed.
+const defaultOrphanGrace = time.Hour
+
+// ObjectStore is satisfied by *minio.Client.
+type ObjectStore interface {
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+}
+
+// MaintenanceService runs the offline reconciliation and garbage collection passes
+// behind the maintenance subcommands. Every pass can run as a dry run that only reports.
+type MaintenanceService struct {
+	Repo repository.MaintenanceRepository
+	// Objects and Bucket are needed for orphan GC only
+	Objects ObjectStore
+	Bucket  string
+	// OrphanGrace keeps recently written objects out of GC
+	OrphanGrace time.Duration
+	// DefaultQuotaBytes is the quota of users without an override (20 MB when zero)
+	DefaultQuotaBytes int64
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+func NewMaintenanceService(repo repository.MaintenanceRepository) *MaintenanceService {
+	return &MaintenanceService{Repo: repo, OrphanGrace: defaultOrphanGrace, now: time.Now}
+}
+
+// RefCountReport is the outcome of a ref_count reconciliation pass.
+type RefCountReport struct {
+	// Checked is the number of files examined
+	Checked int
+	// Drifted lists files whose stored ref_count didn't match their active mappings
+	Drifted []models.FileRefCount
+	// Fixed is how many of them were corrected (zero on a dry run)
+	Fixed int
+	// Unreferenced lists files no mapping points at, not even one in trash
+	Unreferenced []models.FileRefCount
+}
+
+// ReconcileRefCounts recomputes every file's ref_count from its active mappings, as
+// migration 024 did, and corrects the ones that drifted unless dryRun is set.
+func (s *MaintenanceService) ReconcileRefCounts(ctx context.Context, dryRun bool) (*RefCountReport, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("maintenance service not configured")
+	}
+	counts, err := s.Repo.ListFileRefCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ref counts: %w", err)
+	}
+	report := &RefCountReport{Checked: len(counts)}
+	for _, c := range counts {
+		if c.TotalMappings == 0 {
+			report.Unreferenced = append(report.Unreferenced, c)
+		}
+		if c.RefCount == c.ActiveMappings {
+			continue
+		}
+		report.Drifted = append(report.Drifted, c)
+		if dryRun {
+			continue
+		}
+		if err := s.Repo.SetFileRefCount(ctx, c.FileID, c.ActiveMappings); err != nil {
+			return report, fmt.Errorf("failed to fix ref count of %s: %w", c.FileID, err)
+		}
+		report.Fixed++
+	}
+	return report, nil
+}
+
+// OrphanObject is a stored object no file row refers to.
+type OrphanObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// OrphanReport is the outcome of an orphan GC pass.
+type OrphanReport struct {
+	// Scanned is the number of objects listed under files/
+	Scanned int
+	// Orphans lists unreferenced objects older than the grace period
+	Orphans []OrphanObject
+	// Removed and RemovedBytes count what was deleted (zero on a dry run)
+	Removed      int
+	RemovedBytes int64
+}
+
+// CollectOrphans lists objects under files/ that no file row refers to under any storage
+// layout and removes them unless dryRun is set. Objects younger than OrphanGrace are left
+// alone since an upload in progress writes its object before its row.
+func (s *MaintenanceService) CollectOrphans(ctx context.Context, dryRun bool) (*OrphanReport, error) {
+	if s == nil || s.Repo == nil || s.Objects == nil || s.Bucket == "" {
+		return nil, fmt.Errorf("object storage not configured")
+	}
+	counts, err := s.Repo.ListFileRefCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	known := map[string]bool{}
+	for _, c := range counts {
+		for _, k := range objectKeyCandidates(&models.File{Hash: c.Hash, StoragePath: c.StoragePath}) {
+			known[k] = true
+		}
+	}
+
+	cutoff := s.now().Add(-s.OrphanGrace)
+	report := &OrphanReport{}
+	for obj := range s.Objects.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: "files/", Recursive: true}) {
+		if obj.Err != nil {
+			return report, fmt.Errorf("failed to list objects: %w", obj.Err)
+		}
+		report.Scanned++
+		if known[obj.Key] || strings.HasSuffix(obj.Key, "/") || obj.LastModified.After(cutoff) {
+			continue
+		}
+		report.Orphans = append(report.Orphans, OrphanObject{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	if dryRun {
+		return report, nil
+	}
+	for _, o := range report.Orphans {
+		if err := s.Objects.RemoveObject(ctx, s.Bucket, o.Key, minio.RemoveObjectOptions{}); err != nil {
+			return report, fmt.Errorf("failed to remove %s: %w", o.Key, err)
+		}
+		report.Removed++
+		report.RemovedBytes += o.Size
+	}
+	return report, nil
+}
+
+// QuotaDiscrepancy is a user whose stored files exceed their quota.
+type QuotaDiscrepancy struct {
+	UserID     uuid.UUID
+	UsedBytes  int64
+	QuotaBytes int64
+}
+
+// QuotaDiscrepancies reports users whose logical usage is above quota, largest overrun
+// first. Uploads enforce the quota, so any entry points at bookkeeping gone wrong or
+// content added outside the upload path.
+func (s *MaintenanceService) QuotaDiscrepancies(ctx context.Context) ([]QuotaDiscrepancy, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("maintenance service not configured")
+	}
+	usage, err := s.Repo.ListUserUsage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	overrides, err := s.Repo.ListUserQuotas(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quotas: %w", err)
+	}
+	fallback := s.DefaultQuotaBytes
+	if fallback <= 0 {
+		fallback = defaultQuotaBytes
+	}
+	var out []QuotaDiscrepancy
+	for userID, used := range usage {
+		quota, ok := overrides[userID]
+		if !ok {
+			quota = fallback
+		}
+		if used > quota {
+			out = append(out, QuotaDiscrepancy{UserID: userID, UsedBytes: used, QuotaBytes: quota})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UsedBytes > out[j].UsedBytes })
+	return out, nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+// stubMaintenanceRepo derives ref counts and usage from seeded files and mappings the
+// way the SQL does, so stored ref counts can be seeded out of line with the mappings.
+type stubMaintenanceRepo struct {
+	files    []*models.File
+	mappings []stubMapping
+	// quotas backs ListUserQuotas, keyed by user
+	quotas map[uuid.UUID]int64
+}
+
+func (s *stubMaintenanceRepo) ListUserQuotas(ctx context.Context) (map[uuid.UUID]int64, error) {
+	return s.quotas, nil
+}
+
+func (s *stubMaintenanceRepo) ListFileRefCounts(ctx context.Context) ([]models.FileRefCount, error) {
+	var out []models.FileRefCount
+	for _, f := range s.files {
+		c := models.FileRefCount{FileID: f.ID, Hash: f.Hash, StoragePath: f.StoragePath, Size: f.Size, RefCount: f.RefCount}
+		for _, m := range s.mappings {
+			if m.fileID != f.ID {
+				continue
+			}
+			c.TotalMappings++
+			if !m.deleted {
+				c.ActiveMappings++
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (s *stubMaintenanceRepo) SetFileRefCount(ctx context.Context, fileID uuid.UUID, refCount int) error {
+	for _, f := range s.files {
+		if f.ID == fileID {
+			f.RefCount = refCount
+		}
+	}
+	return nil
+}
+
+func (s *stubMaintenanceRepo) ListUserUsage(ctx context.Context) (map[uuid.UUID]int64, error) {
+	usage := map[uuid.UUID]int64{}
+	seen := map[[2]uuid.UUID]bool{}
+	for _, m := range s.mappings {
+		if m.deleted || seen[[2]uuid.UUID{m.userID, m.fileID}] {
+			continue
+		}
+		seen[[2]uuid.UUID{m.userID, m.fileID}] = true
+		for _, f := range s.files {
+			if f.ID == m.fileID {
+				usage[m.userID] += f.Size
+			}
+		}
+	}
+	return usage, nil
+}
+
+// seededMaintenanceRepo holds one consistent file, one with too high a count after a
+// trash, one with too low a count, and one nothing maps to.
+func seededMaintenanceRepo(alice, bob uuid.UUID) *stubMaintenanceRepo {
+	file := func(refCount int) *models.File {
+		hash := hashOf(uuid.NewString())
+		return &models.File{ID: uuid.New(), Hash: hash, StoragePath: LayoutFlat.ObjectKey(hash), Size: 1024, RefCount: refCount}
+	}
+	ok, stale, low, orphan := file(1), file(2), file(0), file(3)
+	return &stubMaintenanceRepo{
+		files: []*models.File{ok, stale, low, orphan},
+		mappings: []stubMapping{
+			{id: uuid.New(), userID: alice, fileID: ok.ID},
+			{id: uuid.New(), userID: alice, fileID: stale.ID},
+			{id: uuid.New(), userID: bob, fileID: stale.ID, deleted: true},
+			{id: uuid.New(), userID: alice, fileID: low.ID},
+			{id: uuid.New(), userID: bob, fileID: low.ID},
+		},
+	}
+}
+
+func TestMaintenanceService_ReconcileRefCounts(t *testing.T) {
+	repo := seededMaintenanceRepo(uuid.New(), uuid.New())
+	svc := NewMaintenanceService(repo)
+	ctx := context.Background()
+
+	report, err := svc.ReconcileRefCounts(ctx, true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if report.Checked != 4 || len(report.Drifted) != 3 || report.Fixed != 0 || len(report.Unreferenced) != 1 {
+		t.Fatalf("unexpected dry-run report %+v", report)
+	}
+	if repo.files[1].RefCount != 2 {
+		t.Fatalf("expected dry run to leave counts alone")
+	}
+
+	if report, err = svc.ReconcileRefCounts(ctx, false); err != nil || report.Fixed != 3 {
+		t.Fatalf("expected 3 fixes, got %+v (%v)", report, err)
+	}
+	for i, want := range []int{1, 1, 2, 0} {
+		if got := repo.files[i].RefCount; got != want {
+			t.Fatalf("file %d: expected ref count %d, got %d", i, want, got)
+		}
+	}
+
+	if report, err = svc.ReconcileRefCounts(ctx, false); err != nil || len(report.Drifted) != 0 {
+		t.Fatalf("expected a second pass to find nothing, got %+v (%v)", report, err)
+	}
+}
+
+// stubObjectStore lists seeded objects and records removals.
+type stubObjectStore struct {
+	objects []minio.ObjectInfo
+	removed []string
+}
+
+func (s *stubObjectStore) ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	ch := make(chan minio.ObjectInfo, len(s.objects))
+	for _, o := range s.objects {
+		ch <- o
+	}
+	close(ch)
+	return ch
+}
+
+func (s *stubObjectStore) RemoveObject(ctx context.Context, bucket, key string, opts minio.RemoveObjectOptions) error {
+	s.removed = append(s.removed, key)
+	return nil
+}
+
+func TestMaintenanceService_CollectOrphans(t *testing.T) {
+	repo := seededMaintenanceRepo(uuid.New(), uuid.New())
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	moved := repo.files[1]
+	store := &stubObjectStore{objects: []minio.ObjectInfo{
+		{Key: repo.files[0].StoragePath, Size: 1024, LastModified: old},
+		// stored under the other layout than recorded: still referenced
+		{Key: LayoutSharded.ObjectKey(moved.Hash), Size: 1024, LastModified: old},
+		{Key: "files/deadbeef", Size: 10, LastModified: old},
+		{Key: "files/de/ad/deadbeef2", Size: 20, LastModified: old},
+		// too young to be sure no upload is about to claim it
+		{Key: "files/fresh", Size: 30, LastModified: now.Add(-time.Minute)},
+	}}
+	svc := NewMaintenanceService(repo)
+	svc.Objects, svc.Bucket = store, "bucket"
+	svc.now = func() time.Time { return now }
+
+	report, err := svc.CollectOrphans(context.Background(), true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if report.Scanned != 5 || len(report.Orphans) != 2 || len(store.removed) != 0 {
+		t.Fatalf("unexpected dry-run report %+v, removed %v", report, store.removed)
+	}
+
+	if report, err = svc.CollectOrphans(context.Background(), false); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if report.Removed != 2 || report.RemovedBytes != 30 || len(store.removed) != 2 || store.removed[0] != "files/deadbeef" {
+		t.Fatalf("expected the two old orphans removed, got %+v, removed %v", report, store.removed)
+	}
+}
+
+func TestMaintenanceService_CollectOrphans_NotConfigured(t *testing.T) {
+	if _, err := NewMaintenanceService(&stubMaintenanceRepo{}).CollectOrphans(context.Background(), true); err == nil {
+		t.Fatalf("expected error without object storage")
+	}
+}
+
+func TestMaintenanceService_QuotaDiscrepancies(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	repo := seededMaintenanceRepo(alice, bob)
+	big := &models.File{ID: uuid.New(), Size: defaultQuotaBytes}
+	repo.files = append(repo.files, big)
+	repo.mappings = append(repo.mappings, stubMapping{id: uuid.New(), userID: bob, fileID: big.ID})
+
+	over, err := NewMaintenanceService(repo).QuotaDiscrepancies(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// bob holds the quota-sized file plus one other; alice is well under
+	if len(over) != 1 || over[0].UserID != bob || over[0].UsedBytes != defaultQuotaBytes+1024 {
+		t.Fatalf("expected only bob over quota, got %+v", over)
+	}
+}
+
+func TestMaintenanceService_QuotaDiscrepancies_Overrides(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	repo := seededMaintenanceRepo(alice, bob)
+	big := &models.File{ID: uuid.New(), Size: defaultQuotaBytes}
+	repo.files = append(repo.files, big)
+	repo.mappings = append(repo.mappings, stubMapping{id: uuid.New(), userID: bob, fileID: big.ID})
+	// bob's larger quota covers the big file; alice's 2 KB override is exceeded by her 3 KB
+	repo.quotas = map[uuid.UUID]int64{bob: 2 * defaultQuotaBytes, alice: 2048}
+
+	over, err := NewMaintenanceService(repo).QuotaDiscrepancies(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(over) != 1 || over[0].UserID != alice || over[0].UsedBytes != 3072 || over[0].QuotaBytes != 2048 {
+		t.Fatalf("expected only alice over her override, got %+v", over)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/repository"
+)
+
+// NameConflict decides what an upload does when its target folder already holds a file of
+// the same name with different content. Names are compared ignoring case. Uploading the
+// same content under the same name is never a conflict.
+type NameConflict string
+
+const (
+	// NameConflictAllow stores the file under its name next to the existing one (default)
+	NameConflictAllow NameConflict = ""
+	// NameConflictRename stores the file as "name (1).ext", "name (2).ext", ...
+	NameConflictRename NameConflict = "rename"
+	// NameConflictReject fails the file with an error wrapping ErrNameConflict
+	NameConflictReject NameConflict = "reject"
+)
+
+// ErrNameConflict is wrapped by upload errors for files rejected under NameConflictReject.
+var ErrNameConflict = errors.New("name conflict")
+
+// maxRenameAttempts bounds the suffixes tried before giving up on a free name
+const maxRenameAttempts = 1000
+
+// folderNames tracks the names taken in an upload's target folder, counting the files of
+// each content stored under each name, so files of one batch see each other's names too.
+type folderNames map[string]map[string]int
+
+// loadFolderNames collects the names of the user's active files in folderID (the root when nil).
+func (s *FileService) loadFolderNames(ctx context.Context, userID uuid.UUID, folderID *uuid.UUID) (folderNames, error) {
+	files, err := s.FileRepo.ListUserFilesInFolder(ctx, userID, folderID, repository.SortByUploadedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder: %w", err)
+	}
+	names := folderNames{}
+	for _, uf := range files {
+		names.add(uf.File.OriginalName, uf.File.Hash)
+	}
+	return names, nil
+}
+
+func (n folderNames) add(name, hash string) {
+	key := strings.ToLower(name)
+	if n[key] == nil {
+		n[key] = map[string]int{}
+	}
+	n[key][hash]++
+}
+
+// conflicts reports whether name is taken by content other than hash.
+func (n folderNames) conflicts(name, hash string) bool {
+	for h := range n[strings.ToLower(name)] {
+		if h != hash {
+			return true
+		}
+	}
+	return false
+}
+
+// claim resolves name for content hash under policy and records the result as taken.
+func (n folderNames) claim(name, hash string, policy NameConflict) (string, error) {
+	if policy == NameConflictAllow || !n.conflicts(name, hash) {
+		n.add(name, hash)
+		return name, nil
+	}
+	if policy == NameConflictReject {
+		return "", fmt.Errorf("%w: a different file named %s already exists in the folder", ErrNameConflict, name)
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; i <= maxRenameAttempts; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, taken := n[strings.ToLower(candidate)]; !taken {
+			n.add(candidate, hash)
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no free name found for %s", ErrNameConflict, name)
+}
+
+// release gives back a name claimed for content that ended up not being stored.
+func (n folderNames) release(name, hash string) {
+	key := strings.ToLower(name)
+	if n[key][hash]--; n[key][hash] <= 0 {
+		delete(n[key], hash)
+	}
+	if len(n[key]) == 0 {
+		delete(n, key)
+	}
+}
+
+// displayName is the per-mapping name to store for a file uploaded as name whose content
+// is known as original: nil when they match, so the mapping follows the content's name.
+func displayName(name, original string) *string {
+	if name == original {
+		return nil
+	}
+	return &name
+}
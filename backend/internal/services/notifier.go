@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareInfo describes a share to the recipient being told about it.
+type ShareInfo struct {
+	// Kind is "file" or "folder"
+	Kind     string
+	ItemID   uuid.UUID
+	ItemName string
+	// OwnerEmail is who shared the item
+	OwnerEmail string
+	Permission string
+	ExpiresAt  *time.Time
+}
+
+// Notifier tells users about items shared with them.
+type Notifier interface {
+	NotifyShare(ctx context.Context, recipientEmail string, share ShareInfo) error
+}
+
+// ShareNotification is one recipient to tell about one share.
+type ShareNotification struct {
+	RecipientEmail string
+	Share          ShareInfo
+}
+
+// BatchNotifier is a Notifier that sends several notifications at once, e.g. over a single
+// connection to the mail server. NotifyShares returns one error per notification, nil for
+// those that were sent.
+type BatchNotifier interface {
+	Notifier
+	NotifyShares(ctx context.Context, notifications []ShareNotification) []error
+}
+
+// defaultNotifyWait is how long a share call waits for its notifications to be sent when
+// ShareService.NotifyWait is zero
+const defaultNotifyWait = 2 * time.Second
+
+// notifySendTimeout bounds the sending of one share call's notifications, including the
+// part that goes on in the background after the call has returned
+const notifySendTimeout = 2 * time.Minute
+
+// notifyConcurrency bounds the NotifyShare calls in flight for one share operation when the
+// notifier can't batch them
+const notifyConcurrency = 4
+
+// NotifyFailure is a recipient who couldn't be told about a share created for them. The
+// share itself stands.
+type NotifyFailure struct {
+	Email    string
+	ItemID   uuid.UUID
+	ItemName string
+	Err      error
+}
+
+func (f NotifyFailure) Error() string {
+	return fmt.Sprintf("shared with %s, but failed to notify them: %v", f.Email, f.Err)
+}
+
+// notifyShares sends notifications through notifier in the background and waits up to
+// wait (defaultNotifyWait when zero) for them, so a slow mail server can't hold up the share
+// call. It returns the ones that failed in the order given; notifications still being sent
+// when the wait is over finish on their own, with their failures only logged. Nothing is
+// sent without a notifier.
+func notifyShares(ctx context.Context, notifier Notifier, notifications []ShareNotification, wait time.Duration) []NotifyFailure {
+	if notifier == nil || len(notifications) == 0 {
+		return nil
+	}
+	if wait <= 0 {
+		wait = defaultNotifyWait
+	}
+	// The sends outlive the request, so they mustn't be cancelled along with it
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifySendTimeout)
+	done := make(chan []NotifyFailure, 1)
+	go func() {
+		defer cancel()
+		done <- sendNotifications(sendCtx, notifier, notifications)
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case failures := <-done:
+		return failures
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	log.Printf("notifying %d recipients of new shares continues in the background", len(notifications))
+	return nil
+}
+
+// sendNotifications sends notifications through notifier, in one batch when it supports
+// that, and returns the ones that failed in the order given. Failures are logged.
+func sendNotifications(ctx context.Context, notifier Notifier, notifications []ShareNotification) []NotifyFailure {
+	var errs []error
+	if batch, ok := notifier.(BatchNotifier); ok {
+		errs = batch.NotifyShares(ctx, notifications)
+	} else {
+		errs = make([]error, len(notifications))
+		sem := make(chan struct{}, notifyConcurrency)
+		var wg sync.WaitGroup
+		for i, n := range notifications {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				errs[i] = notifier.NotifyShare(ctx, n.RecipientEmail, n.Share)
+			}()
+		}
+		wg.Wait()
+	}
+
+	var failures []NotifyFailure
+	for i, n := range notifications {
+		var err error
+		if i < len(errs) {
+			err = errs[i]
+		} else {
+			err = fmt.Errorf("notification not sent")
+		}
+		if err == nil {
+			continue
+		}
+		log.Printf("warning: failed to notify %s of %s %s shared with them: %v", n.RecipientEmail, n.Share.Kind, n.Share.ItemID, err)
+		failures = append(failures, NotifyFailure{Email: n.RecipientEmail, ItemID: n.Share.ItemID, ItemName: n.Share.ItemName, Err: err})
+	}
+	return failures
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"fmt"
+	"io"
+)
+
+// unknownSizePartSize is the part size objects of unknown length are streamed in. Each
+// put buffers one part, and minio-go would otherwise size parts for a 5 TiB object.
+const unknownSizePartSize = 16 << 20
+
+// quotaReader counts the bytes read through it and fails once they pass limit, so
+// content of unknown length is cut off at the user's quota instead of read to the end.
+type quotaReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.n > q.limit {
+		return n, fmt.Errorf("%w: content is larger than the %d bytes left", ErrQuotaExceeded, q.limit)
+	}
+	return n, err
+}
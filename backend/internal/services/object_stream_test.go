@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// zeroReader is an endless stream of zero bytes that counts how much was read
+type zeroReader struct{ n int64 }
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	z.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestFileService_UploadFiles_UnknownSizeOverQuota(t *testing.T) {
+	repo := &stubFileRepo{usage: defaultQuotaBytes - 1000}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	src := &zeroReader{}
+	body := io.LimitReader(src, 64<<20)
+	uploads := []*graphql.Upload{{Filename: "stream.bin", File: struct {
+		io.Reader
+		io.Seeker
+	}{Reader: body}, Size: -1}}
+
+	_, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(failures) != 1 || !errors.Is(failures[0].Err, ErrQuotaExceeded) {
+		t.Fatalf("expected the upload to be over quota, got %+v", failures)
+	}
+	if src.n > 1<<20 {
+		t.Fatalf("expected the upload cut off near the quota, read %d of 64 MiB", src.n)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// maxOrganizationNameLen bounds organization names
+const maxOrganizationNameLen = 100
+
+// OrganizationService manages organizations and their shared storage quotas. Membership is
+// optional: users outside an organization only have their personal quota.
+type OrganizationService struct {
+	Repo repository.OrganizationRepository
+}
+
+func NewOrganizationService(repo repository.OrganizationRepository) *OrganizationService {
+	return &OrganizationService{Repo: repo}
+}
+
+// OrganizationUsage is an organization together with what its members store in total.
+type OrganizationUsage struct {
+	Organization models.Organization
+	UsedBytes    int64
+}
+
+// CreateOrganization creates an organization with an empty member list.
+func (s *OrganizationService) CreateOrganization(ctx context.Context, name string, quotaBytes int64) (*models.Organization, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("organization service not configured")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxOrganizationNameLen {
+		return nil, fmt.Errorf("organization name must be 1-%d characters", maxOrganizationNameLen)
+	}
+	if quotaBytes < 0 {
+		return nil, fmt.Errorf("organization quota must not be negative")
+	}
+	org := &models.Organization{Name: name, QuotaBytes: quotaBytes}
+	if err := s.Repo.CreateOrganization(ctx, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// SetQuota changes an organization's shared quota and returns it with its usage. Lowering
+// the quota below current usage stops members from adding new content; nothing already
+// stored is removed.
+func (s *OrganizationService) SetQuota(ctx context.Context, orgID uuid.UUID, quotaBytes int64) (*OrganizationUsage, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("organization service not configured")
+	}
+	if quotaBytes < 0 {
+		return nil, fmt.Errorf("organization quota must not be negative")
+	}
+	if err := s.Repo.SetQuota(ctx, orgID, quotaBytes); err != nil {
+		return nil, err
+	}
+	org, err := s.Repo.GetOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.Repo.GetOrganizationUsage(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationUsage{Organization: *org, UsedBytes: used}, nil
+}
+
+// AddMember puts a user in an organization. A user belongs to at most one organization,
+// so adding them elsewhere moves them.
+func (s *OrganizationService) AddMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	if s == nil || s.Repo == nil {
+		return fmt.Errorf("organization service not configured")
+	}
+	if _, err := s.Repo.GetOrganization(ctx, orgID); err != nil {
+		return err
+	}
+	return s.Repo.AddMember(ctx, orgID, userID)
+}
+
+// RemoveMember takes a user out of their organization, leaving them with their personal
+// quota only. It reports whether the user was a member.
+func (s *OrganizationService) RemoveMember(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if s == nil || s.Repo == nil {
+		return false, fmt.Errorf("organization service not configured")
+	}
+	return s.Repo.RemoveMember(ctx, userID)
+}
+
+// GetUserOrganization returns the user's organization and its usage, or nil when the user
+// has none.
+func (s *OrganizationService) GetUserOrganization(ctx context.Context, userID uuid.UUID) (*OrganizationUsage, error) {
+	if s == nil || s.Repo == nil {
+		return nil, fmt.Errorf("organization service not configured")
+	}
+	org, err := s.Repo.GetUserOrganization(ctx, userID)
+	if err != nil || org == nil {
+		return nil, err
+	}
+	used, err := s.Repo.GetOrganizationUsage(ctx, org.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationUsage{Organization: *org, UsedBytes: used}, nil
+}
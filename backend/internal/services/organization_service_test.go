@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// stubOrgRepo implements OrganizationRepository in memory; usage is summed from the
+// members' usage in files
+type stubOrgRepo struct {
+	orgs    map[uuid.UUID]*models.Organization
+	members map[uuid.UUID]uuid.UUID
+	files   *stubFileRepo
+}
+
+func (s *stubOrgRepo) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	if s.orgs == nil {
+		s.orgs = map[uuid.UUID]*models.Organization{}
+	}
+	org.ID, org.CreatedAt = uuid.New(), time.Now()
+	stored := *org
+	s.orgs[org.ID] = &stored
+	return nil
+}
+func (s *stubOrgRepo) GetOrganization(ctx context.Context, orgID uuid.UUID) (*models.Organization, error) {
+	org, ok := s.orgs[orgID]
+	if !ok {
+		return nil, fmt.Errorf("organization %s: %w", orgID, repository.ErrNotFound)
+	}
+	out := *org
+	return &out, nil
+}
+func (s *stubOrgRepo) GetUserOrganization(ctx context.Context, userID uuid.UUID) (*models.Organization, error) {
+	orgID, ok := s.members[userID]
+	if !ok {
+		return nil, nil
+	}
+	return s.GetOrganization(ctx, orgID)
+}
+func (s *stubOrgRepo) SetQuota(ctx context.Context, orgID uuid.UUID, quotaBytes int64) error {
+	org, ok := s.orgs[orgID]
+	if !ok {
+		return fmt.Errorf("organization %s: %w", orgID, repository.ErrNotFound)
+	}
+	org.QuotaBytes = quotaBytes
+	return nil
+}
+func (s *stubOrgRepo) AddMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	if s.members == nil {
+		s.members = map[uuid.UUID]uuid.UUID{}
+	}
+	s.members[userID] = orgID
+	return nil
+}
+func (s *stubOrgRepo) RemoveMember(ctx context.Context, userID uuid.UUID) (bool, error) {
+	_, ok := s.members[userID]
+	delete(s.members, userID)
+	return ok, nil
+}
+func (s *stubOrgRepo) GetOrganizationUsage(ctx context.Context, orgID uuid.UUID) (int64, error) {
+	var used int64
+	for userID, id := range s.members {
+		if id == orgID {
+			n, _ := s.files.GetUserUsageSum(ctx, userID)
+			used += n
+		}
+	}
+	return used, nil
+}
+
+func TestFileService_OrganizationQuotaAcrossMembers(t *testing.T) {
+	ctx := context.Background()
+	const size = 1024
+	alice, bob := uuid.New(), uuid.New()
+	// Bob has used all but two files' worth of the team pool; Alice has stored nothing
+	repo := &stubFileRepo{usageByUser: map[uuid.UUID]int64{alice: 0, bob: defaultQuotaBytes - 2*size}}
+	orgs := &stubOrgRepo{files: repo}
+	svc := NewOrganizationService(orgs)
+	org, err := svc.CreateOrganization(ctx, "Team", defaultQuotaBytes)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, u := range []uuid.UUID{alice, bob} {
+		if err := svc.AddMember(ctx, org.ID, u); err != nil {
+			t.Fatalf("add member: %v", err)
+		}
+	}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.Orgs = orgs
+
+	// Alice's personal quota is untouched, but the pool only has room for two files
+	files, failures, err := fs.UploadFiles(ctx, alice, knownUploads(repo, 5, size), "", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 2 || len(failures) != 3 {
+		t.Fatalf("expected 2 stored and 3 over the organization quota, got %d and %d", len(files), len(failures))
+	}
+	for _, f := range failures {
+		if !errors.Is(f.Err, ErrQuotaExceeded) {
+			t.Fatalf("expected quota failure, got %v", f.Err)
+		}
+	}
+	if used, quota, _ := fs.GetUserUsage(ctx, alice); used != 0 || quota != 2*size {
+		t.Fatalf("expected Alice's effective quota to be the pool's remaining %d, got %d of %d", 2*size, used, quota)
+	}
+	// Bob's personal remaining is the smaller limit here
+	if _, quota, _ := fs.GetUserUsage(ctx, bob); quota != defaultQuotaBytes {
+		t.Fatalf("expected Bob to keep the personal quota, got %d", quota)
+	}
+
+	// Leaving the organization restores the personal quota alone
+	if left, err := svc.RemoveMember(ctx, alice); err != nil || !left {
+		t.Fatalf("remove member: %v (%v)", left, err)
+	}
+	files, failures, err = fs.UploadFiles(ctx, alice, knownUploads(repo, 5, size), "", true)
+	if err != nil || len(files) != 5 || len(failures) != 0 {
+		t.Fatalf("expected all 5 files stored outside the organization, got %d and %d (%v)", len(files), len(failures), err)
+	}
+}
+
+func TestFileService_OrganizationQuota_CheckQuotaForUpload(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	repo := &stubFileRepo{usageByUser: map[uuid.UUID]int64{alice: 1000, bob: 3000}}
+	orgs := &stubOrgRepo{files: repo}
+	svc := NewOrganizationService(orgs)
+	org, _ := svc.CreateOrganization(ctx, "Team", 5000)
+	_ = svc.AddMember(ctx, org.ID, alice)
+	_ = svc.AddMember(ctx, org.ID, bob)
+	fs := NewFileService(repo, nil, "", "")
+	fs.Orgs = orgs
+
+	hash := strings.Repeat("a", 64)
+	check, err := fs.CheckQuotaForUpload(ctx, alice, []int64{1500}, []string{hash})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if check.RemainingBytes != 1000 || check.FitCount != 0 {
+		t.Fatalf("expected 1000 bytes left in the pool and no fit, got %d left and %d fitting", check.RemainingBytes, check.FitCount)
+	}
+
+	// Raising the pool makes room again
+	usage, err := svc.SetQuota(ctx, org.ID, 10000)
+	if err != nil || usage.UsedBytes != 4000 || usage.Organization.QuotaBytes != 10000 {
+		t.Fatalf("unexpected quota update %+v (%v)", usage, err)
+	}
+	if check, _ = fs.CheckQuotaForUpload(ctx, alice, []int64{1500}, []string{hash}); check.FitCount != 1 {
+		t.Fatalf("expected the file to fit after raising the quota, got %+v", check)
+	}
+}
+
+func TestOrganizationService_Validation(t *testing.T) {
+	ctx := context.Background()
+	svc := NewOrganizationService(&stubOrgRepo{})
+	if _, err := svc.CreateOrganization(ctx, "  ", 100); err == nil {
+		t.Fatalf("expected a blank name to be rejected")
+	}
+	if _, err := svc.CreateOrganization(ctx, "Team", -1); err == nil {
+		t.Fatalf("expected a negative quota to be rejected")
+	}
+	if err := svc.AddMember(ctx, uuid.New(), uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound adding to an unknown organization, got %v", err)
+	}
+	if usage, err := svc.GetUserOrganization(ctx, uuid.New()); err != nil || usage != nil {
+		t.Fatalf("expected no organization for a non-member, got %+v (%v)", usage, err)
+	}
+}
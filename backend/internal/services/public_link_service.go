@@ -5,10 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/useradityaa/internal/auth"
 	"github.com/useradityaa/internal/models"
 	"github.com/useradityaa/internal/repository"
 )
@@ -19,8 +22,25 @@ type PublicLinkService struct {
 	UserRepo   repository.UserRepository
 	FileRepo   repository.FileRepository
 	FolderRepo repository.FolderRepository
+	// MaxLifetime caps how far in the future a link may expire (zero = no cap)
+	MaxLifetime time.Duration
+	// MaxActiveLinks caps each user's unrevoked, unexpired links, file and folder links
+	// together (zero = no cap). Admins can override it per user
+	MaxActiveLinks int
 }
 
+// ErrLinkLimitReached is returned when creating a link would take the owner past their cap
+// on active public links.
+var ErrLinkLimitReached = errors.New("active public link limit reached")
+
+// ErrLinkPasswordRequired is returned when a password-protected link is resolved without a
+// password, and ErrLinkPasswordIncorrect when the password given doesn't match. Revoked and
+// expired links report as revoked before any password is checked.
+var (
+	ErrLinkPasswordRequired  = errors.New("this link is password protected")
+	ErrLinkPasswordIncorrect = errors.New("incorrect link password")
+)
+
 func NewPublicLinkService(pub repository.PublicLinkRepository, share repository.ShareRepository, user repository.UserRepository, file repository.FileRepository, folder repository.FolderRepository) *PublicLinkService {
 	return &PublicLinkService{PublicRepo: pub, ShareRepo: share, UserRepo: user, FileRepo: file, FolderRepo: folder}
 }
@@ -34,79 +54,387 @@ func generateToken() (string, error) {
 	return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "="), nil
 }
 
-func (s *PublicLinkService) CreateFileLink(ctx context.Context, ownerID, fileID uuid.UUID, expiresAt *time.Time) (string, *time.Time, error) {
-	// Verify ownership
-	has, role, err := s.ShareRepo.HasFileAccess(ctx, ownerID, "", fileID)
-	if err != nil || !has || role != "owner" {
-		return "", nil, errors.New("not owner of file")
+// hashLinkPassword returns the bcrypt hash to store for a link password, nil for none.
+func hashLinkPassword(password string) (*string, error) {
+	if password == "" {
+		return nil, nil
 	}
-	token, err := generateToken()
+	hash, err := auth.HashPassword(password)
 	if err != nil {
+		return nil, fmt.Errorf("failed to hash link password: %w", err)
+	}
+	return &hash, nil
+}
+
+// checkLinkPassword verifies password against a link's stored hash; links without one
+// accept any password.
+func checkLinkPassword(hash *string, password string) error {
+	if hash == nil {
+		return nil
+	}
+	if password == "" {
+		return ErrLinkPasswordRequired
+	}
+	if auth.CheckPasswordHash(password, *hash) != nil {
+		return ErrLinkPasswordIncorrect
+	}
+	return nil
+}
+
+// CreateFileLink creates a public link to the file. With a non-empty password the link only
+// resolves for those who know it; with maxDownloads above zero it expires after being
+// resolved that many times.
+//
+// A file has at most one usable link. Sharing a file that already has one returns that
+// link's token, so the link stays stable, unless the call asks for an expiry, password or
+// download limit, or forceNew is set: then a new token replaces it and the old one is
+// revoked. The returned state is the link as stored.
+func (s *PublicLinkService) CreateFileLink(ctx context.Context, ownerID, fileID uuid.UUID, expiresAt *time.Time, password string, maxDownloads int, forceNew bool) (string, *models.LinkState, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
 		return "", nil, err
 	}
-	if err := s.PublicRepo.CreateFileLink(ctx, fileID, ownerID, token, expiresAt); err != nil {
+	if err := validateExpiry(expiresAt, s.MaxLifetime); err != nil {
 		return "", nil, err
 	}
-	return token, expiresAt, nil
+	if maxDownloads < 0 {
+		return "", nil, fmt.Errorf("max downloads must not be negative")
+	}
+	var maxPtr *int64
+	if maxDownloads > 0 {
+		n := int64(maxDownloads)
+		maxPtr = &n
+	}
+
+	current, state, err := s.PublicRepo.GetActiveFileLinkByFile(ctx, fileID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return "", nil, err
+	}
+	active := err == nil && linkUsable(state)
+	if active && !forceNew && expiresAt == nil && password == "" && maxDownloads == 0 {
+		return current, state, nil
+	}
+	// Replacing an active link leaves the owner's number of links as it was
+	limit := -1
+	if !active {
+		if limit, err = s.linkCap(ctx, ownerID); err != nil {
+			return "", nil, err
+		}
+	}
+	passwordHash, err := hashLinkPassword(password)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	if forceNew || active {
+		err = s.PublicRepo.ReplaceFileLink(ctx, fileID, ownerID, token, expiresAt, passwordHash, maxPtr, limit)
+	} else {
+		err = s.PublicRepo.CreateFileLink(ctx, fileID, ownerID, token, expiresAt, passwordHash, maxPtr, limit)
+	}
+	if err != nil {
+		return "", nil, linkLimitErr(err, limit)
+	}
+	stored, state, err := s.PublicRepo.GetActiveFileLinkByFile(ctx, fileID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load the new link: %w", err)
+	}
+	if stored != token {
+		// Another share of the file landed in between. A plain share takes its link, as it
+		// would have had it come first; one with settings must not hand out a link without them.
+		if !forceNew && expiresAt == nil && password == "" && maxDownloads == 0 && linkUsable(state) {
+			return stored, state, nil
+		}
+		return "", nil, fmt.Errorf("public link of file %s changed meanwhile, try again", fileID)
+	}
+	return token, state, nil
 }
 
 func (s *PublicLinkService) RevokeFileLink(ctx context.Context, ownerID, fileID uuid.UUID) error {
-	has, role, err := s.ShareRepo.HasFileAccess(ctx, ownerID, "", fileID)
-	if err != nil || !has || role != "owner" {
-		return errors.New("not owner")
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
+		return err
 	}
 	return s.PublicRepo.RevokeFileLink(ctx, fileID)
 }
 
-func (s *PublicLinkService) ResolveFileLink(ctx context.Context, token string) (*models.File, *models.User, *time.Time, bool, error) {
-	f, owner, expiresAt, revokedAt, err := s.PublicRepo.GetFileLinkResolve(ctx, token)
+// RotateFileLink replaces the token of the file's public link, e.g. after it leaked. The old
+// token resolves as revoked from then on. With preserve the download count and expiry carry
+// over to the new token, along with any download limit; otherwise it starts fresh with no
+// expiry or limit. A password stays either way.
+func (s *PublicLinkService) RotateFileLink(ctx context.Context, ownerID, fileID uuid.UUID, preserve bool) (string, *time.Time, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
+		return "", nil, err
+	}
+	token, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	expiresAt, err := s.PublicRepo.RotateFileLink(ctx, fileID, token, preserve)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, expiresAt, nil
+}
+
+// linkUsable reports whether a link is neither revoked, expired nor out of downloads
+func linkUsable(state *models.LinkState) bool {
+	if state.RevokedAt != nil || state.Exhausted() {
+		return false
+	}
+	return state.ExpiresAt == nil || !state.ExpiresAt.Before(time.Now())
+}
+
+// CheckFileLink returns the file behind a link like ResolveFileLink, password check
+// included, but counts no download. It is for using a link without fetching the file,
+// such as saving it to one's own storage, which a link out of downloads still refuses.
+func (s *PublicLinkService) CheckFileLink(ctx context.Context, token, password string) (*models.File, *models.User, *time.Time, bool, error) {
+	f, owner, state, err := s.PublicRepo.GetFileLinkResolve(ctx, token)
 	if err != nil {
 		return nil, nil, nil, false, err
 	}
-	if revokedAt != nil {
+	if !linkUsable(state) {
 		return nil, nil, nil, true, nil
 	}
-	if expiresAt != nil && expiresAt.Before(time.Now()) {
+	if err := checkLinkPassword(state.PasswordHash, password); err != nil {
+		return nil, nil, nil, false, err
+	}
+	return f, owner, state.ExpiresAt, false, nil
+}
+
+// ResolveFileLink returns the file behind a link and counts it as a download, reporting
+// revoked for revoked and expired links and links out of downloads. A password-protected
+// link needs its password, failing with ErrLinkPasswordRequired or ErrLinkPasswordIncorrect
+// otherwise; refused attempts aren't counted.
+func (s *PublicLinkService) ResolveFileLink(ctx context.Context, token, password string) (*models.File, *models.User, *time.Time, bool, error) {
+	f, owner, expiresAt, revoked, err := s.CheckFileLink(ctx, token, password)
+	if err != nil || revoked {
+		return nil, nil, nil, revoked, err
+	}
+	// The limit is enforced by the increment itself, so of several resolves racing for the
+	// last download only one gets it
+	counted, err := s.PublicRepo.IncrementFileDownload(ctx, token)
+	if err != nil {
+		return nil, nil, nil, false, fmt.Errorf("failed to count download: %w", err)
+	}
+	if !counted {
 		return nil, nil, nil, true, nil
 	}
 	return f, owner, expiresAt, false, nil
 }
 
-func (s *PublicLinkService) CreateFolderLink(ctx context.Context, ownerID, folderID uuid.UUID, expiresAt *time.Time) (string, *time.Time, error) {
-	has, role, err := s.ShareRepo.HasFolderAccess(ctx, ownerID, "", folderID)
-	if err != nil || !has || role != "owner" {
-		return "", nil, errors.New("not owner of folder")
+// LinkStatus says whether a public link can currently be used
+type LinkStatus string
+
+const (
+	LinkValid    LinkStatus = "valid"
+	LinkExpired  LinkStatus = "expired"
+	LinkRevoked  LinkStatus = "revoked"
+	LinkNotFound LinkStatus = "not_found"
+)
+
+// FileLinkInfo is what a public link landing page may show before the file is fetched.
+// File details are only filled in for valid links without a password.
+type FileLinkInfo struct {
+	Status    LinkStatus
+	FileName  string
+	MimeType  string
+	Size      int64
+	ExpiresAt *time.Time
+	// PasswordProtected is set for valid links that need a password to resolve
+	PasswordProtected bool
+}
+
+// InspectFileLink reports a file link's status without resolving it for download: no
+// download is counted and nothing about the owner is returned. A revoked link reports as
+// revoked even when it had also expired, and a link out of downloads as expired. Unknown
+// tokens are LinkNotFound, not an error.
+func (s *PublicLinkService) InspectFileLink(ctx context.Context, token string) (*FileLinkInfo, error) {
+	f, _, state, err := s.PublicRepo.GetFileLinkResolve(ctx, token)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &FileLinkInfo{Status: LinkNotFound}, nil
 	}
-	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := state.ExpiresAt
+	switch {
+	case state.RevokedAt != nil:
+		return &FileLinkInfo{Status: LinkRevoked}, nil
+	case !linkUsable(state):
+		return &FileLinkInfo{Status: LinkExpired, ExpiresAt: expiresAt}, nil
+	case state.PasswordHash != nil:
+		return &FileLinkInfo{Status: LinkValid, ExpiresAt: expiresAt, PasswordProtected: true}, nil
+	}
+	return &FileLinkInfo{Status: LinkValid, FileName: f.OriginalName, MimeType: f.MimeType, Size: f.Size, ExpiresAt: expiresAt}, nil
+}
+
+// CreateFolderLink creates a public link to the folder, optionally password protected; see
+// CreateFileLink.
+func (s *PublicLinkService) CreateFolderLink(ctx context.Context, ownerID, folderID uuid.UUID, expiresAt *time.Time, password string) (string, *time.Time, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, folderID); err != nil {
+		return "", nil, err
+	}
+	if err := validateExpiry(expiresAt, s.MaxLifetime); err != nil {
+		return "", nil, err
+	}
+	limit, err := s.linkCap(ctx, ownerID)
+	if err != nil {
+		return "", nil, err
+	}
+	passwordHash, err := hashLinkPassword(password)
 	if err != nil {
 		return "", nil, err
 	}
-	if err := s.PublicRepo.CreateFolderLink(ctx, folderID, ownerID, token, expiresAt); err != nil {
+	token, err := generateToken()
+	if err != nil {
 		return "", nil, err
 	}
+	if err := s.PublicRepo.CreateFolderLink(ctx, folderID, ownerID, token, expiresAt, passwordHash, limit); err != nil {
+		return "", nil, linkLimitErr(err, limit)
+	}
 	return token, expiresAt, nil
 }
 
 func (s *PublicLinkService) RevokeFolderLink(ctx context.Context, ownerID, folderID uuid.UUID) error {
-	has, role, err := s.ShareRepo.HasFolderAccess(ctx, ownerID, "", folderID)
-	if err != nil || !has || role != "owner" {
-		return errors.New("not owner")
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, folderID); err != nil {
+		return err
 	}
 	return s.PublicRepo.RevokeFolderLink(ctx, folderID)
 }
 
-func (s *PublicLinkService) ResolveFolderLink(ctx context.Context, token string) (*models.Folder, *models.User, *time.Time, bool, error) {
-	fo, owner, expiresAt, revokedAt, err := s.PublicRepo.GetFolderLinkResolve(ctx, token)
+// RotateFolderLink replaces the token of the folder's public link; see RotateFileLink.
+func (s *PublicLinkService) RotateFolderLink(ctx context.Context, ownerID, folderID uuid.UUID, preserve bool) (string, *time.Time, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, folderID); err != nil {
+		return "", nil, err
+	}
+	token, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	expiresAt, err := s.PublicRepo.RotateFolderLink(ctx, folderID, token, preserve)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, expiresAt, nil
+}
+
+// ResolveFolderLink returns the folder behind a link, checking its password like
+// ResolveFileLink.
+func (s *PublicLinkService) ResolveFolderLink(ctx context.Context, token, password string) (*models.Folder, *models.User, *time.Time, bool, error) {
+	fo, owner, state, err := s.PublicRepo.GetFolderLinkResolve(ctx, token)
 	if err != nil {
 		return nil, nil, nil, false, err
 	}
-	if revokedAt != nil {
+	if !linkUsable(state) {
 		return nil, nil, nil, true, nil
 	}
-	if expiresAt != nil && expiresAt.Before(time.Now()) {
-		return nil, nil, nil, true, nil
+	if err := checkLinkPassword(state.PasswordHash, password); err != nil {
+		return nil, nil, nil, false, err
+	}
+	return fo, owner, state.ExpiresAt, false, nil
+}
+
+// PublicFolderListing is the browsable view of a folder reached through a public link.
+type PublicFolderListing struct {
+	Folder     *models.Folder
+	Owner      *models.User
+	ExpiresAt  *time.Time
+	Subfolders []models.Folder
+	Files      []models.UserFile
+}
+
+// BrowsePublicFolder validates a folder link and its password and returns the folder's
+// subfolders and files. When recursive is false only the direct children are listed;
+// otherwise the whole tree is flattened into Subfolders and Files. Each successful browse
+// bumps the link's access count.
+func (s *PublicLinkService) BrowsePublicFolder(ctx context.Context, token, password string, recursive bool) (*PublicFolderListing, error) {
+	if s == nil || s.PublicRepo == nil || s.ShareRepo == nil {
+		return nil, errors.New("public link service not configured")
+	}
+	folder, owner, expiresAt, revoked, err := s.ResolveFolderLink(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+	if revoked || folder == nil {
+		return nil, errors.New("folder link not found or has been revoked")
+	}
+
+	subfolders, files, err := s.listPublicFolder(ctx, folder.ID, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Access counting is best effort; a failed counter update shouldn't hide the listing
+	if err := s.PublicRepo.IncrementFolderAccess(ctx, token); err != nil {
+		log.Printf("WARNING: failed to increment folder link access count: %v", err)
+	}
+
+	return &PublicFolderListing{
+		Folder:     folder,
+		Owner:      owner,
+		ExpiresAt:  expiresAt,
+		Subfolders: subfolders,
+		Files:      files,
+	}, nil
+}
+
+// ResolvePublicFolderFile returns a file reachable through a public folder link, checking that
+// it lives somewhere under the linked folder. Callers use it before handing out a download URL.
+func (s *PublicLinkService) ResolvePublicFolderFile(ctx context.Context, token, password string, fileID uuid.UUID) (*models.UserFile, *models.User, error) {
+	if s == nil || s.PublicRepo == nil || s.ShareRepo == nil {
+		return nil, nil, errors.New("public link service not configured")
+	}
+	folder, owner, _, revoked, err := s.ResolveFolderLink(ctx, token, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked || folder == nil {
+		return nil, nil, errors.New("folder link not found or has been revoked")
 	}
-	return fo, owner, expiresAt, false, nil
+
+	_, files, err := s.listPublicFolder(ctx, folder.ID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		if files[i].FileID == fileID {
+			return &files[i], owner, nil
+		}
+	}
+	return nil, nil, errors.New("file not found in public folder")
+}
+
+// listPublicFolder collects the subfolders and files under folderID without any user filtering.
+func (s *PublicLinkService) listPublicFolder(ctx context.Context, folderID uuid.UUID, recursive bool) ([]models.Folder, []models.UserFile, error) {
+	files, err := s.ShareRepo.GetFolderFiles(ctx, folderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get folder files: %w", err)
+	}
+
+	if !recursive {
+		subfolders, err := s.ShareRepo.GetDirectSubfolders(ctx, folderID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get subfolders: %w", err)
+		}
+		return subfolders, files, nil
+	}
+
+	if s.FolderRepo == nil {
+		return nil, nil, errors.New("folder repository not configured")
+	}
+	subfolders, err := s.FolderRepo.GetAllSubfolders(ctx, uuid.Nil, folderID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get subfolders: %w", err)
+	}
+	for _, sub := range subfolders {
+		subFiles, err := s.ShareRepo.GetFolderFiles(ctx, sub.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get files from subfolder %s: %w", sub.ID, err)
+		}
+		files = append(files, subFiles...)
+	}
+	return subfolders, files, nil
 }
 
 // AddPublicFileToStorage creates user_file mapping if not already present.
@@ -114,17 +442,171 @@ func (s *PublicLinkService) AddPublicFileToStorage(ctx context.Context, userID,
 	if s == nil || s.FileRepo == nil {
 		return errors.New("file repository not configured")
 	}
-	// Determine mapping status before attempting to add
-	prevStatus, _ := s.FileRepo.GetUserFileMappingStatus(ctx, userID, fileID)
-	inserted, err := s.FileRepo.AddUserFile(ctx, userID, fileID, "viewer")
+	_, err := s.FileRepo.AddUserFile(ctx, userID, fileID, "viewer")
+	return err
+}
+
+// MyPublicLinks is an owner's active public links, with how many point at files and folders
+type MyPublicLinks struct {
+	Links       []models.PublicLink
+	FileLinks   int
+	FolderLinks int
+}
+
+// ListMyPublicLinks lists the owner's unrevoked, unexpired file and folder links, newest
+// first, with each link's expiry and download or access count.
+func (s *PublicLinkService) ListMyPublicLinks(ctx context.Context, ownerID uuid.UUID) (*MyPublicLinks, error) {
+	links, err := s.PublicRepo.ListActiveLinksByOwner(ctx, ownerID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// Increment ref_count only if this user had no previous mapping (active or deleted) and we inserted a new one
-	if prevStatus == "none" && inserted {
-		if err := s.FileRepo.IncrementRefCount(ctx, fileID); err != nil {
-			return err
+	out := &MyPublicLinks{Links: links}
+	for _, l := range links {
+		if l.ItemType == "folder" {
+			out.FolderLinks++
+		} else {
+			out.FileLinks++
 		}
 	}
-	return nil
+	return out, nil
+}
+
+// Granularities of a link's download timeline
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+// maxLinkStatsBuckets caps how many buckets one timeline may span: a month of hours, or
+// about two years of days
+const maxLinkStatsBuckets = 31 * 24
+
+// defaultLinkStatsRange is the timeline GetLinkStats covers when no range is given
+const defaultLinkStatsRange = 30 * 24 * time.Hour
+
+// LinkStats is how often a file's public link has been downloaded: in total, and per hour
+// or day over a range.
+type LinkStats struct {
+	Token string
+	// TotalDownloads counts the link's recorded downloads over its whole life, from the same
+	// file_downloads rows as Buckets. It can differ from the link's download counter, which
+	// a rotation may carry over from the previous token
+	TotalDownloads int64
+	Granularity    string
+	From, To       time.Time
+	// Buckets cover From to To oldest first, including those without downloads
+	Buckets []models.DownloadBucket
+}
+
+// GetLinkStats returns the download timeline of the file's current public link between from
+// and to, in buckets of granularity (BucketDay when empty). Without a range the last 30 days
+// are covered; from is rounded down to the start of its bucket. Only the file's owner may
+// see the stats.
+func (s *PublicLinkService) GetLinkStats(ctx context.Context, ownerID, fileID uuid.UUID, from, to *time.Time, granularity string) (*LinkStats, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
+		return nil, err
+	}
+	step := 24 * time.Hour
+	switch granularity {
+	case "", BucketDay:
+		granularity = BucketDay
+	case BucketHour:
+		step = time.Hour
+	default:
+		return nil, fmt.Errorf("unknown granularity %q", granularity)
+	}
+	end := time.Now().UTC()
+	if to != nil {
+		end = to.UTC()
+	}
+	start := end.Add(-defaultLinkStatsRange)
+	if from != nil {
+		start = from.UTC()
+	}
+	start = start.Truncate(step)
+	if !start.Before(end) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	if end.Sub(start) > maxLinkStatsBuckets*step {
+		return nil, fmt.Errorf("range too long: at most %d %s buckets", maxLinkStatsBuckets, granularity)
+	}
+
+	token, _, err := s.PublicRepo.GetActiveFileLinkByFile(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file has no public link: %w", err)
+	}
+	counts, err := s.PublicRepo.GetLinkDownloadBuckets(ctx, token, start, end, granularity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count downloads: %w", err)
+	}
+	total, err := s.PublicRepo.CountLinkDownloads(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count downloads: %w", err)
+	}
+	byStart := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		byStart[c.Start.Unix()] = c.Downloads
+	}
+
+	stats := &LinkStats{Token: token, TotalDownloads: total, Granularity: granularity, From: start, To: end}
+	for t := start; t.Before(end); t = t.Add(step) {
+		stats.Buckets = append(stats.Buckets, models.DownloadBucket{Start: t, Downloads: byStart[t.Unix()]})
+	}
+	return stats, nil
+}
+
+// RevokeAllMyPublicLinks revokes every public link the owner has, files and folders alike,
+// in one transaction so nothing they shared publicly stays reachable. Returns how many
+// links were revoked.
+func (s *PublicLinkService) RevokeAllMyPublicLinks(ctx context.Context, ownerID uuid.UUID) (int, error) {
+	files, folders, err := s.PublicRepo.RevokeAllLinksByOwner(ctx, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke public links: %w", err)
+	}
+	return files + folders, nil
+}
+
+// LinkLimit returns the user's cap on active public links: their admin override when one
+// is set, else MaxActiveLinks. Zero means no cap unless it comes from an override, which
+// stops the user from creating links at all; overridden reports which applies.
+func (s *PublicLinkService) LinkLimit(ctx context.Context, userID uuid.UUID) (limit int, overridden bool, err error) {
+	override, err := s.PublicRepo.GetLinkLimit(ctx, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	if override != nil {
+		return *override, true, nil
+	}
+	return s.MaxActiveLinks, false, nil
+}
+
+// SetLinkLimit overrides a user's cap on active public links; nil returns them to the
+// configured default. Links above a lowered cap stay active, the user just can't add more.
+func (s *PublicLinkService) SetLinkLimit(ctx context.Context, userID uuid.UUID, limit *int) error {
+	if limit != nil && *limit < 0 {
+		return fmt.Errorf("link limit must not be negative")
+	}
+	return s.PublicRepo.SetLinkLimit(ctx, userID, limit)
+}
+
+// linkCap returns the number of active links ownerID may have for the repository to hold
+// new links to, -1 when they are uncapped. Revoked and expired links don't count, and
+// rotating a link replaces it, so only creation is capped.
+func (s *PublicLinkService) linkCap(ctx context.Context, ownerID uuid.UUID) (int, error) {
+	limit, overridden, err := s.LinkLimit(ctx, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	if limit == 0 && !overridden {
+		return -1, nil
+	}
+	return limit, nil
+}
+
+// linkLimitErr turns the repository's ErrLinkLimit into ErrLinkLimitReached
+func linkLimitErr(err error, limit int) error {
+	if errors.Is(err, repository.ErrLinkLimit) {
+		return fmt.Errorf("%w: the limit is %d links, revoke one to create another", ErrLinkLimitReached, limit)
+	}
+	return err
 }
@@ -0,0 +1,1464 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// stubPublicLinkRepo implements PublicLinkRepository with a single in-memory folder link
+// plus token-keyed file links for the create/rotate paths
+type stubPublicLinkRepo struct {
+	// mu guards file link downloads, which resolves may count concurrently
+	mu          sync.Mutex
+	folder      *models.Folder
+	owner       *models.User
+	expiresAt   *time.Time
+	revokedAt   *time.Time
+	accessCount int
+	// passwordHash is the folder link's, as stored by CreateFolderLink
+	passwordHash *string
+	// fileLinks is keyed by token, in creation order per file
+	fileLinks map[string]*stubFileLink
+	// active backs ListActiveLinksByOwner, keyed by owner
+	active map[uuid.UUID][]models.PublicLink
+	// folderLinks counts CreateFolderLink calls per owner; limits holds per-user cap overrides
+	folderLinks map[uuid.UUID]int
+	limits      map[uuid.UUID]int
+	// recorded holds the file_downloads times of each share token
+	recorded map[string][]time.Time
+	// beforeCreate runs once at the start of the next CreateFileLink, standing in for a
+	// concurrent share by the owner
+	beforeCreate func(fileID uuid.UUID)
+}
+
+type stubFileLink struct {
+	fileID, ownerID uuid.UUID
+	expiresAt       *time.Time
+	revokedAt       *time.Time
+	passwordHash    *string
+	maxDownloads    *int64
+	name            string
+	size            int64
+	downloads       int64
+	seq             int
+}
+
+// checkLimit is the repository's in-transaction count of the owner's active links
+func (s *stubPublicLinkRepo) checkLimit(ownerID uuid.UUID, limit int) error {
+	if limit < 0 {
+		return nil
+	}
+	if n, _ := s.CountActiveLinksByOwner(context.Background(), ownerID); n >= limit {
+		return repository.ErrLinkLimit
+	}
+	return nil
+}
+func (s *stubPublicLinkRepo) CreateFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, maxDownloads *int64, limit int) error {
+	if s.fileLinks == nil {
+		s.fileLinks = map[string]*stubFileLink{}
+	}
+	if s.beforeCreate != nil {
+		hook := s.beforeCreate
+		s.beforeCreate = nil
+		hook(fileID)
+	}
+	if err := s.checkLimit(ownerID, limit); err != nil {
+		return err
+	}
+	// Like uq_file_public_links_active: stale links are revoked, a usable one wins
+	now := time.Now()
+	for _, l := range s.fileLinks {
+		if l.fileID != fileID || l.revokedAt != nil {
+			continue
+		}
+		if !linkUsable(&models.LinkState{ExpiresAt: l.expiresAt, Downloads: l.downloads, MaxDownloads: l.maxDownloads}) {
+			l.revokedAt = &now
+			continue
+		}
+		return nil
+	}
+	s.fileLinks[token] = &stubFileLink{fileID: fileID, ownerID: ownerID, expiresAt: expiresAt, passwordHash: passwordHash, maxDownloads: maxDownloads, seq: len(s.fileLinks)}
+	return nil
+}
+func (s *stubPublicLinkRepo) ReplaceFileLink(ctx context.Context, fileID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, maxDownloads *int64, limit int) error {
+	if err := s.checkLimit(ownerID, limit); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, l := range s.fileLinks {
+		if l.fileID == fileID && l.revokedAt == nil {
+			l.revokedAt = &now
+		}
+	}
+	return s.CreateFileLink(ctx, fileID, ownerID, token, expiresAt, passwordHash, maxDownloads, -1)
+}
+func (s *stubPublicLinkRepo) GetActiveFileLinkByFile(ctx context.Context, fileID uuid.UUID) (string, *models.LinkState, error) {
+	token, latest := "", (*stubFileLink)(nil)
+	for t, l := range s.fileLinks {
+		if l.fileID == fileID && (latest == nil || l.seq > latest.seq) {
+			token, latest = t, l
+		}
+	}
+	if latest == nil {
+		return "", nil, fmt.Errorf("public file link: %w", repository.ErrNotFound)
+	}
+	return token, &models.LinkState{ExpiresAt: latest.expiresAt, RevokedAt: latest.revokedAt, PasswordHash: latest.passwordHash, Downloads: latest.downloads, MaxDownloads: latest.maxDownloads}, nil
+}
+func (s *stubPublicLinkRepo) GetFileLinkResolve(ctx context.Context, token string) (*models.File, *models.User, *models.LinkState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.fileLinks[token]
+	if l == nil {
+		return nil, nil, nil, fmt.Errorf("public file link: %w", repository.ErrNotFound)
+	}
+	state := &models.LinkState{ExpiresAt: l.expiresAt, RevokedAt: l.revokedAt, PasswordHash: l.passwordHash, Downloads: l.downloads, MaxDownloads: l.maxDownloads}
+	return &models.File{ID: l.fileID, OriginalName: l.name, Size: l.size}, &models.User{ID: l.ownerID}, state, nil
+}
+func (s *stubPublicLinkRepo) RevokeFileLink(ctx context.Context, fileID uuid.UUID) error { return nil }
+func (s *stubPublicLinkRepo) CreateFolderLink(ctx context.Context, folderID, ownerID uuid.UUID, token string, expiresAt *time.Time, passwordHash *string, limit int) error {
+	if s.folderLinks == nil {
+		s.folderLinks = map[uuid.UUID]int{}
+	}
+	if err := s.checkLimit(ownerID, limit); err != nil {
+		return err
+	}
+	s.folderLinks[ownerID]++
+	s.passwordHash = passwordHash
+	return nil
+}
+func (s *stubPublicLinkRepo) GetActiveFolderLinkByFolder(ctx context.Context, folderID uuid.UUID) (string, *time.Time, *time.Time, error) {
+	return "", nil, nil, nil
+}
+func (s *stubPublicLinkRepo) GetFolderLinkResolve(ctx context.Context, token string) (*models.Folder, *models.User, *models.LinkState, error) {
+	if s.folder == nil {
+		return nil, nil, nil, errors.New("no rows in result set")
+	}
+	return s.folder, s.owner, &models.LinkState{ExpiresAt: s.expiresAt, RevokedAt: s.revokedAt, PasswordHash: s.passwordHash}, nil
+}
+func (s *stubPublicLinkRepo) RevokeFolderLink(ctx context.Context, folderID uuid.UUID) error {
+	return nil
+}
+func (s *stubPublicLinkRepo) IncrementFileDownload(ctx context.Context, token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.fileLinks[token]
+	if l == nil || l.revokedAt != nil || (l.maxDownloads != nil && l.downloads >= *l.maxDownloads) {
+		return false, nil
+	}
+	l.downloads++
+	return true, nil
+}
+func (s *stubPublicLinkRepo) IncrementFolderAccess(ctx context.Context, token string) error {
+	s.accessCount++
+	return nil
+}
+func (s *stubPublicLinkRepo) RotateFileLink(ctx context.Context, fileID uuid.UUID, newToken string, preserve bool) (*time.Time, error) {
+	var latest *stubFileLink
+	now := time.Now()
+	for _, l := range s.fileLinks {
+		if l.fileID != fileID || l.revokedAt != nil {
+			continue
+		}
+		if latest == nil || l.seq > latest.seq {
+			latest = l
+		}
+		l.revokedAt = &now
+	}
+	if latest == nil {
+		return nil, errors.New("no active link")
+	}
+	next := &stubFileLink{fileID: fileID, ownerID: latest.ownerID, passwordHash: latest.passwordHash, seq: len(s.fileLinks)}
+	if preserve {
+		next.expiresAt, next.downloads, next.maxDownloads = latest.expiresAt, latest.downloads, latest.maxDownloads
+	}
+	s.fileLinks[newToken] = next
+	return next.expiresAt, nil
+}
+func (s *stubPublicLinkRepo) RotateFolderLink(ctx context.Context, folderID uuid.UUID, newToken string, preserve bool) (*time.Time, error) {
+	return nil, errors.New("no active link")
+}
+func (s *stubPublicLinkRepo) ListActiveLinksByOwner(ctx context.Context, ownerID uuid.UUID) ([]models.PublicLink, error) {
+	return s.active[ownerID], nil
+}
+func (s *stubPublicLinkRepo) CountActiveLinksByOwner(ctx context.Context, ownerID uuid.UUID) (int, error) {
+	n := s.folderLinks[ownerID]
+	for _, l := range s.fileLinks {
+		exhausted := l.maxDownloads != nil && l.downloads >= *l.maxDownloads
+		if l.ownerID == ownerID && l.revokedAt == nil && (l.expiresAt == nil || l.expiresAt.After(time.Now())) && !exhausted {
+			n++
+		}
+	}
+	return n, nil
+}
+func (s *stubPublicLinkRepo) RevokeAllLinksByOwner(ctx context.Context, ownerID uuid.UUID) (int, int, error) {
+	now := time.Now()
+	files := 0
+	for _, l := range s.fileLinks {
+		if l.ownerID == ownerID && l.revokedAt == nil {
+			l.revokedAt = &now
+			files++
+		}
+	}
+	folders := s.folderLinks[ownerID]
+	delete(s.folderLinks, ownerID)
+	delete(s.active, ownerID)
+	return files, folders, nil
+}
+func (s *stubPublicLinkRepo) GetLinkDownloadBuckets(ctx context.Context, token string, from, to time.Time, bucket string) ([]models.DownloadBucket, error) {
+	step := 24 * time.Hour
+	if bucket == "hour" {
+		step = time.Hour
+	}
+	counts := map[time.Time]int64{}
+	for _, at := range s.recorded[token] {
+		if !at.Before(from) && at.Before(to) {
+			counts[at.UTC().Truncate(step)]++
+		}
+	}
+	var out []models.DownloadBucket
+	for start, n := range counts {
+		out = append(out, models.DownloadBucket{Start: start, Downloads: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out, nil
+}
+func (s *stubPublicLinkRepo) CountLinkDownloads(ctx context.Context, token string) (int64, error) {
+	return int64(len(s.recorded[token])), nil
+}
+func (s *stubPublicLinkRepo) GetLinkLimit(ctx context.Context, userID uuid.UUID) (*int, error) {
+	if limit, ok := s.limits[userID]; ok {
+		return &limit, nil
+	}
+	return nil, nil
+}
+func (s *stubPublicLinkRepo) SetLinkLimit(ctx context.Context, userID uuid.UUID, limit *int) error {
+	if s.limits == nil {
+		s.limits = map[uuid.UUID]int{}
+	}
+	if limit == nil {
+		delete(s.limits, userID)
+	} else {
+		s.limits[userID] = *limit
+	}
+	return nil
+}
+
+// stubShareRepo implements ShareRepository over fixed folder contents
+type stubShareRepo struct {
+	files      map[uuid.UUID][]models.UserFile
+	subfolders map[uuid.UUID][]models.Folder
+	// access backs GetFileShareAccess, keyed by file
+	access map[uuid.UUID][]models.ShareAccess
+	// notOwner makes HasFileAccess and HasFolderAccess report a viewer instead of the owner
+	notOwner bool
+	// noAccess makes HasFileAccess deny access entirely, except to files in public
+	noAccess bool
+	// public lists files an owner made public; they grant viewer access to anyone
+	public map[uuid.UUID]bool
+	// permissions records created shares as file or folder id -> email -> permission
+	permissions map[uuid.UUID]map[string]string
+	// levels backs the batched access lookups, keyed by item id; levelQueries counts the calls
+	levels       map[uuid.UUID]string
+	levelQueries int
+	// bulkShareCalls counts CreateFileShares calls
+	bulkShareCalls int
+	// fileShares and folderShares back the by-owner and for-user share listings
+	fileShares   []models.FileShare
+	folderShares []models.FolderShare
+	// mapped, when set, makes GetFolderFiles list the active mappings it holds in the folder
+	mapped *stubFileRepo
+	// folderOwners, when set, makes HasFolderAccess grant owner access to a folder's owner
+	// only and otherwise the permission it was shared with to the caller's email
+	folderOwners map[uuid.UUID]uuid.UUID
+}
+
+func (s *stubShareRepo) setPermission(id uuid.UUID, email, permission string) {
+	if s.permissions == nil {
+		s.permissions = map[uuid.UUID]map[string]string{}
+	}
+	if s.permissions[id] == nil {
+		s.permissions[id] = map[string]string{}
+	}
+	s.permissions[id][email] = permission
+}
+
+func (s *stubShareRepo) CreateFileShare(ctx context.Context, fileID, ownerID uuid.UUID, sharedWithEmail string, permission string, expiresAt *time.Time) (*models.FileShare, error) {
+	s.setPermission(fileID, sharedWithEmail, permission)
+	return &models.FileShare{FileID: fileID, OwnerID: ownerID, SharedWithEmail: sharedWithEmail, Permission: permission}, nil
+}
+func (s *stubShareRepo) CreateFileShares(ctx context.Context, ownerID uuid.UUID, fileIDs []uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FileShare, error) {
+	s.bulkShareCalls++
+	var shares []models.FileShare
+	seen := map[string]bool{}
+	for _, fileID := range fileIDs {
+		for _, email := range emails {
+			// Postgres refuses an insert that would update the same row twice
+			key := fileID.String() + email
+			if seen[key] {
+				return nil, fmt.Errorf("share of %s with %s updated twice in one statement", fileID, email)
+			}
+			seen[key] = true
+			s.setPermission(fileID, email, permission)
+			shares = append(shares, models.FileShare{ID: uuid.New(), FileID: fileID, OwnerID: ownerID, SharedWithEmail: email, Permission: permission, ExpiresAt: expiresAt})
+		}
+	}
+	return shares, nil
+}
+func (s *stubShareRepo) GetFileShares(ctx context.Context, fileID uuid.UUID) ([]models.FileShare, error) {
+	return nil, nil
+}
+func (s *stubShareRepo) GetFileSharesForUser(ctx context.Context, userEmail string) ([]models.FileShare, error) {
+	var out []models.FileShare
+	for _, sh := range s.fileShares {
+		if sh.SharedWithEmail == userEmail {
+			out = append(out, sh)
+		}
+	}
+	return out, nil
+}
+func (s *stubShareRepo) GetFileSharesByOwner(ctx context.Context, ownerID uuid.UUID, includeExpired bool) ([]models.FileShare, error) {
+	var out []models.FileShare
+	for _, sh := range s.fileShares {
+		if sh.OwnerID == ownerID && (includeExpired || sh.ExpiresAt == nil || sh.ExpiresAt.After(time.Now())) {
+			out = append(out, sh)
+		}
+	}
+	return out, nil
+}
+func (s *stubShareRepo) DeleteFileShare(ctx context.Context, fileID uuid.UUID, sharedWithEmail string) error {
+	return nil
+}
+func (s *stubShareRepo) DeleteAllFileShares(ctx context.Context, fileID uuid.UUID) (int64, error) {
+	n := len(s.permissions[fileID])
+	delete(s.permissions, fileID)
+	return int64(n), nil
+}
+func (s *stubShareRepo) UpdateFileSharePermission(ctx context.Context, fileID uuid.UUID, sharedWithEmail string, permission string) (*models.FileShare, error) {
+	if _, ok := s.permissions[fileID][sharedWithEmail]; !ok {
+		return nil, nil
+	}
+	s.permissions[fileID][sharedWithEmail] = permission
+	return &models.FileShare{FileID: fileID, SharedWithEmail: sharedWithEmail, Permission: permission}, nil
+}
+func (s *stubShareRepo) CreateFolderShare(ctx context.Context, folderID, ownerID uuid.UUID, sharedWithEmail string, permission string, expiresAt *time.Time) (*models.FolderShare, error) {
+	s.setPermission(folderID, sharedWithEmail, permission)
+	return &models.FolderShare{FolderID: folderID, OwnerID: ownerID, SharedWithEmail: sharedWithEmail, Permission: permission}, nil
+}
+func (s *stubShareRepo) GetFolderShares(ctx context.Context, folderID uuid.UUID) ([]models.FolderShare, error) {
+	return nil, nil
+}
+func (s *stubShareRepo) GetFolderSharesForUser(ctx context.Context, userEmail string) ([]models.FolderShare, error) {
+	var out []models.FolderShare
+	for _, sh := range s.folderShares {
+		if sh.SharedWithEmail == userEmail {
+			out = append(out, sh)
+		}
+	}
+	return out, nil
+}
+func (s *stubShareRepo) GetFolderSharesByOwner(ctx context.Context, ownerID uuid.UUID, includeExpired bool) ([]models.FolderShare, error) {
+	var out []models.FolderShare
+	for _, sh := range s.folderShares {
+		if sh.OwnerID == ownerID && (includeExpired || sh.ExpiresAt == nil || sh.ExpiresAt.After(time.Now())) {
+			out = append(out, sh)
+		}
+	}
+	return out, nil
+}
+func (s *stubShareRepo) DeleteFolderShare(ctx context.Context, folderID uuid.UUID, sharedWithEmail string) error {
+	return nil
+}
+func (s *stubShareRepo) DeleteAllFolderShares(ctx context.Context, folderID uuid.UUID) (int64, error) {
+	n := len(s.permissions[folderID])
+	delete(s.permissions, folderID)
+	return int64(n), nil
+}
+func (s *stubShareRepo) UpdateFolderSharePermission(ctx context.Context, folderID uuid.UUID, sharedWithEmail string, permission string) (*models.FolderShare, error) {
+	if _, ok := s.permissions[folderID][sharedWithEmail]; !ok {
+		return nil, nil
+	}
+	s.permissions[folderID][sharedWithEmail] = permission
+	return &models.FolderShare{FolderID: folderID, SharedWithEmail: sharedWithEmail, Permission: permission}, nil
+}
+func (s *stubShareRepo) GetFileShareAccess(ctx context.Context, fileID uuid.UUID) ([]models.ShareAccess, error) {
+	return s.access[fileID], nil
+}
+func (s *stubShareRepo) HasFileAccess(ctx context.Context, userID uuid.UUID, userEmail string, fileID uuid.UUID) (bool, string, error) {
+	if s.noAccess {
+		if s.public[fileID] {
+			return true, "viewer", nil
+		}
+		return false, "", nil
+	}
+	if s.notOwner {
+		return true, "viewer", nil
+	}
+	return true, "owner", nil
+}
+func (s *stubShareRepo) HasFolderAccess(ctx context.Context, userID uuid.UUID, userEmail string, folderID uuid.UUID) (bool, string, error) {
+	if s.folderOwners != nil {
+		if s.folderOwners[folderID] == userID {
+			return true, "owner", nil
+		}
+		permission, ok := s.permissions[folderID][userEmail]
+		return ok, permission, nil
+	}
+	if s.notOwner {
+		return true, "viewer", nil
+	}
+	return true, "owner", nil
+}
+func (s *stubShareRepo) GetFileAccessLevels(ctx context.Context, userID uuid.UUID, userEmail string, fileIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	return s.accessLevels(fileIDs), nil
+}
+func (s *stubShareRepo) GetFolderAccessLevels(ctx context.Context, userID uuid.UUID, userEmail string, folderIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	return s.accessLevels(folderIDs), nil
+}
+func (s *stubShareRepo) accessLevels(ids []uuid.UUID) map[uuid.UUID]string {
+	s.levelQueries++
+	levels := map[uuid.UUID]string{}
+	for _, id := range ids {
+		if p, ok := s.levels[id]; ok {
+			levels[id] = p
+		}
+	}
+	return levels
+}
+func (s *stubShareRepo) GetFolderFiles(ctx context.Context, folderID uuid.UUID) ([]models.UserFile, error) {
+	if s.mapped == nil {
+		return s.files[folderID], nil
+	}
+	var files []models.UserFile
+	for _, m := range s.mapped.mappings {
+		if m.folderID != nil && *m.folderID == folderID && !m.deleted {
+			files = append(files, models.UserFile{ID: m.id, UserID: m.userID, FileID: m.fileID, FolderID: m.folderID})
+		}
+	}
+	return files, nil
+}
+func (s *stubShareRepo) GetDirectSubfolders(ctx context.Context, folderID uuid.UUID) ([]models.Folder, error) {
+	return s.subfolders[folderID], nil
+}
+
+// stubFolderRepo implements FolderRepository; GetAllSubfolders walks the share stub's tree
+// and RenameFolder honours per-folder versions when any are set. CreateFolderWithFiles moves
+// mappings in files all-or-nothing, like the transactional query.
+type stubFolderRepo struct {
+	share    *stubShareRepo
+	versions map[uuid.UUID]time.Time
+	files    *stubFileRepo
+	// created records folders made by CreateFolderWithFiles
+	created []models.Folder
+	// owners backs ValidateParents when set: a folder is valid for its owner only
+	owners map[uuid.UUID]uuid.UUID
+	// validations counts ValidateParents calls
+	validations int
+	// moves counts MoveFolder calls that passed the cycle check
+	moves int
+	// deleted records folders removed by PurgeFolder
+	deleted []uuid.UUID
+	// trashed maps each folder in the trash to the folder whose deletion took it there
+	trashed map[uuid.UUID]uuid.UUID
+	// trashedFiles holds the mappings each deletion trashed, keyed like trashed's values
+	trashedFiles map[uuid.UUID][]*stubMapping
+	// descriptions backs SetFolderDescription and the description GetFolderByID reports
+	descriptions map[uuid.UUID]string
+	// quotas backs GetFolderQuotaUsage: the folder quotas the folder falls under, keyed by
+	// the folder uploaded to
+	quotas map[uuid.UUID][]repository.FolderQuotaUsage
+}
+
+func (s *stubFolderRepo) CreateFolder(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID) (*models.Folder, error) {
+	return &models.Folder{ID: uuid.New(), UserID: userID, Name: name, ParentID: parentID}, nil
+}
+func (s *stubFolderRepo) RenameFolder(ctx context.Context, userID, folderID uuid.UUID, newName string, expectedUpdatedAt *time.Time) error {
+	if s.versions == nil {
+		return nil
+	}
+	current, ok := s.versions[folderID]
+	if !ok {
+		return errors.New("folder not found")
+	}
+	if expectedUpdatedAt != nil && !expectedUpdatedAt.Equal(current) {
+		return repository.ErrVersionConflict
+	}
+	s.versions[folderID] = current.Add(time.Second)
+	return nil
+}
+func (s *stubFolderRepo) DeleteFolder(ctx context.Context, userID, folderID uuid.UUID) error {
+	s.trash(folderID, folderID)
+	return nil
+}
+func (s *stubFolderRepo) PurgeFolder(ctx context.Context, userID, folderID uuid.UUID) error {
+	s.deleted = append(s.deleted, folderID)
+	return nil
+}
+func (s *stubFolderRepo) trash(folderID, deletion uuid.UUID) {
+	if s.trashed == nil {
+		s.trashed = map[uuid.UUID]uuid.UUID{}
+	}
+	s.trashed[folderID] = deletion
+	if s.files != nil {
+		if s.files.trashedFolders == nil {
+			s.files.trashedFolders = map[uuid.UUID]bool{}
+		}
+		s.files.trashedFolders[folderID] = true
+	}
+}
+func (s *stubFolderRepo) ListFolders(ctx context.Context, userID uuid.UUID, parentID *uuid.UUID) ([]models.Folder, error) {
+	if s.share == nil {
+		return nil, nil
+	}
+	key := uuid.Nil
+	if parentID != nil {
+		key = *parentID
+	}
+	var out []models.Folder
+	for _, f := range s.share.subfolders[key] {
+		if _, gone := s.trashed[f.ID]; !gone {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+func (s *stubFolderRepo) GetFolderTree(ctx context.Context, userID uuid.UUID, rootID *uuid.UUID, maxDepth int) ([]models.FolderTreeEntry, error) {
+	if s.share == nil {
+		return nil, nil
+	}
+	level := uuid.Nil
+	if rootID != nil {
+		level = *rootID
+	}
+	var out []models.FolderTreeEntry
+	parents := []uuid.UUID{level}
+	for depth := 1; depth <= maxDepth && len(parents) > 0; depth++ {
+		var next []uuid.UUID
+		for _, p := range parents {
+			for _, f := range s.share.subfolders[p] {
+				out = append(out, models.FolderTreeEntry{Folder: f, Depth: depth, HasChildren: len(s.share.subfolders[f.ID]) > 0})
+				next = append(next, f.ID)
+			}
+		}
+		parents = next
+	}
+	return out, nil
+}
+func (s *stubFolderRepo) GetFolderByID(ctx context.Context, userID, folderID uuid.UUID) (*models.Folder, error) {
+	if _, gone := s.trashed[folderID]; gone {
+		return nil, fmt.Errorf("folder %s: %w", folderID, repository.ErrNotFound)
+	}
+	if owner, ok := s.owners[folderID]; s.owners != nil && (!ok || owner != userID) {
+		return nil, fmt.Errorf("folder %s: %w", folderID, repository.ErrNotFound)
+	}
+	if s.share != nil {
+		for _, siblings := range s.share.subfolders {
+			for _, f := range siblings {
+				if f.ID == folderID {
+					f.Description = s.descriptions[folderID]
+					return &f, nil
+				}
+			}
+		}
+	}
+	return &models.Folder{ID: folderID, UserID: userID, Description: s.descriptions[folderID]}, nil
+}
+func (s *stubFolderRepo) SetFolderDescription(ctx context.Context, userID, folderID uuid.UUID, description *string) error {
+	if owner, ok := s.owners[folderID]; s.owners != nil && (!ok || owner != userID) {
+		return fmt.Errorf("folder %s: %w", folderID, repository.ErrNotFound)
+	}
+	if s.descriptions == nil {
+		s.descriptions = map[uuid.UUID]string{}
+	}
+	if description == nil {
+		delete(s.descriptions, folderID)
+	} else {
+		s.descriptions[folderID] = *description
+	}
+	return nil
+}
+func (s *stubFolderRepo) SetFolderQuota(ctx context.Context, userID, folderID uuid.UUID, quotaBytes *int64) error {
+	return nil
+}
+func (s *stubFolderRepo) GetFolderQuota(ctx context.Context, userID, folderID uuid.UUID) (*int64, error) {
+	return nil, nil
+}
+func (s *stubFolderRepo) GetFolderQuotaUsage(ctx context.Context, folderID uuid.UUID) ([]repository.FolderQuotaUsage, error) {
+	return s.quotas[folderID], nil
+}
+func (s *stubFolderRepo) MoveFolder(ctx context.Context, userID, folderID uuid.UUID, newParentID *uuid.UUID) error {
+	if newParentID != nil {
+		subtree, _ := s.GetAllSubfolders(ctx, userID, folderID)
+		for _, f := range append(subtree, models.Folder{ID: folderID}) {
+			if f.ID == *newParentID {
+				return repository.ErrFolderCycle
+			}
+		}
+	}
+	s.moves++
+	for key, siblings := range s.share.subfolders {
+		for i, f := range siblings {
+			if f.ID != folderID {
+				continue
+			}
+			s.share.subfolders[key] = append(siblings[:i:i], siblings[i+1:]...)
+			f.ParentID = newParentID
+			target := uuid.Nil
+			if newParentID != nil {
+				target = *newParentID
+			}
+			s.share.subfolders[target] = append(s.share.subfolders[target], f)
+			return nil
+		}
+	}
+	return fmt.Errorf("folder %s: %w", folderID, repository.ErrNotFound)
+}
+func (s *stubFolderRepo) CountChildren(ctx context.Context, userID, folderID uuid.UUID) (int, error) {
+	children, _ := s.ListFolders(ctx, userID, &folderID)
+	return len(children), nil
+}
+func (s *stubFolderRepo) ValidateParent(ctx context.Context, userID uuid.UUID, parentID uuid.UUID) (bool, error) {
+	if _, gone := s.trashed[parentID]; gone {
+		return false, nil
+	}
+	owner, ok := s.owners[parentID]
+	return s.owners == nil || (ok && owner == userID), nil
+}
+func (s *stubFolderRepo) GetFolderOwner(ctx context.Context, folderID uuid.UUID) (uuid.UUID, error) {
+	owner, ok := s.owners[folderID]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("folder %s: %w", folderID, repository.ErrNotFound)
+	}
+	return owner, nil
+}
+func (s *stubFolderRepo) ValidateParents(ctx context.Context, userID uuid.UUID, parentIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	s.validations++
+	valid := make(map[uuid.UUID]bool, len(parentIDs))
+	for _, id := range parentIDs {
+		owner, ok := s.owners[id]
+		valid[id] = s.owners == nil || (ok && owner == userID)
+	}
+	return valid, nil
+}
+func (s *stubFolderRepo) DeleteFolderReassignFiles(ctx context.Context, userID, folderID uuid.UUID) error {
+	if s.files != nil {
+		for _, m := range s.files.mappings {
+			if m.userID == userID && m.folderID != nil && *m.folderID == folderID {
+				m.folderID = nil
+			}
+		}
+	}
+	s.trash(folderID, folderID)
+	return nil
+}
+func (s *stubFolderRepo) DeleteFolderRecursive(ctx context.Context, userID, folderID uuid.UUID) error {
+	// The subtree stops at folders already in the trash, like the repository's
+	tree := map[uuid.UUID]bool{folderID: true}
+	for queue := []uuid.UUID{folderID}; len(queue) > 0; queue = queue[1:] {
+		children, _ := s.ListFolders(ctx, userID, &queue[0])
+		for _, c := range children {
+			tree[c.ID] = true
+			queue = append(queue, c.ID)
+		}
+	}
+	if s.trashedFiles == nil {
+		s.trashedFiles = map[uuid.UUID][]*stubMapping{}
+	}
+	if s.files != nil {
+		for _, m := range s.files.mappings {
+			if m.userID == userID && !m.deleted && m.folderID != nil && tree[*m.folderID] {
+				m.deleted = true
+				s.trashedFiles[folderID] = append(s.trashedFiles[folderID], m)
+			}
+		}
+	}
+	for id := range tree {
+		s.trash(id, folderID)
+	}
+	return nil
+}
+func (s *stubFolderRepo) GetDeletedFolders(ctx context.Context, userID uuid.UUID) ([]models.Folder, error) {
+	var out []models.Folder
+	for _, siblings := range s.share.subfolders {
+		for _, f := range siblings {
+			if deletion, gone := s.trashed[f.ID]; gone && deletion == f.ID {
+				out = append(out, f)
+			}
+		}
+	}
+	return out, nil
+}
+func (s *stubFolderRepo) RecoverFolder(ctx context.Context, userID, folderID uuid.UUID, parentID *uuid.UUID) error {
+	if deletion, gone := s.trashed[folderID]; !gone || deletion != folderID {
+		return fmt.Errorf("deleted folder %s: %w", folderID, repository.ErrNotFound)
+	}
+	for id, deletion := range s.trashed {
+		if deletion == folderID {
+			delete(s.trashed, id)
+			if s.files != nil {
+				delete(s.files.trashedFolders, id)
+			}
+		}
+	}
+	for _, m := range s.trashedFiles[folderID] {
+		m.deleted = false
+	}
+	delete(s.trashedFiles, folderID)
+	folder, _ := s.GetFolderByID(ctx, userID, folderID)
+	if !sameParent(folder.ParentID, parentID) {
+		return s.MoveFolder(ctx, userID, folderID, parentID)
+	}
+	return nil
+}
+func (s *stubFolderRepo) GetAllSubfolders(ctx context.Context, userID, folderID uuid.UUID) ([]models.Folder, error) {
+	if s.share == nil {
+		return nil, nil
+	}
+	var all []models.Folder
+	for _, sub := range s.share.subfolders[folderID] {
+		all = append(all, sub)
+		nested, _ := s.GetAllSubfolders(ctx, userID, sub.ID)
+		all = append(all, nested...)
+	}
+	return all, nil
+}
+func (s *stubFolderRepo) CreateFolderPath(ctx context.Context, userID uuid.UUID, folderPath string, parentID *uuid.UUID) (*models.Folder, error) {
+	return &models.Folder{ID: uuid.New(), UserID: userID, Name: folderPath, ParentID: parentID}, nil
+}
+func (s *stubFolderRepo) CreateFolderWithFiles(ctx context.Context, userID uuid.UUID, name string, parentID *uuid.UUID, mappingIDs []uuid.UUID) (*models.Folder, error) {
+	var moving []*stubMapping
+	for _, id := range mappingIDs {
+		var found *stubMapping
+		for _, m := range s.files.mappings {
+			if m.id == id && m.userID == userID && !m.deleted {
+				found = m
+			}
+		}
+		if found == nil {
+			return nil, repository.ErrMappingsNotMoved
+		}
+		moving = append(moving, found)
+	}
+	folder := models.Folder{ID: uuid.New(), UserID: userID, Name: name, ParentID: parentID}
+	for _, m := range moving {
+		m.folderID = &folder.ID
+	}
+	s.created = append(s.created, folder)
+	return &folder, nil
+}
+func (s *stubFolderRepo) BulkCreateFolders(ctx context.Context, userID uuid.UUID, folders []models.Folder) error {
+	return nil
+}
+
+// newPublicFolderFixture builds root -> child with one file in each
+func newPublicFolderFixture() (*stubPublicLinkRepo, *stubShareRepo, uuid.UUID, uuid.UUID) {
+	rootID, childID := uuid.New(), uuid.New()
+	rootFile, childFile := uuid.New(), uuid.New()
+	share := &stubShareRepo{
+		files: map[uuid.UUID][]models.UserFile{
+			rootID:  {{ID: uuid.New(), FileID: rootFile, FolderID: &rootID, File: models.File{ID: rootFile}}},
+			childID: {{ID: uuid.New(), FileID: childFile, FolderID: &childID, File: models.File{ID: childFile}}},
+		},
+		subfolders: map[uuid.UUID][]models.Folder{
+			rootID: {{ID: childID, Name: "child", ParentID: &rootID}},
+		},
+	}
+	pub := &stubPublicLinkRepo{
+		folder: &models.Folder{ID: rootID, Name: "root"},
+		owner:  &models.User{ID: uuid.New(), Email: "owner@example.com"},
+	}
+	return pub, share, rootID, childFile
+}
+
+func TestPublicLinkService_BrowsePublicFolder_Listing(t *testing.T) {
+	pub, share, rootID, _ := newPublicFolderFixture()
+	svc := NewPublicLinkService(pub, share, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{share: share})
+
+	listing, err := svc.BrowsePublicFolder(context.Background(), "tok", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listing.Folder.ID != rootID {
+		t.Fatalf("expected root folder, got %v", listing.Folder.ID)
+	}
+	if len(listing.Subfolders) != 1 || len(listing.Files) != 1 {
+		t.Fatalf("expected 1 subfolder and 1 file, got %d and %d", len(listing.Subfolders), len(listing.Files))
+	}
+
+	listing, err = svc.BrowsePublicFolder(context.Background(), "tok", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(listing.Files) != 2 {
+		t.Fatalf("expected 2 files when recursive, got %d", len(listing.Files))
+	}
+	if pub.accessCount != 2 {
+		t.Fatalf("expected access count 2, got %d", pub.accessCount)
+	}
+}
+
+func TestPublicLinkService_BrowsePublicFolder_Revoked(t *testing.T) {
+	pub, share, _, _ := newPublicFolderFixture()
+	revokedAt := time.Now().Add(-time.Minute)
+	pub.revokedAt = &revokedAt
+	svc := NewPublicLinkService(pub, share, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{share: share})
+
+	if _, err := svc.BrowsePublicFolder(context.Background(), "tok", "", false); err == nil {
+		t.Fatalf("expected error for revoked link")
+	}
+	if pub.accessCount != 0 {
+		t.Fatalf("revoked link must not count access, got %d", pub.accessCount)
+	}
+}
+
+func TestPublicLinkService_ResolvePublicFolderFile(t *testing.T) {
+	pub, share, _, childFile := newPublicFolderFixture()
+	svc := NewPublicLinkService(pub, share, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{share: share})
+
+	uf, _, err := svc.ResolvePublicFolderFile(context.Background(), "tok", "", childFile)
+	if err != nil || uf == nil || uf.FileID != childFile {
+		t.Fatalf("expected nested file to resolve, got %v, %v", uf, err)
+	}
+	if _, _, err := svc.ResolvePublicFolderFile(context.Background(), "tok", "", uuid.New()); err == nil {
+		t.Fatalf("expected error for file outside the folder")
+	}
+}
+
+func TestPublicLinkService_CreateLink_Expiry(t *testing.T) {
+	svc := NewPublicLinkService(&stubPublicLinkRepo{}, &stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.MaxLifetime = 30 * 24 * time.Hour
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	if _, _, err := svc.CreateFileLink(ctx, uuid.New(), uuid.New(), &past, "", 0, false); err == nil {
+		t.Fatalf("expected past expiry to be rejected")
+	}
+
+	tooFar := time.Now().Add(60 * 24 * time.Hour)
+	if _, _, err := svc.CreateFolderLink(ctx, uuid.New(), uuid.New(), &tooFar, ""); err == nil {
+		t.Fatalf("expected expiry beyond max lifetime to be rejected")
+	}
+
+	valid := time.Now().Add(24 * time.Hour)
+	token, exp, err := svc.CreateFolderLink(ctx, uuid.New(), uuid.New(), &valid, "")
+	if err != nil || token == "" || exp == nil {
+		t.Fatalf("expected valid expiry to be accepted, got %v", err)
+	}
+}
+
+func TestPublicLinkService_LinkLimit(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.MaxActiveLinks = 3
+
+	// File and folder links share the cap; the link reaching it is still allowed
+	for i := 0; i < 2; i++ {
+		if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); err != nil {
+			t.Fatalf("link %d: unexpected err: %v", i+1, err)
+		}
+	}
+	if _, _, err := svc.CreateFolderLink(ctx, owner, uuid.New(), nil, ""); err != nil {
+		t.Fatalf("link 3: unexpected err: %v", err)
+	}
+	if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); !errors.Is(err, ErrLinkLimitReached) {
+		t.Fatalf("expected file link past the cap to be rejected, got %v", err)
+	}
+	if _, _, err := svc.CreateFolderLink(ctx, owner, uuid.New(), nil, ""); !errors.Is(err, ErrLinkLimitReached) {
+		t.Fatalf("expected folder link past the cap to be rejected, got %v", err)
+	}
+
+	// Other users have caps of their own
+	if _, _, err := svc.CreateFileLink(ctx, uuid.New(), uuid.New(), nil, "", 0, false); err != nil {
+		t.Fatalf("expected another user to be unaffected, got %v", err)
+	}
+}
+
+func TestPublicLinkService_LinkLimit_ConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+	svc.MaxActiveLinks = 1
+
+	// Another share by the same owner takes the last slot after the service has looked;
+	// the count made when storing the link still refuses it
+	repo.beforeCreate = func(uuid.UUID) {
+		repo.fileLinks["other"] = &stubFileLink{fileID: uuid.New(), ownerID: owner}
+	}
+	if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); !errors.Is(err, ErrLinkLimitReached) {
+		t.Fatalf("expected the concurrent link to use up the cap, got %v", err)
+	}
+	if len(repo.fileLinks) != 1 {
+		t.Fatalf("expected only the concurrent link stored, got %d", len(repo.fileLinks))
+	}
+}
+
+func TestPublicLinkService_LinkLimit_InactiveLinksFreeSlots(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	past := time.Now().Add(-time.Hour)
+	repo := &stubPublicLinkRepo{fileLinks: map[string]*stubFileLink{
+		"revoked": {fileID: uuid.New(), ownerID: owner, revokedAt: &past},
+		"expired": {fileID: uuid.New(), ownerID: owner, expiresAt: &past, seq: 1},
+		"active":  {fileID: uuid.New(), ownerID: owner, seq: 2},
+	}}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.MaxActiveLinks = 2
+
+	if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); err != nil {
+		t.Fatalf("expected revoked and expired links not to count, got %v", err)
+	}
+	if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); !errors.Is(err, ErrLinkLimitReached) {
+		t.Fatalf("expected third active link to be rejected, got %v", err)
+	}
+}
+
+func TestPublicLinkService_LinkLimit_Override(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.MaxActiveLinks = 1
+
+	raised := 2
+	if err := svc.SetLinkLimit(ctx, owner, &raised); err != nil {
+		t.Fatalf("set limit: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); err != nil {
+			t.Fatalf("link %d: expected raised cap to allow it, got %v", i+1, err)
+		}
+	}
+	if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); !errors.Is(err, ErrLinkLimitReached) {
+		t.Fatalf("expected the override to still cap links, got %v", err)
+	}
+
+	// An override of zero blocks links even though zero means no cap by default
+	none := 0
+	blocked := uuid.New()
+	if err := svc.SetLinkLimit(ctx, blocked, &none); err != nil {
+		t.Fatalf("set limit: %v", err)
+	}
+	if _, _, err := svc.CreateFileLink(ctx, blocked, uuid.New(), nil, "", 0, false); !errors.Is(err, ErrLinkLimitReached) {
+		t.Fatalf("expected zero override to block links, got %v", err)
+	}
+
+	if err := svc.SetLinkLimit(ctx, owner, nil); err != nil {
+		t.Fatalf("clear limit: %v", err)
+	}
+	if limit, overridden, _ := svc.LinkLimit(ctx, owner); limit != 1 || overridden {
+		t.Fatalf("expected cleared override to fall back to the default, got %d (overridden=%v)", limit, overridden)
+	}
+	negative := -1
+	if err := svc.SetLinkLimit(ctx, owner, &negative); err == nil {
+		t.Fatalf("expected negative limit to be rejected")
+	}
+}
+
+func TestPublicLinkService_ListMyPublicLinks(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	expires := time.Now().Add(24 * time.Hour)
+	repo := &stubPublicLinkRepo{active: map[uuid.UUID][]models.PublicLink{owner: {
+		{ItemType: "file", ItemID: uuid.New(), ItemName: "report.pdf", ExpiresAt: &expires, AccessCount: 7},
+		{ItemType: "folder", ItemID: uuid.New(), ItemName: "Photos", AccessCount: 2},
+		{ItemType: "file", ItemID: uuid.New(), ItemName: "notes.txt"},
+	}}}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+
+	got, err := svc.ListMyPublicLinks(ctx, owner)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(got.Links) != 3 || got.FileLinks != 2 || got.FolderLinks != 1 {
+		t.Fatalf("expected 3 links (2 files, 1 folder), got %d (%d files, %d folders)", len(got.Links), got.FileLinks, got.FolderLinks)
+	}
+	if first := got.Links[0]; first.ExpiresAt == nil || !first.ExpiresAt.Equal(expires) || first.AccessCount != 7 {
+		t.Fatalf("expected expiry and download count carried through, got %+v", first)
+	}
+
+	empty, err := svc.ListMyPublicLinks(ctx, uuid.New())
+	if err != nil || len(empty.Links) != 0 || empty.FileLinks != 0 || empty.FolderLinks != 0 {
+		t.Fatalf("expected no links for another user, got %+v, %v", empty, err)
+	}
+}
+
+func TestPublicLinkService_RevokeAllMyPublicLinks(t *testing.T) {
+	ctx := context.Background()
+	owner, other := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	for i := 0; i < 2; i++ {
+		if _, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false); err != nil {
+			t.Fatalf("file link %d: %v", i+1, err)
+		}
+	}
+	if _, _, err := svc.CreateFolderLink(ctx, owner, uuid.New(), nil, ""); err != nil {
+		t.Fatalf("folder link: %v", err)
+	}
+	if _, _, err := svc.CreateFileLink(ctx, other, uuid.New(), nil, "", 0, false); err != nil {
+		t.Fatalf("other user's link: %v", err)
+	}
+
+	n, err := svc.RevokeAllMyPublicLinks(ctx, owner)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 links revoked, got %d", n)
+	}
+	if active, _ := repo.CountActiveLinksByOwner(ctx, owner); active != 0 {
+		t.Fatalf("expected no active links left, got %d", active)
+	}
+	if active, _ := repo.CountActiveLinksByOwner(ctx, other); active != 1 {
+		t.Fatalf("expected another user's link untouched, got %d active", active)
+	}
+
+	// Revoking again is a no-op rather than an error
+	if n, err := svc.RevokeAllMyPublicLinks(ctx, owner); err != nil || n != 0 {
+		t.Fatalf("expected nothing left to revoke, got %d, %v", n, err)
+	}
+}
+
+func TestPublicLinkService_RotateFileLink(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+
+	exp := time.Now().Add(time.Hour)
+	oldToken, _, err := svc.CreateFileLink(ctx, owner, fileID, &exp, "", 0, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	repo.fileLinks[oldToken].downloads = 7
+
+	newToken, newExp, err := svc.RotateFileLink(ctx, owner, fileID, true)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if newToken == oldToken {
+		t.Fatalf("expected a fresh token")
+	}
+	if newExp == nil || !newExp.Equal(exp) || repo.fileLinks[newToken].downloads != 7 {
+		t.Fatalf("expected expiry and download count preserved, got %v and %d", newExp, repo.fileLinks[newToken].downloads)
+	}
+	if _, _, _, revoked, err := svc.ResolveFileLink(ctx, oldToken, ""); err != nil || !revoked {
+		t.Fatalf("expected old token to resolve as revoked, got revoked=%v err=%v", revoked, err)
+	}
+	f, _, _, revoked, err := svc.ResolveFileLink(ctx, newToken, "")
+	if err != nil || revoked || f == nil || f.ID != fileID {
+		t.Fatalf("expected new token to resolve to %s, got %+v revoked=%v err=%v", fileID, f, revoked, err)
+	}
+	if repo.fileLinks[newToken].downloads != 8 || repo.fileLinks[oldToken].downloads != 7 {
+		t.Fatalf("expected only the resolve of the new token counted, got %d and %d", repo.fileLinks[newToken].downloads, repo.fileLinks[oldToken].downloads)
+	}
+}
+
+func TestPublicLinkService_RotateFileLink_Fresh(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+
+	exp := time.Now().Add(time.Hour)
+	oldToken, _, _ := svc.CreateFileLink(ctx, owner, fileID, &exp, "", 0, false)
+	repo.fileLinks[oldToken].downloads = 7
+
+	newToken, newExp, err := svc.RotateFileLink(ctx, owner, fileID, false)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if newExp != nil || repo.fileLinks[newToken].downloads != 0 {
+		t.Fatalf("expected fresh link, got expiry %v and %d downloads", newExp, repo.fileLinks[newToken].downloads)
+	}
+}
+
+func TestPublicLinkService_RotateFileLink_NoActiveLink(t *testing.T) {
+	svc := NewPublicLinkService(&stubPublicLinkRepo{}, &stubShareRepo{}, nil, nil, nil)
+	if _, _, err := svc.RotateFileLink(context.Background(), uuid.New(), uuid.New(), true); err == nil {
+		t.Fatalf("expected error when the file has no link")
+	}
+}
+
+func TestPublicLinkService_InspectFileLink(t *testing.T) {
+	ctx := context.Background()
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	repo := &stubPublicLinkRepo{fileLinks: map[string]*stubFileLink{
+		"valid":   {fileID: uuid.New(), name: "report.pdf", size: 2048, expiresAt: &future, downloads: 3},
+		"forever": {fileID: uuid.New(), name: "notes.txt", size: 12},
+		"expired": {fileID: uuid.New(), name: "old.pdf", size: 1, expiresAt: &past},
+		"revoked": {fileID: uuid.New(), name: "gone.pdf", size: 1, expiresAt: &past, revokedAt: &past},
+	}}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+
+	cases := []struct {
+		token  string
+		status LinkStatus
+		name   string
+	}{
+		{"valid", LinkValid, "report.pdf"},
+		{"forever", LinkValid, "notes.txt"},
+		{"expired", LinkExpired, ""},
+		{"revoked", LinkRevoked, ""},
+		{"unknown", LinkNotFound, ""},
+	}
+	for _, c := range cases {
+		info, err := svc.InspectFileLink(ctx, c.token)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", c.token, err)
+		}
+		if info.Status != c.status || info.FileName != c.name {
+			t.Fatalf("%s: expected %s %q, got %+v", c.token, c.status, c.name, info)
+		}
+	}
+	if info, _ := svc.InspectFileLink(ctx, "valid"); info.Size != 2048 || info.ExpiresAt == nil || !info.ExpiresAt.Equal(future) {
+		t.Fatalf("expected size and expiry of the valid link, got %+v", info)
+	}
+	if repo.fileLinks["valid"].downloads != 3 {
+		t.Fatalf("expected inspecting not to count a download, got %d", repo.fileLinks["valid"].downloads)
+	}
+}
+
+func TestPublicLinkService_FileLinkPassword(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+
+	token, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "hunter2", 0, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if h := repo.fileLinks[token].passwordHash; h == nil || *h == "hunter2" {
+		t.Fatalf("expected a hash of the password stored, got %v", h)
+	}
+	if f, _, _, revoked, err := svc.ResolveFileLink(ctx, token, "hunter2"); err != nil || revoked || f == nil || f.ID != fileID {
+		t.Fatalf("expected the right password to resolve the file, got %+v revoked=%v err=%v", f, revoked, err)
+	}
+	if f, _, _, _, err := svc.ResolveFileLink(ctx, token, "wrong"); !errors.Is(err, ErrLinkPasswordIncorrect) || f != nil {
+		t.Fatalf("expected a wrong password refused, got %+v, %v", f, err)
+	}
+	if _, _, _, _, err := svc.ResolveFileLink(ctx, token, ""); !errors.Is(err, ErrLinkPasswordRequired) {
+		t.Fatalf("expected a missing password asked for, got %v", err)
+	}
+	if info, err := svc.InspectFileLink(ctx, token); err != nil || info.Status != LinkValid || !info.PasswordProtected || info.FileName != "" {
+		t.Fatalf("expected inspection to flag the password and hide the file, got %+v, %v", info, err)
+	}
+
+	// Rotating keeps the password; the revoked old token reports revoked whatever the password
+	newToken, _, err := svc.RotateFileLink(ctx, owner, fileID, false)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, _, _, _, err := svc.ResolveFileLink(ctx, newToken, ""); !errors.Is(err, ErrLinkPasswordRequired) {
+		t.Fatalf("expected the rotated link still protected, got %v", err)
+	}
+	if _, _, _, revoked, err := svc.ResolveFileLink(ctx, token, "wrong"); err != nil || !revoked {
+		t.Fatalf("expected the old link revoked rather than a password error, got revoked=%v err=%v", revoked, err)
+	}
+
+	open, _, _ := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 0, false)
+	if repo.fileLinks[open].passwordHash != nil {
+		t.Fatalf("expected no hash for a link without a password")
+	}
+	if f, _, _, _, err := svc.ResolveFileLink(ctx, open, "anything"); err != nil || f == nil {
+		t.Fatalf("expected a link without a password to resolve, got %+v, %v", f, err)
+	}
+}
+
+func TestPublicLinkService_FolderLinkPassword(t *testing.T) {
+	ctx := context.Background()
+	pub, share, rootID, childFile := newPublicFolderFixture()
+	svc := NewPublicLinkService(pub, share, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{share: share})
+
+	if _, _, err := svc.CreateFolderLink(ctx, uuid.New(), rootID, nil, "s3cret"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := svc.BrowsePublicFolder(ctx, "tok", "", false); !errors.Is(err, ErrLinkPasswordRequired) {
+		t.Fatalf("expected browsing without the password refused, got %v", err)
+	}
+	if _, _, err := svc.ResolvePublicFolderFile(ctx, "tok", "wrong", childFile); !errors.Is(err, ErrLinkPasswordIncorrect) {
+		t.Fatalf("expected a wrong password refused for files, got %v", err)
+	}
+	if pub.accessCount != 0 {
+		t.Fatalf("expected refused browses not counted, got %d", pub.accessCount)
+	}
+	listing, err := svc.BrowsePublicFolder(ctx, "tok", "s3cret", false)
+	if err != nil || listing.Folder.ID != rootID {
+		t.Fatalf("expected the right password to list the folder, got %+v, %v", listing, err)
+	}
+}
+
+func TestPublicLinkService_MaxDownloads(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+
+	if _, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "", -1, false); err == nil {
+		t.Fatalf("expected a negative limit rejected")
+	}
+	token, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "pw", 2, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, _, _, _, err := svc.ResolveFileLink(ctx, token, "wrong"); !errors.Is(err, ErrLinkPasswordIncorrect) {
+		t.Fatalf("expected a wrong password refused, got %v", err)
+	}
+	// Checking a link, e.g. to save the file, is no download
+	if _, _, _, _, err := svc.CheckFileLink(ctx, token, "wrong"); !errors.Is(err, ErrLinkPasswordIncorrect) {
+		t.Fatalf("expected a check with a wrong password refused, got %v", err)
+	}
+	if f, _, _, revoked, err := svc.CheckFileLink(ctx, token, "pw"); err != nil || revoked || f == nil || repo.fileLinks[token].downloads != 0 {
+		t.Fatalf("expected the check to pass uncounted, got revoked=%v err=%v downloads=%d", revoked, err, repo.fileLinks[token].downloads)
+	}
+	for i := 0; i < 2; i++ {
+		if f, _, _, revoked, err := svc.ResolveFileLink(ctx, token, "pw"); err != nil || revoked || f == nil {
+			t.Fatalf("download %d: expected the link to resolve, got revoked=%v err=%v", i+1, revoked, err)
+		}
+	}
+	if _, _, _, revoked, err := svc.ResolveFileLink(ctx, token, "pw"); err != nil || !revoked {
+		t.Fatalf("expected the link expired after its downloads, got revoked=%v err=%v", revoked, err)
+	}
+	if repo.fileLinks[token].downloads != 2 {
+		t.Fatalf("expected refused resolves not counted, got %d downloads", repo.fileLinks[token].downloads)
+	}
+	if _, _, _, revoked, err := svc.CheckFileLink(ctx, token, "pw"); err != nil || !revoked {
+		t.Fatalf("expected a check of the used-up link refused, got revoked=%v err=%v", revoked, err)
+	}
+	if info, err := svc.InspectFileLink(ctx, token); err != nil || info.Status != LinkExpired {
+		t.Fatalf("expected inspection to report the used-up link expired, got %+v, %v", info, err)
+	}
+	if active, _ := repo.CountActiveLinksByOwner(ctx, owner); active != 0 {
+		t.Fatalf("expected the used-up link not to count as active, got %d", active)
+	}
+
+	// A fresh rotation lifts the limit, a preserving one keeps it
+	fresh, _, err := svc.RotateFileLink(ctx, owner, fileID, false)
+	if err != nil || repo.fileLinks[fresh].maxDownloads != nil {
+		t.Fatalf("expected a fresh rotation without a limit, got %v", err)
+	}
+	repo.fileLinks[fresh].maxDownloads = repo.fileLinks[token].maxDownloads
+	kept, _, err := svc.RotateFileLink(ctx, owner, fileID, true)
+	if err != nil || repo.fileLinks[kept].maxDownloads == nil || *repo.fileLinks[kept].maxDownloads != 2 {
+		t.Fatalf("expected a preserving rotation to keep the limit, got %v", err)
+	}
+}
+
+func TestPublicLinkService_MaxDownloads_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	owner := uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+	token, _, err := svc.CreateFileLink(ctx, owner, uuid.New(), nil, "", 5, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Two downloads in, the remaining three are raced for by many resolves at once
+	repo.fileLinks[token].downloads = 2
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served, expired := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, _, _, revoked, err := svc.ResolveFileLink(ctx, token, "")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case revoked:
+				expired++
+			case f != nil:
+				served++
+			}
+		}()
+	}
+	wg.Wait()
+	if served != 3 || expired != 17 || repo.fileLinks[token].downloads != 5 {
+		t.Fatalf("expected exactly the 3 remaining downloads served, got %d served, %d expired, %d counted", served, expired, repo.fileLinks[token].downloads)
+	}
+}
+
+func TestPublicLinkService_CreateFileLink_ReusesActiveLink(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{limits: map[uuid.UUID]int{owner: 1}}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+
+	first, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Sharing again hands back the same link, even at the owner's link cap
+	again, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false)
+	if err != nil || again != first || len(repo.fileLinks) != 1 {
+		t.Fatalf("expected the active link returned, got %q (%v) and %d links", again, err, len(repo.fileLinks))
+	}
+
+	// forceNew rotates it, replacing rather than adding to the owner's links
+	rotated, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, true)
+	if err != nil || rotated == first {
+		t.Fatalf("expected a new token with forceNew, got %q (%v)", rotated, err)
+	}
+	if _, _, _, revoked, err := svc.ResolveFileLink(ctx, first, ""); err != nil || !revoked {
+		t.Fatalf("expected the previous token revoked, got revoked=%v err=%v", revoked, err)
+	}
+	if again, _, _ := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false); again != rotated {
+		t.Fatalf("expected the rotated link reused from then on, got %q", again)
+	}
+
+	// A revoked or used-up link isn't reused
+	repo.fileLinks[rotated].maxDownloads = new(int64)
+	if next, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false); err != nil || next == rotated {
+		t.Fatalf("expected a new link for a used-up one, got %q (%v)", next, err)
+	}
+}
+
+func TestPublicLinkService_CreateFileLink_ConcurrentShare(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+	raceIn := func(token string) {
+		repo.beforeCreate = func(id uuid.UUID) {
+			repo.fileLinks[token] = &stubFileLink{fileID: id, ownerID: owner, seq: len(repo.fileLinks)}
+		}
+	}
+
+	// A plain share that loses the race gets the winner's link, not a second live one
+	raceIn("winner")
+	got, _, err := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false)
+	if err != nil || got != "winner" || len(repo.fileLinks) != 1 {
+		t.Fatalf("expected the concurrent link returned, got %q (%v) with %d links", got, err, len(repo.fileLinks))
+	}
+
+	// One asking for settings can't be handed a link without them
+	other := uuid.New()
+	raceIn("bare")
+	if _, _, err := svc.CreateFileLink(ctx, owner, other, nil, "pw", 0, false); err == nil {
+		t.Fatalf("expected a password-protected share to fail when another link won")
+	}
+	if repo.fileLinks["bare"].revokedAt != nil {
+		t.Fatalf("expected the winning link left live")
+	}
+}
+
+func TestPublicLinkService_CreateFileLink_SettingsReplaceLink(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+	svc.MaxActiveLinks = 1
+
+	plain, _, _ := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false)
+	protected, state, err := svc.CreateFileLink(ctx, owner, fileID, nil, "pw", 3, false)
+	if err != nil || protected == plain {
+		t.Fatalf("expected new settings to get a new token, got %q (%v)", protected, err)
+	}
+	if repo.fileLinks[plain].revokedAt == nil {
+		t.Fatalf("expected the earlier link revoked, leaving the file one live link")
+	}
+	if state.PasswordHash == nil || state.MaxDownloads == nil || *state.MaxDownloads != 3 {
+		t.Fatalf("expected the stored link's settings returned, got %+v", state)
+	}
+	// Without settings the replacement is the one handed out, password, limit and all
+	again, state, _ := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false)
+	if again != protected || state.MaxDownloads == nil || *state.MaxDownloads != 3 {
+		t.Fatalf("expected the active link reused with its limit, got %q %+v", again, state)
+	}
+}
+
+func TestPublicLinkService_GetLinkStats(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	day := func(d, h int) time.Time { return time.Date(2026, 3, d, h, 30, 0, 0, time.UTC) }
+	repo := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(repo, &stubShareRepo{}, nil, nil, nil)
+	token, _, _ := svc.CreateFileLink(ctx, owner, fileID, nil, "", 0, false)
+	// The link's counter, carried over from an earlier token, isn't what the stats count
+	repo.fileLinks[token].downloads = 9
+	repo.recorded = map[string][]time.Time{
+		token:   {day(1, 9), day(1, 17), day(3, 8), day(3, 8), day(3, 23), day(6, 0)},
+		"other": {day(2, 12)},
+	}
+
+	from, to := day(1, 12), day(5, 0)
+	stats, err := svc.GetLinkStats(ctx, owner, fileID, &from, &to, BucketDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Token != token || stats.TotalDownloads != 6 || !stats.From.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected stats header: %+v", stats)
+	}
+	want := []int64{2, 0, 3, 0, 0}
+	if len(stats.Buckets) != len(want) {
+		t.Fatalf("expected %d daily buckets, got %+v", len(want), stats.Buckets)
+	}
+	for i, b := range stats.Buckets {
+		if b.Downloads != want[i] || !b.Start.Equal(time.Date(2026, 3, 1+i, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("bucket %d: expected %d downloads on March %d, got %+v", i, want[i], i+1, b)
+		}
+	}
+
+	from, to = day(3, 0), day(3, 10)
+	hourly, err := svc.GetLinkStats(ctx, owner, fileID, &from, &to, BucketHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly.Buckets) != 11 || hourly.Buckets[8].Downloads != 2 {
+		t.Fatalf("expected 11 hourly buckets with 2 downloads at 08:00, got %+v", hourly.Buckets)
+	}
+
+	from, to = day(1, 0), day(1, 0).AddDate(0, 2, 0)
+	if _, err := svc.GetLinkStats(ctx, owner, fileID, &from, &to, BucketHour); err == nil {
+		t.Fatalf("expected two months of hours refused")
+	}
+	if _, err := svc.GetLinkStats(ctx, owner, fileID, &to, &from, BucketDay); err == nil {
+		t.Fatalf("expected a reversed range refused")
+	}
+	if _, err := svc.GetLinkStats(ctx, owner, uuid.New(), nil, nil, ""); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected a file without a link reported, got %v", err)
+	}
+	other := NewPublicLinkService(repo, &stubShareRepo{notOwner: true}, &stubUserRepo{}, nil, nil)
+	if _, err := other.GetLinkStats(ctx, uuid.New(), fileID, nil, nil, ""); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected a non-owner refused, got %v", err)
+	}
+}
+
+func TestPublicLinkService_ViewerCannotPublish(t *testing.T) {
+	links := &stubPublicLinkRepo{}
+	svc := NewPublicLinkService(links, &stubShareRepo{notOwner: true}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	ctx := context.Background()
+	viewer := uuid.New()
+
+	if _, _, err := svc.CreateFileLink(ctx, viewer, uuid.New(), nil, "", 0, false); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected viewer to be denied a file link, got %v", err)
+	}
+	if _, _, err := svc.CreateFolderLink(ctx, viewer, uuid.New(), nil, ""); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected viewer to be denied a folder link, got %v", err)
+	}
+	if _, _, err := svc.RotateFileLink(ctx, viewer, uuid.New(), true); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected viewer to be denied link rotation, got %v", err)
+	}
+	if err := svc.RevokeFolderLink(ctx, viewer, uuid.New()); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected viewer to be denied link revocation, got %v", err)
+	}
+	if len(links.fileLinks) != 0 {
+		t.Fatalf("expected no links to be created, got %d", len(links.fileLinks))
+	}
+}
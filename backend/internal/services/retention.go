@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/repository"
+)
+
+// SetRetention keeps one copy of a file, active or in the trash, from being trashed, purged
+// or deleted until until; nil lifts the retention. Admins may set any copy's retention.
+// Owners may set or extend their own, but shortening or lifting a retention still in force
+// takes an admin.
+func (s *FileService) SetRetention(ctx context.Context, userID, mappingID uuid.UUID, until *time.Time) error {
+	if s == nil || s.FileRepo == nil {
+		return ErrStorageUnavailable
+	}
+	if until != nil && !until.After(time.Now()) {
+		return fmt.Errorf("retention must end in the future")
+	}
+	if middleware.GetIsAdminFromContext(ctx) {
+		return s.FileRepo.SetUserFileRetention(ctx, mappingID, until)
+	}
+
+	uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, mappingID)
+	if err != nil {
+		return err
+	}
+	if uf == nil {
+		return fmt.Errorf("file %s: %w", mappingID, repository.ErrNotFound)
+	}
+	if uf.Role != "owner" {
+		return fmt.Errorf("only the owner can set a file's retention")
+	}
+	retained, err := s.FileRepo.GetRetainedMappings(ctx, uf.FileID)
+	if err != nil {
+		return err
+	}
+	if current, ok := retained[mappingID]; ok && (until == nil || until.Before(current)) {
+		return fmt.Errorf("unauthorized: only admins can shorten or lift a retention in force until %s", current.Format(time.RFC3339))
+	}
+	return s.FileRepo.SetUserFileRetention(ctx, mappingID, until)
+}
+
+// checkRetention fails with an error wrapping repository.ErrRetained when one of the given
+// copies of fileID is under retention. Without mappingIDs every copy of the file counts, for
+// operations that remove the content for everyone.
+func (s *FileService) checkRetention(ctx context.Context, fileID uuid.UUID, mappingIDs ...uuid.UUID) error {
+	retained, err := s.FileRepo.GetRetainedMappings(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if len(mappingIDs) == 0 {
+		for _, until := range retained {
+			return retentionError(until)
+		}
+		return nil
+	}
+	for _, id := range mappingIDs {
+		if until, ok := retained[id]; ok {
+			return retentionError(until)
+		}
+	}
+	return nil
+}
+
+func retentionError(until time.Time) error {
+	return fmt.Errorf("%w until %s and can't be deleted", repository.ErrRetained, until.Format(time.RFC3339))
+}
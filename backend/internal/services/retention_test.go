@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// retainedService returns a file service over a repo holding one owned mapping of a file,
+// retained for a day, with object removals recorded
+func retainedService(t *testing.T, mode DeleteMode) (*FileService, *stubFileRepo, uuid.UUID, uuid.UUID, uuid.UUID, *[]string) {
+	t.Helper()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	mappingID := repo.addMapping(userID, fileID)
+	fs, removed := deleteModeService(repo, mode)
+	until := time.Now().Add(24 * time.Hour)
+	if err := fs.SetRetention(context.Background(), userID, mappingID, &until); err != nil {
+		t.Fatalf("set retention: %v", err)
+	}
+	return fs, repo, userID, fileID, mappingID, removed
+}
+
+func TestFileService_Retention_BlocksSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, userID, fileID, mappingID, _ := retainedService(t, DeleteModeTrash)
+
+	if err := fs.SoftDeleteUserFile(ctx, userID, fileID); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected trashing a retained file to be refused, got %v", err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, userID, mappingID.String()); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected trashing a retained copy to be refused, got %v", err)
+	}
+	if active, _, _ := repo.CountFileMappings(ctx, fileID); active != 1 {
+		t.Fatalf("expected the file to stay active, got %d active", active)
+	}
+}
+
+func TestFileService_Retention_BlocksPurge(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{}
+	mappingID := repo.addMapping(userID, fileID)
+	fs, removed := deleteModeService(repo, DeleteModeTrash)
+	if err := fs.SoftDeleteUserFile(ctx, userID, fileID); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	// Retention applies to copies already in the trash too
+	until := time.Now().Add(time.Hour)
+	if err := fs.SetRetention(ctx, userID, mappingID, &until); err != nil {
+		t.Fatalf("set retention: %v", err)
+	}
+
+	if err := fs.PurgeUserFile(ctx, userID, fileID); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected purging a retained file to be refused, got %v", err)
+	}
+	if err := fs.PurgeUserFileByMappingID(ctx, userID, mappingID.String()); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected purging a retained copy to be refused, got %v", err)
+	}
+	if _, total, _ := repo.CountFileMappings(ctx, fileID); total != 1 || len(*removed) != 0 {
+		t.Fatalf("expected the trashed copy and its object kept, got %d mappings and removed %v", total, *removed)
+	}
+}
+
+func TestFileService_Retention_BlocksImmediateDelete(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, userID, fileID, _, removed := retainedService(t, DeleteModeImmediate)
+
+	if err := fs.DeleteFile(ctx, userID, fileID, ""); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected deleting a retained file to be refused, got %v", err)
+	}
+	if len(*removed) != 0 || repo.gone[fileID] {
+		t.Fatalf("expected the object and file row kept, got removed %v, gone %v", *removed, repo.gone[fileID])
+	}
+}
+
+func TestFileService_Retention_BlocksQuarantineDelete(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, _, fileID, _, removed := retainedService(t, DeleteModeTrash)
+	repo.statuses = map[uuid.UUID]string{fileID: models.FileStatusQuarantined}
+
+	if err := fs.DeleteQuarantinedFile(ctx, fileID); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected deleting retained quarantined content to be refused, got %v", err)
+	}
+	if len(*removed) != 0 || repo.gone[fileID] {
+		t.Fatalf("expected the content kept, got removed %v, gone %v", *removed, repo.gone[fileID])
+	}
+}
+
+func TestFileService_Retention_OnlyRetainedCopyIsHeld(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, _, fileID, _, _ := retainedService(t, DeleteModeTrash)
+	// Another user's copy of the same content can still be trashed
+	otherID := uuid.New()
+	repo.addMapping(otherID, fileID)
+
+	if err := fs.SoftDeleteUserFile(ctx, otherID, fileID); err != nil {
+		t.Fatalf("expected an unretained copy to be trashed, got %v", err)
+	}
+}
+
+func TestFileService_Retention_Expired(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, userID, fileID, mappingID, _ := retainedService(t, DeleteModeTrash)
+	repo.retained[mappingID] = time.Now().Add(-time.Minute)
+
+	if err := fs.SoftDeleteUserFile(ctx, userID, fileID); err != nil {
+		t.Fatalf("expected an expired retention not to block deletes, got %v", err)
+	}
+}
+
+func TestFileService_SetRetention_Permissions(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, userID, fileID, mappingID, _ := retainedService(t, DeleteModeTrash)
+
+	sooner := time.Now().Add(time.Hour)
+	if err := fs.SetRetention(ctx, userID, mappingID, &sooner); err == nil {
+		t.Fatalf("expected an owner not to shorten a retention in force")
+	}
+	if err := fs.SetRetention(ctx, userID, mappingID, nil); err == nil {
+		t.Fatalf("expected an owner not to lift a retention in force")
+	}
+	later := time.Now().Add(48 * time.Hour)
+	if err := fs.SetRetention(ctx, userID, mappingID, &later); err != nil {
+		t.Fatalf("expected an owner to extend a retention, got %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := fs.SetRetention(ctx, userID, mappingID, &past); err == nil {
+		t.Fatalf("expected a retention ending in the past to be rejected")
+	}
+	if err := fs.SetRetention(ctx, uuid.New(), mappingID, &later); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected another user's copy to report not found, got %v", err)
+	}
+
+	editorID := uuid.New()
+	editorMapping := repo.addMapping(editorID, fileID)
+	repo.roles = map[uuid.UUID]string{fileID: "editor"}
+	if err := fs.SetRetention(ctx, editorID, editorMapping, &later); err == nil {
+		t.Fatalf("expected a non-owner not to set retention")
+	}
+
+	admin := middleware.WithUser(ctx, uuid.New().String(), true)
+	if err := fs.SetRetention(admin, uuid.Nil, mappingID, nil); err != nil {
+		t.Fatalf("expected an admin to lift a retention, got %v", err)
+	}
+	if err := fs.SoftDeleteUserFile(ctx, userID, fileID); err != nil {
+		t.Fatalf("expected the file deletable once its retention is lifted, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -17,6 +18,19 @@ type ShareService struct {
 	UserRepo   repository.UserRepository
 	FileRepo   repository.FileRepository
 	FolderRepo repository.FolderRepository
+	// MaxLifetime caps how far in the future a share may expire (zero = no cap)
+	MaxLifetime time.Duration
+	// Notifier tells recipients about new shares (optional; without it nobody is told)
+	Notifier Notifier
+	// NotifyWait is how long share calls wait for their notifications before returning,
+	// defaultNotifyWait when zero; slower sends carry on in the background
+	NotifyWait time.Duration
+	// Files checks that a file handed to a new owner fits their quota (optional; without it
+	// transfers aren't quota-checked)
+	Files *FileService
+	// TransferRemovesPreviousOwner drops the previous owner's copies of a transferred file
+	// instead of keeping them as editor copies
+	TransferRemovesPreviousOwner bool
 }
 
 func NewShareService(shareRepo repository.ShareRepository, userRepo repository.UserRepository, fileRepo repository.FileRepository, folderRepo repository.FolderRepository) *ShareService {
@@ -28,25 +42,135 @@ func NewShareService(shareRepo repository.ShareRepository, userRepo repository.U
 	}
 }
 
-// ShareFile shares a file with multiple users via email
-func (s *ShareService) ShareFile(ctx context.Context, userID uuid.UUID, fileID uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FileShare, error) {
-	// Validate that the user owns the file
-	hasAccess, role, err := s.ShareRepo.HasFileAccess(ctx, userID, "", fileID)
+// validateExpiry rejects expiries in the past and, when maxLifetime is set, expiries
+// further out than maxLifetime from now. A nil expiry means "never expires" and is
+// always accepted.
+func validateExpiry(expiresAt *time.Time, maxLifetime time.Duration) error {
+	if expiresAt == nil {
+		return nil
+	}
+	now := time.Now()
+	if !expiresAt.After(now) {
+		return fmt.Errorf("expiry must be in the future")
+	}
+	if maxLifetime > 0 && expiresAt.After(now.Add(maxLifetime)) {
+		return fmt.Errorf("expiry exceeds maximum lifetime of %s", maxLifetime)
+	}
+	return nil
+}
+
+// ErrNotOwner is returned when someone other than the owner, including share recipients with
+// viewer or editor access, tries to share an item, publish a link to it, or manage its sharing.
+var ErrNotOwner = errors.New("only the owner can share or publish this item")
+
+// requireFileOwner checks that userID owns fileID. On failure the user's email is looked up
+// so a share recipient is told which access they do have.
+func requireFileOwner(ctx context.Context, shares repository.ShareRepository, users repository.UserRepository, userID, fileID uuid.UUID) error {
+	has, role, err := shares.HasFileAccess(ctx, userID, "", fileID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check file access: %w", err)
+		return fmt.Errorf("failed to check file access: %w", err)
+	}
+	if has && role == "owner" {
+		return nil
+	}
+	if !has && users != nil {
+		if email, err := users.GetUserEmailByID(ctx, userID.String()); err == nil && email != "" {
+			has, role, _ = shares.HasFileAccess(ctx, userID, email, fileID)
+		}
+	}
+	return notOwnerError("file", has, role)
+}
+
+// requireFolderOwner checks that userID owns folderID; see requireFileOwner.
+func requireFolderOwner(ctx context.Context, shares repository.ShareRepository, users repository.UserRepository, userID, folderID uuid.UUID) error {
+	has, role, err := folderAccess(ctx, shares, users, userID, folderID)
+	if err != nil {
+		return err
 	}
-	if !hasAccess || role != "owner" {
-		return nil, fmt.Errorf("you don't have permission to share this file")
+	if has && role == "owner" {
+		return nil
 	}
+	return notOwnerError("folder", has, role)
+}
+
+// ErrNotEditor is returned when a share recipient without editor access tries to add files
+// to a shared folder or remove them.
+var ErrNotEditor = errors.New("editor access required")
 
-	// Validate permission - only viewer is allowed
-	if permission != "viewer" {
-		return nil, fmt.Errorf("invalid permission: only 'viewer' is allowed")
+// requireFolderEditor checks that userID owns folderID or it is shared with them as editor.
+func requireFolderEditor(ctx context.Context, shares repository.ShareRepository, users repository.UserRepository, userID, folderID uuid.UUID) error {
+	has, role, err := folderAccess(ctx, shares, users, userID, folderID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case has && (role == "owner" || role == "editor"):
+		return nil
+	case has:
+		return fmt.Errorf("%w: you have %s access to this folder", ErrNotEditor, role)
+	}
+	return fmt.Errorf("%w: folder not found or access denied", ErrNotEditor)
+}
+
+// folderAccess is HasFolderAccess for userID, looking up their email only when they
+// don't own the folder.
+func folderAccess(ctx context.Context, shares repository.ShareRepository, users repository.UserRepository, userID, folderID uuid.UUID) (bool, string, error) {
+	has, role, err := shares.HasFolderAccess(ctx, userID, "", folderID)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check folder access: %w", err)
+	}
+	if has && role == "owner" {
+		return has, role, nil
+	}
+	if !has && users != nil {
+		if email, err := users.GetUserEmailByID(ctx, userID.String()); err == nil && email != "" {
+			has, role, _ = shares.HasFolderAccess(ctx, userID, email, folderID)
+		}
+	}
+	return has, role, nil
+}
+
+func notOwnerError(kind string, has bool, role string) error {
+	if !has || role == "" {
+		return fmt.Errorf("%w: %s not found or access denied", ErrNotOwner, kind)
+	}
+	return fmt.Errorf("%w: you have %s access to this %s", ErrNotOwner, role, kind)
+}
+
+// sharePermissions are the permissions a share can grant. Editors of a folder may also
+// upload into it and move the files they added to trash; only the owner can share an
+// item or change its shares.
+var sharePermissions = map[string]bool{"viewer": true, "editor": true}
+
+// validSharePermission rejects permissions a share can't grant.
+func validSharePermission(permission string) error {
+	if !sharePermissions[permission] {
+		return fmt.Errorf("invalid permission: %q must be 'viewer' or 'editor'", permission)
+	}
+	return nil
+}
+
+// ShareFile shares a file with multiple users via email. Recipients are then notified;
+// those who couldn't be are returned as failures, their shares kept.
+func (s *ShareService) ShareFile(ctx context.Context, userID uuid.UUID, fileID uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FileShare, []NotifyFailure, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, userID, fileID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validSharePermission(permission); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateExpiry(expiresAt, s.MaxLifetime); err != nil {
+		return nil, nil, err
 	}
 
 	var shares []models.FileShare
 	var errors []string
 
+	// Get user email to prevent sharing with self
+	ownerEmail, ownerErr := s.UserRepo.GetUserEmailByID(ctx, userID.String())
+
 	for _, email := range emails {
 		email = strings.ToLower(strings.TrimSpace(email))
 		if email == "" {
@@ -59,9 +183,7 @@ func (s *ShareService) ShareFile(ctx context.Context, userID uuid.UUID, fileID u
 			continue
 		}
 
-		// Get user email to prevent sharing with self
-		ownerEmail, err := s.UserRepo.GetUserEmailByID(ctx, userID.String())
-		if err == nil && ownerEmail == email {
+		if ownerErr == nil && ownerEmail == email {
 			errors = append(errors, fmt.Sprintf("cannot share with yourself: %s", email))
 			continue
 		}
@@ -77,31 +199,215 @@ func (s *ShareService) ShareFile(ctx context.Context, userID uuid.UUID, fileID u
 	}
 
 	if len(errors) > 0 && len(shares) == 0 {
-		return nil, fmt.Errorf("failed to share with any users: %s", strings.Join(errors, "; "))
+		return nil, nil, fmt.Errorf("failed to share with any users: %s", strings.Join(errors, "; "))
+	}
+
+	var notifications []ShareNotification
+	if s.Notifier != nil && len(shares) > 0 {
+		info := s.fileShareInfo(ctx, userID, fileID, ownerEmail, permission, expiresAt)
+		for _, share := range shares {
+			notifications = append(notifications, ShareNotification{RecipientEmail: share.SharedWithEmail, Share: info})
+		}
+	}
+	return shares, notifyShares(ctx, s.Notifier, notifications, s.NotifyWait), nil
+}
+
+// fileShareInfo describes ownerID's file for share notifications. The name is the one the
+// owner sees, their newest copy's display name as in BulkShareFiles, and is left out when
+// it can't be looked up.
+func (s *ShareService) fileShareInfo(ctx context.Context, ownerID, fileID uuid.UUID, ownerEmail, permission string, expiresAt *time.Time) ShareInfo {
+	info := ShareInfo{Kind: "file", ItemID: fileID, OwnerEmail: ownerEmail, Permission: permission, ExpiresAt: expiresAt}
+	if ufs, err := s.FileRepo.GetUserFilesByFileIDs(ctx, ownerID, []uuid.UUID{fileID}); err == nil && len(ufs) > 0 {
+		info.ItemName = ufs[0].File.OriginalName
+	}
+	return info
+}
+
+// folderShareInfo is fileShareInfo for a folder.
+func (s *ShareService) folderShareInfo(ctx context.Context, ownerID, folderID uuid.UUID, ownerEmail, permission string, expiresAt *time.Time) ShareInfo {
+	info := ShareInfo{Kind: "folder", ItemID: folderID, OwnerEmail: ownerEmail, Permission: permission, ExpiresAt: expiresAt}
+	if f, err := s.FolderRepo.GetFolderByID(ctx, ownerID, folderID); err == nil && f != nil {
+		info.ItemName = f.Name
 	}
+	return info
+}
 
-	return shares, nil
+// maxBulkShareFiles caps how many files BulkShareFiles shares at once
+const maxBulkShareFiles = 500
+
+// maxBulkShareEmails caps how many recipients BulkShareFiles shares with at once
+const maxBulkShareEmails = 50
+
+// BulkShareResult is the outcome of sharing one file with one recipient in BulkShareFiles.
+type BulkShareResult struct {
+	FileID uuid.UUID
+	Email  string
+	// Share is the created or updated share; nil when Error is set
+	Share *models.FileShare
+	Error string
+	// NotifyError is why the recipient couldn't be told about the share, which stands
+	NotifyError string
 }
 
-// ShareFolder shares a folder with multiple users via email
-func (s *ShareService) ShareFolder(ctx context.Context, userID uuid.UUID, folderID uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FolderShare, error) {
-	// Validate that the user owns the folder
-	hasAccess, role, err := s.ShareRepo.HasFolderAccess(ctx, userID, "", folderID)
+// BulkShareFiles shares several files with the same recipients, e.g. "share selected with
+// team". Repeated file ids and emails count once, emails compared case-insensitively.
+// Ownership is checked for every file in one lookup, and files the user doesn't own, like
+// invalid emails or the user's own, are reported in their results without stopping the
+// others. The remaining shares are created together: either all of them or, on error, none,
+// and their recipients are then notified in one batch. Results are ordered by file, then
+// email, as given.
+func (s *ShareService) BulkShareFiles(ctx context.Context, ownerID uuid.UUID, fileIDs []uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]BulkShareResult, error) {
+	if err := validSharePermission(permission); err != nil {
+		return nil, err
+	}
+	if err := validateExpiry(expiresAt, s.MaxLifetime); err != nil {
+		return nil, err
+	}
+
+	files := make([]uuid.UUID, 0, len(fileIDs))
+	seenFiles := make(map[uuid.UUID]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		if !seenFiles[id] {
+			seenFiles[id] = true
+			files = append(files, id)
+		}
+	}
+	recipients := make([]string, 0, len(emails))
+	seenEmails := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" && !seenEmails[email] {
+			seenEmails[email] = true
+			recipients = append(recipients, email)
+		}
+	}
+	if len(files) == 0 || len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one file and one email are required")
+	}
+	if len(files) > maxBulkShareFiles {
+		return nil, fmt.Errorf("too many files: at most %d can be shared at once", maxBulkShareFiles)
+	}
+	if len(recipients) > maxBulkShareEmails {
+		return nil, fmt.Errorf("too many emails: at most %d can be shared with at once", maxBulkShareEmails)
+	}
+
+	ownerEmail, err := s.UserRepo.GetUserEmailByID(ctx, ownerID.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to check folder access: %w", err)
+		return nil, fmt.Errorf("failed to get user email: %w", err)
+	}
+	levels, err := s.ShareRepo.GetFileAccessLevels(ctx, ownerID, ownerEmail, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check file access: %w", err)
+	}
+
+	fileErrors := map[uuid.UUID]string{}
+	var owned []uuid.UUID
+	for _, id := range files {
+		role, has := levels[id]
+		if has && role == "owner" {
+			owned = append(owned, id)
+			continue
+		}
+		fileErrors[id] = notOwnerError("file", has, role).Error()
+	}
+	emailErrors := map[string]string{}
+	var valid []string
+	for _, email := range recipients {
+		switch {
+		case !strings.Contains(email, "@"):
+			emailErrors[email] = fmt.Sprintf("invalid email format: %s", email)
+		case email == ownerEmail:
+			emailErrors[email] = fmt.Sprintf("cannot share with yourself: %s", email)
+		default:
+			valid = append(valid, email)
+		}
+	}
+
+	created := map[uuid.UUID]map[string]*models.FileShare{}
+	if len(owned) > 0 && len(valid) > 0 {
+		shares, err := s.ShareRepo.CreateFileShares(ctx, ownerID, owned, valid, permission, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create shares: %w", err)
+		}
+		for i := range shares {
+			share := &shares[i]
+			if created[share.FileID] == nil {
+				created[share.FileID] = map[string]*models.FileShare{}
+			}
+			created[share.FileID][share.SharedWithEmail] = share
+		}
 	}
-	if !hasAccess || role != "owner" {
-		return nil, fmt.Errorf("you don't have permission to share this folder")
+
+	notifyErrors := map[uuid.UUID]map[string]string{}
+	if s.Notifier != nil && len(created) > 0 {
+		names := map[uuid.UUID]string{}
+		if ufs, err := s.FileRepo.GetUserFilesByFileIDs(ctx, ownerID, owned); err == nil {
+			for _, uf := range ufs {
+				names[uf.FileID] = uf.File.OriginalName
+			}
+		}
+		var notifications []ShareNotification
+		for _, id := range owned {
+			if len(created[id]) == 0 {
+				continue
+			}
+			info := ShareInfo{Kind: "file", ItemID: id, ItemName: names[id], OwnerEmail: ownerEmail, Permission: permission, ExpiresAt: expiresAt}
+			for _, email := range valid {
+				if created[id][email] != nil {
+					notifications = append(notifications, ShareNotification{RecipientEmail: email, Share: info})
+				}
+			}
+		}
+		for _, f := range notifyShares(ctx, s.Notifier, notifications, s.NotifyWait) {
+			if notifyErrors[f.ItemID] == nil {
+				notifyErrors[f.ItemID] = map[string]string{}
+			}
+			notifyErrors[f.ItemID][f.Email] = f.Err.Error()
+		}
 	}
 
-	// Validate permission - only viewer is allowed
-	if permission != "viewer" {
-		return nil, fmt.Errorf("invalid permission: only 'viewer' is allowed")
+	results := make([]BulkShareResult, 0, len(files)*len(recipients))
+	for _, id := range files {
+		for _, email := range recipients {
+			result := BulkShareResult{FileID: id, Email: email}
+			switch {
+			case fileErrors[id] != "":
+				result.Error = fileErrors[id]
+			case emailErrors[email] != "":
+				result.Error = emailErrors[email]
+			case created[id][email] != nil:
+				result.Share = created[id][email]
+				result.NotifyError = notifyErrors[id][email]
+			default:
+				result.Error = "failed to create share"
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// ShareFolder shares a folder with multiple users via email. Recipients are then notified;
+// those who couldn't be are returned as failures, their shares kept.
+func (s *ShareService) ShareFolder(ctx context.Context, userID uuid.UUID, folderID uuid.UUID, emails []string, permission string, expiresAt *time.Time) ([]models.FolderShare, []NotifyFailure, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, userID, folderID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validSharePermission(permission); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateExpiry(expiresAt, s.MaxLifetime); err != nil {
+		return nil, nil, err
 	}
 
 	var shares []models.FolderShare
 	var errors []string
 
+	// Get user email to prevent sharing with self
+	ownerEmail, ownerErr := s.UserRepo.GetUserEmailByID(ctx, userID.String())
+
 	for _, email := range emails {
 		email = strings.ToLower(strings.TrimSpace(email))
 		if email == "" {
@@ -114,9 +420,7 @@ func (s *ShareService) ShareFolder(ctx context.Context, userID uuid.UUID, folder
 			continue
 		}
 
-		// Get user email to prevent sharing with self
-		ownerEmail, err := s.UserRepo.GetUserEmailByID(ctx, userID.String())
-		if err == nil && ownerEmail == email {
+		if ownerErr == nil && ownerEmail == email {
 			errors = append(errors, fmt.Sprintf("cannot share with yourself: %s", email))
 			continue
 		}
@@ -132,63 +436,252 @@ func (s *ShareService) ShareFolder(ctx context.Context, userID uuid.UUID, folder
 	}
 
 	if len(errors) > 0 && len(shares) == 0 {
-		return nil, fmt.Errorf("failed to share with any users: %s", strings.Join(errors, "; "))
+		return nil, nil, fmt.Errorf("failed to share with any users: %s", strings.Join(errors, "; "))
+	}
+
+	var notifications []ShareNotification
+	if s.Notifier != nil && len(shares) > 0 {
+		info := s.folderShareInfo(ctx, userID, folderID, ownerEmail, permission, expiresAt)
+		for _, share := range shares {
+			notifications = append(notifications, ShareNotification{RecipientEmail: share.SharedWithEmail, Share: info})
+		}
+	}
+	return shares, notifyShares(ctx, s.Notifier, notifications, s.NotifyWait), nil
+}
+
+// UpdateSharePermission changes the permission of an existing file share in place, keeping
+// its share date and expiry. Only the file owner may change it.
+func (s *ShareService) UpdateSharePermission(ctx context.Context, ownerID uuid.UUID, fileID uuid.UUID, email string, permission string) (*models.FileShare, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
+		return nil, err
+	}
+	if err := validSharePermission(permission); err != nil {
+		return nil, err
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	share, err := s.ShareRepo.UpdateFileSharePermission(ctx, fileID, email, permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update share: %w", err)
+	}
+	if share == nil {
+		return nil, fmt.Errorf("file is not shared with %s", email)
+	}
+	return share, nil
+}
+
+// UpdateFolderSharePermission changes the permission of an existing folder share in place.
+// Only the folder owner may change it.
+func (s *ShareService) UpdateFolderSharePermission(ctx context.Context, ownerID uuid.UUID, folderID uuid.UUID, email string, permission string) (*models.FolderShare, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, folderID); err != nil {
+		return nil, err
+	}
+	if err := validSharePermission(permission); err != nil {
+		return nil, err
 	}
 
-	return shares, nil
+	email = strings.ToLower(strings.TrimSpace(email))
+	share, err := s.ShareRepo.UpdateFolderSharePermission(ctx, folderID, email, permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update share: %w", err)
+	}
+	if share == nil {
+		return nil, fmt.Errorf("folder is not shared with %s", email)
+	}
+	return share, nil
 }
 
 // UnshareFile removes sharing access for a specific email
 func (s *ShareService) UnshareFile(ctx context.Context, userID uuid.UUID, fileID uuid.UUID, sharedWithEmail string) error {
-	// Validate that the user owns the file
-	hasAccess, role, err := s.ShareRepo.HasFileAccess(ctx, userID, "", fileID)
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, userID, fileID); err != nil {
+		return err
+	}
+
+	return s.ShareRepo.DeleteFileShare(ctx, fileID, sharedWithEmail)
+}
+
+// UnshareFileAll revokes every share of a file at once, e.g. after over-sharing a
+// sensitive document, and returns how many were revoked. Only the owner may do so.
+func (s *ShareService) UnshareFileAll(ctx context.Context, ownerID, fileID uuid.UUID) (int, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
+		return 0, err
+	}
+	n, err := s.ShareRepo.DeleteAllFileShares(ctx, fileID)
 	if err != nil {
-		return fmt.Errorf("failed to check file access: %w", err)
+		return 0, fmt.Errorf("failed to revoke shares: %w", err)
 	}
-	if !hasAccess || role != "owner" {
-		return fmt.Errorf("you don't have permission to unshare this file")
+	return int(n), nil
+}
+
+// ErrTransferTarget is returned when a file can't be handed to the requested user: there is
+// no account with that email, or it is the caller's own.
+var ErrTransferTarget = errors.New("invalid new owner")
+
+// TransferFileOwnership hands currentOwnerID's file to the user with newOwnerEmail. The new
+// owner gets an owner copy of it, or their existing copy is promoted, and takes over the
+// shares of it; the previous owner keeps their copies as editor or, with
+// TransferRemovesPreviousOwner, loses them, which copies under retention prevent. Storage
+// usage moves along, since editor copies don't count against their holder's quota, so the
+// file must fit the new owner's quota unless they already hold it. That check runs in the
+// transfer's own transaction.
+func (s *ShareService) TransferFileOwnership(ctx context.Context, currentOwnerID, fileID uuid.UUID, newOwnerEmail string) error {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, currentOwnerID, fileID); err != nil {
+		return err
+	}
+
+	newOwnerEmail = strings.ToLower(strings.TrimSpace(newOwnerEmail))
+	account, _, err := s.UserRepo.FindUserByEmailAny(ctx, newOwnerEmail)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("failed to look up %s: %w", newOwnerEmail, err)
+	}
+	var newOwnerID uuid.UUID
+	switch u := account.(type) {
+	case *models.User:
+		if u != nil {
+			newOwnerID = u.ID
+		}
+	case *models.GoogleUser:
+		if u != nil {
+			newOwnerID = u.ID
+		}
+	}
+	if newOwnerID == uuid.Nil {
+		return fmt.Errorf("%w: no user with email %s", ErrTransferTarget, newOwnerEmail)
+	}
+	if newOwnerID == currentOwnerID {
+		return fmt.Errorf("%w: you already own this file", ErrTransferTarget)
 	}
 
-	return s.ShareRepo.DeleteFileShare(ctx, fileID, sharedWithEmail)
+	quota := int64(-1)
+	if s.Files != nil {
+		if quota, err = s.transferQuota(ctx, newOwnerID); err != nil {
+			return err
+		}
+	}
+
+	err = s.FileRepo.TransferFileOwnership(ctx, currentOwnerID, newOwnerID, newOwnerEmail, fileID, !s.TransferRemovesPreviousOwner, quota)
+	if errors.Is(err, repository.ErrOverQuota) {
+		return fmt.Errorf("%w: the file doesn't fit the new owner's remaining quota", ErrQuotaExceeded)
+	}
+	return err
 }
 
-// UnshareFolder removes sharing access for a specific email
-func (s *ShareService) UnshareFolder(ctx context.Context, userID uuid.UUID, folderID uuid.UUID, sharedWithEmail string) error {
-	// Validate that the user owns the folder
-	hasAccess, role, err := s.ShareRepo.HasFolderAccess(ctx, userID, "", folderID)
+// transferQuota returns how many bytes of owned content newOwnerID may hold: their quota,
+// lowered to what their organization has left when that is less. The organization's share
+// is read here, outside the transfer, so like uploads concurrent changes can overshoot it.
+func (s *ShareService) transferQuota(ctx context.Context, newOwnerID uuid.UUID) (int64, error) {
+	quota, err := s.Files.userQuota(ctx, newOwnerID)
 	if err != nil {
-		return fmt.Errorf("failed to check folder access: %w", err)
+		return 0, err
 	}
-	if !hasAccess || role != "owner" {
-		return fmt.Errorf("you don't have permission to unshare this folder")
+	orgRemaining, inOrg, err := s.Files.orgRemainingQuota(ctx, newOwnerID)
+	if err != nil || !inOrg {
+		return quota, err
+	}
+	used, err := s.FileRepo.GetUserUsageSum(ctx, newOwnerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return min(quota, used+orgRemaining), nil
+}
+
+// FolderSharePreview is what sharing a folder would make accessible: everything below it
+type FolderSharePreview struct {
+	FolderID       uuid.UUID
+	FileCount      int
+	SubfolderCount int
+	// TotalBytes sums the sizes of the files, as a recipient would download them
+	TotalBytes int64
+}
+
+// PreviewFolderShare reports how many files and subfolders, and how many bytes, a share of
+// folderID would expose, counting the whole tree below it since folder shares are
+// inherited. Only the folder's owner may preview it. Nothing is shared.
+func (s *ShareService) PreviewFolderShare(ctx context.Context, ownerID, folderID uuid.UUID) (*FolderSharePreview, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, folderID); err != nil {
+		return nil, err
+	}
+	if s.FolderRepo == nil {
+		return nil, fmt.Errorf("folder repository not configured")
+	}
+	subfolders, err := s.FolderRepo.GetAllSubfolders(ctx, ownerID, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subfolders: %w", err)
+	}
+	preview := &FolderSharePreview{FolderID: folderID, SubfolderCount: len(subfolders)}
+	folderIDs := make([]uuid.UUID, 0, len(subfolders)+1)
+	folderIDs = append(folderIDs, folderID)
+	for _, sub := range subfolders {
+		folderIDs = append(folderIDs, sub.ID)
+	}
+	for _, id := range folderIDs {
+		files, err := s.ShareRepo.GetFolderFiles(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files of folder %s: %w", id, err)
+		}
+		preview.FileCount += len(files)
+		for _, f := range files {
+			preview.TotalBytes += f.File.Size
+		}
+	}
+	return preview, nil
+}
+
+// UnshareFolder removes sharing access for a specific email
+func (s *ShareService) UnshareFolder(ctx context.Context, userID uuid.UUID, folderID uuid.UUID, sharedWithEmail string) error {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, userID, folderID); err != nil {
+		return err
 	}
 
 	return s.ShareRepo.DeleteFolderShare(ctx, folderID, sharedWithEmail)
 }
 
-// GetFileShares gets all shares for a file (only if user owns it)
-func (s *ShareService) GetFileShares(ctx context.Context, userID uuid.UUID, fileID uuid.UUID) ([]models.FileShare, error) {
-	// Validate that the user owns the file
-	hasAccess, role, err := s.ShareRepo.HasFileAccess(ctx, userID, "", fileID)
+// UnshareFolderAll is UnshareFileAll for a folder.
+func (s *ShareService) UnshareFolderAll(ctx context.Context, ownerID, folderID uuid.UUID) (int, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, folderID); err != nil {
+		return 0, err
+	}
+	n, err := s.ShareRepo.DeleteAllFolderShares(ctx, folderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check file access: %w", err)
+		return 0, fmt.Errorf("failed to revoke shares: %w", err)
 	}
-	if !hasAccess || role != "owner" {
-		return nil, fmt.Errorf("you don't have permission to view shares for this file")
+	return int(n), nil
+}
+
+// GetFileShares gets all shares for a file (only if user owns it)
+func (s *ShareService) GetFileShares(ctx context.Context, userID uuid.UUID, fileID uuid.UUID) ([]models.FileShare, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, userID, fileID); err != nil {
+		return nil, err
 	}
 
 	return s.ShareRepo.GetFileShares(ctx, fileID)
 }
 
-// GetFolderShares gets all shares for a folder (only if user owns it)
-func (s *ShareService) GetFolderShares(ctx context.Context, userID uuid.UUID, folderID uuid.UUID) ([]models.FolderShare, error) {
-	// Validate that the user owns the folder
-	hasAccess, role, err := s.ShareRepo.HasFolderAccess(ctx, userID, "", folderID)
+// GetShareAccessStatus reports, for each recipient the file is shared with, whether and when
+// they last downloaded or previewed it (only if user owns the file)
+func (s *ShareService) GetShareAccessStatus(ctx context.Context, ownerID uuid.UUID, fileID uuid.UUID) ([]models.ShareAccess, error) {
+	if err := requireFileOwner(ctx, s.ShareRepo, s.UserRepo, ownerID, fileID); err != nil {
+		return nil, err
+	}
+
+	access, err := s.ShareRepo.GetFileShareAccess(ctx, fileID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check folder access: %w", err)
+		return nil, err
 	}
-	if !hasAccess || role != "owner" {
-		return nil, fmt.Errorf("you don't have permission to view shares for this folder")
+	for i := range access {
+		a := &access[i]
+		a.LastAccessedAt = a.LastDownloadedAt
+		if a.LastPreviewedAt != nil && (a.LastAccessedAt == nil || a.LastPreviewedAt.After(*a.LastAccessedAt)) {
+			a.LastAccessedAt = a.LastPreviewedAt
+		}
+	}
+	return access, nil
+}
+
+// GetFolderShares gets all shares for a folder (only if user owns it)
+func (s *ShareService) GetFolderShares(ctx context.Context, userID uuid.UUID, folderID uuid.UUID) ([]models.FolderShare, error) {
+	if err := requireFolderOwner(ctx, s.ShareRepo, s.UserRepo, userID, folderID); err != nil {
+		return nil, err
 	}
 
 	return s.ShareRepo.GetFolderShares(ctx, folderID)
@@ -214,11 +707,114 @@ func (s *ShareService) GetSharedFoldersWithMe(ctx context.Context, userID uuid.U
 	return s.ShareRepo.GetFolderSharesForUser(ctx, userEmail)
 }
 
+// SharesByMe is everything a user has shared, with the shares that have expired kept apart
+// from the ones still granting access. Each list is newest first.
+type SharesByMe struct {
+	FileShares          []models.FileShare
+	FolderShares        []models.FolderShare
+	ExpiredFileShares   []models.FileShare
+	ExpiredFolderShares []models.FolderShare
+}
+
+// GetSharesCreatedByMe lists the file and folder shares the user has created, expired ones
+// included so they can be renewed or cleaned up. Each share's Owner is the user.
+func (s *ShareService) GetSharesCreatedByMe(ctx context.Context, userID uuid.UUID) (*SharesByMe, error) {
+	email, err := s.UserRepo.GetUserEmailByID(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user email: %w", err)
+	}
+	owner := models.User{ID: userID, Email: email}
+
+	fileShares, err := s.ShareRepo.GetFileSharesByOwner(ctx, userID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file shares: %w", err)
+	}
+	folderShares, err := s.ShareRepo.GetFolderSharesByOwner(ctx, userID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder shares: %w", err)
+	}
+
+	now := time.Now()
+	out := &SharesByMe{}
+	for _, share := range fileShares {
+		share.Owner = owner
+		if share.ExpiresAt != nil && !share.ExpiresAt.After(now) {
+			out.ExpiredFileShares = append(out.ExpiredFileShares, share)
+		} else {
+			out.FileShares = append(out.FileShares, share)
+		}
+	}
+	for _, share := range folderShares {
+		share.Owner = owner
+		if share.ExpiresAt != nil && !share.ExpiresAt.After(now) {
+			out.ExpiredFolderShares = append(out.ExpiredFolderShares, share)
+		} else {
+			out.FolderShares = append(out.FolderShares, share)
+		}
+	}
+	return out, nil
+}
+
 // HasFolderAccess checks if a user has access to a folder (either as owner or via sharing)
 func (s *ShareService) HasFolderAccess(ctx context.Context, userID uuid.UUID, userEmail string, folderID uuid.UUID) (bool, string, error) {
 	return s.ShareRepo.HasFolderAccess(ctx, userID, userEmail, folderID)
 }
 
+// maxAccessItems caps how many items one GetAccessLevels call may look up
+const maxAccessItems = 500
+
+// GetAccessLevels returns the user's permission on each item, in the order given, using one
+// batched lookup per item type. Items the user cannot access are reported as "none".
+func (s *ShareService) GetAccessLevels(ctx context.Context, userID uuid.UUID, items []models.AccessItem) ([]models.ItemAccess, error) {
+	if len(items) > maxAccessItems {
+		return nil, fmt.Errorf("too many items: at most %d can be checked at once", maxAccessItems)
+	}
+
+	var fileIDs, folderIDs []uuid.UUID
+	for _, item := range items {
+		switch item.Type {
+		case "file":
+			fileIDs = append(fileIDs, item.ID)
+		case "folder":
+			folderIDs = append(folderIDs, item.ID)
+		default:
+			return nil, fmt.Errorf("invalid item type %q: must be 'file' or 'folder'", item.Type)
+		}
+	}
+
+	userEmail, err := s.UserRepo.GetUserEmailByID(ctx, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user email: %w", err)
+	}
+
+	fileLevels := map[uuid.UUID]string{}
+	if len(fileIDs) > 0 {
+		if fileLevels, err = s.ShareRepo.GetFileAccessLevels(ctx, userID, userEmail, fileIDs); err != nil {
+			return nil, fmt.Errorf("failed to check file access: %w", err)
+		}
+	}
+	folderLevels := map[uuid.UUID]string{}
+	if len(folderIDs) > 0 {
+		if folderLevels, err = s.ShareRepo.GetFolderAccessLevels(ctx, userID, userEmail, folderIDs); err != nil {
+			return nil, fmt.Errorf("failed to check folder access: %w", err)
+		}
+	}
+
+	result := make([]models.ItemAccess, len(items))
+	for i, item := range items {
+		levels := fileLevels
+		if item.Type == "folder" {
+			levels = folderLevels
+		}
+		permission := levels[item.ID]
+		if permission == "" {
+			permission = "none"
+		}
+		result[i] = models.ItemAccess{AccessItem: item, Permission: permission}
+	}
+	return result, nil
+}
+
 // GetSharedFolderFiles gets files within a shared folder that the user has access to (direct files only, not recursive)
 func (s *ShareService) GetSharedFolderFiles(ctx context.Context, userID uuid.UUID, folderID uuid.UUID) ([]models.UserFile, error) {
 	// Get user email for access check
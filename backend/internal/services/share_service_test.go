@@ -0,0 +1,735 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+func TestShareService_ShareFile_Expiry(t *testing.T) {
+	svc := NewShareService(&stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.MaxLifetime = 30 * 24 * time.Hour
+	ctx := context.Background()
+	emails := []string{"friend@example.com"}
+
+	past := time.Now().Add(-time.Hour)
+	if _, _, err := svc.ShareFile(ctx, uuid.New(), uuid.New(), emails, "viewer", &past); err == nil {
+		t.Fatalf("expected past expiry to be rejected")
+	}
+
+	tooFar := time.Now().Add(31 * 24 * time.Hour)
+	if _, _, err := svc.ShareFolder(ctx, uuid.New(), uuid.New(), emails, "viewer", &tooFar); err == nil {
+		t.Fatalf("expected expiry beyond max lifetime to be rejected")
+	}
+
+	valid := time.Now().Add(7 * 24 * time.Hour)
+	shares, _, err := svc.ShareFile(ctx, uuid.New(), uuid.New(), emails, "viewer", &valid)
+	if err != nil || len(shares) != 1 {
+		t.Fatalf("expected valid expiry to be accepted, got %v", err)
+	}
+
+	if _, _, err := svc.ShareFile(ctx, uuid.New(), uuid.New(), emails, "viewer", nil); err != nil {
+		t.Fatalf("expected no expiry to be accepted, got %v", err)
+	}
+}
+
+func TestShareService_GetShareAccessStatus(t *testing.T) {
+	fileID := uuid.New()
+	seen, downloaded, unseen := uuid.New(), uuid.New(), uuid.New()
+	earlier := time.Now().Add(-2 * time.Hour)
+	later := time.Now().Add(-time.Hour)
+	repo := &stubShareRepo{access: map[uuid.UUID][]models.ShareAccess{fileID: {
+		{ShareID: uuid.New(), SharedWithEmail: "seen@example.com", RecipientID: &seen, LastDownloadedAt: &earlier, LastPreviewedAt: &later},
+		{ShareID: uuid.New(), SharedWithEmail: "downloaded@example.com", RecipientID: &downloaded, LastDownloadedAt: &earlier},
+		{ShareID: uuid.New(), SharedWithEmail: "unseen@example.com", RecipientID: &unseen},
+		{ShareID: uuid.New(), SharedWithEmail: "invited@example.com"},
+	}}}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+
+	access, err := svc.GetShareAccessStatus(context.Background(), uuid.New(), fileID)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(access) != 4 {
+		t.Fatalf("expected 4 recipients, got %d", len(access))
+	}
+	if a := access[0]; a.LastAccessedAt == nil || !a.LastAccessedAt.Equal(later) {
+		t.Fatalf("expected latest of download and preview, got %v", a.LastAccessedAt)
+	}
+	if a := access[1]; a.LastAccessedAt == nil || !a.LastAccessedAt.Equal(earlier) {
+		t.Fatalf("expected download time, got %v", a.LastAccessedAt)
+	}
+	for _, a := range access[2:] {
+		if a.LastAccessedAt != nil {
+			t.Fatalf("expected %s not to have accessed the file, got %v", a.SharedWithEmail, a.LastAccessedAt)
+		}
+	}
+}
+
+func TestShareService_GetShareAccessStatus_NotOwner(t *testing.T) {
+	svc := NewShareService(&stubShareRepo{notOwner: true}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	if _, err := svc.GetShareAccessStatus(context.Background(), uuid.New(), uuid.New()); err == nil {
+		t.Fatalf("expected non-owner to be rejected")
+	}
+}
+
+func TestShareService_UpdateSharePermission(t *testing.T) {
+	repo := &stubShareRepo{}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	ctx := context.Background()
+	owner, fileID, folderID := uuid.New(), uuid.New(), uuid.New()
+	if _, _, err := svc.ShareFile(ctx, owner, fileID, []string{"friend@example.com"}, "viewer", nil); err != nil {
+		t.Fatalf("share file: %v", err)
+	}
+	if _, _, err := svc.ShareFolder(ctx, owner, folderID, []string{"friend@example.com"}, "viewer", nil); err != nil {
+		t.Fatalf("share folder: %v", err)
+	}
+
+	share, err := svc.UpdateSharePermission(ctx, owner, fileID, " Friend@Example.com ", "editor")
+	if err != nil || share.Permission != "editor" || repo.permissions[fileID]["friend@example.com"] != "editor" {
+		t.Fatalf("expected upgrade to editor, got %+v (%v)", share, err)
+	}
+	if share, err = svc.UpdateSharePermission(ctx, owner, fileID, "friend@example.com", "viewer"); err != nil || share.Permission != "viewer" {
+		t.Fatalf("expected downgrade to viewer, got %+v (%v)", share, err)
+	}
+
+	folderShare, err := svc.UpdateFolderSharePermission(ctx, owner, folderID, "friend@example.com", "editor")
+	if err != nil || folderShare.Permission != "editor" {
+		t.Fatalf("expected folder upgrade to editor, got %+v (%v)", folderShare, err)
+	}
+
+	if _, err := svc.UpdateSharePermission(ctx, owner, fileID, "stranger@example.com", "editor"); err == nil {
+		t.Fatalf("expected error for recipient without a share")
+	}
+}
+
+func TestShareService_UpdateSharePermission_Invalid(t *testing.T) {
+	repo := &stubShareRepo{}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	ctx := context.Background()
+	owner, fileID := uuid.New(), uuid.New()
+	repo.setPermission(fileID, "friend@example.com", "viewer")
+
+	for _, perm := range []string{"", "owner", "admin"} {
+		if _, err := svc.UpdateSharePermission(ctx, owner, fileID, "friend@example.com", perm); err == nil {
+			t.Fatalf("expected permission %q to be rejected", perm)
+		}
+	}
+	if repo.permissions[fileID]["friend@example.com"] != "viewer" {
+		t.Fatalf("expected share to be unchanged, got %q", repo.permissions[fileID]["friend@example.com"])
+	}
+
+	repo.notOwner = true
+	if _, err := svc.UpdateSharePermission(ctx, owner, fileID, "friend@example.com", "editor"); err == nil {
+		t.Fatalf("expected non-owner to be rejected")
+	}
+}
+
+func TestShareService_GetSharedFolderSubfolders_Creator(t *testing.T) {
+	shared, child := uuid.New(), uuid.New()
+	repo := &stubShareRepo{subfolders: map[uuid.UUID][]models.Folder{
+		shared: {{ID: child, Name: "drafts", ParentID: &shared, CreatorEmail: "owner@example.com", CreatorName: "Owner"}},
+	}}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+
+	subfolders, err := svc.GetSharedFolderSubfolders(context.Background(), uuid.New(), shared)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(subfolders) != 1 || subfolders[0].CreatorEmail != "owner@example.com" || subfolders[0].CreatorName != "Owner" {
+		t.Fatalf("expected creator attribution on subfolders, got %+v", subfolders)
+	}
+}
+
+func TestShareService_PreviewFolderShare(t *testing.T) {
+	ctx := context.Background()
+	root, docs, drafts, photos := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	sized := func(sizes ...int64) []models.UserFile {
+		var files []models.UserFile
+		for _, size := range sizes {
+			files = append(files, models.UserFile{ID: uuid.New(), File: models.File{ID: uuid.New(), Size: size}})
+		}
+		return files
+	}
+	// root holds docs (which holds drafts) and photos
+	repo := &stubShareRepo{
+		subfolders: map[uuid.UUID][]models.Folder{
+			root: {{ID: docs, ParentID: &root}, {ID: photos, ParentID: &root}},
+			docs: {{ID: drafts, ParentID: &docs}},
+		},
+		files: map[uuid.UUID][]models.UserFile{
+			root:   sized(100, 200),
+			docs:   sized(300),
+			drafts: sized(400, 500),
+		},
+	}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{share: repo})
+
+	preview, err := svc.PreviewFolderShare(ctx, uuid.New(), root)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := FolderSharePreview{FolderID: root, FileCount: 5, SubfolderCount: 3, TotalBytes: 1500}
+	if *preview != want {
+		t.Fatalf("expected %+v, got %+v", want, *preview)
+	}
+
+	// A subfolder's preview covers only its own subtree
+	preview, err = svc.PreviewFolderShare(ctx, uuid.New(), docs)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if preview.FileCount != 3 || preview.SubfolderCount != 1 || preview.TotalBytes != 1200 {
+		t.Fatalf("expected 3 files, 1 subfolder and 1200 bytes, got %+v", *preview)
+	}
+
+	repo.notOwner = true
+	if _, err := svc.PreviewFolderShare(ctx, uuid.New(), root); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected a viewer to be denied the preview, got %v", err)
+	}
+}
+
+func TestShareService_ViewerCannotReshare(t *testing.T) {
+	repo := &stubShareRepo{notOwner: true}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	ctx := context.Background()
+	viewer := uuid.New()
+	emails := []string{"someone@example.com"}
+
+	_, _, err := svc.ShareFile(ctx, viewer, uuid.New(), emails, "viewer", nil)
+	if !errors.Is(err, ErrNotOwner) || !strings.Contains(err.Error(), "viewer access") {
+		t.Fatalf("expected viewer to be denied re-sharing a file with a clear error, got %v", err)
+	}
+	if _, _, err := svc.ShareFolder(ctx, viewer, uuid.New(), emails, "viewer", nil); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected viewer to be denied re-sharing a folder, got %v", err)
+	}
+	if _, err := svc.UpdateFolderSharePermission(ctx, viewer, uuid.New(), "friend@example.com", "editor"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected viewer to be denied changing folder permissions, got %v", err)
+	}
+	if len(repo.permissions) != 0 {
+		t.Fatalf("expected no shares to be created, got %v", repo.permissions)
+	}
+}
+
+func TestShareService_EditorCannotReshare(t *testing.T) {
+	ctx := context.Background()
+	owner, editor, folder := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubShareRepo{folderOwners: map[uuid.UUID]uuid.UUID{folder: owner}}
+	users := &stubUserRepo{emails: map[string]string{editor.String(): "editor@example.com"}}
+	svc := NewShareService(repo, users, &stubFileRepo{}, &stubFolderRepo{})
+
+	if _, _, err := svc.ShareFolder(ctx, owner, folder, []string{"editor@example.com"}, "editor", nil); err != nil {
+		t.Fatalf("expected the owner to share the folder as editor: %v", err)
+	}
+	if _, _, err := svc.ShareFolder(ctx, editor, folder, []string{"someone@example.com"}, "viewer", nil); !errors.Is(err, ErrNotOwner) || !strings.Contains(err.Error(), "editor access") {
+		t.Fatalf("expected an editor denied re-sharing the folder, got %v", err)
+	}
+	if _, err := svc.UpdateFolderSharePermission(ctx, editor, folder, "editor@example.com", "viewer"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected an editor denied changing folder permissions, got %v", err)
+	}
+	if _, _, err := svc.ShareFolder(ctx, owner, folder, []string{"someone@example.com"}, "owner", nil); err == nil {
+		t.Fatalf("expected the owner permission refused")
+	}
+}
+
+func TestShareService_GetAccessLevels(t *testing.T) {
+	ownedFile, sharedFile, hiddenFile := uuid.New(), uuid.New(), uuid.New()
+	ownedFolder, sharedFolder, hiddenFolder := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubShareRepo{levels: map[uuid.UUID]string{
+		ownedFile:    "owner",
+		sharedFile:   "viewer",
+		ownedFolder:  "owner",
+		sharedFolder: "editor",
+	}}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+
+	items := []models.AccessItem{
+		{Type: "file", ID: ownedFile},
+		{Type: "folder", ID: sharedFolder},
+		{Type: "file", ID: hiddenFile},
+		{Type: "file", ID: sharedFile},
+		{Type: "folder", ID: hiddenFolder},
+		{Type: "folder", ID: ownedFolder},
+	}
+	levels, err := svc.GetAccessLevels(context.Background(), uuid.New(), items)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := []string{"owner", "editor", "none", "viewer", "none", "owner"}
+	if len(levels) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(levels))
+	}
+	for i, l := range levels {
+		if l.ID != items[i].ID || l.Type != items[i].Type || l.Permission != want[i] {
+			t.Fatalf("item %d: expected %s %s, got %+v", i, items[i].Type, want[i], l)
+		}
+	}
+	if repo.levelQueries != 2 {
+		t.Fatalf("expected one lookup per item type, got %d", repo.levelQueries)
+	}
+}
+
+func TestShareService_GetAccessLevels_Invalid(t *testing.T) {
+	repo := &stubShareRepo{}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	ctx := context.Background()
+
+	if _, err := svc.GetAccessLevels(ctx, uuid.New(), []models.AccessItem{{Type: "link", ID: uuid.New()}}); err == nil {
+		t.Fatalf("expected unknown item type to be rejected")
+	}
+	levels, err := svc.GetAccessLevels(ctx, uuid.New(), nil)
+	if err != nil || len(levels) != 0 || repo.levelQueries != 0 {
+		t.Fatalf("expected no lookups for an empty request, got %v (%v, %d queries)", levels, err, repo.levelQueries)
+	}
+}
+
+func TestShareService_PublicFileIsReadOnly(t *testing.T) {
+	fileID := uuid.New()
+	repo := &stubShareRepo{noAccess: true, public: map[uuid.UUID]bool{fileID: true}}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+
+	_, _, err := svc.ShareFile(context.Background(), uuid.New(), fileID, []string{"friend@example.com"}, "viewer", nil)
+	if !errors.Is(err, ErrNotOwner) || !strings.Contains(err.Error(), "viewer access") {
+		t.Fatalf("expected public access to be read-only, got %v", err)
+	}
+}
+
+func TestShareService_SharedFolderFiles_OwnerSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	ownerID, recipientID, fileID, folderID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	inShared := files.addMappingInFolder(ownerID, fileID, &folderID)
+	// A newer copy of the same content at the root: deleteFile by file id would trash this one
+	files.addMapping(ownerID, fileID)
+	svc := NewShareService(&stubShareRepo{notOwner: true, mapped: files}, &stubUserRepo{}, files, &stubFolderRepo{})
+	fs := NewFileService(files, nil, "", "")
+
+	if listed, err := svc.GetSharedFolderFiles(ctx, recipientID, folderID); err != nil || len(listed) != 1 {
+		t.Fatalf("expected the recipient to see the shared file, got %d (%v)", len(listed), err)
+	}
+	if err := fs.SoftDeleteUserFileByMappingID(ctx, ownerID, inShared.String()); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if listed, err := svc.GetSharedFolderFiles(ctx, recipientID, folderID); err != nil || len(listed) != 0 {
+		t.Fatalf("expected the trashed file to disappear for the recipient, got %d (%v)", len(listed), err)
+	}
+	if active, _, _ := files.CountFileMappings(ctx, fileID); active != 1 {
+		t.Fatalf("expected the owner's root copy to stay active, got %d active", active)
+	}
+}
+
+func TestShareService_BulkShareFiles_MixedOwnership(t *testing.T) {
+	ownerID := uuid.New()
+	mine, viewed, unknown := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubShareRepo{levels: map[uuid.UUID]string{mine: "owner", viewed: "viewer"}}
+	users := &stubUserRepo{emails: map[string]string{ownerID.String(): "me@example.com"}}
+	svc := NewShareService(repo, users, &stubFileRepo{}, &stubFolderRepo{})
+
+	results, err := svc.BulkShareFiles(context.Background(), ownerID, []uuid.UUID{mine, viewed, unknown}, []string{"a@example.com", "me@example.com"}, "viewer", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected a result per file and email, got %d", len(results))
+	}
+	if r := results[0]; r.FileID != mine || r.Email != "a@example.com" || r.Share == nil || r.Error != "" {
+		t.Fatalf("expected the owned file to be shared, got %+v", r)
+	}
+	if r := results[1]; r.Share != nil || !strings.Contains(r.Error, "yourself") {
+		t.Fatalf("expected sharing with yourself to be refused, got %+v", r)
+	}
+	if r := results[2]; r.FileID != viewed || r.Share != nil || !strings.Contains(r.Error, "viewer access") {
+		t.Fatalf("expected a file the user only views to be refused, got %+v", r)
+	}
+	if r := results[4]; r.FileID != unknown || r.Share != nil || !strings.Contains(r.Error, "not found") {
+		t.Fatalf("expected an unknown file to be refused, got %+v", r)
+	}
+	if repo.levelQueries != 1 || repo.bulkShareCalls != 1 {
+		t.Fatalf("expected one ownership lookup and one insert, got %d and %d", repo.levelQueries, repo.bulkShareCalls)
+	}
+	if len(repo.permissions) != 1 || repo.permissions[mine]["a@example.com"] != "viewer" {
+		t.Fatalf("expected only the owned file to be shared, got %v", repo.permissions)
+	}
+}
+
+func TestShareService_BulkShareFiles_Dedup(t *testing.T) {
+	fileID := uuid.New()
+	repo := &stubShareRepo{levels: map[uuid.UUID]string{fileID: "owner"}}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+
+	results, err := svc.BulkShareFiles(context.Background(), uuid.New(), []uuid.UUID{fileID, fileID}, []string{"Team@Example.com", " team@example.com ", "", "other@example.com"}, "viewer", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(results) != 2 || results[0].Email != "team@example.com" || results[1].Email != "other@example.com" {
+		t.Fatalf("expected one result per distinct email, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Share == nil || r.Error != "" {
+			t.Fatalf("expected every share to be created, got %+v", r)
+		}
+	}
+}
+
+func TestShareService_BulkShareFiles_Invalid(t *testing.T) {
+	repo := &stubShareRepo{}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	ctx := context.Background()
+	files, emails := []uuid.UUID{uuid.New()}, []string{"a@example.com"}
+
+	if _, err := svc.BulkShareFiles(ctx, uuid.New(), files, emails, "owner", nil); err == nil {
+		t.Fatalf("expected a permission other than viewer or editor to be rejected")
+	}
+	past := time.Now().Add(-time.Hour)
+	if _, err := svc.BulkShareFiles(ctx, uuid.New(), files, emails, "viewer", &past); err == nil {
+		t.Fatalf("expected past expiry to be rejected")
+	}
+	if _, err := svc.BulkShareFiles(ctx, uuid.New(), nil, emails, "viewer", nil); err == nil {
+		t.Fatalf("expected no files to be rejected")
+	}
+	if _, err := svc.BulkShareFiles(ctx, uuid.New(), files, []string{" "}, "viewer", nil); err == nil {
+		t.Fatalf("expected no emails to be rejected")
+	}
+	if repo.levelQueries != 0 || repo.bulkShareCalls != 0 {
+		t.Fatalf("expected invalid requests to reach no repository")
+	}
+}
+
+// fakeNotifier records the notifications sent through it and fails those to the emails in fail
+type fakeNotifier struct {
+	mu    sync.Mutex
+	sent  []ShareNotification
+	fail  map[string]bool
+	calls int
+}
+
+func (n *fakeNotifier) NotifyShare(ctx context.Context, recipientEmail string, share ShareInfo) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.fail[recipientEmail] {
+		return errors.New("mailbox unavailable")
+	}
+	n.sent = append(n.sent, ShareNotification{RecipientEmail: recipientEmail, Share: share})
+	return nil
+}
+
+// fakeBatchNotifier is a fakeNotifier that also counts the batches sent through it
+type fakeBatchNotifier struct {
+	fakeNotifier
+	batches int
+}
+
+func (n *fakeBatchNotifier) NotifyShares(ctx context.Context, notifications []ShareNotification) []error {
+	n.batches++
+	errs := make([]error, len(notifications))
+	for i, note := range notifications {
+		errs[i] = n.NotifyShare(ctx, note.RecipientEmail, note.Share)
+	}
+	return errs
+}
+
+func TestShareService_ShareFile_Notifies(t *testing.T) {
+	ctx := context.Background()
+	ownerID, fileID := uuid.New(), uuid.New()
+	// The recipient is told the name the owner gave their copy, not the upload's
+	files := &stubFileRepo{names: map[uuid.UUID]string{fileID: "scan-0042.pdf"}}
+	renamed := "report.pdf"
+	files.SetUserFileDisplayName(ctx, ownerID, files.addMapping(ownerID, fileID), &renamed)
+	users := &stubUserRepo{emails: map[string]string{ownerID.String(): "me@example.com"}}
+	repo := &stubShareRepo{}
+	notifier := &fakeNotifier{fail: map[string]bool{"gone@example.com": true}}
+	svc := NewShareService(repo, users, files, &stubFolderRepo{})
+	svc.Notifier = notifier
+
+	shares, failures, err := svc.ShareFile(ctx, ownerID, fileID, []string{"a@example.com", "Gone@Example.com", "b@example.com"}, "editor", nil)
+	if err != nil || len(shares) != 3 {
+		t.Fatalf("expected every share created, got %d (%v)", len(shares), err)
+	}
+	if len(failures) != 1 || failures[0].Email != "gone@example.com" || failures[0].ItemID != fileID {
+		t.Fatalf("expected the undeliverable recipient reported, got %+v", failures)
+	}
+	if repo.permissions[fileID]["gone@example.com"] != "editor" {
+		t.Fatalf("expected the share kept when notifying its recipient failed")
+	}
+	if notifier.calls != 3 || len(notifier.sent) != 2 {
+		t.Fatalf("expected one notification per recipient, got %d calls", notifier.calls)
+	}
+	want := ShareInfo{Kind: "file", ItemID: fileID, ItemName: "report.pdf", OwnerEmail: "me@example.com", Permission: "editor"}
+	for _, note := range notifier.sent {
+		if note.Share != want {
+			t.Fatalf("expected %+v, got %+v", want, note.Share)
+		}
+	}
+
+	// Refused shares aren't notified
+	notifier.calls = 0
+	if _, _, err := svc.ShareFile(ctx, ownerID, fileID, []string{"me@example.com"}, "viewer", nil); err == nil || notifier.calls != 0 {
+		t.Fatalf("expected sharing with yourself refused without a notification, got %d calls (%v)", notifier.calls, err)
+	}
+}
+
+// slowNotifier blocks every send until release is closed, then records it in sent
+type slowNotifier struct {
+	release chan struct{}
+	sent    chan string
+}
+
+func (n *slowNotifier) NotifyShare(ctx context.Context, recipientEmail string, share ShareInfo) error {
+	<-n.release
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.sent <- recipientEmail
+	return nil
+}
+
+func TestShareService_ShareFile_SlowNotifier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	notifier := &slowNotifier{release: make(chan struct{}), sent: make(chan string, 1)}
+	svc := NewShareService(&stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.Notifier = notifier
+	svc.NotifyWait = 20 * time.Millisecond
+
+	// The share doesn't wait out a mail server that is slower than NotifyWait
+	shares, failures, err := svc.ShareFile(ctx, uuid.New(), uuid.New(), []string{"a@example.com"}, "viewer", nil)
+	if err != nil || len(shares) != 1 || len(failures) != 0 {
+		t.Fatalf("expected the share returned without waiting, got %d shares, %+v (%v)", len(shares), failures, err)
+	}
+
+	// and the notification still goes out after the request is over
+	cancel()
+	close(notifier.release)
+	select {
+	case email := <-notifier.sent:
+		if email != "a@example.com" {
+			t.Fatalf("unexpected recipient %s", email)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the notification sent in the background")
+	}
+}
+
+func TestShareService_ShareFolder_NotifiesInOneBatch(t *testing.T) {
+	notifier := &fakeBatchNotifier{}
+	svc := NewShareService(&stubShareRepo{}, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	svc.Notifier = notifier
+	var emails []string
+	for i := 0; i < 20; i++ {
+		emails = append(emails, fmt.Sprintf("user%d@example.com", i))
+	}
+
+	shares, failures, err := svc.ShareFolder(context.Background(), uuid.New(), uuid.New(), emails, "viewer", nil)
+	if err != nil || len(shares) != 20 || len(failures) != 0 {
+		t.Fatalf("expected every share created and notified, got %d shares, %+v (%v)", len(shares), failures, err)
+	}
+	if notifier.batches != 1 || len(notifier.sent) != 20 || notifier.sent[0].Share.Kind != "folder" {
+		t.Fatalf("expected 20 folder notifications in one batch, got %d in %d batches", len(notifier.sent), notifier.batches)
+	}
+}
+
+func TestShareService_BulkShareFiles_Notifies(t *testing.T) {
+	ownerID, first, second := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{names: map[uuid.UUID]string{first: "a.txt", second: "b.txt"}}
+	files.addMapping(ownerID, first)
+	files.addMapping(ownerID, second)
+	repo := &stubShareRepo{levels: map[uuid.UUID]string{first: "owner", second: "owner"}}
+	notifier := &fakeBatchNotifier{fakeNotifier: fakeNotifier{fail: map[string]bool{"gone@example.com": true}}}
+	svc := NewShareService(repo, &stubUserRepo{}, files, &stubFolderRepo{})
+	svc.Notifier = notifier
+
+	results, err := svc.BulkShareFiles(context.Background(), ownerID, []uuid.UUID{first, second}, []string{"a@example.com", "gone@example.com"}, "viewer", nil)
+	if err != nil || len(results) != 4 {
+		t.Fatalf("unexpected results %+v (%v)", results, err)
+	}
+	for _, r := range results {
+		if r.Share == nil || r.Error != "" || (r.NotifyError != "") != (r.Email == "gone@example.com") {
+			t.Fatalf("expected every share created and only gone@example.com's notifications failed, got %+v", r)
+		}
+	}
+	if notifier.batches != 1 || len(notifier.sent) != 2 || notifier.sent[1].Share.ItemName != "b.txt" {
+		t.Fatalf("expected the notifications sent in one batch, got %d batches: %+v", notifier.batches, notifier.sent)
+	}
+}
+
+func TestShareService_TransferFileOwnership(t *testing.T) {
+	ctx := context.Background()
+	owner, newOwner, fileID := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	files.addMapping(owner, fileID)
+	users := &stubUserRepo{usersByEmail: map[string]*models.User{"new@example.com": {ID: newOwner, Email: "new@example.com"}}}
+	svc := NewShareService(&stubShareRepo{}, users, files, &stubFolderRepo{})
+	svc.Files = NewFileService(files, nil, "", "")
+
+	if err := svc.TransferFileOwnership(ctx, owner, fileID, " New@Example.com "); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if m := files.mapping(newOwner, fileID, false); m == nil || m.role != "" {
+		t.Fatalf("expected the new owner to get an owner copy, got %+v", m)
+	}
+	if m := files.mapping(owner, fileID, false); m == nil || m.role != "editor" {
+		t.Fatalf("expected the previous owner kept as editor, got %+v", m)
+	}
+
+	// Handing it back promotes the copy the previous owner kept instead of adding one
+	users.usersByEmail["old@example.com"] = &models.User{ID: owner, Email: "old@example.com"}
+	svc.TransferRemovesPreviousOwner = true
+	if err := svc.TransferFileOwnership(ctx, newOwner, fileID, "old@example.com"); err != nil {
+		t.Fatalf("transfer back: %v", err)
+	}
+	if len(files.mappings) != 1 || files.mappings[0].userID != owner || files.mappings[0].role != "" {
+		t.Fatalf("expected only the original owner's copy left, promoted, got %d mappings", len(files.mappings))
+	}
+
+	for _, email := range []string{"nobody@example.com", "old@example.com"} {
+		if err := svc.TransferFileOwnership(ctx, owner, fileID, email); !errors.Is(err, ErrTransferTarget) {
+			t.Fatalf("expected a transfer to %s refused, got %v", email, err)
+		}
+	}
+}
+
+func TestShareService_TransferFileOwnership_NotOwner(t *testing.T) {
+	ctx := context.Background()
+	owner, viewer, fileID := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	files.addMapping(owner, fileID)
+	users := &stubUserRepo{usersByEmail: map[string]*models.User{"viewer@example.com": {ID: viewer, Email: "viewer@example.com"}}}
+	svc := NewShareService(&stubShareRepo{notOwner: true}, users, files, &stubFolderRepo{})
+
+	if err := svc.TransferFileOwnership(ctx, viewer, fileID, "viewer@example.com"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected a non-owner refused, got %v", err)
+	}
+	if m := files.mapping(owner, fileID, false); m == nil || m.role != "" || len(files.mappings) != 1 {
+		t.Fatalf("expected ownership unchanged")
+	}
+}
+
+func TestShareService_TransferFileOwnership_Quota(t *testing.T) {
+	ctx := context.Background()
+	owner, newOwner, fileID := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{
+		filesByHash: map[string]*models.File{"h": {ID: fileID, Hash: "h", Size: 1000}},
+		quotas:      map[uuid.UUID]int64{newOwner: 1500},
+		usageByUser: map[uuid.UUID]int64{newOwner: 600},
+	}
+	files.addMapping(owner, fileID)
+	users := &stubUserRepo{usersByEmail: map[string]*models.User{"new@example.com": {ID: newOwner, Email: "new@example.com"}}}
+	svc := NewShareService(&stubShareRepo{}, users, files, &stubFolderRepo{})
+	svc.Files = NewFileService(files, nil, "", "")
+
+	if err := svc.TransferFileOwnership(ctx, owner, fileID, "new@example.com"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected a file over the new owner's quota refused, got %v", err)
+	}
+	// Content the new owner already holds doesn't need room
+	files.addMapping(newOwner, fileID)
+	if err := svc.TransferFileOwnership(ctx, owner, fileID, "new@example.com"); err != nil {
+		t.Fatalf("expected the transfer to go through, got %v", err)
+	}
+}
+
+func TestShareService_TransferFileOwnership_Retained(t *testing.T) {
+	ctx := context.Background()
+	owner, newOwner, fileID := uuid.New(), uuid.New(), uuid.New()
+	files := &stubFileRepo{}
+	held := files.addMapping(owner, fileID)
+	until := time.Now().Add(time.Hour)
+	if err := files.SetUserFileRetention(ctx, held, &until); err != nil {
+		t.Fatalf("retain: %v", err)
+	}
+	users := &stubUserRepo{usersByEmail: map[string]*models.User{"new@example.com": {ID: newOwner, Email: "new@example.com"}}}
+	svc := NewShareService(&stubShareRepo{}, users, files, &stubFolderRepo{})
+	svc.TransferRemovesPreviousOwner = true
+
+	// Handing the file over would delete the retained copy
+	if err := svc.TransferFileOwnership(ctx, owner, fileID, "new@example.com"); !errors.Is(err, repository.ErrRetained) {
+		t.Fatalf("expected the retained copy to block the transfer, got %v", err)
+	}
+	if len(files.mappings) != 1 || files.mappings[0].role != "" {
+		t.Fatalf("expected ownership unchanged")
+	}
+	// Kept as an editor copy, it isn't deleted
+	svc.TransferRemovesPreviousOwner = false
+	if err := svc.TransferFileOwnership(ctx, owner, fileID, "new@example.com"); err != nil {
+		t.Fatalf("expected the transfer to go through, got %v", err)
+	}
+}
+
+func TestShareService_UnshareAll(t *testing.T) {
+	ctx := context.Background()
+	owner, fileID, otherFile, folderID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	repo := &stubShareRepo{}
+	svc := NewShareService(repo, &stubUserRepo{}, &stubFileRepo{}, &stubFolderRepo{})
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		repo.setPermission(fileID, email, "viewer")
+		repo.setPermission(folderID, email, "editor")
+	}
+	repo.setPermission(otherFile, "a@example.com", "viewer")
+
+	if n, err := svc.UnshareFileAll(ctx, owner, fileID); err != nil || n != 3 {
+		t.Fatalf("expected 3 file shares revoked, got %d (%v)", n, err)
+	}
+	if len(repo.permissions[fileID]) != 0 || repo.permissions[otherFile]["a@example.com"] != "viewer" || len(repo.permissions[folderID]) != 3 {
+		t.Fatalf("expected only the file's shares revoked, got %v", repo.permissions)
+	}
+	if n, err := svc.UnshareFolderAll(ctx, owner, folderID); err != nil || n != 3 {
+		t.Fatalf("expected 3 folder shares revoked, got %d (%v)", n, err)
+	}
+	if n, err := svc.UnshareFileAll(ctx, owner, fileID); err != nil || n != 0 {
+		t.Fatalf("expected nothing left to revoke, got %d (%v)", n, err)
+	}
+
+	repo.notOwner = true
+	if _, err := svc.UnshareFileAll(ctx, uuid.New(), otherFile); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected a non-owner refused, got %v", err)
+	}
+	if _, err := svc.UnshareFolderAll(ctx, uuid.New(), folderID); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected a non-owner refused for folders, got %v", err)
+	}
+	if repo.permissions[otherFile]["a@example.com"] != "viewer" {
+		t.Fatalf("expected the refused call to leave shares alone")
+	}
+}
+
+func TestShareService_GetSharesCreatedByMe(t *testing.T) {
+	ctx := context.Background()
+	me, other := uuid.New(), uuid.New()
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	repo := &stubShareRepo{
+		fileShares: []models.FileShare{
+			{ID: uuid.New(), OwnerID: me, SharedWithEmail: "a@example.com"},
+			{ID: uuid.New(), OwnerID: me, SharedWithEmail: "b@example.com", ExpiresAt: &past},
+			{ID: uuid.New(), OwnerID: other, SharedWithEmail: "c@example.com"},
+		},
+		folderShares: []models.FolderShare{
+			{ID: uuid.New(), OwnerID: me, SharedWithEmail: "a@example.com", ExpiresAt: &future},
+			{ID: uuid.New(), OwnerID: other, SharedWithEmail: "d@example.com", ExpiresAt: &past},
+		},
+	}
+	users := &stubUserRepo{emails: map[string]string{me.String(): "me@example.com"}}
+	svc := NewShareService(repo, users, &stubFileRepo{}, &stubFolderRepo{})
+
+	got, err := svc.GetSharesCreatedByMe(ctx, me)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.FileShares) != 1 || got.FileShares[0].SharedWithEmail != "a@example.com" {
+		t.Fatalf("expected the one active file share, got %+v", got.FileShares)
+	}
+	if len(got.ExpiredFileShares) != 1 || got.ExpiredFileShares[0].SharedWithEmail != "b@example.com" {
+		t.Fatalf("expected the expired file share listed apart, got %+v", got.ExpiredFileShares)
+	}
+	if len(got.FolderShares) != 1 || len(got.ExpiredFolderShares) != 0 {
+		t.Fatalf("expected only my unexpired folder share, got %+v / %+v", got.FolderShares, got.ExpiredFolderShares)
+	}
+	if got.FileShares[0].Owner.Email != "me@example.com" {
+		t.Fatalf("expected the shares to carry me as owner, got %+v", got.FileShares[0].Owner)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// defaultSMTPTimeout bounds one batch of emails when SMTPNotifier.Timeout is unset
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPNotifier emails share recipients through an SMTP server. A batch of notifications is
+// sent over one connection, upgraded with STARTTLS when the server offers it.
+type SMTPNotifier struct {
+	// Addr is the server's host:port, e.g. "smtp.example.com:587"
+	Addr string
+	// Username and Password authenticate with PLAIN auth (optional)
+	Username string
+	Password string
+	// From is the sender address of the emails
+	From string
+	// AppURL is linked from the emails so recipients can find the share (optional)
+	AppURL string
+	// Timeout bounds sending one batch (zero uses 30 seconds)
+	Timeout time.Duration
+}
+
+// NotifyShare emails recipientEmail about share.
+func (n *SMTPNotifier) NotifyShare(ctx context.Context, recipientEmail string, share ShareInfo) error {
+	return n.NotifyShares(ctx, []ShareNotification{{RecipientEmail: recipientEmail, Share: share}})[0]
+}
+
+// NotifyShares emails every notification over a single connection. A message the server
+// refuses doesn't stop the others; losing the connection fails the rest.
+func (n *SMTPNotifier) NotifyShares(ctx context.Context, notifications []ShareNotification) []error {
+	errs := make([]error, len(notifications))
+	if len(notifications) == 0 {
+		return errs
+	}
+	c, stop, err := n.connect(ctx)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	defer stop()
+	defer c.Close()
+
+	for i, note := range notifications {
+		if errs[i] = n.send(c, note); errs[i] == nil {
+			continue
+		}
+		if ctx.Err() != nil || c.Reset() != nil {
+			for j := i + 1; j < len(errs); j++ {
+				errs[j] = fmt.Errorf("smtp: connection lost: %w", errs[i])
+			}
+			return errs
+		}
+	}
+	c.Quit()
+	return errs
+}
+
+// connect dials the server, upgrades to TLS when offered and authenticates. The returned
+// stop func must be called once the client is no longer used.
+func (n *SMTPNotifier) connect(ctx context.Context) (*smtp.Client, func() bool, error) {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("smtp: invalid address %q: %w", n.Addr, err)
+	}
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("smtp: %w", err)
+	}
+	// Unblock reads and writes in flight when the batch runs out of time
+	stopDeadline := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	stop := func() bool {
+		cancel()
+		return stopDeadline()
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err == nil {
+		err = n.handshake(c, host)
+	}
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, nil, fmt.Errorf("smtp: %w", err)
+	}
+	return c, stop, nil
+}
+
+func (n *SMTPNotifier) handshake(c *smtp.Client, host string) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		return c.Auth(smtp.PlainAuth("", n.Username, n.Password, host))
+	}
+	return nil
+}
+
+func (n *SMTPNotifier) send(c *smtp.Client, note ShareNotification) error {
+	if strings.ContainsAny(note.RecipientEmail, "\r\n") {
+		return errors.New("smtp: invalid recipient address")
+	}
+	if err := c.Mail(n.From); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := c.Rcpt(note.RecipientEmail); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err := w.Write(n.message(note)); err != nil {
+		w.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// message renders the email for note. The item name and owner come from users, so the
+// subject is MIME-encoded to keep them from adding headers.
+func (n *SMTPNotifier) message(note ShareNotification) []byte {
+	share := note.Share
+	name := share.ItemName
+	if name == "" {
+		name = "a " + share.Kind
+	}
+	subject := fmt.Sprintf("%s shared %q with you", share.OwnerEmail, name)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s shared the %s %q with you as %s.\r\n", share.OwnerEmail, share.Kind, name, share.Permission)
+	if share.ExpiresAt != nil {
+		fmt.Fprintf(&body, "You have access until %s.\r\n", share.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+	}
+	if n.AppURL != "" {
+		fmt.Fprintf(&body, "\r\nOpen it from \"Shared with me\" at %s\r\n", n.AppURL)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", note.RecipientEmail)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body.String())
+	return []byte(msg.String())
+}
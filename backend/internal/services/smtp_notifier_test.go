@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeSMTP is a minimal SMTP server recording the messages it receives and the connections
+// they came over. It refuses recipients at refuse.example.com.
+type fakeSMTP struct {
+	mu          sync.Mutex
+	connections int
+	messages    []string
+}
+
+func (f *fakeSMTP) start(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback listener: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.connections++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO" || cmd == "HELO":
+			tp.PrintfLine("250 fake")
+		case cmd == "RCPT" && strings.Contains(line, "refuse.example.com"):
+			tp.PrintfLine("550 no such user")
+		case cmd == "MAIL" || cmd == "RCPT" || cmd == "RSET" || cmd == "NOOP":
+			tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			tp.PrintfLine("354 go ahead")
+			body, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, strings.Join(body, "\n"))
+			f.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestSMTPNotifier_NotifySharesOverOneConnection(t *testing.T) {
+	server := &fakeSMTP{}
+	n := &SMTPNotifier{Addr: server.start(t), From: "safevault@example.com", AppURL: "https://vault.example.com"}
+	share := ShareInfo{Kind: "file", ItemID: uuid.New(), ItemName: "plan\r\nBcc: evil@example.com", OwnerEmail: "owner@example.com", Permission: "viewer"}
+	var notes []ShareNotification
+	for _, email := range []string{"a@example.com", "b@refuse.example.com", "c@example.com"} {
+		notes = append(notes, ShareNotification{RecipientEmail: email, Share: share})
+	}
+
+	errs := n.NotifyShares(context.Background(), notes)
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("expected only the refused recipient to fail, got %v", errs)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.connections != 1 || len(server.messages) != 2 {
+		t.Fatalf("expected two messages over one connection, got %d over %d", len(server.messages), server.connections)
+	}
+	msg := server.messages[0]
+	if !strings.Contains(msg, "To: a@example.com") || !strings.Contains(msg, "https://vault.example.com") {
+		t.Fatalf("unexpected message:\n%s", msg)
+	}
+	headers, _, _ := strings.Cut(msg, "\n\n")
+	if strings.Contains(headers, "\nBcc:") {
+		t.Fatalf("expected the item name kept out of the headers:\n%s", headers)
+	}
+}
+
+func TestSMTPNotifier_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback listener: %v", err)
+	}
+	// A server that accepts connections but never greets
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go bufio.NewReader(conn).ReadString('\n')
+		}
+	}()
+	n := &SMTPNotifier{Addr: ln.Addr().String(), From: "safevault@example.com", Timeout: 50 * time.Millisecond}
+	errs := n.NotifyShares(context.Background(), []ShareNotification{{RecipientEmail: "a@example.com"}, {RecipientEmail: "b@example.com"}})
+	if errs[0] == nil || errs[1] == nil {
+		t.Fatalf("expected every notification failed when the server doesn't answer, got %v", errs)
+	}
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pinger is satisfied by *pgxpool.Pool.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// BucketChecker is satisfied by *minio.Client.
+type BucketChecker interface {
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+}
+
+// DependencyStatus is the outcome of probing one external dependency.
+type DependencyStatus struct {
+	Name    string        `json:"name"`
+	Up      bool          `json:"up"`
+	Latency time.Duration `json:"latency_ns"`
+	// Error is empty when the dependency is up
+	Error string `json:"error,omitempty"`
+	// Optional dependencies, like the read replica, leave the instance healthy when down
+	Optional bool `json:"optional,omitempty"`
+}
+
+// JobStatus reports the most recent run of a background job.
+type JobStatus struct {
+	Name      string    `json:"name"`
+	LastRunAt time.Time `json:"last_run_at"`
+	// LastError is empty when the last run succeeded
+	LastError string `json:"last_error,omitempty"`
+}
+
+// SystemStatus aggregates dependency health, migration state, and job runs.
+type SystemStatus struct {
+	// Healthy is true when every required dependency is up
+	Healthy bool `json:"healthy"`
+	// Degraded is true when an optional dependency is down
+	Degraded     bool               `json:"degraded"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+	// PendingMigrations are migration files on disk that weren't applied at startup. They
+	// are reported for operators only and don't affect Healthy: the running instance
+	// works against the schema it migrated, and a restart applies them.
+	PendingMigrations []string    `json:"pending_migrations"`
+	Jobs              []JobStatus `json:"jobs"`
+}
+
+// StatusService probes the backend's dependencies for readiness checks and the admin status view.
+type StatusService struct {
+	DB Pinger
+	// Replica is the optional read replica; it is only probed when set, and being down
+	// degrades the status without making it unhealthy
+	Replica Pinger
+	Minio   BucketChecker
+	Bucket  string
+	// MigrationsDir is scanned for .sql files; any not in AppliedMigrations is reported as
+	// pending. Left empty, migrations aren't checked
+	MigrationsDir     string
+	AppliedMigrations []string
+
+	mu   sync.Mutex
+	jobs map[string]JobStatus
+}
+
+func NewStatusService(db Pinger, minioClient BucketChecker, bucket string) *StatusService {
+	return &StatusService{
+		DB:     db,
+		Minio:  minioClient,
+		Bucket: bucket,
+		jobs:   make(map[string]JobStatus),
+	}
+}
+
+// RecordJobRun is called by background jobs when a run finishes, with the run's error if any.
+func (s *StatusService) RecordJobRun(name string, at time.Time, err error) {
+	if s == nil {
+		return
+	}
+	js := JobStatus{Name: name, LastRunAt: at}
+	if err != nil {
+		js.LastError = err.Error()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobs == nil {
+		s.jobs = make(map[string]JobStatus)
+	}
+	s.jobs[name] = js
+}
+
+// Check probes every dependency and returns the combined status.
+func (s *StatusService) Check(ctx context.Context) *SystemStatus {
+	status := &SystemStatus{CheckedAt: time.Now()}
+
+	status.Dependencies = append(status.Dependencies, probe(ctx, "postgres", func(ctx context.Context) error {
+		if s.DB == nil {
+			return errNotConfigured
+		}
+		return s.DB.Ping(ctx)
+	}))
+	if s.Replica != nil {
+		replica := probe(ctx, "postgres_replica", s.Replica.Ping)
+		replica.Optional = true
+		status.Dependencies = append(status.Dependencies, replica)
+	}
+	status.Dependencies = append(status.Dependencies, probe(ctx, "minio", func(ctx context.Context) error {
+		if s.Minio == nil || s.Bucket == "" {
+			return errNotConfigured
+		}
+		exists, err := s.Minio.BucketExists(ctx, s.Bucket)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errBucketMissing
+		}
+		return nil
+	}))
+
+	pending, err := s.pendingMigrations()
+	status.PendingMigrations = pending
+	if err != nil {
+		// Not being able to tell is worth a warning, not taking the instance out of rotation
+		status.Dependencies = append(status.Dependencies, DependencyStatus{Name: "migrations", Error: "unable to read migrations: " + err.Error(), Optional: true})
+	}
+
+	s.mu.Lock()
+	for _, js := range s.jobs {
+		status.Jobs = append(status.Jobs, js)
+	}
+	s.mu.Unlock()
+	sort.Slice(status.Jobs, func(i, j int) bool { return status.Jobs[i].Name < status.Jobs[j].Name })
+
+	status.Healthy = true
+	for _, d := range status.Dependencies {
+		switch {
+		case d.Up:
+		case d.Optional:
+			status.Degraded = true
+		default:
+			status.Healthy = false
+		}
+	}
+	return status
+}
+
+// probeTimeout bounds each dependency check so one hung service can't stall the report
+const probeTimeout = 3 * time.Second
+
+var (
+	errNotConfigured = errors.New("not configured")
+	errBucketMissing = errors.New("bucket does not exist")
+)
+
+func probe(ctx context.Context, name string, check func(ctx context.Context) error) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check(ctx)
+	ds := DependencyStatus{Name: name, Up: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		ds.Error = err.Error()
+	}
+	return ds
+}
+
+// pendingMigrations lists .sql files in MigrationsDir that were not applied at startup.
+func (s *StatusService) pendingMigrations() ([]string, error) {
+	if s.MigrationsDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool, len(s.AppliedMigrations))
+	for _, name := range s.AppliedMigrations {
+		applied[filepath.Base(name)] = true
+	}
+	var pending []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".sql") {
+			continue
+		}
+		if !applied[e.Name()] {
+			pending = append(pending, e.Name())
+		}
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type stubPinger struct{ err error }
+
+func (p stubPinger) Ping(ctx context.Context) error { return p.err }
+
+type stubBucketChecker struct {
+	exists bool
+	err    error
+}
+
+func (b stubBucketChecker) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return b.exists, b.err
+}
+
+func findDependency(t *testing.T, st *SystemStatus, name string) DependencyStatus {
+	t.Helper()
+	for _, d := range st.Dependencies {
+		if d.Name == name {
+			return d
+		}
+	}
+	t.Fatalf("dependency %s missing from status", name)
+	return DependencyStatus{}
+}
+
+func TestStatusService_Check_AllUp(t *testing.T) {
+	svc := NewStatusService(stubPinger{}, stubBucketChecker{exists: true}, "bucket")
+	svc.RecordJobRun("cleanup", time.Now(), nil)
+	st := svc.Check(context.Background())
+	if !st.Healthy {
+		t.Fatalf("expected healthy status, got %+v", st)
+	}
+	if len(st.Jobs) != 1 || st.Jobs[0].Name != "cleanup" || st.Jobs[0].LastError != "" {
+		t.Fatalf("unexpected jobs: %+v", st.Jobs)
+	}
+}
+
+func TestStatusService_Check_DependenciesDown(t *testing.T) {
+	svc := NewStatusService(stubPinger{err: errors.New("connection refused")}, stubBucketChecker{exists: false}, "bucket")
+	st := svc.Check(context.Background())
+	if st.Healthy {
+		t.Fatalf("expected unhealthy status")
+	}
+	if pg := findDependency(t, st, "postgres"); pg.Up || pg.Error != "connection refused" {
+		t.Fatalf("unexpected postgres status: %+v", pg)
+	}
+	if m := findDependency(t, st, "minio"); m.Up || m.Error != errBucketMissing.Error() {
+		t.Fatalf("unexpected minio status: %+v", m)
+	}
+}
+
+func TestStatusService_Check_PendingMigrations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"001_init.sql", "002_next.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatalf("write migration: %v", err)
+		}
+	}
+	svc := NewStatusService(stubPinger{}, stubBucketChecker{exists: true}, "bucket")
+	svc.MigrationsDir = dir
+	svc.AppliedMigrations = []string{filepath.Join(dir, "001_init.sql")}
+	st := svc.Check(context.Background())
+	if len(st.PendingMigrations) != 1 || st.PendingMigrations[0] != "002_next.sql" {
+		t.Fatalf("unexpected pending migrations: %v", st.PendingMigrations)
+	}
+	// Reported, but the instance keeps serving on the schema it migrated
+	if !st.Healthy || st.Degraded {
+		t.Fatalf("expected pending migrations not to affect health, got %+v", st)
+	}
+
+	svc.MigrationsDir = filepath.Join(dir, "missing")
+	if st := svc.Check(context.Background()); !st.Healthy || !st.Degraded || findDependency(t, st, "migrations").Error == "" {
+		t.Fatalf("expected an unreadable migrations dir to degrade the status, got %+v", st)
+	}
+}
+
+func TestStatusService_Check_ReplicaDown(t *testing.T) {
+	svc := NewStatusService(stubPinger{}, stubBucketChecker{exists: true}, "bucket")
+	svc.Replica = stubPinger{err: errors.New("replica unreachable")}
+	st := svc.Check(context.Background())
+	// The primary still serves every query, so the instance stays ready
+	if !st.Healthy || !st.Degraded {
+		t.Fatalf("expected a healthy but degraded status, got %+v", st)
+	}
+	if r := findDependency(t, st, "postgres_replica"); r.Up || !r.Optional {
+		t.Fatalf("expected an optional replica reported down, got %+v", r)
+	}
+
+	svc.Replica = stubPinger{}
+	if st := svc.Check(context.Background()); !st.Healthy || st.Degraded {
+		t.Fatalf("expected a healthy status once the replica is back, got %+v", st)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+// StorageLayout decides the object key a new file is stored under.
+// The key is persisted in files.storage_path, so changing the layout only affects new uploads.
+type StorageLayout string
+
+const (
+	// LayoutFlat stores every object as files/<hash>
+	LayoutFlat StorageLayout = "flat"
+	// LayoutSharded spreads objects over files/<h[0:2]>/<h[2:4]>/<hash> to avoid a single hot prefix
+	LayoutSharded StorageLayout = "sharded"
+)
+
+// ParseStorageLayout validates a layout name from configuration; empty means flat.
+func ParseStorageLayout(name string) (StorageLayout, error) {
+	switch StorageLayout(strings.ToLower(strings.TrimSpace(name))) {
+	case "", LayoutFlat:
+		return LayoutFlat, nil
+	case LayoutSharded:
+		return LayoutSharded, nil
+	}
+	return "", fmt.Errorf("unknown storage layout %q (want %q or %q)", name, LayoutFlat, LayoutSharded)
+}
+
+// ObjectKey returns the key for content with the given hash under this layout.
+func (l StorageLayout) ObjectKey(hash string) string {
+	if l == LayoutSharded && len(hash) >= 4 {
+		return fmt.Sprintf("files/%s/%s/%s", hash[0:2], hash[2:4], hash)
+	}
+	return fmt.Sprintf("files/%s", hash)
+}
+
+// objectKeyCandidates lists where a file's object may live, most likely first: the recorded
+// storage path, then the key under every known layout. Objects moved to another layout
+// without updating the row are still found this way.
+func objectKeyCandidates(f *models.File) []string {
+	var keys []string
+	add := func(k string) {
+		if k == "" {
+			return
+		}
+		for _, existing := range keys {
+			if existing == k {
+				return
+			}
+		}
+		keys = append(keys, k)
+	}
+	add(f.StoragePath)
+	if f.Hash != "" {
+		add(LayoutSharded.ObjectKey(f.Hash))
+		add(LayoutFlat.ObjectKey(f.Hash))
+	}
+	return keys
+}
+
+// objectStatter is satisfied by *minio.Client.
+type objectStatter interface {
+	StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+}
+
+// locateObjectKey returns the first candidate key that exists in the bucket. When none can
+// be confirmed the recorded storage path is returned so callers behave as before.
+func locateObjectKey(ctx context.Context, st objectStatter, bucket string, f *models.File) string {
+	keys := objectKeyCandidates(f)
+	if len(keys) <= 1 {
+		return f.StoragePath
+	}
+	for _, k := range keys {
+		if _, err := st.StatObject(ctx, bucket, k, minio.StatObjectOptions{}); err == nil {
+			return k
+		}
+	}
+	return keys[0]
+}
+
+// ObjectKey returns the key the file's content is actually stored under. Rows already on
+// the configured layout are trusted as is; others are checked under both layouts so objects
+// written before a layout change stay reachable.
+func (s *FileService) ObjectKey(ctx context.Context, f *models.File) string {
+	if s == nil || s.Minio == nil || f.StoragePath == s.StorageLayout.ObjectKey(f.Hash) {
+		return f.StoragePath
+	}
+	return locateObjectKey(ctx, s.Minio, s.Bucket, f)
+}
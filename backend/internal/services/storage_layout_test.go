@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+const testHash = "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+
+// stubStatter reports objects as present only for the listed keys
+type stubStatter struct {
+	present map[string]bool
+	stats   []string
+}
+
+func (s *stubStatter) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	s.stats = append(s.stats, objectName)
+	if s.present[objectName] {
+		return minio.ObjectInfo{Key: objectName}, nil
+	}
+	return minio.ObjectInfo{}, errors.New("The specified key does not exist.")
+}
+
+func TestStorageLayout_ObjectKey(t *testing.T) {
+	if got := LayoutFlat.ObjectKey(testHash); got != "files/"+testHash {
+		t.Fatalf("flat key: got %s", got)
+	}
+	if got := LayoutSharded.ObjectKey(testHash); got != "files/ab/cd/"+testHash {
+		t.Fatalf("sharded key: got %s", got)
+	}
+	// The zero value keeps the original flat scheme
+	if got := StorageLayout("").ObjectKey(testHash); got != "files/"+testHash {
+		t.Fatalf("default key: got %s", got)
+	}
+}
+
+func TestParseStorageLayout(t *testing.T) {
+	for in, want := range map[string]StorageLayout{"": LayoutFlat, "flat": LayoutFlat, " Sharded ": LayoutSharded} {
+		got, err := ParseStorageLayout(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseStorageLayout(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseStorageLayout("nested"); err == nil {
+		t.Fatalf("expected error for unknown layout")
+	}
+}
+
+func TestLocateObjectKey_DualRead(t *testing.T) {
+	ctx := context.Background()
+	flat, sharded := LayoutFlat.ObjectKey(testHash), LayoutSharded.ObjectKey(testHash)
+
+	// Row and object both still on the flat scheme: found with one lookup
+	st := &stubStatter{present: map[string]bool{flat: true}}
+	f := &models.File{Hash: testHash, StoragePath: flat}
+	if got := locateObjectKey(ctx, st, "bucket", f); got != flat || len(st.stats) != 1 {
+		t.Fatalf("expected %s after one stat, got %s after %v", flat, got, st.stats)
+	}
+
+	// Object moved to the sharded scheme but the row still records the flat path
+	st = &stubStatter{present: map[string]bool{sharded: true}}
+	if got := locateObjectKey(ctx, st, "bucket", f); got != sharded {
+		t.Fatalf("expected sharded key, got %s", got)
+	}
+
+	// Row recorded under the sharded scheme while the object is still flat
+	st = &stubStatter{present: map[string]bool{flat: true}}
+	f = &models.File{Hash: testHash, StoragePath: sharded}
+	if got := locateObjectKey(ctx, st, "bucket", f); got != flat {
+		t.Fatalf("expected flat key, got %s", got)
+	}
+
+	// Nothing found: fall back to the recorded path
+	st = &stubStatter{}
+	if got := locateObjectKey(ctx, st, "bucket", f); got != sharded {
+		t.Fatalf("expected recorded path as fallback, got %s", got)
+	}
+}
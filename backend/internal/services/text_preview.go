@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// defaultTextPreviewBytes is how much of a file a preview shows when the caller doesn't say
+const defaultTextPreviewBytes = 64 * 1024
+
+// maxTextPreviewBytes caps previews so they stay cheap to serve and render
+const maxTextPreviewBytes = 1024 * 1024
+
+// ErrNotTextFile is returned when a preview is requested for a file that isn't text.
+var ErrNotTextFile = errors.New("file is not a text file")
+
+// textPreviewTypes lists non-text/* MIME types holding source code or other plain text
+var textPreviewTypes = map[string]bool{
+	"application/json":         true,
+	"application/xml":          true,
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/typescript":   true,
+	"application/x-sh":         true,
+	"application/x-yaml":       true,
+	"application/yaml":         true,
+	"application/toml":         true,
+	"application/sql":          true,
+	"application/x-httpd-php":  true,
+	"image/svg+xml":            true,
+}
+
+// TextPreview is the beginning of a text file, for showing it in the browser.
+type TextPreview struct {
+	Content  string
+	MimeType string
+	// Size is the whole file's size in bytes
+	Size int64
+	// Truncated is true when the file continues past Content
+	Truncated bool
+}
+
+// isTextMimeType reports whether files of mimeType can be previewed as text.
+func isTextMimeType(mimeType string) bool {
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	return strings.HasPrefix(mimeType, "text/") || textPreviewTypes[mimeType]
+}
+
+// GetTextPreview returns up to maxBytes from the start of one of the user's text files
+// without downloading all of it. maxBytes of zero or less means 64 KB and is capped at
+// 1 MB. Files whose type isn't text, or whose content turns out to be binary, are
+// refused with ErrNotTextFile. A multi-byte character cut by the limit is left out and
+// bytes that aren't UTF-8 are shown as U+FFFD.
+func (s *FileService) GetTextPreview(ctx context.Context, userID, fileID uuid.UUID, maxBytes int) (*TextPreview, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, ErrStorageUnavailable
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultTextPreviewBytes
+	}
+	if maxBytes > maxTextPreviewBytes {
+		maxBytes = maxTextPreviewBytes
+	}
+	uf, err := s.FileRepo.GetUserFileByFileID(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
+		return nil, fmt.Errorf("not found or unauthorized")
+	}
+	if uf.File.Status == models.FileStatusQuarantined {
+		return nil, ErrFileQuarantined
+	}
+	if !isTextMimeType(uf.File.MimeType) {
+		return nil, fmt.Errorf("%w: %s", ErrNotTextFile, uf.File.MimeType)
+	}
+
+	obj, err := s.openObject(ctx, &uf.File)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	// One byte past the limit tells whether the file goes on
+	head, err := io.ReadAll(io.LimitReader(obj, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	truncated := len(head) > maxBytes
+	if truncated {
+		head = head[:maxBytes]
+		// Drop a character split by the cut rather than showing a replacement character
+		for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(head[i]) {
+				if !utf8.FullRune(head[i:]) {
+					head = head[:i]
+				}
+				break
+			}
+		}
+	}
+	// Text doesn't contain NUL bytes; binary formats nearly always do early on
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, fmt.Errorf("%w: content is binary", ErrNotTextFile)
+	}
+	return &TextPreview{
+		Content:   strings.ToValidUTF8(string(head), "\uFFFD"),
+		MimeType:  uf.File.MimeType,
+		Size:      uf.File.Size,
+		Truncated: truncated,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// previewService serves content as the stored object of every file
+func previewService(repo *stubFileRepo, content string) *FileService {
+	fs := NewFileService(repo, nil, "", "")
+	fs.objectReader = func(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(content)), nil
+	}
+	return fs
+}
+
+func TestFileService_GetTextPreview(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{mimeTypes: map[uuid.UUID]string{fileID: "text/x-go; charset=utf-8"}}
+	fs := previewService(repo, "package main\n\n// héllo\n")
+
+	full, err := fs.GetTextPreview(ctx, userID, fileID, 0)
+	if err != nil || full.Content != "package main\n\n// héllo\n" || full.Truncated {
+		t.Fatalf("expected the whole file, got %+v (%v)", full, err)
+	}
+
+	// The cut lands inside "é"; the partial character is dropped
+	cut, err := fs.GetTextPreview(ctx, userID, fileID, 19)
+	if err != nil || cut.Content != "package main\n\n// h" || !cut.Truncated {
+		t.Fatalf("expected a truncated preview, got %+v (%v)", cut, err)
+	}
+}
+
+func TestFileService_GetTextPreview_CodeTypes(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{mimeTypes: map[uuid.UUID]string{fileID: "application/json"}}
+	if p, err := previewService(repo, `{"a": 1}`).GetTextPreview(ctx, userID, fileID, 0); err != nil || p.Content != `{"a": 1}` {
+		t.Fatalf("expected JSON to preview, got %+v (%v)", p, err)
+	}
+}
+
+func TestFileService_GetTextPreview_RefusesBinary(t *testing.T) {
+	ctx := context.Background()
+	userID, png, disguised := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{mimeTypes: map[uuid.UUID]string{png: "image/png", disguised: "text/plain"}}
+	fs := previewService(repo, "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	if _, err := fs.GetTextPreview(ctx, userID, png, 0); !errors.Is(err, ErrNotTextFile) {
+		t.Fatalf("expected an image to be refused, got %v", err)
+	}
+	// A text type doesn't help content that is binary
+	if _, err := fs.GetTextPreview(ctx, userID, disguised, 0); !errors.Is(err, ErrNotTextFile) {
+		t.Fatalf("expected binary content to be refused, got %v", err)
+	}
+}
+
+func TestFileService_GetTextPreview_CapsLimit(t *testing.T) {
+	ctx := context.Background()
+	userID, fileID := uuid.New(), uuid.New()
+	repo := &stubFileRepo{mimeTypes: map[uuid.UUID]string{fileID: "text/plain"}}
+	fs := previewService(repo, strings.Repeat("x", maxTextPreviewBytes+10))
+
+	p, err := fs.GetTextPreview(ctx, userID, fileID, 10*maxTextPreviewBytes)
+	if err != nil || len(p.Content) != maxTextPreviewBytes || !p.Truncated {
+		t.Fatalf("expected the preview capped at %d bytes, got %d (%v)", maxTextPreviewBytes, len(p.Content), err)
+	}
+}
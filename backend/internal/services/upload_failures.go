@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// uploadFailureError is the logged reason of failures that aren't validation rejections,
+// such as storage errors
+const uploadFailureError = "ERROR"
+
+// defaultUploadFailuresLimit is how many logged failures ListUploadFailures returns by default
+const defaultUploadFailuresLimit = 100
+
+// maxUploadFailuresLimit caps how many logged failures one ListUploadFailures call returns
+const maxUploadFailuresLimit = 500
+
+// recordUploadFailures logs the files of an upload that failed, indexed like uploads. It
+// runs even when the request was cancelled, and a logging error is only printed so the
+// client still sees the failure that happened.
+func (s *FileService) recordUploadFailures(ctx context.Context, userID uuid.UUID, uploads []*graphql.Upload, errs []error) {
+	if s.FailureLog == nil {
+		return
+	}
+	var failures []models.UploadFailure
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		f := models.UploadFailure{UserID: userID, Reason: string(UploadRejectionOf(err)), Message: err.Error()}
+		if f.Reason == "" {
+			f.Reason = uploadFailureError
+		}
+		if up := uploads[i]; up != nil {
+			f.Filename, f.Size = up.Filename, up.Size
+		}
+		failures = append(failures, f)
+	}
+	if err := s.FailureLog.RecordUploadFailures(context.WithoutCancel(ctx), failures); err != nil {
+		log.Printf("failed to record %d upload failures for user %s: %v", len(failures), userID, err)
+	}
+}
+
+// ListUploadFailures returns the newest logged upload failures, of one user when userID is
+// set, for support to review. limit defaults to 100 and is capped at 500. Callers must
+// check admin rights.
+func (s *FileService) ListUploadFailures(ctx context.Context, userID *uuid.UUID, limit int) ([]models.UploadFailure, error) {
+	if s == nil || s.FailureLog == nil {
+		return nil, fmt.Errorf("upload failure log not configured")
+	}
+	if limit <= 0 {
+		limit = defaultUploadFailuresLimit
+	}
+	return s.FailureLog.ListUploadFailures(ctx, userID, min(limit, maxUploadFailuresLimit))
+}
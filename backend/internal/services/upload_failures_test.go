@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+// stubUploadFailureLog keeps recorded failures in memory; err fails every write
+type stubUploadFailureLog struct {
+	recorded []models.UploadFailure
+	err      error
+	// limits records the limit of each ListUploadFailures call
+	limits []int
+}
+
+func (s *stubUploadFailureLog) RecordUploadFailures(ctx context.Context, failures []models.UploadFailure) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.recorded = append(s.recorded, failures...)
+	return nil
+}
+func (s *stubUploadFailureLog) ListUploadFailures(ctx context.Context, userID *uuid.UUID, limit int) ([]models.UploadFailure, error) {
+	s.limits = append(s.limits, limit)
+	var out []models.UploadFailure
+	for _, f := range s.recorded {
+		if userID == nil || f.UserID == *userID {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// failingStorageService stores nothing: every object write fails
+func failingStorageService(repo *stubFileRepo) *FileService {
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.objectWriter = func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+		return errors.New("connection reset")
+	}
+	return fs
+}
+
+func TestFileService_UploadFiles_LogsStorageErrors(t *testing.T) {
+	userID := uuid.New()
+	repo := &stubFileRepo{}
+	fs := failingStorageService(repo)
+	failureLog := &stubUploadFailureLog{}
+	fs.FailureLog = failureLog
+	uploads := []*graphql.Upload{{Filename: "notes.txt", File: strings.NewReader("new content"), Size: 11}}
+
+	if _, _, err := fs.UploadFiles(context.Background(), userID, uploads, "", false); err == nil {
+		t.Fatalf("expected the storage error")
+	}
+	if len(failureLog.recorded) != 1 {
+		t.Fatalf("expected one failure logged, got %+v", failureLog.recorded)
+	}
+	got := failureLog.recorded[0]
+	if got.UserID != userID || got.Filename != "notes.txt" || got.Size != 11 || got.Reason != uploadFailureError || !strings.Contains(got.Message, "connection reset") {
+		t.Fatalf("unexpected logged failure %+v", got)
+	}
+}
+
+func TestFileService_UploadFiles_LoggingErrorKeepsUploadError(t *testing.T) {
+	repo := &stubFileRepo{usage: defaultQuotaBytes}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.FailureLog = &stubUploadFailureLog{err: errors.New("log table missing")}
+
+	_, _, err := fs.UploadFiles(context.Background(), uuid.New(), knownUploads(repo, 1, 1024), "", false)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected the quota error despite the logging failure, got %v", err)
+	}
+}
+
+func TestFileService_ListUploadFailures(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	failureLog := &stubUploadFailureLog{recorded: []models.UploadFailure{{UserID: alice}, {UserID: bob}}}
+	fs := NewFileService(&stubFileRepo{}, nil, "", "")
+
+	if _, err := fs.ListUploadFailures(context.Background(), nil, 0); err == nil {
+		t.Fatalf("expected an error without a failure log")
+	}
+	fs.FailureLog = failureLog
+	if all, err := fs.ListUploadFailures(context.Background(), nil, 0); err != nil || len(all) != 2 {
+		t.Fatalf("expected every failure, got %d (%v)", len(all), err)
+	}
+	if mine, err := fs.ListUploadFailures(context.Background(), &bob, 10000); err != nil || len(mine) != 1 || mine[0].UserID != bob {
+		t.Fatalf("expected bob's failure, got %+v (%v)", mine, err)
+	}
+	if failureLog.limits[0] != defaultUploadFailuresLimit || failureLog.limits[1] != maxUploadFailuresLimit {
+		t.Fatalf("expected default and capped limits, got %v", failureLog.limits)
+	}
+}
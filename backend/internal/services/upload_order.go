@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// UploadOrder decides which files of a batch claim quota first, and so which still fit
+// when the batch runs out of space partway through. The zero value keeps the unordered,
+// fully parallel behaviour of UploadFiles.
+type UploadOrder struct {
+	// SmallestFirst stores files in ascending declared size, fitting as many as possible
+	SmallestFirst bool
+	// Priority ranks each upload, lower first; equal ranks keep submission order.
+	// It must have one entry per upload.
+	Priority []int
+}
+
+// set reports whether an order was requested.
+func (o UploadOrder) set() bool {
+	return o.SmallestFirst || o.Priority != nil
+}
+
+// sequence returns the indexes of uploads in the order they claim quota.
+func (o UploadOrder) sequence(uploads []*graphql.Upload) ([]int, error) {
+	if o.SmallestFirst && o.Priority != nil {
+		return nil, fmt.Errorf("choose either smallest-first or a priority order, not both")
+	}
+	if o.Priority != nil && len(o.Priority) != len(uploads) {
+		return nil, fmt.Errorf("priority needs one entry per file: got %d for %d files", len(o.Priority), len(uploads))
+	}
+	seq := make([]int, len(uploads))
+	for i := range seq {
+		seq[i] = i
+	}
+	switch {
+	case o.SmallestFirst:
+		size := func(i int) int64 {
+			if uploads[i] == nil {
+				return 0
+			}
+			return uploads[i].Size
+		}
+		sort.SliceStable(seq, func(a, b int) bool { return size(seq[a]) < size(seq[b]) })
+	case o.Priority != nil:
+		sort.SliceStable(seq, func(a, b int) bool { return o.Priority[seq[a]] < o.Priority[seq[b]] })
+	}
+	return seq, nil
+}
+
+// uploadTurns lets the files of an ordered batch reserve quota strictly in turn while
+// reading and hashing still run in parallel. A nil *uploadTurns never blocks.
+type uploadTurns struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// next is the lowest turn that hasn't passed yet
+	next   int
+	passed map[int]bool
+}
+
+func newUploadTurns() *uploadTurns {
+	t := &uploadTurns{passed: make(map[int]bool)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// wait blocks until every earlier turn has passed.
+func (t *uploadTurns) wait(turn int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	for t.next < turn {
+		t.cond.Wait()
+	}
+	t.mu.Unlock()
+}
+
+// pass marks a turn as done; passing a turn more than once is harmless.
+func (t *uploadTurns) pass(turn int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.passed[turn] = true
+	for t.passed[t.next] {
+		delete(t.passed, t.next)
+		t.next++
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
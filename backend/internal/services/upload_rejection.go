@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UploadRejection is a machine-readable reason a file of an upload was refused, so clients
+// can show a specific message for each failed file.
+type UploadRejection string
+
+const (
+	// RejectQuota: the file didn't fit the remaining quota
+	RejectQuota UploadRejection = "QUOTA"
+	// RejectMimeMismatch: the content, extension or declared type disagree
+	RejectMimeMismatch UploadRejection = "MIME_MISMATCH"
+	// RejectBlockedType: the file's type is on BlockedMimeTypes
+	RejectBlockedType UploadRejection = "BLOCKED_TYPE"
+	// RejectTooLarge: the file is bigger than MaxFileSize
+	RejectTooLarge UploadRejection = "TOO_LARGE"
+	// RejectNameConflict: the folder has a different file of the same name
+	RejectNameConflict UploadRejection = "NAME_CONFLICT"
+	// RejectEmptyFile: the file has no content and RejectEmptyFiles is set
+	RejectEmptyFile UploadRejection = "EMPTY_FILE"
+	// RejectFlagged: the content scanner flagged the file and QuarantineFlagged isn't set
+	RejectFlagged UploadRejection = "FLAGGED"
+)
+
+// ErrMimeMismatch is wrapped by upload errors for files whose content, extension and
+// declared type disagree.
+var ErrMimeMismatch = errors.New("file type mismatch")
+
+// ErrBlockedType is wrapped by upload errors for files of a blocked type.
+var ErrBlockedType = errors.New("file type not allowed")
+
+// ErrFileTooLarge is wrapped by upload errors for files over the per-file size limit.
+var ErrFileTooLarge = errors.New("file too large")
+
+// ErrEmptyFile is wrapped by upload errors for zero-byte files when they aren't allowed.
+var ErrEmptyFile = errors.New("file is empty")
+
+// Reason classifies the failure; it is empty for errors that aren't validation
+// rejections, such as storage outages.
+func (f UploadFailure) Reason() UploadRejection {
+	return UploadRejectionOf(f.Err)
+}
+
+// UploadRejectionOf classifies an upload error, returning "" when it isn't a rejection.
+func UploadRejectionOf(err error) UploadRejection {
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		return RejectQuota
+	case errors.Is(err, ErrMimeMismatch):
+		return RejectMimeMismatch
+	case errors.Is(err, ErrBlockedType):
+		return RejectBlockedType
+	case errors.Is(err, ErrFileTooLarge):
+		return RejectTooLarge
+	case errors.Is(err, ErrNameConflict):
+		return RejectNameConflict
+	case errors.Is(err, ErrEmptyFile):
+		return RejectEmptyFile
+	case errors.Is(err, ErrContentFlagged):
+		return RejectFlagged
+	}
+	return ""
+}
+
+// ParseBlockedMimeTypes parses a comma-separated list of MIME types uploads may not have,
+// e.g. "application/x-msdownload, video/*"; "type/*" blocks a whole top-level type.
+func ParseBlockedMimeTypes(s string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		major, minor, ok := strings.Cut(t, "/")
+		if !ok || major == "" || minor == "" || major == "*" {
+			return nil, fmt.Errorf("invalid MIME type %q in blocked types", t)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// mimeBlocked reports whether mimeType matches one of blocked.
+func mimeBlocked(mimeType string, blocked []string) bool {
+	major, _, _ := strings.Cut(mimeType, "/")
+	for _, b := range blocked {
+		if b == mimeType || b == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
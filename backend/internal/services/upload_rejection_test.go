@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+func TestFileService_UploadFiles_RejectionReasons(t *testing.T) {
+	const size = 1024
+	cases := []struct {
+		name   string
+		setup  func(fs *FileService, repo *stubFileRepo)
+		upload func(repo *stubFileRepo) *graphql.Upload
+		want   UploadRejection
+	}{
+		{
+			name:   "quota",
+			setup:  func(fs *FileService, repo *stubFileRepo) { repo.usage = defaultQuotaBytes - size + 1 },
+			upload: func(repo *stubFileRepo) *graphql.Upload { return knownUploads(repo, 1, size)[0] },
+			want:   RejectQuota,
+		},
+		{
+			name:  "mime mismatch",
+			setup: func(fs *FileService, repo *stubFileRepo) {},
+			upload: func(repo *stubFileRepo) *graphql.Upload {
+				return &graphql.Upload{Filename: "b.png", File: strings.NewReader("not an image")}
+			},
+			want: RejectMimeMismatch,
+		},
+		{
+			name:  "blocked type",
+			setup: func(fs *FileService, repo *stubFileRepo) { fs.BlockedMimeTypes = []string{"text/html"} },
+			upload: func(repo *stubFileRepo) *graphql.Upload {
+				content := "<html><body>hi</body></html>"
+				repo.filesByHash[hashOf(content)] = &models.File{ID: uuid.New(), Hash: hashOf(content)}
+				return &graphql.Upload{Filename: "page.html", File: strings.NewReader(content)}
+			},
+			want: RejectBlockedType,
+		},
+		{
+			name:  "too large by declared size",
+			setup: func(fs *FileService, repo *stubFileRepo) { fs.MaxFileSize = size - 1 },
+			upload: func(repo *stubFileRepo) *graphql.Upload {
+				up := knownUploads(repo, 1, size)[0]
+				up.Size = size
+				return up
+			},
+			want: RejectTooLarge,
+		},
+		{
+			name:   "too large without a declared size",
+			setup:  func(fs *FileService, repo *stubFileRepo) { fs.MaxFileSize = size - 1 },
+			upload: func(repo *stubFileRepo) *graphql.Upload { return knownUploads(repo, 1, size)[0] },
+			want:   RejectTooLarge,
+		},
+		{
+			name:  "empty file",
+			setup: func(fs *FileService, repo *stubFileRepo) { fs.RejectEmptyFiles = true },
+			upload: func(repo *stubFileRepo) *graphql.Upload {
+				return &graphql.Upload{Filename: "empty.txt", File: strings.NewReader("")}
+			},
+			want: RejectEmptyFile,
+		},
+	}
+	for _, c := range cases {
+		repo := &stubFileRepo{filesByHash: map[string]*models.File{}}
+		fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+		failureLog := &stubUploadFailureLog{}
+		fs.FailureLog = failureLog
+		c.setup(fs, repo)
+		// A valid file next to the rejected one is still stored
+		uploads := []*graphql.Upload{c.upload(repo), namedUploads(repo, 8, "ok.txt")[0]}
+
+		files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", c.name, err)
+		}
+		if len(failures) != 1 || failures[0].Index != 0 || failures[0].Reason() != c.want {
+			t.Fatalf("%s: expected file 0 rejected with %s, got %+v", c.name, c.want, failures)
+		}
+		if len(files) != 1 {
+			t.Fatalf("%s: expected the valid file stored, got %d files", c.name, len(files))
+		}
+		if len(failureLog.recorded) != 1 || failureLog.recorded[0].Reason != string(c.want) || failureLog.recorded[0].Filename != uploads[0].Filename {
+			t.Fatalf("%s: expected the rejection logged as %s, got %+v", c.name, c.want, failureLog.recorded)
+		}
+	}
+}
+
+func TestUploadRejectionOf(t *testing.T) {
+	if got := UploadRejectionOf(errors.New("connection reset")); got != "" {
+		t.Fatalf("expected no reason for an unrelated error, got %q", got)
+	}
+	wrapped := errors.Join(errors.New("upload a.txt"), ErrNameConflict)
+	if got := UploadRejectionOf(wrapped); got != RejectNameConflict {
+		t.Fatalf("expected NAME_CONFLICT, got %q", got)
+	}
+}
+
+func TestParseBlockedMimeTypes(t *testing.T) {
+	types, err := ParseBlockedMimeTypes(" Application/X-MSDownload, ,video/* ")
+	if err != nil || len(types) != 2 || types[0] != "application/x-msdownload" || types[1] != "video/*" {
+		t.Fatalf("unexpected types %v (%v)", types, err)
+	}
+	for _, s := range []string{"exe", "*/*", "video/"} {
+		if _, err := ParseBlockedMimeTypes(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+	if !mimeBlocked("video/mp4", types) || mimeBlocked("image/png", types) {
+		t.Fatalf("unexpected matches for %v", types)
+	}
+}
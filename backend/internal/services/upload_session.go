@@ -0,0 +1,306 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// uploadChunkSize is the size of every chunk of an upload session but the last. Multipart
+// parts other than the last must be at least 5 MiB, and each chunk is held in memory
+// while it is stored.
+const uploadChunkSize int64 = 8 << 20
+
+// maxUploadChunks is the most parts a multipart upload may have, which caps session files
+// at 80 GB
+const maxUploadChunks = 10000
+
+// defaultUploadSessionTTL is how long an upload session stays open when none is configured
+const defaultUploadSessionTTL = 24 * time.Hour
+
+// uploadSessionPrefix is where session chunks are assembled before the file is ingested
+const uploadSessionPrefix = "upload-sessions/"
+
+// expireSessionsBatch is how many expired sessions one listing of the sweep handles
+const expireSessionsBatch = 100
+
+// ErrUploadSessionExpired is returned for sessions past their expiry; the upload has to
+// be started again.
+var ErrUploadSessionExpired = errors.New("upload session expired")
+
+// ErrUploadIncomplete is returned when completing a session that is missing chunks.
+var ErrUploadIncomplete = errors.New("upload incomplete")
+
+// multipartStore is the object storage an upload session assembles its chunks in;
+// minio.Core in production, replaced in tests.
+type multipartStore interface {
+	NewMultipartUpload(ctx context.Context, bucket, object string, opts minio.PutObjectOptions) (string, error)
+	PutObjectPart(ctx context.Context, bucket, object, uploadID string, partID int, data io.Reader, size int64, opts minio.PutObjectPartOptions) (minio.ObjectPart, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	AbortMultipartUpload(ctx context.Context, bucket, object, uploadID string) error
+	GetObject(ctx context.Context, bucket, object string, opts minio.GetObjectOptions) (io.ReadCloser, minio.ObjectInfo, http.Header, error)
+	RemoveObject(ctx context.Context, bucket, object string, opts minio.RemoveObjectOptions) error
+}
+
+// sessionStore returns where upload sessions keep their chunks, or nil when sessions
+// aren't available.
+func (s *FileService) sessionStore() multipartStore {
+	if s == nil || s.UploadSessions == nil {
+		return nil
+	}
+	if s.multipart != nil {
+		return s.multipart
+	}
+	if s.Minio == nil || s.Bucket == "" {
+		return nil
+	}
+	return minio.Core{Client: s.Minio}
+}
+
+// sessionChunks is how many chunks a file of totalSize is uploaded in.
+func sessionChunks(totalSize, chunkSize int64) int {
+	return int((totalSize + chunkSize - 1) / chunkSize)
+}
+
+// sessionChunkSize is the size chunk index of the session must have; only the last chunk
+// may be shorter.
+func sessionChunkSize(session *models.UploadSession, index int) int64 {
+	return min(session.ChunkSize, session.TotalSize-int64(index)*session.ChunkSize)
+}
+
+// InitUploadSession opens a resumable upload of one file of totalSize bytes. The file is
+// then sent with UploadChunk in chunks of the session's ChunkSize, in any order, and
+// stored with CompleteUploadSession. Files over MaxFileSize or the user's remaining quota
+// are refused up front; the quota is checked again when the session completes.
+func (s *FileService) InitUploadSession(ctx context.Context, userID uuid.UUID, filename string, totalSize int64) (*models.UploadSession, error) {
+	store := s.sessionStore()
+	if store == nil {
+		return nil, ErrStorageUnavailable
+	}
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		return nil, fmt.Errorf("filename is required")
+	}
+	if totalSize <= 0 {
+		return nil, fmt.Errorf("total size must be positive")
+	}
+	if s.MaxFileSize > 0 && totalSize > s.MaxFileSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrFileTooLarge, filename, totalSize, s.MaxFileSize)
+	}
+	if sessionChunks(totalSize, uploadChunkSize) > maxUploadChunks {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrFileTooLarge, filename, totalSize, uploadChunkSize*maxUploadChunks)
+	}
+	remaining, err := s.remainingQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totalSize > remaining {
+		return nil, fmt.Errorf("%w: not enough space for %s (%d bytes left)", ErrQuotaExceeded, filename, remaining)
+	}
+
+	ttl := s.UploadSessionTTL
+	if ttl <= 0 {
+		ttl = defaultUploadSessionTTL
+	}
+	key := uploadSessionPrefix + uuid.NewString()
+	multipartID, err := store.NewMultipartUpload(ctx, s.Bucket, key, minio.PutObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start upload: %w", err)
+	}
+	session := &models.UploadSession{
+		UserID:      userID,
+		Filename:    filename,
+		TotalSize:   totalSize,
+		ChunkSize:   uploadChunkSize,
+		ObjectKey:   key,
+		MultipartID: multipartID,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := s.UploadSessions.CreateUploadSession(ctx, session); err != nil {
+		if abortErr := store.AbortMultipartUpload(context.WithoutCancel(ctx), s.Bucket, key, multipartID); abortErr != nil {
+			log.Printf("warning: abort upload %s: %v", key, abortErr)
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// openUploadSession loads one of the user's sessions. Sessions of other users are
+// reported as not found, and expired ones as ErrUploadSessionExpired.
+func (s *FileService) openUploadSession(ctx context.Context, userID, sessionID uuid.UUID) (*models.UploadSession, error) {
+	session, err := s.UploadSessions.GetUploadSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, fmt.Errorf("upload session: %w", repository.ErrNotFound)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadSessionExpired
+	}
+	return session, nil
+}
+
+// UploadChunk stores chunk chunkIndex (counted from 0) of the user's upload session. Every
+// chunk must be exactly the session's ChunkSize bytes except the last, which holds the
+// rest of the file. Chunks may arrive in any order, and sending a chunk again replaces
+// the earlier copy, so a client can retry any chunk it isn't sure was stored.
+func (s *FileService) UploadChunk(ctx context.Context, userID, sessionID uuid.UUID, chunkIndex int, data io.Reader) (*models.UploadPart, error) {
+	store := s.sessionStore()
+	if store == nil {
+		return nil, ErrStorageUnavailable
+	}
+	session, err := s.openUploadSession(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	chunks := sessionChunks(session.TotalSize, session.ChunkSize)
+	if chunkIndex < 0 || chunkIndex >= chunks {
+		return nil, fmt.Errorf("chunk index %d out of range, the upload has %d chunks", chunkIndex, chunks)
+	}
+	want := sessionChunkSize(session, chunkIndex)
+	// Read one byte past the expected size so an oversized chunk is noticed
+	buf, err := io.ReadAll(io.LimitReader(data, want+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) != want {
+		return nil, fmt.Errorf("chunk %d must be %d bytes", chunkIndex, want)
+	}
+	stored, err := store.PutObjectPart(ctx, s.Bucket, session.ObjectKey, session.MultipartID, chunkIndex+1, bytes.NewReader(buf), want, minio.PutObjectPartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store chunk %d: %w", chunkIndex, err)
+	}
+	part := models.UploadPart{ChunkIndex: chunkIndex, ETag: stored.ETag, Size: want}
+	if err := s.UploadSessions.RecordUploadPart(ctx, session.ID, part); err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
+
+// CompleteUploadSession assembles the session's chunks and stores the file like
+// UploadFiles does: it is hashed, checked, deduplicated against content the service
+// already has, and added to the user's root folder with DefaultVisibility. Fails with
+// ErrUploadIncomplete, leaving the session open, while chunks are missing. Once the chunks
+// are assembled the session is closed whatever the outcome, so a file refused here (e.g.
+// over quota) has to be uploaded again.
+func (s *FileService) CompleteUploadSession(ctx context.Context, userID, sessionID uuid.UUID) (*models.UserFile, error) {
+	store := s.sessionStore()
+	if store == nil {
+		return nil, ErrStorageUnavailable
+	}
+	session, err := s.openUploadSession(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := s.UploadSessions.ListUploadParts(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	chunks := sessionChunks(session.TotalSize, session.ChunkSize)
+	completed := make([]minio.CompletePart, 0, chunks)
+	for _, p := range parts {
+		if p.ChunkIndex < chunks && p.Size == sessionChunkSize(session, p.ChunkIndex) {
+			completed = append(completed, minio.CompletePart{PartNumber: p.ChunkIndex + 1, ETag: p.ETag})
+		}
+	}
+	if len(completed) != chunks {
+		return nil, fmt.Errorf("%w: %d of %d chunks received", ErrUploadIncomplete, len(completed), chunks)
+	}
+
+	if _, err := store.CompleteMultipartUpload(ctx, s.Bucket, session.ObjectKey, session.MultipartID, completed, minio.PutObjectOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to assemble upload: %w", err)
+	}
+	// The multipart upload is gone now, so the session can't take more chunks
+	cleanup := context.WithoutCancel(ctx)
+	defer func() {
+		if err := store.RemoveObject(cleanup, s.Bucket, session.ObjectKey, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("warning: remove assembled upload %s: %v", session.ObjectKey, err)
+		}
+		if err := s.UploadSessions.DeleteUploadSession(cleanup, session.ID); err != nil {
+			log.Printf("warning: delete upload session %s: %v", session.ID, err)
+		}
+	}()
+
+	assembled, _, _, err := store.GetObject(ctx, s.Bucket, session.ObjectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer assembled.Close()
+	upload := &graphql.Upload{File: streamOnly{assembled}, Filename: session.Filename, Size: session.TotalSize}
+	files, _, err := s.uploadFiles(ctx, userID, nil, []*graphql.Upload{upload}, "", false, UploadOrder{}, NameConflictAllow, false)
+	if err != nil {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+// streamOnly adapts a reader to graphql.Upload, whose content is only ever read through once.
+type streamOnly struct{ io.Reader }
+
+func (streamOnly) Seek(int64, int) (int64, error) {
+	return 0, errors.New("upload content is not seekable")
+}
+
+// ExpireUploadSessions aborts the multipart uploads of sessions that expired before now,
+// freeing their chunks, and deletes the sessions. Returns how many were expired.
+func (s *FileService) ExpireUploadSessions(ctx context.Context, now time.Time) (int, error) {
+	store := s.sessionStore()
+	if store == nil {
+		return 0, ErrStorageUnavailable
+	}
+	expired := 0
+	for {
+		sessions, err := s.UploadSessions.ListExpiredUploadSessions(ctx, now, expireSessionsBatch)
+		if err != nil {
+			return expired, err
+		}
+		for _, session := range sessions {
+			// An upload that is already gone was completed or aborted before
+			err := store.AbortMultipartUpload(ctx, s.Bucket, session.ObjectKey, session.MultipartID)
+			if err != nil && minio.ToErrorResponse(err).Code != "NoSuchUpload" {
+				return expired, fmt.Errorf("abort upload session %s: %w", session.ID, err)
+			}
+			if err := s.UploadSessions.DeleteUploadSession(ctx, session.ID); err != nil {
+				return expired, err
+			}
+			expired++
+		}
+		if len(sessions) < expireSessionsBatch {
+			return expired, nil
+		}
+	}
+}
+
+// RunUploadSessionExpiry expires abandoned upload sessions immediately and then every
+// interval until ctx is cancelled.
+func (s *FileService) RunUploadSessionExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.ExpireUploadSessions(ctx, time.Now())
+		if err != nil {
+			log.Printf("warning: expire upload sessions: %v", err)
+		} else if n > 0 {
+			log.Printf("expired %d abandoned upload sessions", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
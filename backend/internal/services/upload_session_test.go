@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// stubSessionRepo keeps upload sessions and their parts in memory
+type stubSessionRepo struct {
+	sessions map[uuid.UUID]*models.UploadSession
+	parts    map[uuid.UUID]map[int]models.UploadPart
+}
+
+func newStubSessionRepo() *stubSessionRepo {
+	return &stubSessionRepo{sessions: map[uuid.UUID]*models.UploadSession{}, parts: map[uuid.UUID]map[int]models.UploadPart{}}
+}
+
+func (r *stubSessionRepo) CreateUploadSession(ctx context.Context, session *models.UploadSession) error {
+	session.ID, session.CreatedAt = uuid.New(), time.Now()
+	copied := *session
+	r.sessions[session.ID] = &copied
+	r.parts[session.ID] = map[int]models.UploadPart{}
+	return nil
+}
+
+func (r *stubSessionRepo) GetUploadSession(ctx context.Context, id uuid.UUID) (*models.UploadSession, error) {
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (r *stubSessionRepo) RecordUploadPart(ctx context.Context, sessionID uuid.UUID, part models.UploadPart) error {
+	r.parts[sessionID][part.ChunkIndex] = part
+	return nil
+}
+
+func (r *stubSessionRepo) ListUploadParts(ctx context.Context, sessionID uuid.UUID) ([]models.UploadPart, error) {
+	parts := []models.UploadPart{}
+	for _, p := range r.parts[sessionID] {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].ChunkIndex < parts[j].ChunkIndex })
+	return parts, nil
+}
+
+func (r *stubSessionRepo) DeleteUploadSession(ctx context.Context, id uuid.UUID) error {
+	delete(r.sessions, id)
+	delete(r.parts, id)
+	return nil
+}
+
+func (r *stubSessionRepo) ListExpiredUploadSessions(ctx context.Context, now time.Time, limit int) ([]models.UploadSession, error) {
+	var expired []models.UploadSession
+	for _, s := range r.sessions {
+		if s.ExpiresAt.Before(now) && len(expired) < limit {
+			expired = append(expired, *s)
+		}
+	}
+	return expired, nil
+}
+
+// memMultipart is an in-memory multipart store; parts are keyed by upload ID and part number
+type memMultipart struct {
+	uploads map[string]map[int][]byte
+	objects map[string][]byte
+	aborted []string
+}
+
+func newMemMultipart() *memMultipart {
+	return &memMultipart{uploads: map[string]map[int][]byte{}, objects: map[string][]byte{}}
+}
+
+func (m *memMultipart) NewMultipartUpload(ctx context.Context, bucket, object string, opts minio.PutObjectOptions) (string, error) {
+	id := uuid.NewString()
+	m.uploads[id] = map[int][]byte{}
+	return id, nil
+}
+
+func (m *memMultipart) PutObjectPart(ctx context.Context, bucket, object, uploadID string, partID int, data io.Reader, size int64, opts minio.PutObjectPartOptions) (minio.ObjectPart, error) {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return minio.ObjectPart{}, err
+	}
+	m.uploads[uploadID][partID] = b
+	return minio.ObjectPart{PartNumber: partID, ETag: fmt.Sprintf("etag-%d-%d", partID, len(b)), Size: size}, nil
+}
+
+func (m *memMultipart) CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, parts []minio.CompletePart, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	var buf bytes.Buffer
+	for i, p := range parts {
+		if p.PartNumber != i+1 {
+			return minio.UploadInfo{}, fmt.Errorf("parts out of order: %d at %d", p.PartNumber, i)
+		}
+		buf.Write(m.uploads[uploadID][p.PartNumber])
+	}
+	delete(m.uploads, uploadID)
+	m.objects[object] = buf.Bytes()
+	return minio.UploadInfo{Key: object, Size: int64(buf.Len())}, nil
+}
+
+func (m *memMultipart) AbortMultipartUpload(ctx context.Context, bucket, object, uploadID string) error {
+	delete(m.uploads, uploadID)
+	m.aborted = append(m.aborted, uploadID)
+	return nil
+}
+
+func (m *memMultipart) GetObject(ctx context.Context, bucket, object string, opts minio.GetObjectOptions) (io.ReadCloser, minio.ObjectInfo, http.Header, error) {
+	b, ok := m.objects[object]
+	if !ok {
+		return nil, minio.ObjectInfo{}, nil, fmt.Errorf("no such object %s", object)
+	}
+	return io.NopCloser(bytes.NewReader(b)), minio.ObjectInfo{}, nil, nil
+}
+
+func (m *memMultipart) RemoveObject(ctx context.Context, bucket, object string, opts minio.RemoveObjectOptions) error {
+	delete(m.objects, object)
+	return nil
+}
+
+func newSessionFileService() (*FileService, *stubFileRepo, *stubSessionRepo, *memMultipart, map[string][]byte) {
+	repo := &stubFileRepo{}
+	sessions := newStubSessionRepo()
+	store := newMemMultipart()
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.DefaultQuotaBytes = 64 << 20
+	fs.UploadSessions = sessions
+	fs.multipart = store
+	stored := map[string][]byte{}
+	fs.objectWriter = func(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+		b, err := io.ReadAll(r)
+		stored[key] = b
+		return err
+	}
+	return fs, repo, sessions, store, stored
+}
+
+func TestFileService_UploadSession_OutOfOrderAndDuplicateChunks(t *testing.T) {
+	ctx := context.Background()
+	fs, repo, sessions, store, stored := newSessionFileService()
+	userID := uuid.New()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), int(uploadChunkSize*2/16)+100)
+	session, err := fs.InitUploadSession(ctx, userID, "notes.txt", int64(len(content)))
+	if err != nil {
+		t.Fatalf("init session: %v", err)
+	}
+	if session.ChunkSize != uploadChunkSize || sessionChunks(session.TotalSize, session.ChunkSize) != 3 {
+		t.Fatalf("expected 3 chunks of %d bytes, got %+v", uploadChunkSize, session)
+	}
+	chunk := func(i int) io.Reader {
+		end := min(int64(i+1)*session.ChunkSize, session.TotalSize)
+		return bytes.NewReader(content[int64(i)*session.ChunkSize : end])
+	}
+
+	// The last chunk first, then the first one twice
+	for _, i := range []int{2, 0, 0} {
+		if _, err := fs.UploadChunk(ctx, userID, session.ID, i, chunk(i)); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+	}
+	if _, err := fs.CompleteUploadSession(ctx, userID, session.ID); !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("expected ErrUploadIncomplete with chunk 1 missing, got %v", err)
+	}
+	// Chunks of the wrong size or index, or another user's session, are refused
+	if _, err := fs.UploadChunk(ctx, userID, session.ID, 1, bytes.NewReader(content[:100])); err == nil {
+		t.Fatalf("expected a short chunk refused")
+	}
+	if _, err := fs.UploadChunk(ctx, userID, session.ID, 3, chunk(2)); err == nil {
+		t.Fatalf("expected an out of range chunk refused")
+	}
+	if _, err := fs.UploadChunk(ctx, uuid.New(), session.ID, 1, chunk(1)); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected another user's session not found, got %v", err)
+	}
+
+	if _, err := fs.UploadChunk(ctx, userID, session.ID, 1, chunk(1)); err != nil {
+		t.Fatalf("chunk 1: %v", err)
+	}
+	uf, err := fs.CompleteUploadSession(ctx, userID, session.ID)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	row := repo.filesByHash[hashOf(string(content))]
+	if row == nil || uf.FileID != row.ID || row.Size != int64(len(content)) {
+		t.Fatalf("expected the assembled file stored under its hash, got %+v for %+v", row, uf)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("expected one stored object, got %d", len(stored))
+	}
+	for _, b := range stored {
+		if !bytes.Equal(b, content) {
+			t.Fatalf("expected the stored object to match the uploaded file")
+		}
+	}
+	if len(sessions.sessions) != 0 || len(store.objects) != 0 {
+		t.Fatalf("expected the session and assembled object cleaned up, got %d sessions, %d objects", len(sessions.sessions), len(store.objects))
+	}
+
+	// The same content again is deduplicated like any upload
+	again, err := fs.InitUploadSession(ctx, userID, "copy.txt", int64(len(content)))
+	if err != nil {
+		t.Fatalf("init second session: %v", err)
+	}
+	for i := range 3 {
+		if _, err := fs.UploadChunk(ctx, userID, again.ID, i, chunk(i)); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+	}
+	if _, err := fs.CompleteUploadSession(ctx, userID, again.ID); err != nil {
+		t.Fatalf("complete second session: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("expected duplicate content not stored again, got %d objects", len(stored))
+	}
+}
+
+func TestFileService_InitUploadSession_OverQuota(t *testing.T) {
+	fs, _, sessions, _, _ := newSessionFileService()
+	_, err := fs.InitUploadSession(context.Background(), uuid.New(), "big.bin", fs.DefaultQuotaBytes+1)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if len(sessions.sessions) != 0 {
+		t.Fatalf("expected no session opened")
+	}
+}
+
+func TestFileService_ExpireUploadSessions(t *testing.T) {
+	ctx := context.Background()
+	fs, _, sessions, store, _ := newSessionFileService()
+	fs.UploadSessionTTL = time.Hour
+	userID := uuid.New()
+
+	old, err := fs.InitUploadSession(ctx, userID, "old.txt", 100)
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if _, err := fs.UploadChunk(ctx, userID, old.ID, 0, bytes.NewReader(make([]byte, 100))); err != nil {
+		t.Fatalf("chunk: %v", err)
+	}
+	sessions.sessions[old.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	fresh, err := fs.InitUploadSession(ctx, userID, "fresh.txt", 100)
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	if _, err := fs.CompleteUploadSession(ctx, userID, old.ID); !errors.Is(err, ErrUploadSessionExpired) {
+		t.Fatalf("expected ErrUploadSessionExpired, got %v", err)
+	}
+	n, err := fs.ExpireUploadSessions(ctx, time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("expected one session expired, got %d (%v)", n, err)
+	}
+	if len(store.aborted) != 1 || store.aborted[0] != old.MultipartID {
+		t.Fatalf("expected the expired multipart upload aborted, got %v", store.aborted)
+	}
+	if _, ok := sessions.sessions[old.ID]; ok {
+		t.Fatalf("expected the expired session deleted")
+	}
+	if _, ok := sessions.sessions[fresh.ID]; !ok {
+		t.Fatalf("expected the open session kept")
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrUploadCapacity is returned when the temp upload area has no room for another file.
+// HTTP callers answer it with 503 so clients retry later.
+var ErrUploadCapacity = errors.New("upload temp space is full, try again later")
+
+// UploadSpool is the temp area uploads are written to while they are hashed and checked.
+// It caps the bytes held by in-flight uploads so a flood of large uploads can't fill the disk.
+type UploadSpool struct {
+	// Dir holds the temp files; empty uses the system temp directory
+	Dir string
+	// MaxBytes caps the bytes spooled at once across all uploads; zero means no cap
+	MaxBytes int64
+
+	mu       sync.Mutex
+	inFlight int64
+}
+
+func NewUploadSpool(dir string, maxBytes int64) *UploadSpool {
+	return &UploadSpool{Dir: dir, MaxBytes: maxBytes}
+}
+
+// RemoveStale deletes temp files left behind by a previous process, e.g. after a crash.
+// Call it at startup, before uploads are accepted, and only for a dedicated Dir.
+func (s *UploadSpool) RemoveStale() (int, error) {
+	if s.Dir == "" {
+		return 0, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "upload-*"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, m := range matches {
+		if err := os.Remove(m); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// InFlight returns the bytes currently held by spooled uploads.
+func (s *UploadSpool) InFlight() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight
+}
+
+// HasRoom reports whether n more bytes would currently fit. It only admits requests
+// early; spooling still enforces the cap as bytes arrive.
+func (s *UploadSpool) HasRoom(n int64) bool {
+	if s == nil || s.MaxBytes <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight+n <= s.MaxBytes
+}
+
+func (s *UploadSpool) grow(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxBytes > 0 && s.inFlight+n > s.MaxBytes {
+		return ErrUploadCapacity
+	}
+	s.inFlight += n
+	return nil
+}
+
+func (s *UploadSpool) shrink(n int64) {
+	s.mu.Lock()
+	s.inFlight -= n
+	s.mu.Unlock()
+}
+
+// defaultUploadSpool serves file services without a configured spool.
+var defaultUploadSpool = &UploadSpool{}
+
+// spooledUpload is an upload copied to a temp file. Close removes the file and returns
+// its bytes to the spool; callers defer it so the file goes away on every path, panics included.
+type spooledUpload struct {
+	spool *UploadSpool
+	file  *os.File
+	// Size and Hash describe the full content; Head is its first 512 bytes for sniffing
+	Size int64
+	Hash string
+	Head []byte
+}
+
+// Spool copies r into a temp file, hashing it on the way. A declared size larger than the
+// free space is refused before anything is written.
+func (s *UploadSpool) Spool(r io.Reader, declared int64) (*spooledUpload, error) {
+	if declared > 0 && !s.HasRoom(declared) {
+		return nil, ErrUploadCapacity
+	}
+	f, err := os.CreateTemp(s.Dir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	su := &spooledUpload{spool: s, file: f}
+	h := sha256.New()
+	w := &spoolWriter{su: su, dst: io.MultiWriter(f, h)}
+	if _, err := io.Copy(w, r); err != nil {
+		su.Close()
+		return nil, err
+	}
+	su.Hash = fmt.Sprintf("%x", h.Sum(nil))
+	return su, nil
+}
+
+// spoolWriter charges the spool for each chunk before writing it.
+type spoolWriter struct {
+	su  *spooledUpload
+	dst io.Writer
+}
+
+func (w *spoolWriter) Write(p []byte) (int, error) {
+	if err := w.su.spool.grow(int64(len(p))); err != nil {
+		return 0, err
+	}
+	w.su.Size += int64(len(p))
+	if room := 512 - len(w.su.Head); room > 0 {
+		w.su.Head = append(w.su.Head, p[:min(room, len(p))]...)
+	}
+	return w.dst.Write(p)
+}
+
+// Reader returns the spooled content from the start.
+func (su *spooledUpload) Reader() io.Reader {
+	return io.NewSectionReader(su.file, 0, su.Size)
+}
+
+// Bytes reads the whole spooled content into memory.
+func (su *spooledUpload) Bytes() ([]byte, error) {
+	return io.ReadAll(su.Reader())
+}
+
+// Close removes the temp file and releases its bytes. It is safe to call more than once.
+func (su *spooledUpload) Close() {
+	if su.file == nil {
+		return
+	}
+	name := su.file.Name()
+	su.file.Close()
+	os.Remove(name)
+	su.file = nil
+	su.spool.shrink(su.Size)
+}
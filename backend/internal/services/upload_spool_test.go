@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// assertSpoolEmpty checks no temp files are left and no bytes are still charged.
+func assertSpoolEmpty(t *testing.T, spool *UploadSpool) {
+	t.Helper()
+	entries, err := os.ReadDir(spool.Dir)
+	if err != nil {
+		t.Fatalf("read temp dir: %v", err)
+	}
+	if len(entries) != 0 || spool.InFlight() != 0 {
+		t.Fatalf("expected temp area to be empty, got %d files and %d bytes in flight", len(entries), spool.InFlight())
+	}
+}
+
+func TestUploadSpool_OverCapacity(t *testing.T) {
+	spool := NewUploadSpool(t.TempDir(), 100)
+
+	// Undeclared size: rejected once the stream outgrows the cap
+	if _, err := spool.Spool(strings.NewReader(strings.Repeat("x", 200)), 0); !errors.Is(err, ErrUploadCapacity) {
+		t.Fatalf("expected capacity error while streaming, got %v", err)
+	}
+	assertSpoolEmpty(t, spool)
+
+	// Declared size: rejected before anything is written
+	if _, err := spool.Spool(strings.NewReader("small"), 200); !errors.Is(err, ErrUploadCapacity) {
+		t.Fatalf("expected capacity error for declared size, got %v", err)
+	}
+	assertSpoolEmpty(t, spool)
+
+	held, err := spool.Spool(strings.NewReader(strings.Repeat("x", 80)), 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if spool.HasRoom(40) {
+		t.Fatalf("expected held bytes to count against the cap")
+	}
+	if _, err := spool.Spool(strings.NewReader(strings.Repeat("y", 40)), 0); !errors.Is(err, ErrUploadCapacity) {
+		t.Fatalf("expected second upload to be rejected while the first is held, got %v", err)
+	}
+	held.Close()
+	held.Close()
+	assertSpoolEmpty(t, spool)
+	if !spool.HasRoom(100) {
+		t.Fatalf("expected capacity to be released")
+	}
+}
+
+func TestUploadSpool_Content(t *testing.T) {
+	spool := NewUploadSpool(t.TempDir(), 0)
+	content := strings.Repeat("abc", 400)
+	su, err := spool.Spool(strings.NewReader(content), 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer su.Close()
+	got, err := su.Bytes()
+	if err != nil || string(got) != content {
+		t.Fatalf("expected spooled content back, got %d bytes (%v)", len(got), err)
+	}
+	if su.Size != int64(len(content)) || su.Hash != hashOf(content) || string(su.Head) != content[:512] {
+		t.Fatalf("unexpected size %d, hash %s or head length %d", su.Size, su.Hash, len(su.Head))
+	}
+}
+
+func TestUploadSpool_RemoveStale(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"upload-1", "upload-2", "keep.txt"} {
+		if err := os.WriteFile(dir+"/"+name, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := NewUploadSpool(dir, 0).RemoveStale()
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 stale files removed, got %d (%v)", n, err)
+	}
+	if _, err := os.Stat(dir + "/keep.txt"); err != nil {
+		t.Fatalf("expected unrelated files to be kept: %v", err)
+	}
+}
+
+type panicScanner struct{}
+
+func (panicScanner) Scan(ctx context.Context, filename string, content io.Reader) (bool, string, error) {
+	panic("scanner crashed")
+}
+
+func TestFileService_UploadFiles_CleansUpTempFiles(t *testing.T) {
+	repo, uploads := mixedUploads(t)
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.Spool = NewUploadSpool(t.TempDir(), 1<<20)
+
+	if _, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true); err != nil || len(failures) != 1 {
+		t.Fatalf("expected one mime failure, got %+v (%v)", failures, err)
+	}
+	assertSpoolEmpty(t, fs.Spool)
+
+	// A panic mid-upload fails that file and still removes its temp file
+	fs.Scanner = panicScanner{}
+	retry := []*graphql.Upload{{Filename: "a.txt", File: strings.NewReader("hello")}}
+	_, failures, err := fs.UploadFiles(context.Background(), uuid.New(), retry, "", true)
+	if err != nil || len(failures) != 1 || !strings.Contains(failures[0].Err.Error(), "scanner crashed") {
+		t.Fatalf("expected the panic to fail the file, got %+v (%v)", failures, err)
+	}
+	assertSpoolEmpty(t, fs.Spool)
+}
+
+func TestFileService_UploadFiles_OverCapacity(t *testing.T) {
+	repo := &stubFileRepo{}
+	fs := NewFileService(repo, &minio.Client{}, "bucket", "")
+	fs.Spool = NewUploadSpool(t.TempDir(), 1000)
+	uploads := sizedUploads(repo, 500, 2000)
+
+	files, failures, err := fs.UploadFiles(context.Background(), uuid.New(), uploads, "", true)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected the small file to be stored, got %d (%v)", len(files), err)
+	}
+	if len(failures) != 1 || failures[0].Index != 1 || !errors.Is(failures[0].Err, ErrUploadCapacity) {
+		t.Fatalf("expected the large file to be rejected for capacity, got %+v", failures)
+	}
+	assertSpoolEmpty(t, fs.Spool)
+}
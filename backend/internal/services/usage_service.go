@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/repository"
+)
+
+// usageSnapshotJob is the name the snapshot job reports under in the system status
+const usageSnapshotJob = "usage_snapshots"
+
+// maxUsageHistoryDays caps how far back GetUsageHistory looks
+const maxUsageHistoryDays = 366
+
+// UsageService records daily usage snapshots and serves each user's usage history.
+type UsageService struct {
+	FileRepo  repository.FileRepository
+	UsageRepo repository.UsageRepository
+	// Status receives a job run record after each snapshot pass (optional)
+	Status *StatusService
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+func NewUsageService(fileRepo repository.FileRepository, usageRepo repository.UsageRepository) *UsageService {
+	return &UsageService{FileRepo: fileRepo, UsageRepo: usageRepo, now: time.Now}
+}
+
+// today returns the current UTC day with the time of day cleared.
+func (s *UsageService) today() time.Time {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	y, m, d := now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// SnapshotUsage writes today's logical and attributed usage for every user, using the same
+// queries as the storage usage view. Running it again on the same day overwrites the
+// day's snapshots. Users that fail are skipped; the first failure is returned after the pass.
+func (s *UsageService) SnapshotUsage(ctx context.Context) (int, error) {
+	if s == nil || s.FileRepo == nil || s.UsageRepo == nil {
+		return 0, fmt.Errorf("usage service not configured")
+	}
+	users, err := s.UsageRepo.ListSnapshotUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	day := s.today()
+	written := 0
+	var firstErr error
+	for _, userID := range users {
+		if err := s.snapshotUser(ctx, userID, day); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("snapshot for user %s: %w", userID, err)
+			}
+			continue
+		}
+		written++
+	}
+	return written, firstErr
+}
+
+func (s *UsageService) snapshotUser(ctx context.Context, userID uuid.UUID, day time.Time) error {
+	logical, err := s.FileRepo.GetUserUsageSum(ctx, userID)
+	if err != nil {
+		return err
+	}
+	attributed, err := s.FileRepo.GetUserAttributedUsage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.UsageRepo.UpsertSnapshot(ctx, models.UsageSnapshot{
+		UserID:          userID,
+		Date:            day,
+		LogicalBytes:    logical,
+		AttributedBytes: attributed,
+	})
+}
+
+// GetUsageHistory returns the user's daily snapshots for the last days days, oldest first.
+func (s *UsageService) GetUsageHistory(ctx context.Context, userID uuid.UUID, days int) ([]models.UsageSnapshot, error) {
+	if s == nil || s.UsageRepo == nil {
+		return nil, fmt.Errorf("usage service not configured")
+	}
+	if days <= 0 {
+		return nil, fmt.Errorf("days must be positive")
+	}
+	if days > maxUsageHistoryDays {
+		days = maxUsageHistoryDays
+	}
+	to := s.today()
+	from := to.AddDate(0, 0, -(days - 1))
+	return s.UsageRepo.GetUsageHistory(ctx, userID, from, to)
+}
+
+// Run takes a snapshot immediately and then every interval until ctx is cancelled.
+// Each pass is reported to Status so the admin status view shows the last run.
+func (s *UsageService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.SnapshotUsage(ctx)
+		if err != nil {
+			log.Printf("warning: usage snapshot: %v", err)
+		} else {
+			log.Printf("usage snapshot written for %d users", n)
+		}
+		s.Status.RecordJobRun(usageSnapshotJob, time.Now(), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
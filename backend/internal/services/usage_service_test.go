@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+// stubUsageRepo keeps snapshots keyed by user and day
+type stubUsageRepo struct {
+	users     []uuid.UUID
+	snapshots map[uuid.UUID]map[time.Time]models.UsageSnapshot
+}
+
+func (s *stubUsageRepo) ListSnapshotUsers(ctx context.Context) ([]uuid.UUID, error) {
+	return s.users, nil
+}
+func (s *stubUsageRepo) UpsertSnapshot(ctx context.Context, snap models.UsageSnapshot) error {
+	if s.snapshots == nil {
+		s.snapshots = map[uuid.UUID]map[time.Time]models.UsageSnapshot{}
+	}
+	if s.snapshots[snap.UserID] == nil {
+		s.snapshots[snap.UserID] = map[time.Time]models.UsageSnapshot{}
+	}
+	s.snapshots[snap.UserID][snap.Date] = snap
+	return nil
+}
+func (s *stubUsageRepo) GetUsageHistory(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]models.UsageSnapshot, error) {
+	var out []models.UsageSnapshot
+	for day, snap := range s.snapshots[userID] {
+		if !day.Before(from) && !day.After(to) {
+			out = append(out, snap)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out, nil
+}
+
+func TestUsageService_SnapshotUsage(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	files := &stubFileRepo{
+		usageByUser:      map[uuid.UUID]int64{alice: 300, bob: 50},
+		attributedByUser: map[uuid.UUID]int64{alice: 200, bob: 50},
+	}
+	repo := &stubUsageRepo{users: []uuid.UUID{alice, bob}}
+	svc := NewUsageService(files, repo)
+	svc.now = func() time.Time { return time.Date(2024, 5, 10, 23, 30, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	n, err := svc.SnapshotUsage(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 snapshots, got %d (%v)", n, err)
+	}
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	snap, ok := repo.snapshots[alice][day]
+	if !ok || snap.LogicalBytes != 300 || snap.AttributedBytes != 200 {
+		t.Fatalf("unexpected snapshot for alice: %+v", snap)
+	}
+
+	// a second run on the same day replaces the day's figures
+	files.usageByUser[alice] = 400
+	if _, err := svc.SnapshotUsage(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(repo.snapshots[alice]) != 1 || repo.snapshots[alice][day].LogicalBytes != 400 {
+		t.Fatalf("expected same-day snapshot to be overwritten, got %+v", repo.snapshots[alice])
+	}
+}
+
+func TestUsageService_GetUsageHistory(t *testing.T) {
+	userID := uuid.New()
+	repo := &stubUsageRepo{}
+	today := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		day := today.AddDate(0, 0, -i)
+		repo.UpsertSnapshot(context.Background(), models.UsageSnapshot{UserID: userID, Date: day, LogicalBytes: int64(100 - i)})
+	}
+	svc := NewUsageService(&stubFileRepo{}, repo)
+	svc.now = func() time.Time { return today.Add(8 * time.Hour) }
+
+	history, err := svc.GetUsageHistory(context.Background(), userID, 7)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(history) != 7 {
+		t.Fatalf("expected 7 days of history, got %d", len(history))
+	}
+	if !history[0].Date.Equal(today.AddDate(0, 0, -6)) || !history[6].Date.Equal(today) {
+		t.Fatalf("expected oldest-first window ending today, got %v .. %v", history[0].Date, history[6].Date)
+	}
+
+	if _, err := svc.GetUsageHistory(context.Background(), userID, 0); err == nil {
+		t.Fatalf("expected non-positive days to be rejected")
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/useradityaa/internal/models"
+)
+
+// maxZipSelection caps how many files one selected-files ZIP may contain
+const maxZipSelection = 500
+
+// zipEntryName returns a unique archive name for a file. Path separators are replaced so
+// every entry sits at the top level, and repeated names get " (1)", " (2)", ... before
+// the extension. used tracks the names handed out so far.
+func zipEntryName(name string, used map[string]bool) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+	candidate := name
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// openObject returns a reader over the file's content, decrypted when it is stored encrypted.
+func (s *FileService) openObject(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+	keyID, nonce, err := s.fileEncryption(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.openStoredObject(ctx, f)
+	if err != nil || keyID == "" {
+		return obj, err
+	}
+	if s.Crypto == nil {
+		obj.Close()
+		return nil, ErrEncryptionUnavailable
+	}
+	plain, err := s.Crypto.Decrypt(keyID, nonce, obj)
+	if err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return decryptingReader{Reader: plain, Closer: obj}, nil
+}
+
+// openStoredObject returns a reader over the file's object as stored.
+func (s *FileService) openStoredObject(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+	if s.objectReader != nil {
+		return s.objectReader(ctx, f)
+	}
+	if s.Minio == nil || s.Bucket == "" {
+		return nil, ErrStorageUnavailable
+	}
+	return s.Minio.GetObject(ctx, s.Bucket, s.ObjectKey(ctx, f), minio.GetObjectOptions{})
+}
+
+// SelectZipFiles resolves mapping IDs to the files a selected-files ZIP will contain.
+// Mappings that don't belong to the user, are in trash, or hold quarantined content are
+// returned as skipped instead of failing the whole download. Duplicate IDs count once.
+func (s *FileService) SelectZipFiles(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID) ([]models.UserFile, []uuid.UUID, error) {
+	if s == nil || s.FileRepo == nil {
+		return nil, nil, ErrStorageUnavailable
+	}
+	if len(mappingIDs) == 0 {
+		return nil, nil, fmt.Errorf("no files selected")
+	}
+	if len(mappingIDs) > maxZipSelection {
+		return nil, nil, fmt.Errorf("too many files: at most %d can be downloaded at once", maxZipSelection)
+	}
+	var files []models.UserFile
+	var skipped []uuid.UUID
+	seen := make(map[uuid.UUID]bool, len(mappingIDs))
+	for _, id := range mappingIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		uf, err := s.FileRepo.GetUserFileByMappingID(ctx, userID, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if uf == nil || uf.DeletedAt != nil || uf.File.Status == models.FileStatusQuarantined {
+			skipped = append(skipped, id)
+			continue
+		}
+		files = append(files, *uf)
+	}
+	return files, skipped, nil
+}
+
+// StreamSelectedZip writes a ZIP of the user's selected files to w, one object at a time
+// straight from storage, so the archive is never held in memory. Entries use the files'
+// original names with collision suffixes. Mappings the user can't download are skipped
+// and returned. Nothing is written when no selected file can be downloaded.
+func (s *FileService) StreamSelectedZip(ctx context.Context, userID uuid.UUID, mappingIDs []uuid.UUID, w io.Writer) ([]uuid.UUID, error) {
+	files, skipped, err := s.SelectZipFiles(ctx, userID, mappingIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return skipped, fmt.Errorf("none of the selected files can be downloaded")
+	}
+	return skipped, s.WriteZip(ctx, files, w)
+}
+
+// WriteZip streams the given files into a ZIP archive on w. Callers authorize the files
+// first, e.g. with SelectZipFiles.
+func (s *FileService) WriteZip(ctx context.Context, files []models.UserFile, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool, len(files))
+	for i := range files {
+		f := &files[i].File
+		header := &zip.FileHeader{
+			Name:     zipEntryName(f.OriginalName, used),
+			Method:   zip.Deflate,
+			Modified: files[i].UploadedAt,
+		}
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		obj, err := s.openObject(ctx, f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		_, err = io.Copy(entry, obj)
+		obj.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+)
+
+func TestZipEntryName_Collisions(t *testing.T) {
+	used := map[string]bool{}
+	got := []string{
+		zipEntryName("report.pdf", used),
+		zipEntryName("report.pdf", used),
+		zipEntryName("Report.pdf", used),
+		zipEntryName("notes", used),
+		zipEntryName("notes", used),
+		zipEntryName("a/b.txt", used),
+		zipEntryName("", used),
+	}
+	want := []string{"report.pdf", "report (1).pdf", "Report (2).pdf", "notes", "notes (1)", "a_b.txt", "file"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("entry %d: expected %q, got %q (all: %v)", i, want[i], got[i], got)
+		}
+	}
+}
+
+func TestFileService_StreamSelectedZip(t *testing.T) {
+	user, other := uuid.New(), uuid.New()
+	a, b, trashed, quarantined := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	repo := &stubFileRepo{
+		names:    map[uuid.UUID]string{a: "photo.jpg", b: "photo.jpg", trashed: "old.txt", quarantined: "bad.exe"},
+		statuses: map[uuid.UUID]string{quarantined: models.FileStatusQuarantined},
+	}
+	mapA, mapB := repo.addMapping(user, a), repo.addMapping(user, b)
+	foreign := repo.addMapping(other, a)
+	mapTrashed := repo.addMapping(user, trashed)
+	repo.mappings[len(repo.mappings)-1].deleted = true
+	mapQuarantined := repo.addMapping(user, quarantined)
+
+	fs := NewFileService(repo, nil, "", "")
+	fs.objectReader = func(ctx context.Context, f *models.File) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("content of " + f.ID.String())), nil
+	}
+
+	var buf bytes.Buffer
+	selection := []uuid.UUID{mapA, foreign, mapB, mapTrashed, mapQuarantined, uuid.New(), mapA}
+	skipped, err := fs.StreamSelectedZip(context.Background(), user, selection, &buf)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(skipped) != 4 || skipped[0] != foreign || skipped[1] != mapTrashed || skipped[2] != mapQuarantined {
+		t.Fatalf("expected foreign, trashed, quarantined and unknown mappings to be skipped, got %v", skipped)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read zip: %v", err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "photo.jpg" || zr.File[1].Name != "photo (1).jpg" {
+		t.Fatalf("expected two entries with distinct names, got %+v", zr.File)
+	}
+	rc, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatalf("open entry: %v", err)
+	}
+	defer rc.Close()
+	content, _ := io.ReadAll(rc)
+	if string(content) != "content of "+b.String() {
+		t.Fatalf("unexpected entry content %q", content)
+	}
+}
+
+func TestFileService_StreamSelectedZip_NothingAllowed(t *testing.T) {
+	repo := &stubFileRepo{}
+	foreign := repo.addMapping(uuid.New(), uuid.New())
+	fs := NewFileService(repo, nil, "", "")
+
+	var buf bytes.Buffer
+	if _, err := fs.StreamSelectedZip(context.Background(), uuid.New(), []uuid.UUID{foreign}, &buf); err == nil {
+		t.Fatalf("expected an error when no selected file is accessible")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %d bytes", buf.Len())
+	}
+}
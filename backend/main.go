@@ -21,8 +21,10 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/rs/cors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/useradityaa/graph"
+	"github.com/useradityaa/internal/auth"
 	"github.com/useradityaa/internal/config"
 	"github.com/useradityaa/internal/middleware"
 	"github.com/useradityaa/internal/repository"
@@ -36,30 +38,53 @@ import (
 func main() {
 	// Load configuration (loads .env once)
 	cfg := config.Load()
+	activeKeyID, signingKeys, err := cfg.JWTSigningKeys()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	jwtKeys := &auth.KeySet{ActiveKID: activeKeyID, Keys: signingKeys, Issuer: cfg.JWTIssuer, Audience: cfg.JWTAudience}
+
+	// Optional per-request query counting to surface N+1 patterns (off unless DB_QUERY_BUDGET is set)
+	var queryBudget *repository.QueryBudget
+	var dbTracer pgx.QueryTracer
+	if cfg.DBQueryBudget > 0 {
+		queryBudget = &repository.QueryBudget{Limit: cfg.DBQueryBudget, Enforce: cfg.DBQueryBudgetEnforce}
+		dbTracer = queryBudget
+	}
 
-	// Init Postgres
-	db := config.InitDB(cfg.DatabaseURL)
+	// Init Postgres; the timeouts make the server kill runaway queries and stuck transactions
+	dbTimeouts := config.DBTimeouts{Statement: cfg.DBStatementTimeout, IdleInTransaction: cfg.DBIdleInTransactionTimeout}
+	db := config.InitDB(cfg.DatabaseURL, dbTracer, dbTimeouts)
 	defer db.Close()
 
+	// Optional read replica for admin aggregates and download stats (nil = use primary)
+	replicaDB := config.InitReplicaDB(cfg.DatabaseReplicaURL, dbTimeouts)
+	if replicaDB != nil {
+		defer replicaDB.Close()
+	}
+
 	// Run SQL migrations from ./migrations on startup
-	if err := runMigrations(db); err != nil {
+	appliedMigrations, err := runMigrations(db)
+	if err != nil {
 		log.Fatalf("migration error: %v", err)
 	}
 
 	port := cfg.Port
 
-	userRepo := repository.NewUserRepository(db)
+	userRepo := repository.NewUserRepositoryWithReplica(db, replicaDB)
 	fileRepo := repository.NewFileRepository(db)
 	folderRepo := repository.NewFolderRepository(db)
 	shareRepo := repository.NewShareRepository(db)
 	publicLinkRepo := repository.NewPublicLinkRepository(db)
-	fileDownloadRepo := repository.NewFileDownloadRepository(db)
+	fileDownloadRepo := repository.NewFileDownloadRepositoryWithReplica(db, replicaDB)
 	starredRepo := repository.NewStarredRepository(db)
+	usageRepo := repository.NewUsageRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
 
-	folderService := services.NewFolderService(folderRepo)
+	folderService := services.NewFolderService(folderRepo, fileRepo)
 
-	authService := services.AuthService{UserRepo: userRepo}
-	googleService := services.GoogleService{UserRepo: userRepo}
+	authService := services.AuthService{UserRepo: userRepo, JWTKeys: jwtKeys, APITokens: repository.NewAPITokenRepository(db)}
+	googleService := services.GoogleService{UserRepo: userRepo, JWTKeys: jwtKeys, AllowedDomain: cfg.GoogleAllowedDomain}
 
 	// MinIO config (from centralized config)
 	minioEndpoint := cfg.MinioEndpoint
@@ -68,6 +93,10 @@ func main() {
 	minioUseSSL := cfg.MinioUseSSL
 	minioBucket := cfg.MinioBucket
 	minioPublic := cfg.MinioPublicURL
+	publicEndpoints, err := cfg.PublicEndpointsByHost()
+	if err != nil {
+		log.Fatalf("invalid MINIO_PUBLIC_ENDPOINTS: %v", err)
+	}
 
 	var minioClient *minio.Client
 	if minioEndpoint != "" && minioAccessKey != "" && minioSecretKey != "" {
@@ -82,6 +111,20 @@ func main() {
 		}
 	}
 
+	// Maintenance subcommands (e.g. `backend reconcile refcounts`) run once and exit
+	if len(os.Args) > 1 {
+		maintenanceService := services.NewMaintenanceService(repository.NewMaintenanceRepository(db))
+		maintenanceService.DefaultQuotaBytes = cfg.DefaultQuotaBytes
+		if minioClient != nil {
+			maintenanceService.Objects = minioClient
+			maintenanceService.Bucket = minioBucket
+		}
+		if err := runMaintenance(context.Background(), maintenanceService, os.Args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	var fileService *services.FileService
 	if minioClient != nil && minioBucket != "" {
 		// Ensure bucket exists
@@ -97,21 +140,159 @@ func main() {
 		}
 		fmt.Print("Minio client initialized: ", minioClient)
 		fileService = services.NewFileService(fileRepo, minioClient, minioBucket, minioPublic)
+		fileService.MaxFilesPerUpload = cfg.MaxFilesPerUpload
+		fileService.UploadConcurrency = cfg.UploadConcurrency
+		fileService.Folders = folderService
+		fileService.Shares = shareRepo
+		fileService.Users = userRepo
+		layout, err := services.ParseStorageLayout(cfg.StorageLayout)
+		if err != nil {
+			log.Fatalf("invalid STORAGE_LAYOUT: %v", err)
+		}
+		fileService.StorageLayout = layout
+		visibility, err := services.ParseVisibility(cfg.DefaultVisibility)
+		if err != nil {
+			log.Fatalf("invalid DEFAULT_VISIBILITY: %v", err)
+		}
+		fileService.DefaultVisibility = visibility
+		downloadName, err := services.ParseDownloadNameTemplate(cfg.DownloadFilenameTemplate)
+		if err != nil {
+			log.Fatalf("invalid DOWNLOAD_FILENAME_TEMPLATE: %v", err)
+		}
+		fileService.DownloadName = downloadName
+		deleteMode, err := services.ParseDeleteMode(cfg.DeleteMode)
+		if err != nil {
+			log.Fatalf("invalid DELETE_MODE: %v", err)
+		}
+		fileService.DeleteMode = deleteMode
+		fileService.MaxFileSize = int64(cfg.MaxUploadFileMB) << 20
+		if cfg.DefaultQuotaBytes <= 0 {
+			log.Fatalf("invalid DEFAULT_QUOTA_BYTES: must be positive")
+		}
+		fileService.DefaultQuotaBytes = cfg.DefaultQuotaBytes
+		blocked, err := services.ParseBlockedMimeTypes(cfg.BlockedMimeTypes)
+		if err != nil {
+			log.Fatalf("invalid BLOCKED_MIME_TYPES: %v", err)
+		}
+		fileService.BlockedMimeTypes = blocked
+		fileService.RejectEmptyFiles = !cfg.AllowEmptyFiles
+		fileService.QuarantineFlagged = cfg.QuarantineFlaggedUploads
+		fileService.Scanner = services.NopScanner{}
+		if cfg.ClamAVAddr != "" {
+			fileService.Scanner = &services.ClamAVScanner{Addr: cfg.ClamAVAddr}
+		}
+		fileService.ScanTimeout = cfg.ScanTimeout
+		fileService.FailureLog = repository.NewUploadFailureRepository(db)
+		fileService.UploadSessions = repository.NewUploadSessionRepository(db)
+		fileService.UploadSessionTTL = cfg.UploadSessionTTL
+		if cfg.UploadSessionSweepInterval > 0 {
+			go fileService.RunUploadSessionExpiry(context.Background(), cfg.UploadSessionSweepInterval)
+		}
+		cdn, err := services.NewCDN(cfg.CDNBaseURL, cfg.CDNSigningKey, cfg.CDNURLTTL)
+		if err != nil {
+			log.Fatalf("invalid CDN_BASE_URL: %v", err)
+		}
+		if cdn != nil && cfg.CDNPurgeURL != "" {
+			cdn.Purger = &services.HTTPPurger{URL: cfg.CDNPurgeURL, Token: cfg.CDNPurgeToken}
+		}
+		fileService.CDN = cdn
+		if cfg.EncryptionKeys != "" {
+			keys, err := services.ParseEncryptionKeys(cfg.EncryptionKeys)
+			if err != nil {
+				log.Fatalf("invalid ENCRYPTION_KEYS: %v", err)
+			}
+			provider, err := services.NewAESGCMProvider(keys, cfg.EncryptionKeyID)
+			if err != nil {
+				log.Fatalf("invalid ENCRYPTION_KEYS: %v", err)
+			}
+			fileService.Crypto = provider
+			fileService.DownloadSigningKey = provider.SubKey("download urls")
+			fileService.DownloadVerifyKeys = provider.SubKeys("download urls")[1:]
+			fileService.DownloadBaseURL = cfg.DownloadBaseURL
+		}
+	}
+
+	// Temp area uploads are spooled to while hashing; capped so upload floods can't fill the disk
+	uploadSpool := services.NewUploadSpool(cfg.TempUploadDir, int64(cfg.TempUploadMaxMB)<<20)
+	if cfg.TempUploadDir != "" {
+		if err := os.MkdirAll(cfg.TempUploadDir, 0o700); err != nil {
+			log.Fatalf("invalid TEMP_UPLOAD_DIR: %v", err)
+		}
+		if n, err := uploadSpool.RemoveStale(); err != nil {
+			log.Printf("warning: failed to clean TEMP_UPLOAD_DIR: %v", err)
+		} else if n > 0 {
+			log.Printf("removed %d stale upload temp files", n)
+		}
+	}
+	if fileService != nil {
+		fileService.Spool = uploadSpool
+		// Lock sessions come from a pool of their own so holders can't starve their own queries
+		lockDB := config.InitLockDB(cfg.DatabaseURL, config.DefaultLockSessions)
+		defer lockDB.Close()
+		fileService.Locks = repository.NewFileLocker(lockDB)
+		// Members of an organization are also capped by its shared quota
+		fileService.Orgs = orgRepo
 	}
 
 	// Create services
 	shareService := services.NewShareService(shareRepo, userRepo, fileRepo, folderRepo)
+	shareService.MaxLifetime = cfg.MaxShareLifetime
+	shareService.Files = fileService
+	shareService.TransferRemovesPreviousOwner = cfg.TransferRemovesPreviousOwner
+	if cfg.SMTPAddr != "" {
+		if cfg.SMTPFrom == "" {
+			log.Fatalf("invalid configuration: SMTP_FROM must be set when SMTP_ADDR is")
+		}
+		shareService.Notifier = &services.SMTPNotifier{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			AppURL:   cfg.AppURL,
+		}
+	}
 	publicLinkService := services.NewPublicLinkService(publicLinkRepo, shareRepo, userRepo, fileRepo, folderRepo)
+	publicLinkService.MaxLifetime = cfg.MaxPublicLinkLifetime
+	publicLinkService.MaxActiveLinks = cfg.MaxPublicLinksPerUser
 	adminService := services.NewAdminService(userRepo, fileRepo, folderRepo)
 	fileDownloadService := services.NewFileDownloadService(fileDownloadRepo, fileRepo, shareRepo)
+	fileDownloadService.UserRepo = userRepo
 
 	// Initialize file activity repository and service
 	fileActivityRepo := repository.NewFileActivityRepository(db)
 	fileActivityService := services.NewFileActivityService(fileActivityRepo, fileRepo)
+	fileActivityService.ShareRepo = shareRepo
+	fileActivityService.UserRepo = userRepo
+	adminService.ShareRepo = shareRepo
+	adminService.LinkRepo = publicLinkRepo
+	adminService.ActivityRepo = fileActivityRepo
+	adminService.DownloadRepo = fileDownloadRepo
 
 	// Initialize starred service
 	starredService := services.NewStarredService(starredRepo, fileRepo, folderRepo)
 
+	// Status checks for /readyz and the admin systemStatus query
+	var bucketChecker services.BucketChecker
+	if minioClient != nil {
+		bucketChecker = minioClient
+	}
+	statusService := services.NewStatusService(db, bucketChecker, minioBucket)
+	statusService.MigrationsDir = migrationsDir
+	statusService.AppliedMigrations = appliedMigrations
+	if replicaDB != nil {
+		statusService.Replica = replicaDB
+	}
+
+	// Daily per-user usage snapshots for the usage history view
+	usageService := services.NewUsageService(fileRepo, usageRepo)
+	usageService.Status = statusService
+	if cfg.UsageSnapshotInterval > 0 {
+		go usageService.Run(context.Background(), cfg.UsageSnapshotInterval)
+	}
+
+	organizationService := services.NewOrganizationService(orgRepo)
+	dashboardService := services.NewDashboardService(fileService, fileActivityService, starredService, shareService)
+
 	// Create GraphQL server
 	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{
 		Resolvers: &graph.Resolver{
@@ -125,7 +306,12 @@ func main() {
 			FileDownloadService: fileDownloadService,
 			FileActivityService: fileActivityService,
 			StarredService:      starredService,
+			StatusService:       statusService,
+			UsageService:        usageService,
+			OrganizationService: organizationService,
+			DashboardService:    dashboardService,
 		},
+		Directives: graph.NewDirectiveRoot(),
 	}))
 
 	corsHandler := cors.New(cors.Options{
@@ -133,6 +319,7 @@ func main() {
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"X-Skipped-Files", "Content-Disposition"},
 		AllowCredentials: true,
 	}).Handler
 
@@ -140,12 +327,26 @@ func main() {
 	http.Handle("/", playground.Handler("GraphQL Playground", "/query"))
 
 	// GraphQL endpoint at /query with CORS and auth middleware
-	http.Handle("/query", corsHandler(middleware.AuthMiddleware(srv)))
+	http.Handle("/query", corsHandler(middleware.AuthMiddlewareWithTokens(jwtKeys, &authService, publicEndpointSelector(publicEndpoints, uploadScopeGuard(uploadCapacityGuard(uploadSpool, queryBudgetGuard(queryBudget, compressionGuard(cfg.ResponseCompression, cfg.CompressionMinBytes, srv))))))))
+
+	// Streams a ZIP of selected files; authenticated like /query. Not compressed, since the
+	// archive already is
+	http.Handle("/download/zip", corsHandler(middleware.AuthMiddlewareWithTokens(jwtKeys, &authService, publicEndpointSelector(publicEndpoints, queryBudgetGuard(queryBudget, selectedZipHandler(fileService))))))
+
+	// Serves encrypted files at the signed URLs handed out for them instead of presigned
+	// MinIO URLs; the signature authorizes the download
+	http.Handle("/download/file/", corsHandler(signedDownloadHandler(fileService)))
+
+	// Readiness probe: 200 when all required dependencies are reachable, 503 otherwise
+	http.Handle("/readyz", readinessHandler(statusService))
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// migrationsDir holds the SQL migrations run on startup
+const migrationsDir = "./migrations"
+
 // runMigrations executes all .sql files in ./migrations in lexicographic order.
 // It reads all SQL files from the migrations directory, sorts them alphabetically,
 // and executes them in order against the provided database connection.
@@ -155,12 +356,13 @@ func main() {
 //   - db: PostgreSQL connection pool for executing migration scripts
 //
 // Returns:
+//   - []string: Paths of the migrations that were applied (or were empty)
 //   - error: nil on success, or an error if any migration fails
-func runMigrations(db *pgxpool.Pool) error {
-	dir := "./migrations"
+func runMigrations(db *pgxpool.Pool) ([]string, error) {
+	dir := migrationsDir
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var files []string
 	for _, e := range entries {
@@ -173,19 +375,22 @@ func runMigrations(db *pgxpool.Pool) error {
 		}
 	}
 	sort.Strings(files)
+	var applied []string
 	for _, f := range files {
 		b, err := os.ReadFile(f)
 		if err != nil {
-			return err
+			return applied, err
 		}
 		sql := string(b)
 		if strings.TrimSpace(sql) == "" {
+			applied = append(applied, f)
 			continue
 		}
 		if _, err := db.Exec(context.Background(), sql); err != nil {
-			return fmt.Errorf("failed executing %s: %w", f, err)
+			return applied, fmt.Errorf("failed executing %s: %w", f, err)
 		}
+		applied = append(applied, f)
 		log.Printf("applied migration: %s", filepath.Base(f))
 	}
-	return nil
+	return applied, nil
 }
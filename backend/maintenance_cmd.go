@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/useradityaa/internal/services"
+)
+
+const maintenanceUsage = `usage:
+  backend                                       start the server
+  backend reconcile refcounts [--dry-run]       recompute files.ref_count from active mappings
+  backend reconcile quota                       report users whose stored files exceed the quota
+  backend gc orphans [--dry-run] [--grace 1h]   remove stored objects no file refers to`
+
+// runMaintenance runs one maintenance subcommand to completion and writes its report to out.
+// Subcommands use the same configuration as the server but never start it.
+func runMaintenance(ctx context.Context, svc *services.MaintenanceService, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%s", maintenanceUsage)
+	}
+	cmd := args[0] + " " + args[1]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(out)
+	dryRun := fs.Bool("dry-run", false, "report what would change without changing it")
+	grace := fs.Duration("grace", svc.OrphanGrace, "skip objects younger than this")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v\n%s", fs.Args(), maintenanceUsage)
+	}
+	mode := ""
+	if *dryRun {
+		mode = " (dry run)"
+	}
+
+	switch cmd {
+	case "reconcile refcounts":
+		report, err := svc.ReconcileRefCounts(ctx, *dryRun)
+		if err != nil {
+			return err
+		}
+		for _, c := range report.Drifted {
+			fmt.Fprintf(out, "file %s: ref_count %d, active mappings %d\n", c.FileID, c.RefCount, c.ActiveMappings)
+		}
+		for _, c := range report.Unreferenced {
+			fmt.Fprintf(out, "file %s: no mappings, %d bytes at %s\n", c.FileID, c.Size, c.StoragePath)
+		}
+		fmt.Fprintf(out, "checked %d files, %d drifted, %d fixed, %d unreferenced%s\n",
+			report.Checked, len(report.Drifted), report.Fixed, len(report.Unreferenced), mode)
+	case "reconcile quota":
+		over, err := svc.QuotaDiscrepancies(ctx)
+		if err != nil {
+			return err
+		}
+		for _, d := range over {
+			fmt.Fprintf(out, "user %s: %d bytes used of %d\n", d.UserID, d.UsedBytes, d.QuotaBytes)
+		}
+		fmt.Fprintf(out, "%d users over quota\n", len(over))
+	case "gc orphans":
+		svc.OrphanGrace = *grace
+		report, err := svc.CollectOrphans(ctx, *dryRun)
+		if err != nil {
+			return err
+		}
+		for _, o := range report.Orphans {
+			fmt.Fprintf(out, "orphan %s: %d bytes, last modified %s\n", o.Key, o.Size, o.LastModified.Format("2006-01-02T15:04:05Z07:00"))
+		}
+		fmt.Fprintf(out, "scanned %d objects, %d orphaned, %d removed (%d bytes)%s\n",
+			report.Scanned, len(report.Orphans), report.Removed, report.RemovedBytes, mode)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, maintenanceUsage)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/useradityaa/internal/models"
+	"github.com/useradityaa/internal/services"
+)
+
+type stubMaintenanceRepo struct {
+	counts []models.FileRefCount
+	fixed  int
+}
+
+func (s *stubMaintenanceRepo) ListFileRefCounts(ctx context.Context) ([]models.FileRefCount, error) {
+	return s.counts, nil
+}
+func (s *stubMaintenanceRepo) SetFileRefCount(ctx context.Context, fileID uuid.UUID, refCount int) error {
+	s.fixed++
+	return nil
+}
+func (s *stubMaintenanceRepo) ListUserUsage(ctx context.Context) (map[uuid.UUID]int64, error) {
+	return nil, nil
+}
+func (s *stubMaintenanceRepo) ListUserQuotas(ctx context.Context) (map[uuid.UUID]int64, error) {
+	return nil, nil
+}
+
+func TestRunMaintenance(t *testing.T) {
+	repo := &stubMaintenanceRepo{counts: []models.FileRefCount{
+		{FileID: uuid.New(), RefCount: 3, ActiveMappings: 1, TotalMappings: 1},
+	}}
+	svc := services.NewMaintenanceService(repo)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	if err := runMaintenance(ctx, svc, []string{"reconcile", "refcounts", "--dry-run"}, &out); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if repo.fixed != 0 || !strings.Contains(out.String(), "1 drifted, 0 fixed") || !strings.Contains(out.String(), "dry run") {
+		t.Fatalf("expected a dry-run report, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runMaintenance(ctx, svc, []string{"reconcile", "refcounts"}, &out); err != nil || repo.fixed != 1 {
+		t.Fatalf("expected the drift to be fixed, got %q (%v)", out.String(), err)
+	}
+}
+
+func TestRunMaintenance_Invalid(t *testing.T) {
+	svc := services.NewMaintenanceService(&stubMaintenanceRepo{})
+	for _, args := range [][]string{
+		{"reconcile"},
+		{"reconcile", "everything"},
+		{"gc", "orphans", "--bogus"},
+		{"reconcile", "quota", "extra"},
+	} {
+		if err := runMaintenance(context.Background(), svc, args, &bytes.Buffer{}); err == nil {
+			t.Fatalf("expected %v to be rejected", args)
+		}
+	}
+}
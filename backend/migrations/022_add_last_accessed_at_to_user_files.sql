@@ -0,0 +1,8 @@
+-- Track when a user last opened (previewed/downloaded) each of their files
+ALTER TABLE user_files
+ADD COLUMN IF NOT EXISTS last_accessed_at TIMESTAMP NULL;
+
+-- Supports the per-user "recent" sort
+CREATE INDEX IF NOT EXISTS idx_user_files_user_last_accessed
+  ON user_files (user_id, last_accessed_at DESC)
+  WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+-- Version column for optimistic concurrency on folder updates (e.g. rename)
+ALTER TABLE folders
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,12 @@
+-- ref_count counts active (non-deleted) user_files mappings. Earlier code only
+-- incremented on a user's first mapping and never adjusted on soft-delete, so
+-- bring stored counts in line. Safe to re-run.
+UPDATE files f
+SET ref_count = c.active
+FROM (
+    SELECT f2.id, COUNT(uf.id) FILTER (WHERE uf.deleted_at IS NULL) AS active
+    FROM files f2
+    LEFT JOIN user_files uf ON uf.file_id = f2.id
+    GROUP BY f2.id
+) c
+WHERE c.id = f.id AND f.ref_count <> c.active;
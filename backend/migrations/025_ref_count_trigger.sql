@@ -0,0 +1,23 @@
+-- Maintain files.ref_count as the number of active (non-deleted) user_files
+-- mappings, so application code never increments or decrements it by hand.
+-- Existing rows are reconciled by 024_recompute_file_ref_counts.sql.
+CREATE OR REPLACE FUNCTION sync_file_ref_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE files SET ref_count = (
+            SELECT COUNT(*) FROM user_files WHERE file_id = OLD.file_id AND deleted_at IS NULL
+        ) WHERE id = OLD.file_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE files SET ref_count = (
+            SELECT COUNT(*) FROM user_files WHERE file_id = NEW.file_id AND deleted_at IS NULL
+        ) WHERE id = NEW.file_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_files_sync_ref_count ON user_files;
+CREATE TRIGGER user_files_sync_ref_count
+AFTER INSERT OR DELETE OR UPDATE OF deleted_at, file_id ON user_files
+FOR EACH ROW EXECUTE FUNCTION sync_file_ref_count();
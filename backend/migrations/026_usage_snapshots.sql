@@ -0,0 +1,10 @@
+-- Daily per-user storage usage, written by the usage snapshot job.
+-- user_id has no foreign key so snapshots cover both users and google_users.
+CREATE TABLE IF NOT EXISTS usage_snapshots (
+    user_id UUID NOT NULL,
+    snapshot_date DATE NOT NULL,
+    logical_bytes BIGINT NOT NULL,
+    attributed_bytes BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, snapshot_date)
+);
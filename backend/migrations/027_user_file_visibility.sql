@@ -0,0 +1,19 @@
+-- Visibility is chosen per owner mapping rather than on the deduplicated files row, so one
+-- user publishing content does not change the visibility of another user's identical copy.
+-- 'public' files are readable by any signed-in user; 'private' and 'shared' need a mapping or share.
+ALTER TABLE user_files
+  ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'private';
+
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint WHERE conname = 'chk_user_files_visibility'
+  ) THEN
+    ALTER TABLE user_files
+      ADD CONSTRAINT chk_user_files_visibility CHECK (visibility IN ('private', 'shared', 'public'));
+  END IF;
+END$$;
+
+-- Access checks look for a public owner mapping of a file
+CREATE INDEX IF NOT EXISTS idx_user_files_public ON user_files(file_id)
+  WHERE visibility = 'public' AND role = 'owner' AND deleted_at IS NULL;
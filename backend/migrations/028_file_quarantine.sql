@@ -0,0 +1,18 @@
+-- Uploads flagged by the content scanner can be kept for review instead of rejected.
+-- Quarantined content cannot be downloaded until an admin releases or deletes it.
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active',
+  ADD COLUMN IF NOT EXISTS quarantine_reason TEXT,
+  ADD COLUMN IF NOT EXISTS quarantined_at TIMESTAMPTZ;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint WHERE conname = 'chk_files_status'
+  ) THEN
+    ALTER TABLE files
+      ADD CONSTRAINT chk_files_status CHECK (status IN ('active', 'quarantined'));
+  END IF;
+END$$;
+
+CREATE INDEX IF NOT EXISTS idx_files_quarantined ON files(quarantined_at) WHERE status = 'quarantined';
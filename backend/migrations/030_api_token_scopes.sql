@@ -0,0 +1,3 @@
+-- Scopes limit what an API token may do. Tokens created before scopes existed keep full access.
+ALTER TABLE api_tokens
+  ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT ARRAY['files:read', 'files:write', 'share'];
@@ -0,0 +1,5 @@
+-- 031_filename_match_index.sql
+
+-- Btree on the lowercased name for prefix and exact filename searches; the trigram
+-- index from 008 keeps serving contains searches
+CREATE INDEX IF NOT EXISTS idx_files_original_name_lower ON files (lower(original_name) text_pattern_ops);
@@ -0,0 +1,7 @@
+-- Per-user overrides of MAX_PUBLIC_LINKS_PER_USER, set by admins. 0 means the user may not
+-- create links. user_id has no foreign key so overrides cover both users and google_users.
+CREATE TABLE IF NOT EXISTS public_link_limits (
+  user_id UUID PRIMARY KEY,
+  max_active_links INT NOT NULL CHECK (max_active_links >= 0),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
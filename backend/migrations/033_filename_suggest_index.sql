@@ -0,0 +1,7 @@
+-- 033_filename_suggest_index.sql
+
+-- Covers the mapping side of filename suggestions so a user's active files and their
+-- recency come from the index alone; the name prefix uses idx_files_original_name_lower
+CREATE INDEX IF NOT EXISTS idx_user_files_user_active_recency
+  ON user_files (user_id, file_id) INCLUDE (uploaded_at, last_accessed_at)
+  WHERE deleted_at IS NULL;
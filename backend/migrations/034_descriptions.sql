@@ -0,0 +1,6 @@
+-- 034_descriptions.sql
+
+-- Free-text notes on files and folders. File notes live on the mapping so every user who
+-- stores a file keeps their own; NULL means no description
+ALTER TABLE user_files ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS description TEXT;
@@ -0,0 +1,17 @@
+-- Optional team-level storage pools. A member's remaining space is the smaller of their
+-- personal quota and what is left of the organization's. A user belongs to at most one
+-- organization; user_id has no foreign key so members may be users or google_users.
+CREATE TABLE IF NOT EXISTS organizations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL,
+  quota_bytes BIGINT NOT NULL CHECK (quota_bytes >= 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+  user_id UUID PRIMARY KEY,
+  org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_org ON organization_members(org_id);
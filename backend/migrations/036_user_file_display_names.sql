@@ -0,0 +1,4 @@
+-- Per-mapping name shown instead of files.original_name. Content is deduplicated across
+-- users and uploads, so the name a user gave an upload (or the one it was renamed to, to
+-- avoid a clash in its folder) is kept on their mapping. NULL means the content's name.
+ALTER TABLE user_files ADD COLUMN IF NOT EXISTS display_name TEXT;
@@ -0,0 +1,5 @@
+-- Retention (legal hold) on a user's copy of a file: until retain_until passes, the copy
+-- can't be trashed, purged or deleted with its folder. NULL means no retention
+ALTER TABLE user_files ADD COLUMN IF NOT EXISTS retain_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_user_files_retained ON user_files (file_id) WHERE retain_until IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Per-user storage quota overrides for deployments with different tiers. Users without a
+-- row get the configured default (DEFAULT_QUOTA_BYTES). user_id has no foreign key so
+-- rows may belong to users or google_users, as with organization_members.
+CREATE TABLE IF NOT EXISTS user_quotas (
+  user_id UUID PRIMARY KEY,
+  quota_bytes BIGINT NOT NULL CHECK (quota_bytes >= 0),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,15 @@
+-- Files uploads failed to store (quota, type checks, storage errors), for diagnosing
+-- "upload doesn't work" reports. user_id has no foreign key so rows may belong to users or
+-- google_users, and outlive a deleted account.
+CREATE TABLE IF NOT EXISTS upload_failures (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL,
+  filename TEXT NOT NULL,
+  size BIGINT NOT NULL DEFAULT 0,
+  reason TEXT NOT NULL,
+  message TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_failures_created ON upload_failures (created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_upload_failures_user ON upload_failures (user_id, created_at DESC);
@@ -0,0 +1,26 @@
+-- Resumable uploads: a session is one file uploaded in fixed-size chunks, each stored as a
+-- part of a MinIO multipart upload under object_key. Sessions not completed by expires_at
+-- are aborted by the expiry job. Like upload_failures, user_id has no foreign key so
+-- sessions may belong to users or google_users.
+CREATE TABLE IF NOT EXISTS upload_sessions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL,
+  filename TEXT NOT NULL,
+  total_size BIGINT NOT NULL,
+  chunk_size BIGINT NOT NULL,
+  object_key TEXT NOT NULL,
+  multipart_id TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires ON upload_sessions (expires_at);
+
+-- One row per chunk received; a chunk sent again replaces its row
+CREATE TABLE IF NOT EXISTS upload_session_parts (
+  session_id UUID NOT NULL REFERENCES upload_sessions(id) ON DELETE CASCADE,
+  chunk_index INT NOT NULL,
+  etag TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  PRIMARY KEY (session_id, chunk_index)
+);
@@ -0,0 +1,8 @@
+-- Optional caps on how much a folder can hold, e.g. a shared project folder. A folder's
+-- usage is the size of every active copy in it and its subfolders, whoever uploaded it;
+-- uploads into the folder or below it are refused once they would pass quota_bytes.
+CREATE TABLE IF NOT EXISTS folder_quotas (
+  folder_id UUID PRIMARY KEY REFERENCES folders(id) ON DELETE CASCADE,
+  quota_bytes BIGINT NOT NULL CHECK (quota_bytes >= 0),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+-- Content encrypted at rest (ENCRYPTION_KEYS). encryption_key_id names the master key the
+-- object was encrypted under and encryption_nonce is the random per-file nonce its key is
+-- derived with; both are NULL for objects stored as plaintext. hash stays the SHA-256 of
+-- the plaintext, so deduplication is unaffected.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS encryption_key_id TEXT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS encryption_nonce BYTEA;
+
+-- Finds the files a key rotation still has to re-encrypt
+CREATE INDEX IF NOT EXISTS idx_files_encryption_key ON files (encryption_key_id);
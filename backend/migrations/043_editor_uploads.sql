@@ -0,0 +1,6 @@
+-- Files a share recipient with editor access uploads into someone else's shared folder
+-- are the folder owner's copies, so they show up for everyone the folder is shared with.
+-- added_by records which editor put the copy there; that editor may move it to trash.
+ALTER TABLE user_files ADD COLUMN IF NOT EXISTS added_by UUID;
+
+CREATE INDEX IF NOT EXISTS idx_user_files_added_by ON user_files (added_by) WHERE added_by IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Optional password protection for public links: the bcrypt hash of the password the link
+-- was created with, NULL for links anyone with the token may open.
+ALTER TABLE file_public_links ADD COLUMN IF NOT EXISTS password_hash TEXT;
+ALTER TABLE folder_public_links ADD COLUMN IF NOT EXISTS password_hash TEXT;
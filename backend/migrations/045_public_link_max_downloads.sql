@@ -0,0 +1,3 @@
+-- Optional cap on how many times a public file link may be resolved. Once download_count
+-- reaches max_downloads the link is treated as expired; NULL means no limit.
+ALTER TABLE file_public_links ADD COLUMN IF NOT EXISTS max_downloads BIGINT;
@@ -0,0 +1,15 @@
+-- Deleted folders go to the trash like files do. Deleting a folder with its contents stamps
+-- the folders and files of the subtree with one deleted_at, so recovery can restore exactly
+-- what went out together.
+ALTER TABLE folders
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+
+-- A trashed folder mustn't keep its name taken at its level
+ALTER TABLE folders DROP CONSTRAINT IF EXISTS uq_folder_per_parent;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_folder_per_parent
+  ON folders (user_id, parent_id, name)
+  WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_folders_deleted
+  ON folders (user_id, deleted_at)
+  WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,15 @@
+-- A file has at most one unrevoked public link. Links created before this, or by
+-- concurrent shares, may have left several: keep the newest and revoke the rest.
+UPDATE file_public_links l
+SET revoked_at = NOW()
+WHERE l.revoked_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM file_public_links n
+    WHERE n.file_id = l.file_id
+      AND n.revoked_at IS NULL
+      AND (COALESCE(n.created_at, 'epoch'), n.id) > (COALESCE(l.created_at, 'epoch'), l.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_file_public_links_active
+  ON file_public_links (file_id)
+  WHERE revoked_at IS NULL;
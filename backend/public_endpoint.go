@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/useradityaa/internal/services"
+)
+
+// publicEndpointSelector points presigned URLs of requests arriving for a host listed in
+// endpoints at that host's endpoint. The host comes from X-Forwarded-Host when a reverse
+// proxy sets it, else from the request itself. Unlisted hosts keep the default endpoint,
+// so a client naming an arbitrary host can only pick among configured endpoints.
+func publicEndpointSelector(endpoints map[string]string, next http.Handler) http.Handler {
+	if len(endpoints) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if endpoint, ok := endpointForHost(endpoints, requestHost(r)); ok {
+			r = r.WithContext(services.WithPublicEndpoint(r.Context(), endpoint))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestHost returns the host the client addressed, preferring the first
+// X-Forwarded-Host entry.
+func requestHost(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host, _, _ := strings.Cut(fwd, ",")
+		return strings.ToLower(strings.TrimSpace(host))
+	}
+	return strings.ToLower(r.Host)
+}
+
+// endpointForHost matches host exactly first, then without its port.
+func endpointForHost(endpoints map[string]string, host string) (string, bool) {
+	if endpoint, ok := endpoints[host]; ok {
+		return endpoint, true
+	}
+	if bare, _, err := net.SplitHostPort(host); err == nil {
+		endpoint, ok := endpoints[bare]
+		return endpoint, ok
+	}
+	return "", false
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/useradityaa/internal/services"
+)
+
+func TestPublicEndpointSelector(t *testing.T) {
+	endpoints := map[string]string{
+		"files.example.com": "https://cdn.example.com",
+		"intranet:8080":     "http://minio.internal:9000",
+	}
+	var seen context.Context
+	h := publicEndpointSelector(endpoints, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Context()
+	}))
+
+	cases := []struct {
+		host, forwarded string
+		want            string
+	}{
+		{host: "Files.Example.com", want: "https://cdn.example.com"},
+		{host: "files.example.com:443", want: "https://cdn.example.com"},
+		{host: "intranet:8080", want: "http://minio.internal:9000"},
+		{host: "intranet:9090", want: ""},
+		{host: "internal-lb", forwarded: "files.example.com, internal-lb", want: "https://cdn.example.com"},
+		{host: "files.example.com", forwarded: "evil.example.com", want: ""},
+		{host: "other.example.com", want: ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.Host = c.host
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-Host", c.forwarded)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		got, _ := services.PublicEndpointFromContext(seen)
+		if got != c.want {
+			t.Fatalf("host %q forwarded %q: expected endpoint %q, got %q", c.host, c.forwarded, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/useradityaa/internal/repository"
+)
+
+// queryBudgetGuard counts the database queries each request runs against budget. With
+// no budget configured requests pass through untouched.
+func queryBudgetGuard(budget *repository.QueryBudget, next http.Handler) http.Handler {
+	if budget == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, _ := budget.Track(r.Context(), r.Method+" "+r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
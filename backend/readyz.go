@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/useradityaa/internal/services"
+)
+
+// readiness is the whole /readyz body. Probes are unauthenticated, so dependency errors
+// and job runs stay behind the admin systemStatus query.
+type readiness struct {
+	Status string `json:"status"`
+}
+
+// readinessHandler answers 200 while every required dependency is up and 503 otherwise,
+// saying only whether the instance is ready, degraded or unavailable.
+func readinessHandler(status *services.StatusService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := status.Check(r.Context())
+		body := readiness{Status: "ready"}
+		code := http.StatusOK
+		switch {
+		case !st.Healthy:
+			body.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		case st.Degraded:
+			body.Status = "degraded"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(body)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/useradityaa/internal/services"
+)
+
+type pinger struct{ err error }
+
+func (p pinger) Ping(ctx context.Context) error { return p.err }
+
+type bucketChecker struct{}
+
+func (bucketChecker) BucketExists(ctx context.Context, bucket string) (bool, error) { return true, nil }
+
+func TestReadinessHandler(t *testing.T) {
+	cases := []struct {
+		name     string
+		db       error
+		replica  error
+		wantCode int
+		wantBody string
+	}{
+		{name: "ready", wantCode: http.StatusOK, wantBody: `{"status":"ready"}`},
+		{name: "replica down", replica: errors.New("dial tcp replica.internal:5432: refused"), wantCode: http.StatusOK, wantBody: `{"status":"degraded"}`},
+		{name: "primary down", db: errors.New("dial tcp db.internal:5432: refused"), wantCode: http.StatusServiceUnavailable, wantBody: `{"status":"unavailable"}`},
+	}
+	for _, c := range cases {
+		status := services.NewStatusService(pinger{c.db}, bucketChecker{}, "vault-bucket")
+		status.Replica = pinger{c.replica}
+		rec := httptest.NewRecorder()
+		readinessHandler(status).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != c.wantCode {
+			t.Fatalf("%s: expected %d, got %d", c.name, c.wantCode, rec.Code)
+		}
+		// Nothing about the dependencies reaches anonymous callers
+		if body := strings.TrimSpace(rec.Body.String()); body != c.wantBody {
+			t.Fatalf("%s: expected body %s, got %s", c.name, c.wantBody, body)
+		}
+	}
+}
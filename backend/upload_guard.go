@@ -0,0 +1,49 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/services"
+)
+
+// uploadRetryAfter is the Retry-After hint, in seconds, sent with over-capacity rejections
+const uploadRetryAfter = "30"
+
+// uploadCapacityGuard answers multipart upload requests with 503 while the upload temp
+// area has no room for their body, before any of it is read. Other requests pass through.
+// The spool still enforces its cap per file, since bodies may exceed their estimate
+// or arrive together.
+func uploadCapacityGuard(spool *services.UploadSpool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && isMultipart(r) {
+			// Bodies of unknown length need at least some room
+			if !spool.HasRoom(max(r.ContentLength, 1)) {
+				w.Header().Set("Retry-After", uploadRetryAfter)
+				http.Error(w, services.ErrUploadCapacity.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadScopeGuard answers multipart uploads made with an API token lacking files:write
+// with 403 before the body is read. The @scope directive would refuse the mutation too,
+// but only after the whole upload had been received.
+func uploadScopeGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && isMultipart(r) && !middleware.HasScope(r.Context(), auth.ScopeFilesWrite) {
+			http.Error(w, "forbidden: api token lacks the "+auth.ScopeFilesWrite+" scope", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
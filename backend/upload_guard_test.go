@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/useradityaa/internal/auth"
+	"github.com/useradityaa/internal/middleware"
+	"github.com/useradityaa/internal/services"
+)
+
+func TestUploadCapacityGuard(t *testing.T) {
+	spool := services.NewUploadSpool(t.TempDir(), 1024)
+	served := 0
+	h := uploadCapacityGuard(spool, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+	upload := func(size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(strings.Repeat("x", size)))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := upload(512); rec.Code != http.StatusOK || served != 1 {
+		t.Fatalf("expected upload within capacity to pass, got %d", rec.Code)
+	}
+	rec := upload(2048)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || served != 1 {
+		t.Fatalf("expected over-capacity upload to be rejected with 503, got %d", rec.Code)
+	}
+
+	// Ordinary queries are never held back
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(strings.Repeat("x", 2048)))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if served != 2 {
+		t.Fatalf("expected JSON request to pass the guard")
+	}
+}
+
+func TestUploadScopeGuard(t *testing.T) {
+	served := 0
+	h := uploadScopeGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+	upload := func(ctx func(*http.Request) *http.Request) int {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("--xyz--"))
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, ctx(req))
+		return rec.Code
+	}
+	withToken := func(scopes ...string) func(*http.Request) *http.Request {
+		return func(r *http.Request) *http.Request {
+			ctx := middleware.WithUser(r.Context(), "user-1", false)
+			return r.WithContext(middleware.WithAPIToken(ctx, "token-1", scopes))
+		}
+	}
+
+	if code := upload(withToken(auth.ScopeFilesRead)); code != http.StatusForbidden || served != 0 {
+		t.Fatalf("expected read-only token upload to get 403, got %d", code)
+	}
+	if code := upload(withToken(auth.ScopeFilesWrite)); code != http.StatusOK || served != 1 {
+		t.Fatalf("expected write token upload to pass, got %d", code)
+	}
+	session := func(r *http.Request) *http.Request {
+		return r.WithContext(middleware.WithUser(r.Context(), "user-1", false))
+	}
+	if code := upload(session); code != http.StatusOK || served != 2 {
+		t.Fatalf("expected session upload to pass, got %d", code)
+	}
+}
@@ -141,7 +141,7 @@ export default function MyFiles() {
     if (!newName || newName === folder.name) return;
     setFolderCruding(true);
     try {
-      const data = await gqlFetch<{ renameFolder: boolean }>(MUTATION_RENAME_FOLDER, { folderId: folder.id, newName });
+      const data = await gqlFetch<{ renameFolder: boolean }>(MUTATION_RENAME_FOLDER, { folderId: folder.id, newName, expectedUpdatedAt: folder.updatedAt ?? null });
       if (!data?.renameFolder) throw new Error("Failed to rename folder");
       toast.success("Folder renamed");
       if (currentFolderId === folder.id) setCurrentFolderName(newName);
@@ -11,7 +11,7 @@ export const QUERY_SEARCH_MY_FILES = `
 `;
 
 export const QUERY_MY_FOLDERS = `
-  query MyFolders($parentId: ID) { myFolders(parentId: $parentId) { id name parentId createdAt } }
+  query MyFolders($parentId: ID) { myFolders(parentId: $parentId) { id name parentId createdAt updatedAt } }
 `;
 
 export const QUERY_MY_FOLDER_FILES = `
@@ -35,7 +35,7 @@ export const MUTATION_CREATE_FOLDER = `
 `;
 
 export const MUTATION_RENAME_FOLDER = `
-  mutation Rename($folderId: ID!, $newName: String!) { renameFolder(folderId: $folderId, newName: $newName) }
+  mutation Rename($folderId: ID!, $newName: String!, $expectedUpdatedAt: String) { renameFolder(folderId: $folderId, newName: $newName, expectedUpdatedAt: $expectedUpdatedAt) }
 `;
 
 export const MUTATION_DELETE_FOLDER = `
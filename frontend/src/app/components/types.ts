@@ -63,6 +63,8 @@ export type GqlFolder = {
   parentId?: string | null; 
   /** ISO timestamp when the folder was created */
   createdAt: string; 
+  /** Version timestamp echoed back on rename to detect concurrent edits */
+  updatedAt?: string | null; 
 };
 
 /**